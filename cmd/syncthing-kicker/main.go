@@ -2,11 +2,15 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -20,46 +24,599 @@ func main() {
 	_ = godotenv.Load() // best-effort; do not override env
 
 	check := flag.Bool("check", false, "Check Syncthing folder status and exit")
+	healthcheck := flag.Bool("healthcheck", false, "Check that a running daemon is healthy and exit (for container healthchecks)")
+	checkInstances := flag.String("instance", "", "With --check, comma-separated instances to check (default all)")
+	checkFormat := flag.String("format", "text", "With --check, output format: text or nagios")
+	checkFolders := flag.String("folders", "", "With --check, comma-separated folders to check instead of ST_FOLDERS (also given as arguments)")
+	checkJSON := flag.Bool("json", false, "With --check, print a JSON report, devices included, instead of logs")
+	restoreIntervals := flag.Bool("restore-intervals", false, "Restore the folder rescan intervals ST_MANAGE_RESCAN_INTERVAL changed and exit")
+	printConfig := flag.Bool("print-config", false, "Print the effective settings, secrets redacted, and exit")
 	flag.Parse()
+	nagios := *check && *checkFormat == "nagios"
+	if *check && !nagios && *checkFormat != "text" {
+		fmt.Fprintf(os.Stderr, "unknown --format %q (want text or nagios)\n", *checkFormat)
+		exit(app.ExitStatus(app.ExitConfig))
+	}
+	if nagios && *checkJSON {
+		fmt.Fprintln(os.Stderr, "--json cannot be combined with --format nagios")
+		exit(app.ExitStatus(app.ExitConfig))
+	}
 
 	logger := log.New(os.Stdout, "", log.LstdFlags)
 
 	settings, err := app.LoadSettingsFromEnv()
 	if err != nil {
+		if nagios {
+			nagiosUnknown(fmt.Errorf("failed to load settings: %w", err))
+		}
+		if flag.Arg(0) == "selftest" {
+			_ = app.WriteSelfTestStage(os.Stdout, app.SelfTestStage{Name: "settings", Problems: []string{err.Error()}})
+		}
 		logger.Printf("Failed to load settings: %v", err)
-		os.Exit(1)
+		exit(app.Fatal(app.ErrConfig, err))
 	}
 
-	client, err := syncthing.NewClient(settings.APIURL, settings.APIKey, syncthing.ClientOptions{
-		VerifyTLS:      settings.VerifyTLS,
-		RequestTimeout: seconds(settings.RequestTimeout),
-	})
+	var logFile *app.LogFile
+	if settings.LogFile != "" {
+		logFile, err = app.OpenLogFile(settings.LogFile, settings.LogMaxSizeMB, settings.LogMaxBackups)
+		if err != nil {
+			logger.Printf("Failed to open log file: %v", err)
+			exit(app.Fatal(app.ErrConfig, err))
+		}
+		defer logFile.Close()
+		if settings.LogStdout {
+			logger.SetOutput(io.MultiWriter(os.Stdout, logFile))
+		} else {
+			logger.SetOutput(logFile)
+		}
+	}
+	if nagios {
+		// The plugin output is the only thing allowed on stdout.
+		if logFile != nil {
+			logger.SetOutput(logFile)
+		} else {
+			logger.SetOutput(io.Discard)
+		}
+	}
+	if *check && *checkJSON {
+		// So is the JSON report; logs go to stderr instead.
+		if logFile != nil {
+			logger.SetOutput(logFile)
+		} else {
+			logger.SetOutput(os.Stderr)
+		}
+	}
+	if settings.LogFormat == "json" {
+		// Every line becomes one JSON object with its own time field.
+		logger.SetFlags(0)
+		logger.SetOutput(app.JSONLogWriter(logger.Writer()))
+	}
+
+	for _, w := range settings.Warnings() {
+		logger.Printf("Warning: %s", w)
+	}
+
+	if *printConfig {
+		if err := app.WriteConfig(os.Stdout, settings); err != nil {
+			logger.Printf("Failed to print the settings: %v", err)
+			exit(err)
+		}
+		return
+	}
+
+	if *healthcheck {
+		if err := app.Healthcheck(context.Background(), settings); err != nil {
+			fmt.Fprintf(os.Stderr, "unhealthy: %v\n", err)
+			exit(app.Fatal(app.ErrCheckFailed, err))
+		}
+		return
+	}
+
+	switch flag.Arg(0) {
+	case "history":
+		exit(app.ExitStatus(runHistory(settings, flag.Args()[1:])))
+	case "last":
+		exit(app.ExitStatus(runLast(settings, flag.Args()[1:])))
+	}
+
+	svc := &app.Service{Settings: settings, Logger: logger, ReadOnlyState: *check}
+	if settings.StatsDAddr != "" {
+		svc.StatsD, err = app.NewStatsD(settings.StatsDAddr, settings.StatsDPrefix, settings.StatsDTags)
+		if err != nil {
+			logger.Printf("Failed to initialize StatsD: %v", err)
+			exit(app.Fatal(app.ErrConfig, err))
+		}
+		defer svc.StatsD.Close()
+	}
+
+	clientOpts := func(name, fallback string) syncthing.ClientOptions {
+		var observe func(string, string, int, time.Duration, error)
+		if svc.StatsD != nil {
+			observe = svc.ObserveRequest(name)
+		}
+		return syncthing.ClientOptions{
+			VerifyTLS:           settings.VerifyTLS,
+			RequestTimeout:      seconds(settings.RequestTimeout),
+			MaxErrorBody:        settings.ErrorBodyLimit,
+			FallbackURL:         fallback,
+			MaxIdleConnsPerHost: app.IdleConnsPerHost(settings.ScanWorkers),
+			OnSwitch: func(from, to string) {
+				logger.Printf("Instance %s: switching from %s to %s", name, from, to)
+			},
+			OnRetry: func(method, path string, err error) {
+				logger.Printf("Instance %s: %s %s hit a dropped connection (%v); retrying on a fresh one", name, method, path, err)
+			},
+			OnRequest: observe,
+		}
+	}
+	defaultOpts := clientOpts("default", settings.APIURLFallback)
+	defaultOpts.GUIUser, defaultOpts.GUIPassword = settings.GUIUser, settings.GUIPassword
+	if settings.APIKeyFile != "" {
+		defaultOpts.ReloadKey = func() (string, error) { return app.ReadKeyFile(settings.APIKeyFile) }
+		defaultOpts.OnKeyRotated = svc.KeyRotated("default")
+	}
+	client, err := syncthing.NewClient(settings.APIURL, settings.APIKey, defaultOpts)
 	if err != nil {
 		logger.Printf("Failed to initialize client: %v", err)
-		os.Exit(1)
+		exit(app.Fatal(app.ErrClient, err))
+	}
+
+	instances := map[string]*syncthing.Client{}
+	for _, inst := range settings.Instances {
+		c, err := syncthing.NewClient(inst.APIURL, inst.APIKey, clientOpts(inst.Name, inst.FallbackURL))
+		if err != nil {
+			logger.Printf("Failed to initialize client for instance %s: %v", inst.Name, err)
+			exit(app.Fatal(app.ErrClient, err))
+		}
+		instances[inst.Name] = c
 	}
 
-	svc := &app.Service{Settings: settings, Client: client, Logger: logger}
+	var notifiers []app.Notifier
+	for _, sink := range settings.NotifySinks {
+		n, err := app.NewNotifier(sink)
+		if err != nil {
+			logger.Printf("Failed to initialize notifier %s: %v", sink.Name, err)
+			exit(app.Fatal(app.ErrConfig, err))
+		}
+		notifiers = append(notifiers, n)
+	}
+
+	svc.Client, svc.Instances, svc.Notifiers = client, instances, notifiers
+
+	switch flag.Arg(0) {
+	case "compare":
+		exit(app.ExitStatus(runCompare(svc, flag.Args()[1:])))
+	case "pause", "resume":
+		exit(app.ExitStatus(runPause(svc, flag.Arg(0), flag.Args()[1:])))
+	case "completion":
+		exit(app.ExitStatus(runCompletion(svc, flag.Args()[1:])))
+	case "schedules":
+		exit(app.ExitStatus(runSchedules(svc, logger, flag.Args()[1:])))
+	case "selftest":
+		exit(app.ExitStatus(runSelfTest(svc, logger, flag.Args()[1:])))
+	}
+
+	if *restoreIntervals {
+		if err := svc.RestoreRescanIntervals(context.Background()); err != nil {
+			logger.Printf("Failed to restore rescan intervals: %v", err)
+			exit(err)
+		}
+		return
+	}
 
 	if *check {
-		if err := svc.CheckOnce(context.Background()); err != nil {
+		var names []string
+		if *checkInstances != "" {
+			names = strings.Split(*checkInstances, ",")
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		if settings.RunDeadline > 0 {
+			ctx, cancel = context.WithTimeout(context.Background(), settings.RunDeadline)
+		}
+		defer cancel()
+		folders := svc.Folders()
+		selectors := flag.Args()
+		if *checkFolders != "" {
+			selectors = append(selectors, strings.Split(*checkFolders, ",")...)
+		}
+		if len(selectors) > 0 {
+			if len(names) > 0 {
+				fmt.Fprintln(os.Stderr, "--instance cannot be combined with a folder list; prefix the folders with their instance instead")
+				exit(app.ExitStatus(app.ExitConfig))
+			}
+			folders, err = svc.SelectFolders(ctx, selectors)
+			var unknown *app.UnknownFoldersError
+			switch {
+			case errors.As(err, &unknown):
+				fmt.Fprintf(os.Stderr, "unknown folder(s): %s\n", strings.Join(unknown.Names, ", "))
+				exit(app.ExitStatus(app.ExitConfig))
+			case err != nil && nagios:
+				nagiosUnknown(err)
+			case err != nil:
+				logger.Printf("Check failed: %v", err)
+				exit(err)
+			}
+			names = svc.FolderInstances(folders)
+		}
+		report, err := svc.CheckOnce(ctx, folders, names...)
+		_ = svc.StatsD.Close()
+		if err != nil {
+			if nagios {
+				nagiosUnknown(err)
+			}
 			logger.Printf("Check failed: %v", err)
-			os.Exit(1)
+			exit(app.Fatal(app.ErrCheckFailed, err))
 		}
-		return
+		if nagios {
+			out, code := report.Nagios()
+			fmt.Println(out)
+			exit(app.ExitStatus(code))
+		}
+		if *checkJSON {
+			report.Devices = svc.DeviceReport(ctx, report.Checked())
+			if err := report.WriteJSON(os.Stdout); err != nil {
+				exit(err)
+			}
+			if ctx.Err() != nil {
+				exit(app.Fatal(app.ErrAborted, ctx.Err()))
+			}
+			exit(app.ExitStatus(report.ExitCode()))
+		}
+		if ctx.Err() != nil {
+			logger.Printf("Check stopped at ST_RUN_DEADLINE (%s): %s", settings.RunDeadline, report.DeadlineSummary())
+			exit(app.Fatal(app.ErrAborted, ctx.Err()))
+		}
+		for _, line := range report.LogLines() {
+			logger.Print(line)
+		}
+		exit(app.ExitStatus(report.ExitCode()))
 	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go func() {
+		for range hup {
+			logger.Printf("SIGHUP received; dropping cached folder list")
+			svc.InvalidateFolderCache()
+			if err := svc.ReloadFolderCron(); err != nil {
+				logger.Printf("Failed to reload ST_FOLDER_CRON_FILE: %v; keeping the current schedules", err)
+			}
+			if err := svc.ReloadFolders(); err != nil {
+				logger.Printf("Failed to reload ST_FOLDERS_FILE: %v; keeping the current folders", err)
+			}
+			if logFile != nil {
+				if err := logFile.Reopen(); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to reopen log file: %v\n", err)
+				}
+			}
+		}
+	}()
+
 	if err := svc.Run(ctx); err != nil {
-		if err == context.Canceled {
+		if errors.Is(err, context.Canceled) {
 			return
 		}
 		logger.Printf("Service stopped: %v", err)
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		exit(err)
+	}
+}
+
+// runCompare implements `syncthing-kicker compare [--json] <folder>`. It exits non-zero
+// only when no instance could be queried.
+func runCompare(svc *app.Service, args []string) int {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Print JSON instead of a table")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: syncthing-kicker compare [--json] <folder>")
+		return 2
+	}
+	folder := fs.Arg(0)
+
+	rows := svc.Compare(context.Background(), folder)
+	write := app.WriteCompareTable
+	if *asJSON {
+		write = app.WriteCompareJSON
+	}
+	if err := write(os.Stdout, folder, rows); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for _, r := range rows {
+		if r.Shared || r.Error == "" {
+			return 0
+		}
+	}
+	return 1
+}
+
+// runPause implements `syncthing-kicker pause|resume [--all --yes] [--dry-run] [--json]
+// <folder>...`, with folders named by ID or label. It exits non-zero if a folder could
+// not be updated.
+func runPause(svc *app.Service, cmd string, args []string) int {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	all := fs.Bool("all", false, "Act on every folder of every instance")
+	yes := fs.Bool("yes", false, "Confirm --all")
+	dryRun := fs.Bool("dry-run", false, "Print what would change without changing it (as DRY_RUN)")
+	asJSON := fs.Bool("json", false, "Print JSON instead of a table")
+	_ = fs.Parse(args)
+	if *all == (fs.NArg() > 0) {
+		fmt.Fprintf(os.Stderr, "usage: syncthing-kicker %s [--dry-run] [--json] <folder>... | --all --yes\n", cmd)
+		return 2
+	}
+	if *dryRun {
+		svc.Settings.DryRun = true
+	}
+	if *all && !*yes && !svc.Settings.DryRun {
+		fmt.Fprintf(os.Stderr, "refusing to %s every folder without --yes\n", cmd)
+		return 2
+	}
+	for _, name := range fs.Args() {
+		if app.FolderPattern(name) && !*yes && !svc.Settings.DryRun {
+			fmt.Fprintf(os.Stderr, "refusing to %s the folders matching %q without --yes\n", cmd, name)
+			return 2
+		}
+	}
+
+	ctx := context.Background()
+	refs, err := svc.ResolveFolders(ctx, fs.Args(), *all)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	paused := cmd == "pause"
+	results := svc.SetFoldersPaused(ctx, refs, paused)
+	if *asJSON {
+		if err := writeJSON(map[string]any{"dryRun": svc.Settings.DryRun, "folders": results}); err != nil {
+			return 1
+		}
+	} else if err := app.WritePauseTable(os.Stdout, results, paused, svc.Settings.DryRun); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
 	}
+	for _, r := range results {
+		if r.Error != "" {
+			return 1
+		}
+	}
+	return 0
+}
+
+// runCompletion implements `syncthing-kicker completion [--json] [--sort completion]
+// [folder...]`, listing how far each device sharing the folders (all of them by
+// default) is from completing them.
+func runCompletion(svc *app.Service, args []string) int {
+	fs := flag.NewFlagSet("completion", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Print JSON instead of a table")
+	sortBy := fs.String("sort", "folder", "Order rows by folder, or by completion with the least complete first")
+	_ = fs.Parse(args)
+	if *sortBy != "folder" && *sortBy != "completion" {
+		fmt.Fprintln(os.Stderr, "usage: syncthing-kicker completion [--json] [--sort folder|completion] [folder...]")
+		return 2
+	}
+
+	ctx := context.Background()
+	refs, err := svc.ResolveFolders(ctx, fs.Args(), fs.NArg() == 0)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	rows := svc.CompletionReport(ctx, refs)
+	if *sortBy == "completion" {
+		app.SortByCompletion(rows)
+	}
+	if *asJSON {
+		if err := writeJSON(rows); err != nil {
+			return 1
+		}
+	} else if err := app.WriteCompletionTable(os.Stdout, rows); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for _, r := range rows {
+		if r.Error != "" {
+			return 1
+		}
+	}
+	return 0
+}
+
+// runSchedules implements `syncthing-kicker schedules [--json] [--effective]`: every
+// configured schedule with its next fire times, as GET /api/schedules reports them,
+// or with --effective when each folder's next scan would really go ahead, without
+// starting anything.
+func runSchedules(svc *app.Service, logger *log.Logger, args []string) int {
+	fs := flag.NewFlagSet("schedules", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Print JSON instead of a table")
+	effective := fs.Bool("effective", false, "Show each folder's next scan once pause windows and other rules are applied")
+	_ = fs.Parse(args)
+	if fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: syncthing-kicker schedules [--json] [--effective]")
+		return 2
+	}
+
+	logger.SetOutput(os.Stderr) // keep stdout for the listing
+	if *effective {
+		plans, err := svc.ScanPlans(time.Now())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return app.ExitConfig
+		}
+		if *asJSON {
+			if err := writeJSON(map[string]any{"folders": plans}); err != nil {
+				return 1
+			}
+			return 0
+		}
+		if err := app.WriteScanPlanTable(os.Stdout, plans); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+	infos, err := svc.DescribeSchedules(time.Now())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return app.ExitConfig
+	}
+	if *asJSON {
+		if err := writeJSON(map[string]any{"schedules": infos}); err != nil {
+			return 1
+		}
+		return 0
+	}
+	if err := app.WriteScheduleTable(os.Stdout, infos); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// runSelfTest implements `syncthing-kicker selftest [--notify]`: every stage short of
+// scanning, printed as it runs, then the problems found. It changes nothing, so it
+// can be pointed at production before deploying new settings.
+func runSelfTest(svc *app.Service, logger *log.Logger, args []string) int {
+	fs := flag.NewFlagSet("selftest", flag.ExitOnError)
+	notify := fs.Bool("notify", false, "Send a test event to every notification sink")
+	_ = fs.Parse(args)
+	if fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: syncthing-kicker selftest [--notify]")
+		return 2
+	}
+
+	logger.SetOutput(os.Stderr) // keep stdout for the stages
+	stages := svc.SelfTest(context.Background(), time.Now(), *notify, func(st app.SelfTestStage) {
+		_ = app.WriteSelfTestStage(os.Stdout, st)
+	})
+	var problems []string
+	for _, st := range stages {
+		for _, p := range st.Problems {
+			problems = append(problems, st.Name+": "+p)
+		}
+	}
+	if len(problems) == 0 {
+		fmt.Println("selftest passed")
+		return 0
+	}
+	fmt.Printf("selftest found %d problem(s):\n", len(problems))
+	for _, p := range problems {
+		fmt.Println("  " + p)
+	}
+	return 1
+}
+
+// runHistory implements `syncthing-kicker history [--json] [--limit n]`, reading the
+// daemon's /api/history or, if it is not running, the state file.
+func runHistory(settings app.Settings, args []string) int {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Print JSON instead of a table")
+	limit := fs.Int("limit", 20, "Show at most this many runs (0 for all)")
+	_ = fs.Parse(args)
+
+	runs, source, err := app.FetchHistory(context.Background(), settings)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "history unavailable: %v\n", err)
+		return 1
+	}
+	if *limit > 0 && len(runs) > *limit {
+		runs = runs[len(runs)-*limit:]
+	}
+	if *asJSON {
+		newest := make([]app.RunRecord, 0, len(runs))
+		for i := len(runs) - 1; i >= 0; i-- {
+			newest = append(newest, runs[i])
+		}
+		if err := writeJSON(newest); err != nil {
+			return 1
+		}
+		return 0
+	}
+	fmt.Printf("Recent runs (from %s):\n", source)
+	if err := app.WriteHistoryTable(os.Stdout, runs); err != nil {
+		return 1
+	}
+	return 0
+}
+
+// runLast implements `syncthing-kicker last [--json] <folder>` from ST_STATE_FILE, so
+// it works whether or not the daemon is running.
+func runLast(settings app.Settings, args []string) int {
+	fs := flag.NewFlagSet("last", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Print JSON instead of text")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: syncthing-kicker last [--json] <folder>")
+		return 2
+	}
+	folder := fs.Arg(0)
+	if settings.StateFile == "" {
+		fmt.Fprintln(os.Stderr, "ST_STATE_FILE is not set")
+		return 1
+	}
+	st, ok, err := app.ReadFolderState(settings.StateFile, folder)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot read state file: %v\n", err)
+		return 1
+	}
+	if !ok {
+		fmt.Fprintf(os.Stderr, "no state recorded for folder %s\n", folder)
+		return 1
+	}
+	if *asJSON {
+		if err := writeJSON(map[string]any{"folder": folder, "state": st}); err != nil {
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Printf("Folder %s\n", folder)
+	fmt.Printf("  Last trigger: %s (%s)\n", formatTime(st.LastTrigger), orDash(st.LastResult))
+	if st.LastError != "" {
+		fmt.Printf("  Last error:   %s\n", st.LastError)
+	}
+	fmt.Printf("  Last scan:    %s\n", formatTime(st.LastScan))
+	fmt.Printf("  State:        %s since %s\n", orDash(st.LastState), formatTime(st.LastStateChanged))
+	if st.LastResult == "failed" {
+		return 1
+	}
+	return 0
+}
+
+func writeJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// nagiosUnknown reports err as a Nagios UNKNOWN result and exits.
+func nagiosUnknown(err error) {
+	fmt.Printf("SYNCTHING UNKNOWN - %v\n", err)
+	exit(app.ExitStatus(app.NagiosUnknown))
+}
+
+// exit ends the process with the code app.ExitCode gives err. Every exit goes
+// through here, so wrappers can tell the failure classes apart (see README).
+func exit(err error) {
+	os.Exit(app.ExitCode(err))
 }
 
 func seconds(v float64) time.Duration {
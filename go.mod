@@ -3,6 +3,9 @@ module github.com/rcarmo/syncthing-kicker
 go 1.23
 
 require (
+	github.com/fsnotify/fsnotify v1.8.0
 	github.com/joho/godotenv v1.5.1
 	github.com/robfig/cron/v3 v3.0.1
 )
+
+require golang.org/x/sys v0.13.0 // indirect
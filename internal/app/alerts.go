@@ -0,0 +1,72 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// trackFailureStreak updates the folder's and its instance's consecutive failure
+// counts after a trigger attempt and raises alerts: scan_failed once the folder's
+// streak reaches ST_ALERT_AFTER, scan_still_failing every ST_ALERT_REPEAT while it
+// lasts, and scan_recovered once when a streak that alerted ends. Skipped and
+// dry-run attempts neither extend nor reset a streak, and a timed-out trigger waits
+// for the status check after it (scanAttempt.settled) to say which it was.
+func (s *Service) trackFailureStreak(ctx context.Context, folder, result string, err error) {
+	if _, id := s.splitRef(folder); id == "*" || result == resultSkipped || result == resultDryRun || result == resultAbandoned || result == resultTimeout {
+		return
+	}
+	failed := result == resultFailed
+	threshold := max(s.Settings.AlertAfter, 1)
+	now := time.Now().UTC()
+
+	var ev *NotifyEvent
+	inst, _ := s.splitRef(folder)
+	uerr := s.stateStore().updateFolderAndInstance(folder, instanceName(inst), func(f *FolderState) {
+		if !failed {
+			if f.FailureStreak >= threshold {
+				ev = &NotifyEvent{
+					Type:    eventScanRecovered,
+					Folder:  folder,
+					Message: fmt.Sprintf("Folder %s%s: scans succeed again after %d consecutive failures", folder, s.labelSuffix(folder), f.FailureStreak),
+					Fields:  map[string]any{"streak": f.FailureStreak},
+				}
+			}
+			f.FailureStreak = 0
+			f.LastAlert = time.Time{}
+			return
+		}
+		f.FailureStreak++
+		typ := ""
+		switch {
+		case f.FailureStreak == threshold:
+			typ = eventScanFailed
+		case f.FailureStreak > threshold && s.Settings.AlertRepeat > 0 && now.Sub(f.LastAlert) >= s.Settings.AlertRepeat:
+			typ = eventScanStillFailing
+		default:
+			return
+		}
+		f.LastAlert = now
+		msg := fmt.Sprintf("Folder %s%s: scan failed %d times in a row", folder, s.labelSuffix(folder), f.FailureStreak)
+		fields := map[string]any{"streak": f.FailureStreak}
+		if err != nil {
+			msg += ": " + err.Error()
+			fields["error"] = err.Error()
+		}
+		ev = &NotifyEvent{Type: typ, Folder: folder, Message: msg, Fields: fields}
+	}, func(i *InstanceState) {
+		if failed {
+			i.FailureStreak++
+		} else {
+			i.FailureStreak = 0
+		}
+	})
+	if uerr != nil {
+		s.Logger.Printf("Failed to save state: %v", uerr)
+	}
+
+	if ev != nil {
+		s.log(ctx).Printf("Alert %s: %s", ev.Type, ev.Message)
+		s.notify(*ev)
+	}
+}
@@ -0,0 +1,101 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFailureStreakAlerts(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	rec := &recordingNotifier{}
+	svc := fake.service(t, Settings{AlertAfter: 3, StateFile: filepath.Join(t.TempDir(), "state.json")})
+	svc.Notifiers = []Notifier{rec}
+	ctx := context.Background()
+
+	fake.failScans(http.StatusInternalServerError)
+	for i := 0; i < 4; i++ {
+		svc.triggerScan(ctx, "docs")
+	}
+	svc.notifications.Wait()
+	if got := rec.types(); !slices.Equal(got, []string{eventScanFailed}) {
+		t.Fatalf("expected a single scan_failed after the third failure, got %v", got)
+	}
+	if f := svc.stateStore().folder("docs"); f.FailureStreak != 4 {
+		t.Fatalf("expected streak 4, got %d", f.FailureStreak)
+	}
+
+	h := svc.adminHandler(ctx, make(chan struct{}, 1))
+	if body := adminRequest(t, h, http.MethodGet, "/api/health", "", "").Body.String(); !strings.Contains(body, `"maxFailureStreak":4`) {
+		t.Fatalf("expected max streak in health: %s", body)
+	}
+
+	// The streak survives a restart.
+	restarted := fake.service(t, svc.Settings)
+	if f := restarted.stateStore().folder("docs"); f.FailureStreak != 4 {
+		t.Fatalf("expected persisted streak 4, got %d", f.FailureStreak)
+	}
+
+	fake.failScans(0)
+	svc.triggerScan(ctx, "docs")
+	svc.triggerScan(ctx, "docs")
+	svc.notifications.Wait()
+	if got := rec.types(); !slices.Equal(got, []string{eventScanFailed, eventScanRecovered}) {
+		t.Fatalf("expected exactly one recovery, got %v", got)
+	}
+}
+
+func TestFailureStreakReminders(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	rec := &recordingNotifier{}
+	svc := fake.service(t, Settings{AlertAfter: 1, AlertRepeat: time.Nanosecond})
+	svc.Notifiers = []Notifier{rec}
+
+	fake.failScans(http.StatusInternalServerError)
+	for i := 0; i < 3; i++ {
+		svc.triggerScan(context.Background(), "docs")
+		svc.notifications.Wait()
+	}
+	want := []string{eventScanFailed, eventScanStillFailing, eventScanStillFailing}
+	if got := rec.types(); !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestNoRecoveryWithoutAlert(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	rec := &recordingNotifier{}
+	svc := fake.service(t, Settings{AlertAfter: 3})
+	svc.Notifiers = []Notifier{rec}
+
+	fake.failScans(http.StatusInternalServerError)
+	svc.triggerScan(context.Background(), "docs")
+	fake.failScans(0)
+	svc.triggerScan(context.Background(), "docs")
+	svc.notifications.Wait()
+	if got := rec.types(); len(got) != 0 {
+		t.Fatalf("expected no events for a short streak, got %v", got)
+	}
+}
+
+func TestLoadSettingsAlertAfter(t *testing.T) {
+	os.Clearenv()
+	os.Setenv("ST_API_KEY", "abc123")
+	os.Setenv("ST_CRON", "*/5 * * * *")
+	if s, err := LoadSettingsFromEnv(); err != nil || s.AlertAfter != 3 {
+		t.Fatalf("expected 3 by default, got %d, %v", s.AlertAfter, err)
+	}
+	os.Setenv("ST_ALERT_AFTER", "0")
+	if _, err := LoadSettingsFromEnv(); err == nil || err.Error() != "ST_ALERT_AFTER must be >= 1" {
+		t.Fatalf("expected 0 to be rejected, got %v", err)
+	}
+	os.Setenv("ST_ALERT_AFTER", "x")
+	if _, err := LoadSettingsFromEnv(); err == nil || !strings.Contains(err.Error(), "invalid ST_ALERT_AFTER") {
+		t.Fatalf("expected a non-number to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+const bandwidthTimeout = 10 * time.Second
+
+// BandwidthRule sets Syncthing's global rate limits, in KiB/s (0 is unlimited),
+// whenever its cron expression fires.
+type BandwidthRule struct {
+	Cron     string
+	SendKbps int
+	RecvKbps int
+}
+
+// bandwidthEntry is a BandwidthRule with its parsed schedule.
+type bandwidthEntry struct {
+	rule  BandwidthRule
+	sched cron.Schedule
+}
+
+// bandwidthLookback is how far back the startup reconciliation looks for the rule
+// that fired last, widened step by step so frequent rules stay cheap to evaluate.
+var bandwidthLookback = []time.Duration{time.Hour, 24 * time.Hour, 8 * 24 * time.Hour, 32 * 24 * time.Hour, 367 * 24 * time.Hour}
+
+// lastActivation is the latest time at or before now that sched fired, within a
+// year.
+func lastActivation(sched cron.Schedule, now time.Time) (time.Time, bool) {
+	for _, back := range bandwidthLookback {
+		var last time.Time
+		for t := sched.Next(now.Add(-back)); !t.IsZero() && !t.After(now); t = sched.Next(t) {
+			last = t
+		}
+		if !last.IsZero() {
+			return last, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// currentBandwidthRule is the rule that fired most recently, and when; on a tie the
+// one listed last wins, as it would have run last.
+func currentBandwidthRule(entries []bandwidthEntry, now time.Time) (BandwidthRule, time.Time, bool) {
+	var (
+		rule  BandwidthRule
+		fired time.Time
+	)
+	for _, e := range entries {
+		if t, ok := lastActivation(e.sched, now); ok && !t.Before(fired) {
+			rule, fired = e.rule, t
+		}
+	}
+	return rule, fired, !fired.IsZero()
+}
+
+// bandwidthRules returns the ST_BANDWIDTH_SCHEDULE rules of the current scheduler.
+func (s *Service) bandwidthRules() []bandwidthEntry {
+	s.schedMu.Lock()
+	defer s.schedMu.Unlock()
+	return s.bandwidth
+}
+
+// runBandwidthStartup applies the current ST_BANDWIDTH_SCHEDULE limits in the
+// background.
+func (s *Service) runBandwidthStartup(ctx context.Context) {
+	if len(s.bandwidthRules()) == 0 {
+		return
+	}
+	s.watchers.Add(1)
+	go func() {
+		defer s.watchers.Done()
+		s.applyCurrentBandwidth(ctx)
+	}()
+}
+
+// applyCurrentBandwidth applies the limits of the rule that fired last, so the
+// daemon starts with the limits its schedule says should be in force now.
+func (s *Service) applyCurrentBandwidth(ctx context.Context) {
+	rule, fired, ok := currentBandwidthRule(s.bandwidthRules(), time.Now().In(s.schedulerLocation()))
+	if !ok {
+		s.Logger.Printf("No ST_BANDWIDTH_SCHEDULE rule fired within the last year; leaving bandwidth limits alone")
+		return
+	}
+	s.applyBandwidth(ctx, rule, fmt.Sprintf("startup, schedule '%s' last fired at %s", rule.Cron, fired.Format(time.RFC3339)))
+}
+
+// applyBandwidth sets rule's limits on every instance. The options are read,
+// changed and written back whole, so no other setting is touched; an instance
+// already at the limits is left alone.
+func (s *Service) applyBandwidth(ctx context.Context, rule BandwidthRule, reason string) {
+	for _, inst := range s.instances() {
+		key := joinRef(inst, "*")
+		client := s.client(inst)
+		opts, _, err := client.GetOptions(ctx, bandwidthTimeout)
+		if err != nil {
+			s.logFailure(ctx, key, "bandwidth", err, "Cannot read the options of instance %s to set bandwidth limits: %v", instanceName(inst), err)
+			continue
+		}
+		oldSend, oldRecv := opts.Int("maxSendKbps"), opts.Int("maxRecvKbps")
+		if oldSend == rule.SendKbps && oldRecv == rule.RecvKbps {
+			s.logSuccess(ctx, key, "bandwidth")
+			continue
+		}
+		change := fmt.Sprintf("send %s -> %s, receive %s -> %s",
+			formatKbps(oldSend), formatKbps(rule.SendKbps), formatKbps(oldRecv), formatKbps(rule.RecvKbps))
+		diff := configDiff{
+			Subject: "the options of instance " + instanceName(inst),
+			Changes: []configChange{{"maxSendKbps", oldSend, rule.SendKbps}, {"maxRecvKbps", oldRecv, rule.RecvKbps}},
+		}
+		if s.Settings.DryRun {
+			s.log(ctx).Printf("[dry-run] Would change bandwidth limits on instance %s (%s): %s", instanceName(inst), reason, change)
+			s.logConfigDiff(ctx, diff)
+			continue
+		}
+		opts.SetInt("maxSendKbps", rule.SendKbps)
+		opts.SetInt("maxRecvKbps", rule.RecvKbps)
+		if _, err := client.SetOptions(ctx, opts, bandwidthTimeout); err != nil {
+			s.logFailure(ctx, key, "bandwidth", err, "Failed to set bandwidth limits on instance %s: %v", instanceName(inst), err)
+			continue
+		}
+		s.logSuccess(ctx, key, "bandwidth")
+		s.log(ctx).Printf("Changed bandwidth limits on instance %s (%s): %s", instanceName(inst), reason, change)
+		s.logConfigDiff(ctx, diff)
+	}
+}
+
+func formatKbps(kbps int) string {
+	if kbps == 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d KiB/s", kbps)
+}
@@ -0,0 +1,85 @@
+package app
+
+import (
+	"context"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+func TestCurrentBandwidthRule(t *testing.T) {
+	parser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+	var entries []bandwidthEntry
+	for _, r := range []BandwidthRule{{Cron: "0 8 * * 1-5", SendKbps: 500, RecvKbps: 2000}, {Cron: "0 22 * * *"}} {
+		sched, err := parser.Parse(r.Cron)
+		if err != nil {
+			t.Fatalf("parse %q: %v", r.Cron, err)
+		}
+		entries = append(entries, bandwidthEntry{rule: r, sched: sched})
+	}
+	// 2024-05-06 is a Monday.
+	at := func(day, hour int) time.Time { return time.Date(2024, 5, day, hour, 30, 0, 0, time.UTC) }
+	for _, c := range []struct {
+		now      time.Time
+		wantSend int
+		wantAt   time.Time
+	}{
+		{at(6, 12), 500, time.Date(2024, 5, 6, 8, 0, 0, 0, time.UTC)},
+		{at(6, 23), 0, time.Date(2024, 5, 6, 22, 0, 0, 0, time.UTC)},
+		{at(7, 7), 0, time.Date(2024, 5, 6, 22, 0, 0, 0, time.UTC)},
+		{at(11, 12), 0, time.Date(2024, 5, 10, 22, 0, 0, 0, time.UTC)}, // Saturday: no working-hours limit
+	} {
+		rule, fired, ok := currentBandwidthRule(entries, c.now)
+		if !ok || rule.SendKbps != c.wantSend || !fired.Equal(c.wantAt) {
+			t.Fatalf("at %s: got %+v fired at %s (%v)", c.now.Format("Mon 15:04"), rule, fired, ok)
+		}
+	}
+
+	// A rule that cannot fire within a year is never current.
+	sched, err := parser.Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if _, _, ok := currentBandwidthRule([]bandwidthEntry{{sched: sched}}, at(6, 12)); ok {
+		t.Fatalf("expected no current rule for February 30th")
+	}
+}
+
+func TestApplyBandwidth(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	svc := fake.service(t, Settings{})
+	var buf syncBuffer
+	svc.Logger = log.New(&buf, "", 0)
+	ctx := context.Background()
+	rule := BandwidthRule{Cron: "0 8 * * 1-5", SendKbps: 500, RecvKbps: 2000}
+
+	svc.applyBandwidth(ctx, rule, "schedule '0 8 * * 1-5'")
+	if fake.option("maxSendKbps") != float64(500) || fake.option("maxRecvKbps") != float64(2000) {
+		t.Fatalf("limits not set: %v/%v", fake.option("maxSendKbps"), fake.option("maxRecvKbps"))
+	}
+	if fake.option("globalAnnounceEnabled") != true {
+		t.Fatalf("an unrelated option was lost")
+	}
+	want := "Changed bandwidth limits on instance default (schedule '0 8 * * 1-5'): send unlimited -> 500 KiB/s, receive unlimited -> 2000 KiB/s"
+	if !strings.Contains(buf.String(), want) {
+		t.Fatalf("expected the change to be logged:\n%s", buf.String())
+	}
+
+	// Already at the limits: nothing is written.
+	svc.applyBandwidth(ctx, rule, "startup")
+	if fake.patches != 1 {
+		t.Fatalf("expected one options update, got %d", fake.patches)
+	}
+
+	svc.Settings.DryRun = true
+	svc.applyBandwidth(ctx, BandwidthRule{Cron: "0 22 * * *"}, "schedule '0 22 * * *'")
+	if fake.patches != 1 || fake.option("maxSendKbps") != float64(500) {
+		t.Fatalf("dry run changed the limits")
+	}
+	if !strings.Contains(buf.String(), "[dry-run] Would change bandwidth limits on instance default (schedule '0 22 * * *'): send 500 KiB/s -> unlimited, receive 2000 KiB/s -> unlimited") {
+		t.Fatalf("expected the dry-run change to be logged:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,226 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+// folderCache holds the folder list from /rest/system/config so wildcard
+// expansion does not refetch the (potentially huge) config on every check.
+// The zero value is an empty, ready-to-use cache.
+type folderCache struct {
+	mu         sync.Mutex
+	folders    []syncthing.FolderConfig
+	fetchedAt  time.Time
+	startTime  time.Time // Syncthing start time observed when the list was fetched
+	version    int64     // Syncthing config version observed before the fetch
+	versioned  bool      // whether version could be read; if not, only the TTL applies
+	valid      bool
+	generation int // bumped on every fetch
+
+	// labels maps folder IDs to labels from the last fetch. It has its own lock
+	// because mu is held across fetches and log lines must never wait on one.
+	labelMu sync.RWMutex
+	labels  map[string]string
+}
+
+func (c *folderCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.valid = false
+	c.folders = nil
+}
+
+// lookup reports whether id is in the cached folder list, without fetching. ok is
+// false when no fresh list is cached (caching disabled, expired or invalidated);
+// generation identifies the fetch the answer comes from.
+func (c *folderCache) lookup(id string, ttl time.Duration) (found, ok bool, generation int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.valid || ttl <= 0 || time.Since(c.fetchedAt) >= ttl {
+		return false, false, 0
+	}
+	for _, f := range c.folders {
+		if f.ID == id {
+			return true, true, c.generation
+		}
+	}
+	return false, true, c.generation
+}
+
+func (c *folderCache) setLabels(folders []syncthing.FolderConfig) {
+	labels := make(map[string]string, len(folders))
+	for _, f := range folders {
+		if label := strings.TrimSpace(f.Label); label != "" && label != f.ID {
+			labels[f.ID] = label
+		}
+	}
+	c.labelMu.Lock()
+	c.labels = labels
+	c.labelMu.Unlock()
+}
+
+func (c *folderCache) label(id string) string {
+	c.labelMu.RLock()
+	defer c.labelMu.RUnlock()
+	return c.labels[id]
+}
+
+// folderLabel returns the label of a folder reference from its instance's cached
+// config, or "" when the cache has not been filled yet. It never fetches.
+func (s *Service) folderLabel(ref string) string {
+	inst, id := s.splitRef(ref)
+	return s.folderCacheFor(inst).label(id)
+}
+
+// labelSuffix renders folderLabel for log messages: " (Documents)" or "".
+func (s *Service) labelSuffix(ref string) string {
+	if label := s.folderLabel(ref); label != "" {
+		return " (" + label + ")"
+	}
+	return ""
+}
+
+// folderCacheFor returns the cache of one instance ("" is the default instance).
+func (s *Service) folderCacheFor(instance string) *folderCache {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	if s.folderCaches == nil {
+		s.folderCaches = map[string]*folderCache{}
+	}
+	c := s.folderCaches[instance]
+	if c == nil {
+		c = &folderCache{}
+		s.folderCaches[instance] = c
+	}
+	return c
+}
+
+// InvalidateFolderCache drops the cached folder lists of all instances; the next lookup refetches them.
+func (s *Service) InvalidateFolderCache() {
+	for _, inst := range s.instances() {
+		s.folderCacheFor(inst).invalidate()
+	}
+}
+
+// cachedFolderIDs is cachedFolders for callers that need only each folder's ID,
+// label and paused flag, such as wildcard expansion. With ST_CONFIG_CACHE off every
+// call fetches the config, so only those fields are decoded and nothing is cached.
+func (s *Service) cachedFolderIDs(ctx context.Context, instance string) ([]syncthing.FolderConfig, error) {
+	if s.Settings.ConfigCacheTTL > 0 {
+		return s.cachedFolders(ctx, instance)
+	}
+	c := s.folderCacheFor(instance)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return s.fetchFolders(ctx, instance, c, true)
+}
+
+// fetchFolders fetches an instance's folder list for c, whose lock the caller
+// holds, and updates the labels and found or removed folders from it. With light
+// set, only IDs, labels and paused flags are decoded.
+func (s *Service) fetchFolders(ctx context.Context, instance string, c *folderCache, light bool) ([]syncthing.FolderConfig, error) {
+	list, _, err := s.client(instance).ConfigFolders(ctx, 15*time.Second, light)
+	if err != nil {
+		return nil, err
+	}
+	folders := make([]syncthing.FolderConfig, 0, len(list))
+	for _, f := range list {
+		if strings.TrimSpace(f.ID) != "" {
+			folders = append(folders, f)
+		}
+	}
+	c.generation++
+	c.setLabels(folders)
+	s.forgetRemovedFolders(instance, folders)
+	s.folderFound(instance, folders)
+	return folders, nil
+}
+
+// cachedFolders returns an instance's folder list, refreshing it when the TTL has
+// expired, Syncthing has restarted or its config version has advanced since the last
+// fetch. The lock is held across the fetch so concurrent callers share a single
+// upstream request.
+func (s *Service) cachedFolders(ctx context.Context, instance string) ([]syncthing.FolderConfig, error) {
+	c := s.folderCacheFor(instance)
+	client := s.client(instance)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ttl := s.Settings.ConfigCacheTTL
+	if c.valid && ttl > 0 && time.Since(c.fetchedAt) < ttl {
+		if s.folderCacheCurrent(ctx, instance, c) {
+			return c.folders, nil
+		}
+	}
+
+	var version int64
+	var versionErr error
+	if ttl > 0 {
+		version, _, versionErr = client.ConfigVersion(ctx, 5*time.Second)
+	}
+	folders, err := s.fetchFolders(ctx, instance, c, false)
+	if err != nil {
+		return nil, err
+	}
+	c.folders = folders
+	c.fetchedAt = time.Now()
+	c.valid = ttl > 0
+	if c.valid {
+		if st, _, err := client.SystemStatus(ctx, 5*time.Second); err == nil {
+			c.startTime = st.StartTime
+		}
+		if versionErr != nil && (c.versioned || c.generation == 1) {
+			s.Logger.Printf("Cannot read the config version of instance %s (%v); refreshing its folder list every ST_CONFIG_CACHE only", instanceName(instance), versionErr)
+		}
+		c.version, c.versioned = version, versionErr == nil
+	}
+	return folders, nil
+}
+
+// folderCacheCurrent reports whether a cached list within its TTL still matches
+// Syncthing: same start time and, where the config version can be read, the same
+// version. A failed check keeps the cached list.
+func (s *Service) folderCacheCurrent(ctx context.Context, instance string, c *folderCache) bool {
+	client := s.client(instance)
+	st, _, err := client.SystemStatus(ctx, 5*time.Second)
+	if err != nil {
+		return true
+	}
+	if !st.StartTime.Equal(c.startTime) {
+		s.Logger.Printf("Syncthing restart detected on instance %s; refreshing folder list", instanceName(instance))
+		return false
+	}
+	if !c.versioned {
+		return true
+	}
+	version, _, err := client.ConfigVersion(ctx, 5*time.Second)
+	if err != nil || version == c.version {
+		return true
+	}
+	s.Logger.Printf("Syncthing config changed on instance %s; refreshing folder list", instanceName(instance))
+	return false
+}
+
+// forgetRemovedFolders drops tracked stats (and so metric series) for folders of
+// instance that are no longer in its Syncthing config.
+func (s *Service) forgetRemovedFolders(instance string, folders []syncthing.FolderConfig) {
+	known := make(map[string]bool, len(folders))
+	for _, f := range folders {
+		known[f.ID] = true
+	}
+	s.stats.retain(func(ref string) bool {
+		inst, id := s.splitRef(ref)
+		return inst != instance || id == "*" || known[id]
+	})
+}
+
+// isFolderNotFound reports whether err is Syncthing rejecting an unknown folder ID.
+func isFolderNotFound(err error) bool {
+	return errors.Is(err, syncthing.ErrFolderNotFound)
+}
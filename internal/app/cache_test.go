@@ -0,0 +1,218 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+	"github.com/rcarmo/syncthing-kicker/internal/syncthingtest"
+)
+
+func TestWildcardStatusCheckReusesCachedFolderList(t *testing.T) {
+	srv := syncthingtest.New(t, "folderA", "folderB")
+	svc := harnessService(t, srv, Settings{ConfigCacheTTL: 5 * time.Minute})
+
+	for i := 0; i < 5; i++ {
+		if err := svc.checkSyncStatus(context.Background(), []string{"*"}, 0); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if got := srv.Count("/rest/system/config"); got != 1 {
+		t.Fatalf("expected 1 config fetch across ticks, got %d", got)
+	}
+	if got := srv.Count("/rest/db/status"); got != 10 {
+		t.Fatalf("expected 10 folder status calls, got %d", got)
+	}
+}
+
+func TestFolderCacheDisabledWithZeroTTL(t *testing.T) {
+	srv := syncthingtest.New(t, "folderA")
+	svc := harnessService(t, srv, Settings{})
+
+	for i := 0; i < 3; i++ {
+		_ = svc.checkSyncStatus(context.Background(), []string{"*"}, 0)
+	}
+	if got := srv.Count("/rest/system/config"); got != 3 {
+		t.Fatalf("expected 3 config fetches, got %d", got)
+	}
+}
+
+func TestWildcardFolderListDecodesOnlyWhatItNeeds(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	fake.folders[0] = syncthing.FolderConfig{ID: "docs", Label: "Docs", Path: "/data/docs", Type: "sendreceive", Paused: true}
+	want := syncthing.FolderConfig{ID: "docs", Label: "Docs", Paused: true}
+
+	svc := fake.service(t, Settings{})
+	list, err := svc.cachedFolderIDs(context.Background(), "")
+	if err != nil || len(list) != 1 || list[0].ID != want.ID || list[0].Label != want.Label || list[0].Paused != want.Paused || list[0].Path != "" || list[0].Type != "" {
+		t.Fatalf("expected only ID, label and paused without a cache, got %+v, %v", list, err)
+	}
+	if got := svc.folderLabel("docs"); got != "Docs" {
+		t.Fatalf("expected the label to be learned, got %q", got)
+	}
+
+	// The cached list is shared with callers that need the whole folder config.
+	svc = fake.service(t, Settings{ConfigCacheTTL: time.Minute})
+	if list, err = svc.cachedFolderIDs(context.Background(), ""); err != nil || len(list) != 1 || list[0].Path != "/data/docs" {
+		t.Fatalf("expected the full cached folder config, got %+v, %v", list, err)
+	}
+}
+
+func TestFolderCacheRefetchesAfterInvalidation(t *testing.T) {
+	srv := syncthingtest.New(t, "folderA")
+	svc := harnessService(t, srv, Settings{ConfigCacheTTL: 5 * time.Minute})
+
+	_ = svc.checkSyncStatus(context.Background(), []string{"*"}, 0)
+	svc.InvalidateFolderCache()
+	_ = svc.checkSyncStatus(context.Background(), []string{"*"}, 0)
+
+	if got := srv.Count("/rest/system/config"); got != 2 {
+		t.Fatalf("expected 2 config fetches, got %d", got)
+	}
+}
+
+func TestFolderCacheRefetchesAfterExpiry(t *testing.T) {
+	srv := syncthingtest.New(t, "folderA")
+	svc := harnessService(t, srv, Settings{ConfigCacheTTL: 5 * time.Minute})
+
+	_ = svc.checkSyncStatus(context.Background(), []string{"*"}, 0)
+	svc.folderCacheFor("").fetchedAt = time.Now().Add(-10 * time.Minute)
+	_ = svc.checkSyncStatus(context.Background(), []string{"*"}, 0)
+
+	if got := srv.Count("/rest/system/config"); got != 2 {
+		t.Fatalf("expected 2 config fetches, got %d", got)
+	}
+}
+
+func TestFolderCacheRefetchesAfterSyncthingRestart(t *testing.T) {
+	srv := syncthingtest.New(t, "folderA")
+	svc := harnessService(t, srv, Settings{ConfigCacheTTL: 5 * time.Minute})
+
+	_ = svc.checkSyncStatus(context.Background(), []string{"*"}, 0)
+	srv.Restart()
+	_ = svc.checkSyncStatus(context.Background(), []string{"*"}, 0)
+	_ = svc.checkSyncStatus(context.Background(), []string{"*"}, 0)
+
+	if got := srv.Count("/rest/system/config"); got != 2 {
+		t.Fatalf("expected 2 config fetches, got %d", got)
+	}
+}
+
+func TestFolderCacheInvalidatedOnFolderNotFound(t *testing.T) {
+	srv := syncthingtest.New(t, "folderA")
+	svc := harnessService(t, srv, Settings{ConfigCacheTTL: 5 * time.Minute})
+
+	_ = svc.checkSyncStatus(context.Background(), []string{"*"}, 0)
+	_ = svc.checkSyncStatus(context.Background(), []string{"missing"}, 0)
+	_ = svc.checkSyncStatus(context.Background(), []string{"*"}, 0)
+
+	if got := srv.Count("/rest/system/config"); got != 2 {
+		t.Fatalf("expected 2 config fetches, got %d", got)
+	}
+}
+
+func TestFolderCacheConcurrentLookupsShareOneFetch(t *testing.T) {
+	fake := newFakeSyncthing(t, "folderA", "folderB")
+	svc := fake.service(t, Settings{ConfigCacheTTL: 5 * time.Minute})
+
+	done := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			_, _ = svc.cachedFolders(context.Background(), "")
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		<-done
+	}
+	if got := fake.count("/rest/system/config"); got != 1 {
+		t.Fatalf("expected 1 config fetch, got %d", got)
+	}
+}
+
+func TestFolderLabelsFollowTheCache(t *testing.T) {
+	fake := newFakeSyncthing(t, "abcd-1234")
+	fake.setLabel("abcd-1234", "Documents")
+	svc := fake.service(t, Settings{})
+	var buf bytes.Buffer
+	svc.Logger = log.New(&buf, "", 0)
+
+	svc.triggerScans(context.Background(), "global", []string{"abcd-1234"}, nil)
+	if !strings.Contains(buf.String(), "Triggered scan for folder 'abcd-1234'\n") {
+		t.Fatalf("cold cache should log without a label:\n%s", buf.String())
+	}
+	if fake.count("/rest/system/config") != 0 {
+		t.Fatalf("label lookup must not fetch the config")
+	}
+
+	_ = svc.checkSyncStatus(context.Background(), []string{"*"}, 0)
+	buf.Reset()
+	svc.triggerScans(context.Background(), "global", []string{"abcd-1234"}, nil)
+	if !strings.Contains(buf.String(), "Triggered scan for folder 'abcd-1234' (Documents)\n") {
+		t.Fatalf("expected label once the cache is warm:\n%s", buf.String())
+	}
+
+	fake.setLabel("abcd-1234", "Papers")
+	_ = svc.checkSyncStatus(context.Background(), []string{"*"}, 0)
+	if got := svc.folderLabel("abcd-1234"); got != "Papers" {
+		t.Fatalf("expected refreshed label, got %q", got)
+	}
+}
+
+func TestFolderCacheRefetchesWhenConfigVersionAdvances(t *testing.T) {
+	fake := newFakeSyncthing(t, "folderA")
+	var logs bytes.Buffer
+	svc := fake.service(t, Settings{ConfigCacheTTL: 5 * time.Minute})
+	svc.Logger = log.New(&logs, "", 0)
+
+	_ = svc.checkSyncStatus(context.Background(), []string{"*"}, 0)
+	fake.addEvent("StateChanged", map[string]any{"folder": "folderA"})
+	_ = svc.checkSyncStatus(context.Background(), []string{"*"}, 0)
+	if got := fake.count("/rest/system/config"); got != 1 {
+		t.Fatalf("other events must not refetch the folder list, got %d fetches", got)
+	}
+
+	fake.mu.Lock()
+	fake.folders = append(fake.folders, syncthing.FolderConfig{ID: "folderB"})
+	fake.status["folderB"] = syncthing.FolderStatus{State: "idle"}
+	fake.mu.Unlock()
+	fake.addEvent("ConfigSaved", map[string]any{})
+	_ = svc.checkSyncStatus(context.Background(), []string{"*"}, 0)
+	_ = svc.checkSyncStatus(context.Background(), []string{"*"}, 0)
+
+	if got := fake.count("/rest/system/config"); got != 2 {
+		t.Fatalf("expected 2 config fetches, got %d", got)
+	}
+	if got := fake.count("/rest/db/status"); got != 6 {
+		t.Fatalf("expected the new folder checked after the change, got %d status calls", got)
+	}
+	if !strings.Contains(logs.String(), "Syncthing config changed on instance default") {
+		t.Fatalf("expected the change logged:\n%s", logs.String())
+	}
+}
+
+func TestFolderCacheFallsBackToTTLWithoutConfigVersion(t *testing.T) {
+	fake := newFakeSyncthing(t, "folderA")
+	fake.eventsErr = http.StatusNotFound
+	var logs bytes.Buffer
+	svc := fake.service(t, Settings{ConfigCacheTTL: 5 * time.Minute})
+	svc.Logger = log.New(&logs, "", 0)
+
+	for i := 0; i < 3; i++ {
+		_ = svc.checkSyncStatus(context.Background(), []string{"*"}, 0)
+	}
+	if got := fake.count("/rest/system/config"); got != 1 {
+		t.Fatalf("expected 1 config fetch within the TTL, got %d", got)
+	}
+	if got := fake.count("/rest/events"); got != 1 {
+		t.Fatalf("expected the config version tried once, got %d", got)
+	}
+	if got := strings.Count(logs.String(), "Cannot read the config version"); got != 1 {
+		t.Fatalf("expected the fallback logged once:\n%s", logs.String())
+	}
+}
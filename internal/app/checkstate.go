@@ -0,0 +1,72 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+// checkOK rates a folder state as healthy in --check, whatever its need bytes.
+const checkOK = "ok"
+
+var checkSeverityLevels = []string{checkOK, severityWarning, severityCritical}
+
+// checkStates are the folder states ST_CHECK_STATE_SEVERITY can rate: the ones
+// Syncthing reports today, and "stopped" from older releases.
+var checkStates = append(append([]string{}, folderStates...), "stopped")
+
+// defaultStateSeverities fails --check on folders that are not syncing at all,
+// however little they need.
+var defaultStateSeverities = map[string]string{
+	"error":   severityCritical,
+	"stopped": severityCritical,
+	"unknown": severityCritical,
+}
+
+// FolderProblem is a checked folder whose state is rated warning or critical.
+type FolderProblem struct {
+	Folder   string `json:"folder"`
+	State    string `json:"state"`
+	Severity string `json:"severity"`
+	Error    string `json:"error,omitempty"` // the folder's error, or its first file error
+}
+
+// Critical reports whether the folder fails the check rather than only warning.
+func (p FolderProblem) Critical() bool {
+	return p.Severity == severityCritical
+}
+
+// stateSeverity rates a folder state for --check: ST_CHECK_STATE_SEVERITY's setting
+// or the default, or "" for states judged by need bytes as usual. A folder with no
+// state is in the unknown state.
+func stateSeverity(overrides map[string]string, state string) string {
+	if state == "" {
+		state = "unknown"
+	}
+	if sev, ok := overrides[state]; ok {
+		return sev
+	}
+	return defaultStateSeverities[state]
+}
+
+// folderProblem returns ref's problem if its state is rated warning or critical,
+// with the error Syncthing gives for it: the status payload's, or else the first
+// of /rest/folder/errors.
+func (s *Service) folderProblem(ctx context.Context, ref string, st syncthing.FolderStatus) (FolderProblem, bool) {
+	sev := stateSeverity(s.Settings.CheckStateSeverity, st.State)
+	if sev != severityWarning && sev != severityCritical {
+		return FolderProblem{}, false
+	}
+	p := FolderProblem{Folder: ref, State: st.State, Severity: sev, Error: st.Error}
+	if p.State == "" {
+		p.State = "unknown"
+	}
+	if p.Error == "" && st.Errors > 0 {
+		inst, id := s.splitRef(ref)
+		if errs, _, err := s.client(inst).FolderErrors(ctx, id, 1, 10*time.Second); err == nil && len(errs) > 0 {
+			p.Error = errs[0].Path + ": " + errs[0].Error
+		}
+	}
+	return p, true
+}
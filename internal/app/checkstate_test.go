@@ -0,0 +1,80 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+func TestStateSeverity(t *testing.T) {
+	want := map[string]string{
+		"idle":           "",
+		"scanning":       "",
+		"scan-waiting":   "",
+		"syncing":        "",
+		"sync-waiting":   "",
+		"sync-preparing": "",
+		"cleaning":       "",
+		"clean-waiting":  "",
+		"error":          severityCritical,
+		"unknown":        severityCritical,
+		"stopped":        severityCritical,
+		"":               severityCritical,
+	}
+	for _, state := range checkStates {
+		if _, ok := want[state]; !ok {
+			t.Fatalf("state %q has no expectation", state)
+		}
+	}
+	for state, sev := range want {
+		if got := stateSeverity(nil, state); got != sev {
+			t.Fatalf("state %q: got %q, want %q", state, got, sev)
+		}
+	}
+	overrides := map[string]string{"stopped": checkOK, "syncing": severityWarning}
+	if got := stateSeverity(overrides, "stopped"); got != checkOK {
+		t.Fatalf("expected stopped to be overridden, got %q", got)
+	}
+	if got := stateSeverity(overrides, "syncing"); got != severityWarning {
+		t.Fatalf("expected syncing to be overridden, got %q", got)
+	}
+	if got := stateSeverity(overrides, "error"); got != severityCritical {
+		t.Fatalf("expected error to keep its default, got %q", got)
+	}
+}
+
+func TestCheckOnceReportsFolderProblems(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs", "media", "photos", "archive")
+	fake.setStatus("docs", syncthing.FolderStatus{State: "error", Error: "folder marker missing"})
+	fake.setStatus("media", syncthing.FolderStatus{State: "error", Errors: 2})
+	fake.fileErrors = map[string][]syncthing.FileError{"media": {{Path: "a.mkv", Error: "permission denied"}, {Path: "b.mkv", Error: "permission denied"}}}
+	fake.setStatus("photos", syncthing.FolderStatus{State: "syncing", NeedBytes: 10})
+	fake.setStatus("archive", syncthing.FolderStatus{State: "stopped"})
+	svc := fake.service(t, Settings{CheckStateSeverity: map[string]string{"stopped": severityWarning}})
+
+	report, err := svc.CheckOnce(context.Background(), []string{"*"})
+	results := report.Instances
+	if err != nil || len(results) != 1 {
+		t.Fatalf("unexpected results: %+v, %v", results, err)
+	}
+	got := map[string]FolderProblem{}
+	for _, p := range results[0].Problems {
+		got[p.Folder] = p
+	}
+	if len(got) != 3 {
+		t.Fatalf("expected docs, media and archive to be reported, got %+v", results[0].Problems)
+	}
+	if p := got["docs"]; !p.Critical() || p.Error != "folder marker missing" {
+		t.Fatalf("unexpected docs problem: %+v", p)
+	}
+	if p := got["media"]; !p.Critical() || p.Error != "a.mkv: permission denied" {
+		t.Fatalf("unexpected media problem: %+v", p)
+	}
+	if p := got["archive"]; p.Critical() || p.Severity != severityWarning {
+		t.Fatalf("unexpected archive problem: %+v", p)
+	}
+	if fake.count("/rest/folder/errors") != 1 {
+		t.Fatalf("expected file errors to be fetched only for media")
+	}
+}
@@ -0,0 +1,107 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// CompareRow is one instance's view of a folder in `compare` output.
+type CompareRow struct {
+	Instance    string   `json:"instance"`
+	Shared      bool     `json:"shared"`
+	State       string   `json:"state,omitempty"`
+	NeedBytes   int64    `json:"needBytes"`
+	InSyncBytes int64    `json:"inSyncBytes"`
+	Completion  *float64 `json:"remoteCompletion,omitempty"` // aggregated over remote devices
+	Error       string   `json:"error,omitempty"`
+}
+
+// Compare fetches the folder's status and completion from every configured instance
+// concurrently. Failures are reported per row so partial results are still returned.
+func (s *Service) Compare(ctx context.Context, folder string) []CompareRow {
+	instances := s.instances()
+	rows := make([]CompareRow, len(instances))
+	var wg sync.WaitGroup
+	for i, inst := range instances {
+		wg.Add(1)
+		go func(i int, inst string) {
+			defer wg.Done()
+			rows[i] = s.compareOne(ctx, inst, folder)
+		}(i, inst)
+	}
+	wg.Wait()
+	return rows
+}
+
+func (s *Service) compareOne(ctx context.Context, instance, folder string) CompareRow {
+	row := CompareRow{Instance: instanceName(instance)}
+	client := s.client(instance)
+
+	st, code, err := client.FolderStatus(ctx, folder, 10*time.Second)
+	if err != nil {
+		if code == http.StatusNotFound || isFolderNotFound(err) {
+			return row
+		}
+		row.Error = err.Error()
+		return row
+	}
+	row.Shared = true
+	row.State = st.State
+	row.NeedBytes = st.NeedBytes
+	row.InSyncBytes = st.InSyncBytes
+
+	if fc, _, err := client.Completion(ctx, folder, "", 10*time.Second); err == nil {
+		row.Completion = &fc.Completion
+	} else {
+		row.Error = err.Error()
+	}
+	return row
+}
+
+// WriteCompareTable prints rows as an aligned table.
+func WriteCompareTable(w io.Writer, folder string, rows []CompareRow) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Folder %s\n", folder)
+	fmt.Fprintln(tw, "INSTANCE\tSTATE\tNEED\tIN SYNC\tREMOTE\tERROR")
+	for _, r := range rows {
+		if !r.Shared && r.Error == "" {
+			fmt.Fprintf(tw, "%s\tnot shared\t-\t-\t-\t\n", r.Instance)
+			continue
+		}
+		state, need, inSync, remote := "-", "-", "-", "-"
+		if r.Shared {
+			state, need, inSync = r.State, formatBytes(r.NeedBytes), formatBytes(r.InSyncBytes)
+		}
+		if r.Completion != nil {
+			remote = fmt.Sprintf("%.1f%%", *r.Completion)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Instance, state, need, inSync, remote, r.Error)
+	}
+	return tw.Flush()
+}
+
+// WriteCompareJSON prints rows as a JSON document.
+func WriteCompareJSON(w io.Writer, folder string, rows []CompareRow) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]any{"folder": folder, "instances": rows})
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
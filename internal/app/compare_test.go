@@ -0,0 +1,64 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+func TestCompareReportsEveryInstance(t *testing.T) {
+	def := newFakeSyncthing(t, "photos")
+	def.setStatus("photos", syncthing.FolderStatus{State: "syncing", NeedBytes: 2048, InSyncBytes: 4096})
+	offsite := newFakeSyncthing(t, "photos")
+	other := newFakeSyncthing(t, "docs")
+	down := newFakeSyncthing(t, "photos")
+	down.srv.Close()
+	svc := multiInstanceService(t, Settings{}, def, map[string]*fakeSyncthing{
+		"offsite": offsite, "other": other, "down": down,
+	})
+
+	rows := svc.Compare(context.Background(), "photos")
+	byName := map[string]CompareRow{}
+	for _, r := range rows {
+		byName[r.Instance] = r
+	}
+	if r := byName["default"]; !r.Shared || r.State != "syncing" || r.NeedBytes != 2048 || r.Completion == nil || *r.Completion != 50 {
+		t.Fatalf("unexpected default row: %+v", r)
+	}
+	if r := byName["offsite"]; !r.Shared || r.State != "idle" || r.Error != "" {
+		t.Fatalf("unexpected offsite row: %+v", r)
+	}
+	if r := byName["other"]; r.Shared || r.Error != "" {
+		t.Fatalf("expected other to report not shared: %+v", r)
+	}
+	if r := byName["down"]; r.Shared || r.Error == "" {
+		t.Fatalf("expected down to report an error: %+v", r)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCompareTable(&buf, "photos", rows); err != nil {
+		t.Fatalf("write table: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"not shared", "2.0 KiB", "50.0%", "syncing"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("table missing %q:\n%s", want, out)
+		}
+	}
+
+	buf.Reset()
+	if err := WriteCompareJSON(&buf, "photos", rows); err != nil {
+		t.Fatalf("write json: %v", err)
+	}
+	var doc struct {
+		Folder    string       `json:"folder"`
+		Instances []CompareRow `json:"instances"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil || doc.Folder != "photos" || len(doc.Instances) != 4 {
+		t.Fatalf("unexpected json (%v):\n%s", err, buf.String())
+	}
+}
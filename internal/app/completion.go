@@ -0,0 +1,193 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+const completionTimeout = 10 * time.Second
+
+// CompletionRow is one remote device's progress on one folder in `completion`
+// output. Completion is left out, with Note saying why, for devices that are paused
+// or were never seen, as Syncthing's figure for them means nothing.
+type CompletionRow struct {
+	Folder     string    `json:"folder"`
+	Label      string    `json:"label,omitempty"`
+	DeviceID   string    `json:"deviceID,omitempty"`
+	Device     string    `json:"device,omitempty"`     // the device's name in the config
+	Connection string    `json:"connection,omitempty"` // connected, disconnected or paused
+	Completion *float64  `json:"completion,omitempty"`
+	NeedBytes  int64     `json:"needBytes"`
+	NeedItems  int64     `json:"needItems"`
+	LastSeen   time.Time `json:"lastSeen,omitempty"`
+	Note       string    `json:"note,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// completionDevices is what one instance says about its devices, fetched once for
+// all of its folders.
+type completionDevices struct {
+	myID  string
+	names map[string]string
+	conns map[string]syncthing.Connection
+	stats map[string]syncthing.DeviceStatistics
+}
+
+// CompletionReport lists, for each folder, every remote device it is shared with
+// and how far that device is from completing it, in the order refs are given and
+// by device name within a folder. Failures are reported per row.
+func (s *Service) CompletionReport(ctx context.Context, refs []string) []CompletionRow {
+	var rows []CompletionRow
+	devices := map[string]*completionDevices{}
+	errs := map[string]error{}
+	for _, ref := range refs {
+		inst, _ := s.splitRef(ref)
+		if _, ok := devices[inst]; !ok && errs[inst] == nil {
+			devices[inst], errs[inst] = s.completionDevices(ctx, inst)
+		}
+		if err := errs[inst]; err != nil {
+			rows = append(rows, CompletionRow{Folder: ref, Error: err.Error()})
+			continue
+		}
+		rows = append(rows, s.folderCompletion(ctx, ref, devices[inst])...)
+	}
+	return rows
+}
+
+func (s *Service) completionDevices(ctx context.Context, inst string) (*completionDevices, error) {
+	client := s.client(inst)
+	st, _, err := client.SystemStatus(ctx, completionTimeout)
+	if err != nil {
+		return nil, err
+	}
+	configured, _, err := client.Devices(ctx, completionTimeout)
+	if err != nil {
+		return nil, err
+	}
+	conns, _, err := client.Connections(ctx, completionTimeout)
+	if err != nil {
+		return nil, err
+	}
+	stats, _, err := client.DeviceStats(ctx, completionTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if conns == nil {
+		conns = map[string]syncthing.Connection{}
+	}
+	d := &completionDevices{myID: st.MyID, names: map[string]string{}, conns: conns, stats: stats}
+	for _, dev := range configured {
+		d.names[dev.DeviceID] = dev.Name
+		if dev.Paused {
+			c := conns[dev.DeviceID]
+			c.Paused = true
+			d.conns[dev.DeviceID] = c
+		}
+	}
+	return d, nil
+}
+
+func (s *Service) folderCompletion(ctx context.Context, ref string, d *completionDevices) []CompletionRow {
+	inst, id := s.splitRef(ref)
+	client := s.client(inst)
+	cfg, _, err := client.Folder(ctx, id, completionTimeout)
+	if err != nil {
+		return []CompletionRow{{Folder: ref, Error: err.Error()}}
+	}
+	var rows []CompletionRow
+	for _, fd := range cfg.Devices {
+		if fd.DeviceID == d.myID {
+			continue
+		}
+		row := CompletionRow{Folder: ref, Label: cfg.Label, DeviceID: fd.DeviceID, Device: d.names[fd.DeviceID], Connection: "disconnected"}
+		conn := d.conns[fd.DeviceID]
+		switch {
+		case conn.Paused:
+			row.Connection = "paused"
+		case conn.Connected:
+			row.Connection = "connected"
+		}
+		if seen := d.stats[fd.DeviceID].LastSeen; seen.Unix() > 0 {
+			row.LastSeen = seen
+		}
+		switch {
+		case conn.Paused:
+			row.Note = "device paused"
+		case row.LastSeen.IsZero() && !conn.Connected:
+			row.Note = "never seen"
+		default:
+			fc, _, err := client.Completion(ctx, id, fd.DeviceID, completionTimeout)
+			if err != nil {
+				row.Error = err.Error()
+				break
+			}
+			row.Completion, row.NeedBytes, row.NeedItems = &fc.Completion, fc.NeedBytes, fc.NeedItems
+		}
+		rows = append(rows, row)
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Device < rows[j].Device })
+	if len(rows) == 0 {
+		rows = append(rows, CompletionRow{Folder: ref, Label: cfg.Label, Note: "not shared with any other device"})
+	}
+	return rows
+}
+
+// SortByCompletion orders rows worst first: lowest completion, then most bytes
+// needed. Rows without a completion go last.
+func SortByCompletion(rows []CompletionRow) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if (a.Completion == nil) != (b.Completion == nil) {
+			return b.Completion == nil
+		}
+		if a.Completion == nil || *a.Completion == *b.Completion {
+			return a.NeedBytes > b.NeedBytes
+		}
+		return *a.Completion < *b.Completion
+	})
+}
+
+// WriteCompletionTable prints rows as an aligned table.
+func WriteCompletionTable(w io.Writer, rows []CompletionRow) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FOLDER\tDEVICE\tCONNECTION\tCOMPLETION\tNEED\tITEMS\tNOTE")
+	for _, r := range rows {
+		folder := r.Folder
+		if r.Label != "" {
+			folder += " (" + r.Label + ")"
+		}
+		device := r.Device
+		if device == "" {
+			device = shortDeviceID(r.DeviceID)
+		}
+		completion, need, items := "-", "-", "-"
+		if r.Completion != nil {
+			completion, need, items = fmt.Sprintf("%.1f%%", *r.Completion), formatBytes(r.NeedBytes), fmt.Sprint(r.NeedItems)
+		}
+		note := r.Note
+		switch {
+		case r.Error != "":
+			note = r.Error
+		case !r.LastSeen.IsZero() && r.Connection != "connected":
+			note = "last seen " + r.LastSeen.Local().Format("2006-01-02 15:04")
+			if r.Note != "" {
+				note = r.Note + ", " + note
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", folder, orDashText(device), orDashText(r.Connection), completion, need, items, note)
+	}
+	return tw.Flush()
+}
+
+func orDashText(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
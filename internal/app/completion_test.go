@@ -0,0 +1,74 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+func TestCompletionReport(t *testing.T) {
+	const (
+		nasID    = "NASBOXA-AAAAAAA-BBBBBBB-CCCCCCC-DDDDDDD-EEEEEEE-FFFFFFF-GGGGGGG"
+		phoneID  = "PHONEZZ-AAAAAAA-BBBBBBB-CCCCCCC-DDDDDDD-EEEEEEE-FFFFFFF-GGGGGGG"
+		tabletID = "TABLETZ-AAAAAAA-BBBBBBB-CCCCCCC-DDDDDDD-EEEEEEE-FFFFFFF-GGGGGGG"
+	)
+	fake := newFakeSyncthing(t, "photos", "solo")
+	fake.setLabel("photos", "Photos")
+	fake.folders[0].Devices = []syncthing.FolderDevice{{DeviceID: "FAKE"}, {DeviceID: nasID}, {DeviceID: phoneID}, {DeviceID: laptopID}, {DeviceID: tabletID}}
+	fake.setDevice(syncthing.DeviceConfig{DeviceID: nasID, Name: "nas"})
+	fake.setDevice(syncthing.DeviceConfig{DeviceID: phoneID, Name: "phone"})
+	fake.setDevice(syncthing.DeviceConfig{DeviceID: laptopID, Name: "laptop", Paused: true})
+	fake.setDevice(syncthing.DeviceConfig{DeviceID: tabletID, Name: "tablet"})
+	lastWeek := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	fake.connections = map[string]syncthing.Connection{nasID: {Connected: true}}
+	fake.deviceStats = map[string]syncthing.DeviceStatistics{
+		nasID:    {LastSeen: time.Now()},
+		phoneID:  {LastSeen: lastWeek},
+		laptopID: {LastSeen: lastWeek},
+		tabletID: {LastSeen: time.Unix(0, 0)},
+	}
+	fake.completions = map[string]syncthing.FolderCompletion{
+		"photos@" + nasID:   {Completion: 99.5, NeedBytes: 1 << 20, NeedItems: 3},
+		"photos@" + phoneID: {Completion: 12, NeedBytes: 1 << 30, NeedItems: 400},
+	}
+	svc := fake.service(t, Settings{})
+
+	rows := svc.CompletionReport(context.Background(), []string{"photos", "solo"})
+	if len(rows) != 5 {
+		t.Fatalf("expected a row per remote device plus one for the unshared folder, got %+v", rows)
+	}
+	byDevice := map[string]CompletionRow{}
+	for _, r := range rows {
+		byDevice[r.Device] = r
+	}
+	if r := byDevice["nas"]; r.Connection != "connected" || r.Completion == nil || *r.Completion != 99.5 || r.NeedItems != 3 {
+		t.Fatalf("unexpected nas row: %+v", r)
+	}
+	if r := byDevice["laptop"]; r.Connection != "paused" || r.Completion != nil || r.Note != "device paused" {
+		t.Fatalf("unexpected laptop row: %+v", r)
+	}
+	if r := byDevice["tablet"]; r.Completion != nil || r.Note != "never seen" || !r.LastSeen.IsZero() {
+		t.Fatalf("unexpected tablet row: %+v", r)
+	}
+	if r := rows[4]; r.Folder != "solo" || r.Note != "not shared with any other device" {
+		t.Fatalf("unexpected solo row: %+v", r)
+	}
+
+	SortByCompletion(rows)
+	if rows[0].Device != "phone" || rows[1].Device != "nas" || rows[2].Completion != nil {
+		t.Fatalf("expected the least complete device first, got %+v", rows)
+	}
+	var buf bytes.Buffer
+	if err := WriteCompletionTable(&buf, rows); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "photos (Photos)  phone   disconnected  12.0%") || !strings.Contains(out, "last seen 2024-05-01") ||
+		!strings.Contains(out, "tablet  disconnected  -           -") {
+		t.Fatalf("unexpected table:\n%s", out)
+	}
+}
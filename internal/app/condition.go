@@ -0,0 +1,98 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// hookCondition is the hook name scan conditions run under.
+const hookCondition = "condition"
+
+// scanConditionTimeout bounds a scan condition command; one that runs longer counts
+// as not met.
+var scanConditionTimeout = 10 * time.Second
+
+// conditionCache remembers condition command results by command, so a tick over many
+// folders sharing a command runs it once per ST_SCAN_CONDITION_TTL. The zero value
+// is ready to use.
+type conditionCache struct {
+	mu      sync.Mutex // held while a command runs, so concurrent folders wait for its result
+	entries map[string]conditionEntry
+}
+
+type conditionEntry struct {
+	res hookResult
+	at  time.Time
+}
+
+// scanCondition is the condition command for folder: its ST_FOLDER_CONDITION_CMD
+// entry, if any, or ST_SCAN_CONDITION_CMD.
+func (s *Service) scanCondition(folder string) string {
+	if cmd, ok := s.Settings.FolderConditionCmd[folder]; ok {
+		return cmd
+	}
+	return s.Settings.ScanConditionCmd
+}
+
+// scanConditionMet runs folder's condition command, if it has one, and reports
+// whether it exited 0. A failing condition is logged with the first line of its
+// output as the reason. DRY_RUN evaluates it too.
+func (s *Service) scanConditionMet(ctx context.Context, folder string) bool {
+	command := s.scanCondition(folder)
+	if command == "" {
+		return true
+	}
+	res, cached := s.evalCondition(ctx, folder, command)
+	if a := attemptFrom(ctx); a != nil {
+		run := res
+		if cached {
+			run.Cached, run.DurationMs = true, 0
+		}
+		a.recordHook(run)
+	}
+	if res.ExitCode == 0 && res.Err == nil {
+		if s.Settings.DryRun {
+			s.log(ctx).Printf("[dry-run] Scan condition for folder '%s'%s met", folder, s.labelSuffix(folder))
+		}
+		return true
+	}
+	why := fmt.Sprintf("exit %d", res.ExitCode)
+	if res.TimedOut {
+		why = "timed out"
+	}
+	if cached {
+		why += ", cached"
+	}
+	reason := ""
+	if res.FirstLine != "" {
+		reason = fmt.Sprintf(": %q", res.FirstLine)
+	}
+	s.log(ctx).Printf("Scan condition for folder '%s'%s not met (%s)%s; skipping", folder, s.labelSuffix(folder), why, reason)
+	return false
+}
+
+// evalCondition runs command for folder, or reuses its result from within
+// ST_SCAN_CONDITION_TTL.
+func (s *Service) evalCondition(ctx context.Context, folder, command string) (res hookResult, cached bool) {
+	ttl := s.Settings.ScanConditionTTL
+	if ttl <= 0 {
+		return s.runHook(ctx, hookCondition, folder, command, scanConditionTimeout, nil), false
+	}
+	c := &s.conditions
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[command]; ok && time.Since(e.at) < ttl {
+		return e.res, true
+	}
+	res = s.runHook(ctx, hookCondition, folder, command, scanConditionTimeout, nil)
+	if ctx.Err() != nil {
+		return res, false // cut short by the run, not an answer worth keeping
+	}
+	if c.entries == nil {
+		c.entries = map[string]conditionEntry{}
+	}
+	c.entries[command] = conditionEntry{res: res, at: time.Now()}
+	return res, false
+}
@@ -0,0 +1,119 @@
+//go:build unix
+
+package app
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScanConditionGatesScans(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs", "photos")
+	svc := fake.service(t, Settings{
+		ScanConditionCmd:   "echo on battery; exit 1",
+		FolderConditionCmd: map[string]string{"photos": "true"},
+		HookOutputLimit:    defaultHookOutputLimit,
+	})
+	var buf syncBuffer
+	svc.Logger = log.New(&buf, "", 0)
+
+	if got := svc.triggerScan(context.Background(), "docs"); got != resultSkipped {
+		t.Fatalf("expected docs to be skipped, got %s", got)
+	}
+	if got := svc.triggerScan(context.Background(), "photos"); got != resultTriggered {
+		t.Fatalf("expected the per-folder condition to let photos through, got %s", got)
+	}
+	if got := strings.Join(fake.scanned(), ","); got != "photos" {
+		t.Fatalf("unexpected scans: %q", got)
+	}
+	if !strings.Contains(buf.String(), `Scan condition for folder 'docs' not met (exit 1): "on battery"; skipping`) {
+		t.Fatalf("expected the reason in the log:\n%s", buf.String())
+	}
+}
+
+func TestScanConditionRecordedInHistory(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs", "photos")
+	svc := fake.service(t, Settings{
+		ScanConditionCmd:   "exit 1",
+		FolderConditionCmd: map[string]string{"photos": "true"},
+		HookOutputLimit:    defaultHookOutputLimit,
+	})
+	_ = svc.triggerScans(context.Background(), "test", []string{"docs", "photos"}, nil)
+
+	for i, want := range []int{1, 0} {
+		f := svc.lastRun("test").Folders[i]
+		if len(f.Hooks) != 1 || f.Hooks[0].Hook != hookCondition || f.Hooks[0].ExitCode != want {
+			t.Fatalf("expected the condition with exit %d in %s's history entry, got %+v", want, f.Folder, f.Hooks)
+		}
+	}
+}
+
+func TestScanConditionCachedForTTL(t *testing.T) {
+	runs := filepath.Join(t.TempDir(), "runs")
+	count := func() int {
+		data, _ := os.ReadFile(runs)
+		return strings.Count(string(data), "\n")
+	}
+	fake := newFakeSyncthing(t, "a", "b", "c")
+	settings := Settings{ScanConditionCmd: "echo run >> " + runs, ScanConditionTTL: time.Hour}
+
+	svc := fake.service(t, settings)
+	_ = svc.triggerScans(context.Background(), "test", []string{"a", "b", "c"}, nil)
+	if n := count(); n != 1 {
+		t.Fatalf("expected one condition run within the TTL, got %d", n)
+	}
+	if len(fake.scanned()) != 3 {
+		t.Fatalf("expected all folders scanned, got %v", fake.scanned())
+	}
+	cached := 0
+	for _, f := range svc.lastRun("test").Folders {
+		if len(f.Hooks) != 1 {
+			t.Fatalf("expected the condition in %s's history entry, got %+v", f.Folder, f.Hooks)
+		}
+		if f.Hooks[0].Cached {
+			cached++
+		}
+	}
+	if cached != 2 {
+		t.Fatalf("expected the two reused results marked cached, got %d", cached)
+	}
+
+	settings.ScanConditionTTL = 0
+	svc = fake.service(t, settings)
+	_ = svc.triggerScans(context.Background(), "test", []string{"a", "b", "c"}, nil)
+	if n := count(); n != 4 {
+		t.Fatalf("expected one condition run per folder without a TTL, got %d", n-1)
+	}
+}
+
+func TestScanConditionEvaluatedInDryRun(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs", "photos")
+	svc := fake.service(t, Settings{
+		DryRun:             true,
+		ScanConditionCmd:   "true",
+		FolderConditionCmd: map[string]string{"photos": "false"},
+	})
+	var buf syncBuffer
+	svc.Logger = log.New(&buf, "", 0)
+
+	if got := svc.triggerScan(context.Background(), "docs"); got != resultDryRun {
+		t.Fatalf("expected a dry run for docs, got %s", got)
+	}
+	if got := svc.triggerScan(context.Background(), "photos"); got != resultSkipped {
+		t.Fatalf("expected photos to be skipped, got %s", got)
+	}
+	out := buf.String()
+	for _, want := range []string{"[dry-run] Scan condition for folder 'docs' met", "Scan condition for folder 'photos' not met (exit 1); skipping"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "Would trigger scan for folder 'photos'") || len(fake.scanned()) != 0 {
+		t.Fatalf("dry run must not scan, and photos must not get that far:\n%s", out)
+	}
+}
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// configChange is one config field an operation changes. Old is nil for a field of
+// an object being added.
+type configChange struct {
+	Field    string
+	Old, New any
+}
+
+// configDiff is what one operation changes in a folder, a device or an instance's
+// options. Every feature that writes to Syncthing's config logs one: as a preview
+// with DRY_RUN, and once applied otherwise, so changes can be audited afterwards.
+type configDiff struct {
+	Subject string // how logs refer to the object, e.g. "folder 'docs' (Documents)"
+	Folder  string // the folder reference, for folder changes
+	Changes []configChange
+}
+
+// String lays the changes out as "paused false -> true, rescanIntervalS 3600 -> 0".
+func (d configDiff) String() string {
+	parts := make([]string, 0, len(d.Changes))
+	for _, c := range d.Changes {
+		parts = append(parts, c.Field+" "+c.arrow())
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (c configChange) arrow() string {
+	return configValue(c.Old) + " -> " + configValue(c.New)
+}
+
+func configValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "(none)"
+	case string:
+		return fmt.Sprintf("%q", v)
+	case []string:
+		return "[" + strings.Join(v, ", ") + "]"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// logConfigDiff logs d through the log format. With DRY_RUN it is what would be
+// changed; otherwise call it once the change is applied.
+func (s *Service) logConfigDiff(ctx context.Context, d configDiff) {
+	if len(d.Changes) == 0 {
+		return
+	}
+	prefix, text := "Config change", "config change"
+	if s.Settings.DryRun {
+		prefix, text = "[dry-run] Config change", "[dry-run] config change"
+	}
+	ev := logEvent{Msg: fmt.Sprintf("%s for %s: %s", prefix, d.Subject, d), Folder: d.Folder, Text: text}
+	if d.Folder != "" {
+		ev.Label = s.folderLabel(d.Folder)
+	}
+	for _, c := range d.Changes {
+		ev.Fields = append(ev.Fields, logField{c.Field, c.arrow()})
+	}
+	s.logEvent(ctx, ev)
+}
@@ -0,0 +1,78 @@
+package app
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigDiffString(t *testing.T) {
+	d := configDiff{Changes: []configChange{
+		{"paused", false, true},
+		{"label", nil, "Documents"},
+		{"devices", []string{"AAA"}, []string{"AAA", "BBB"}},
+	}}
+	if got, want := d.String(), `paused false -> true, label (none) -> "Documents", devices [AAA] -> [AAA, BBB]`; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestPauseWindowsLogConfigDiff(t *testing.T) {
+	fake := newFakeSyncthing(t, "media")
+	settings := Settings{
+		CronTimezone: "UTC",
+		DryRun:       true,
+		StateFile:    filepath.Join(t.TempDir(), "state.json"),
+		PauseWindows: map[string][]PauseWindow{"media": {mustPauseWindow(t, "08:00-18:00 Mon-Fri")}},
+	}
+	svc := fake.service(t, settings)
+	var buf syncBuffer
+	svc.Logger = log.New(&buf, "", 0)
+	ctx := context.Background()
+	monday := func(hour int) time.Time { return time.Date(2024, 5, 6, hour, 0, 0, 0, time.UTC) }
+
+	svc.reconcilePauseWindows(ctx, monday(9))
+	if fake.patches != 0 {
+		t.Fatalf("dry run paused the folder")
+	}
+	if !strings.Contains(buf.String(), "[dry-run] Config change for folder 'media': paused false -> true\n") {
+		t.Fatalf("expected the dry-run diff:\n%s", buf.String())
+	}
+
+	settings.DryRun = false
+	settings.LogFormat = logFormatPretty
+	svc = fake.service(t, settings)
+	var applied syncBuffer
+	svc.Logger = log.New(&applied, "", 0)
+	svc.reconcilePauseWindows(ctx, monday(9))
+	svc.reconcilePauseWindows(ctx, monday(19))
+	for _, want := range []string{
+		"media  config change  paused false -> true\n",
+		"media  config change  paused true -> false\n",
+	} {
+		if !strings.Contains(applied.String(), want) {
+			t.Fatalf("expected %q once applied:\n%s", want, applied.String())
+		}
+	}
+}
+
+func TestApplyBandwidthLogsConfigDiff(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	svc := fake.service(t, Settings{DryRun: true})
+	var buf syncBuffer
+	svc.Logger = log.New(&buf, "", 0)
+	ctx := context.Background()
+
+	svc.applyBandwidth(ctx, BandwidthRule{SendKbps: 500}, "startup")
+	if !strings.Contains(buf.String(), "[dry-run] Config change for the options of instance default: maxSendKbps 0 -> 500, maxRecvKbps 0 -> 0") {
+		t.Fatalf("expected the dry-run diff:\n%s", buf.String())
+	}
+	svc.Settings.DryRun = false
+	svc.applyBandwidth(ctx, BandwidthRule{SendKbps: 500}, "startup")
+	if !strings.Contains(buf.String(), "\nConfig change for the options of instance default: maxSendKbps 0 -> 500") {
+		t.Fatalf("expected the applied diff:\n%s", buf.String())
+	}
+}
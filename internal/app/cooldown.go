@@ -0,0 +1,106 @@
+package app
+
+import (
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+)
+
+// NotifyCooldown is when an event was last sent and how many identical events have
+// been suppressed since.
+type NotifyCooldown struct {
+	LastSent   time.Time `json:"lastSent"`
+	Suppressed int       `json:"suppressed,omitempty"`
+}
+
+// suppressionCounts counts suppressed notifications by event type for /metrics.
+// The zero value is ready to use.
+type suppressionCounts struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func (c *suppressionCounts) add(event string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts == nil {
+		c.counts = map[string]int64{}
+	}
+	c.counts[event]++
+}
+
+func (c *suppressionCounts) get(event string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[event]
+}
+
+// cooldownKey identifies identical events: same type, instance, folder and
+// severity, and for health_changed the same level moved to.
+func cooldownKey(ev NotifyEvent) string {
+	key := ev.Type + "|" + ev.Instance + "|" + ev.Folder + "|" + ev.Severity
+	if to, ok := ev.Fields["to"]; ok {
+		key += "|" + fmt.Sprint(to)
+	}
+	return key
+}
+
+// throttleNotification reports whether the event keyed by key may be sent at now.
+// If not, it is counted as suppressed; if so, the count suppressed since the last
+// send is returned and reset. Entries with nothing pending are dropped once their
+// cooldown has passed.
+func (st *stateStore) throttleNotification(key string, now time.Time, cooldown time.Duration) (send bool, suppressed int, err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.state.Cooldowns == nil {
+		st.state.Cooldowns = map[string]*NotifyCooldown{}
+	}
+	if c := st.state.Cooldowns[key]; c != nil && now.Sub(c.LastSent) < cooldown {
+		c.Suppressed++
+		return false, c.Suppressed, st.saveLocked()
+	} else if c != nil {
+		suppressed = c.Suppressed
+	}
+	for k, c := range st.state.Cooldowns {
+		if c.Suppressed == 0 && now.Sub(c.LastSent) >= cooldown {
+			delete(st.state.Cooldowns, k)
+		}
+	}
+	st.state.Cooldowns[key] = &NotifyCooldown{LastSent: now}
+	return true, suppressed, st.saveLocked()
+}
+
+// cooldownNotification applies ST_NOTIFY_COOLDOWN to ev and reports whether it
+// should go out. Recoveries and digests always do. The first event after a
+// cooldown notes how many were suppressed during it.
+func (s *Service) cooldownNotification(ev *NotifyEvent) bool {
+	if s.Settings.NotifyCooldown <= 0 || len(s.Notifiers) == 0 || ev.Type == eventDigest || recoveryEvent(*ev) {
+		return true
+	}
+	send, suppressed, err := s.stateStore().throttleNotification(cooldownKey(*ev), ev.Time, s.Settings.NotifyCooldown)
+	if err != nil {
+		s.Logger.Printf("Failed to save state: %v", err)
+	}
+	if !send {
+		s.suppressed.add(ev.Type)
+		s.Logger.Printf("Suppressed %s notification%s within ST_NOTIFY_COOLDOWN (%s); %d suppressed so far", ev.Type, folderSuffix(ev.Folder), s.Settings.NotifyCooldown, suppressed)
+		return false
+	}
+	if suppressed > 0 {
+		ev.Message += fmt.Sprintf(" (+%d suppressed)", suppressed)
+		ev.Fields = maps.Clone(ev.Fields)
+		if ev.Fields == nil {
+			ev.Fields = map[string]any{}
+		}
+		ev.Fields["suppressed"] = suppressed
+	}
+	return true
+}
+
+func folderSuffix(folder string) string {
+	if folder == "" {
+		return ""
+	}
+	return " for folder '" + folder + "'"
+}
@@ -0,0 +1,84 @@
+package app
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotifyCooldownSuppressesRepeats(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	settings := Settings{NotifyCooldown: time.Hour, StateFile: filepath.Join(t.TempDir(), "state.json")}
+	svc := fake.service(t, settings)
+	rec := &recordingNotifier{}
+	svc.Notifiers = []Notifier{rec}
+
+	failed := NotifyEvent{Type: eventScanFailed, Folder: "docs", Message: "docs failed"}
+	for i := 0; i < 3; i++ {
+		svc.notify(failed)
+	}
+	svc.notify(NotifyEvent{Type: eventScanFailed, Folder: "photos", Message: "photos failed"})
+	svc.notify(NotifyEvent{Type: eventScanRecovered, Folder: "docs", Message: "docs recovered"})
+	svc.notify(NotifyEvent{Type: eventScanRecovered, Folder: "docs", Message: "docs recovered"})
+	svc.notifications.Wait()
+	if got := len(rec.types()); got != 4 {
+		t.Fatalf("expected one scan_failed per folder plus both recoveries, got %v", rec.types())
+	}
+	if out := scrape(t, svc); !strings.Contains(out, `syncthing_kicker_notifications_suppressed_total{event="scan_failed"} 2`) {
+		t.Fatalf("expected the suppressions in /metrics:\n%s", out)
+	}
+
+	// A restarted daemon (say, in a crash loop) keeps the cooldown.
+	if err := svc.FlushState(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	restarted := fake.service(t, settings)
+	restarted.Notifiers = []Notifier{rec}
+	restarted.notify(failed)
+	restarted.notifications.Wait()
+	if got := len(rec.types()); got != 4 {
+		t.Fatalf("expected the cooldown to survive a restart, got %v", rec.types())
+	}
+
+	// Once it expires, the next event says how many were held back.
+	st := restarted.stateStore()
+	st.mu.Lock()
+	st.state.Cooldowns[cooldownKey(NotifyEvent{Type: eventScanFailed, Instance: defaultInstance, Folder: "docs", Severity: severityWarning})].LastSent = time.Now().Add(-2 * time.Hour)
+	st.mu.Unlock()
+	restarted.notify(failed)
+	restarted.notifications.Wait()
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	last := rec.events[len(rec.events)-1]
+	if len(rec.events) != 5 || last.Message != "docs failed (+3 suppressed)" || last.Fields["suppressed"] != 3 {
+		t.Fatalf("unexpected event after the cooldown: %+v", last)
+	}
+}
+
+func TestNotifyCooldownKeepsDistinctEventsApart(t *testing.T) {
+	fake := newFakeSyncthing(t)
+	svc := fake.service(t, Settings{NotifyCooldown: time.Hour})
+	rec := &recordingNotifier{}
+	svc.Notifiers = []Notifier{rec}
+
+	health := func(to string) NotifyEvent {
+		return NotifyEvent{Type: eventHealthChanged, Message: "health " + to, Fields: map[string]any{"to": to}}
+	}
+	svc.notify(health(levelDegraded))
+	svc.notify(health(levelUnhealthy))
+	svc.notify(health(levelUnhealthy))
+	svc.notifications.Wait()
+	if got := len(rec.types()); got != 2 {
+		t.Fatalf("expected one event per level moved to, got %d", got)
+	}
+
+	// Nothing to send: nothing is counted as suppressed either.
+	quiet := fake.service(t, Settings{NotifyCooldown: time.Hour})
+	for range 2 {
+		quiet.notify(NotifyEvent{Type: eventScanFailed, Folder: "docs"})
+	}
+	if n := quiet.suppressed.get(eventScanFailed); n != 0 || len(quiet.stateStore().state.Cooldowns) != 0 {
+		t.Fatalf("expected no cooldown without notifiers, got %d suppressed", n)
+	}
+}
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// tickContext bounds one scheduled tick by ST_RUN_DEADLINE, when set. The delayed
+// status checks are detached from it and are not cut short.
+func (s *Service) tickContext() (context.Context, context.CancelFunc) {
+	if s.Settings.RunDeadline > 0 {
+		return context.WithTimeout(context.Background(), s.Settings.RunDeadline)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// DeadlineSummary says what a --check cut short by ST_RUN_DEADLINE got done and
+// what it abandoned.
+func (r Report) DeadlineSummary() string {
+	checked := r.Checked()
+	var abandoned []string
+	for _, res := range r.Instances {
+		if res.Abandoned {
+			abandoned = append(abandoned, res.Instance)
+		}
+	}
+	return fmt.Sprintf("checked %d folder(s)%s; abandoned instance(s): %s", len(checked), listSuffix(checked), orNone(abandoned))
+}
+
+// runSummary says how far a run cut short by ST_RUN_DEADLINE got: which folders were
+// triggered and settled, which were abandoned, and which status checks never ran.
+func runSummary(rec RunRecord) string {
+	var done, abandoned, unsettled []string
+	for _, f := range rec.Folders {
+		switch f.Result {
+		case "", resultAbandoned:
+			abandoned = append(abandoned, f.Folder)
+			continue
+		case resultTriggered, resultTimeout:
+			if f.Settled == "" {
+				unsettled = append(unsettled, f.Folder)
+			}
+		}
+		done = append(done, f.Folder)
+	}
+	return fmt.Sprintf("%d of %d folder(s) handled%s; abandoned: %s; status not checked: %s",
+		len(done), len(rec.Folders), listSuffix(done), orNone(abandoned), orNone(unsettled))
+}
+
+func listSuffix(items []string) string {
+	if len(items) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(items, ", ") + ")"
+}
+
+func orNone(items []string) string {
+	if len(items) == 0 {
+		return "none"
+	}
+	return strings.Join(items, ", ")
+}
@@ -0,0 +1,86 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunOnceStopsAtDeadline(t *testing.T) {
+	fake := newFakeSyncthing(t, "f1", "f2", "f3", "f4")
+	fake.slowScans(200 * time.Millisecond)
+	svc := fake.service(t, Settings{ScanOnStartup: true, RunOnce: true, ScanWorkers: 1, Folders: []string{"f1", "f2", "f3", "f4"}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := svc.Run(ctx)
+	if err == nil || !strings.Contains(err.Error(), "run deadline exceeded") {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "(f1); abandoned: f2, f3, f4") {
+		t.Fatalf("expected the in-flight f2 and the queued f3, f4 to be abandoned: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 700*time.Millisecond {
+		t.Fatalf("run outlived its deadline: %s", elapsed)
+	}
+}
+
+func TestRunDeadlineBoundsOnlyTheRunOncePass(t *testing.T) {
+	fake := newFakeSyncthing(t, "f1", "f2")
+	fake.slowScans(200 * time.Millisecond)
+	svc := fake.service(t, Settings{ScanOnStartup: true, RunOnce: true, RunDeadline: 300 * time.Millisecond, ScanWorkers: 1, Folders: []string{"f1", "f2"}})
+	if err := svc.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "run deadline exceeded") {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+
+	// Without RUN_ONCE the daemon outlives ST_RUN_DEADLINE.
+	fake = newFakeSyncthing(t, "docs")
+	svc = fake.service(t, Settings{ScanOnStartup: true, RunDeadline: 20 * time.Millisecond, CronExpr: "0 0 1 1 *"})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	start := time.Now()
+	if err := svc.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the daemon to run until cancelled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("the daemon stopped after %s", elapsed)
+	}
+}
+
+func TestCheckOnceAbandonedAtDeadline(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	svc := fake.service(t, Settings{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	report, err := svc.CheckOnce(ctx, svc.Folders())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results := report.Instances; len(results) != 1 || !results[0].Abandoned {
+		t.Fatalf("expected abandoned result, got %+v", results)
+	}
+	if got := report.DeadlineSummary(); got != "checked 0 folder(s); abandoned instance(s): default" {
+		t.Fatalf("DeadlineSummary = %q", got)
+	}
+	// An abandoned check says nothing about the instance's health.
+	if h := svc.health.snapshot([]string{""}); h[0].Failures != 0 {
+		t.Fatalf("abandoned check counted as a failure: %+v", h[0])
+	}
+}
+
+func TestRunSummary(t *testing.T) {
+	rec := RunRecord{Folders: []RunFolderResult{
+		{Folder: "docs", Result: resultTriggered, Settled: "idle"},
+		{Folder: "photos", Result: resultTriggered},
+		{Folder: "media", Result: resultAbandoned},
+		{Folder: "music"},
+	}}
+	want := "2 of 4 folder(s) handled (docs, photos); abandoned: media, music; status not checked: photos"
+	if got := runSummary(rec); got != want {
+		t.Fatalf("runSummary = %q", got)
+	}
+}
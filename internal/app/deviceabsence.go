@@ -0,0 +1,155 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+// eventDeviceAbsent is raised when a device sharing a configured folder has not
+// been seen for longer than ST_DEVICE_ABSENT_WARN.
+const eventDeviceAbsent = "device_absent"
+
+// deviceCheckInterval is the least time between two device absence checks, however
+// often the schedules tick.
+var deviceCheckInterval = time.Hour
+
+// DeviceRow is one remote device in the `--check` JSON devices section: the
+// configured folders it shares and when it was last seen. LastSeen is zero for a
+// device never seen. Rows with only Instance and Error set report an instance whose
+// devices could not be read.
+type DeviceRow struct {
+	Instance   string    `json:"instance"`
+	DeviceID   string    `json:"deviceID,omitempty"`
+	Device     string    `json:"device,omitempty"`     // the device's name in the config
+	Connection string    `json:"connection,omitempty"` // connected, disconnected or paused
+	LastSeen   time.Time `json:"lastSeen,omitempty"`
+	Folders    []string  `json:"folders,omitempty"`
+	Absent     bool      `json:"absent"` // not seen for longer than ST_DEVICE_ABSENT_WARN
+	Error      string    `json:"error,omitempty"`
+}
+
+// DeviceReport lists the remote devices sharing the folders in refs, one row per
+// device and instance, grouped by instance and sorted by device name. Wildcards are resolved to
+// the instance's folders; paused devices are never absent.
+func (s *Service) DeviceReport(ctx context.Context, refs []string) []DeviceRow {
+	var rows []DeviceRow
+	now := time.Now()
+	order, groups := s.groupByInstance(refs)
+	for _, inst := range order {
+		folders, err := s.cachedFolders(ctx, inst)
+		var d *completionDevices
+		if err == nil {
+			d, err = s.completionDevices(ctx, inst)
+		}
+		if err != nil {
+			rows = append(rows, DeviceRow{Instance: instanceName(inst), Error: err.Error()})
+			continue
+		}
+		shares := map[string][]string{} // device ID -> folder refs
+		for _, ref := range s.expandWildcards(ctx, groups[inst], "device check") {
+			_, id := s.splitRef(ref)
+			i := slices.IndexFunc(folders, func(f syncthing.FolderConfig) bool { return f.ID == id })
+			if i < 0 {
+				continue
+			}
+			for _, fd := range folders[i].Devices {
+				if fd.DeviceID != d.myID && !slices.Contains(shares[fd.DeviceID], ref) {
+					shares[fd.DeviceID] = append(shares[fd.DeviceID], ref)
+				}
+			}
+		}
+		start := len(rows)
+		for id, refs := range shares {
+			row := DeviceRow{Instance: instanceName(inst), DeviceID: id, Device: d.names[id], Connection: "disconnected", Folders: refs}
+			conn := d.conns[id]
+			switch {
+			case conn.Paused:
+				row.Connection = "paused"
+			case conn.Connected:
+				row.Connection = "connected"
+			}
+			if seen := d.stats[id].LastSeen; seen.Unix() > 0 {
+				row.LastSeen = seen
+			}
+			row.Absent = s.Settings.DeviceAbsentWarn > 0 && row.Connection == "disconnected" &&
+				(row.LastSeen.IsZero() || now.Sub(row.LastSeen) > s.Settings.DeviceAbsentWarn)
+			rows = append(rows, row)
+		}
+		added := rows[start:]
+		sort.Slice(added, func(i, j int) bool {
+			if added[i].Device != added[j].Device {
+				return added[i].Device < added[j].Device
+			}
+			return added[i].DeviceID < added[j].DeviceID
+		})
+	}
+	return rows
+}
+
+// checkDevices warns about devices sharing a configured folder that have not been
+// seen for longer than ST_DEVICE_ABSENT_WARN, at most once per deviceCheckInterval.
+// An absent device raises device_absent once; it is logged again when it is back.
+// What was warned about is kept in ST_STATE_FILE, so a restart does not repeat it.
+func (s *Service) checkDevices(ctx context.Context) {
+	if s.Settings.DeviceAbsentWarn <= 0 {
+		return
+	}
+	now := time.Now()
+	last := s.lastDeviceCheck.Load()
+	if last != 0 && now.Sub(time.Unix(0, last)) < deviceCheckInterval {
+		return
+	}
+	if !s.lastDeviceCheck.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+
+	for _, row := range s.DeviceReport(ctx, s.configuredFolders(ctx, "device check")) {
+		inst := row.Instance
+		if inst == defaultInstance {
+			inst = ""
+		}
+		if row.Error != "" {
+			s.logFailure(ctx, "devices:"+joinRef(inst, "*"), "device check", errors.New(row.Error), "Cannot check when devices were last seen on instance %s: %s", row.Instance, row.Error)
+			continue
+		}
+		s.logSuccess(ctx, "devices:"+joinRef(inst, "*"), "device check")
+		ref := joinRef(inst, row.DeviceID)
+		warned := !s.stateStore().device(ref).AbsentWarned.IsZero()
+		name := fmt.Sprintf("'%s'", joinRef(inst, shortDeviceID(row.DeviceID)))
+		if row.Device != "" {
+			name += " (" + row.Device + ")"
+		}
+		switch {
+		case row.Absent && !warned:
+			seen := "has never been seen"
+			if !row.LastSeen.IsZero() {
+				seen = fmt.Sprintf("was last seen %s ago at %s", now.Sub(row.LastSeen).Round(time.Minute), row.LastSeen.Format(time.RFC3339))
+			}
+			msg := fmt.Sprintf("Device %s %s, over ST_DEVICE_ABSENT_WARN (%s); it shares %s", name, seen, s.Settings.DeviceAbsentWarn, strings.Join(row.Folders, ", "))
+			s.log(ctx).Printf("Warning: %s", msg)
+			s.notify(NotifyEvent{
+				Type:     eventDeviceAbsent,
+				Instance: row.Instance,
+				Message:  msg,
+				Fields:   map[string]any{"deviceID": row.DeviceID, "device": row.Device, "lastSeen": row.LastSeen, "folders": row.Folders},
+			})
+			s.setAbsentWarned(ref, now)
+		case !row.Absent && warned:
+			s.log(ctx).Printf("Device %s is no longer absent (%s)", name, row.Connection)
+			s.setAbsentWarned(ref, time.Time{})
+		}
+	}
+}
+
+func (s *Service) setAbsentWarned(ref string, at time.Time) {
+	if err := s.stateStore().updateDevice(ref, func(d *DeviceState) { d.AbsentWarned = at.UTC() }); err != nil {
+		s.Logger.Printf("Failed to save state: %v", err)
+	}
+}
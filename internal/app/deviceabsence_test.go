@@ -0,0 +1,77 @@
+package app
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+func TestDeviceAbsenceWarnsOnceAndHourly(t *testing.T) {
+	const (
+		offsiteID = "OFFSITE-AAAAAAA-BBBBBBB-CCCCCCC-DDDDDDD-EEEEEEE-FFFFFFF-GGGGGGG"
+		phoneID   = "PHONEZZ-AAAAAAA-BBBBBBB-CCCCCCC-DDDDDDD-EEEEEEE-FFFFFFF-GGGGGGG"
+	)
+	fake := newFakeSyncthing(t, "docs", "photos", "scratch")
+	fake.folders[0].Devices = []syncthing.FolderDevice{{DeviceID: "FAKE"}, {DeviceID: offsiteID}}
+	fake.folders[1].Devices = []syncthing.FolderDevice{{DeviceID: "FAKE"}, {DeviceID: offsiteID}, {DeviceID: phoneID}, {DeviceID: laptopID}}
+	fake.folders[2].Devices = []syncthing.FolderDevice{{DeviceID: "FAKE"}, {DeviceID: phoneID}}
+	fake.setDevice(syncthing.DeviceConfig{DeviceID: offsiteID, Name: "Offsite NAS"})
+	fake.setDevice(syncthing.DeviceConfig{DeviceID: phoneID, Name: "phone"})
+	fake.setDevice(syncthing.DeviceConfig{DeviceID: laptopID, Name: "laptop", Paused: true})
+	threeWeeks := time.Now().Add(-21 * 24 * time.Hour)
+	fake.deviceStats = map[string]syncthing.DeviceStatistics{
+		offsiteID: {LastSeen: threeWeeks},
+		phoneID:   {LastSeen: time.Now().Add(-time.Hour)},
+		laptopID:  {LastSeen: threeWeeks},
+	}
+	rec := &recordingNotifier{}
+	var logs syncBuffer
+	settings := Settings{Folders: []string{"docs", "photos"}, DeviceAbsentWarn: 7 * 24 * time.Hour, StateFile: filepath.Join(t.TempDir(), "state.json")}
+	svc := fake.service(t, settings)
+	svc.Logger = log.New(&logs, "", 0)
+	svc.Notifiers = []Notifier{rec}
+
+	rows := svc.DeviceReport(context.Background(), svc.Folders())
+	if len(rows) != 3 || rows[0].Device != "Offsite NAS" || !rows[0].Absent || strings.Join(rows[0].Folders, ",") != "docs,photos" {
+		t.Fatalf("unexpected rows: %+v", rows)
+	}
+	if rows[1].Device != "laptop" || rows[1].Absent || rows[1].Connection != "paused" || rows[2].Device != "phone" || rows[2].Absent {
+		t.Fatalf("paused and recently seen devices should not be absent: %+v", rows)
+	}
+
+	// Every tick runs the check, but it only looks once per hour.
+	_ = svc.triggerScans(context.Background(), "global", svc.Folders(), nil)
+	_ = svc.triggerScans(context.Background(), "global", svc.Folders(), nil)
+	svc.notifications.Wait()
+	if got := fake.count("/rest/stats/device"); got != 2 {
+		t.Fatalf("expected the report and one check to read device stats, got %d", got)
+	}
+	rec.mu.Lock()
+	events := append([]NotifyEvent(nil), rec.events...)
+	rec.mu.Unlock()
+	if len(events) != 1 || events[0].Type != eventDeviceAbsent || events[0].Fields["device"] != "Offsite NAS" ||
+		!strings.Contains(events[0].Message, "(Offsite NAS) was last seen") || !strings.HasSuffix(events[0].Message, "it shares docs, photos") {
+		t.Fatalf("expected one device_absent event for the offsite NAS, got %+v", events)
+	}
+
+	// A restart remembers the warning; the device coming back clears it.
+	svc = fake.service(t, settings)
+	svc.Logger = log.New(&logs, "", 0)
+	svc.Notifiers = []Notifier{rec}
+	fake.mu.Lock()
+	fake.deviceStats[offsiteID] = syncthing.DeviceStatistics{LastSeen: time.Now()}
+	fake.mu.Unlock()
+	svc.checkDevices(context.Background())
+	svc.notifications.Wait()
+	if !strings.Contains(logs.String(), "Device 'OFFSITE' (Offsite NAS) is no longer absent (disconnected)") {
+		t.Fatalf("expected the device to be reported back:\n%s", logs.String())
+	}
+	if !svc.stateStore().device(offsiteID).AbsentWarned.IsZero() {
+		t.Fatalf("the warning should be cleared once the device is seen")
+	}
+}
@@ -0,0 +1,154 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+var errUnknownDevice = errors.New("no such device")
+
+// DevicePause is the pause state of a device with a pause window, for /api/status.
+type DevicePause struct {
+	Instance string    `json:"instance"`
+	DeviceID string    `json:"deviceID"`
+	Name     string    `json:"name,omitempty"`
+	Paused   bool      `json:"paused"`
+	PausedBy string    `json:"pausedBy,omitempty"` // "kicker" for a pause window, "user" otherwise
+	Since    time.Time `json:"since,omitempty"`    // when the kicker paused it
+}
+
+// devicePauses remembers how the devices with a pause window were last seen.
+type devicePauses struct {
+	mu      sync.Mutex
+	devices map[string]DevicePause // by instance-prefixed device ID
+}
+
+func (d *devicePauses) replace(devices map[string]DevicePause) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.devices = devices
+}
+
+func (d *devicePauses) setPaused(ref string, paused bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if dev, ok := d.devices[ref]; ok {
+		dev.Paused = paused
+		d.devices[ref] = dev
+	}
+}
+
+// devicePauseStatus lists the devices with a pause window and who paused them, if
+// anyone, sorted by instance and device ID.
+func (s *Service) devicePauseStatus() []DevicePause {
+	s.devicePauses.mu.Lock()
+	refs := slices.Sorted(maps.Keys(s.devicePauses.devices))
+	out := make([]DevicePause, 0, len(refs))
+	for _, ref := range refs {
+		out = append(out, s.devicePauses.devices[ref])
+	}
+	s.devicePauses.mu.Unlock()
+	for i, dev := range out {
+		ref := joinRef(dev.Instance, dev.DeviceID)
+		switch since := s.stateStore().device(ref).WindowPaused; {
+		case !since.IsZero():
+			out[i].PausedBy, out[i].Since = "kicker", since
+		case dev.Paused:
+			out[i].PausedBy = "user"
+		}
+	}
+	return out
+}
+
+// devicePauseTargets lists the devices with an ST_DEVICE_PAUSE_WINDOWS window or
+// paused by one. Devices are named by ID or by name; each instance's device list
+// is fetched once per call and tells whether they are paused.
+func (s *Service) devicePauseTargets(ctx context.Context) []pauseTarget {
+	configured := map[string]map[string][]PauseWindow{} // instance -> device ID or name -> windows
+	for ref, ws := range s.Settings.DevicePauseWindows {
+		inst, key := s.splitRef(ref)
+		if configured[inst] == nil {
+			configured[inst] = map[string][]PauseWindow{}
+		}
+		configured[inst][key] = append(configured[inst][key], ws...)
+	}
+	owned := s.stateStore().windowPausedDevices()
+	for _, ref := range owned {
+		if inst, _ := s.splitRef(ref); configured[inst] == nil {
+			configured[inst] = map[string][]PauseWindow{}
+		}
+	}
+
+	var out []pauseTarget
+	status := map[string]DevicePause{}
+	for _, inst := range slices.Sorted(maps.Keys(configured)) {
+		client := s.client(inst)
+		devices, _, err := client.Devices(ctx, pauseWindowTimeout)
+		if err != nil {
+			s.logFailure(ctx, "device:"+joinRef(inst, "*"), "pause window", err, "Cannot list the devices of instance %s for their pause windows: %v", instanceName(inst), err)
+			continue
+		}
+		s.logSuccess(ctx, "device:"+joinRef(inst, "*"), "pause window")
+
+		windows := map[string][]PauseWindow{} // by device ID
+		for key, ws := range configured[inst] {
+			i := slices.IndexFunc(devices, func(d syncthing.DeviceConfig) bool { return d.DeviceID == key || d.Name == key })
+			if i < 0 {
+				s.logFailure(ctx, "device:"+joinRef(inst, key), "pause window", errUnknownDevice,
+					"Device '%s' in ST_DEVICE_PAUSE_WINDOWS is not configured on instance %s", key, instanceName(inst))
+				continue
+			}
+			windows[devices[i].DeviceID] = append(windows[devices[i].DeviceID], ws...)
+		}
+		for _, ref := range owned {
+			if refInst, id := s.splitRef(ref); refInst == inst {
+				if _, ok := windows[id]; !ok {
+					windows[id] = nil
+				}
+			}
+		}
+
+		for _, id := range slices.Sorted(maps.Keys(windows)) {
+			ref := joinRef(inst, id)
+			i := slices.IndexFunc(devices, func(d syncthing.DeviceConfig) bool { return d.DeviceID == id })
+			var dev syncthing.DeviceConfig
+			if i >= 0 {
+				dev = devices[i]
+				status[ref] = DevicePause{Instance: instanceName(inst), DeviceID: id, Name: dev.Name, Paused: dev.Paused}
+			}
+			name := fmt.Sprintf("device '%s'", joinRef(inst, shortDeviceID(id)))
+			if dev.Name != "" {
+				name += " (" + dev.Name + ")"
+			}
+			out = append(out, pauseTarget{
+				key:     "device:" + ref,
+				name:    name,
+				verbs:   pauseVerbs,
+				windows: windows[id],
+				ours:    !s.stateStore().device(ref).WindowPaused.IsZero(),
+				paused: func(context.Context) (bool, bool, error) {
+					return dev.Paused, i >= 0, nil
+				},
+				set: func(ctx context.Context, paused bool) error {
+					if _, err := client.SetDevicePaused(ctx, id, paused, pauseWindowTimeout); err != nil {
+						return err
+					}
+					s.devicePauses.setPaused(ref, paused)
+					return nil
+				},
+				own: func(since time.Time) error {
+					return s.stateStore().updateDevice(ref, func(d *DeviceState) { d.WindowPaused = since })
+				},
+			})
+		}
+	}
+	s.devicePauses.replace(status)
+	return out
+}
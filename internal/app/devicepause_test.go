@@ -0,0 +1,91 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+const (
+	offsiteID = "OFFSITE-AAAAAAA-BBBBBBB-CCCCCCC-DDDDDDD-EEEEEEE-FFFFFFF-GGGGGGG"
+	laptopID  = "LAPTOPX-AAAAAAA-BBBBBBB-CCCCCCC-DDDDDDD-EEEEEEE-FFFFFFF-GGGGGGG"
+)
+
+func TestDevicePauseWindows(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	fake.setDevice(syncthing.DeviceConfig{DeviceID: offsiteID, Name: "Offsite"})
+	fake.setDevice(syncthing.DeviceConfig{DeviceID: laptopID, Name: "Laptop", Paused: true})
+	settings := Settings{
+		CronTimezone: "UTC",
+		StateFile:    filepath.Join(t.TempDir(), "state.json"),
+		DevicePauseWindows: map[string][]PauseWindow{
+			"Offsite": {mustPauseWindow(t, "06:00-23:00")}, // by name: only sync overnight
+			laptopID:  {mustPauseWindow(t, "06:00-23:00")}, // by ID, but paused in the GUI
+		},
+	}
+	svc := fake.service(t, settings)
+	ctx := context.Background()
+	at := func(hour int) time.Time { return time.Date(2024, 5, 6, hour, 30, 0, 0, time.UTC) }
+
+	svc.reconcilePauseWindows(ctx, at(12))
+	svc.reconcilePauseWindows(ctx, at(13))
+	if !fake.devicePaused(offsiteID) || fake.patches != 1 {
+		t.Fatalf("expected only the offsite device paused, got paused=%v after %d patches", fake.devicePaused(offsiteID), fake.patches)
+	}
+
+	rec := adminRequest(t, svc.adminHandler(ctx, make(chan struct{}, 1)), http.MethodGet, "/api/status", "", "")
+	var status struct{ Devices []DevicePause }
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(status.Devices) != 2 || status.Devices[0].DeviceID != laptopID || status.Devices[0].PausedBy != "user" ||
+		status.Devices[1].Name != "Offsite" || status.Devices[1].PausedBy != "kicker" || status.Devices[1].Since.IsZero() {
+		t.Fatalf("unexpected devices in /api/status: %s", rec.Body)
+	}
+
+	// Restarted after the window closed: the device the kicker paused is resumed,
+	// the one paused by hand stays paused.
+	if err := svc.FlushState(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	restarted := fake.service(t, settings)
+	restarted.reconcilePauseWindows(ctx, at(23))
+	if fake.devicePaused(offsiteID) || !fake.devicePaused(laptopID) || fake.patches != 2 {
+		t.Fatalf("expected offsite resumed and the laptop left paused, got %v/%v after %d patches",
+			fake.devicePaused(offsiteID), fake.devicePaused(laptopID), fake.patches)
+	}
+	if got := restarted.devicePauseStatus(); got[1].Paused || got[1].PausedBy != "" {
+		t.Fatalf("expected offsite shown as running, got %+v", got[1])
+	}
+}
+
+func TestDevicePauseWindowsDryRun(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	fake.setDevice(syncthing.DeviceConfig{DeviceID: offsiteID, Name: "Offsite"})
+	svc := fake.service(t, Settings{
+		DryRun:             true,
+		CronTimezone:       "UTC",
+		DevicePauseWindows: map[string][]PauseWindow{"Offsite": {mustPauseWindow(t, "06:00-23:00")}, "Phone": {mustPauseWindow(t, "06:00-23:00")}},
+	})
+	var buf syncBuffer
+	svc.Logger = log.New(&buf, "", 0)
+
+	svc.reconcilePauseWindows(context.Background(), time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC))
+	if fake.devicePaused(offsiteID) || fake.patches != 0 {
+		t.Fatalf("dry run paused the device")
+	}
+	out := buf.String()
+	if !strings.Contains(out, "[dry-run] Would pause device 'OFFSITE' (Offsite) for pause window 06:00-23:00") {
+		t.Fatalf("expected the dry-run pause to be logged:\n%s", out)
+	}
+	if !strings.Contains(out, "Device 'Phone' in ST_DEVICE_PAUSE_WINDOWS is not configured on instance default") {
+		t.Fatalf("expected the unknown device to be reported:\n%s", out)
+	}
+}
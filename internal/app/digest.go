@@ -0,0 +1,155 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+const eventDigest = "digest"
+
+// Digest accumulates per-folder activity between two ST_DIGEST_CRON emissions. It is
+// kept in the state file so a restart does not lose the numbers collected so far.
+type Digest struct {
+	Since   time.Time                `json:"since"`
+	Folders map[string]*DigestFolder `json:"folders,omitempty"`
+}
+
+// DigestFolder is one folder's share of a digest.
+type DigestFolder struct {
+	Scans         int64  `json:"scans"`
+	Failures      int64  `json:"failures"`
+	Skips         int64  `json:"skips"`
+	State         string `json:"state,omitempty"` // last observed
+	PeakNeedBytes int64  `json:"peakNeedBytes"`
+	ScanTimeMs    int64  `json:"scanTimeMs"`         // total time spent in trigger attempts
+	Inactive      string `json:"inactive,omitempty"` // "paused" or "stopped" when first found so in Syncthing
+}
+
+// updateDigest applies fn to the folder's digest entry and persists the result.
+// fn reports whether it changed anything worth saving.
+func (st *stateStore) updateDigest(folder string, fn func(*DigestFolder) bool) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	d := st.state.Digest
+	if d == nil {
+		d = &Digest{Since: time.Now().UTC()}
+		st.state.Digest = d
+	}
+	if d.Folders == nil {
+		d.Folders = map[string]*DigestFolder{}
+	}
+	f := d.Folders[folder]
+	if f == nil {
+		f = &DigestFolder{}
+		d.Folders[folder] = f
+	}
+	if !fn(f) {
+		return nil
+	}
+	return st.saveLocked()
+}
+
+// takeDigest returns the accumulated digest and starts a new one.
+func (st *stateStore) takeDigest(now time.Time) (Digest, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	d := Digest{Since: now}
+	if st.state.Digest != nil {
+		d = *st.state.Digest
+	}
+	st.state.Digest = &Digest{Since: now}
+	return d, st.saveLocked()
+}
+
+// digestScan adds one trigger attempt, as recorded by a run, to the digest.
+func (s *Service) digestScan(folder string, res RunFolderResult) {
+	if _, id := s.splitRef(folder); id == "*" {
+		return
+	}
+	err := s.stateStore().updateDigest(folder, func(f *DigestFolder) bool {
+		switch res.Result {
+		case resultTriggered, resultTimeout:
+			f.Scans++
+		case resultFailed:
+			f.Failures++
+		case resultSkipped:
+			f.Skips++
+		default:
+			return false
+		}
+		f.ScanTimeMs += res.DurationMs
+		return true
+	})
+	if err != nil {
+		s.Logger.Printf("Failed to save state: %v", err)
+	}
+}
+
+// digestStatus folds a status check into the digest.
+func (s *Service) digestStatus(folder string, st syncthing.FolderStatus) {
+	err := s.stateStore().updateDigest(folder, func(f *DigestFolder) bool {
+		if f.State == st.State && st.NeedBytes <= f.PeakNeedBytes {
+			return false
+		}
+		f.State = st.State
+		f.PeakNeedBytes = max(f.PeakNeedBytes, st.NeedBytes)
+		return true
+	})
+	if err != nil {
+		s.Logger.Printf("Failed to save state: %v", err)
+	}
+}
+
+// sendDigest logs the accumulated digest, sends it as a digest event and resets it.
+func (s *Service) sendDigest() {
+	now := time.Now().UTC()
+	d, err := s.stateStore().takeDigest(now)
+	if err != nil {
+		s.Logger.Printf("Failed to save state: %v", err)
+	}
+	msg := formatDigest(d, now)
+	for _, line := range strings.Split(msg, "\n") {
+		s.Logger.Printf("%s", line)
+	}
+	folders := map[string]DigestFolder{}
+	for id, f := range d.Folders {
+		folders[id] = *f
+	}
+	s.notify(NotifyEvent{
+		Type:    eventDigest,
+		Message: msg,
+		Fields:  map[string]any{"since": d.Since, "until": now, "folders": folders},
+	})
+}
+
+// formatDigest renders a digest as a heading plus one line per folder.
+func formatDigest(d Digest, until time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Digest for %s to %s", d.Since.Local().Format("2006-01-02 15:04"), until.Local().Format("2006-01-02 15:04"))
+	if len(d.Folders) == 0 {
+		b.WriteString(": no activity")
+		return b.String()
+	}
+	ids := make([]string, 0, len(d.Folders))
+	for id := range d.Folders {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		f := d.Folders[id]
+		state := f.State
+		if state == "" {
+			state = "unknown"
+		}
+		fmt.Fprintf(&b, "\n  %s: %d scans, %d failed, %d skipped, %s, worst need %s, scan time %s",
+			id, f.Scans, f.Failures, f.Skips, state, formatBytes(f.PeakNeedBytes), (time.Duration(f.ScanTimeMs) * time.Millisecond).Round(time.Millisecond))
+		if f.Inactive != "" {
+			fmt.Fprintf(&b, ", found %s in Syncthing", f.Inactive)
+		}
+	}
+	return b.String()
+}
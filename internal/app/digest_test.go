@@ -0,0 +1,96 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+func TestDigestAccumulatesAndResets(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs", "photos")
+	rec := &recordingNotifier{}
+	settings := Settings{StateFile: filepath.Join(t.TempDir(), "state.json")}
+	svc := fake.service(t, settings)
+	svc.Notifiers = []Notifier{rec}
+	ctx := context.Background()
+
+	svc.triggerScans(ctx, "global", []string{"docs", "photos"}, nil)
+	fake.failScans(http.StatusInternalServerError)
+	svc.triggerScans(ctx, "global", []string{"docs"}, nil)
+	fake.failScans(0)
+	fake.setStatus("docs", syncthing.FolderStatus{State: "syncing", NeedBytes: 2048})
+	_ = svc.checkSyncStatus(ctx, []string{"docs"}, 0)
+	fake.setStatus("docs", syncthing.FolderStatus{State: "idle"})
+	_ = svc.checkSyncStatus(ctx, []string{"docs"}, 0)
+
+	// A restart mid-day keeps the numbers collected so far.
+	svc = fake.service(t, settings)
+	svc.Notifiers = []Notifier{rec}
+	svc.sendDigest()
+	svc.notifications.Wait()
+
+	var digests []NotifyEvent
+	rec.mu.Lock()
+	for _, ev := range rec.events {
+		if ev.Type == eventDigest {
+			digests = append(digests, ev)
+		}
+	}
+	rec.mu.Unlock()
+	if len(digests) != 1 {
+		t.Fatalf("expected one digest event, got %+v", digests)
+	}
+	ev := digests[0]
+	docs := ev.Fields["folders"].(map[string]DigestFolder)["docs"]
+	if docs.Scans != 1 || docs.Failures != 1 || docs.State != "idle" || docs.PeakNeedBytes != 2048 {
+		t.Fatalf("unexpected docs digest: %+v", docs)
+	}
+	if !strings.Contains(ev.Message, "docs: 1 scans, 1 failed, 0 skipped, idle, worst need 2.0 KiB") {
+		t.Fatalf("unexpected message:\n%s", ev.Message)
+	}
+
+	d, _ := svc.stateStore().takeDigest(ev.Time)
+	if len(d.Folders) != 0 {
+		t.Fatalf("digest should be reset after sending: %+v", d)
+	}
+}
+
+func TestDigestScheduleEntry(t *testing.T) {
+	svc := newFakeSyncthing(t).service(t, Settings{CronExpr: "*/5 * * * *", DigestCron: "0 8 * * *"})
+	c, err := svc.buildCronScheduler(make(chan struct{}, 1))
+	if err != nil {
+		t.Fatalf("build scheduler: %v", err)
+	}
+	defer c.Stop()
+	found := false
+	for _, e := range svc.schedules {
+		found = found || (e.label == "digest" && e.expr == "0 8 * * *")
+	}
+	if !found {
+		t.Fatalf("expected a digest schedule entry, got %+v", svc.schedules)
+	}
+
+	svc = newFakeSyncthing(t).service(t, Settings{CronExpr: "*/5 * * * *", DigestCron: "bogus"})
+	if _, err := svc.buildCronScheduler(make(chan struct{}, 1)); err == nil {
+		t.Fatalf("expected an error for an invalid ST_DIGEST_CRON")
+	}
+}
+
+func TestLoadSettingsRejectsInvalidDigestCron(t *testing.T) {
+	os.Clearenv()
+	os.Setenv("ST_API_KEY", "abc123")
+	os.Setenv("ST_CRON", "*/5 * * * *")
+	os.Setenv("ST_DIGEST_CRON", "0 8 * *")
+	if _, err := LoadSettingsFromEnv(); err == nil || !strings.Contains(err.Error(), "invalid ST_DIGEST_CRON") {
+		t.Fatalf("expected an invalid ST_DIGEST_CRON to be rejected at load, got %v", err)
+	}
+	os.Setenv("ST_DIGEST_CRON", "0 8 * * *")
+	if s, err := LoadSettingsFromEnv(); err != nil || s.DigestCron != "0 8 * * *" {
+		t.Fatalf("expected the digest schedule, got %q, %v", s.DigestCron, err)
+	}
+}
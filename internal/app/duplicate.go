@@ -0,0 +1,170 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+// scanEvents are the events duplicate kicker detection follows.
+var scanEvents = []string{"StateChanged"}
+
+type stateChangedEvent struct {
+	Folder string `json:"folder"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+// scanOrigins tells the scans this kicker triggered from the others. Each trigger
+// explains one scan of its folder starting within ST_DUPLICATE_SCAN_WINDOW; a
+// trigger of "*" explains all of them on its instance. The zero value is ready to
+// use.
+type scanOrigins struct {
+	mu          sync.Mutex
+	triggered   map[string][]time.Time // by folder ref, oldest first
+	unexplained map[string]int         // by instance, since the last warning
+}
+
+// record notes that ref was triggered at t, forgetting its triggers older than
+// window.
+func (o *scanOrigins) record(ref string, t time.Time, window time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.triggered == nil {
+		o.triggered = map[string][]time.Time{}
+	}
+	ts := o.triggered[ref]
+	for len(ts) > 0 && t.Sub(ts[0]) > window {
+		ts = ts[1:]
+	}
+	o.triggered[ref] = append(ts, t)
+}
+
+// explain reports whether a scan of ref (or of "*" on its instance, all) starting
+// at t follows one of our triggers within window, using up that trigger.
+func (o *scanOrigins) explain(ref, all string, t time.Time, window time.Duration) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	recent := func(key string) []time.Time {
+		ts := o.triggered[key]
+		for len(ts) > 0 && t.Sub(ts[0]) > window {
+			ts = ts[1:]
+		}
+		if len(ts) == 0 {
+			delete(o.triggered, key)
+		} else {
+			o.triggered[key] = ts
+		}
+		return ts
+	}
+	if ts := recent(ref); len(ts) > 0 {
+		o.triggered[ref] = ts[1:]
+		return true
+	}
+	return len(recent(all)) > 0
+}
+
+// count adds an unexplained scan on inst and returns how many there have been since
+// the last reset.
+func (o *scanOrigins) count(inst string) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.unexplained == nil {
+		o.unexplained = map[string]int{}
+	}
+	o.unexplained[inst]++
+	return o.unexplained[inst]
+}
+
+func (o *scanOrigins) reset(inst string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.unexplained, inst)
+}
+
+// runDuplicateDetection follows the scans of every instance to spot another kicker
+// pointed at the same Syncthing, when ST_DUPLICATE_SCAN_THRESHOLD is set.
+func (s *Service) runDuplicateDetection(ctx context.Context) {
+	if s.Settings.DuplicateScanThreshold <= 0 {
+		return
+	}
+	for _, inst := range s.instances() {
+		s.watchers.Add(1)
+		go func(inst string) {
+			defer s.watchers.Done()
+			s.followEvents(ctx, inst, scanEvents, func(ev syncthing.Event) {
+				s.handleScanEvent(ctx, inst, ev, time.Now())
+			})
+		}(inst)
+	}
+}
+
+// handleScanEvent looks at a folder starting to scan at now. A scan we did not
+// trigger that starts within ST_DUPLICATE_SCAN_WINDOW of one of the folder's
+// schedule times is what a second kicker with the same settings would cause; once
+// ST_DUPLICATE_SCAN_THRESHOLD of them are seen on an instance, a warning is logged
+// and the count starts over. Scans at other times, from Syncthing's own rescans or
+// its watcher, are not counted.
+func (s *Service) handleScanEvent(ctx context.Context, inst string, ev syncthing.Event, now time.Time) {
+	var data stateChangedEvent
+	if ev.Type != "StateChanged" || json.Unmarshal(ev.Data, &data) != nil || data.To != "scanning" {
+		return
+	}
+	ref := s.missingRef(joinRef(inst, data.Folder))
+	window := s.Settings.DuplicateScanWindow
+	if s.origins.explain(ref, joinRef(inst, "*"), now, window) {
+		return
+	}
+	fired, ok := s.scheduledNear(inst, ref, now, window)
+	if !ok {
+		return
+	}
+	n := s.origins.count(inst)
+	s.log(ctx).Printf("Folder %s%s started scanning at %s, near its %s schedule time %s, without a trigger from this kicker (%d of %d)",
+		ref, s.labelSuffix(ref), now.Format(time.RFC3339), fired.label, fired.at.Format(time.RFC3339), n, s.Settings.DuplicateScanThreshold)
+	if n < s.Settings.DuplicateScanThreshold {
+		return
+	}
+	s.origins.reset(inst)
+	s.log(ctx).Printf("Warning: %d scan(s) on instance %s started at our schedule times without being triggered by this kicker; "+
+		"another syncthing-kicker is probably pointed at the same Syncthing, doubling every scan. Look for a second kicker on other hosts and containers",
+		n, instanceName(inst))
+}
+
+// scheduleFire is a schedule time near a scan.
+type scheduleFire struct {
+	label string
+	at    time.Time
+}
+
+// scheduledNear finds a schedule that scans ref, directly or through ST_FOLDERS,
+// with a fire time within window of t.
+func (s *Service) scheduledNear(inst, ref string, t time.Time, window time.Duration) (scheduleFire, bool) {
+	globals := s.Folders()
+	s.schedMu.Lock()
+	defer s.schedMu.Unlock()
+	if s.cron == nil {
+		return scheduleFire{}, false
+	}
+	for _, e := range s.schedules {
+		folder, scan := strings.CutPrefix(e.label, "folder:")
+		switch {
+		case e.label == "global" && coveredBy(globals, inst, ref):
+		case scan && s.missingRef(folder) == ref:
+		default:
+			continue
+		}
+		entry := s.cron.Entry(e.id)
+		if entry.Schedule == nil {
+			continue
+		}
+		if next := entry.Schedule.Next(t.Add(-window)); !next.After(t.Add(window)) {
+			return scheduleFire{label: e.label, at: next}, true
+		}
+	}
+	return scheduleFire{}, false
+}
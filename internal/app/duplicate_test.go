@@ -0,0 +1,94 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+func stateChanged(t *testing.T, folder, from, to string) syncthing.Event {
+	t.Helper()
+	raw, err := json.Marshal(map[string]any{"folder": folder, "from": from, "to": to})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return syncthing.Event{Type: "StateChanged", Data: raw}
+}
+
+func TestDuplicateKickerDetectedFromScanEvents(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs", "media", "notes")
+	var logs syncBuffer
+	svc := fake.service(t, Settings{
+		CronExpr:               "0 * * * *",
+		CronTimezone:           "UTC",
+		Folders:                []string{"docs", "media"},
+		FolderCron:             map[string]string{"default/notes": "30 2 * * *"},
+		DuplicateScanThreshold: 3,
+		DuplicateScanWindow:    time.Minute,
+	})
+	svc.Logger = log.New(&logs, "", 0)
+	sched, err := svc.buildCronScheduler(make(chan struct{}, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.cron = sched
+	ctx := context.Background()
+	at := func(h, m, s int) time.Time { return time.Date(2024, 5, 6, h, m, s, 0, time.UTC) }
+
+	// Our own trigger explains one scan; the second one at the top of the hour is
+	// the other kicker's.
+	svc.origins.record("docs", at(10, 0, 0), time.Minute)
+	svc.handleScanEvent(ctx, "", stateChanged(t, "docs", "idle", "scanning"), at(10, 0, 2))
+	svc.handleScanEvent(ctx, "", stateChanged(t, "docs", "scanning", "idle"), at(10, 0, 3))
+	svc.handleScanEvent(ctx, "", stateChanged(t, "docs", "scan-waiting", "scanning"), at(10, 0, 4))
+	if got := svc.origins.unexplained[""]; got != 1 {
+		t.Fatalf("expected one unexplained scan, got %d:\n%s", got, logs.String())
+	}
+
+	// Syncthing's own rescans and watcher scans away from the schedule, and scans of
+	// folders no schedule covers, do not count.
+	svc.handleScanEvent(ctx, "", stateChanged(t, "media", "idle", "scanning"), at(10, 23, 0))
+	svc.handleScanEvent(ctx, "", stateChanged(t, "other", "idle", "scanning"), at(11, 0, 5))
+	if got := svc.origins.unexplained[""]; got != 1 {
+		t.Fatalf("off-schedule scans should not count, got %d", got)
+	}
+
+	// A per-folder schedule matches too, however its instance is written.
+	svc.handleScanEvent(ctx, "", stateChanged(t, "notes", "idle", "scanning"), at(2, 30, 40))
+	svc.handleScanEvent(ctx, "", stateChanged(t, "media", "idle", "scanning"), at(10, 59, 30))
+	if !strings.Contains(logs.String(), "Warning: 3 scan(s) on instance default started at our schedule times without being triggered by this kicker") {
+		t.Fatalf("expected the duplicate kicker warning:\n%s", logs.String())
+	}
+	if got := svc.origins.unexplained[""]; got != 0 {
+		t.Fatalf("the count should start over after a warning, got %d", got)
+	}
+}
+
+func TestDuplicateDetectionRecordsOwnTriggers(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	var logs syncBuffer
+	svc := fake.service(t, Settings{CronExpr: "* * * * *", Folders: []string{"docs"}, DuplicateScanThreshold: 1, DuplicateScanWindow: time.Minute})
+	svc.Logger = log.New(&logs, "", 0)
+	sched, err := svc.buildCronScheduler(make(chan struct{}, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.cron = sched
+	ctx := context.Background()
+
+	_ = svc.triggerScans(ctx, "global", []string{"docs"}, nil)
+	svc.statusChecks.Wait()
+	svc.handleScanEvent(ctx, "", stateChanged(t, "docs", "idle", "scanning"), time.Now())
+	if strings.Contains(logs.String(), "Warning") {
+		t.Fatalf("a scan we triggered should not count:\n%s", logs.String())
+	}
+	svc.handleScanEvent(ctx, "", stateChanged(t, "docs", "idle", "scanning"), time.Now())
+	if !strings.Contains(logs.String(), "Warning: 1 scan(s) on instance default") {
+		t.Fatalf("a second scan should:\n%s", logs.String())
+	}
+}
@@ -0,0 +1,158 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+var (
+	eventPollWait      = 60 * time.Second
+	eventRetryInterval = 10 * time.Second
+	completionEvents   = []string{"FolderSummary", "FolderCompletion"}
+)
+
+// runEventSubscription follows the event stream of every instance that is the source
+// of a completion rule.
+func (s *Service) runEventSubscription(ctx context.Context, pending chan struct{}) {
+	sources := make([]string, 0, len(s.Settings.CompletionRules))
+	for source := range s.Settings.CompletionRules {
+		sources = append(sources, source)
+	}
+	order, _ := s.groupByInstance(sources)
+	for _, inst := range order {
+		s.watchers.Add(1)
+		go func(inst string) {
+			defer s.watchers.Done()
+			behind := map[string]bool{}
+			s.followEvents(ctx, inst, completionEvents, func(ev syncthing.Event) {
+				s.handleCompletionEvent(ctx, inst, ev, behind, pending)
+			})
+		}(inst)
+	}
+}
+
+// followEvents long-polls instance's events of the given types, passing each to
+// handle in order, until ctx ends. Failures are logged and retried.
+func (s *Service) followEvents(ctx context.Context, instance string, types []string, handle func(syncthing.Event)) {
+	client := s.client(instance)
+	ref := joinRef(instance, "*")
+	since := int64(-1)
+	for ctx.Err() == nil {
+		var err error
+		if since < 0 {
+			// Start from the newest event so history is not replayed as fresh events.
+			since, err = latestEventID(ctx, client, types)
+		}
+		var events []syncthing.Event
+		if err == nil {
+			events, _, err = client.Events(ctx, since, 0, types, eventPollWait)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			s.logFailure(ctx, ref, "event subscription", err, "Event subscription on instance %s failed: %v; retrying in %s", instanceName(instance), err, eventRetryInterval)
+			since = -1 // Syncthing may have restarted and reset event IDs
+			t := time.NewTimer(eventRetryInterval)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return
+			case <-t.C:
+			}
+			continue
+		}
+		s.logSuccess(ctx, ref, "event subscription")
+		for _, ev := range events {
+			since = ev.ID
+			handle(ev)
+		}
+	}
+}
+
+func latestEventID(ctx context.Context, client *syncthing.Client, types []string) (int64, error) {
+	events, _, err := client.Events(ctx, 0, 1, types, 0)
+	if err != nil {
+		return -1, err
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+	return events[len(events)-1].ID, nil
+}
+
+type folderSummaryEvent struct {
+	Folder  string `json:"folder"`
+	Summary struct {
+		State          string `json:"state"`
+		NeedBytes      int64  `json:"needBytes"`
+		NeedTotalItems int64  `json:"needTotalItems"`
+	} `json:"summary"`
+}
+
+type folderCompletionEvent struct {
+	Folder     string  `json:"folder"`
+	Device     string  `json:"device"`
+	Completion float64 `json:"completion"`
+	NeedBytes  int64   `json:"needBytes"`
+}
+
+// handleCompletionEvent tracks completion episodes per (source folder, device) and scans
+// the rule targets exactly once when a source that was behind becomes complete. Event
+// folders are qualified with the instance the event came from before rule lookup.
+func (s *Service) handleCompletionEvent(ctx context.Context, instance string, ev syncthing.Event, behind map[string]bool, pending chan struct{}) {
+	var folder, device string
+	var done bool
+	switch ev.Type {
+	case "FolderSummary":
+		var data folderSummaryEvent
+		if err := json.Unmarshal(ev.Data, &data); err != nil {
+			return
+		}
+		folder = joinRef(instance, data.Folder)
+		done = data.Summary.State == "idle" && data.Summary.NeedBytes == 0 && data.Summary.NeedTotalItems == 0
+	case "FolderCompletion":
+		var data folderCompletionEvent
+		if err := json.Unmarshal(ev.Data, &data); err != nil {
+			return
+		}
+		folder, device = joinRef(instance, data.Folder), data.Device
+		done = data.Completion >= 100 && data.NeedBytes == 0
+	default:
+		return
+	}
+
+	targets := s.Settings.CompletionRules[folder]
+	if len(targets) == 0 {
+		return
+	}
+	key := folder + "|" + device
+	if !done {
+		behind[key] = true
+		return
+	}
+	if !behind[key] {
+		return
+	}
+	delete(behind, key)
+
+	who := ""
+	if device != "" {
+		who = " on device " + shortDeviceID(device)
+	}
+	ctx = withRunID(ctx, newRunID())
+	s.log(ctx).Printf("Folder '%s'%s finished syncing%s; triggering scan for %s", folder, s.labelSuffix(folder), who, strings.Join(targets, ", "))
+	_ = s.triggerScans(ctx, "completion:"+folder, targets, pending)
+}
+
+// shortDeviceID returns the first block of a Syncthing device ID for log lines.
+func shortDeviceID(id string) string {
+	if i := strings.IndexByte(id, '-'); i > 0 {
+		return id[:i]
+	}
+	return id
+}
@@ -0,0 +1,106 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+func summaryEvent(t *testing.T, folder, state string, needBytes int64) syncthing.Event {
+	t.Helper()
+	data := map[string]any{"folder": folder, "summary": map[string]any{"state": state, "needBytes": needBytes}}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return syncthing.Event{Type: "FolderSummary", Data: raw}
+}
+
+func TestCompletionRuleFiresOncePerEpisode(t *testing.T) {
+	fake := newFakeSyncthing(t, "inbox", "archive")
+	svc := fake.service(t, Settings{CompletionRules: map[string][]string{"inbox": {"archive"}}})
+	behind := map[string]bool{}
+	pending := make(chan struct{}, 16)
+	ctx := context.Background()
+
+	// Already idle on first sight: nothing to do.
+	svc.handleCompletionEvent(ctx, "", summaryEvent(t, "inbox", "idle", 0), behind, pending)
+	// Falls behind, keeps syncing, then completes twice.
+	svc.handleCompletionEvent(ctx, "", summaryEvent(t, "inbox", "syncing", 1000), behind, pending)
+	svc.handleCompletionEvent(ctx, "", summaryEvent(t, "inbox", "syncing", 10), behind, pending)
+	svc.handleCompletionEvent(ctx, "", summaryEvent(t, "inbox", "idle", 0), behind, pending)
+	svc.handleCompletionEvent(ctx, "", summaryEvent(t, "inbox", "idle", 0), behind, pending)
+
+	if got := fake.scanned(); len(got) != 1 || got[0] != "archive" {
+		t.Fatalf("expected one archive scan, got %v", got)
+	}
+
+	// A second episode triggers again.
+	svc.handleCompletionEvent(ctx, "", summaryEvent(t, "inbox", "syncing", 5), behind, pending)
+	svc.handleCompletionEvent(ctx, "", summaryEvent(t, "inbox", "idle", 0), behind, pending)
+	if got := fake.scanned(); len(got) != 2 {
+		t.Fatalf("expected second episode to scan, got %v", got)
+	}
+}
+
+func TestCompletionRuleIgnoresOtherFolders(t *testing.T) {
+	fake := newFakeSyncthing(t, "inbox", "archive", "other")
+	svc := fake.service(t, Settings{CompletionRules: map[string][]string{"inbox": {"archive"}}})
+	behind := map[string]bool{}
+	pending := make(chan struct{}, 16)
+
+	svc.handleCompletionEvent(context.Background(), "", summaryEvent(t, "other", "syncing", 5), behind, pending)
+	svc.handleCompletionEvent(context.Background(), "", summaryEvent(t, "other", "idle", 0), behind, pending)
+
+	if got := fake.scanned(); len(got) != 0 {
+		t.Fatalf("expected no scans, got %v", got)
+	}
+}
+
+func TestCompletionRuleTracksRemoteDevicesSeparately(t *testing.T) {
+	fake := newFakeSyncthing(t, "inbox", "archive")
+	svc := fake.service(t, Settings{CompletionRules: map[string][]string{"inbox": {"archive"}}})
+	behind := map[string]bool{}
+	pending := make(chan struct{}, 16)
+	completion := func(device string, pct float64) syncthing.Event {
+		raw, _ := json.Marshal(map[string]any{"folder": "inbox", "device": device, "completion": pct})
+		return syncthing.Event{Type: "FolderCompletion", Data: raw}
+	}
+
+	svc.handleCompletionEvent(context.Background(), "", completion("AAAA-BBBB", 40), behind, pending)
+	svc.handleCompletionEvent(context.Background(), "", completion("CCCC-DDDD", 100), behind, pending)
+	if got := fake.scanned(); len(got) != 0 {
+		t.Fatalf("unrelated device completion must not fire, got %v", got)
+	}
+	svc.handleCompletionEvent(context.Background(), "", completion("AAAA-BBBB", 100), behind, pending)
+	if got := fake.scanned(); len(got) != 1 {
+		t.Fatalf("expected one scan, got %v", got)
+	}
+}
+
+func TestFollowEventsSkipsHistoryAndReactsToNewEvents(t *testing.T) {
+	fake := newFakeSyncthing(t, "inbox", "archive")
+	// History from before startup must not be replayed.
+	fake.addEvent("FolderSummary", map[string]any{"folder": "inbox", "summary": map[string]any{"state": "syncing", "needBytes": 5}})
+	fake.addEvent("FolderSummary", map[string]any{"folder": "inbox", "summary": map[string]any{"state": "idle"}})
+	svc := fake.service(t, Settings{CompletionRules: map[string][]string{"inbox": {"archive"}}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	svc.runEventSubscription(ctx, make(chan struct{}, 16))
+
+	time.Sleep(50 * time.Millisecond)
+	if got := fake.scanned(); len(got) != 0 {
+		t.Fatalf("history replayed: %v", got)
+	}
+
+	fake.addEvent("FolderSummary", map[string]any{"folder": "inbox", "summary": map[string]any{"state": "syncing", "needBytes": 5}})
+	fake.addEvent("FolderSummary", map[string]any{"folder": "inbox", "summary": map[string]any{"state": "idle"}})
+	waitFor(t, 2*time.Second, func() bool { return len(fake.scanned()) == 1 })
+
+	cancel()
+	svc.watchers.Wait()
+}
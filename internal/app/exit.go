@@ -0,0 +1,69 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"strconv"
+)
+
+// Exit codes of syncthing-kicker. --check, its Nagios format and the subcommands
+// keep the codes they document, passed through as an ExitStatus.
+const (
+	ExitOK          = 0
+	ExitFailure     = 1 // a runtime failure, an aborted run or a failed check
+	ExitConfig      = 2 // invalid settings or flags, or clients that cannot be set up with them
+	ExitUnreachable = 3 // Syncthing did not answer at all
+)
+
+// Classes of fatal errors, matched with errors.Is.
+var (
+	ErrConfig      = errors.New("invalid configuration")
+	ErrClient      = errors.New("cannot set up a client")
+	ErrUnreachable = errors.New("Syncthing unreachable")
+	ErrCheckFailed = errors.New("check failed")
+	ErrAborted     = errors.New("run aborted")
+)
+
+// FatalError is an error that ends the process, tagged with its class.
+type FatalError struct {
+	Class error // one of the Err classes above
+	Err   error
+}
+
+// Fatal tags err with class; a nil err stays nil.
+func Fatal(class, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &FatalError{Class: class, Err: err}
+}
+
+func (e *FatalError) Error() string   { return e.Err.Error() }
+func (e *FatalError) Unwrap() []error { return []error{e.Class, e.Err} }
+
+// ExitStatus is an exit code decided by the caller, such as a check's result.
+type ExitStatus int
+
+func (e ExitStatus) Error() string { return "exit status " + strconv.Itoa(int(e)) }
+
+// ExitCode maps an error ending the process to its exit code. A context deadline
+// counts as ErrAborted, and other connection failures that carry no class of their
+// own as ErrUnreachable.
+func ExitCode(err error) int {
+	var status ExitStatus
+	switch {
+	case err == nil, errors.Is(err, context.Canceled):
+		return ExitOK
+	case errors.As(err, &status):
+		return int(status)
+	case errors.Is(err, ErrConfig), errors.Is(err, ErrClient):
+		return ExitConfig
+	case errors.Is(err, ErrUnreachable):
+		return ExitUnreachable
+	case errors.Is(err, ErrCheckFailed), errors.Is(err, ErrAborted), errors.Is(err, context.DeadlineExceeded):
+		return ExitFailure
+	case isUnreachable(err):
+		return ExitUnreachable
+	}
+	return ExitFailure
+}
@@ -0,0 +1,44 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	cases := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"clean exit", nil, ExitOK},
+		{"shutdown", context.Canceled, ExitOK},
+		{"wrapped shutdown", fmt.Errorf("run: %w", context.Canceled), ExitOK},
+		{"settings", Fatal(ErrConfig, errors.New("ST_CRON is invalid")), ExitConfig},
+		{"client", Fatal(ErrClient, errors.New("bad URL")), ExitConfig},
+		{"unreachable", Fatal(ErrUnreachable, errors.New("no answer")), ExitUnreachable},
+		{"untagged connection failure", fmt.Errorf("cannot list the folders of instance default: %w", refused), ExitUnreachable},
+		{"check", Fatal(ErrCheckFailed, refused), ExitFailure}, // the class wins over the cause
+		{"aborted", Fatal(ErrAborted, errors.New("run deadline exceeded")), ExitFailure},
+		{"deadline", context.DeadlineExceeded, ExitFailure},
+		{"explicit status", ExitStatus(NagiosUnknown), NagiosUnknown},
+		{"wrapped status", fmt.Errorf("compare: %w", ExitStatus(2)), 2},
+		{"other", errors.New("listen tcp: address already in use"), ExitFailure},
+	}
+	for _, tc := range cases {
+		if got := ExitCode(tc.err); got != tc.want {
+			t.Errorf("%s: ExitCode(%v) = %d, want %d", tc.name, tc.err, got, tc.want)
+		}
+	}
+	if Fatal(ErrConfig, nil) != nil {
+		t.Fatalf("expected Fatal to keep a nil error nil")
+	}
+	if err := Fatal(ErrConfig, errors.New("ST_CRON is invalid")); err.Error() != "ST_CRON is invalid" || !errors.Is(err, ErrConfig) {
+		t.Fatalf("unexpected fatal error: %v", err)
+	}
+}
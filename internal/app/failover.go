@@ -0,0 +1,40 @@
+package app
+
+import (
+	"context"
+	"time"
+)
+
+// failoverProbeInterval is how often instances with a fallback address are probed.
+var failoverProbeInterval = 30 * time.Second
+
+// runFailoverProbes periodically probes both addresses of every instance configured
+// with a fallback, so requests return to the primary once it is reachable again.
+// Locks, state and stats are keyed by folder, never by address, so a switchover
+// mid-run cannot cause a second trigger.
+func (s *Service) runFailoverProbes(ctx context.Context) {
+	for _, inst := range s.instances() {
+		client := s.client(inst)
+		if client == nil || !client.HasFallback() {
+			continue
+		}
+		s.watchers.Add(1)
+		go func(inst string) {
+			defer s.watchers.Done()
+			ticker := time.NewTicker(failoverProbeInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+				if err := client.Probe(ctx, 5*time.Second); err != nil && ctx.Err() == nil {
+					s.logFailure(ctx, joinRef(inst, "*"), "failover probe", err, "Instance %s: no address reachable: %v", instanceName(inst), err)
+				} else {
+					s.logSuccess(ctx, joinRef(inst, "*"), "failover probe")
+				}
+			}
+		}(inst)
+	}
+}
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+// unusedAddr returns a loopback address nothing is listening on (yet).
+func unusedAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func TestFailoverSwitchesToReachableAddressAndBack(t *testing.T) {
+	primaryAddr := unusedAddr(t)
+	primary := newFakeSyncthing(t, "docs")
+	fallback := newFakeSyncthing(t, "docs")
+
+	var mu sync.Mutex
+	var switches []string
+	client, err := syncthing.NewClient("http://"+primaryAddr, "test-key", syncthing.ClientOptions{
+		FallbackURL: fallback.srv.URL,
+		OnSwitch: func(from, to string) {
+			mu.Lock()
+			defer mu.Unlock()
+			switches = append(switches, from+" -> "+to)
+		},
+	})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	svc := primary.service(t, Settings{})
+	svc.Client = client
+
+	svc.triggerScan(context.Background(), "docs")
+	svc.triggerScan(context.Background(), "docs")
+	if got := len(fallback.scanned()); got != 2 {
+		t.Fatalf("expected both scans on the fallback, got %d", got)
+	}
+	if len(switches) != 1 {
+		t.Fatalf("expected exactly one switchover, got %v", switches)
+	}
+
+	// The primary comes back: the next probe routes requests to it again.
+	ln, err := net.Listen("tcp", primaryAddr)
+	if err != nil {
+		t.Skipf("cannot rebind %s: %v", primaryAddr, err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(primary.serve))
+	srv.Listener.Close()
+	srv.Listener = ln
+	srv.Start()
+	defer srv.Close()
+
+	if err := client.Probe(context.Background(), 0); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	svc.triggerScan(context.Background(), "docs")
+	if got := strings.Join(primary.scanned(), ","); got != "docs" {
+		t.Fatalf("expected scan on the primary after recovery, got %q", got)
+	}
+	if len(switches) != 2 || !strings.HasSuffix(switches[1], primaryAddr+"/") {
+		t.Fatalf("expected switch back to primary, got %v", switches)
+	}
+}
+
+func TestFailoverDoesNotRetryHTTPErrors(t *testing.T) {
+	primary := newFakeSyncthing(t, "docs")
+	fallback := newFakeSyncthing(t, "docs")
+	client, err := syncthing.NewClient(primary.srv.URL, "test-key", syncthing.ClientOptions{FallbackURL: fallback.srv.URL})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	svc := primary.service(t, Settings{})
+	svc.Client = client
+
+	if got := svc.triggerScan(context.Background(), "missing"); got != resultFailed {
+		t.Fatalf("expected failure for unknown folder, got %s", got)
+	}
+	if fallback.count("/rest/db/scan") != 0 {
+		t.Fatalf("a reachable primary must not fail over")
+	}
+}
@@ -0,0 +1,546 @@
+package app
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+	"github.com/rcarmo/syncthing-kicker/internal/syncthingtest"
+)
+
+// fakeSyncthing is a minimal in-process Syncthing REST API that records requests.
+type fakeSyncthing struct {
+	srv *httptest.Server
+
+	mu          sync.Mutex
+	folders     []syncthing.FolderConfig
+	status      map[string]syncthing.FolderStatus
+	startTime   time.Time
+	hits        map[string]int
+	scans       []string
+	scanSubs    []string // comma-joined sub parameters, parallel to scans
+	scanNext    []string // next parameters ("" when absent), parallel to scans
+	statusErr   int      // when non-zero, /rest/db/status fails with this code
+	scanErr     int      // when non-zero, /rest/db/scan fails with this code
+	eventsErr   int      // when non-zero, /rest/events fails with this code
+	events      []syncthing.Event
+	lastScans   map[string]time.Time // served by /rest/stats/folder
+	scanDelay   time.Duration        // how long /rest/db/scan takes to answer
+	statusDelay time.Duration        // how long /rest/db/status takes to answer
+	patches     int                  // folder, device and options config changes received
+	devices     []syncthing.DeviceConfig
+	options     map[string]any // served and replaced by /rest/config/options
+	conflicts   int            // folder config PATCHes still to answer with 409 Conflict
+	revertStuck bool           // /rest/db/revert leaves the local changes in place
+	restartDown int            // pings /rest/system/restart leaves unanswered
+	down        int            // pings still to fail after a restart
+
+	// versions are served by /rest/folder/versions, keyed by folder.
+	versions map[string]map[string][]syncthing.FileVersion
+	// pending are served by /rest/cluster/pending/devices; POSTing a device to
+	// /rest/config/devices adds it to devices and drops it from here.
+	pending map[string]syncthing.PendingDevice
+	added   []syncthing.NewDevice
+	// pendingFolders are served by /rest/cluster/pending/folders; POSTing a folder to
+	// /rest/config/folders adds it to folders and drops it from here.
+	pendingFolders map[string]syncthing.PendingFolder
+	// connections and deviceStats are served by /rest/system/connections and
+	// /rest/stats/device; completions overrides /rest/db/completion for a
+	// folder+"@"+device key.
+	connections map[string]syncthing.Connection
+	deviceStats map[string]syncthing.DeviceStatistics
+	completions map[string]syncthing.FolderCompletion
+	// fileErrors are served by /rest/folder/errors, keyed by folder.
+	fileErrors map[string][]syncthing.FileError
+}
+
+func newFakeSyncthing(t *testing.T, folders ...string) *fakeSyncthing {
+	t.Helper()
+	f := &fakeSyncthing{
+		status:    map[string]syncthing.FolderStatus{},
+		startTime: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		hits:      map[string]int{},
+		lastScans: map[string]time.Time{},
+		options:   map[string]any{"maxSendKbps": 0, "maxRecvKbps": 0, "globalAnnounceEnabled": true},
+	}
+	for _, id := range folders {
+		f.folders = append(f.folders, syncthing.FolderConfig{ID: id})
+		f.status[id] = syncthing.FolderStatus{State: "idle"}
+	}
+	f.srv = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+func (f *fakeSyncthing) serve(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/rest/db/scan", "/rest/db/status":
+		f.mu.Lock()
+		delay := f.scanDelay
+		if r.URL.Path == "/rest/db/status" {
+			delay = f.statusDelay
+		}
+		f.mu.Unlock()
+		time.Sleep(delay) // outside the lock so slow requests overlap
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.hits[r.URL.Path]++
+
+	folder := r.URL.Query().Get("folder")
+	if id, ok := strings.CutPrefix(r.URL.Path, "/rest/config/folders/"); ok {
+		f.serveFolderConfig(w, r, id)
+		return
+	}
+	if id, ok := strings.CutPrefix(r.URL.Path, "/rest/config/devices/"); ok {
+		f.serveDeviceConfig(w, r, id)
+		return
+	}
+	switch r.URL.Path {
+	case "/rest/config/options":
+		if r.Method == http.MethodPut {
+			f.options = nil
+			if err := json.NewDecoder(r.Body).Decode(&f.options); err != nil {
+				http.Error(w, "bad options", http.StatusBadRequest)
+				return
+			}
+			f.patches++
+		}
+		writeJSON(w, f.options)
+	case "/rest/config/devices":
+		if r.Method == http.MethodPost {
+			var dev syncthing.NewDevice
+			if err := json.NewDecoder(r.Body).Decode(&dev); err != nil {
+				http.Error(w, "bad device", http.StatusBadRequest)
+				return
+			}
+			f.added = append(f.added, dev)
+			f.devices = append(f.devices, syncthing.DeviceConfig{DeviceID: dev.DeviceID, Name: dev.Name})
+			delete(f.pending, dev.DeviceID)
+			f.patches++
+			return
+		}
+		writeJSON(w, append([]syncthing.DeviceConfig{}, f.devices...))
+	case "/rest/config/folders":
+		var nf syncthing.NewFolder
+		if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&nf) != nil {
+			http.Error(w, "bad folder", http.StatusBadRequest)
+			return
+		}
+		f.folders = append(f.folders, syncthing.FolderConfig{ID: nf.ID, Label: nf.Label, Path: nf.Path, Type: nf.Type, Devices: nf.Devices})
+		f.status[nf.ID] = syncthing.FolderStatus{State: "idle"}
+		delete(f.pendingFolders, nf.ID)
+		f.patches++
+	case "/rest/cluster/pending/folders":
+		pending := map[string]syncthing.PendingFolder{}
+		maps.Copy(pending, f.pendingFolders)
+		writeJSON(w, pending)
+	case "/rest/cluster/pending/devices":
+		pending := map[string]syncthing.PendingDevice{}
+		maps.Copy(pending, f.pending)
+		writeJSON(w, pending)
+	case "/rest/system/config":
+		writeJSON(w, syncthing.Config{Folders: f.folders})
+	case "/rest/stats/folder":
+		stats := map[string]syncthing.FolderStatistics{}
+		for id, t := range f.lastScans {
+			stats[id] = syncthing.FolderStatistics{LastScan: t}
+		}
+		writeJSON(w, stats)
+	case "/rest/stats/device":
+		stats := map[string]syncthing.DeviceStatistics{}
+		maps.Copy(stats, f.deviceStats)
+		writeJSON(w, stats)
+	case "/rest/system/connections":
+		conns := map[string]syncthing.Connection{}
+		maps.Copy(conns, f.connections)
+		writeJSON(w, map[string]any{"connections": conns})
+	case "/rest/system/status":
+		writeJSON(w, syncthing.SystemStatus{MyID: "FAKE", StartTime: f.startTime})
+	case "/rest/system/version":
+		writeJSON(w, syncthing.SystemVersion{Version: "v1.27.0", OS: "linux", Arch: "amd64"})
+	case "/rest/system/ping":
+		if f.down > 0 {
+			f.down--
+			http.Error(w, "restarting", http.StatusServiceUnavailable)
+			return
+		}
+		writeJSON(w, map[string]string{"ping": "pong"})
+	case "/rest/system/restart":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		f.down = f.restartDown
+		f.startTime = f.startTime.Add(time.Hour)
+		writeJSON(w, map[string]string{"ok": "restarting"})
+	case "/rest/db/status":
+		if f.statusErr != 0 {
+			http.Error(w, "injected failure", f.statusErr)
+			return
+		}
+		st, ok := f.status[folder]
+		if !ok {
+			http.Error(w, "no such folder", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, st)
+	case "/rest/db/override":
+		st, ok := f.status[folder]
+		if !ok || r.Method != http.MethodPost {
+			http.Error(w, "no such folder", http.StatusNotFound)
+			return
+		}
+		st.NeedFiles, st.NeedDirectories, st.NeedDeletes, st.NeedBytes = 0, 0, 0, 0
+		f.status[folder] = st
+	case "/rest/db/revert":
+		st, ok := f.status[folder]
+		if !ok || r.Method != http.MethodPost {
+			http.Error(w, "no such folder", http.StatusNotFound)
+			return
+		}
+		if !f.revertStuck {
+			st.ReceiveOnlyChangedFiles, st.ReceiveOnlyChangedDirectories, st.ReceiveOnlyChangedDeletes, st.ReceiveOnlyChangedBytes = 0, 0, 0, 0
+			f.status[folder] = st
+		}
+	case "/rest/folder/versions":
+		if _, ok := f.status[folder]; !ok {
+			http.Error(w, "no such folder", http.StatusNotFound)
+			return
+		}
+		vs := f.versions[folder]
+		if vs == nil {
+			vs = map[string][]syncthing.FileVersion{}
+		}
+		writeJSON(w, vs)
+	case "/rest/folder/errors":
+		errs := f.fileErrors[folder]
+		if perPage, _ := strconv.Atoi(r.URL.Query().Get("perpage")); perPage > 0 && len(errs) > perPage {
+			errs = errs[:perPage]
+		}
+		writeJSON(w, map[string]any{"folder": folder, "errors": append([]syncthing.FileError{}, errs...)})
+	case "/rest/db/completion":
+		st, ok := f.status[folder]
+		if !ok {
+			http.Error(w, "no such folder", http.StatusNotFound)
+			return
+		}
+		if fc, ok := f.completions[folder+"@"+r.URL.Query().Get("device")]; ok {
+			writeJSON(w, fc)
+			return
+		}
+		completion := 100.0
+		if st.NeedBytes > 0 {
+			completion = 50
+		}
+		writeJSON(w, syncthing.FolderCompletion{Completion: completion, NeedBytes: st.NeedBytes})
+	case "/rest/db/scan":
+		if f.scanErr != 0 {
+			http.Error(w, "injected scan failure", f.scanErr)
+			return
+		}
+		if folder != "" {
+			if _, ok := f.status[folder]; !ok {
+				http.Error(w, "no such folder", http.StatusInternalServerError)
+				return
+			}
+		}
+		f.scans = append(f.scans, folder)
+		f.scanSubs = append(f.scanSubs, strings.Join(r.URL.Query()["sub"], ","))
+		f.scanNext = append(f.scanNext, r.URL.Query().Get("next"))
+		writeJSON(w, map[string]any{})
+	case "/rest/events":
+		if f.eventsErr != 0 {
+			http.Error(w, "events unavailable", f.eventsErr)
+			return
+		}
+		since, _ := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+		var types []string
+		if list := r.URL.Query().Get("events"); list != "" {
+			types = strings.Split(list, ",")
+		}
+		out := []syncthing.Event{}
+		for _, ev := range f.events {
+			if ev.ID > since && (types == nil || slices.Contains(types, ev.Type)) {
+				out = append(out, ev)
+			}
+		}
+		if limit, _ := strconv.Atoi(r.URL.Query().Get("limit")); limit > 0 && len(out) > limit {
+			out = out[len(out)-limit:]
+		}
+		if len(out) == 0 {
+			// Emulate a short long-poll so idle subscribers do not spin.
+			f.mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			f.mu.Lock()
+		}
+		writeJSON(w, out)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveFolderConfig serves GET and PATCH (of "paused", "rescanIntervalS",
+// "fsWatcherEnabled" and "devices") of one folder's config.
+func (f *fakeSyncthing) serveFolderConfig(w http.ResponseWriter, r *http.Request, id string) {
+	for i := range f.folders {
+		if f.folders[i].ID != id {
+			continue
+		}
+		if r.Method == http.MethodPatch {
+			var patch struct {
+				Paused           *bool
+				RescanIntervalS  *int  `json:"rescanIntervalS"`
+				FSWatcherEnabled *bool `json:"fsWatcherEnabled"`
+				Devices          *[]syncthing.FolderDevice
+			}
+			if err := json.NewDecoder(r.Body).Decode(&patch); err != nil || (patch.Paused == nil && patch.RescanIntervalS == nil && patch.FSWatcherEnabled == nil && patch.Devices == nil) {
+				http.Error(w, "bad patch", http.StatusBadRequest)
+				return
+			}
+			if f.conflicts > 0 {
+				f.conflicts--
+				http.Error(w, "config changed", http.StatusConflict)
+				return
+			}
+			if patch.Paused != nil {
+				f.folders[i].Paused = *patch.Paused
+			}
+			if patch.RescanIntervalS != nil {
+				f.folders[i].RescanIntervalS = *patch.RescanIntervalS
+			}
+			if patch.FSWatcherEnabled != nil {
+				f.folders[i].FSWatcherEnabled = *patch.FSWatcherEnabled
+			}
+			if patch.Devices != nil {
+				f.folders[i].Devices = *patch.Devices
+			}
+			f.patches++
+		}
+		writeJSON(w, f.folders[i])
+		return
+	}
+	http.Error(w, "No folder with given ID", http.StatusNotFound)
+}
+
+// serveDeviceConfig serves PATCH (of "paused" only) of one device's config.
+func (f *fakeSyncthing) serveDeviceConfig(w http.ResponseWriter, r *http.Request, id string) {
+	for i := range f.devices {
+		if f.devices[i].DeviceID != id || r.Method != http.MethodPatch {
+			continue
+		}
+		var patch struct{ Paused *bool }
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil || patch.Paused == nil {
+			http.Error(w, "bad patch", http.StatusBadRequest)
+			return
+		}
+		f.devices[i].Paused = *patch.Paused
+		f.patches++
+		writeJSON(w, f.devices[i])
+		return
+	}
+	http.NotFound(w, r)
+}
+
+func (f *fakeSyncthing) setDevice(dev syncthing.DeviceConfig) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.devices {
+		if f.devices[i].DeviceID == dev.DeviceID {
+			f.devices[i] = dev
+			return
+		}
+	}
+	f.devices = append(f.devices, dev)
+}
+
+func (f *fakeSyncthing) devicePaused(id string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, d := range f.devices {
+		if d.DeviceID == id {
+			return d.Paused
+		}
+	}
+	return false
+}
+
+func (f *fakeSyncthing) option(key string) any {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.options[key]
+}
+
+func (f *fakeSyncthing) setPaused(folder string, paused bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.folders {
+		if f.folders[i].ID == folder {
+			f.folders[i].Paused = paused
+		}
+	}
+}
+
+func (f *fakeSyncthing) paused(folder string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, fc := range f.folders {
+		if fc.ID == folder {
+			return fc.Paused
+		}
+	}
+	return false
+}
+
+// folderConfig returns a copy of folder's config.
+func (f *fakeSyncthing) folderConfig(folder string) syncthing.FolderConfig {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, fc := range f.folders {
+		if fc.ID == folder {
+			return fc
+		}
+	}
+	return syncthing.FolderConfig{}
+}
+
+func (f *fakeSyncthing) setType(folder, typ string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.folders {
+		if f.folders[i].ID == folder {
+			f.folders[i].Type = typ
+		}
+	}
+}
+
+func (f *fakeSyncthing) setWatcher(folder string, enabled bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.folders {
+		if f.folders[i].ID == folder {
+			f.folders[i].FSWatcherEnabled = enabled
+		}
+	}
+}
+
+func (f *fakeSyncthing) setRescanInterval(folder string, seconds int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.folders {
+		if f.folders[i].ID == folder {
+			f.folders[i].RescanIntervalS = seconds
+		}
+	}
+}
+
+// addEvent appends an event with the next ID and the given JSON payload.
+func (f *fakeSyncthing) addEvent(typ string, data any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	raw, _ := json.Marshal(data)
+	f.events = append(f.events, syncthing.Event{ID: int64(len(f.events) + 1), Type: typ, Time: time.Now(), Data: raw})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (f *fakeSyncthing) count(path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.hits[path]
+}
+
+func (f *fakeSyncthing) scanned() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.scans...)
+}
+
+func (f *fakeSyncthing) scannedSubs() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.scanSubs...)
+}
+
+func (f *fakeSyncthing) scannedNext() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.scanNext...)
+}
+
+func (f *fakeSyncthing) setStatus(folder string, st syncthing.FolderStatus) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status[folder] = st
+}
+
+func (f *fakeSyncthing) setLabel(folder, label string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.folders {
+		if f.folders[i].ID == folder {
+			f.folders[i].Label = label
+		}
+	}
+}
+
+func (f *fakeSyncthing) setLastScan(folder string, t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lastScans[folder] = t
+}
+
+func (f *fakeSyncthing) failScans(code int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scanErr = code
+}
+
+func (f *fakeSyncthing) slowScans(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scanDelay = d
+}
+
+func (f *fakeSyncthing) restart() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.startTime = f.startTime.Add(time.Hour)
+}
+
+func (f *fakeSyncthing) service(t *testing.T, settings Settings) *Service {
+	t.Helper()
+	client, err := syncthing.NewClient(f.srv.URL, "test-key", syncthing.ClientOptions{})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	return &Service{
+		Settings: settings,
+		Client:   client,
+		Logger:   log.New(io.Discard, "", 0),
+	}
+}
+
+// harnessService returns a Service talking to srv. New tests should prefer the
+// shared syncthingtest server to growing fakeSyncthing.
+func harnessService(t *testing.T, srv *syncthingtest.Server, settings Settings) *Service {
+	t.Helper()
+	return &Service{
+		Settings: settings,
+		Client:   srv.Client(t),
+		Logger:   log.New(io.Discard, "", 0),
+	}
+}
@@ -0,0 +1,127 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/robfig/cron/v3"
+)
+
+// cronParser reads the 5-field cron expressions (min hour dom mon dow) of every
+// schedule.
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+
+// folderCronJob is one ST_FOLDER_CRON schedule, parsed and ready to add to the
+// scheduler.
+type folderCronJob struct {
+	label string // "folder:<id>" for scans, "<action>:<id>" otherwise
+	expr  string
+	sched cron.Schedule
+	run   func(context.Context)
+}
+
+// folderCrons returns the per-folder schedules keyed by action.
+func (st Settings) folderCrons() map[string]map[string]string {
+	return map[string]map[string]string{
+		actionScan:           st.FolderCron,
+		actionOverride:       st.FolderOverrideCron,
+		actionRevert:         st.FolderRevertCron,
+		actionVersionsReport: st.FolderVersionsReportCron,
+	}
+}
+
+// folderCrons is Settings.folderCrons under schedMu, which ReloadFolderCron holds
+// while it replaces the maps. The maps themselves are never changed in place.
+func (s *Service) folderCrons() map[string]map[string]string {
+	s.schedMu.Lock()
+	defer s.schedMu.Unlock()
+	return s.Settings.folderCrons()
+}
+
+// folderCronJobs parses the per-folder schedules of every action. Scans go through
+// pending like any other run.
+func (s *Service) folderCronJobs(crons map[string]map[string]string, pending chan struct{}) ([]folderCronJob, error) {
+	var jobs []folderCronJob
+	for _, action := range folderCronActions {
+		for folder, expr := range crons[action] {
+			sched, err := cronParser.Parse(expr)
+			if err != nil {
+				if action == actionScan {
+					return nil, fmt.Errorf("invalid ST_FOLDER_CRON expr for %s: %w", folder, err)
+				}
+				return nil, fmt.Errorf("invalid ST_FOLDER_CRON %s expr for %s: %w", action, folder, err)
+			}
+			j := folderCronJob{label: action + ":" + folder, expr: expr, sched: sched}
+			switch action {
+			case actionScan:
+				j.label = "folder:" + folder
+				j.run = func(ctx context.Context) { _ = s.triggerScans(ctx, "folder:"+folder, []string{folder}, pending) }
+			case actionOverride:
+				j.run = func(ctx context.Context) { s.overrideFolder(ctx, folder) }
+			case actionRevert:
+				j.run = func(ctx context.Context) { s.revertFolder(ctx, folder) }
+			case actionVersionsReport:
+				j.run = func(ctx context.Context) { s.reportVersions(ctx, folder) }
+			}
+			jobs = append(jobs, j)
+		}
+	}
+	return jobs, nil
+}
+
+// ReloadFolderCron re-reads ST_FOLDER_CRON_FILE (merged with ST_FOLDER_CRON as at
+// startup) and replaces the running scheduler's per-folder schedules with it. On
+// any error the current schedules stay as they are.
+func (s *Service) ReloadFolderCron() error {
+	file := s.Settings.FolderCronFile
+	if file == "" {
+		return nil
+	}
+	crons, err := loadFolderCron(file)
+	if err != nil {
+		return err
+	}
+	s.schedMu.Lock()
+	defer s.schedMu.Unlock()
+	if s.cron == nil {
+		return errors.New("the scheduler is not running")
+	}
+	jobs, err := s.folderCronJobs(crons, s.pending)
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 && s.Settings.CronExpr == "" {
+		return fmt.Errorf("%s leaves no schedules", file)
+	}
+
+	old := map[string]string{}
+	kept := s.schedules[:0:0]
+	for _, e := range s.schedules {
+		if !e.folderCron {
+			kept = append(kept, e)
+			continue
+		}
+		s.cron.Remove(e.id)
+		old[e.label] = e.expr
+	}
+	var added, changed int
+	for _, j := range jobs {
+		id := s.cron.Schedule(j.sched, cron.FuncJob(s.scheduled(j.label, j.run)))
+		kept = append(kept, scheduleEntry{id: id, label: j.label, expr: j.expr, folderCron: true})
+		switch prev, ok := old[j.label]; {
+		case !ok:
+			added++
+		case prev != j.expr:
+			changed++
+		}
+		delete(old, j.label)
+	}
+	s.schedules = kept
+	s.Settings.FolderCron = crons[actionScan]
+	s.Settings.FolderOverrideCron = crons[actionOverride]
+	s.Settings.FolderRevertCron = crons[actionRevert]
+	s.Settings.FolderVersionsReportCron = crons[actionVersionsReport]
+	s.Logger.Printf("Reloaded ST_FOLDER_CRON_FILE %s: %d folder schedule(s), %d added, %d changed, %d removed", file, len(jobs), added, changed, len(old))
+	return nil
+}
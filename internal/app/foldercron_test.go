@@ -0,0 +1,156 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeCronFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func TestFolderCronFileMergesUnderEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "folders.cron")
+	writeCronFile(t, path, "# nightly scans\r\ndocs: 0 2 * * *\r\nmedia: 0 3 * * * # big\r\nmedia: override 0 4 * * *\r\n")
+	os.Clearenv()
+	os.Setenv("ST_API_KEY", "abc123")
+	os.Setenv("ST_FOLDER_CRON_FILE", path)
+	os.Setenv("ST_FOLDER_CRON", "media: 30 1 * * *\nphotos: 0 5 * * *")
+
+	st, err := LoadSettingsFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// ST_FOLDER_CRON replaces all of media's lines from the file, override included.
+	want := map[string]string{"docs": "0 2 * * *", "media": "30 1 * * *", "photos": "0 5 * * *"}
+	if !maps.Equal(st.FolderCron, want) || len(st.FolderOverrideCron) != 0 {
+		t.Fatalf("unexpected schedules: %#v, overrides %#v", st.FolderCron, st.FolderOverrideCron)
+	}
+
+	// The file alone is enough.
+	os.Unsetenv("ST_FOLDER_CRON")
+	if st, err = LoadSettingsFromEnv(); err != nil || len(st.FolderCron) != 2 || st.FolderOverrideCron["media"] != "0 4 * * *" {
+		t.Fatalf("unexpected settings from the file alone: %#v, %#v, %v", st.FolderCron, st.FolderOverrideCron, err)
+	}
+}
+
+func TestFolderCronFileErrorsNamePath(t *testing.T) {
+	dir := t.TempDir()
+	os.Clearenv()
+	os.Setenv("ST_API_KEY", "abc123")
+	os.Setenv("ST_FOLDER_CRON_FILE", filepath.Join(dir, "missing.cron"))
+	if _, err := LoadSettingsFromEnv(); err == nil || !strings.Contains(err.Error(), filepath.Join(dir, "missing.cron")) {
+		t.Fatalf("expected the missing path in the error, got %v", err)
+	}
+
+	path := filepath.Join(dir, "folders.cron")
+	writeCronFile(t, path, "docs: 0 2 * * *\ndocs 0 3 * * *\n")
+	os.Setenv("ST_FOLDER_CRON_FILE", path)
+	_, err := LoadSettingsFromEnv()
+	if err == nil || !strings.Contains(err.Error(), path) || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("expected the path and line in the error, got %v", err)
+	}
+}
+
+func TestReloadFolderCronReplacesFolderSchedules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "folders.cron")
+	writeCronFile(t, path, "docs: 0 2 * * *\nmedia: 0 3 * * *\n")
+	os.Clearenv()
+	fake := newFakeSyncthing(t, "docs", "media", "photos")
+	var logs syncBuffer
+	svc := fake.service(t, Settings{
+		CronExpr:       "0 5 * * *",
+		FolderCron:     map[string]string{"docs": "0 2 * * *", "media": "0 3 * * *"},
+		FolderCronFile: path,
+	})
+	svc.Logger = log.New(&logs, "", 0)
+	sched, err := svc.buildCronScheduler(make(chan struct{}, 1))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	svc.cron = sched
+
+	labels := func() []string {
+		var out []string
+		for _, e := range svc.schedules {
+			if svc.cron.Entry(e.id).Schedule == nil {
+				t.Fatalf("schedule %s is not in the scheduler", e.label)
+			}
+			out = append(out, e.label+"="+e.expr)
+		}
+		slices.Sort(out)
+		return out
+	}
+
+	writeCronFile(t, path, "docs: 0 4 * * *\nphotos: 0 6 * * *\nphotos: versions-report 0 7 * * 1\n")
+	if err := svc.ReloadFolderCron(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	want := []string{"folder:docs=0 4 * * *", "folder:photos=0 6 * * *", "global=0 5 * * *", "versions-report:photos=0 7 * * 1"}
+	if got := labels(); !slices.Equal(got, want) || len(svc.cron.Entries()) != 6 { // plus the heartbeat and the paused folder check
+		t.Fatalf("schedules = %v (%d entries), want %v", got, len(svc.cron.Entries()), want)
+	}
+	if !strings.Contains(logs.String(), "3 folder schedule(s), 2 added, 1 changed, 1 removed") {
+		t.Fatalf("expected a reload summary in log:\n%s", logs.String())
+	}
+
+	// A broken file keeps what is running.
+	writeCronFile(t, path, "docs: not a cron\n")
+	if err := svc.ReloadFolderCron(); err == nil {
+		t.Fatalf("expected an invalid expression to fail the reload")
+	}
+	if got := labels(); !slices.Equal(got, want) {
+		t.Fatalf("schedules changed by a failed reload: %v", got)
+	}
+}
+
+// Run with -race: a reload replaces the schedule maps that planning reads.
+func TestReloadFolderCronWhilePlanning(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "folders.cron")
+	writeCronFile(t, path, "docs: 0 2 * * *\n")
+	os.Clearenv()
+	fake := newFakeSyncthing(t, "docs", "media")
+	svc := fake.service(t, Settings{FolderCron: map[string]string{"docs": "0 2 * * *"}, FolderCronFile: path})
+	svc.Logger = log.New(io.Discard, "", 0)
+	sched, err := svc.buildCronScheduler(make(chan struct{}, 1))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	svc.cron = sched
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 50 {
+			writeCronFile(t, path, fmt.Sprintf("docs: %d 2 * * *\nmedia: 0 3 * * *\n", i))
+			if err := svc.ReloadFolderCron(); err != nil {
+				t.Errorf("reload failed: %v", err)
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if _, err := svc.ScanPlans(time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		_ = svc.configuredFolders(context.Background(), "test")
+		_ = svc.rescanScheduledFolders(context.Background())
+	}
+}
@@ -0,0 +1,429 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+const (
+	healthDegradedAfter = 3 // consecutive connection failures before an instance backs off
+	healthBaseBackoff   = 30 * time.Second
+	healthMaxBackoff    = 10 * time.Minute
+)
+
+// instanceHealth tracks connection failures per Syncthing instance. Once an instance
+// has failed healthDegradedAfter times in a row it is degraded: calls to it are skipped
+// until a backoff (doubling up to a cap) has elapsed, then a single attempt probes it
+// again. Other instances are unaffected. The zero value is ready to use.
+//
+// With an offline grace (ST_OFFLINE_GRACE), connection failures first start an
+// offline episode and are held back rather than counted, so a Syncthing restart goes
+// unreported. Failures still coming once the grace has run out are released into the
+// streak, dated from the start of the episode.
+type instanceHealth struct {
+	mu      sync.Mutex
+	entries map[string]*healthEntry
+	now     func() time.Time // for tests; defaults to time.Now
+}
+
+type healthEntry struct {
+	failures     int
+	failingSince time.Time // first failure of the current streak
+	lastError    string
+	lastSuccess  time.Time
+	lastFailure  time.Time
+	backoff      time.Duration
+	retryAt      time.Time
+
+	offlineSince time.Time         // first held failure of the current offline episode
+	heldFailures int               // failures held back during the episode
+	held         []func(time.Time) // callers' reports of held failures, run on release
+}
+
+// InstanceHealth is the per-instance view exposed by /api/health.
+type InstanceHealth struct {
+	Instance    string    `json:"instance"`
+	Healthy     bool      `json:"healthy"`
+	Failures    int       `json:"consecutiveFailures"`
+	LastError   string    `json:"lastError,omitempty"`
+	LastSuccess time.Time `json:"lastSuccess,omitempty"`
+	LastFailure time.Time `json:"lastFailure,omitempty"`
+	RetryAt     time.Time `json:"retryAt,omitempty"`
+
+	failingSince time.Time
+}
+
+func (h *instanceHealth) clock() time.Time {
+	if h.now != nil {
+		return h.now()
+	}
+	return time.Now()
+}
+
+func (h *instanceHealth) get(instance string) *healthEntry {
+	if h.entries == nil {
+		h.entries = map[string]*healthEntry{}
+	}
+	e := h.entries[instance]
+	if e == nil {
+		e = &healthEntry{}
+		h.entries[instance] = e
+	}
+	return e
+}
+
+// available reports whether calls to instance may go ahead, and if not, when the
+// next probe is due.
+func (h *instanceHealth) available(instance string) (bool, time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	e := h.get(instance)
+	if e.retryAt.IsZero() || !h.clock().Before(e.retryAt) {
+		return true, time.Time{}
+	}
+	return false, e.retryAt
+}
+
+// record updates instance health after a call. Errors that carry an HTTP response
+// prove the instance is reachable and count as success. It reports whether a
+// connection failure is held back by the offline grace; the caller then leaves it
+// unreported, and release, if set, is run with the start of the episode should the
+// grace run out.
+func (h *instanceHealth) record(logger *log.Logger, instance string, err error, grace time.Duration, release func(since time.Time)) (held bool) {
+	now := h.clock()
+	h.mu.Lock()
+	e := h.get(instance)
+
+	if err == nil || !isUnreachable(err) {
+		if !e.offlineSince.IsZero() {
+			logger.Printf("Instance %s was unreachable for %s, within ST_OFFLINE_GRACE; %d failed attempt(s) not reported", instanceName(instance), now.Sub(e.offlineSince).Round(time.Second), e.heldFailures)
+		} else if e.failures >= healthDegradedAfter {
+			logger.Printf("Instance %s is reachable again after %d failed attempts", instanceName(instance), e.failures)
+		}
+		e.endEpisode()
+		e.failures = 0
+		e.failingSince = time.Time{}
+		e.lastError = ""
+		e.backoff = 0
+		e.retryAt = time.Time{}
+		e.lastSuccess = now
+		h.mu.Unlock()
+		return false
+	}
+
+	if e.failures == 0 && grace > 0 {
+		if e.offlineSince.IsZero() {
+			e.offlineSince = now
+		}
+		if now.Sub(e.offlineSince) < grace {
+			e.heldFailures++
+			e.lastError = errorClass(err)
+			e.lastFailure = now
+			if release != nil {
+				e.held = append(e.held, release)
+			}
+			h.mu.Unlock()
+			return true
+		}
+	}
+	since, releases := e.release()
+	if e.failures == 0 {
+		e.failingSince = now
+	}
+	e.failures++
+	e.lastError = errorClass(err)
+	e.lastFailure = now
+	e.degrade(logger, instance, now)
+	h.mu.Unlock()
+	runReleases(releases, since)
+	return false
+}
+
+// expire releases offline episodes that have outlived grace without another call to
+// the instance, so the health level does not wait for one.
+func (h *instanceHealth) expire(logger *log.Logger, grace time.Duration) {
+	now := h.clock()
+	h.mu.Lock()
+	type pending struct {
+		since    time.Time
+		releases []func(time.Time)
+	}
+	var due []pending
+	for instance, e := range h.entries {
+		if e.offlineSince.IsZero() || now.Sub(e.offlineSince) < grace {
+			continue
+		}
+		since, releases := e.release()
+		e.degrade(logger, instance, now)
+		due = append(due, pending{since, releases})
+	}
+	h.mu.Unlock()
+	for _, p := range due {
+		runReleases(p.releases, p.since)
+	}
+}
+
+// release ends the offline episode, moving its held failures into the streak, and
+// returns its start along with the reports to run once the lock is released.
+func (e *healthEntry) release() (time.Time, []func(time.Time)) {
+	since, releases := e.offlineSince, e.held
+	if !since.IsZero() {
+		e.failures = e.heldFailures
+		e.failingSince = since
+	}
+	e.endEpisode()
+	return since, releases
+}
+
+func (e *healthEntry) endEpisode() {
+	e.offlineSince = time.Time{}
+	e.heldFailures = 0
+	e.held = nil
+}
+
+// degrade backs the instance off once its streak reaches healthDegradedAfter.
+func (e *healthEntry) degrade(logger *log.Logger, instance string, now time.Time) {
+	if e.failures < healthDegradedAfter {
+		return
+	}
+	if e.backoff == 0 {
+		e.backoff = healthBaseBackoff
+	} else if e.backoff *= 2; e.backoff > healthMaxBackoff {
+		e.backoff = healthMaxBackoff
+	}
+	e.retryAt = now.Add(e.backoff)
+	logger.Printf("Instance %s unreachable (%s, %d attempts); backing off for %s", instanceName(instance), e.lastError, e.failures, e.backoff)
+}
+
+func runReleases(releases []func(time.Time), since time.Time) {
+	for _, release := range releases {
+		release(since)
+	}
+}
+
+// snapshot returns the health of the given instances in order.
+func (h *instanceHealth) snapshot(instances []string) []InstanceHealth {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]InstanceHealth, 0, len(instances))
+	for _, inst := range instances {
+		e := h.get(inst)
+		out = append(out, InstanceHealth{
+			Instance:    instanceName(inst),
+			Healthy:     e.failures < healthDegradedAfter,
+			Failures:    e.failures,
+			LastError:   e.lastError,
+			LastSuccess: e.lastSuccess,
+			LastFailure: e.lastFailure,
+			RetryAt:     e.retryAt,
+
+			failingSince: e.failingSince,
+		})
+	}
+	return out
+}
+
+// isUnreachable reports whether err means no response came back from Syncthing at all.
+func isUnreachable(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.As(err, &netErr)
+}
+
+// instanceAvailable gates calls to a degraded instance, logging (rate-limited) why
+// the call was skipped.
+func (s *Service) instanceAvailable(ctx context.Context, instance, folder, op string) bool {
+	ok, retryAt := s.health.available(instance)
+	if !ok {
+		err := fmt.Errorf("instance %s degraded", instanceName(instance))
+		s.logFailure(ctx, folder, op, err, "Instance %s is unreachable; skipping %s for '%s'%s until %s", instanceName(instance), op, folder, s.labelSuffix(folder), retryAt.Format(time.RFC3339))
+	}
+	return ok
+}
+
+// recordHealth records a call's outcome under ST_OFFLINE_GRACE and reports whether a
+// failure is held back; see instanceHealth.record.
+func (s *Service) recordHealth(ctx context.Context, instance string, err error, release func(since time.Time)) bool {
+	return s.health.record(s.log(ctx), instance, err, s.Settings.OfflineGrace, release)
+}
+
+// CheckResult is the outcome of CheckOnce for one instance.
+type CheckResult struct {
+	Instance  string
+	Err       error
+	Checked   []string        // folders whose status was fetched
+	Missing   []string        // folders Syncthing does not know
+	Problems  []FolderProblem // folders in a state ST_CHECK_STATE_SEVERITY rates warning or critical
+	Abandoned bool            // ctx ended (ST_RUN_DEADLINE) before the instance was fully checked
+}
+
+// CheckOnce probes the selected instances (all when none are given) and reports folder
+// status for the entries of folders, usually FoldersFromEnv, that belong to each, or
+// all of its folders if none do. The report is only built here; rendering it is up
+// to the caller.
+func (s *Service) CheckOnce(ctx context.Context, folders []string, instances ...string) (Report, error) {
+	started := time.Now().UTC()
+	selected := s.instances()
+	if len(instances) > 0 {
+		selected = selected[:0:0]
+		for _, name := range instances {
+			name = strings.TrimSpace(name)
+			inst := name
+			if inst == defaultInstance {
+				inst = ""
+			}
+			if inst != "" && s.Instances[inst] == nil {
+				return Report{}, fmt.Errorf("unknown instance %q", name)
+			}
+			selected = append(selected, inst)
+		}
+	}
+
+	_, groups := s.groupByInstance(folders)
+	results := make([]CheckResult, len(selected))
+	checked := make([][]ReportFolder, len(selected))
+	var wg sync.WaitGroup
+	for i, inst := range selected {
+		wg.Add(1)
+		go func(i int, inst string) {
+			defer wg.Done()
+			_, _, err := s.client(inst).SystemStatus(ctx, 10*time.Second)
+			results[i] = CheckResult{Instance: instanceName(inst), Err: err}
+			if ctx.Err() != nil {
+				results[i].Abandoned = true
+				return
+			}
+			s.recordHealth(ctx, inst, err, nil)
+			if err != nil {
+				s.Logger.Printf("Instance %s check failed: %v", instanceName(inst), err)
+				return
+			}
+			folders := groups[inst]
+			if len(folders) == 0 {
+				folders = []string{joinRef(inst, "*")}
+			}
+			_ = s.checkStatuses(ctx, folders, 0, false, func(ctx context.Context, ref string, st syncthing.FolderStatus) {
+				results[i].Checked = append(results[i].Checked, ref)
+				f := ReportFolder{
+					Folder: ref, Instance: instanceName(inst), State: st.State,
+					NeedBytes: st.NeedBytes, InSyncBytes: st.InSyncBytes,
+					NeedFiles: st.NeedFiles, NeedDirectories: st.NeedDirectories, NeedSymlinks: st.NeedSymlinks, NeedDeletes: st.NeedDeletes,
+					Error: st.Error,
+				}
+				if p, ok := s.folderProblem(ctx, ref, st); ok {
+					results[i].Problems = append(results[i].Problems, p)
+					f.Error = p.Error
+				}
+				if stats, ok := s.stats.lookup(ref); ok && !stats.SyncthingLastScan.IsZero() {
+					f.LastScan, f.Stale = stats.SyncthingLastScan.Format(time.RFC3339), stats.Stale
+				}
+				checked[i] = append(checked[i], f)
+			})
+			for _, ref := range folders {
+				if s.missing.has(s.missingRef(ref)) {
+					results[i].Missing = append(results[i].Missing, ref)
+				}
+			}
+			results[i].Abandoned = ctx.Err() != nil
+		}(i, inst)
+	}
+	wg.Wait()
+	return newReport(started, time.Now().UTC(), results, slices.Concat(checked...), s.Settings.CheckStateSeverity, s.Settings.CheckNeed == checkNeedFiles), nil
+}
+
+// FolderInstances names the instances refs belong to, in order of first appearance,
+// for CheckOnce.
+func (s *Service) FolderInstances(refs []string) []string {
+	order, _ := s.groupByInstance(refs)
+	names := make([]string, len(order))
+	for i, inst := range order {
+		names[i] = instanceName(inst)
+	}
+	return names
+}
+
+// UnknownFoldersError lists the SelectFolders selectors that matched no folder.
+type UnknownFoldersError struct {
+	Names []string
+}
+
+func (e *UnknownFoldersError) Error() string {
+	return "no folder matches " + strings.Join(e.Names, ", ")
+}
+
+// SelectFolders resolves the folder selectors given to --check: IDs, labels and globs
+// over either, optionally instance-prefixed, where a leading "!" drops the folders a
+// selector matches. Given only exclusions, it starts from every folder of every
+// instance. Selectors matching nothing are reported together as an
+// *UnknownFoldersError.
+func (s *Service) SelectFolders(ctx context.Context, selectors []string) ([]string, error) {
+	var include, exclude, unknown []string
+	for _, sel := range selectors {
+		sel = strings.TrimSpace(sel)
+		if rest, ok := strings.CutPrefix(sel, "!"); ok {
+			exclude = append(exclude, strings.TrimSpace(rest))
+		} else if sel != "" {
+			include = append(include, sel)
+		}
+	}
+	resolve := func(sels []string) ([]string, error) {
+		var refs []string
+		for _, sel := range sels {
+			inst, id := s.splitRef(sel)
+			list, err := s.cachedFolders(ctx, inst)
+			if err != nil {
+				return nil, fmt.Errorf("cannot list the folders of instance %s: %w", instanceName(inst), err)
+			}
+			matches := matchFolders(list, id)
+			if len(matches) == 0 {
+				unknown = append(unknown, sel)
+			}
+			for _, m := range matches {
+				refs = append(refs, joinRef(inst, m))
+			}
+		}
+		return refs, nil
+	}
+
+	selected, err := resolve(include)
+	if err == nil && len(include) == 0 {
+		selected, err = s.ResolveFolders(ctx, nil, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+	dropped, err := resolve(exclude)
+	if err != nil {
+		return nil, err
+	}
+	if len(unknown) > 0 {
+		return nil, &UnknownFoldersError{Names: unknown}
+	}
+	skip := map[string]bool{}
+	for _, ref := range dropped {
+		skip[ref] = true
+	}
+	var out []string
+	for _, ref := range selected {
+		if !skip[ref] {
+			skip[ref] = true
+			out = append(out, ref)
+		}
+	}
+	if len(out) == 0 {
+		return nil, errors.New("the exclusions leave no folders to check")
+	}
+	return out, nil
+}
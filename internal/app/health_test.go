@@ -0,0 +1,144 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInstanceHealthBacksOffAfterRepeatedFailures(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	h := &instanceHealth{now: clock.now}
+	logger := log.New(io.Discard, "", 0)
+
+	for i := 0; i < healthDegradedAfter; i++ {
+		if ok, _ := h.available("nas"); !ok {
+			t.Fatalf("instance should stay available before %d failures", healthDegradedAfter)
+		}
+		h.record(logger, "nas", refused(), 0, nil)
+	}
+	if ok, retryAt := h.available("nas"); ok || !retryAt.Equal(clock.t.Add(healthBaseBackoff)) {
+		t.Fatalf("expected backoff until %s, got ok=%v retryAt=%s", clock.t.Add(healthBaseBackoff), ok, retryAt)
+	}
+	if ok, _ := h.available(""); !ok {
+		t.Fatalf("other instances must not be affected")
+	}
+
+	// A failed probe doubles the backoff; a success clears it.
+	clock.advance(healthBaseBackoff)
+	h.record(logger, "nas", refused(), 0, nil)
+	if _, retryAt := h.available("nas"); !retryAt.Equal(clock.t.Add(2 * healthBaseBackoff)) {
+		t.Fatalf("expected doubled backoff, got retryAt=%s", retryAt)
+	}
+	h.record(logger, "nas", nil, 0, nil)
+	if ok, _ := h.available("nas"); !ok {
+		t.Fatalf("expected instance available after success")
+	}
+}
+
+func TestInstanceHealthIgnoresHTTPErrors(t *testing.T) {
+	h := &instanceHealth{}
+	for i := 0; i < 5; i++ {
+		h.record(log.New(io.Discard, "", 0), "", errors.New("http error: no such folder"), 0, nil)
+	}
+	if got := h.snapshot([]string{""}); !got[0].Healthy || got[0].Failures != 0 {
+		t.Fatalf("HTTP errors should not degrade an instance: %+v", got[0])
+	}
+}
+
+func TestFailingInstanceIsIsolated(t *testing.T) {
+	def := newFakeSyncthing(t, "docs")
+	down := newFakeSyncthing(t, "media")
+	down.srv.Close()
+	svc := multiInstanceService(t, Settings{}, def, map[string]*fakeSyncthing{"down": down})
+	pending := make(chan struct{}, 64)
+
+	for i := 0; i < healthDegradedAfter+2; i++ {
+		_ = svc.triggerScans(context.Background(), "test", []string{"docs", "down/media"}, pending)
+	}
+
+	if got := len(def.scanned()); got != healthDegradedAfter+2 {
+		t.Fatalf("expected every default-instance scan to go through, got %d", got)
+	}
+	st := map[string]FolderStats{}
+	for _, f := range svc.stats.snapshot() {
+		st[f.Folder] = f
+	}
+	// Follow-up status checks count towards instance health too, so the backoff may
+	// kick in before the third scan attempt.
+	if got := st["down/media"]; got.Failures > healthDegradedAfter || got.Skips < 2 || got.Failures+got.Skips != healthDegradedAfter+2 {
+		t.Fatalf("expected degraded instance to be skipped after at most %d failures: %+v", healthDegradedAfter, got)
+	}
+
+	h := svc.adminHandler(context.Background(), pending)
+	rec := adminRequest(t, h, http.MethodGet, "/api/health", "", "")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 while an instance is degraded, got %d", rec.Code)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, `"instance":"default","healthy":true`) || !strings.Contains(body, `"instance":"down","healthy":false`) {
+		t.Fatalf("unexpected health body: %s", body)
+	}
+}
+
+func TestCheckOnceReportsPerInstance(t *testing.T) {
+	def := newFakeSyncthing(t, "docs")
+	down := newFakeSyncthing(t, "media")
+	down.srv.Close()
+	svc := multiInstanceService(t, Settings{}, def, map[string]*fakeSyncthing{"down": down})
+
+	report, err := svc.CheckOnce(context.Background(), svc.Folders())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	results := report.Instances
+	if len(results) != 2 || results[0].Err != nil || results[1].Err == nil {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	if def.count("/rest/db/status") != 1 {
+		t.Fatalf("expected default instance folders to be checked")
+	}
+
+	report, err = svc.CheckOnce(context.Background(), svc.Folders(), "default")
+	results = report.Instances
+	if err != nil || len(results) != 1 || results[0].Instance != "default" {
+		t.Fatalf("unexpected filtered results: %+v, %v", results, err)
+	}
+	if _, err := svc.CheckOnce(context.Background(), svc.Folders(), "missing"); err == nil {
+		t.Fatalf("expected error for unknown instance")
+	}
+}
+
+func TestSelectFolders(t *testing.T) {
+	def := newFakeSyncthing(t, "docs", "photos", "pics-a", "pics-b")
+	def.setLabel("photos", "Photos")
+	offsite := newFakeSyncthing(t, "media", "pics-a")
+	svc := multiInstanceService(t, Settings{Folders: []string{"docs"}}, def, map[string]*fakeSyncthing{"offsite": offsite})
+	ctx := context.Background()
+
+	got, err := svc.SelectFolders(ctx, []string{"Photos", "pics-*", "!pics-b", "offsite/media"})
+	if err != nil || strings.Join(got, ",") != "photos,pics-a,offsite/media" {
+		t.Fatalf("got %v, %v", got, err)
+	}
+	if got, err := svc.SelectFolders(ctx, []string{"!pics-*", "!offsite/*"}); err != nil || strings.Join(got, ",") != "docs,photos" {
+		t.Fatalf("expected exclusions alone to start from every folder, got %v, %v", got, err)
+	}
+	var unknown *UnknownFoldersError
+	if _, err := svc.SelectFolders(ctx, []string{"docs", "nope", "!gone*"}); !errors.As(err, &unknown) || strings.Join(unknown.Names, ",") != "nope,gone*" {
+		t.Fatalf("expected the unknown selectors to be named, got %v", err)
+	}
+
+	// The explicit list is checked instead of ST_FOLDERS, on its instances only.
+	report, err := svc.CheckOnce(ctx, got, svc.FolderInstances(got)...)
+	results := report.Instances
+	if err != nil || len(results) != 2 || strings.Join(results[0].Checked, ",") != "photos,pics-a" || results[1].Instance != "offsite" {
+		t.Fatalf("unexpected results: %+v, %v", results, err)
+	}
+	if def.count("/rest/db/status") != 2 {
+		t.Fatalf("expected only the selected folders to be checked, got %d", def.count("/rest/db/status"))
+	}
+}
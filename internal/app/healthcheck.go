@@ -0,0 +1,204 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// heartbeatInterval is how often the scheduler records a liveness heartbeat.
+var heartbeatInterval = 10 * time.Second
+
+// heartbeat is scheduled on the cron loop itself, so a stale heartbeat means the
+// scheduler has stopped dispatching jobs.
+func (s *Service) heartbeat() {
+	s.lastBeat.Store(time.Now().UnixNano())
+	s.updateHealthLevel(context.Background())
+}
+
+type probeCheck struct {
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// writeProbe answers 200 when every check passed and 503 otherwise, listing each check.
+func writeProbe(w http.ResponseWriter, checks map[string]probeCheck) {
+	status, code := "ok", http.StatusOK
+	for _, c := range checks {
+		if !c.OK {
+			status, code = "fail", http.StatusServiceUnavailable
+		}
+	}
+	writeAPIJSON(w, code, map[string]any{"status": status, "checks": checks})
+}
+
+// livenessChecks reports whether the process itself is working; Syncthing being
+// unreachable never fails it.
+func (s *Service) livenessChecks() map[string]probeCheck {
+	beat := s.lastBeat.Load()
+	if beat == 0 {
+		return map[string]probeCheck{"heartbeat": {OK: true, Detail: "scheduler starting"}}
+	}
+	age := time.Since(time.Unix(0, beat)).Round(time.Second)
+	return map[string]probeCheck{"heartbeat": {
+		OK:     age <= s.Settings.LivenessMaxAge,
+		Detail: fmt.Sprintf("last heartbeat %s ago (limit %s)", age, s.Settings.LivenessMaxAge),
+	}}
+}
+
+// readinessChecks adds the scheduler and Syncthing reachability to liveness. An
+// instance not heard from within ReadinessMaxAge is probed on the spot.
+func (s *Service) readinessChecks(ctx context.Context) map[string]probeCheck {
+	checks := s.livenessChecks()
+	s.schedMu.Lock()
+	started := s.cron != nil
+	s.schedMu.Unlock()
+	if !started {
+		checks["scheduler"] = probeCheck{OK: false, Detail: "scheduler not started"}
+	} else {
+		checks["scheduler"] = probeCheck{OK: true}
+	}
+
+	for _, h := range s.health.snapshot(s.instances()) {
+		name := "syncthing:" + h.Instance
+		if !h.LastSuccess.IsZero() && time.Since(h.LastSuccess) <= s.Settings.ReadinessMaxAge {
+			checks[name] = probeCheck{OK: true, Detail: "last contact " + h.LastSuccess.Format(time.RFC3339)}
+			continue
+		}
+		inst := h.Instance
+		if inst == defaultInstance {
+			inst = ""
+		}
+		_, _, err := s.client(inst).SystemStatus(ctx, 5*time.Second)
+		s.recordHealth(ctx, inst, err, nil)
+		if err != nil {
+			checks[name] = probeCheck{OK: false, Detail: err.Error()}
+		} else {
+			checks[name] = probeCheck{OK: true, Detail: "probed"}
+		}
+	}
+	return checks
+}
+
+// handleLivez serves /livez. Like /healthz and /readyz it needs no token so container
+// and Kubernetes probes need no credentials.
+func (s *Service) handleLivez(w http.ResponseWriter, r *http.Request) {
+	writeProbe(w, s.livenessChecks())
+}
+
+func (s *Service) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	writeProbe(w, s.readinessChecks(r.Context()))
+}
+
+// registerProbes adds the unauthenticated probe endpoints to mux.
+func (s *Service) registerProbes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /healthz", s.handleHealthz)
+	mux.HandleFunc("GET /livez", s.handleLivez)
+	mux.HandleFunc("GET /readyz", s.handleReadyz)
+}
+
+// startHealthSocket serves /healthz on Settings.HealthSocket so --healthcheck works
+// even without ST_ADMIN_ADDR. Failing to listen is logged, not fatal.
+func (s *Service) startHealthSocket() (stop func()) {
+	path := s.Settings.HealthSocket
+	// A socket left behind by an unclean exit would make Listen fail.
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&fs.ModeSocket != 0 {
+		_ = os.Remove(path)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		s.Logger.Printf("Health socket disabled: %v", err)
+		return func() {}
+	}
+	mux := http.NewServeMux()
+	s.registerProbes(mux)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() { _ = srv.Serve(ln) }()
+	return func() {
+		_ = srv.Close()
+		_ = os.Remove(path)
+	}
+}
+
+// errNoHealthListener means neither the admin listener nor the health socket answered.
+var errNoHealthListener = errors.New("no health listener reachable")
+
+// Healthcheck checks a running daemon: it queries /healthz on ST_ADMIN_ADDR or the
+// health socket and, when neither is reachable, requires the state file's last
+// successful trigger to be newer than ST_HEALTHCHECK_MAX_AGE.
+func Healthcheck(ctx context.Context, settings Settings) error {
+	err := probeHealthz(ctx, settings)
+	if !errors.Is(err, errNoHealthListener) {
+		return err
+	}
+
+	if settings.StateFile == "" {
+		return fmt.Errorf("%w and ST_STATE_FILE is not set", err)
+	}
+	state, err := readState(settings.StateFile)
+	if err != nil {
+		return err
+	}
+	if state.LastSuccess.IsZero() {
+		return errors.New("state file has no successful trigger yet")
+	}
+	if age := time.Since(state.LastSuccess); age > settings.HealthcheckMaxAge {
+		return fmt.Errorf("last successful trigger was %s ago (limit %s)", age.Round(time.Second), settings.HealthcheckMaxAge)
+	}
+	return nil
+}
+
+func probeHealthz(ctx context.Context, settings Settings) error {
+	type target struct {
+		url string
+		hc  *http.Client
+	}
+	var targets []target
+	if settings.AdminAddr != "" {
+		targets = append(targets, target{"http://" + dialAddr(settings.AdminAddr) + "/healthz", &http.Client{}})
+	}
+	if path := settings.HealthSocket; path != "" {
+		tr := &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		}}
+		targets = append(targets, target{"http://unix/healthz", &http.Client{Transport: tr}})
+	}
+
+	for _, t := range targets {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.url, nil)
+		if err != nil {
+			cancel()
+			return err
+		}
+		resp, err := t.hc.Do(req)
+		cancel()
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("healthz returned %s", resp.Status)
+		}
+		return nil
+	}
+	return errNoHealthListener
+}
+
+// dialAddr turns a listen address into one we can connect to locally.
+func dialAddr(listen string) string {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return listen
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealthcheckQueriesHealthSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "kick")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	sock := filepath.Join(dir, "h.sock") // keep short: unix socket paths are length-limited
+
+	fake := newFakeSyncthing(t)
+	svc := fake.service(t, Settings{HealthSocket: sock})
+	stop := svc.startHealthSocket()
+
+	settings := Settings{HealthSocket: sock}
+	if err := Healthcheck(context.Background(), settings); err != nil {
+		t.Fatalf("expected healthy daemon, got %v", err)
+	}
+
+	stop()
+	if _, err := os.Stat(sock); !os.IsNotExist(err) {
+		t.Fatalf("expected socket to be removed on stop")
+	}
+	if err := Healthcheck(context.Background(), settings); err == nil {
+		t.Fatalf("expected failure with no listener and no state file")
+	}
+}
+
+func TestHealthcheckReportsUnhealthyListener(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	err := Healthcheck(context.Background(), Settings{AdminAddr: strings.TrimPrefix(srv.URL, "http://")})
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("expected 503 error, got %v", err)
+	}
+}
+
+func TestHealthcheckFallsBackToStateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	settings := Settings{
+		HealthSocket:      filepath.Join(t.TempDir(), "missing.sock"),
+		StateFile:         path,
+		HealthcheckMaxAge: time.Hour,
+	}
+
+	fake := newFakeSyncthing(t, "docs")
+	svc := fake.service(t, settings)
+	if err := Healthcheck(context.Background(), settings); err == nil {
+		t.Fatalf("expected failure before any successful trigger")
+	}
+
+	svc.triggerScan(context.Background(), "docs")
+	if err := Healthcheck(context.Background(), settings); err != nil {
+		t.Fatalf("expected healthy after a trigger, got %v", err)
+	}
+
+	_ = svc.stateStore().markSuccess(time.Now().Add(-2 * time.Hour))
+	if err := Healthcheck(context.Background(), settings); err == nil || !strings.Contains(err.Error(), "ago") {
+		t.Fatalf("expected stale state error, got %v", err)
+	}
+}
+
+func TestDialAddr(t *testing.T) {
+	for in, want := range map[string]string{
+		":8385":          "127.0.0.1:8385",
+		"0.0.0.0:8385":   "127.0.0.1:8385",
+		"10.0.0.1:8385":  "10.0.0.1:8385",
+		"localhost:8385": "localhost:8385",
+	} {
+		if got := dialAddr(in); got != want {
+			t.Fatalf("dialAddr(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Overall health levels, from best to worst.
+const (
+	levelHealthy   = "healthy"
+	levelDegraded  = "degraded"
+	levelUnhealthy = "unhealthy"
+)
+
+// eventHealthChanged is raised on every health level transition.
+const eventHealthChanged = "health_changed"
+
+var levelRank = map[string]int{levelHealthy: 0, levelDegraded: 1, levelUnhealthy: 2}
+
+// HealthLevel is the overall health served by /healthz.
+type HealthLevel struct {
+	Level  string    `json:"status"`
+	Reason string    `json:"reason,omitempty"`
+	Since  time.Time `json:"since"`
+}
+
+// healthState is the overall health state machine. A worse level takes effect as
+// soon as it is assessed; a better one only once it has held for
+// ST_HEALTH_RECOVER_AFTER, so a flapping instance does not flap the level.
+type healthState struct {
+	mu      sync.Mutex
+	current HealthLevel
+	better  time.Time // when a better level was first assessed; zero if none is pending
+}
+
+// observe feeds one assessment into the state machine and reports the level it
+// moved from, if it moved.
+func (h *healthState) observe(level, reason string, now time.Time, recoverAfter time.Duration) (from HealthLevel, changed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.current.Level == "" {
+		h.current = HealthLevel{Level: levelHealthy, Since: now}
+	}
+	from = h.current
+	switch {
+	case level == h.current.Level:
+		h.current.Reason = reason
+		h.better = time.Time{}
+		return from, false
+	case levelRank[level] < levelRank[h.current.Level]:
+		if h.better.IsZero() {
+			h.better = now
+		}
+		if now.Sub(h.better) < recoverAfter {
+			return from, false
+		}
+	}
+	h.current = HealthLevel{Level: level, Reason: reason, Since: now}
+	h.better = time.Time{}
+	return from, true
+}
+
+func (h *healthState) snapshot() HealthLevel {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.current
+}
+
+// assessHealth works out the level the daemon is at right now and why:
+//   - unhealthy: the scheduler heartbeat is stale, or an instance has been
+//     unreachable for ST_UNHEALTHY_AFTER;
+//   - degraded: an instance is failing but still within that grace period, or a
+//     folder is out of sync, erroring, stale, or paused or stopped in Syncthing;
+//   - a folder whose failure streak reached ST_ALERT_AFTER brings it to the level
+//     matching its scan_failed severity: critical is unhealthy, warning degraded,
+//     and info leaves health alone;
+//   - healthy otherwise, including while an instance is within ST_OFFLINE_GRACE.
+func (s *Service) assessHealth(now time.Time) (string, string) {
+	reasons := map[string][]string{}
+	for name, c := range s.livenessChecks() {
+		if !c.OK {
+			reasons[levelUnhealthy] = append(reasons[levelUnhealthy], name+": "+c.Detail)
+		}
+	}
+	for _, h := range s.health.snapshot(s.instances()) {
+		if h.Failures == 0 {
+			continue
+		}
+		failing := now.Sub(h.failingSince).Round(time.Second)
+		if failing >= s.Settings.HealthUnhealthyAfter {
+			reasons[levelUnhealthy] = append(reasons[levelUnhealthy], fmt.Sprintf("instance %s unreachable for %s (%s)", h.Instance, failing, h.LastError))
+		} else {
+			reasons[levelDegraded] = append(reasons[levelDegraded], fmt.Sprintf("instance %s failing (%s)", h.Instance, h.LastError))
+		}
+	}
+	folderStreaks, _ := s.stateStore().failureStreaks()
+	threshold := max(s.Settings.AlertAfter, 1)
+	for _, id := range slices.Sorted(maps.Keys(folderStreaks)) {
+		n := folderStreaks[id]
+		if n < threshold {
+			continue
+		}
+		sev := s.eventSeverity(NotifyEvent{Type: eventScanFailed, Fields: map[string]any{"streak": n}})
+		if level := severityHealth[sev]; level != levelHealthy {
+			reasons[level] = append(reasons[level], fmt.Sprintf("folder %s failed %d times in a row", id, n))
+		}
+	}
+	for _, id := range s.stateStore().unhealthyFolders() {
+		reasons[levelDegraded] = append(reasons[levelDegraded], "folder "+id+" out of sync")
+	}
+	for _, id := range s.stats.staleFolders() {
+		reasons[levelDegraded] = append(reasons[levelDegraded], "folder "+id+" stale")
+	}
+	inactive := s.inactive.snapshot()
+	for _, id := range slices.Sorted(maps.Keys(inactive)) {
+		reasons[levelDegraded] = append(reasons[levelDegraded], "folder "+id+" "+inactive[id])
+	}
+
+	for _, level := range []string{levelUnhealthy, levelDegraded} {
+		if len(reasons[level]) > 0 {
+			return level, strings.Join(reasons[level], "; ")
+		}
+	}
+	return levelHealthy, ""
+}
+
+// updateHealthLevel assesses health and steps the state machine, logging and
+// notifying (health_changed) when the level changes.
+func (s *Service) updateHealthLevel(ctx context.Context) HealthLevel {
+	s.health.expire(s.log(ctx), s.Settings.OfflineGrace)
+	level, reason := s.assessHealth(time.Now())
+	from, changed := s.level.observe(level, reason, time.Now().UTC(), s.Settings.HealthRecoverAfter)
+	cur := s.level.snapshot()
+	if !changed {
+		return cur
+	}
+	msg := fmt.Sprintf("Health changed from %s to %s", from.Level, cur.Level)
+	if cur.Reason != "" {
+		msg += ": " + cur.Reason
+	}
+	s.log(ctx).Printf("%s", msg)
+	s.notify(NotifyEvent{
+		Type:    eventHealthChanged,
+		Message: msg,
+		Fields:  map[string]any{"from": from.Level, "to": cur.Level, "reason": cur.Reason},
+	})
+	return cur
+}
+
+// handleHealthz serves /healthz: 200 while healthy or degraded, 503 once unhealthy.
+// The body names the level and why.
+func (s *Service) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	lvl := s.updateHealthLevel(r.Context())
+	code := http.StatusOK
+	if lvl.Level == levelUnhealthy {
+		code = http.StatusServiceUnavailable
+	}
+	writeAPIJSON(w, code, map[string]any{"status": lvl.Level, "reason": lvl.Reason, "since": lvl.Since, "checks": s.livenessChecks()})
+}
@@ -0,0 +1,129 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+func TestHealthStateRecoversOnlyAfterHold(t *testing.T) {
+	var h healthState
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if _, changed := h.observe(levelUnhealthy, "down", t0, time.Minute); !changed {
+		t.Fatal("a worse level should apply at once")
+	}
+	if _, changed := h.observe(levelDegraded, "flaky", t0.Add(30*time.Second), time.Minute); changed {
+		t.Fatal("a better level should wait for the hold period")
+	}
+	if _, changed := h.observe(levelHealthy, "", t0.Add(80*time.Second), time.Minute); changed {
+		t.Fatal("the hold period has not passed yet")
+	}
+	from, changed := h.observe(levelHealthy, "", t0.Add(90*time.Second), time.Minute)
+	if !changed || from.Level != levelUnhealthy || h.snapshot().Level != levelHealthy {
+		t.Fatalf("expected unhealthy -> healthy, got changed=%v from %+v now %+v", changed, from, h.snapshot())
+	}
+
+	// Falling back to the current level restarts the hold.
+	h.observe(levelDegraded, "x", t0.Add(100*time.Second), time.Minute)
+	h.observe(levelHealthy, "", t0.Add(110*time.Second), time.Minute)
+	h.observe(levelDegraded, "x", t0.Add(120*time.Second), time.Minute)
+	if _, changed := h.observe(levelHealthy, "", t0.Add(170*time.Second), time.Minute); changed {
+		t.Fatal("expected the hold to restart")
+	}
+}
+
+func TestHealthzLevels(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	rec := &recordingNotifier{}
+	var logs syncBuffer
+	svc := fake.service(t, Settings{HealthUnhealthyAfter: 5 * time.Minute, AlertAfter: 3})
+	svc.Logger = log.New(&logs, "", 0)
+	svc.Notifiers = []Notifier{rec}
+	h := svc.adminHandler(context.Background(), make(chan struct{}, 1))
+	healthz := func() (int, HealthLevel) {
+		t.Helper()
+		resp := adminRequest(t, h, http.MethodGet, "/healthz", "", "")
+		var lvl HealthLevel
+		if err := json.Unmarshal(resp.Body.Bytes(), &lvl); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp.Code, lvl
+	}
+
+	if code, lvl := healthz(); code != http.StatusOK || lvl.Level != levelHealthy {
+		t.Fatalf("expected healthy, got %d %+v", code, lvl)
+	}
+
+	// A transient failure degrades without failing the probe.
+	svc.health.record(svc.Logger, "", refused(), 0, nil)
+	if code, lvl := healthz(); code != http.StatusOK || lvl.Level != levelDegraded || !strings.Contains(lvl.Reason, "instance default failing") {
+		t.Fatalf("expected degraded, got %d %+v", code, lvl)
+	}
+
+	// Still unreachable past the grace period: unhealthy.
+	svc.health.entries[""].failingSince = time.Now().Add(-10 * time.Minute)
+	code, lvl := healthz()
+	if code != http.StatusServiceUnavailable || lvl.Level != levelUnhealthy || !strings.Contains(lvl.Reason, "unreachable for 10m0s") {
+		t.Fatalf("expected unhealthy, got %d %+v", code, lvl)
+	}
+	healthz()
+
+	svc.notifications.Wait()
+	if got := rec.types(); !slices.Equal(got, []string{eventHealthChanged, eventHealthChanged}) {
+		t.Fatalf("expected one event per transition, got %v", got)
+	}
+	rec.mu.Lock()
+	hasEscalation := slices.ContainsFunc(rec.events, func(ev NotifyEvent) bool {
+		return ev.Fields["from"] == levelDegraded && ev.Fields["to"] == levelUnhealthy
+	})
+	rec.mu.Unlock()
+	if !hasEscalation {
+		t.Fatalf("expected a degraded -> unhealthy event, got %+v", rec.events)
+	}
+	if n := strings.Count(logs.String(), "Health changed from degraded to unhealthy"); n != 1 {
+		t.Fatalf("expected the transition logged once, got %d:\n%s", n, logs.String())
+	}
+}
+
+func TestAssessHealthFolders(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs", "photos")
+	svc := fake.service(t, Settings{AlertAfter: 2})
+
+	fake.setStatus("photos", syncthing.FolderStatus{State: "syncing", NeedBytes: 10})
+	_ = svc.checkSyncStatus(context.Background(), []string{"photos"}, 0)
+	if level, reason := svc.assessHealth(time.Now()); level != levelDegraded || reason != "folder photos out of sync" {
+		t.Fatalf("got %s %q", level, reason)
+	}
+
+	fake.failScans(http.StatusInternalServerError)
+	svc.triggerScan(context.Background(), "docs")
+	svc.triggerScan(context.Background(), "docs")
+	if level, reason := svc.assessHealth(time.Now()); level != levelDegraded || reason != "folder docs failed 2 times in a row; folder photos out of sync" {
+		t.Fatalf("got %s %q", level, reason)
+	}
+
+	// The streak takes the health level of its scan_failed severity.
+	svc.Settings.NotifySeverity = map[string]string{eventScanFailed: severityCritical}
+	if level, reason := svc.assessHealth(time.Now()); level != levelUnhealthy || reason != "folder docs failed 2 times in a row" {
+		t.Fatalf("got %s %q", level, reason)
+	}
+	svc.Settings.NotifySeverity = map[string]string{eventScanFailed: severityInfo}
+	if level, reason := svc.assessHealth(time.Now()); level != levelDegraded || reason != "folder photos out of sync" {
+		t.Fatalf("expected an info streak to leave health alone, got %s %q", level, reason)
+	}
+	svc.Settings.NotifySeverity = nil
+	for range 18 {
+		svc.triggerScan(context.Background(), "docs")
+	}
+	if level, reason := svc.assessHealth(time.Now()); level != levelUnhealthy || reason != "folder docs failed 20 times in a row" {
+		t.Fatalf("expected an escalated streak to be unhealthy, got %s %q", level, reason)
+	}
+}
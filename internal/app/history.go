@@ -0,0 +1,384 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+const defaultHistorySize = 100
+
+// RunRecord describes one run: a batch of folders triggered together by one source.
+type RunRecord struct {
+	ID         string            `json:"id,omitempty"` // also prefixes the run's log lines
+	Started    time.Time         `json:"started"`
+	Label      string            `json:"label"` // "global", "folder:<id>", "api:<run id>", "watch:<id>", ...
+	DurationMs int64             `json:"durationMs"`
+	Folders    []RunFolderResult `json:"folders"`
+}
+
+// RunFolderResult is the outcome of one folder within a run. The settle fields are
+// filled in by the delayed status check, possibly after the run itself finished.
+type RunFolderResult struct {
+	Folder     string `json:"folder"`
+	Attempt    int    `json:"attempt,omitempty"` // 1 unless the run scanned the folder more than once
+	Result     string `json:"result"`
+	DurationMs int64  `json:"durationMs"`
+	// CompletedMs bounds how long the scan took: the time from the trigger to the first
+	// status check that no longer showed it scanning.
+	CompletedMs int64  `json:"completedMs,omitempty"`
+	Settled     string `json:"settled,omitempty"` // folder state at that status check
+	NeedBytes   int64  `json:"needBytes,omitempty"`
+	// Overridden is how many needed items a scheduled override undid.
+	Overridden int64 `json:"overridden,omitempty"`
+	// Reverted is how many locally changed items a scheduled revert undid.
+	Reverted int64 `json:"reverted,omitempty"`
+	// VersionedFiles, Versions and VersionsBytes are what a versions report found
+	// archived: files with versions, versions in all and their total size.
+	VersionedFiles int64 `json:"versionedFiles,omitempty"`
+	Versions       int64 `json:"versions,omitempty"`
+	VersionsBytes  int64 `json:"versionsBytes,omitempty"`
+	// Hooks are the hook commands run for this attempt, in order.
+	Hooks []HookRun `json:"hooks,omitempty"`
+	// LatencyMs is the time from the trigger until the folder was idle again, needing
+	// no more than before the scan (with ST_SCAN_LATENCY_BUDGET). LatencyCensored
+	// means it had not settled by then and LatencyMs is the budget.
+	LatencyMs       int64 `json:"latencyMs,omitempty"`
+	LatencyCensored bool  `json:"latencyCensored,omitempty"`
+}
+
+// runHistory is a fixed-size ring of the most recent runs; the oldest record is
+// overwritten first. The zero value is ready to use.
+type runHistory struct {
+	mu   sync.Mutex
+	buf  []RunRecord
+	next int // index the next record is written to once buf is full
+}
+
+func (h *runHistory) add(size int, rec RunRecord) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if size <= 0 {
+		size = defaultHistorySize
+	}
+	if len(h.buf) < size {
+		h.buf = append(h.buf, rec)
+		return
+	}
+	h.buf[h.next] = rec
+	h.next = (h.next + 1) % len(h.buf)
+}
+
+// update applies fn to the record with the given run ID and reports whether it was found.
+func (h *runHistory) update(id string, fn func(*RunRecord)) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i := range h.buf {
+		if h.buf[i].ID == id {
+			// Copy first: earlier list() results share the slice.
+			h.buf[i].Folders = append([]RunFolderResult(nil), h.buf[i].Folders...)
+			fn(&h.buf[i])
+			return true
+		}
+	}
+	return false
+}
+
+// list returns the records oldest first.
+func (h *runHistory) list() []RunRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]RunRecord, 0, len(h.buf))
+	out = append(out, h.buf[h.next:]...)
+	return append(out, h.buf[:h.next]...)
+}
+
+// seed loads previously persisted records (oldest first), keeping the newest size.
+func (h *runHistory) seed(size int, recs []RunRecord) {
+	for _, rec := range recs {
+		h.add(size, rec)
+	}
+}
+
+// runRecorder collects one run's folder outcomes while it is in progress.
+type runRecorder struct {
+	s        *Service
+	mu       sync.Mutex
+	rec      RunRecord
+	attempts map[string]int // folder -> attempts so far in this run
+	finished bool           // rec has been added to the history
+}
+
+// scanAttempt follows one folder through a run, from the trigger to the delayed status
+// check that shows whether the scan finished and where the folder settled.
+type scanAttempt struct {
+	run       *runRecorder
+	folder    string
+	attempt   int
+	index     int // into run.rec.Folders
+	triggered time.Time
+	result    string
+
+	// For ST_SCAN_LATENCY_BUDGET: what the folder needed before the trigger, and the
+	// last status seen of it since.
+	baseline   int64
+	baselineOK bool
+	mu         sync.Mutex
+	last       syncthing.FolderStatus
+	lastAt     time.Time
+}
+
+// recentRuns returns the run history, seeded from the state file on first use.
+func (s *Service) recentRuns() *runHistory {
+	s.historyOnce.Do(func() {
+		s.history.seed(s.Settings.HistorySize, s.stateStore().history())
+	})
+	return &s.history
+}
+
+// startRun begins recording a run. It keeps the run ID already carried by ctx, if
+// any, or assigns a new one; the returned context carries it.
+func (s *Service) startRun(ctx context.Context, label string) (context.Context, *runRecorder) {
+	id := runIDFrom(ctx)
+	if id == "" {
+		id = newRunID()
+		ctx = withRunID(ctx, id)
+	}
+	return ctx, &runRecorder{s: s, rec: RunRecord{ID: id, Started: time.Now().UTC(), Label: label}, attempts: map[string]int{}}
+}
+
+// scan triggers folder (limited to sub, if set) and records how it went. The returned
+// attempt is handed to the status check that follows.
+func (r *runRecorder) scan(ctx context.Context, folder, sub string) *scanAttempt {
+	a := r.begin(folder)
+	a.trigger(ctx, sub)
+	return a
+}
+
+// begin reserves folder's place in the run, so outcomes are listed in dispatch order
+// even when attempts finish out of order.
+func (r *runRecorder) begin(folder string) *scanAttempt {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts[folder]++
+	a := &scanAttempt{run: r, folder: folder, attempt: r.attempts[folder], index: len(r.rec.Folders)}
+	r.rec.Folders = append(r.rec.Folders, RunFolderResult{Folder: folder, Attempt: a.attempt})
+	return a
+}
+
+type attemptKey struct{}
+
+// withAttempt returns a copy of ctx carrying a, so hooks run on its behalf are
+// recorded with it.
+func withAttempt(ctx context.Context, a *scanAttempt) context.Context {
+	return context.WithValue(ctx, attemptKey{}, a)
+}
+
+// attemptFrom returns the scan attempt carried by ctx, if any.
+func attemptFrom(ctx context.Context) *scanAttempt {
+	a, _ := ctx.Value(attemptKey{}).(*scanAttempt)
+	return a
+}
+
+// trigger scans the attempt's folder (limited to sub, if set) and records the outcome.
+func (a *scanAttempt) trigger(ctx context.Context, sub string) {
+	if a.run.s.Settings.ScanLatencyBudget > 0 && a.folder != "*" {
+		st, err := a.run.s.folderStatus(ctx, a.folder, 3*time.Second, false)
+		a.baseline, a.baselineOK = st.NeedBytes, err == nil
+	}
+	a.triggered = time.Now()
+	a.result = a.run.s.triggerScanPath(withAttempt(ctx, a), a.folder, sub)
+	var res RunFolderResult
+	a.run.update(a.index, func(f *RunFolderResult) {
+		f.Result, f.DurationMs = a.result, time.Since(a.triggered).Milliseconds()
+		res = *f
+	})
+	a.run.s.digestScan(a.folder, res)
+	a.run.s.log(ctx).Printf("%s: %s (attempt %d)", a.folder, a.result, a.attempt)
+}
+
+// settled records what the status check after the attempt saw for ref and logs the
+// transition: whether the scan has completed and where the folder settled.
+func (a *scanAttempt) settled(ctx context.Context, ref string, st syncthing.FolderStatus) {
+	if a.result != resultTriggered && a.result != resultTimeout {
+		return
+	}
+	logger := a.run.s.log(ctx)
+	elapsed := time.Since(a.triggered)
+	if st.State == "scanning" || st.State == "scan-waiting" {
+		logger.Printf("%s: still %s after %s (attempt %d)", ref, st.State, elapsed.Round(time.Second), a.attempt)
+	} else {
+		logger.Printf("%s: scan completed within %s (attempt %d)", ref, elapsed.Round(time.Second), a.attempt)
+	}
+	if st.State == "idle" && st.NeedBytes == 0 {
+		logger.Printf("%s: settled idle, needBytes=0 (attempt %d)", ref, a.attempt)
+	} else {
+		logger.Printf("%s: not settled, state=%s needBytes=%d (attempt %d)", ref, st.State, st.NeedBytes, a.attempt)
+	}
+	if ref != a.folder {
+		return // one folder of a "*" attempt
+	}
+	a.mu.Lock()
+	a.last, a.lastAt = st, time.Now()
+	a.mu.Unlock()
+	unconfirmed := a.result == resultTimeout && !scanStarted(st, a.triggered)
+	if unconfirmed {
+		a.run.s.failUnconfirmedTimeout(ctx, ref, st)
+	} else if a.result == resultTimeout {
+		a.run.s.trackFailureStreak(ctx, ref, resultTriggered, nil)
+	}
+	a.run.update(a.index, func(f *RunFolderResult) {
+		if unconfirmed {
+			f.Result = resultFailed
+		}
+		if st.State != "scanning" && st.State != "scan-waiting" {
+			f.CompletedMs = elapsed.Milliseconds()
+		}
+		f.Settled, f.NeedBytes = st.State, st.NeedBytes
+	})
+}
+
+// lastStatus returns the last status the attempt's status check saw of its folder,
+// with a zero time if there was none.
+func (a *scanAttempt) lastStatus() (syncthing.FolderStatus, time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.last, a.lastAt
+}
+
+// update applies fn to one folder's outcome, in the history if the run has finished.
+func (r *runRecorder) update(index int, fn func(*RunFolderResult)) {
+	r.mu.Lock()
+	if !r.finished {
+		fn(&r.rec.Folders[index])
+		r.mu.Unlock()
+		return
+	}
+	id := r.rec.ID
+	r.mu.Unlock()
+	h := r.s.recentRuns()
+	if !h.update(id, func(rec *RunRecord) {
+		if index < len(rec.Folders) {
+			fn(&rec.Folders[index])
+		}
+	}) {
+		return // already rotated out
+	}
+	if err := r.s.stateStore().setHistory(h.list()); err != nil {
+		r.s.Logger.Printf("Failed to save state: %v", err)
+	}
+}
+
+// lastRun returns the most recent run recorded under label.
+func (s *Service) lastRun(label string) RunRecord {
+	runs := s.recentRuns().list()
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runs[i].Label == label {
+			return runs[i]
+		}
+	}
+	return RunRecord{Label: label}
+}
+
+// finish logs a summary of the run, adds it to the history and persists it with the
+// state file.
+func (r *runRecorder) finish() {
+	r.mu.Lock()
+	rec := r.rec
+	rec.Folders = append([]RunFolderResult(nil), rec.Folders...)
+	r.finished = true
+	r.mu.Unlock()
+	rec.DurationMs = time.Since(rec.Started).Milliseconds()
+	parts := make([]string, 0, len(rec.Folders))
+	for _, f := range rec.Folders {
+		parts = append(parts, f.Folder+"="+f.Result)
+	}
+	r.s.log(withRunID(context.Background(), rec.ID)).Printf("Run %s finished in %s: %s",
+		rec.Label, (time.Duration(rec.DurationMs) * time.Millisecond).String(), strings.Join(parts, ", "))
+	h := r.s.recentRuns()
+	h.add(r.s.Settings.HistorySize, rec)
+	if err := r.s.stateStore().setHistory(h.list()); err != nil {
+		r.s.Logger.Printf("Failed to save state: %v", err)
+	}
+}
+
+func (s *Service) handleHistory(w http.ResponseWriter, r *http.Request) {
+	writeAPIJSON(w, http.StatusOK, map[string]any{"runs": s.recentRuns().list()})
+}
+
+// FetchHistory returns recent runs from the running daemon's admin API, or from the
+// state file when the daemon cannot be reached. source says which one answered.
+func FetchHistory(ctx context.Context, settings Settings) (runs []RunRecord, source string, err error) {
+	if settings.AdminAddr != "" {
+		runs, err = fetchHistoryAPI(ctx, settings)
+		if err == nil {
+			return runs, "api", nil
+		}
+	}
+	if settings.StateFile == "" {
+		if err == nil {
+			err = fmt.Errorf("ST_ADMIN_ADDR and ST_STATE_FILE are both unset")
+		}
+		return nil, "", err
+	}
+	state, serr := readState(settings.StateFile)
+	if serr != nil {
+		return nil, "", serr
+	}
+	return state.History, "state file", nil
+}
+
+func fetchHistoryAPI(ctx context.Context, settings Settings) ([]RunRecord, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+dialAddr(settings.AdminAddr)+"/api/history", nil)
+	if err != nil {
+		return nil, err
+	}
+	if settings.AdminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+settings.AdminToken)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("admin API returned %s", resp.Status)
+	}
+	var body struct {
+		Runs []RunRecord `json:"runs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decode history: %w", err)
+	}
+	return body.Runs, nil
+}
+
+// WriteHistoryTable prints runs newest first, one line per run.
+func WriteHistoryTable(w io.Writer, runs []RunRecord) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STARTED\tRUN\tLABEL\tDURATION\tFOLDERS")
+	for i := len(runs) - 1; i >= 0; i-- {
+		r := runs[i]
+		parts := make([]string, 0, len(r.Folders))
+		for _, f := range r.Folders {
+			parts = append(parts, f.Folder+"="+f.Result)
+		}
+		d := (time.Duration(r.DurationMs) * time.Millisecond).String()
+		id := r.ID
+		if id == "" {
+			id = "-" // recorded before runs had IDs
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Started.Local().Format("2006-01-02 15:04:05"), id, r.Label, d, strings.Join(parts, ", "))
+	}
+	return tw.Flush()
+}
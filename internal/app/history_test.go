@@ -0,0 +1,152 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+func TestRunHistoryEvictsOldestFirst(t *testing.T) {
+	var h runHistory
+	for i := 0; i < 5; i++ {
+		h.add(3, RunRecord{Label: fmt.Sprint(i)})
+	}
+	labels := []string{}
+	for _, r := range h.list() {
+		labels = append(labels, r.Label)
+	}
+	if got := strings.Join(labels, ","); got != "2,3,4" {
+		t.Fatalf("expected the 3 newest runs oldest first, got %s", got)
+	}
+}
+
+func TestRunHistoryConcurrentAdds(t *testing.T) {
+	var h runHistory
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.add(10, RunRecord{Label: "x"})
+			_ = h.list()
+		}()
+	}
+	wg.Wait()
+	if got := len(h.list()); got != 10 {
+		t.Fatalf("expected 10 records, got %d", got)
+	}
+}
+
+func TestHistoryRecordsRunsAndIsServed(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs", "photos")
+	svc := fake.service(t, Settings{})
+	pending := make(chan struct{}, 16)
+
+	_ = svc.triggerScans(context.Background(), "global", []string{"docs", "missing"}, pending)
+	_ = svc.triggerScans(context.Background(), "folder:photos", []string{"photos"}, pending)
+
+	h := svc.adminHandler(context.Background(), pending)
+	rec := adminRequest(t, h, http.MethodGet, "/api/history", "", "")
+	var body struct {
+		Runs []RunRecord `json:"runs"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(body.Runs) != 2 || body.Runs[0].Label != "global" || body.Runs[1].Label != "folder:photos" {
+		t.Fatalf("unexpected runs: %+v", body.Runs)
+	}
+	got := body.Runs[0].Folders
+	if len(got) != 2 || got[0].Result != resultTriggered || got[1].Result != resultFailed {
+		t.Fatalf("unexpected folder outcomes: %+v", got)
+	}
+
+	var buf bytes.Buffer
+	_ = WriteHistoryTable(&buf, body.Runs)
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 3 || !strings.Contains(lines[1], "folder:photos") {
+		t.Fatalf("expected newest run first:\n%s", buf.String())
+	}
+}
+
+func TestFetchHistoryFallsBackToStateFile(t *testing.T) {
+	settings := Settings{StateFile: filepath.Join(t.TempDir(), "state.json"), AdminAddr: unusedAddr(t)}
+	fake := newFakeSyncthing(t, "docs")
+	svc := fake.service(t, settings)
+	_ = svc.triggerScans(context.Background(), "global", []string{"docs"}, make(chan struct{}, 4))
+
+	runs, source, err := FetchHistory(context.Background(), settings)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if source != "state file" || len(runs) != 1 || runs[0].Folders[0].Folder != "docs" {
+		t.Fatalf("unexpected history from %s: %+v", source, runs)
+	}
+
+	// A restarted daemon picks the persisted history up again.
+	restarted := fake.service(t, settings)
+	if got := len(restarted.recentRuns().list()); got != 1 {
+		t.Fatalf("expected persisted run to be reloaded, got %d", got)
+	}
+}
+
+func TestRunTracksFolderAttemptStages(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs", "media")
+	fake.setStatus("docs", syncthing.FolderStatus{State: "idle"})
+	fake.setStatus("media", syncthing.FolderStatus{State: "scanning", NeedBytes: 10})
+	svc := fake.service(t, Settings{})
+	var buf syncBuffer
+	svc.Logger = log.New(&buf, "", 0)
+
+	pending := make(chan struct{}, 4)
+	_ = svc.triggerScans(context.Background(), "global", []string{"docs", "media", "docs"}, pending)
+	var runs []RunRecord
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		runs = svc.recentRuns().list()
+		settled := 0
+		for _, f := range runs[0].Folders {
+			if f.Settled != "" {
+				settled++
+			}
+		}
+		if settled == 3 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	got := runs[0].Folders
+	if len(got) != 3 || got[0].Attempt != 1 || got[2].Attempt != 2 || got[1].Attempt != 1 {
+		t.Fatalf("unexpected attempts: %+v", got)
+	}
+	if got[0].Settled != "idle" || got[2].Settled != "idle" || got[1].Settled != "scanning" || got[1].NeedBytes != 10 || got[1].CompletedMs != 0 {
+		t.Fatalf("unexpected settle stages: %+v", got)
+	}
+
+	logs := buf.String()
+	for _, want := range []string{
+		"docs: triggered (attempt 1)",
+		"docs: triggered (attempt 2)",
+		"docs: settled idle, needBytes=0 (attempt 2)",
+		"media: still scanning after ",
+		"media: not settled, state=scanning needBytes=10 (attempt 1)",
+	} {
+		if !strings.Contains(logs, want) {
+			t.Fatalf("missing %q in:\n%s", want, logs)
+		}
+	}
+	if !regexp.MustCompile(`docs: scan completed within \S+ \(attempt 1\)`).MatchString(logs) {
+		t.Fatalf("missing completion line in:\n%s", logs)
+	}
+}
@@ -0,0 +1,211 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultHookOutputLimit = 4096
+
+// hookEnvPassthrough are the only variables a hook inherits from the kicker's own
+// environment; everything else, ST_API_KEY included, stays out of reach.
+var hookEnvPassthrough = []string{"PATH", "HOME", "USER", "LANG", "LC_ALL", "TZ", "TMPDIR"}
+
+// hookMaxLine is how much of a line without a newline is buffered before it is
+// handled as a line of its own.
+const hookMaxLine = 64 << 10
+
+// hookWaitDelay bounds how long a finished or killed hook may keep its output
+// pipes open through processes it left behind.
+const hookWaitDelay = time.Second
+
+// HookRun is one hook command as recorded in the run history.
+type HookRun struct {
+	Hook       string `json:"hook"`
+	ExitCode   int    `json:"exitCode"` // -1 when it could not be started or was killed
+	DurationMs int64  `json:"durationMs"`
+	TimedOut   bool   `json:"timedOut,omitempty"`
+	// Cached is set when the outcome of an earlier run within ST_SCAN_CONDITION_TTL
+	// was reused instead of running the command; DurationMs is then 0.
+	Cached bool `json:"cached,omitempty"`
+}
+
+// hookResult is how a hook command ended.
+type hookResult struct {
+	HookRun
+	FirstLine string // first line of stdout, for callers that report it
+	Err       error  // why it did not exit 0
+}
+
+// runHook runs command through /bin/sh on behalf of folder. It starts with a minimal
+// environment plus KICKER_HOOK, KICKER_FOLDER, KICKER_FOLDER_ID, KICKER_INSTANCE,
+// KICKER_RUN_ID and env, and is killed together with its process group once timeout
+// passes or ctx ends. Its stdout and stderr are logged line by line, prefixed with
+// the hook and folder, until ST_HOOK_OUTPUT_LIMIT bytes have been logged.
+func (s *Service) runHook(ctx context.Context, hook, folder, command string, timeout time.Duration, env map[string]string) hookResult {
+	inst, id := s.splitRef(folder)
+	vars := map[string]string{
+		"KICKER_HOOK":      hook,
+		"KICKER_FOLDER":    folder,
+		"KICKER_FOLDER_ID": id,
+		"KICKER_INSTANCE":  instanceName(inst),
+		"KICKER_RUN_ID":    runIDFrom(ctx),
+	}
+	for k, v := range env {
+		vars[k] = v
+	}
+
+	hctx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		hctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(hctx, "/bin/sh", "-c", command)
+	cmd.Env = hookEnv(vars)
+	cmd.WaitDelay = hookWaitDelay
+	killProcessGroup(cmd)
+
+	out := &hookOutput{limit: s.Settings.HookOutputLimit, emit: func(stream, line string) {
+		s.logEvent(ctx, logEvent{
+			Msg:    fmt.Sprintf("[%s %s] %s: %s", hook, folder, stream, line),
+			Folder: folder, Label: s.folderLabel(folder), Text: hook + " " + stream + ": " + line,
+		})
+	}}
+	cmd.Stdout, cmd.Stderr = out.stream("stdout"), out.stream("stderr")
+
+	start := time.Now()
+	err := cmd.Run()
+	out.flush()
+	res := hookResult{HookRun: HookRun{Hook: hook, ExitCode: -1, DurationMs: time.Since(start).Milliseconds()}, FirstLine: out.firstLine()}
+	if cmd.ProcessState != nil {
+		res.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	switch {
+	case errors.Is(hctx.Err(), context.DeadlineExceeded) && ctx.Err() == nil:
+		res.TimedOut = true
+		res.Err = fmt.Errorf("killed after %s", timeout)
+	case err != nil && !errors.Is(err, exec.ErrWaitDelay):
+		// ErrWaitDelay only means something the hook left behind held its output open.
+		res.Err = err
+	}
+	if n := out.dropped(); n > 0 {
+		s.log(ctx).Printf("[%s %s] output truncated after %d bytes (ST_HOOK_OUTPUT_LIMIT); %d more not logged", hook, folder, s.Settings.HookOutputLimit, n)
+	}
+	if res.Err != nil {
+		s.log(ctx).Printf("[%s %s] failed after %s: %v", hook, folder, time.Duration(res.DurationMs)*time.Millisecond, res.Err)
+	}
+	return res
+}
+
+// hookEnv is the passthrough part of the kicker's environment plus vars, sorted.
+func hookEnv(vars map[string]string) []string {
+	var env []string
+	for _, k := range hookEnvPassthrough {
+		if v, ok := os.LookupEnv(k); ok {
+			env = append(env, k+"="+v)
+		}
+	}
+	for k, v := range vars {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// hookOutput splits a hook's stdout and stderr into lines and hands them to emit
+// until limit bytes have been emitted; the rest is only counted.
+type hookOutput struct {
+	limit int
+	emit  func(stream, line string)
+
+	mu      sync.Mutex
+	used    int
+	skipped int
+	first   string
+	gotLine bool // first is set
+	streams []*hookStream
+}
+
+type hookStream struct {
+	out  *hookOutput
+	name string
+	buf  []byte // incomplete last line
+}
+
+func (o *hookOutput) stream(name string) io.Writer {
+	st := &hookStream{out: o, name: name}
+	o.streams = append(o.streams, st)
+	return st
+}
+
+// Write is only ever called by one goroutine per stream.
+func (w *hookStream) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.out.line(w.name, string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	if len(w.buf) > hookMaxLine {
+		w.out.line(w.name, string(w.buf))
+		w.buf = nil
+	}
+	return len(p), nil
+}
+
+func (o *hookOutput) line(stream, line string) {
+	line = strings.TrimRight(line, "\r")
+	o.mu.Lock()
+	if stream == "stdout" && !o.gotLine {
+		o.first, o.gotLine = line, true
+	}
+	if o.skipped > 0 || o.used+len(line)+1 > o.limit {
+		o.skipped += len(line) + 1
+		o.mu.Unlock()
+		return
+	}
+	o.used += len(line) + 1
+	o.mu.Unlock()
+	o.emit(stream, line)
+}
+
+// flush emits what is left of unterminated last lines, once the command is done.
+func (o *hookOutput) flush() {
+	for _, st := range o.streams {
+		if len(st.buf) > 0 {
+			o.line(st.name, string(st.buf))
+			st.buf = nil
+		}
+	}
+}
+
+func (o *hookOutput) firstLine() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.first
+}
+
+// dropped is the number of output bytes that were not logged.
+func (o *hookOutput) dropped() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.skipped
+}
+
+// recordHook adds a finished hook command to the attempt's run history entry.
+func (a *scanAttempt) recordHook(res hookResult) {
+	a.run.update(a.index, func(f *RunFolderResult) { f.Hooks = append(f.Hooks, res.HookRun) })
+}
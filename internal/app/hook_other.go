@@ -0,0 +1,9 @@
+//go:build !unix
+
+package app
+
+import "os/exec"
+
+// killProcessGroup leaves cmd as is: without process groups cancellation kills
+// only the hook itself.
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,92 @@
+//go:build unix
+
+package app
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func hookService(t *testing.T, settings Settings) (*Service, *syncBuffer) {
+	t.Helper()
+	fake := newFakeSyncthing(t, "docs")
+	svc := fake.service(t, settings)
+	var buf syncBuffer
+	svc.Logger = log.New(&buf, "", 0)
+	return svc, &buf
+}
+
+func TestHookOutputIsLoggedAndRecorded(t *testing.T) {
+	svc, buf := hookService(t, Settings{HookOutputLimit: defaultHookOutputLimit})
+	t.Setenv("ST_API_KEY", "secret")
+	ctx, run := svc.startRun(context.Background(), "test")
+	a := run.begin("docs")
+
+	res := svc.runHook(ctx, "post-scan", "docs", `echo "$KICKER_HOOK $KICKER_FOLDER ${ST_API_KEY:-no-key}"; echo oops >&2`, time.Second, map[string]string{"KICKER_RESULT": "triggered"})
+	a.recordHook(res)
+	run.finish()
+
+	if res.Err != nil || res.ExitCode != 0 || res.FirstLine != "post-scan docs no-key" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	for _, want := range []string{"[post-scan docs] stdout: post-scan docs no-key", "[post-scan docs] stderr: oops"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("missing %q in:\n%s", want, buf.String())
+		}
+	}
+	if hooks := svc.lastRun("test").Folders[0].Hooks; len(hooks) != 1 || hooks[0].Hook != "post-scan" || hooks[0].ExitCode != 0 {
+		t.Fatalf("expected the hook in the run history, got %+v", hooks)
+	}
+
+	if env := svc.runHook(ctx, "post-scan", "docs", `echo "$KICKER_RESULT"`, time.Second, map[string]string{"KICKER_RESULT": "triggered"}); env.FirstLine != "triggered" {
+		t.Fatalf("expected extra KICKER_* variables, got %q", env.FirstLine)
+	}
+}
+
+func TestHookFailureReportsExitCode(t *testing.T) {
+	svc, buf := hookService(t, Settings{HookOutputLimit: defaultHookOutputLimit})
+	res := svc.runHook(context.Background(), "pre-scan", "docs", "exit 3", time.Second, nil)
+	if res.Err == nil || res.ExitCode != 3 || res.TimedOut {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if !strings.Contains(buf.String(), "[pre-scan docs] failed after") {
+		t.Fatalf("expected the failure to be logged:\n%s", buf.String())
+	}
+}
+
+func TestHookTimeoutKillsProcessGroup(t *testing.T) {
+	svc, _ := hookService(t, Settings{HookOutputLimit: defaultHookOutputLimit})
+	marker := filepath.Join(t.TempDir(), "child-survived")
+	start := time.Now()
+	res := svc.runHook(context.Background(), "pre-scan", "docs", "(sleep 1; touch "+marker+") & sleep 5", 200*time.Millisecond, nil)
+	if !res.TimedOut || res.ExitCode != -1 || res.Err == nil {
+		t.Fatalf("expected a timeout, got %+v", res)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("hook was not killed promptly: %s", elapsed)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := os.Stat(marker); err == nil {
+		t.Fatalf("the hook's child outlived the timeout")
+	}
+}
+
+func TestHookOutputTruncated(t *testing.T) {
+	svc, buf := hookService(t, Settings{HookOutputLimit: 20})
+	res := svc.runHook(context.Background(), "post-scan", "docs", "for i in 1 2 3 4 5 6 7 8 9; do echo line$i; done", time.Second, nil)
+	if res.Err != nil || res.FirstLine != "line1" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "stdout: line3") || strings.Contains(out, "line4") {
+		t.Fatalf("expected three lines (18 bytes) to fit the limit:\n%s", out)
+	}
+	if !strings.Contains(out, "output truncated after 20 bytes (ST_HOOK_OUTPUT_LIMIT); 36 more not logged") {
+		t.Fatalf("expected a truncation note:\n%s", out)
+	}
+}
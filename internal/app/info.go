@@ -0,0 +1,99 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+// processStart is when the process started, as reported by /api/info.
+var processStart = time.Now()
+
+// buildInfo identifies the running binary.
+type buildInfo struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision,omitempty"`
+	Modified  bool   `json:"modified,omitempty"` // built from a tree with uncommitted changes
+	GoVersion string `json:"goVersion"`
+}
+
+// readBuildInfo reads the module version and VCS stamp Go embeds in the binary.
+// Binaries built from a checkout report "(devel)" with the revision they were
+// built from.
+func readBuildInfo() buildInfo {
+	info := buildInfo{Version: "unknown", GoVersion: runtime.Version()}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	if bi.Main.Version != "" {
+		info.Version = bi.Main.Version
+	}
+	for _, kv := range bi.Settings {
+		switch kv.Key {
+		case "vcs.revision":
+			info.Revision = kv.Value
+		case "vcs.modified":
+			info.Modified = kv.Value == "true"
+		}
+	}
+	return info
+}
+
+// syncthingInfo is what an instance reported about itself at startup.
+type syncthingInfo struct {
+	Instance string `json:"instance"`
+	Version  string `json:"version,omitempty"`
+	DeviceID string `json:"deviceID,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// discoverSyncthing asks every instance for its version and device ID in the
+// background, for /api/info. An instance that does not answer is not asked again.
+func (s *Service) discoverSyncthing(ctx context.Context) {
+	for _, inst := range s.instances() {
+		s.watchers.Add(1)
+		go func() {
+			defer s.watchers.Done()
+			info := syncthingInfo{Instance: instanceName(inst)}
+			client := s.client(inst)
+			st, _, err := client.SystemStatus(ctx, 10*time.Second)
+			if err == nil {
+				var v syncthing.SystemVersion
+				v, _, err = client.SystemVersion(ctx, 10*time.Second)
+				info.Version, info.DeviceID = v.Version, st.MyID
+			}
+			if err != nil {
+				info.Error = err.Error()
+			}
+			s.discovered.Store(inst, info)
+		}()
+	}
+}
+
+// handleInfo serves /api/info: what is running, since when, with which settings and
+// against which Syncthing, and how healthy it is.
+func (s *Service) handleInfo(w http.ResponseWriter, r *http.Request) {
+	var instances []syncthingInfo
+	for _, inst := range s.instances() {
+		info := syncthingInfo{Instance: instanceName(inst), Error: "not discovered yet"}
+		if v, ok := s.discovered.Load(inst); ok {
+			info = v.(syncthingInfo)
+		}
+		instances = append(instances, info)
+	}
+	uptime := time.Since(processStart)
+	writeAPIJSON(w, http.StatusOK, map[string]any{
+		"build":         readBuildInfo(),
+		"started":       processStart.UTC(),
+		"uptime":        uptime.Round(time.Second).String(),
+		"uptimeSeconds": int64(uptime.Seconds()),
+		"config":        s.Settings.Redacted(),
+		"syncthing":     instances,
+		"health":        s.updateHealthLevel(r.Context()),
+	})
+}
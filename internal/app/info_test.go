@@ -0,0 +1,61 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestInfoReportsBuildSyncthingAndRedactedConfig(t *testing.T) {
+	const (
+		key      = "s3cr3t-api-key-0123456789abcdef"
+		otherKey = "other-instance-key-9876543210"
+		password = "gui-password-hunter2"
+		token    = "admin-token-correct-horse"
+		hook     = "T0001/B0002/webhook-secret-path"
+	)
+	fake := newFakeSyncthing(t, "docs")
+	svc := fake.service(t, Settings{
+		APIURL:      "https://kicker:" + password + "@nas:8384/?apikey=" + key,
+		APIKey:      key,
+		GUIPassword: password,
+		AdminToken:  token,
+		Instances:   []InstanceSettings{{Name: "laptop", APIURL: "https://laptop:8384/" + otherKey, APIKey: otherKey}},
+		NotifySinks: []NotifySinkSettings{{Name: "slack", Type: "slack", URL: "https://hooks.slack.com/services/" + hook}},
+	})
+	svc.discoverSyncthing(context.Background())
+	svc.watchers.Wait()
+
+	rec := adminRequest(t, svc.adminHandler(context.Background(), make(chan struct{}, 1)), http.MethodGet, "/api/info", token, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	body := rec.Body.String()
+	for _, secret := range []string{key, otherKey, password, token, hook, "webhook-secret"} {
+		if strings.Contains(body, secret) {
+			t.Fatalf("secret %q leaked into /api/info:\n%s", secret, body)
+		}
+	}
+
+	var info struct {
+		Build     buildInfo       `json:"build"`
+		Syncthing []syncthingInfo `json:"syncthing"`
+		Config    Settings        `json:"config"`
+		Health    HealthLevel     `json:"health"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if info.Build.GoVersion != runtime.Version() || info.Health.Level == "" {
+		t.Fatalf("unexpected build or health: %+v, %+v", info.Build, info.Health)
+	}
+	if len(info.Syncthing) != 1 || info.Syncthing[0] != (syncthingInfo{Instance: defaultInstance, Version: "v1.27.0", DeviceID: "FAKE"}) {
+		t.Fatalf("unexpected Syncthing info: %+v", info.Syncthing)
+	}
+	if info.Config.APIKey != "***************************cdef" || info.Config.NotifySinks[0].URL != "https://hooks.slack.com/********" {
+		t.Fatalf("unexpected redacted config: %q, %q", info.Config.APIKey, info.Config.NotifySinks[0].URL)
+	}
+}
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+// defaultInstance names the Syncthing instance configured by ST_API_URL / ST_API_KEY.
+// Folder references without an instance prefix target it.
+const defaultInstance = "default"
+
+// splitRef splits a folder reference like "nas/media" into instance and folder ID. The
+// prefix only counts as an instance when it names a configured one, so folder IDs that
+// happen to contain '/' keep working. The default instance is returned as "".
+func (s *Service) splitRef(ref string) (instance, folder string) {
+	if i := strings.IndexByte(ref, '/'); i > 0 {
+		name := ref[:i]
+		if name == defaultInstance {
+			return "", ref[i+1:]
+		}
+		if _, ok := s.Instances[name]; ok {
+			return name, ref[i+1:]
+		}
+	}
+	return "", ref
+}
+
+// joinRef is the inverse of splitRef; default-instance folders stay unprefixed.
+func joinRef(instance, folder string) string {
+	if instance == "" || instance == defaultInstance {
+		return folder
+	}
+	return instance + "/" + folder
+}
+
+// instanceName returns the display name of an instance ("" is the default instance).
+func instanceName(instance string) string {
+	if instance == "" {
+		return defaultInstance
+	}
+	return instance
+}
+
+// client returns the Syncthing client for an instance ("" is the default instance).
+func (s *Service) client(instance string) *syncthing.Client {
+	if instance == "" {
+		return s.Client
+	}
+	return s.Instances[instance]
+}
+
+// instances lists the default instance ("") followed by named instances in order.
+func (s *Service) instances() []string {
+	out := []string{""}
+	names := make([]string, 0, len(s.Instances))
+	for name := range s.Instances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append(out, names...)
+}
+
+// groupByInstance splits folder references by instance, keeping their order.
+func (s *Service) groupByInstance(refs []string) (order []string, groups map[string][]string) {
+	groups = map[string][]string{}
+	for _, ref := range refs {
+		inst, _ := s.splitRef(ref)
+		if _, ok := groups[inst]; !ok {
+			order = append(order, inst)
+		}
+		groups[inst] = append(groups[inst], ref)
+	}
+	return order, groups
+}
+
+// forEachInstance runs fn concurrently for every instance group so one unreachable
+// instance cannot hold up the others, and waits for all of them.
+func (s *Service) forEachInstance(refs []string, fn func(refs []string)) {
+	order, groups := s.groupByInstance(refs)
+	if len(order) == 1 {
+		fn(groups[order[0]])
+		return
+	}
+	var wg sync.WaitGroup
+	for _, inst := range order {
+		wg.Add(1)
+		go func(refs []string) {
+			defer wg.Done()
+			fn(refs)
+		}(groups[inst])
+	}
+	wg.Wait()
+}
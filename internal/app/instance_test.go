@@ -0,0 +1,117 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+// multiInstanceService wires fakes into one Service: def is the default instance and
+// named ones are registered under their map keys.
+func multiInstanceService(t *testing.T, settings Settings, def *fakeSyncthing, named map[string]*fakeSyncthing) *Service {
+	t.Helper()
+	svc := def.service(t, settings)
+	svc.Instances = map[string]*syncthing.Client{}
+	for name, f := range named {
+		c, err := syncthing.NewClient(f.srv.URL, "test-key", syncthing.ClientOptions{})
+		if err != nil {
+			t.Fatalf("new client: %v", err)
+		}
+		svc.Instances[name] = c
+	}
+	return svc
+}
+
+func TestSplitRef(t *testing.T) {
+	svc := &Service{Instances: map[string]*syncthing.Client{"nas": nil}}
+	tests := []struct {
+		ref, inst, folder string
+	}{
+		{"docs", "", "docs"},
+		{"nas/media", "nas", "media"},
+		{"nas/*", "nas", "*"},
+		{"default/docs", "", "docs"},
+		{"other/docs", "", "other/docs"}, // not a configured instance
+		{"*", "", "*"},
+	}
+	for _, tt := range tests {
+		inst, folder := svc.splitRef(tt.ref)
+		if inst != tt.inst || folder != tt.folder {
+			t.Fatalf("splitRef(%q) = %q, %q; want %q, %q", tt.ref, inst, folder, tt.inst, tt.folder)
+		}
+	}
+	if got := joinRef("nas", "media"); got != "nas/media" {
+		t.Fatalf("joinRef = %q", got)
+	}
+	if got := joinRef("", "docs"); got != "docs" {
+		t.Fatalf("joinRef = %q", got)
+	}
+}
+
+func TestTriggerScansRoutesByInstancePrefix(t *testing.T) {
+	def := newFakeSyncthing(t, "docs")
+	nas := newFakeSyncthing(t, "media", "docs")
+	// One worker per instance keeps each instance's triggers in order.
+	svc := multiInstanceService(t, Settings{ScanWorkers: 1}, def, map[string]*fakeSyncthing{"nas": nas})
+
+	pending := make(chan struct{}, 16)
+	_ = svc.triggerScans(context.Background(), "test", []string{"docs", "nas/media", "nas/*"}, pending)
+
+	if got := strings.Join(def.scanned(), ","); got != "docs" {
+		t.Fatalf("default instance scans = %q", got)
+	}
+	// nas/* expands to the nas folders not already listed.
+	if got := strings.Join(nas.scanned(), ","); got != "media,docs" {
+		t.Fatalf("nas instance scans = %q", got)
+	}
+}
+
+func TestUnreachableInstanceDoesNotBlockOthers(t *testing.T) {
+	def := newFakeSyncthing(t, "docs")
+	down := newFakeSyncthing(t, "media")
+	down.srv.Close()
+	svc := multiInstanceService(t, Settings{}, def, map[string]*fakeSyncthing{"down": down})
+
+	start := time.Now()
+	pending := make(chan struct{}, 16)
+	_ = svc.triggerScans(context.Background(), "test", []string{"down/media", "docs"}, pending)
+
+	if got := strings.Join(def.scanned(), ","); got != "docs" {
+		t.Fatalf("default instance scans = %q", got)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("healthy instance was held up for %s", elapsed)
+	}
+	stats := map[string]FolderStats{}
+	for _, f := range svc.stats.snapshot() {
+		stats[f.Folder] = f
+	}
+	if stats["down/media"].LastResult != resultFailed || stats["docs"].LastResult != resultTriggered {
+		t.Fatalf("unexpected results: %+v", stats)
+	}
+}
+
+func TestWildcardStatusCheckPerInstance(t *testing.T) {
+	def := newFakeSyncthing(t, "docs")
+	nas := newFakeSyncthing(t, "media", "photos")
+	svc := multiInstanceService(t, Settings{}, def, map[string]*fakeSyncthing{"nas": nas})
+
+	_ = svc.checkSyncStatus(context.Background(), []string{"nas/*"}, 0)
+
+	if def.count("/rest/db/status") != 0 {
+		t.Fatalf("default instance should not be queried")
+	}
+	if got := nas.count("/rest/db/status"); got != 2 {
+		t.Fatalf("expected 2 status calls on nas, got %d", got)
+	}
+	folders := []string{}
+	for _, f := range svc.stats.snapshot() {
+		folders = append(folders, f.Folder)
+	}
+	if got := strings.Join(folders, ","); got != "nas/media,nas/photos" {
+		t.Fatalf("unexpected tracked folders: %s", got)
+	}
+}
@@ -0,0 +1,22 @@
+package app
+
+import "sync/atomic"
+
+// KeyRotated returns a syncthing.ClientOptions.OnKeyRotated hook for instance: it
+// logs the switch to a key re-read from ST_API_KEY_FILE and counts it for
+// /metrics and StatsD. Both keys arrive masked.
+func (s *Service) KeyRotated(instance string) func(from, to string) {
+	return func(from, to string) {
+		n, _ := s.keyRotations.LoadOrStore(instance, new(atomic.Int64))
+		n.(*atomic.Int64).Add(1)
+		s.StatsD.Count("api.key_rotations", 1, statsdTag{"instance", instance})
+		s.Logger.Printf("Instance %s: Syncthing refused API key %s; switched to %s from ST_API_KEY_FILE", instance, from, to)
+	}
+}
+
+func (s *Service) keyRotationCount(instance string) int64 {
+	if n, ok := s.keyRotations.Load(instance); ok {
+		return n.(*atomic.Int64).Load()
+	}
+	return 0
+}
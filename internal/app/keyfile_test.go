@@ -0,0 +1,115 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+func TestRotatedAPIKeyIsReloadedFromFile(t *testing.T) {
+	var mu sync.Mutex
+	accepted, requests := "old-key-0001", 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if r.Header.Get("X-API-Key") != accepted {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		writeJSON(w, syncthing.SystemStatus{MyID: "FAKE"})
+	}))
+	defer srv.Close()
+	rotate := func(key string) {
+		mu.Lock()
+		defer mu.Unlock()
+		accepted, requests = key, 0
+	}
+
+	keyFile := filepath.Join(t.TempDir(), "apikey")
+	if err := os.WriteFile(keyFile, []byte("old-key-0001\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var logs bytes.Buffer
+	svc := &Service{Logger: log.New(&logs, "", 0)}
+	key, err := ReadKeyFile(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := syncthing.NewClient(srv.URL, key, syncthing.ClientOptions{
+		ReloadKey:    func() (string, error) { return ReadKeyFile(keyFile) },
+		OnKeyRotated: svc.KeyRotated("default"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.Client = client
+	ctx := context.Background()
+
+	// The secrets manager rotates the key: the refused request is retried with it.
+	rotate("new-key-0002")
+	if err := os.WriteFile(keyFile, []byte("new-key-0002\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := client.SystemStatus(ctx, time.Second); err != nil {
+		t.Fatalf("expected the request to succeed with the new key: %v", err)
+	}
+	if requests != 2 || svc.keyRotationCount("default") != 1 {
+		t.Fatalf("expected one retry and one rotation, got %d requests, %d rotations", requests, svc.keyRotationCount("default"))
+	}
+	if got := logs.String(); !strings.Contains(got, "refused API key ********0001; switched to ********0002") || strings.Contains(got, "new-key") {
+		t.Fatalf("expected the rotation logged with masked keys:\n%s", got)
+	}
+
+	// An unchanged file is a genuine auth problem: no retry, the 403 is returned.
+	rotate("other-key-0003")
+	_, _, err = client.SystemStatus(ctx, time.Second)
+	var apiErr *syncthing.APIError
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusForbidden {
+		t.Fatalf("expected a 403 error, got %v", err)
+	}
+	if requests != 1 || svc.keyRotationCount("default") != 1 {
+		t.Fatalf("expected no retry or rotation, got %d requests, %d rotations", requests, svc.keyRotationCount("default"))
+	}
+
+	var metrics strings.Builder
+	svc.writeMetrics(&metrics)
+	if !strings.Contains(metrics.String(), `syncthing_kicker_api_key_rotations_total{instance="default"} 1`) {
+		t.Fatalf("expected the rotation counted in metrics:\n%s", metrics.String())
+	}
+}
+
+func TestLoadSettingsReadsAPIKeyFile(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "apikey")
+	if err := os.WriteFile(keyFile, []byte("  abc123\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	os.Clearenv()
+	os.Setenv("ST_CRON", "*/5 * * * *")
+	os.Setenv("ST_API_KEY_FILE", keyFile)
+	st, err := LoadSettingsFromEnv()
+	if err != nil || st.APIKey != "abc123" || st.APIKeyFile != keyFile {
+		t.Fatalf("unexpected settings %+v: %v", st, err)
+	}
+
+	os.Setenv("ST_API_KEY", "abc123")
+	if _, err := LoadSettingsFromEnv(); err == nil {
+		t.Fatalf("expected ST_API_KEY and ST_API_KEY_FILE to be refused together")
+	}
+	os.Unsetenv("ST_API_KEY")
+	os.Setenv("ST_API_KEY_FILE", filepath.Join(t.TempDir(), "missing"))
+	if _, err := LoadSettingsFromEnv(); err == nil {
+		t.Fatalf("expected a missing key file to be refused")
+	}
+}
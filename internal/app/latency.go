@@ -0,0 +1,149 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+// scanLatencyBuckets are the upper bounds, in seconds, of the
+// syncthing_kicker_scan_latency_seconds histogram.
+var scanLatencyBuckets = [...]float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600}
+
+// latencyHistogram counts a folder's scan latencies. Censored ones, whose folder
+// had not settled when ST_SCAN_LATENCY_BUDGET ran out, are only counted apart.
+type latencyHistogram struct {
+	buckets  [len(scanLatencyBuckets)]int64 // non-cumulative; the +Inf bucket is count
+	sum      float64
+	count    int64
+	censored int64
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	secs := d.Seconds()
+	for i, le := range scanLatencyBuckets {
+		if secs <= le {
+			h.buckets[i]++
+			break
+		}
+	}
+	h.sum += secs
+	h.count++
+}
+
+func (t *folderStats) recordLatency(folder string, d time.Duration, censored bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f := t.get(folder)
+	if censored {
+		f.latency.censored++
+		return
+	}
+	f.latency.observe(d)
+}
+
+// writeLatencyMetrics writes the scan latency histogram of folders.
+func writeLatencyMetrics(m *metricWriter, folders []FolderStats, labels func(FolderStats, ...string) []string) {
+	m.header("syncthing_kicker_scan_latency_seconds", "histogram", "Time from a scan trigger until the folder was idle again, needing no more than before (with ST_SCAN_LATENCY_BUDGET).")
+	for _, f := range folders {
+		h := f.latency
+		if h.count == 0 {
+			continue
+		}
+		var cum int64
+		for i, le := range scanLatencyBuckets {
+			cum += h.buckets[i]
+			m.sample("syncthing_kicker_scan_latency_seconds_bucket", float64(cum), labels(f, "le", strconv.FormatFloat(le, 'g', -1, 64))...)
+		}
+		m.sample("syncthing_kicker_scan_latency_seconds_bucket", float64(h.count), labels(f, "le", "+Inf")...)
+		m.sample("syncthing_kicker_scan_latency_seconds_sum", h.sum, labels(f)...)
+		m.sample("syncthing_kicker_scan_latency_seconds_count", float64(h.count), labels(f)...)
+	}
+	m.header("syncthing_kicker_scan_latency_censored_total", "counter", "Scans whose folder had not settled within ST_SCAN_LATENCY_BUDGET.")
+	for _, f := range folders {
+		if f.latency.censored > 0 {
+			m.sample("syncthing_kicker_scan_latency_censored_total", float64(f.latency.censored), labels(f)...)
+		}
+	}
+}
+
+// settledAfterScan reports whether st shows the folder back to idle after a scan
+// triggered at since, needing no more than the baseline it needed before.
+func settledAfterScan(st syncthing.FolderStatus, since time.Time, baseline int64) bool {
+	return st.State == "idle" && st.NeedBytes <= baseline && scanStarted(st, since)
+}
+
+// measureLatency follows the attempt after its status check until its folder has
+// settled, polling every ST_STATUS_DELAY, and records the time from the trigger:
+// to when Syncthing says the folder went idle, or else when a poll first saw it.
+// A folder still unsettled once ST_SCAN_LATENCY_BUDGET has passed records the
+// budget as a lower bound, flagged as censored. Polling stops when the kicker shuts
+// down; ctx only lends its run ID.
+func (a *scanAttempt) measureLatency(ctx context.Context) {
+	s := a.run.s
+	budget := s.Settings.ScanLatencyBudget
+	if budget <= 0 || !a.baselineOK || (a.result != resultTriggered && a.result != resultTimeout) {
+		return
+	}
+	interval := max(time.Duration(s.Settings.StatusDelaySec*float64(time.Second)), time.Second)
+	deadline := a.triggered.Add(budget)
+	ctx, cancel := context.WithDeadline(withRunID(s.serviceContext(), runIDFrom(ctx)), deadline)
+	defer cancel()
+
+	st, seenAt := a.lastStatus()
+	for seenAt.IsZero() || !settledAfterScan(st, a.triggered, a.baseline) {
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			a.recordLatency(ctx, budget, true)
+			return
+		}
+		t := time.NewTimer(min(interval, wait))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				a.recordLatency(ctx, budget, true)
+			}
+			return
+		case <-t.C:
+		}
+		if fresh, err := s.folderStatus(ctx, a.folder, 10*time.Second, true); err == nil {
+			st, seenAt = fresh, time.Now()
+		}
+	}
+	at := seenAt
+	if st.StateChanged.After(a.triggered) && st.StateChanged.Before(seenAt) {
+		at = st.StateChanged
+	}
+	a.recordLatency(ctx, at.Sub(a.triggered), false)
+}
+
+// recordLatency adds the attempt's latency to the run history, metrics and StatsD,
+// warning past ST_SCAN_LATENCY_WARN.
+func (a *scanAttempt) recordLatency(ctx context.Context, d time.Duration, censored bool) {
+	s := a.run.s
+	a.run.update(a.index, func(f *RunFolderResult) {
+		f.LatencyMs, f.LatencyCensored = d.Milliseconds(), censored
+	})
+	s.stats.recordLatency(a.folder, d, censored)
+	tags := s.folderTags(a.folder)
+	if censored {
+		s.StatsD.Count("scan.latency_censored", 1, tags...)
+	} else {
+		s.StatsD.Timing("scan.latency", d, tags...)
+	}
+
+	what := fmt.Sprintf("settled %s after the scan trigger", d.Round(time.Second))
+	if censored {
+		what = fmt.Sprintf("had not settled %s after the scan trigger (ST_SCAN_LATENCY_BUDGET)", d.Round(time.Second))
+	}
+	if warn := s.Settings.ScanLatencyWarn; warn > 0 && d > warn {
+		s.log(ctx).Printf("Warning: folder '%s'%s %s, over ST_SCAN_LATENCY_WARN (%s)", a.folder, s.labelSuffix(a.folder), what, warn)
+		return
+	}
+	s.log(ctx).Printf("%s: %s (attempt %d)", a.folder, what, a.attempt)
+}
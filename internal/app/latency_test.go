@@ -0,0 +1,89 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+func TestScanLatencyMeasuredUntilSettled(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	fake.setStatus("docs", syncthing.FolderStatus{State: "idle", NeedBytes: 100, StateChanged: time.Now().Add(-time.Hour)})
+	var logs syncBuffer
+	svc := fake.service(t, Settings{ScanLatencyBudget: 5 * time.Second, ScanLatencyWarn: 100 * time.Millisecond})
+	svc.Logger = log.New(&logs, "", 0)
+
+	// The scan finishes 200ms in, needing less than before.
+	time.AfterFunc(200*time.Millisecond, func() {
+		fake.setStatus("docs", syncthing.FolderStatus{State: "idle", NeedBytes: 50, StateChanged: time.Now()})
+	})
+	_ = svc.triggerScans(context.Background(), "global", []string{"docs"}, nil)
+	svc.statusChecks.Wait()
+
+	f := svc.lastRun("global").Folders[0]
+	if f.LatencyCensored || f.LatencyMs < 150 || f.LatencyMs > 900 {
+		t.Fatalf("expected a latency of about 200ms from Syncthing's state change, got %+v", f)
+	}
+	if !strings.Contains(logs.String(), "Warning: folder 'docs' settled 0s after the scan trigger, over ST_SCAN_LATENCY_WARN (100ms)") {
+		t.Fatalf("expected a latency warning in log:\n%s", logs.String())
+	}
+	var buf bytes.Buffer
+	svc.writeMetrics(&buf)
+	for _, want := range []string{
+		`syncthing_kicker_scan_latency_seconds_bucket{folder="docs",instance="default",le="1"} 1`,
+		`syncthing_kicker_scan_latency_seconds_count{folder="docs",instance="default"} 1`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("expected %q in metrics:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestScanLatencyCensoredAtBudget(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	fake.setStatus("docs", syncthing.FolderStatus{State: "syncing", NeedBytes: 100, StateChanged: time.Now().Add(-time.Hour)})
+	svc := fake.service(t, Settings{ScanLatencyBudget: 300 * time.Millisecond})
+
+	_ = svc.triggerScans(context.Background(), "global", []string{"docs"}, nil)
+	svc.statusChecks.Wait()
+
+	f := svc.lastRun("global").Folders[0]
+	if !f.LatencyCensored || f.LatencyMs != 300 {
+		t.Fatalf("expected the budget recorded as censored, got %+v", f)
+	}
+	var buf bytes.Buffer
+	svc.writeMetrics(&buf)
+	if !strings.Contains(buf.String(), `syncthing_kicker_scan_latency_censored_total{folder="docs",instance="default"} 1`) ||
+		strings.Contains(buf.String(), "syncthing_kicker_scan_latency_seconds_count") {
+		t.Fatalf("expected only the censored count in metrics:\n%s", buf.String())
+	}
+}
+
+func TestScanLatencyStopsOnShutdown(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	fake.setStatus("docs", syncthing.FolderStatus{State: "syncing", NeedBytes: 100, StateChanged: time.Now().Add(-time.Hour)})
+	svc := fake.service(t, Settings{ScanLatencyBudget: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	svc.lifetime = ctx
+
+	_ = svc.triggerScans(context.Background(), "global", []string{"docs"}, nil)
+	time.AfterFunc(100*time.Millisecond, cancel)
+	done := make(chan struct{})
+	go func() {
+		svc.statusChecks.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("latency polling outlived the service context")
+	}
+	if f := svc.lastRun("global").Folders[0]; f.LatencyMs != 0 || f.LatencyCensored {
+		t.Fatalf("expected no latency recorded for an interrupted measurement, got %+v", f)
+	}
+}
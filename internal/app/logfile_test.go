@@ -0,0 +1,95 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestLogFileRotatesBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kicker.log")
+	l, err := OpenLogFile(path, 1, 2)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer l.Close()
+
+	line := strings.Repeat("x", 600<<10) + "\n" // two lines exceed 1 MiB
+	for i := 0; i < 4; i++ {
+		if _, err := l.Write([]byte(fmt.Sprintf("%d", i) + line)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	if got := readFile(t, path); !strings.HasPrefix(got, "3") {
+		t.Fatalf("expected current file to hold the newest line")
+	}
+	if got := readFile(t, path+".1"); !strings.HasPrefix(got, "2") {
+		t.Fatalf("expected .1 to hold the previous line")
+	}
+	if got := readFile(t, path+".2"); !strings.HasPrefix(got, "1") {
+		t.Fatalf("expected .2 to hold the oldest kept line")
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("expected at most 2 backups")
+	}
+}
+
+func TestLogFileConcurrentWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kicker.log")
+	l, err := OpenLogFile(path, 0, 0)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer l.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _ = l.Write([]byte(fmt.Sprintf("line %02d\n", i)))
+		}(i)
+	}
+	wg.Wait()
+	if got := strings.Count(readFile(t, path), "\n"); got != 20 {
+		t.Fatalf("expected 20 intact lines, got %d", got)
+	}
+}
+
+func TestLogFileReopenAfterExternalRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kicker.log")
+	l, err := OpenLogFile(path, 0, 0)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer l.Close()
+
+	_, _ = l.Write([]byte("before\n"))
+	if err := os.Rename(path, path+".old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Reopen(); err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	_, _ = l.Write([]byte("after\n"))
+
+	if got := readFile(t, path); got != "after\n" {
+		t.Fatalf("expected new file after reopen, got %q", got)
+	}
+	if got := readFile(t, path+".old"); got != "before\n" {
+		t.Fatalf("expected rotated file untouched, got %q", got)
+	}
+}
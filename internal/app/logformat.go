@@ -0,0 +1,230 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	logFormatPlain  = "plain"
+	logFormatPretty = "pretty"
+	logFormatJSON   = "json"
+
+	logColorAuto   = "auto"
+	logColorAlways = "always"
+	logColorNever  = "never"
+)
+
+// logEvent is one log line in structured form. Msg is the line exactly as the
+// plain format prints it; Folder, Text and Fields let other formats lay it out
+// differently without the call site knowing which format is active.
+type logEvent struct {
+	Msg    string
+	Folder string     // folder reference the line is about, if any
+	Label  string     // the folder's label, when known
+	Text   string     // short message without the folder, e.g. "scan triggered"
+	Fields []logField // structured values in display order
+	RunID  string     // run the line belongs to; set by Service.logEvent
+}
+
+type logField struct {
+	Key   string
+	Value any
+}
+
+// logBytes marks a field value as a byte count so formats can humanize it.
+type logBytes int64
+
+// logFormatter renders a logEvent as a single line (without the timestamp prefix,
+// which the logger adds).
+type logFormatter interface {
+	format(ev logEvent) string
+}
+
+// plainFormatter keeps the historical printf output so existing log parsers work.
+type plainFormatter struct{}
+
+func (plainFormatter) format(ev logEvent) string { return ev.Msg }
+
+// prettyFormatter right-aligns folder references, humanizes byte counts and,
+// when color is set, colorizes folder states.
+type prettyFormatter struct {
+	color bool
+
+	mu    sync.Mutex
+	width int // widest folder reference seen so far
+}
+
+func (f *prettyFormatter) format(ev logEvent) string {
+	if ev.Folder == "" || ev.Text == "" {
+		return ev.Msg
+	}
+	folder := ev.Folder
+	if ev.Label != "" {
+		folder += " (" + ev.Label + ")"
+	}
+	f.mu.Lock()
+	if len(folder) > f.width {
+		f.width = len(folder)
+	}
+	width := f.width
+	f.mu.Unlock()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%*s  %s", width, folder, ev.Text)
+	for _, field := range ev.Fields {
+		b.WriteString("  ")
+		b.WriteString(field.Key)
+		b.WriteString(" ")
+		b.WriteString(f.value(field))
+	}
+	return b.String()
+}
+
+func (f *prettyFormatter) value(field logField) string {
+	switch v := field.Value.(type) {
+	case logBytes:
+		return formatBytes(int64(v))
+	case string:
+		if field.Key == "state" && f.color {
+			return colorState(v)
+		}
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// colorState wraps a Syncthing folder state in an ANSI color: idle green,
+// syncing/scanning yellow, error red.
+func colorState(state string) string {
+	code := ""
+	switch {
+	case state == "idle":
+		code = "32"
+	case strings.HasPrefix(state, "sync"), strings.HasPrefix(state, "scan"):
+		code = "33"
+	case strings.Contains(state, "error"):
+		code = "31"
+	default:
+		return state
+	}
+	return "\x1b[" + code + "m" + state + "\x1b[0m"
+}
+
+// stdoutIsTerminal reports whether stdout is a TTY; a variable so tests can stub it.
+var stdoutIsTerminal = func() bool {
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// jsonFormatter renders each event as a JSON object: the message without the
+// folder, then folder, label and run ID as fields of their own, then the event's
+// fields with byte counts as plain numbers. The timestamp is added by JSONLogWriter.
+type jsonFormatter struct{}
+
+func (jsonFormatter) format(ev logEvent) string {
+	var b bytes.Buffer
+	add := func(key string, v any) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			data, _ = json.Marshal(fmt.Sprint(v))
+		}
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		k, _ := json.Marshal(strings.ReplaceAll(key, " ", "_"))
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(data)
+	}
+	msg := ev.Msg
+	if ev.Folder != "" && ev.Text != "" {
+		msg = ev.Text
+	}
+	add("msg", msg)
+	if ev.Folder != "" {
+		add("folder", ev.Folder)
+	}
+	if ev.Label != "" {
+		add("label", ev.Label)
+	}
+	if ev.RunID != "" {
+		add("run", ev.RunID)
+	}
+	for _, f := range ev.Fields {
+		add(f.Key, f.Value)
+	}
+	return "{" + b.String() + "}"
+}
+
+// jsonLinePrefix starts every line jsonFormatter renders.
+const jsonLinePrefix = `{"msg":`
+
+// JSONLogWriter turns the lines a logger without flags writes into JSON objects
+// for ST_LOG_FORMAT=json: lines from jsonFormatter get the time added, and any
+// other line becomes {"time":...,"msg":...}.
+func JSONLogWriter(w io.Writer) io.Writer {
+	return &jsonLogWriter{w: w, now: time.Now}
+}
+
+type jsonLogWriter struct {
+	w   io.Writer
+	now func() time.Time
+}
+
+func (j *jsonLogWriter) Write(p []byte) (int, error) {
+	line := strings.TrimSuffix(string(p), "\n")
+	ts, _ := json.Marshal(j.now().Format(time.RFC3339))
+	var out string
+	if strings.HasPrefix(line, jsonLinePrefix) {
+		out = `{"time":` + string(ts) + "," + line[1:]
+	} else {
+		msg, _ := json.Marshal(line)
+		out = `{"time":` + string(ts) + `,"msg":` + string(msg) + "}"
+	}
+	if _, err := io.WriteString(j.w, out+"\n"); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func newLogFormatter(settings Settings) logFormatter {
+	switch settings.LogFormat {
+	case logFormatJSON:
+		return jsonFormatter{}
+	case logFormatPretty:
+	default:
+		return plainFormatter{}
+	}
+	color := false
+	switch settings.LogColor {
+	case logColorAlways:
+		color = true
+	case logColorNever:
+	default:
+		// Escape codes would end up in the log file, so auto only colors a terminal
+		// we write to exclusively.
+		color = settings.LogFile == "" && stdoutIsTerminal()
+	}
+	return &prettyFormatter{color: color}
+}
+
+// logEvent writes ev through the configured log format. The JSON format carries
+// the run ID as a field rather than a prefix.
+func (s *Service) logEvent(ctx context.Context, ev logEvent) {
+	s.logFmtOnce.Do(func() { s.logFmt = newLogFormatter(s.Settings) })
+	if _, ok := s.logFmt.(jsonFormatter); ok {
+		ev.RunID = runIDFrom(ctx)
+		s.Logger.Print(s.logFmt.format(ev))
+		return
+	}
+	s.log(ctx).Print(s.logFmt.format(ev))
+}
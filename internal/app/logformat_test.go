@@ -0,0 +1,116 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+func TestPlainLogFormatKeepsHistoricalLines(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	fake.setStatus("docs", syncthing.FolderStatus{State: "idle", NeedBytes: 0, InSyncBytes: 2048})
+	svc := fake.service(t, Settings{})
+	var buf bytes.Buffer
+	svc.Logger = log.New(&buf, "", 0)
+
+	svc.triggerScans(context.Background(), "global", []string{"docs"}, nil)
+	svc.statusChecks.Wait()
+	if err := svc.checkSyncStatus(context.Background(), []string{"docs"}, 0); err != nil {
+		t.Fatalf("status check: %v", err)
+	}
+	for _, want := range []string{
+		"Triggered scan for folder 'docs'\n",
+		"Folder docs status: state=idle needBytes=0 inSyncBytes=2048\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("missing %q in:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestPrettyLogFormat(t *testing.T) {
+	f := &prettyFormatter{}
+	f.format(logEvent{Folder: "photos-archive", Text: "scan triggered"})
+	line := f.format(logEvent{
+		Folder: "docs", Text: "status",
+		Fields: []logField{{"state", "idle"}, {"need", logBytes(0)}, {"in sync", logBytes(3 << 20)}},
+	})
+	if want := "          docs  status  state idle  need 0 B  in sync 3.0 MiB"; line != want {
+		t.Fatalf("got %q, want %q", line, want)
+	}
+	if got := f.format(logEvent{Msg: "Scheduler starting"}); got != "Scheduler starting" {
+		t.Fatalf("events without a folder should fall back to Msg, got %q", got)
+	}
+
+	f.color = true
+	line = f.format(logEvent{Folder: "docs", Text: "status", Fields: []logField{{"state", "syncing"}}})
+	if !strings.Contains(line, "\x1b[33msyncing\x1b[0m") {
+		t.Fatalf("expected yellow syncing state, got %q", line)
+	}
+}
+
+func TestLogColorDetection(t *testing.T) {
+	orig := stdoutIsTerminal
+	t.Cleanup(func() { stdoutIsTerminal = orig })
+	stdoutIsTerminal = func() bool { return true }
+
+	cases := []struct {
+		settings Settings
+		color    bool
+	}{
+		{Settings{LogFormat: "pretty", LogColor: "auto"}, true},
+		{Settings{LogFormat: "pretty", LogColor: "auto", LogFile: "/tmp/kicker.log"}, false},
+		{Settings{LogFormat: "pretty", LogColor: "never"}, false},
+	}
+	for _, c := range cases {
+		f, ok := newLogFormatter(c.settings).(*prettyFormatter)
+		if !ok || f.color != c.color {
+			t.Fatalf("%+v: got %#v, want color=%v", c.settings, f, c.color)
+		}
+	}
+
+	stdoutIsTerminal = func() bool { return false }
+	if f := newLogFormatter(Settings{LogFormat: "pretty", LogColor: "always"}).(*prettyFormatter); !f.color {
+		t.Fatalf("always should force color")
+	}
+	if _, ok := newLogFormatter(Settings{}).(plainFormatter); !ok {
+		t.Fatalf("default should be plain")
+	}
+}
+
+func TestJSONLogFormat(t *testing.T) {
+	fake := newFakeSyncthing(t, "abcd-1234")
+	fake.setLabel("abcd-1234", "Documents")
+	fake.setStatus("abcd-1234", syncthing.FolderStatus{State: "idle", InSyncBytes: 2048})
+	svc := fake.service(t, Settings{LogFormat: "json"})
+	var buf bytes.Buffer
+	out := JSONLogWriter(&buf).(*jsonLogWriter)
+	out.now = func() time.Time { return time.Date(2024, 5, 1, 3, 0, 0, 0, time.UTC) }
+	svc.Logger = log.New(out, "", 0)
+
+	ctx := withRunID(context.Background(), "r1")
+	if err := svc.checkSyncStatus(ctx, []string{"*"}, 0); err != nil {
+		t.Fatalf("status check: %v", err)
+	}
+	svc.triggerScans(ctx, "global", []string{"abcd-1234"}, nil)
+	svc.statusChecks.Wait()
+	svc.Logger.Printf("Scheduler starting")
+	for _, want := range []string{
+		`{"time":"2024-05-01T03:00:00Z","msg":"status","folder":"abcd-1234","label":"Documents","run":"r1","state":"idle","need":0,"in_sync":2048}` + "\n",
+		`{"time":"2024-05-01T03:00:00Z","msg":"scan triggered","folder":"abcd-1234","label":"Documents","run":"r1"}` + "\n",
+		`{"time":"2024-05-01T03:00:00Z","msg":"abcd-1234: triggered (attempt 1)","run":"r1"}` + "\n",
+		`{"time":"2024-05-01T03:00:00Z","msg":"Scheduler starting"}` + "\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("missing %s in:\n%s", want, buf.String())
+		}
+	}
+	if _, ok := newLogFormatter(Settings{LogFormat: "json"}).(jsonFormatter); !ok {
+		t.Fatalf("expected the json format")
+	}
+}
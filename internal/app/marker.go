@@ -0,0 +1,66 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// runMarkerPollers starts one poller per ST_TRIGGER_FILES entry. Each runs until ctx ends.
+func (s *Service) runMarkerPollers(ctx context.Context, pending chan struct{}) {
+	for folder, path := range s.Settings.TriggerFiles {
+		s.watchers.Add(1)
+		go func(folder, path string) {
+			defer s.watchers.Done()
+			t := time.NewTicker(s.Settings.TriggerFilePoll)
+			defer t.Stop()
+			for {
+				s.checkMarker(ctx, folder, path, pending)
+				select {
+				case <-ctx.Done():
+					return
+				case <-t.C:
+				}
+			}
+		}(folder, path)
+	}
+}
+
+// checkMarker triggers a scan of folder when the marker file's mtime has advanced past
+// the last one recorded in the state file. Missing markers are ignored.
+func (s *Service) checkMarker(ctx context.Context, folder, path string, pending chan struct{}) {
+	info, err := os.Stat(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			s.logFailure(ctx, folder, "marker", err, "Cannot stat trigger file %s for folder '%s'%s: %v", path, folder, s.labelSuffix(folder), err)
+		}
+		return
+	}
+	s.logSuccess(ctx, folder, "marker")
+
+	mtime := info.ModTime().UTC()
+	if !mtime.After(s.stateStore().folder(folder).LastMarker) {
+		return
+	}
+
+	ctx, run := s.startRun(ctx, "marker:"+folder)
+	s.log(ctx).Printf("Trigger file %s updated at %s; triggering scan for folder '%s'%s", path, mtime.Format(time.RFC3339), folder, s.labelSuffix(folder))
+	attempt := run.scan(ctx, folder, "")
+	run.finish()
+	s.scheduleStatusCheck(ctx, attempt, pending)
+	result := attempt.result
+	if result == resultFailed {
+		return // retry on the next poll
+	}
+
+	if err := s.stateStore().updateFolder(folder, func(f *FolderState) { f.LastMarker = mtime }); err != nil {
+		s.Logger.Printf("Failed to save state: %v", err)
+	}
+	if s.Settings.TriggerFileConsume && (result == resultTriggered || result == resultTimeout) {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			s.Logger.Printf("Failed to remove trigger file %s: %v", path, err)
+		}
+	}
+}
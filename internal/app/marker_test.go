@@ -0,0 +1,85 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMarkerTriggersOncePerMtime(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(dir, ".done")
+	fake := newFakeSyncthing(t, "exports")
+	svc := fake.service(t, Settings{StateFile: filepath.Join(dir, "state.json")})
+	pending := make(chan struct{}, 16)
+
+	svc.checkMarker(context.Background(), "exports", marker, pending) // missing: tolerated
+	if got := fake.scanned(); len(got) != 0 {
+		t.Fatalf("expected no scan for missing marker, got %v", got)
+	}
+
+	if err := os.WriteFile(marker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	svc.checkMarker(context.Background(), "exports", marker, pending)
+	svc.checkMarker(context.Background(), "exports", marker, pending)
+	if got := fake.scanned(); len(got) != 1 {
+		t.Fatalf("expected one scan, got %v", got)
+	}
+
+	// A restarted service must not retrigger for the same mtime.
+	restarted := fake.service(t, Settings{StateFile: filepath.Join(dir, "state.json")})
+	restarted.checkMarker(context.Background(), "exports", marker, pending)
+	if got := fake.scanned(); len(got) != 1 {
+		t.Fatalf("expected no retrigger after restart, got %v", got)
+	}
+
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(marker, later, later); err != nil {
+		t.Fatal(err)
+	}
+	restarted.checkMarker(context.Background(), "exports", marker, pending)
+	if got := fake.scanned(); len(got) != 2 {
+		t.Fatalf("expected scan after mtime advanced, got %v", got)
+	}
+}
+
+func TestMarkerConsumedAfterTrigger(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(dir, ".done")
+	if err := os.WriteFile(marker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fake := newFakeSyncthing(t, "exports")
+	svc := fake.service(t, Settings{TriggerFileConsume: true})
+
+	svc.checkMarker(context.Background(), "exports", marker, make(chan struct{}, 16))
+
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Fatalf("expected marker to be removed, stat err=%v", err)
+	}
+	if got := fake.scanned(); len(got) != 1 {
+		t.Fatalf("expected one scan, got %v", got)
+	}
+}
+
+func TestMarkerRetriedAfterFailedTrigger(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(dir, ".done")
+	if err := os.WriteFile(marker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fake := newFakeSyncthing(t) // folder unknown: scan fails
+	svc := fake.service(t, Settings{TriggerFileConsume: true})
+
+	svc.checkMarker(context.Background(), "exports", marker, make(chan struct{}, 16))
+
+	if _, err := os.Stat(marker); err != nil {
+		t.Fatalf("expected marker to be kept after failure: %v", err)
+	}
+	if !svc.stateStore().folder("exports").LastMarker.IsZero() {
+		t.Fatalf("expected mtime not to be recorded after failure")
+	}
+}
@@ -0,0 +1,143 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// folderStates are the Syncthing folder states exported one-hot by
+// syncthing_kicker_folder_state; anything else is reported as "unknown".
+var folderStates = []string{
+	"idle", "scanning", "scan-waiting", "syncing", "sync-waiting", "sync-preparing",
+	"cleaning", "clean-waiting", "error", "unknown",
+}
+
+// handleMetrics serves per-folder metrics in the Prometheus text format. Series only
+// exist for folders we have tracked, and folders Syncthing no longer knows are dropped
+// from the stats, so label cardinality stays bounded.
+func (s *Service) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.writeMetrics(w)
+}
+
+func (s *Service) writeMetrics(w io.Writer) {
+	var folders []FolderStats
+	for _, f := range s.stats.snapshot() {
+		if _, id := s.splitRef(f.Folder); id != "*" {
+			folders = append(folders, f)
+		}
+	}
+	m := &metricWriter{w: w}
+	labels := func(f FolderStats, extra ...string) []string {
+		inst, _ := s.splitRef(f.Folder)
+		return append([]string{"folder", f.Folder, "instance", instanceName(inst)}, extra...)
+	}
+
+	m.header("syncthing_kicker_scans_total", "counter", "Scan triggers by folder and result.")
+	for _, f := range folders {
+		m.sample("syncthing_kicker_scans_total", float64(f.Scans), labels(f, "result", "ok")...)
+		m.sample("syncthing_kicker_scans_total", float64(f.Failures), labels(f, "result", "failed")...)
+		m.sample("syncthing_kicker_scans_total", float64(f.Skips), labels(f, "result", "skipped")...)
+		if f.UnknownFolder > 0 {
+			m.sample("syncthing_kicker_scans_total", float64(f.UnknownFolder), labels(f, "result", "unknown_folder")...)
+		}
+	}
+
+	m.header("syncthing_kicker_scan_timeouts_total", "counter", "Scan triggers that timed out, by folder (also counted in scans_total).")
+	for _, f := range folders {
+		m.sample("syncthing_kicker_scan_timeouts_total", float64(f.Timeouts), labels(f)...)
+	}
+
+	if s.Settings.ScanLatencyBudget > 0 {
+		writeLatencyMetrics(m, folders, labels)
+	}
+
+	m.header("syncthing_kicker_notifications_suppressed_total", "counter", "Notifications suppressed by ST_NOTIFY_COOLDOWN, by event type.")
+	for _, ev := range notifyEventTypes {
+		m.sample("syncthing_kicker_notifications_suppressed_total", float64(s.suppressed.get(ev)), "event", ev)
+	}
+
+	m.header("syncthing_kicker_api_key_rotations_total", "counter", "API keys re-read from ST_API_KEY_FILE after Syncthing refused the old one, by instance.")
+	for _, inst := range s.instances() {
+		m.sample("syncthing_kicker_api_key_rotations_total", float64(s.keyRotationCount(instanceName(inst))), "instance", instanceName(inst))
+	}
+
+	m.header("syncthing_kicker_panics_total", "counter", "Panics recovered in scheduled jobs and workers.")
+	m.sample("syncthing_kicker_panics_total", float64(s.panicCount.Load()))
+
+	m.header("syncthing_kicker_need_bytes", "gauge", "Bytes the folder still needs, as of the last status check.")
+	for _, f := range folders {
+		if !f.LastStatus.IsZero() {
+			m.sample("syncthing_kicker_need_bytes", float64(f.NeedBytes), labels(f)...)
+		}
+	}
+
+	m.header("syncthing_kicker_last_scan_timestamp_seconds", "gauge", "Unix time of the last scan trigger Syncthing accepted.")
+	for _, f := range folders {
+		if !f.LastScan.IsZero() {
+			m.sample("syncthing_kicker_last_scan_timestamp_seconds", float64(f.LastScan.Unix()), labels(f)...)
+		}
+	}
+
+	m.header("syncthing_kicker_next_scan_timestamp_seconds", "gauge", "Unix time of the next scheduled scan no rule holds back; absent when none is due within 8 days.")
+	plans := s.scanPlans()
+	for _, f := range folders {
+		if next := plans[f.Folder].Next; !next.IsZero() {
+			m.sample("syncthing_kicker_next_scan_timestamp_seconds", float64(next.Unix()), labels(f)...)
+		}
+	}
+
+	m.header("syncthing_kicker_syncthing_last_scan_timestamp_seconds", "gauge", "Unix time of Syncthing's last completed scan (with ST_STALE_SCAN_WARN).")
+	for _, f := range folders {
+		if !f.SyncthingLastScan.IsZero() {
+			m.sample("syncthing_kicker_syncthing_last_scan_timestamp_seconds", float64(f.SyncthingLastScan.Unix()), labels(f)...)
+		}
+	}
+
+	m.header("syncthing_kicker_folder_state", "gauge", "Last observed folder state (1 for the current state, 0 otherwise).")
+	for _, f := range folders {
+		if f.State == "" {
+			continue
+		}
+		current := f.State
+		if !slices.Contains(folderStates, current) {
+			current = "unknown"
+		}
+		for _, st := range folderStates {
+			v := 0.0
+			if st == current {
+				v = 1
+			}
+			m.sample("syncthing_kicker_folder_state", v, labels(f, "state", st)...)
+		}
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricWriter emits the Prometheus text exposition format.
+type metricWriter struct {
+	w io.Writer
+}
+
+func (m *metricWriter) header(name, typ, help string) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes one series; labels are alternating names and values.
+func (m *metricWriter) sample(name string, value float64, labels ...string) {
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+`="`+labelEscaper.Replace(labels[i+1])+`"`)
+	}
+	sort.Strings(pairs)
+	if len(pairs) > 0 {
+		name += "{" + strings.Join(pairs, ",") + "}"
+	}
+	fmt.Fprintf(m.w, "%s %s\n", name, strconv.FormatFloat(value, 'g', -1, 64))
+}
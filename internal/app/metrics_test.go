@@ -0,0 +1,80 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+func scrape(t *testing.T, svc *Service) string {
+	t.Helper()
+	rec := adminRequest(t, svc.adminHandler(context.Background(), make(chan struct{}, 1)), http.MethodGet, "/metrics", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("scrape failed: %d", rec.Code)
+	}
+	return rec.Body.String()
+}
+
+func TestMetricsPerFolder(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs", "photos")
+	fake.setStatus("photos", syncthing.FolderStatus{State: "syncing", NeedBytes: 1234})
+	svc := fake.service(t, Settings{})
+	pending := make(chan struct{}, 16)
+
+	_ = svc.triggerScans(context.Background(), "test", []string{"docs", "docs", "missing"}, pending)
+	_ = svc.checkSyncStatus(context.Background(), []string{"docs", "photos"}, 0)
+
+	out := scrape(t, svc)
+	for _, want := range []string{
+		`syncthing_kicker_scans_total{folder="docs",instance="default",result="ok"} 2`,
+		`syncthing_kicker_scans_total{folder="docs",instance="default",result="failed"} 0`,
+		`syncthing_kicker_need_bytes{folder="photos",instance="default"} 1234`,
+		`syncthing_kicker_folder_state{folder="photos",instance="default",state="syncing"} 1`,
+		`syncthing_kicker_folder_state{folder="photos",instance="default",state="idle"} 0`,
+		`syncthing_kicker_folder_state{folder="docs",instance="default",state="idle"} 1`,
+		`syncthing_kicker_last_scan_timestamp_seconds{folder="docs",instance="default"} `,
+		"# TYPE syncthing_kicker_scans_total counter",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `folder="missing"`) {
+		t.Fatalf("unknown folders must not create series:\n%s", out)
+	}
+}
+
+func TestMetricsDropFoldersRemovedFromSyncthing(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs", "old")
+	svc := fake.service(t, Settings{})
+
+	_ = svc.checkSyncStatus(context.Background(), []string{"*"}, 0)
+	if out := scrape(t, svc); !strings.Contains(out, `folder="old"`) {
+		t.Fatalf("expected series for old:\n%s", out)
+	}
+
+	fake.mu.Lock()
+	fake.folders = fake.folders[:1]
+	delete(fake.status, "old")
+	fake.mu.Unlock()
+	_ = svc.checkSyncStatus(context.Background(), []string{"*"}, 0)
+
+	out := scrape(t, svc)
+	if strings.Contains(out, `folder="old"`) {
+		t.Fatalf("expected series for removed folder to be deleted:\n%s", out)
+	}
+	if !strings.Contains(out, `folder="docs"`) {
+		t.Fatalf("expected docs series to remain:\n%s", out)
+	}
+}
+
+func TestMetricLabelEscaping(t *testing.T) {
+	var b strings.Builder
+	(&metricWriter{w: &b}).sample("m", 1, "folder", `a"b\c`)
+	if got := b.String(); got != `m{folder="a\"b\\c"} 1`+"\n" {
+		t.Fatalf("unexpected sample: %q", got)
+	}
+}
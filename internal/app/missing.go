@@ -0,0 +1,144 @@
+package app
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+// missingFolders remembers the folders Syncthing rejected as unknown, keyed by
+// normalized reference. Runs skip them until a fresh folder list of their instance
+// shows them again. The zero value is ready to use.
+type missingFolders struct {
+	mu       sync.Mutex
+	refs     map[string]bool
+	warned   map[string]int       // folder list generation each unlisted folder was last warned about
+	restored map[string]time.Time // when each folder was last re-admitted
+}
+
+// add reports whether ref was not already known to be missing. A rejection of a
+// request sent before ref was last re-admitted is out of date and ignored.
+func (m *missingFolders) add(ref string, asked time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.refs[ref] || asked.Before(m.restored[ref]) {
+		return false
+	}
+	if m.refs == nil {
+		m.refs = map[string]bool{}
+	}
+	m.refs[ref] = true
+	return true
+}
+
+// warnOnce reports whether ref has not been warned about for this folder list generation yet.
+func (m *missingFolders) warnOnce(ref string, generation int) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.warned[ref] == generation {
+		return false
+	}
+	if m.warned == nil {
+		m.warned = map[string]int{}
+	}
+	m.warned[ref] = generation
+	return true
+}
+
+func (m *missingFolders) has(ref string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.refs[ref]
+}
+
+// restore forgets the missing folders found reports as existing and returns them, sorted.
+func (m *missingFolders) restore(found func(ref string) bool) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []string
+	now := time.Now()
+	for ref := range m.refs {
+		if found(ref) {
+			delete(m.refs, ref)
+			if m.restored == nil {
+				m.restored = map[string]time.Time{}
+			}
+			m.restored[ref] = now
+			out = append(out, ref)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// missingRef normalizes a folder reference, so "default/docs" and "docs" match.
+func (s *Service) missingRef(ref string) string {
+	return joinRef(s.splitRef(ref))
+}
+
+// folderMissing handles Syncthing rejecting ref as an unknown folder in answer to a
+// request sent at asked: the folder list is refetched on next use, and the first
+// time the hint is logged and later runs skip ref.
+func (s *Service) folderMissing(ctx context.Context, ref, op string, asked time.Time, err error) {
+	inst, _ := s.splitRef(ref)
+	s.folderCacheFor(inst).invalidate()
+	if !s.missing.add(s.missingRef(ref), asked) {
+		return
+	}
+	s.log(ctx).Printf("Folder '%s' does not exist on instance %s (%s: %v); check ST_FOLDERS and ST_FOLDER_CRON. "+
+		"Skipping it until Syncthing's folder list shows it again", ref, instanceName(inst), op, err)
+}
+
+// folderFound re-admits the missing folders of instance that are in its fresh folder list.
+func (s *Service) folderFound(instance string, folders []syncthing.FolderConfig) {
+	known := make(map[string]bool, len(folders))
+	for _, f := range folders {
+		known[f.ID] = true
+	}
+	for _, ref := range s.missing.restore(func(ref string) bool {
+		inst, id := s.splitRef(ref)
+		return inst == instance && known[id]
+	}) {
+		s.Logger.Printf("Folder '%s' exists again on instance %s; scanning it from now on", ref, instanceName(instance))
+	}
+}
+
+// unknownFolder reports whether a run should skip ref as a folder Syncthing does not
+// have, rather than have Syncthing reject the scan. That is a folder it already
+// rejected, unless its instance's refreshed folder list (subject to
+// ST_CONFIG_CACHE_TTL) shows it again, or one missing from a fresh cached folder
+// list; the latter is warned about once per fetched list. Wildcards never are.
+func (s *Service) unknownFolder(ctx context.Context, ref string) bool {
+	inst, id := s.splitRef(ref)
+	if id == "*" {
+		return false
+	}
+	key := s.missingRef(ref)
+	if s.missing.has(key) {
+		_, _ = s.cachedFolders(ctx, inst)
+		if s.missing.has(key) {
+			return true
+		}
+	}
+	found, ok, generation := s.folderCacheFor(inst).lookup(id, s.Settings.ConfigCacheTTL)
+	if !ok || found {
+		return false
+	}
+	if s.missing.warnOnce(key, generation) {
+		s.log(ctx).Printf("Warning: folder '%s' is not in Syncthing's folder list on instance %s; skipping it (check ST_FOLDERS and ST_FOLDER_CRON)", ref, instanceName(inst))
+	}
+	return true
+}
+
+// skipUnknown records the attempt as unknown_folder without asking Syncthing.
+func (a *scanAttempt) skipUnknown(ctx context.Context) {
+	s := a.run.s
+	a.result = resultUnknownFolder
+	a.run.update(a.index, func(f *RunFolderResult) { f.Result = resultUnknownFolder })
+	s.stats.recordScan(a.folder, runIDFrom(ctx), resultUnknownFolder, nil)
+	s.statsdScan(a.folder, resultUnknownFolder, nil, 0)
+	s.log(ctx).Printf("%s: %s (attempt %d)", a.folder, a.result, a.attempt)
+}
@@ -0,0 +1,162 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+func TestClientRecognizesFolderNotFound(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		status int
+		body   string
+		want   bool
+	}{
+		{"v1.x scan", http.StatusInternalServerError, "no such folder\n", true},
+		{"v1.2x scan", http.StatusInternalServerError, `folder "abcd-1234" does not exist` + "\n", true},
+		{"status 404", http.StatusNotFound, "no such folder\n", true},
+		{"unknown folder", http.StatusNotFound, "Unknown folder\n", true},
+		{"folder config 404", http.StatusNotFound, "No folder with given ID\n", true},
+		{"server error", http.StatusInternalServerError, "internal server error\n", false},
+		{"folder paused", http.StatusInternalServerError, "folder is paused\n", false},
+		{"forbidden", http.StatusForbidden, "no such folder\n", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, strings.TrimSuffix(tc.body, "\n"), tc.status)
+			}))
+			defer srv.Close()
+			client, err := syncthing.NewClient(srv.URL, "test-key", syncthing.ClientOptions{})
+			if err != nil {
+				t.Fatalf("new client: %v", err)
+			}
+			_, err = client.PostScan(context.Background(), "abcd-1234", syncthing.ScanOptions{}, 0)
+			if got := errors.Is(err, syncthing.ErrFolderNotFound); got != tc.want {
+				t.Fatalf("errors.Is(%v, ErrFolderNotFound) = %v, want %v", err, got, tc.want)
+			}
+			if !strings.HasPrefix(err.Error(), "http error: ") {
+				t.Fatalf("expected Syncthing's message to be kept, got %q", err)
+			}
+		})
+	}
+}
+
+func TestMissingFolderIsSkippedUntilItExists(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	svc := fake.service(t, Settings{ScanWorkers: 1})
+	var buf syncBuffer
+	svc.Logger = log.New(&buf, "", 0)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		_ = svc.triggerScans(ctx, "global", []string{"docs", "gone"}, nil)
+	}
+	if got := strings.Join(fake.scanned(), ","); got != "docs,docs,docs" {
+		t.Fatalf("expected gone to be tried once, got %q", got)
+	}
+	if got := fake.count("/rest/db/scan"); got != 4 {
+		t.Fatalf("expected 4 scan requests, got %d", got)
+	}
+	if n := strings.Count(buf.String(), "Folder 'gone' does not exist on instance default"); n != 1 {
+		t.Fatalf("expected the hint logged once, got %d:\n%s", n, buf.String())
+	}
+	if !strings.Contains(buf.String(), "check ST_FOLDERS and ST_FOLDER_CRON") {
+		t.Fatalf("expected a configuration hint:\n%s", buf.String())
+	}
+
+	svc.statusChecks.Wait()
+	fake.mu.Lock()
+	fake.folders = append(fake.folders, syncthing.FolderConfig{ID: "gone"})
+	fake.status["gone"] = syncthing.FolderStatus{State: "idle"}
+	fake.mu.Unlock()
+	_ = svc.triggerScans(ctx, "global", []string{"docs", "default/gone"}, nil)
+	if got := strings.Join(fake.scanned(), ","); got != "docs,docs,docs,docs,gone" {
+		t.Fatalf("expected gone to be scanned once it exists, got %q", got)
+	}
+	if !strings.Contains(buf.String(), "Folder 'gone' exists again on instance default") {
+		t.Fatalf("expected the folder to be re-admitted:\n%s", buf.String())
+	}
+}
+
+func TestCheckOnceReportsMissingFolders(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	svc := fake.service(t, Settings{Folders: []string{"docs", "gone"}})
+	var buf bytes.Buffer
+	svc.Logger = log.New(&buf, "", 0)
+
+	report, err := svc.CheckOnce(context.Background(), svc.Folders())
+	if err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	results := report.Instances
+	if len(results) != 1 || results[0].Err != nil || strings.Join(results[0].Missing, ",") != "gone" {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+}
+
+func TestUnlistedFoldersSkippedFromCachedList(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	svc := fake.service(t, Settings{ConfigCacheTTL: time.Hour, ScanWorkers: 1})
+	var buf syncBuffer
+	svc.Logger = log.New(&buf, "", 0)
+	ctx := context.Background()
+	if _, err := svc.cachedFolders(ctx, ""); err != nil {
+		t.Fatalf("fill cache: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		_ = svc.triggerScans(ctx, "global", []string{"docs", "typo", "*"}, nil)
+	}
+	if got := strings.Join(fake.scanned(), ","); got != "docs,docs" {
+		t.Fatalf("expected typo never to be sent, got %q", got)
+	}
+	if run := svc.lastRun("global"); run.Folders[1].Folder != "typo" || run.Folders[1].Result != resultUnknownFolder {
+		t.Fatalf("expected unknown_folder in the run, got %+v", run.Folders)
+	}
+	if n := strings.Count(buf.String(), "Warning: folder 'typo' is not in Syncthing's folder list"); n != 1 {
+		t.Fatalf("expected one warning per folder list, got %d:\n%s", n, buf.String())
+	}
+	if out := scrape(t, svc); !strings.Contains(out, `syncthing_kicker_scans_total{folder="typo",instance="default",result="unknown_folder"} 2`) {
+		t.Fatalf("expected unknown_folder in metrics:\n%s", out)
+	}
+
+	// The folder is added in Syncthing and shows up once the list is refetched.
+	fake.mu.Lock()
+	fake.folders = append(fake.folders, syncthing.FolderConfig{ID: "typo"})
+	fake.status["typo"] = syncthing.FolderStatus{State: "idle"}
+	fake.mu.Unlock()
+	svc.InvalidateFolderCache()
+	if _, err := svc.cachedFolders(ctx, ""); err != nil {
+		t.Fatalf("refresh cache: %v", err)
+	}
+	_ = svc.triggerScans(ctx, "global", []string{"typo"}, nil)
+	if got := fake.scanned(); got[len(got)-1] != "typo" {
+		t.Fatalf("expected typo to be scanned after the refresh, got %v", got)
+	}
+}
+
+func TestMissingFolderIgnoresRejectionsOlderThanReadmission(t *testing.T) {
+	var m missingFolders
+	asked := time.Now()
+	if !m.add("/gone", asked) {
+		t.Fatal("expected the first rejection to mark the folder missing")
+	}
+	if got := m.restore(func(string) bool { return true }); len(got) != 1 {
+		t.Fatalf("expected the folder to be re-admitted, got %v", got)
+	}
+	if m.add("/gone", asked) || m.has("/gone") {
+		t.Fatal("a rejection sent before the re-admission marked the folder missing again")
+	}
+	if !m.add("/gone", time.Now()) {
+		t.Fatal("expected a later rejection to mark the folder missing")
+	}
+}
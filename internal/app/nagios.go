@@ -0,0 +1,125 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Nagios plugin exit codes.
+const (
+	NagiosOK       = 0
+	NagiosWarning  = 1
+	NagiosCritical = 2
+	NagiosUnknown  = 3
+)
+
+var nagiosStatus = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// Nagios renders the report in the Nagios plugin format: one status line with
+// performance data, followed by long text listing problem folders. It is CRITICAL
+// when an instance is unreachable or a folder is critical, WARNING when a folder is
+// out of sync, rated warning or stale (ST_STALE_SCAN_WARN), and UNKNOWN when
+// nothing could be checked or ST_RUN_DEADLINE cut the check short.
+func (r Report) Nagios() (string, int) {
+	code := NagiosOK
+	raise := func(c int) { code = max(code, c) }
+
+	var problems, details []string
+	for _, res := range r.Instances {
+		if res.Abandoned {
+			raise(NagiosUnknown)
+			problems = append(problems, fmt.Sprintf("instance %s not fully checked before ST_RUN_DEADLINE", res.Instance))
+			continue
+		}
+		if res.Err != nil {
+			raise(NagiosCritical)
+			problems = append(problems, fmt.Sprintf("instance %s unreachable", res.Instance))
+			details = append(details, fmt.Sprintf("%s: %v", res.Instance, res.Err))
+		}
+		for _, ref := range res.Missing {
+			raise(NagiosCritical)
+			problems = append(problems, fmt.Sprintf("folder %s not found", ref))
+			details = append(details, fmt.Sprintf("%s: no such folder on instance %s; check ST_FOLDERS and ST_FOLDER_CRON", ref, res.Instance))
+		}
+	}
+
+	var idle, syncing, pending, failed, stale int
+	var needTotal int64
+	var perf []string
+	for _, f := range r.Folders {
+		needTotal += f.NeedBytes
+		perf = append(perf, fmt.Sprintf("'%s_need_bytes'=%dB;;;0", f.Folder, f.NeedBytes))
+		state := f.State
+		if f.Error != "" {
+			state += " (" + f.Error + ")"
+		}
+		switch f.Class {
+		case classCritical:
+			failed++
+			raise(NagiosCritical)
+			details = append(details, fmt.Sprintf("%s: %s", f.Folder, state))
+		case classWarning:
+			syncing++
+			raise(NagiosWarning)
+			details = append(details, fmt.Sprintf("%s: %s", f.Folder, state))
+		case classOutOfSync:
+			syncing++
+			raise(NagiosWarning)
+			details = append(details, fmt.Sprintf("%s: %s, need %s%s", f.Folder, f.State, formatBytes(f.NeedBytes), needSuffix(f)))
+		case classPending:
+			idle++
+			pending++
+			details = append(details, fmt.Sprintf("%s: %s, pending %s", f.Folder, f.State, f.needBreakdown()))
+		default:
+			idle++
+		}
+		if f.Stale {
+			stale++
+			raise(NagiosWarning)
+			details = append(details, fmt.Sprintf("%s: last scanned %s", f.Folder, f.LastScan))
+		}
+	}
+	if failed > 0 {
+		problems = append(problems, fmt.Sprintf("%d in error", failed))
+	}
+	if syncing > 0 {
+		problems = append(problems, fmt.Sprintf("%d of %d not in sync", syncing, len(r.Folders)))
+	}
+	if stale > 0 {
+		problems = append(problems, fmt.Sprintf("%d not scanned recently", stale))
+	}
+	if pending > 0 && len(problems) > 0 {
+		problems = append(problems, fmt.Sprintf("%d with only deletes or metadata pending", pending))
+	}
+
+	summary := strings.Join(problems, ", ")
+	switch {
+	case len(r.Folders) == 0 && code == NagiosOK:
+		code, summary = NagiosUnknown, "no folders checked"
+	case summary == "" && pending > 0:
+		summary = fmt.Sprintf("%d folders idle, %d with only deletes or metadata pending", idle, pending)
+	case summary == "":
+		summary = fmt.Sprintf("%d folders idle", idle)
+	}
+	perf = append([]string{
+		fmt.Sprintf("folders=%d;;;0", len(r.Folders)),
+		fmt.Sprintf("idle=%d;;;0", idle),
+		fmt.Sprintf("out_of_sync=%d;;;0", syncing),
+		fmt.Sprintf("error=%d;;;0", failed),
+		fmt.Sprintf("need_bytes=%dB;;;0", needTotal),
+	}, perf...)
+
+	out := fmt.Sprintf("SYNCTHING %s - %s | %s", nagiosStatus[code], summary, strings.Join(perf, " "))
+	if len(details) > 0 {
+		out += "\n" + strings.Join(details, "\n")
+	}
+	return out, code
+}
+
+// needSuffix is " (3 files, 1200 deletes)" for a folder that needs items, or "".
+func needSuffix(f ReportFolder) string {
+	if b := f.needBreakdown(); b != "" {
+		return " (" + b + ")"
+	}
+	return ""
+}
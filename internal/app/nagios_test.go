@@ -0,0 +1,161 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+func TestNagiosReportStates(t *testing.T) {
+	up := []CheckResult{{Instance: "default"}}
+	cases := []struct {
+		name    string
+		results []CheckResult
+		folders []ReportFolder
+		states  map[string]string
+		files   bool // ST_CHECK_NEED=files
+		code    int
+		status  string
+		long    []string
+	}{
+		{
+			name:    "all idle",
+			results: up,
+			folders: []ReportFolder{{Folder: "docs", State: "idle"}, {Folder: "media", State: "idle"}},
+			code:    NagiosOK,
+			status:  "SYNCTHING OK - 2 folders idle | folders=2;;;0 idle=2;;;0 out_of_sync=0;;;0 error=0;;;0 need_bytes=0B;;;0 'docs_need_bytes'=0B;;;0 'media_need_bytes'=0B;;;0",
+		},
+		{
+			name:    "out of sync",
+			results: up,
+			folders: []ReportFolder{{Folder: "docs", State: "syncing", NeedBytes: 2048}, {Folder: "media", State: "idle"}},
+			code:    NagiosWarning,
+			status:  "SYNCTHING WARNING - 1 of 2 not in sync | folders=2;;;0 idle=1;;;0 out_of_sync=1;;;0 error=0;;;0 need_bytes=2048B;;;0 'docs_need_bytes'=2048B;;;0 'media_need_bytes'=0B;;;0",
+			long:    []string{"docs: syncing, need 2.0 KiB"},
+		},
+		{
+			name:    "stale",
+			results: up,
+			folders: []ReportFolder{{Folder: "docs", State: "idle", Stale: true, LastScan: "2024-01-02T03:04:05Z"}},
+			code:    NagiosWarning,
+			status:  "SYNCTHING WARNING - 1 not scanned recently |",
+			long:    []string{"docs: last scanned 2024-01-02T03:04:05Z"},
+		},
+		{
+			name:    "folder error",
+			results: up,
+			folders: []ReportFolder{{Folder: "docs", State: "error"}, {Folder: "media", State: "syncing", NeedBytes: 1}},
+			code:    NagiosCritical,
+			status:  "SYNCTHING CRITICAL - 1 in error, 1 of 2 not in sync |",
+			long:    []string{"docs: error", "media: syncing, need 1 B"},
+		},
+		{
+			name:    "folder error with its reason",
+			results: []CheckResult{{Instance: "default", Problems: []FolderProblem{{Folder: "docs", State: "error", Error: "folder path missing"}}}},
+			folders: []ReportFolder{{Folder: "docs", State: "error", Error: "folder path missing"}},
+			code:    NagiosCritical,
+			status:  "SYNCTHING CRITICAL - 1 in error |",
+			long:    []string{"docs: error (folder path missing)"},
+		},
+		{
+			name:    "stopped and unknown",
+			results: up,
+			folders: []ReportFolder{{Folder: "docs", State: "stopped"}, {Folder: "media"}},
+			code:    NagiosCritical,
+			status:  "SYNCTHING CRITICAL - 2 in error |",
+			long:    []string{"docs: stopped", "media: unknown"},
+		},
+		{
+			name:    "stopped on purpose",
+			results: up,
+			folders: []ReportFolder{{Folder: "docs", State: "stopped"}, {Folder: "media", State: "error"}},
+			states:  map[string]string{"stopped": "ok", "error": "warning"},
+			code:    NagiosWarning,
+			status:  "SYNCTHING WARNING - 1 of 2 not in sync |",
+			long:    []string{"media: error"},
+		},
+		{
+			name:    "unreachable",
+			results: []CheckResult{{Instance: "default"}, {Instance: "nas", Err: errors.New("connection refused")}},
+			folders: []ReportFolder{{Folder: "docs", State: "idle"}},
+			code:    NagiosCritical,
+			status:  "SYNCTHING CRITICAL - instance nas unreachable |",
+			long:    []string{"nas: connection refused"},
+		},
+		{
+			name:    "missing folder",
+			results: []CheckResult{{Instance: "default", Missing: []string{"gone"}}},
+			folders: []ReportFolder{{Folder: "docs", State: "idle"}},
+			code:    NagiosCritical,
+			status:  "SYNCTHING CRITICAL - folder gone not found |",
+			long:    []string{"gone: no such folder on instance default; check ST_FOLDERS and ST_FOLDER_CRON"},
+		},
+		{
+			name:    "deletes pending",
+			results: up,
+			folders: []ReportFolder{{Folder: "docs", State: "idle", NeedBytes: 153600, NeedDeletes: 1200}},
+			code:    NagiosWarning,
+			status:  "SYNCTHING WARNING - 1 of 1 not in sync |",
+			long:    []string{"docs: idle, need 150.0 KiB (1200 deletes)"},
+		},
+		{
+			name:    "deletes pending, files only",
+			results: up,
+			folders: []ReportFolder{{Folder: "docs", State: "idle", NeedBytes: 153600, NeedDeletes: 1200}, {Folder: "media", State: "idle", NeedBytes: 4096, NeedFiles: 3, NeedDeletes: 2}},
+			files:   true,
+			code:    NagiosWarning,
+			status:  "SYNCTHING WARNING - 1 of 2 not in sync, 1 with only deletes or metadata pending |",
+			long:    []string{"docs: idle, pending 1200 deletes", "media: idle, need 4.0 KiB (3 files, 2 deletes)"},
+		},
+		{
+			name:    "only deletes pending",
+			results: up,
+			folders: []ReportFolder{{Folder: "docs", State: "idle", NeedBytes: 153600, NeedDeletes: 1200}},
+			files:   true,
+			code:    NagiosOK,
+			status:  "SYNCTHING OK - 1 folders idle, 1 with only deletes or metadata pending |",
+			long:    []string{"docs: idle, pending 1200 deletes"},
+		},
+		{
+			name:    "nothing checked",
+			results: up,
+			code:    NagiosUnknown,
+			status:  "SYNCTHING UNKNOWN - no folders checked | folders=0;;;0",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, code := newReport(time.Time{}, time.Time{}, tc.results, tc.folders, tc.states, tc.files).Nagios()
+			if code != tc.code {
+				t.Fatalf("expected code %d, got %d: %s", tc.code, code, out)
+			}
+			lines := strings.Split(out, "\n")
+			if !strings.HasPrefix(lines[0], tc.status) {
+				t.Fatalf("unexpected status line %q, want prefix %q", lines[0], tc.status)
+			}
+			if got := lines[1:]; strings.Join(got, "\n") != strings.Join(tc.long, "\n") {
+				t.Fatalf("unexpected long text %q, want %q", got, tc.long)
+			}
+		})
+	}
+}
+
+func TestNagiosReportOnlyCountsThisCheck(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	fake.setStatus("docs", syncthing.FolderStatus{State: "syncing", NeedBytes: 10})
+	svc := fake.service(t, Settings{})
+	svc.stats.recordStatus("old", syncthing.FolderStatus{State: "error"})
+
+	report, err := svc.CheckOnce(context.Background(), svc.Folders())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, code := report.Nagios()
+	if code != NagiosWarning || !strings.HasPrefix(out, "SYNCTHING WARNING - 1 of 1 not in sync |") {
+		t.Fatalf("unexpected report %d: %s", code, out)
+	}
+}
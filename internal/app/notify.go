@@ -0,0 +1,290 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Notification event types.
+const (
+	eventScanFailed       = "scan_failed"
+	eventScanStillFailing = "scan_still_failing"
+	eventScanRecovered    = "scan_recovered"
+	eventFolderRecovered  = "folder_recovered"
+)
+
+// notifyEventTypes lists the event types ST_NOTIFY_ROUTES may name.
+var notifyEventTypes = []string{
+	eventScanFailed, eventScanStillFailing, eventScanRecovered, eventFolderRecovered, eventDigest, eventHealthChanged,
+	eventOverride, eventRevertCompleted, eventRevertFailed, eventVersionsOverThreshold,
+	eventDeviceAccepted, eventFolderAccepted, eventFolderAcceptConflict, eventDeviceAbsent,
+}
+
+// notifierTypes lists the sink types ST_NOTIFY_SINKS accepts.
+var notifierTypes = []string{"webhook", "ntfy", "gotify", "slack", "discord", "syslog"}
+
+// NotifyEvent is what notifiers receive. Fields carries event-specific structured
+// values (streak lengths, durations, ...) so sinks need not parse Message.
+type NotifyEvent struct {
+	Type     string         `json:"type"`
+	Time     time.Time      `json:"time"`
+	Folder   string         `json:"folder,omitempty"`
+	Label    string         `json:"label,omitempty"` // the folder's label, when known
+	Instance string         `json:"instance,omitempty"`
+	Severity string         `json:"severity,omitempty"` // info, warning or critical
+	Title    string         `json:"title,omitempty"`
+	Message  string         `json:"message"`
+	Fields   map[string]any `json:"fields,omitempty"`
+}
+
+// Notifier delivers events to an external sink.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, ev NotifyEvent) error
+}
+
+// notifyTimeout bounds a single delivery unless the sink sets its own.
+var notifyTimeout = 10 * time.Second
+
+// NewNotifier builds the notifier for a configured sink.
+func NewNotifier(sink NotifySinkSettings) (Notifier, error) {
+	switch sink.Type {
+	case "webhook":
+		return &WebhookNotifier{SinkName: sink.Name, URL: sink.URL, Timeout: sink.Timeout, Client: &http.Client{}}, nil
+	case "ntfy":
+		return &NtfyNotifier{SinkName: sink.Name, URL: sink.URL, Timeout: sink.Timeout, Client: &http.Client{}}, nil
+	case "gotify":
+		return &GotifyNotifier{SinkName: sink.Name, URL: sink.URL, Timeout: sink.Timeout, Client: &http.Client{}}, nil
+	case "syslog":
+		return &SyslogNotifier{SinkName: sink.Name, URL: sink.URL, Timeout: sink.Timeout}, nil
+	case "slack":
+		return &SlackNotifier{SinkName: sink.Name, URL: sink.URL, Channel: sink.Channel, Username: sink.Username, Timeout: sink.Timeout, Client: &http.Client{}}, nil
+	case "discord":
+		return &DiscordNotifier{SinkName: sink.Name, URL: sink.URL, Timeout: sink.Timeout, Client: &http.Client{}}, nil
+	default:
+		return nil, fmt.Errorf("unknown notifier type %q", sink.Type)
+	}
+}
+
+// routeNotifiers returns the notifiers ev is routed to. Without routes every
+// notifier receives every event; otherwise a notifier receives the event if any
+// route matching its type and folder names it.
+func (s *Service) routeNotifiers(ev NotifyEvent) []Notifier {
+	if len(s.Settings.NotifyRoutes) == 0 {
+		return s.Notifiers
+	}
+	want := map[string]bool{}
+	for _, r := range s.Settings.NotifyRoutes {
+		if (slices.Contains(r.Events, "*") || slices.Contains(r.Events, ev.Type)) && s.routeCoversFolder(r, ev) {
+			for _, sink := range r.Sinks {
+				want[sink] = true
+			}
+		}
+	}
+	var out []Notifier
+	for _, n := range s.Notifiers {
+		if want[n.Name()] {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// routeCoversFolder applies r's folder filter to ev. A filter entry names a folder
+// by reference, as anywhere else, or by label; an event about no folder passes only
+// exclusion filters.
+func (s *Service) routeCoversFolder(r NotifyRoute, ev NotifyEvent) bool {
+	if len(r.Folders) == 0 {
+		return true
+	}
+	named := false
+	if ev.Folder != "" {
+		inst, _ := s.splitRef(ev.Folder)
+		for _, f := range r.Folders {
+			ref := s.missingRef(f)
+			if ref == s.missingRef(ev.Folder) || (ev.Label != "" && (f == ev.Label || ref == joinRef(inst, ev.Label))) {
+				named = true
+				break
+			}
+		}
+	}
+	return named != r.ExcludeFolders
+}
+
+// notify hands ev to its routed notifiers in the background, each with its own
+// timeout, so a slow or broken sink never holds up a scan or the other sinks.
+// Delivery failures are logged (rate-limited per sink). Repeats within
+// ST_NOTIFY_COOLDOWN are suppressed first. In dry-run mode the routing decision
+// and payload are logged instead.
+func (s *Service) notify(ev NotifyEvent) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	if ev.Folder != "" && ev.Instance == "" {
+		inst, _ := s.splitRef(ev.Folder)
+		ev.Instance = instanceName(inst)
+	}
+	if ev.Folder != "" && ev.Label == "" {
+		ev.Label = s.folderLabel(ev.Folder)
+	}
+	if ev.Severity == "" {
+		ev.Severity = s.eventSeverity(ev)
+	}
+	if !s.cooldownNotification(&ev) {
+		return
+	}
+	targets := s.routeNotifiers(ev)
+	if s.Settings.DryRun {
+		names := make([]string, 0, len(targets))
+		for _, n := range targets {
+			names = append(names, n.Name())
+		}
+		payload, _ := json.Marshal(s.renderNotification("", ev))
+		s.Logger.Printf("[dry-run] Would notify %s via [%s]: %s", ev.Type, strings.Join(names, ", "), payload)
+		return
+	}
+	for _, n := range targets {
+		s.notifications.Add(1)
+		go func(n Notifier, ev NotifyEvent) {
+			defer s.notifications.Done()
+			timeout := notifyTimeout
+			if t, ok := n.(interface{ DeliveryTimeout() time.Duration }); ok && t.DeliveryTimeout() > 0 {
+				timeout = t.DeliveryTimeout()
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			key := "notifier:" + n.Name()
+			if err := n.Notify(ctx, ev); err != nil {
+				s.logFailure(ctx, key, "notify", err, "Notifier %s failed to deliver %s: %v", n.Name(), ev.Type, err)
+				return
+			}
+			s.logSuccess(ctx, key, "notify")
+		}(n, s.renderNotification(n.Name(), ev))
+	}
+}
+
+// WebhookNotifier POSTs each event as JSON to a URL.
+type WebhookNotifier struct {
+	SinkName string
+	URL      string
+	Timeout  time.Duration
+	Client   *http.Client
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{SinkName: "webhook", URL: url, Client: &http.Client{}}
+}
+
+func (w *WebhookNotifier) Name() string                   { return w.SinkName }
+func (w *WebhookNotifier) DeliveryTimeout() time.Duration { return w.Timeout }
+
+func (w *WebhookNotifier) Notify(ctx context.Context, ev NotifyEvent) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// NtfyNotifier publishes each event's message to an ntfy topic URL.
+type NtfyNotifier struct {
+	SinkName string
+	URL      string
+	Timeout  time.Duration
+	Client   *http.Client
+}
+
+// ntfyPriorities maps severities onto ntfy message priorities.
+var ntfyPriorities = map[string]string{
+	severityInfo:     "default",
+	severityWarning:  "high",
+	severityCritical: "urgent",
+}
+
+func (n *NtfyNotifier) Name() string                   { return n.SinkName }
+func (n *NtfyNotifier) DeliveryTimeout() time.Duration { return n.Timeout }
+
+func (n *NtfyNotifier) Notify(ctx context.Context, ev NotifyEvent) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, strings.NewReader(ev.Message))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", ev.Title)
+	req.Header.Set("Tags", ev.Type)
+	if p, ok := ntfyPriorities[ev.Severity]; ok {
+		req.Header.Set("Priority", p)
+	}
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("ntfy returned %s", resp.Status)
+	}
+	return nil
+}
+
+// GotifyNotifier posts each event to a Gotify server's message endpoint. The URL
+// carries the application token: https://gotify.example/message?token=....
+type GotifyNotifier struct {
+	SinkName string
+	URL      string
+	Timeout  time.Duration
+	Client   *http.Client
+}
+
+// gotifyPriorities maps severities onto Gotify message priorities (0-10): clients
+// only show a notification from 4 and pop it up from 8.
+var gotifyPriorities = map[string]int{
+	severityInfo:     2,
+	severityWarning:  5,
+	severityCritical: 8,
+}
+
+func (g *GotifyNotifier) Name() string                   { return g.SinkName }
+func (g *GotifyNotifier) DeliveryTimeout() time.Duration { return g.Timeout }
+
+func (g *GotifyNotifier) Notify(ctx context.Context, ev NotifyEvent) error {
+	priority, ok := gotifyPriorities[ev.Severity]
+	if !ok {
+		priority = gotifyPriorities[severityInfo]
+	}
+	body, err := json.Marshal(map[string]any{"title": ev.Title, "message": ev.Message, "priority": priority})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("gotify returned %s", resp.Status)
+	}
+	return nil
+}
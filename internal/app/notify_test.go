@@ -0,0 +1,150 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingNotifier collects delivered events.
+type recordingNotifier struct {
+	mu     sync.Mutex
+	events []NotifyEvent
+}
+
+func (r *recordingNotifier) Name() string { return "recording" }
+
+func (r *recordingNotifier) Notify(_ context.Context, ev NotifyEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, ev)
+	return nil
+}
+
+func (r *recordingNotifier) types() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]string, 0, len(r.events))
+	for _, ev := range r.events {
+		out = append(out, ev.Type)
+	}
+	return out
+}
+
+func TestWebhookNotifierPostsJSON(t *testing.T) {
+	got := make(chan NotifyEvent, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev NotifyEvent
+		if r.Method != http.MethodPost || r.URL.Path != "/" || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&ev)
+		got <- ev
+	}))
+	defer srv.Close()
+
+	ev := NotifyEvent{Type: eventScanFailed, Folder: "docs", Message: "boom", Fields: map[string]any{"streak": 3}}
+	if err := NewWebhookNotifier(srv.URL+"/").Notify(context.Background(), ev); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	if ev := <-got; ev.Type != eventScanFailed || ev.Folder != "docs" || ev.Fields["streak"] != float64(3) {
+		t.Fatalf("unexpected payload: %+v", ev)
+	}
+
+	if err := NewWebhookNotifier(srv.URL+"/missing").Notify(context.Background(), NotifyEvent{}); err == nil {
+		t.Fatalf("expected an error for a non-2xx response")
+	}
+}
+
+type namedNotifier struct {
+	recordingNotifier
+	name string
+}
+
+func (n *namedNotifier) Name() string { return n.name }
+
+func TestNotifyRouting(t *testing.T) {
+	ntfy, hook := &namedNotifier{name: "ntfy"}, &namedNotifier{name: "webhook"}
+	svc := newFakeSyncthing(t).service(t, Settings{NotifyRoutes: []NotifyRoute{
+		{Events: []string{eventScanFailed}, Sinks: []string{"ntfy"}},
+		{Events: []string{"*"}, Sinks: []string{"webhook"}},
+	}})
+	svc.Notifiers = []Notifier{ntfy, hook}
+
+	svc.notify(NotifyEvent{Type: eventScanFailed, Folder: "docs"})
+	svc.notify(NotifyEvent{Type: eventFolderRecovered, Folder: "docs"})
+	svc.notifications.Wait()
+	if got := ntfy.types(); !slices.Equal(got, []string{eventScanFailed}) {
+		t.Fatalf("ntfy got %v", got)
+	}
+	got := hook.types()
+	slices.Sort(got)
+	if !slices.Equal(got, []string{eventFolderRecovered, eventScanFailed}) {
+		t.Fatalf("webhook got %v", got)
+	}
+}
+
+func TestNotifyRoutingFolderFilters(t *testing.T) {
+	fake := newFakeSyncthing(t, "finance", "docs", "scratch", "music")
+	fake.setLabel("docs", "Documents")
+	routes, err := parseNotifyRoutes("scan_failed[finance, Documents] -> ntfy; scan_failed[!scratch], digest -> webhook",
+		[]NotifySinkSettings{{Name: "ntfy"}, {Name: "webhook"}})
+	if err != nil {
+		t.Fatalf("routes: %v", err)
+	}
+	svc := fake.service(t, Settings{NotifyRoutes: routes})
+	if _, err := svc.cachedFolders(context.Background(), ""); err != nil {
+		t.Fatalf("folders: %v", err)
+	}
+	ntfy, hook := &namedNotifier{name: "ntfy"}, &namedNotifier{name: "webhook"}
+	svc.Notifiers = []Notifier{ntfy, hook}
+
+	sent := func(n *namedNotifier) []string {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		var out []string
+		for _, ev := range n.events {
+			out = append(out, ev.Type+":"+ev.Folder)
+		}
+		slices.Sort(out)
+		return out
+	}
+	for _, folder := range []string{"finance", "default/docs", "scratch", "music"} {
+		svc.notify(NotifyEvent{Type: eventScanFailed, Folder: folder})
+	}
+	svc.notify(NotifyEvent{Type: eventScanRecovered, Folder: "finance"})
+	svc.notify(NotifyEvent{Type: eventDigest})
+	svc.notifications.Wait()
+
+	if got := sent(ntfy); !slices.Equal(got, []string{"scan_failed:default/docs", "scan_failed:finance"}) {
+		t.Fatalf("ntfy got %v", got)
+	}
+	if got := sent(hook); !slices.Equal(got, []string{"digest:", "scan_failed:default/docs", "scan_failed:finance", "scan_failed:music"}) {
+		t.Fatalf("webhook got %v", got)
+	}
+}
+
+func TestNotifyDryRunLogsRouting(t *testing.T) {
+	hook := &namedNotifier{name: "webhook"}
+	svc := newFakeSyncthing(t).service(t, Settings{DryRun: true})
+	svc.Notifiers = []Notifier{hook}
+	var buf bytes.Buffer
+	svc.Logger = log.New(&buf, "", 0)
+
+	svc.notify(NotifyEvent{Type: eventScanFailed, Folder: "docs", Message: "boom"})
+	svc.notifications.Wait()
+	if len(hook.types()) != 0 {
+		t.Fatalf("dry-run must not deliver")
+	}
+	if out := buf.String(); !strings.Contains(out, "[dry-run] Would notify scan_failed via [webhook]: {") || !strings.Contains(out, `"message":"boom"`) {
+		t.Fatalf("unexpected log:\n%s", out)
+	}
+}
@@ -0,0 +1,264 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Chat colors by severity; recoveries are always shown in green.
+var severityColors = map[string]int{
+	severityCritical: 0xD32F2F,
+	severityWarning:  0xF9A825,
+	severityInfo:     0x1976D2,
+}
+
+const recoveryColor = 0x2E7D32
+
+// Message size limits of the chat services; longer text is cut short.
+const (
+	slackTextLimit        = 3000
+	slackTitleLimit       = 250
+	discordTitleLimit     = 256
+	discordDescLimit      = 4096
+	discordFieldLimit     = 1024
+	chatRetryAfterMax     = 30 * time.Second
+	chatRetryAfterDefault = time.Second
+)
+
+// chatColor is the color a chat sink shows ev in.
+func chatColor(ev NotifyEvent) int {
+	if recoveryEvent(ev) {
+		return recoveryColor
+	}
+	if c, ok := severityColors[ev.Severity]; ok {
+		return c
+	}
+	return severityColors[severityInfo]
+}
+
+// chatFact is one short name/value pair shown next to a chat message.
+type chatFact struct {
+	Name  string
+	Value string
+}
+
+// chatFacts picks the folder and the key numbers out of ev, humanized.
+func chatFacts(ev NotifyEvent) []chatFact {
+	var facts []chatFact
+	add := func(name, value string) { facts = append(facts, chatFact{name, value}) }
+	if ev.Folder != "" {
+		folder := ev.Folder
+		if ev.Label != "" {
+			folder += " (" + ev.Label + ")"
+		}
+		add("Folder", folder)
+	}
+	if ev.Instance != "" {
+		add("Instance", ev.Instance)
+	}
+	if n, ok := factInt(ev.Fields["streak"]); ok {
+		add("Failures in a row", strconv.FormatInt(n, 10))
+	}
+	if from, ok := ev.Fields["from"].(string); ok {
+		to, _ := ev.Fields["to"].(string)
+		add("Health", from+" → "+to)
+	}
+	if n, ok := factInt(ev.Fields["durationSeconds"]); ok {
+		add("Unhealthy for", (time.Duration(n) * time.Second).String())
+	}
+	if n, ok := factInt(ev.Fields["peakNeedBytes"]); ok && n > 0 {
+		add("Peak behind", formatBytes(n))
+	}
+	if n, ok := factInt(ev.Fields["peakErrors"]); ok && n > 0 {
+		add("Peak errors", strconv.FormatInt(n, 10))
+	}
+	if folders, ok := ev.Fields["folders"].(map[string]DigestFolder); ok {
+		add("Folders", strconv.Itoa(len(folders)))
+	}
+	return facts
+}
+
+func factInt(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	case float64:
+		return int64(n), true
+	}
+	return 0, false
+}
+
+// truncate cuts s to at most limit runes, marking the cut with an ellipsis.
+func truncate(s string, limit int) string {
+	r := []rune(s)
+	if len(r) <= limit {
+		return s
+	}
+	return string(r[:limit-1]) + "…"
+}
+
+// postChat POSTs payload as JSON to url. A 429 is retried once, after the delay the
+// service asked for (its retry_after), as long as ctx allows.
+func postChat(ctx context.Context, client *http.Client, service, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		wait := chatRetryAfter(resp)
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+			return nil
+		case resp.StatusCode != http.StatusTooManyRequests || attempt > 1:
+			return fmt.Errorf("%s returned %s", service, resp.Status)
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return fmt.Errorf("%s rate limited for %s: %w", service, wait, ctx.Err())
+		case <-t.C:
+		}
+	}
+}
+
+// chatRetryAfter reads how long a rate-limited response asks us to wait: Discord's
+// JSON retry_after or the Retry-After header Slack sends, both in seconds.
+func chatRetryAfter(resp *http.Response) time.Duration {
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return 0
+	}
+	var body struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	secs := 0.0
+	if data, err := io.ReadAll(io.LimitReader(resp.Body, 4096)); err == nil && json.Unmarshal(data, &body) == nil {
+		secs = body.RetryAfter
+	}
+	if secs <= 0 {
+		secs, _ = strconv.ParseFloat(strings.TrimSpace(resp.Header.Get("Retry-After")), 64)
+	}
+	if secs <= 0 {
+		return chatRetryAfterDefault
+	}
+	return min(time.Duration(secs*float64(time.Second)), chatRetryAfterMax)
+}
+
+// SlackNotifier posts each event to a Slack incoming webhook as a colored attachment.
+type SlackNotifier struct {
+	SinkName string
+	URL      string
+	Channel  string // overrides the webhook's channel when set
+	Username string // overrides the webhook's name when set
+	Timeout  time.Duration
+	Client   *http.Client
+}
+
+type slackMessage struct {
+	Channel     string            `json:"channel,omitempty"`
+	Username    string            `json:"username,omitempty"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+type slackAttachment struct {
+	Color    string       `json:"color"`
+	Title    string       `json:"title"`
+	Text     string       `json:"text"`
+	Fields   []slackField `json:"fields,omitempty"`
+	Footer   string       `json:"footer"`
+	Ts       int64        `json:"ts"`
+	Fallback string       `json:"fallback"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+func (n *SlackNotifier) Name() string                   { return n.SinkName }
+func (n *SlackNotifier) DeliveryTimeout() time.Duration { return n.Timeout }
+
+func (n *SlackNotifier) Notify(ctx context.Context, ev NotifyEvent) error {
+	title := truncate(ev.Title, slackTitleLimit)
+	att := slackAttachment{
+		Color:    fmt.Sprintf("#%06X", chatColor(ev)),
+		Title:    title,
+		Text:     truncate(ev.Message, slackTextLimit),
+		Footer:   "syncthing-kicker",
+		Ts:       ev.Time.Unix(),
+		Fallback: title,
+	}
+	for _, f := range chatFacts(ev) {
+		att.Fields = append(att.Fields, slackField{Title: f.Name, Value: f.Value, Short: true})
+	}
+	msg := slackMessage{Channel: n.Channel, Username: n.Username, Attachments: []slackAttachment{att}}
+	return postChat(ctx, n.Client, "slack", n.URL, msg)
+}
+
+// DiscordNotifier posts each event to a Discord webhook as a colored embed.
+type DiscordNotifier struct {
+	SinkName string
+	URL      string
+	Timeout  time.Duration
+	Client   *http.Client
+}
+
+type discordMessage struct {
+	Embeds []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields,omitempty"`
+	Footer      discordFooter  `json:"footer"`
+	Timestamp   string         `json:"timestamp"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type discordFooter struct {
+	Text string `json:"text"`
+}
+
+func (n *DiscordNotifier) Name() string                   { return n.SinkName }
+func (n *DiscordNotifier) DeliveryTimeout() time.Duration { return n.Timeout }
+
+func (n *DiscordNotifier) Notify(ctx context.Context, ev NotifyEvent) error {
+	embed := discordEmbed{
+		Title:       truncate(ev.Title, discordTitleLimit),
+		Description: truncate(ev.Message, discordDescLimit),
+		Color:       chatColor(ev),
+		Footer:      discordFooter{Text: "syncthing-kicker"},
+		Timestamp:   ev.Time.UTC().Format(time.RFC3339),
+	}
+	for _, f := range chatFacts(ev) {
+		embed.Fields = append(embed.Fields, discordField{Name: f.Name, Value: truncate(f.Value, discordFieldLimit), Inline: true})
+	}
+	return postChat(ctx, n.Client, "discord", n.URL, discordMessage{Embeds: []discordEmbed{embed}})
+}
@@ -0,0 +1,134 @@
+package app
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// chatServer records the bodies POSTed to it and answers with the queued status
+// codes (then 200), adding the rate limit hint to 429s.
+func chatServer(t *testing.T, codes ...int) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		code := http.StatusOK
+		if len(bodies) <= len(codes) {
+			code = codes[len(bodies)-1]
+		}
+		mu.Unlock()
+		if r.Header.Get("Content-Type") != "application/json" {
+			code = http.StatusBadRequest
+		}
+		if code == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "0.01")
+			w.WriteHeader(code)
+			_, _ = w.Write([]byte(`{"message": "You are being rate limited.", "retry_after": 0.02, "global": false}`))
+			return
+		}
+		w.WriteHeader(code)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), bodies...)
+	}
+}
+
+var chatEvent = NotifyEvent{
+	Type:     eventFolderRecovered,
+	Time:     time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	Folder:   "docs",
+	Label:    "Documents",
+	Instance: "default",
+	Title:    "syncthing-kicker: folder_recovered",
+	Message:  "Folder 'docs' recovered",
+	Fields:   map[string]any{"durationSeconds": int64(3725), "peakNeedBytes": int64(5 << 20), "peakErrors": int64(0)},
+}
+
+func TestSlackNotifierPostsAttachment(t *testing.T) {
+	srv, bodies := chatServer(t)
+	n := &SlackNotifier{SinkName: "team", URL: srv.URL, Channel: "#ops", Username: "kicker", Client: &http.Client{}}
+	if err := n.Notify(context.Background(), chatEvent); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	want := `{"channel":"#ops","username":"kicker","attachments":[{"color":"#2E7D32","title":"syncthing-kicker: folder_recovered",` +
+		`"text":"Folder 'docs' recovered","fields":[{"title":"Folder","value":"docs (Documents)","short":true},` +
+		`{"title":"Instance","value":"default","short":true},{"title":"Unhealthy for","value":"1h2m5s","short":true},` +
+		`{"title":"Peak behind","value":"5.0 MiB","short":true}],"footer":"syncthing-kicker","ts":1714564800,` +
+		`"fallback":"syncthing-kicker: folder_recovered"}]}`
+	if got := bodies(); len(got) != 1 || got[0] != want {
+		t.Fatalf("unexpected payload:\n%v\nwant:\n%s", got, want)
+	}
+}
+
+func TestDiscordNotifierPostsEmbed(t *testing.T) {
+	srv, bodies := chatServer(t)
+	n := &DiscordNotifier{SinkName: "discord", URL: srv.URL, Client: &http.Client{}}
+	ev := NotifyEvent{
+		Type: eventScanFailed, Time: chatEvent.Time, Folder: "nas/media", Instance: "nas", Severity: severityCritical,
+		Title: "syncthing-kicker: scan_failed", Message: "Scan of 'nas/media' failed 3 times in a row",
+		Fields: map[string]any{"streak": 3},
+	}
+	if err := n.Notify(context.Background(), ev); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	want := `{"embeds":[{"title":"syncthing-kicker: scan_failed","description":"Scan of 'nas/media' failed 3 times in a row",` +
+		`"color":13840175,"fields":[{"name":"Folder","value":"nas/media","inline":true},{"name":"Instance","value":"nas","inline":true},` +
+		`{"name":"Failures in a row","value":"3","inline":true}],"footer":{"text":"syncthing-kicker"},"timestamp":"2024-05-01T12:00:00Z"}]}`
+	if got := bodies(); len(got) != 1 || got[0] != want {
+		t.Fatalf("unexpected payload:\n%v\nwant:\n%s", got, want)
+	}
+}
+
+func TestChatNotifiersRetryRateLimitOnce(t *testing.T) {
+	for _, build := range []func(url string) Notifier{
+		func(url string) Notifier { return &SlackNotifier{SinkName: "slack", URL: url, Client: &http.Client{}} },
+		func(url string) Notifier {
+			return &DiscordNotifier{SinkName: "discord", URL: url, Client: &http.Client{}}
+		},
+	} {
+		srv, bodies := chatServer(t, http.StatusTooManyRequests)
+		if err := build(srv.URL).Notify(context.Background(), chatEvent); err != nil {
+			t.Fatalf("expected the retry to deliver: %v", err)
+		}
+		if got := bodies(); len(got) != 2 || got[0] != got[1] {
+			t.Fatalf("expected the same payload twice, got %d requests", len(got))
+		}
+
+		srv, bodies = chatServer(t, http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests)
+		n := build(srv.URL)
+		if err := n.Notify(context.Background(), chatEvent); err == nil || !strings.Contains(err.Error(), "429") {
+			t.Fatalf("%s: expected the second 429 to fail, got %v", n.Name(), err)
+		}
+		if got := len(bodies()); got != 2 {
+			t.Fatalf("%s: expected a single retry, got %d requests", n.Name(), got)
+		}
+	}
+}
+
+func TestChatNotifiersTruncateLongText(t *testing.T) {
+	ev := chatEvent
+	ev.Message = strings.Repeat("é", 5000)
+	if got := truncate(ev.Message, discordDescLimit); len([]rune(got)) != discordDescLimit || !strings.HasSuffix(got, "…") {
+		t.Fatalf("unexpected truncation to %d runes", len([]rune(got)))
+	}
+
+	srv, bodies := chatServer(t)
+	if err := (&SlackNotifier{URL: srv.URL, Client: &http.Client{}}).Notify(context.Background(), ev); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	if body := bodies()[0]; strings.Count(body, "é") != slackTextLimit-1 || !strings.Contains(body, "é…") {
+		t.Fatalf("expected the Slack text cut to %d runes", slackTextLimit)
+	}
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// syslogFacility is the daemon facility, which every message is logged under.
+const syslogFacility = 3
+
+// syslogSeverities maps severities onto syslog levels: crit, warning and info.
+var syslogSeverities = map[string]int{
+	severityInfo:     6,
+	severityWarning:  4,
+	severityCritical: 2,
+}
+
+// SyslogNotifier logs each event's title and message to a syslog daemon at a level
+// following its severity. The URL names the daemon: udp://host:514, tcp://host:514
+// or unix:///dev/log.
+type SyslogNotifier struct {
+	SinkName string
+	URL      string
+	Timeout  time.Duration
+}
+
+func (n *SyslogNotifier) Name() string                   { return n.SinkName }
+func (n *SyslogNotifier) DeliveryTimeout() time.Duration { return n.Timeout }
+
+func (n *SyslogNotifier) Notify(ctx context.Context, ev NotifyEvent) error {
+	network, addr, err := syslogAddr(n.URL)
+	if err != nil {
+		return err
+	}
+	conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	_, err = conn.Write([]byte(syslogMessage(network, ev, time.Now())))
+	return err
+}
+
+// syslogMessage formats ev as an RFC 3164 line. A local daemon adds the host name
+// itself; a remote one is told it.
+func syslogMessage(network string, ev NotifyEvent, now time.Time) string {
+	level, ok := syslogSeverities[ev.Severity]
+	if !ok {
+		level = syslogSeverities[severityInfo]
+	}
+	text := strings.Join(strings.Fields(ev.Title+": "+ev.Message), " ")
+	header := fmt.Sprintf("<%d>%s ", syslogFacility*8+level, now.Format(time.Stamp))
+	if network == "udp" || network == "tcp" {
+		host, _ := os.Hostname()
+		header += host + " "
+	}
+	return fmt.Sprintf("%ssyncthing-kicker[%d]: %s\n", header, os.Getpid(), text)
+}
+
+// syslogAddr splits a syslog sink URL into the network and address to dial.
+func syslogAddr(raw string) (network, addr string, err error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", "", err
+	}
+	switch u.Scheme {
+	case "udp", "tcp":
+		if u.Host == "" {
+			return "", "", fmt.Errorf("syslog URL %q has no host", raw)
+		}
+		return u.Scheme, u.Host, nil
+	case "unix":
+		if u.Path == "" {
+			return "", "", fmt.Errorf("syslog URL %q has no socket path", raw)
+		}
+		return "unixgram", u.Path, nil
+	}
+	return "", "", fmt.Errorf("syslog URL %q must be udp://host:port, tcp://host:port or unix:///path", raw)
+}
@@ -0,0 +1,147 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// NotifyTemplate holds the raw title and body templates for notifications; empty
+// fields keep the built-in text.
+type NotifyTemplate struct {
+	Title string
+	Body  string
+}
+
+// NotifyTemplateData is what notification templates are executed with.
+type NotifyTemplateData struct {
+	Event     string // event type, e.g. scan_failed
+	Folder    string
+	Label     string // folder label, when known
+	Instance  string
+	Severity  string // info, warning or critical
+	State     string // last observed folder state
+	NeedBytes int64  // last observed; use {{humanize .NeedBytes}}
+	Error     string
+	Streak    int // consecutive failures, for scan_* events
+	Timestamp time.Time
+	Message   string         // the built-in message
+	Fields    map[string]any // the event's structured fields
+}
+
+var notifyTemplateFuncs = template.FuncMap{
+	"humanize": func(n int64) string { return formatBytes(n) },
+}
+
+// compiledTemplate is a parsed NotifyTemplate; nil members keep the default text.
+type compiledTemplate struct {
+	title, body *template.Template
+}
+
+// parseNotifyTemplate parses sink's templates ("" for the global ones); errors name
+// the environment variable the template came from.
+func parseNotifyTemplate(sink string, t NotifyTemplate) (compiledTemplate, error) {
+	var out compiledTemplate
+	parse := func(kind, raw string) (*template.Template, error) {
+		if raw == "" {
+			return nil, nil
+		}
+		tmpl, err := template.New(strings.ToLower(kind)).Funcs(notifyTemplateFuncs).Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", notifyTemplateEnv(kind, sink), err)
+		}
+		return tmpl, nil
+	}
+	var err error
+	if out.title, err = parse("TITLE", t.Title); err != nil {
+		return out, err
+	}
+	out.body, err = parse("BODY", t.Body)
+	return out, err
+}
+
+// notifyTemplateEnv is the environment variable holding sink's template of kind
+// ("TITLE" or "BODY"); an empty sink names the global one.
+func notifyTemplateEnv(kind, sink string) string {
+	name := "ST_NOTIFY_TEMPLATE_" + kind
+	if sink != "" {
+		name += "_" + strings.ToUpper(strings.ReplaceAll(sink, "-", "_"))
+	}
+	return name
+}
+
+// notifyTemplateFor returns the compiled templates for sink: its own where set,
+// otherwise the global ones.
+func (s *Service) notifyTemplateFor(sink string) compiledTemplate {
+	s.templatesOnce.Do(func() {
+		s.templates = map[string]compiledTemplate{}
+		for sink, t := range s.Settings.NotifyTemplates {
+			// Validated when settings were loaded.
+			s.templates[sink], _ = parseNotifyTemplate(sink, t)
+		}
+	})
+	global, own := s.templates[""], s.templates[sink]
+	if own.title == nil {
+		own.title = global.title
+	}
+	if own.body == nil {
+		own.body = global.body
+	}
+	return own
+}
+
+// templateData gathers what templates can refer to for ev.
+func (s *Service) templateData(ev NotifyEvent) NotifyTemplateData {
+	d := NotifyTemplateData{
+		Event:     ev.Type,
+		Folder:    ev.Folder,
+		Instance:  ev.Instance,
+		Severity:  ev.Severity,
+		Timestamp: ev.Time,
+		Message:   ev.Message,
+		Fields:    ev.Fields,
+	}
+	if ev.Folder != "" {
+		d.Label = s.folderLabel(ev.Folder)
+		for _, f := range s.stats.snapshot() {
+			if f.Folder == ev.Folder {
+				d.State, d.NeedBytes = f.State, f.NeedBytes
+			}
+		}
+	}
+	if e, ok := ev.Fields["error"].(string); ok {
+		d.Error = e
+	}
+	if n, ok := ev.Fields["streak"].(int); ok {
+		d.Streak = n
+	}
+	return d
+}
+
+// renderNotification applies sink's templates to ev. A template that fails to
+// execute leaves the built-in text in place and logs a warning.
+func (s *Service) renderNotification(sink string, ev NotifyEvent) NotifyEvent {
+	if ev.Title == "" {
+		ev.Title = "syncthing-kicker: " + ev.Type
+	}
+	t := s.notifyTemplateFor(sink)
+	if t.title == nil && t.body == nil {
+		return ev
+	}
+	data := s.templateData(ev)
+	exec := func(tmpl *template.Template, def string) string {
+		if tmpl == nil {
+			return def
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, data); err != nil {
+			s.Logger.Printf("Warning: notification %s template for sink %s failed: %v; using the default text", tmpl.Name(), sink, err)
+			return def
+		}
+		return b.String()
+	}
+	ev.Title = exec(t.title, ev.Title)
+	ev.Message = exec(t.body, ev.Message)
+	return ev
+}
@@ -0,0 +1,110 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files under testdata")
+
+func TestNotifyTemplatesGolden(t *testing.T) {
+	fake := newFakeSyncthing(t, "abcd-1234")
+	fake.setLabel("abcd-1234", "Documents")
+	fake.setStatus("abcd-1234", syncthing.FolderStatus{State: "error", NeedBytes: 5 << 20})
+	when := time.Date(2024, 5, 1, 3, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name string
+		tmpl NotifyTemplate
+		ev   NotifyEvent
+	}{
+		{
+			name: "scan_failed",
+			tmpl: NotifyTemplate{
+				Title: `[{{.Instance}}] {{.Folder}}{{with .Label}} ({{.}}){{end}} is failing`,
+				Body:  "{{.Event}} x{{.Streak}} at {{.Timestamp.Format \"15:04\"}}: {{.Error}}\nstate {{.State}}, need {{humanize .NeedBytes}}",
+			},
+			ev: NotifyEvent{Type: eventScanFailed, Time: when, Folder: "abcd-1234", Message: "default",
+				Fields: map[string]any{"streak": 3, "error": "connection refused"}},
+		},
+		{
+			name: "folder_recovered",
+			tmpl: NotifyTemplate{
+				Body: `{{or .Label .Folder}} is back after {{index .Fields "durationSeconds"}}s (was {{humanize (index .Fields "peakNeedBytes")}} behind)`,
+			},
+			ev: NotifyEvent{Type: eventFolderRecovered, Time: when, Folder: "abcd-1234", Message: "default",
+				Fields: map[string]any{"durationSeconds": int64(8040), "peakNeedBytes": int64(3 << 30)}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			svc := fake.service(t, Settings{NotifyTemplates: map[string]NotifyTemplate{"": c.tmpl}})
+			_ = svc.checkSyncStatus(context.Background(), []string{"*"}, 0)
+			c.ev.Instance = "default"
+			ev := svc.renderNotification("webhook", c.ev)
+			got := ev.Title + "\n---\n" + ev.Message + "\n"
+
+			path := filepath.Join("testdata", "notify", c.name+".golden")
+			if *updateGolden {
+				if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("read golden file: %v", err)
+			}
+			if got != string(want) {
+				t.Fatalf("rendered notification mismatch\ngot:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestNotifyTemplatePerSinkAndFallback(t *testing.T) {
+	svc := newFakeSyncthing(t).service(t, Settings{NotifyTemplates: map[string]NotifyTemplate{
+		"":     {Title: "global {{.Event}}"},
+		"ntfy": {Body: `{{index .Fields "missing" 1}}`},
+	}})
+	var buf bytes.Buffer
+	svc.Logger = log.New(&buf, "", 0)
+
+	ev := svc.renderNotification("ntfy", NotifyEvent{Type: eventScanFailed, Message: "built-in"})
+	if ev.Title != "global scan_failed" || ev.Message != "built-in" {
+		t.Fatalf("unexpected rendering: %+v", ev)
+	}
+	if !strings.Contains(buf.String(), "Warning: notification body template for sink ntfy failed") {
+		t.Fatalf("expected a warning, got:\n%s", buf.String())
+	}
+	if ev := svc.renderNotification("webhook", NotifyEvent{Type: eventDigest, Message: "m"}); ev.Title != "global digest" || ev.Message != "m" {
+		t.Fatalf("unexpected rendering for other sink: %+v", ev)
+	}
+}
+
+func TestLoadSettingsRejectsBadNotifyTemplate(t *testing.T) {
+	os.Clearenv()
+	os.Setenv("ST_API_KEY", "abc123")
+	os.Setenv("ST_CRON", "*/5 * * * *")
+	os.Setenv("ST_NOTIFY_SINKS", "alerts = ntfy https://ntfy.sh/x")
+	os.Setenv("ST_NOTIFY_TEMPLATE_BODY_ALERTS", "{{.Folder")
+	_, err := LoadSettingsFromEnv()
+	if err == nil || !strings.Contains(err.Error(), "ST_NOTIFY_TEMPLATE_BODY_ALERTS") {
+		t.Fatalf("expected a template error naming the variable, got %v", err)
+	}
+
+	os.Setenv("ST_NOTIFY_TEMPLATE_BODY_ALERTS", "{{.Folder}} failed")
+	st, err := LoadSettingsFromEnv()
+	if err != nil || st.NotifyTemplates["alerts"].Body != "{{.Folder}} failed" {
+		t.Fatalf("unexpected result: %v %+v", err, st.NotifyTemplates)
+	}
+}
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOfflineGraceHoldsFailuresUntilRecovery(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	h := &instanceHealth{now: clock.now}
+	var buf bytes.Buffer
+	logger := log.New(&buf, "", 0)
+
+	released := 0
+	for i := 0; i < 5; i++ {
+		if held := h.record(logger, "nas", refused(), time.Minute, func(time.Time) { released++ }); !held {
+			t.Fatalf("failure %d within the grace should be held", i+1)
+		}
+		clock.advance(10 * time.Second)
+	}
+	if got := h.snapshot([]string{"nas"})[0]; !got.Healthy || got.Failures != 0 {
+		t.Fatalf("held failures must not count: %+v", got)
+	}
+	if ok, _ := h.available("nas"); !ok {
+		t.Fatalf("held failures must not back the instance off")
+	}
+
+	h.record(logger, "nas", nil, time.Minute, nil)
+	if released != 0 {
+		t.Fatalf("recovery within the grace should drop held failures, released %d", released)
+	}
+	if got := buf.String(); strings.Count(got, "\n") != 1 || !strings.Contains(got, "unreachable for 50s, within ST_OFFLINE_GRACE; 5 failed attempt(s) not reported") {
+		t.Fatalf("expected one recovery line, got:\n%s", got)
+	}
+}
+
+func TestOfflineGraceReleasesFailuresWithEpisodeStart(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	h := &instanceHealth{now: clock.now}
+	logger := log.New(io.Discard, "", 0)
+	start := clock.t
+
+	var sinces []time.Time
+	release := func(since time.Time) { sinces = append(sinces, since) }
+	h.record(logger, "nas", refused(), time.Minute, release)
+	clock.advance(30 * time.Second)
+	h.record(logger, "nas", refused(), time.Minute, release)
+	clock.advance(30 * time.Second)
+
+	if held := h.record(logger, "nas", refused(), time.Minute, release); held {
+		t.Fatalf("a failure past the grace should be reported")
+	}
+	if len(sinces) != 2 || !sinces[0].Equal(start) || !sinces[1].Equal(start) {
+		t.Fatalf("expected both held failures released from %s, got %v", start, sinces)
+	}
+	got := h.snapshot([]string{"nas"})[0]
+	if got.Healthy || got.Failures != 3 || !got.failingSince.Equal(start) {
+		t.Fatalf("expected a 3-failure streak from %s, got %+v since %s", start, got, got.failingSince)
+	}
+}
+
+func TestOfflineGraceExpiresWithoutFurtherCalls(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	h := &instanceHealth{now: clock.now}
+	logger := log.New(io.Discard, "", 0)
+
+	released := 0
+	h.record(logger, "nas", refused(), time.Minute, func(time.Time) { released++ })
+	h.expire(logger, time.Minute)
+	if released != 0 {
+		t.Fatalf("episode released before the grace ran out")
+	}
+	clock.advance(time.Minute)
+	h.expire(logger, time.Minute)
+	if got := h.snapshot([]string{"nas"})[0]; released != 1 || got.Failures != 1 {
+		t.Fatalf("expected the held failure released into the streak, released=%d %+v", released, got)
+	}
+}
+
+func TestScanFailureHeldWithinOfflineGrace(t *testing.T) {
+	down := newFakeSyncthing(t, "docs")
+	down.srv.Close()
+	clock := &fakeClock{t: time.Now()}
+	var logs syncBuffer
+	svc := down.service(t, Settings{OfflineGrace: time.Minute})
+	svc.Logger = log.New(&logs, "", 0)
+	svc.health.now = clock.now
+
+	if got := svc.triggerScan(context.Background(), "docs"); got != resultSkipped {
+		t.Fatalf("result = %s, want %s", got, resultSkipped)
+	}
+	if got := svc.stats.snapshot(); len(got) != 0 || strings.Contains(logs.String(), "Scan trigger failed") {
+		t.Fatalf("held failure was reported: %+v\n%s", got, logs.String())
+	}
+	if level, _ := svc.assessHealth(clock.t); level != levelHealthy {
+		t.Fatalf("health level = %s within the grace, want %s", level, levelHealthy)
+	}
+
+	clock.advance(time.Minute)
+	if got := svc.triggerScan(context.Background(), "docs"); got != resultFailed {
+		t.Fatalf("result = %s, want %s", got, resultFailed)
+	}
+	if f := svc.stats.snapshot()[0]; f.Failures != 2 || f.Skips != 0 {
+		t.Fatalf("expected the held failure released alongside the new one, and never counted as a skip: %+v", f)
+	}
+	if !strings.Contains(logs.String(), "unreachable since") {
+		t.Fatalf("expected the released failure logged with the episode start:\n%s", logs.String())
+	}
+	if level, _ := svc.assessHealth(clock.t); level == levelHealthy {
+		t.Fatalf("health level should reflect the released failures")
+	}
+}
@@ -0,0 +1,127 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+// Actions an ST_FOLDER_CRON line can run.
+const (
+	actionScan     = "scan"
+	actionOverride = "override"
+	actionRevert   = "revert"
+
+	actionVersionsReport = "versions-report"
+)
+
+// eventOverride is raised by every scheduled override, whatever its outcome.
+const eventOverride = "override"
+
+// actionTimeout bounds each request of a scheduled override or revert.
+const actionTimeout = 30 * time.Second
+
+// folderCronAction splits the action an ST_FOLDER_CRON expression may start with off
+// the cron expression itself; without one the line scans.
+func folderCronAction(expr string) (action, rest string) {
+	fields := strings.Fields(expr)
+	if len(fields) > 0 {
+		switch fields[0] {
+		case actionScan, actionOverride, actionRevert, actionVersionsReport:
+			return fields[0], strings.TrimSpace(strings.TrimPrefix(expr, fields[0]))
+		}
+	}
+	return actionScan, expr
+}
+
+// overrideFolder runs a scheduled override of folder and records it as a run of its
+// own. The outcome, with the number of items the override undid as seen by a
+// follow-up status check, goes to the run history and to notifications.
+func (s *Service) overrideFolder(ctx context.Context, folder string) {
+	ctx, run := s.startRun(ctx, actionOverride+":"+folder)
+	defer run.finish()
+	a := run.begin(folder)
+	started := time.Now()
+	result, overridden, detail := s.override(ctx, folder)
+	run.update(a.index, func(f *RunFolderResult) {
+		f.Result, f.DurationMs, f.Overridden = result, time.Since(started).Milliseconds(), overridden
+	})
+	s.log(ctx).Printf("%s: override %s", folder, result)
+
+	name := fmt.Sprintf("%s%s", folder, s.labelSuffix(folder))
+	var msg string
+	switch result {
+	case resultTriggered:
+		msg = fmt.Sprintf("Folder %s overridden: %d item(s) reverted to the local copy", name, overridden)
+	case resultDryRun:
+		return
+	default:
+		msg = fmt.Sprintf("Override of folder %s %s: %s", name, result, detail)
+	}
+	fields := map[string]any{"result": result, "overridden": overridden}
+	if detail != "" {
+		fields["reason"] = detail
+	}
+	s.notify(NotifyEvent{Type: eventOverride, Folder: folder, Message: msg, Fields: fields})
+}
+
+// override checks that overriding folder is allowed and meaningful, overrides it and
+// counts how many needed items it undid. It returns the outcome, that count and,
+// unless it succeeded, why not.
+func (s *Service) override(ctx context.Context, folder string) (result string, overridden int64, detail string) {
+	name := fmt.Sprintf("folder '%s'%s", folder, s.labelSuffix(folder))
+	if !s.Settings.AllowDestructive {
+		s.log(ctx).Printf("Skipping override of %s: ST_ALLOW_DESTRUCTIVE is not set", name)
+		return resultSkipped, 0, "ST_ALLOW_DESTRUCTIVE is not set"
+	}
+	inst, id := s.splitRef(folder)
+	client := s.client(inst)
+	cfg, _, err := client.Folder(ctx, id, actionTimeout)
+	if err != nil {
+		s.logFailure(ctx, "override:"+folder, "override", err, "Cannot read the config of %s to override it: %v", name, err)
+		return resultFailed, 0, err.Error()
+	}
+	if cfg.Type != "sendonly" {
+		detail = fmt.Sprintf("it is a %s folder, not sendonly", cfg.Type)
+		s.log(ctx).Printf("Skipping override of %s: %s", name, detail)
+		return resultSkipped, 0, detail
+	}
+	before, _, err := client.FolderStatus(ctx, id, actionTimeout)
+	if err != nil {
+		s.logFailure(ctx, "override:"+folder, "override", err, "Cannot read the status of %s to override it: %v", name, err)
+		return resultFailed, 0, err.Error()
+	}
+	if neededItems(before) == 0 && before.NeedBytes == 0 {
+		s.log(ctx).Printf("Skipping override of %s: it has no remote changes to undo", name)
+		return resultSkipped, 0, "no remote changes to undo"
+	}
+	if s.Settings.DryRun {
+		s.log(ctx).Printf("[dry-run] Would override %s, undoing %d item(s) (%d bytes)", name, neededItems(before), before.NeedBytes)
+		return resultDryRun, 0, ""
+	}
+	if _, err := client.Override(ctx, id, actionTimeout); err != nil {
+		s.logFailure(ctx, "override:"+folder, "override", err, "Failed to override %s: %v", name, err)
+		return resultFailed, 0, err.Error()
+	}
+	s.logSuccess(ctx, "override:"+folder, "override")
+
+	after, checked := before, false
+	_ = s.checkStatuses(ctx, []string{folder}, s.Settings.StatusDelaySec, true, func(_ context.Context, _ string, st syncthing.FolderStatus) {
+		after, checked = st, true
+	})
+	if !checked {
+		s.log(ctx).Printf("Overrode %s; its status could not be read afterwards, so the items undone are unknown", name)
+		return resultTriggered, 0, ""
+	}
+	overridden = max(neededItems(before)-neededItems(after), 0)
+	s.log(ctx).Printf("Overrode %s: %d item(s) undone, %d still needed", name, overridden, neededItems(after))
+	return resultTriggered, overridden, ""
+}
+
+// neededItems is how many files, directories and deletions st still needs.
+func neededItems(st syncthing.FolderStatus) int64 {
+	return st.NeedFiles + st.NeedDirectories + st.NeedDeletes
+}
@@ -0,0 +1,68 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+func TestOverrideFolder(t *testing.T) {
+	fake := newFakeSyncthing(t, "outbox")
+	fake.setType("outbox", "sendonly")
+	fake.setStatus("outbox", syncthing.FolderStatus{State: "idle", NeedFiles: 3, NeedDeletes: 1, NeedBytes: 4096})
+	svc := fake.service(t, Settings{AllowDestructive: true})
+	rec := &recordingNotifier{}
+	svc.Notifiers = []Notifier{rec}
+
+	svc.overrideFolder(context.Background(), "outbox")
+	svc.notifications.Wait()
+	if fake.count("/rest/db/override") != 1 {
+		t.Fatalf("expected one override, got %d", fake.count("/rest/db/override"))
+	}
+	run := svc.lastRun("override:outbox")
+	if len(run.Folders) != 1 || run.Folders[0].Result != resultTriggered || run.Folders[0].Overridden != 4 {
+		t.Fatalf("unexpected run: %+v", run)
+	}
+	if len(rec.events) != 1 || rec.events[0].Type != eventOverride || rec.events[0].Fields["overridden"] != int64(4) || rec.events[0].Severity != severityWarning {
+		t.Fatalf("unexpected notifications: %+v", rec.events)
+	}
+}
+
+func TestOverrideFolderSafetyChecks(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		allow    bool
+		typ      string
+		st       syncthing.FolderStatus
+		dryRun   bool
+		result   string
+		notified bool
+	}{
+		{"not allowed", false, "sendonly", syncthing.FolderStatus{NeedFiles: 1}, false, resultSkipped, true},
+		{"not sendonly", true, "sendreceive", syncthing.FolderStatus{NeedFiles: 1}, false, resultSkipped, true},
+		{"nothing to undo", true, "sendonly", syncthing.FolderStatus{State: "idle"}, false, resultSkipped, true},
+		{"dry run", true, "sendonly", syncthing.FolderStatus{NeedFiles: 1}, true, resultDryRun, false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			fake := newFakeSyncthing(t, "outbox")
+			fake.setType("outbox", c.typ)
+			fake.setStatus("outbox", c.st)
+			svc := fake.service(t, Settings{AllowDestructive: c.allow, DryRun: c.dryRun})
+			rec := &recordingNotifier{}
+			svc.Notifiers = []Notifier{rec}
+
+			svc.overrideFolder(context.Background(), "outbox")
+			svc.notifications.Wait()
+			if fake.count("/rest/db/override") != 0 {
+				t.Fatalf("the folder was overridden")
+			}
+			if got := svc.lastRun("override:outbox").Folders[0].Result; got != c.result {
+				t.Fatalf("got result %s, want %s", got, c.result)
+			}
+			if got := len(rec.events) == 1; got != c.notified {
+				t.Fatalf("notified=%v, want %v: %+v", got, c.notified, rec.events)
+			}
+		})
+	}
+}
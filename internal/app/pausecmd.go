@@ -0,0 +1,170 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+const pauseCmdTimeout = 10 * time.Second
+
+// PauseResult is one folder's outcome of `pause` or `resume`. Paused is the state read
+// back from the config afterwards, or the current one on a dry run.
+type PauseResult struct {
+	Folder  string `json:"folder"`
+	Label   string `json:"label,omitempty"`
+	Paused  bool   `json:"paused"`
+	Changed bool   `json:"changed"` // on a dry run, whether it would change
+	Error   string `json:"error,omitempty"`
+}
+
+// FolderPattern reports whether a folder selector is a glob rather than a name.
+func FolderPattern(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// ResolveFolders turns folder IDs, labels and globs over either, optionally
+// instance-prefixed, into instance-prefixed folder IDs using each instance's folder
+// list; all lists every folder of every instance instead. Selectors that match
+// nothing, or a label shared by several folders, are an error.
+func (s *Service) ResolveFolders(ctx context.Context, names []string, all bool) ([]string, error) {
+	var out []string
+	if all {
+		for _, inst := range s.instances() {
+			list, err := s.cachedFolders(ctx, inst)
+			if err != nil {
+				return nil, fmt.Errorf("cannot list the folders of instance %s: %w", instanceName(inst), err)
+			}
+			for _, cfg := range list {
+				out = append(out, joinRef(inst, cfg.ID))
+			}
+		}
+		return out, nil
+	}
+	seen := map[string]bool{}
+	for _, name := range names {
+		inst, id := s.splitRef(name)
+		list, err := s.cachedFolders(ctx, inst)
+		if err != nil {
+			return nil, fmt.Errorf("cannot list the folders of instance %s: %w", instanceName(inst), err)
+		}
+		matches := matchFolders(list, id)
+		switch {
+		case len(matches) == 0:
+			return nil, fmt.Errorf("no folder with ID or label %q on instance %s", id, instanceName(inst))
+		case len(matches) > 1 && !FolderPattern(id):
+			return nil, fmt.Errorf("label %q is shared by folders %v on instance %s; name one by ID", id, matches, instanceName(inst))
+		}
+		for _, m := range matches {
+			if ref := joinRef(inst, m); !seen[ref] {
+				seen[ref] = true
+				out = append(out, ref)
+			}
+		}
+	}
+	if len(out) == 0 {
+		return nil, errors.New("no folders given")
+	}
+	return out, nil
+}
+
+// matchFolders returns the IDs of the folders in list that id names: by ID, by
+// label if no ID matches, or by either if it is a glob.
+func matchFolders(list []syncthing.FolderConfig, id string) []string {
+	var byID, byLabel []string
+	for _, cfg := range list {
+		switch {
+		case FolderPattern(id):
+			if idOK, _ := path.Match(id, cfg.ID); idOK {
+				byID = append(byID, cfg.ID)
+			} else if labelOK, _ := path.Match(id, cfg.Label); labelOK && cfg.Label != "" {
+				byID = append(byID, cfg.ID)
+			}
+		case cfg.ID == id:
+			byID = append(byID, cfg.ID)
+		case cfg.Label == id:
+			byLabel = append(byLabel, cfg.ID)
+		}
+	}
+	if len(byID) == 0 {
+		return byLabel
+	}
+	return byID
+}
+
+// SetFoldersPaused pauses or resumes each folder in turn and reads its paused flag
+// back from the config. A folder already in the wanted state is left alone. With
+// DRY_RUN nothing is changed and the results say what would be.
+func (s *Service) SetFoldersPaused(ctx context.Context, refs []string, paused bool) []PauseResult {
+	out := make([]PauseResult, 0, len(refs))
+	for _, ref := range refs {
+		out = append(out, s.setFolderPaused(ctx, ref, paused))
+	}
+	return out
+}
+
+func (s *Service) setFolderPaused(ctx context.Context, ref string, paused bool) PauseResult {
+	inst, id := s.splitRef(ref)
+	client := s.client(inst)
+	res := PauseResult{Folder: ref}
+	before, _, err := client.Folder(ctx, id, pauseCmdTimeout)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Label, res.Paused, res.Changed = before.Label, before.Paused, before.Paused != paused
+	if s.Settings.DryRun || !res.Changed {
+		return res
+	}
+	if _, err := client.SetFolderPaused(ctx, id, paused, pauseCmdTimeout); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	after, _, err := client.Folder(ctx, id, pauseCmdTimeout)
+	if err != nil {
+		res.Error = fmt.Sprintf("changed, but cannot read it back: %v", err)
+		return res
+	}
+	res.Paused = after.Paused
+	if after.Paused != paused {
+		res.Error = "the config did not take the change"
+	}
+	return res
+}
+
+// WritePauseTable prints the results of `pause` or `resume` as an aligned table.
+func WritePauseTable(w io.Writer, results []PauseResult, paused, dryRun bool) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FOLDER\tLABEL\tSTATE\tCHANGE\tERROR")
+	want := "resumed"
+	if paused {
+		want = "paused"
+	}
+	for _, r := range results {
+		state := "running"
+		if r.Paused {
+			state = "paused"
+		}
+		label, change := r.Label, "-"
+		if label == "" {
+			label = "-"
+		}
+		switch {
+		case r.Error != "":
+			state, change = "-", "failed"
+		case r.Changed && dryRun:
+			change = "would be " + want
+		case r.Changed:
+			change = want
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Folder, label, state, change, r.Error)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,83 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestResolveFolders(t *testing.T) {
+	def := newFakeSyncthing(t, "media", "docs", "pics-a", "pics-b")
+	def.setLabel("media", "Media")
+	def.setLabel("pics-a", "Pictures")
+	def.setLabel("pics-b", "Pictures")
+	offsite := newFakeSyncthing(t, "media")
+	svc := multiInstanceService(t, Settings{}, def, map[string]*fakeSyncthing{"offsite": offsite})
+	ctx := context.Background()
+
+	got, err := svc.ResolveFolders(ctx, []string{"Media", "docs", "offsite/media", "media"}, false)
+	if err != nil || strings.Join(got, ",") != "media,docs,offsite/media" {
+		t.Fatalf("got %v, %v", got, err)
+	}
+	if _, err := svc.ResolveFolders(ctx, []string{"Pictures"}, false); err == nil || !strings.Contains(err.Error(), "name one by ID") {
+		t.Fatalf("expected an ambiguous label to be refused, got %v", err)
+	}
+	if _, err := svc.ResolveFolders(ctx, []string{"nope"}, false); err == nil {
+		t.Fatalf("expected an unknown folder to be refused")
+	}
+	if got, err := svc.ResolveFolders(ctx, []string{"pics-*", "Pict*"}, false); err != nil || strings.Join(got, ",") != "pics-a,pics-b" {
+		t.Fatalf("got %v, %v", got, err)
+	}
+	if got, err := svc.ResolveFolders(ctx, nil, true); err != nil || len(got) != 5 || got[4] != "offsite/media" {
+		t.Fatalf("got %v, %v", got, err)
+	}
+}
+
+func TestSetFoldersPaused(t *testing.T) {
+	fake := newFakeSyncthing(t, "media", "docs")
+	fake.setLabel("media", "Media")
+	fake.setPaused("docs", true)
+	svc := fake.service(t, Settings{})
+
+	results := svc.SetFoldersPaused(context.Background(), []string{"media", "docs", "gone"}, true)
+	if !fake.paused("media") || fake.patches != 1 {
+		t.Fatalf("expected only media to be patched, got %d patches", fake.patches)
+	}
+	if r := results[0]; !r.Paused || !r.Changed || r.Label != "Media" || r.Error != "" {
+		t.Fatalf("unexpected media result: %+v", r)
+	}
+	if r := results[1]; !r.Paused || r.Changed {
+		t.Fatalf("unexpected docs result: %+v", r)
+	}
+	if results[2].Error == "" {
+		t.Fatalf("expected an error for a folder that is gone")
+	}
+	var buf bytes.Buffer
+	if err := WritePauseTable(&buf, results, true, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "media   Media  paused  paused") || !strings.Contains(buf.String(), "gone    -      -       failed") {
+		t.Fatalf("unexpected table:\n%s", buf.String())
+	}
+}
+
+func TestSetFoldersPausedDryRun(t *testing.T) {
+	fake := newFakeSyncthing(t, "media")
+	svc := fake.service(t, Settings{DryRun: true})
+
+	results := svc.SetFoldersPaused(context.Background(), []string{"media"}, true)
+	if fake.paused("media") || fake.patches != 0 {
+		t.Fatalf("a dry run changed the folder")
+	}
+	if r := results[0]; r.Paused || !r.Changed {
+		t.Fatalf("unexpected result: %+v", r)
+	}
+	var buf bytes.Buffer
+	if err := WritePauseTable(&buf, results, true, true); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "running  would be paused") {
+		t.Fatalf("unexpected table:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// Actions of the ST_PAUSE_CRON and ST_RESUME_CRON schedules, which label them
+// "pause:<folder>" and "resume:<folder>".
+const (
+	actionPause  = "pause"
+	actionResume = "resume"
+)
+
+// pauseCronJobs parses the ST_PAUSE_CRON and ST_RESUME_CRON schedules.
+func (s *Service) pauseCronJobs() ([]folderCronJob, error) {
+	var jobs []folderCronJob
+	for _, c := range []struct {
+		setting, action string
+		crons           map[string]string
+	}{
+		{"ST_PAUSE_CRON", actionPause, s.Settings.FolderPauseCron},
+		{"ST_RESUME_CRON", actionResume, s.Settings.FolderResumeCron},
+	} {
+		for _, folder := range slices.Sorted(maps.Keys(c.crons)) {
+			expr := c.crons[folder]
+			sched, err := cronParser.Parse(expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s expr for %s: %w", c.setting, folder, err)
+			}
+			paused := c.action == actionPause
+			jobs = append(jobs, folderCronJob{
+				label: c.action + ":" + folder,
+				expr:  expr,
+				sched: sched,
+				run:   func(ctx context.Context) { s.pauseOnSchedule(ctx, folder, paused) },
+			})
+		}
+	}
+	return jobs, nil
+}
+
+// pauseOnSchedule pauses or resumes folder for ST_PAUSE_CRON or ST_RESUME_CRON. A
+// folder already in that state is left alone; with DRY_RUN nothing is changed.
+func (s *Service) pauseOnSchedule(ctx context.Context, folder string, paused bool) {
+	verb, doing, done, setting := "pause", "pausing", "paused", "ST_PAUSE_CRON"
+	if !paused {
+		verb, doing, done, setting = "resume", "resuming", "resumed", "ST_RESUME_CRON"
+	}
+	inst, id := s.splitRef(folder)
+	client := s.client(inst)
+	key := verb + ":" + folder
+	name := fmt.Sprintf("folder '%s'%s", folder, s.labelSuffix(folder))
+	diff := configDiff{Subject: name, Folder: folder, Changes: []configChange{{"paused", !paused, paused}}}
+
+	cfg, _, err := client.Folder(ctx, id, pauseWindowTimeout)
+	switch {
+	case isFolderNotFound(err):
+		s.logFailure(ctx, key, verb, err, "Cannot %s %s for %s: it does not exist on instance %s", verb, name, setting, instanceName(inst))
+		return
+	case err != nil:
+		s.logFailure(ctx, key, verb, err, "Cannot read %s to %s it: %v", name, verb, err)
+		return
+	case cfg.Paused == paused:
+		s.log(ctx).Printf("Not %s %s for %s: it is already %s", doing, name, setting, done)
+		if !paused {
+			s.ownCronPause(folder, false)
+		}
+		return
+	case s.Settings.DryRun:
+		s.log(ctx).Printf("[dry-run] Would %s %s for %s", verb, name, setting)
+		s.logConfigDiff(ctx, diff)
+		return
+	}
+
+	if paused {
+		_, err = client.PauseFolder(ctx, id, pauseWindowTimeout)
+	} else {
+		_, err = client.ResumeFolder(ctx, id, pauseWindowTimeout)
+	}
+	if err != nil {
+		s.logFailure(ctx, key, verb, err, "Failed to %s %s for %s: %v", verb, name, setting, err)
+		return
+	}
+	s.logSuccess(ctx, key, verb)
+	s.log(ctx).Printf("%s %s for %s", capitalize(done), name, setting)
+	s.logConfigDiff(ctx, diff)
+	s.ownCronPause(folder, paused)
+}
+
+// ownCronPause records whether ST_PAUSE_CRON has folder paused, so the paused
+// folder check does not warn about it.
+func (s *Service) ownCronPause(folder string, paused bool) {
+	var at time.Time
+	if paused {
+		at = time.Now().UTC()
+	}
+	if err := s.stateStore().updateFolder(s.missingRef(folder), func(f *FolderState) { f.CronPaused = at }); err != nil {
+		s.Logger.Printf("Failed to save state: %v", err)
+	}
+}
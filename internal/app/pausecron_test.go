@@ -0,0 +1,124 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+func TestParsePauseCron(t *testing.T) {
+	got, err := parseFolderSchedules("ST_PAUSE_CRON", "docs: 0 9 * * 1-5 # work hours\nnas/media: \"0 8 * * *\"\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["docs"] != "0 9 * * 1-5" || got["nas/media"] != "0 8 * * *" {
+		t.Fatalf("unexpected schedules: %q", got)
+	}
+	for _, c := range []struct{ raw, want string }{
+		{"docs 0 9 * * *", "Invalid ST_PAUSE_CRON line 1"},
+		{"docs: override 0 9 * * *", "Expected 'folderId: <cron expr>'"},
+		{"docs: 0 25 * * *", "invalid ST_PAUSE_CRON expr for docs"},
+	} {
+		if _, err := parseFolderSchedules("ST_PAUSE_CRON", c.raw); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Fatalf("parse %q: got %v, want %s", c.raw, err, c.want)
+		}
+	}
+}
+
+func TestPauseCronPausesAndResumes(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	svc := fake.service(t, Settings{
+		FolderPauseCron:  map[string]string{"docs": "0 9 * * 1-5"},
+		FolderResumeCron: map[string]string{"docs": "0 18 * * 1-5"},
+	})
+	var buf syncBuffer
+	svc.Logger = log.New(&buf, "", 0)
+	ctx := context.Background()
+
+	jobs, err := svc.pauseCronJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 || jobs[0].label != "pause:docs" || jobs[1].label != "resume:docs" {
+		t.Fatalf("unexpected jobs: %+v", jobs)
+	}
+
+	svc.Settings.DryRun = true
+	jobs[0].run(ctx)
+	if fake.paused("docs") || fake.patches != 0 {
+		t.Fatalf("dry run paused the folder")
+	}
+	if !strings.Contains(buf.String(), "[dry-run] Would pause folder 'docs' for ST_PAUSE_CRON") {
+		t.Fatalf("expected the dry run to be logged:\n%s", buf.String())
+	}
+
+	svc.Settings.DryRun = false
+	jobs[0].run(ctx)
+	jobs[0].run(ctx)
+	if !fake.paused("docs") || fake.patches != 1 {
+		t.Fatalf("expected docs paused once, got paused=%v after %d patches", fake.paused("docs"), fake.patches)
+	}
+	jobs[1].run(ctx)
+	if fake.paused("docs") || fake.patches != 2 {
+		t.Fatalf("expected docs resumed")
+	}
+	for _, want := range []string{
+		"Paused folder 'docs' for ST_PAUSE_CRON",
+		"Not pausing folder 'docs' for ST_PAUSE_CRON: it is already paused",
+		"Resumed folder 'docs' for ST_RESUME_CRON",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("expected %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestPausedFolderCheckSkipsPauseCron(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	svc := fake.service(t, Settings{
+		CronExpr:         "0 * * * *",
+		Folders:          []string{"docs"},
+		FolderPauseCron:  map[string]string{"docs": "0 9 * * *"},
+		FolderResumeCron: map[string]string{"docs": "0 18 * * *"},
+	})
+	var buf syncBuffer
+	svc.Logger = log.New(&buf, "", 0)
+	ctx := context.Background()
+
+	svc.pauseOnSchedule(ctx, "docs", true)
+	svc.checkPausedFolders(ctx)
+	if len(svc.inactive.snapshot()) != 0 || strings.Contains(buf.String(), "Warning: folder docs") {
+		t.Fatalf("warned about a folder ST_PAUSE_CRON paused:\n%s", buf.String())
+	}
+	plans, err := svc.ScanPlans(time.Date(2024, 5, 6, 12, 10, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := plans[0]; p.Next.Hour() != 18 || len(p.HeldBy) != 1 || p.HeldBy[0] != "paused by ST_PAUSE_CRON" {
+		t.Fatalf("expected the scan held until ST_RESUME_CRON, got %+v", p)
+	}
+
+	svc.pauseOnSchedule(ctx, "docs", false)
+	fake.setPaused("docs", true) // by hand, this time
+	svc.checkPausedFolders(ctx)
+	if !strings.Contains(buf.String(), "Warning: folder docs is paused in Syncthing") {
+		t.Fatalf("expected a warning for a folder paused by hand:\n%s", buf.String())
+	}
+}
+
+func TestPauseFolderUnknownFolder(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	svc := fake.service(t, Settings{})
+	code, err := svc.Client.PauseFolder(context.Background(), "ghost", pauseWindowTimeout)
+	if !errors.Is(err, syncthing.ErrFolderNotFound) || code != 404 {
+		t.Fatalf("expected a folder-not-found error, got %d %v", code, err)
+	}
+	if _, err := svc.Client.ResumeFolder(context.Background(), "docs", pauseWindowTimeout); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,133 @@
+package app
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// pausedCheckInterval is how often the configured folders are checked for being
+// paused or stopped after the check at startup.
+var pausedCheckInterval = time.Hour
+
+// inactiveFolders are the configured folders last found paused or stopped in
+// Syncthing, with which of the two. The zero value is ready to use.
+type inactiveFolders struct {
+	mu      sync.Mutex
+	folders map[string]string
+}
+
+// replace records found as the current set and returns the folders that were not
+// in the previous one and those that left it, both sorted.
+func (i *inactiveFolders) replace(found map[string]string) (added, gone []string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for ref := range found {
+		if _, ok := i.folders[ref]; !ok {
+			added = append(added, ref)
+		}
+	}
+	for ref := range i.folders {
+		if _, ok := found[ref]; !ok {
+			gone = append(gone, ref)
+		}
+	}
+	i.folders = found
+	sort.Strings(added)
+	sort.Strings(gone)
+	return added, gone
+}
+
+// snapshot returns the current set, keyed by folder reference.
+func (i *inactiveFolders) snapshot() map[string]string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	out := make(map[string]string, len(i.folders))
+	for ref, why := range i.folders {
+		out[ref] = why
+	}
+	return out
+}
+
+// runPausedFolderCheck looks for paused or stopped folders once at startup, in the
+// background so a slow config read does not hold up the first scans. The scheduler
+// repeats the check every pausedCheckInterval.
+func (s *Service) runPausedFolderCheck(ctx context.Context) {
+	s.watchers.Add(1)
+	go func() {
+		defer s.watchers.Done()
+		s.checkPausedFolders(ctx)
+	}()
+}
+
+// checkPausedFolders looks for configured folders that are paused in Syncthing's
+// config or whose status is paused or stopped, as their scheduled scans do nothing.
+// Newly found ones are logged as a warning and noted in the digest; they degrade
+// health until they run again. Folders the kicker paused for a pause window and
+// those in ST_IGNORE_PAUSED are left out. An instance that cannot be read keeps
+// what was found before.
+func (s *Service) checkPausedFolders(ctx context.Context) {
+	if slices.Contains(s.Settings.IgnorePaused, "*") {
+		return
+	}
+	ignored := map[string]bool{}
+	for _, ref := range s.Settings.IgnorePaused {
+		ignored[s.missingRef(ref)] = true
+	}
+	previous := s.inactive.snapshot()
+	found := map[string]string{}
+	paused := map[string]map[string]bool{} // by instance; nil when its config cannot be read
+	for _, ref := range s.configuredFolders(ctx, "paused folder check") {
+		inst, id := s.splitRef(ref)
+		key := s.missingRef(ref)
+		if st := s.stateStore().folder(key); id == "*" || ignored[key] || !st.WindowPaused.IsZero() || !st.CronPaused.IsZero() {
+			continue
+		}
+		ids, fetched := paused[inst]
+		if !fetched {
+			if list, err := s.cachedFolderIDs(ctx, inst); err == nil {
+				ids = map[string]bool{}
+				for _, f := range list {
+					ids[f.ID] = f.Paused
+				}
+			}
+			paused[inst] = ids
+		}
+		if ids == nil {
+			if why, ok := previous[key]; ok {
+				found[key] = why
+			}
+			continue
+		}
+		if ids[id] {
+			found[key] = "paused"
+			continue
+		}
+		st, err := s.folderStatus(ctx, ref, 10*time.Second, false)
+		switch {
+		case err != nil:
+			if why, ok := previous[key]; ok {
+				found[key] = why
+			}
+		case st.State == "paused" || st.State == "stopped":
+			found[key] = st.State
+		}
+	}
+
+	added, gone := s.inactive.replace(found)
+	for _, ref := range added {
+		s.log(ctx).Printf("Warning: folder %s%s is %s in Syncthing; its scheduled scans do nothing until it runs again (list it in ST_IGNORE_PAUSED if that is intended)", ref, s.labelSuffix(ref), found[ref])
+		err := s.stateStore().updateDigest(ref, func(f *DigestFolder) bool {
+			f.Inactive = found[ref]
+			return true
+		})
+		if err != nil {
+			s.Logger.Printf("Failed to save state: %v", err)
+		}
+	}
+	for _, ref := range gone {
+		s.log(ctx).Printf("Folder %s%s is no longer %s in Syncthing", ref, s.labelSuffix(ref), previous[ref])
+	}
+}
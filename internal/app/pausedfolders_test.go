@@ -0,0 +1,95 @@
+package app
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+	"github.com/rcarmo/syncthing-kicker/internal/syncthingtest"
+)
+
+func TestPausedFoldersWarnDegradeAndDigest(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs", "media", "notes")
+	fake.folders[1].Paused = true
+	fake.status["notes"] = syncthing.FolderStatus{State: "stopped"}
+	var logs syncBuffer
+	svc := fake.service(t, Settings{Folders: []string{"*"}, StateFile: filepath.Join(t.TempDir(), "state.json")})
+	svc.Logger = log.New(&logs, "", 0)
+	ctx := context.Background()
+
+	svc.checkPausedFolders(ctx)
+	svc.checkPausedFolders(ctx)
+	out := logs.String()
+	if strings.Count(out, "Warning: folder media is paused in Syncthing") != 1 || strings.Count(out, "Warning: folder notes is stopped in Syncthing") != 1 || strings.Contains(out, "folder docs") {
+		t.Fatalf("expected one warning each for media and notes:\n%s", out)
+	}
+	if level, reason := svc.assessHealth(time.Now()); level != levelDegraded || reason != "folder media paused; folder notes stopped" {
+		t.Fatalf("expected degraded by the inactive folders, got %s %q", level, reason)
+	}
+	d, _ := svc.stateStore().takeDigest(time.Now())
+	if msg := formatDigest(d, time.Now()); !strings.Contains(msg, "media: 0 scans") || !strings.Contains(msg, "found paused in Syncthing") || !strings.Contains(msg, "found stopped in Syncthing") {
+		t.Fatalf("expected both folders in the digest:\n%s", msg)
+	}
+
+	fake.mu.Lock()
+	fake.folders[1].Paused = false
+	fake.status["notes"] = syncthing.FolderStatus{State: "idle"}
+	fake.mu.Unlock()
+	svc.checkPausedFolders(ctx)
+	if !strings.Contains(logs.String(), "Folder media is no longer paused in Syncthing") {
+		t.Fatalf("expected media to be reported running again:\n%s", logs.String())
+	}
+	if level, _ := svc.assessHealth(time.Now()); level != levelHealthy {
+		t.Fatalf("expected healthy once both run again, got %s", level)
+	}
+}
+
+func TestPausedFoldersIgnored(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs", "media", "notes")
+	fake.folders[1].Paused = true
+	fake.folders[2].Paused = true
+	settings := Settings{
+		Folders:      []string{"docs", "notes"},
+		FolderCron:   map[string]string{"media": "0 3 * * *"},
+		IgnorePaused: []string{"default/notes"},
+		StateFile:    filepath.Join(t.TempDir(), "state.json"),
+	}
+	svc := fake.service(t, settings)
+	if err := svc.stateStore().updateFolder("media", func(f *FolderState) { f.WindowPaused = time.Now() }); err != nil {
+		t.Fatal(err)
+	}
+	svc.checkPausedFolders(context.Background())
+	if got := svc.inactive.snapshot(); len(got) != 0 {
+		t.Fatalf("expected window-paused and ignored folders to be left out, got %v", got)
+	}
+
+	settings.IgnorePaused = []string{"*"}
+	svc = fake.service(t, settings)
+	svc.checkPausedFolders(context.Background())
+	if got := svc.inactive.snapshot(); len(got) != 0 {
+		t.Fatalf("expected ST_IGNORE_PAUSED=* to silence the check, got %v", got)
+	}
+}
+
+func TestPausedFolderCheckDoesNotHoldUpStartup(t *testing.T) {
+	srv := syncthingtest.New(t, "docs")
+	srv.Inject(syncthingtest.Fault{Path: "/rest/system/config", Delay: time.Second})
+	svc := harnessService(t, srv, Settings{Folders: []string{"docs"}, ScanOnStartup: true, RunOnce: true})
+
+	done := make(chan error, 1)
+	go func() { done <- svc.Run(context.Background()) }()
+	deadline := time.Now().Add(500 * time.Millisecond)
+	for len(srv.Scans()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("the startup scan waited for the paused folder check")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
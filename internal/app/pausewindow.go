@@ -0,0 +1,258 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// pauseWindowInterval is how often pause windows are checked; windows are set to
+// the minute.
+var pauseWindowInterval = 30 * time.Second
+
+const pauseWindowTimeout = 10 * time.Second
+
+// PauseWindow is a time of day, in minutes since midnight, on some weekdays. A
+// window whose end is not after its start runs past midnight into the next day.
+type PauseWindow struct {
+	Start, End int
+	Days       [7]bool // indexed by time.Weekday: the days the window opens on
+	Spec       string  // as configured, for logs
+}
+
+// contains reports whether t (in the scheduler timezone) falls inside the window.
+func (w PauseWindow) contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	if w.Start < w.End {
+		return w.Days[day] && m >= w.Start && m < w.End
+	}
+	return (w.Days[day] && m >= w.Start) || (w.Days[(day+6)%7] && m < w.End)
+}
+
+// openPauseWindow returns the first of windows that contains t, if any.
+func openPauseWindow(windows []PauseWindow, t time.Time) (PauseWindow, bool) {
+	for _, w := range windows {
+		if w.contains(t) {
+			return w, true
+		}
+	}
+	return PauseWindow{}, false
+}
+
+// schedulerLocation is the timezone cron schedules and pause windows are read in.
+func (s *Service) schedulerLocation() *time.Location {
+	if loc, err := s.Settings.Location(); err == nil {
+		return loc
+	}
+	return time.Local
+}
+
+// runPauseWindows keeps folders and devices paused during their ST_PAUSE_WINDOWS
+// and ST_DEVICE_PAUSE_WINDOWS, and folder watchers off during their
+// ST_WATCHER_OFF_WINDOWS. It reconciles at once, so a window that opened or closed
+// while the daemon was down is caught up with, and then every pauseWindowInterval.
+func (s *Service) runPauseWindows(ctx context.Context) {
+	if len(s.Settings.PauseWindows) == 0 && len(s.Settings.DevicePauseWindows) == 0 && len(s.Settings.WatcherOffWindows) == 0 &&
+		len(s.stateStore().windowPausedFolders()) == 0 && len(s.stateStore().windowPausedDevices()) == 0 &&
+		len(s.stateStore().watcherOffFolders()) == 0 {
+		return
+	}
+	s.watchers.Add(1)
+	go func() {
+		defer s.watchers.Done()
+		ticker := time.NewTicker(pauseWindowInterval)
+		defer ticker.Stop()
+		for {
+			s.reconcilePauseWindows(ctx, time.Now())
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// pauseTarget is a folder or device pause windows apply to, or a folder watcher
+// that watcher windows turn off ("paused" then meaning the watcher is off).
+type pauseTarget struct {
+	key     string // "folder:", "device:" or "watcher:" plus the instance-prefixed ID; keys windowLeft and failure logs
+	name    string // how logs refer to it, e.g. "folder 'docs' (Documents)"
+	folder  string // the folder reference, for folder and watcher targets
+	verbs   windowVerbs
+	windows []PauseWindow
+	ours    bool // the kicker paused it, as recorded in the state file
+	// paused reads whether Syncthing has it paused; exists is false once it is gone.
+	paused func(ctx context.Context) (paused, exists bool, err error)
+	set    func(ctx context.Context, paused bool) error
+	own    func(since time.Time) error // records (or, with a zero since, forgets) that the kicker paused it
+}
+
+// windowVerbs words what a kind of window does to its targets, for logs.
+type windowVerbs struct {
+	window         string // "pause window"
+	apply, applied string // "pause", "paused"
+	undo, undone   string // "resume", "resumed"
+	undoing        string // "resuming"
+	field          string // the config field the window sets, e.g. "paused"
+	appliedValue   bool   // what the field holds while the window applies
+}
+
+var (
+	pauseVerbs   = windowVerbs{"pause window", "pause", "paused", "resume", "resumed", "resuming", "paused", true}
+	watcherVerbs = windowVerbs{"watcher window", "turn off", "turned off", "turn on", "turned on", "turning on", "fsWatcherEnabled", false}
+)
+
+// diff is the config change applying (or undoing) the window makes to t.
+func (t pauseTarget) diff(apply bool) configDiff {
+	value := func(applied bool) bool { return applied == t.verbs.appliedValue }
+	return configDiff{Subject: t.name, Folder: t.folder, Changes: []configChange{{t.verbs.field, value(!apply), value(apply)}}}
+}
+
+// reconcilePauseWindows pauses the folders and devices whose window is open and
+// resumes the ones the kicker paused whose window has closed (or was removed from
+// the settings). One already paused when its window opens was paused by someone
+// else and is left alone, as is one resumed by hand during its window.
+func (s *Service) reconcilePauseWindows(ctx context.Context, now time.Time) {
+	now = now.In(s.schedulerLocation())
+	targets := append(s.folderPauseTargets(), s.devicePauseTargets(ctx)...)
+	for _, t := range append(targets, s.watcherTargets()...) {
+		w, open := openPauseWindow(t.windows, now)
+		switch {
+		case !open:
+			s.windowLeft.Delete(t.key)
+			if t.ours {
+				s.resumeAfterWindow(ctx, t)
+			}
+		case !t.ours:
+			if _, left := s.windowLeft.Load(t.key); !left {
+				s.pauseForWindow(ctx, t, w, now)
+			}
+		}
+	}
+}
+
+func (s *Service) pauseForWindow(ctx context.Context, t pauseTarget, w PauseWindow, now time.Time) {
+	v := t.verbs
+	paused, _, err := t.paused(ctx)
+	if err != nil {
+		s.logFailure(ctx, t.key, v.window, err, "Cannot check %s for its %s: %v", t.name, v.window, err)
+		return
+	}
+	if paused {
+		s.windowLeft.Store(t.key, true)
+		s.log(ctx).Printf("Leaving %s alone during its %s: it is already %s", t.name, v.window, v.applied)
+		return
+	}
+	if s.Settings.DryRun {
+		s.windowLeft.Store(t.key, true)
+		s.log(ctx).Printf("[dry-run] Would %s %s for %s %s", v.apply, t.name, v.window, w.Spec)
+		s.logConfigDiff(ctx, t.diff(true))
+		return
+	}
+	if err := t.set(ctx, true); err != nil {
+		s.logFailure(ctx, t.key, v.window, err, "Failed to %s %s: %v", v.apply, t.name, err)
+		return
+	}
+	s.logSuccess(ctx, t.key, v.window)
+	s.log(ctx).Printf("%s %s for %s %s", capitalize(v.applied), t.name, v.window, w.Spec)
+	s.logConfigDiff(ctx, t.diff(true))
+	if err := t.own(now.UTC()); err != nil {
+		s.Logger.Printf("Failed to save state: %v", err)
+	}
+}
+
+func (s *Service) resumeAfterWindow(ctx context.Context, t pauseTarget) {
+	v := t.verbs
+	paused, exists, err := t.paused(ctx)
+	if err != nil {
+		s.logFailure(ctx, t.key, v.window, err, "Cannot check %s to %s it: %v", t.name, v.undo, err)
+		return
+	}
+	switch {
+	case !exists:
+		s.log(ctx).Printf("Forgetting %s %s for its %s: it no longer exists", t.name, v.applied, v.window)
+	case !paused:
+		s.log(ctx).Printf("Not %s %s: it was %s during its %s", v.undoing, t.name, v.undone, v.window)
+	case s.Settings.DryRun:
+		s.log(ctx).Printf("[dry-run] Would %s %s: its %s closed", v.undo, t.name, v.window)
+		s.logConfigDiff(ctx, t.diff(false))
+		return
+	default:
+		if err := t.set(ctx, false); err != nil {
+			s.logFailure(ctx, t.key, v.window, err, "Failed to %s %s: %v", v.undo, t.name, err)
+			return
+		}
+		s.logSuccess(ctx, t.key, v.window)
+		s.log(ctx).Printf("%s %s: its %s closed", capitalize(v.undone), t.name, v.window)
+		s.logConfigDiff(ctx, t.diff(false))
+	}
+	if err := t.own(time.Time{}); err != nil {
+		s.Logger.Printf("Failed to save state: %v", err)
+	}
+}
+
+// capitalize upper-cases the first letter of an ASCII word.
+func capitalize(word string) string {
+	if word == "" {
+		return word
+	}
+	return strings.ToUpper(word[:1]) + word[1:]
+}
+
+// folderPauseTargets lists the folders with an ST_PAUSE_WINDOWS window or paused by one.
+func (s *Service) folderPauseTargets() []pauseTarget {
+	windows := map[string][]PauseWindow{}
+	for folder, ws := range s.Settings.PauseWindows {
+		ref := s.missingRef(folder)
+		windows[ref] = append(windows[ref], ws...)
+	}
+	for _, ref := range s.stateStore().windowPausedFolders() {
+		if _, ok := windows[ref]; !ok {
+			windows[ref] = nil
+		}
+	}
+	var out []pauseTarget
+	for _, ref := range slices.Sorted(maps.Keys(windows)) {
+		inst, id := s.splitRef(ref)
+		client := s.client(inst)
+		out = append(out, pauseTarget{
+			key:     "folder:" + ref,
+			name:    fmt.Sprintf("folder '%s'%s", ref, s.labelSuffix(ref)),
+			folder:  ref,
+			verbs:   pauseVerbs,
+			windows: windows[ref],
+			ours:    !s.stateStore().folder(ref).WindowPaused.IsZero(),
+			paused: func(ctx context.Context) (bool, bool, error) {
+				cfg, _, err := client.Folder(ctx, id, pauseWindowTimeout)
+				if isFolderNotFound(err) {
+					return false, false, nil
+				}
+				return cfg.Paused, err == nil, err
+			},
+			set: func(ctx context.Context, paused bool) error {
+				_, err := client.SetFolderPaused(ctx, id, paused, pauseWindowTimeout)
+				return err
+			},
+			own: func(since time.Time) error {
+				return s.stateStore().updateFolder(ref, func(f *FolderState) { f.WindowPaused = since })
+			},
+		})
+	}
+	return out
+}
+
+// pausedForWindow reports whether folder is paused by a pause window, in which case
+// scans skip it rather than have Syncthing reject them.
+func (s *Service) pausedForWindow(ctx context.Context, folder string) bool {
+	since := s.stateStore().folder(s.missingRef(folder)).WindowPaused
+	if since.IsZero() {
+		return false
+	}
+	s.log(ctx).Printf("Folder '%s'%s is paused for its pause window (since %s); skipping scan", folder, s.labelSuffix(folder), since.Format(time.RFC3339))
+	return true
+}
@@ -0,0 +1,156 @@
+package app
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPauseWindowContains(t *testing.T) {
+	workHours, err := parsePauseWindow("08:00-18:00 Mon-Fri")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	overnight, err := parsePauseWindow("22:00-06:00 Fri,Sat")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	// 2024-05-06 is a Monday.
+	at := func(day, hour, minute int) time.Time { return time.Date(2024, 5, day, hour, minute, 0, 0, time.UTC) }
+	for _, c := range []struct {
+		w    PauseWindow
+		t    time.Time
+		want bool
+	}{
+		{workHours, at(6, 8, 0), true},
+		{workHours, at(6, 7, 59), false},
+		{workHours, at(6, 17, 59), true},
+		{workHours, at(6, 18, 0), false},
+		{workHours, at(11, 12, 0), false}, // Saturday
+		{overnight, at(10, 23, 0), true},  // Friday night
+		{overnight, at(11, 5, 59), true},  // early Saturday, still Friday's window
+		{overnight, at(12, 3, 0), true},   // early Sunday, Saturday's window
+		{overnight, at(13, 3, 0), false},  // early Monday: no window opened on Sunday
+		{overnight, at(10, 12, 0), false},
+	} {
+		if got := c.w.contains(c.t); got != c.want {
+			t.Fatalf("%s at %s: got %v, want %v", c.w.Spec, c.t.Format("Mon 15:04"), got, c.want)
+		}
+	}
+}
+
+func TestPauseWindowsPauseAndResume(t *testing.T) {
+	fake := newFakeSyncthing(t, "media", "docs")
+	settings := Settings{
+		CronTimezone: "UTC",
+		StateFile:    filepath.Join(t.TempDir(), "state.json"),
+		PauseWindows: map[string][]PauseWindow{"media": {mustPauseWindow(t, "08:00-18:00 Mon-Fri")}},
+	}
+	svc := fake.service(t, settings)
+	ctx := context.Background()
+	monday := func(hour int) time.Time { return time.Date(2024, 5, 6, hour, 0, 0, 0, time.UTC) }
+
+	svc.reconcilePauseWindows(ctx, monday(7))
+	if fake.paused("media") || fake.patches != 0 {
+		t.Fatalf("media should not be paused before its window")
+	}
+	svc.reconcilePauseWindows(ctx, monday(9))
+	svc.reconcilePauseWindows(ctx, monday(10))
+	if !fake.paused("media") || fake.patches != 1 {
+		t.Fatalf("expected media paused once, got paused=%v after %d patches", fake.paused("media"), fake.patches)
+	}
+	if got := svc.triggerScanPath(ctx, "media", ""); got != resultSkipped {
+		t.Fatalf("expected the paused folder's scan to be skipped, got %s", got)
+	}
+
+	// The daemon was down when the window closed; a restart resumes the folder.
+	if err := svc.FlushState(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	restarted := fake.service(t, settings)
+	restarted.reconcilePauseWindows(ctx, monday(19))
+	if fake.paused("media") || fake.patches != 2 {
+		t.Fatalf("expected media resumed after the window, got paused=%v after %d patches", fake.paused("media"), fake.patches)
+	}
+	if got := restarted.triggerScanPath(ctx, "media", ""); got != resultTriggered {
+		t.Fatalf("expected scans to resume, got %s", got)
+	}
+}
+
+func TestPauseWindowsDryRunResume(t *testing.T) {
+	fake := newFakeSyncthing(t, "media")
+	settings := Settings{
+		CronTimezone: "UTC",
+		StateFile:    filepath.Join(t.TempDir(), "state.json"),
+		PauseWindows: map[string][]PauseWindow{"media": {mustPauseWindow(t, "08:00-18:00")}},
+	}
+	svc := fake.service(t, settings)
+	ctx := context.Background()
+	day := func(hour int) time.Time { return time.Date(2024, 5, 6, hour, 0, 0, 0, time.UTC) }
+	svc.reconcilePauseWindows(ctx, day(9))
+	if err := svc.FlushState(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	// Restarted with DRY_RUN while the folder is still paused by its window.
+	settings.DryRun = true
+	dry := fake.service(t, settings)
+	var buf syncBuffer
+	dry.Logger = log.New(&buf, "", 0)
+	dry.reconcilePauseWindows(ctx, day(19))
+	if !fake.paused("media") || fake.patches != 1 {
+		t.Fatalf("a dry run resumed the folder: paused=%v after %d patches", fake.paused("media"), fake.patches)
+	}
+	if !strings.Contains(buf.String(), "[dry-run] Would resume folder 'media'") {
+		t.Fatalf("expected the resume to be logged:\n%s", buf.String())
+	}
+	if dry.stateStore().folder("media").WindowPaused.IsZero() {
+		t.Fatalf("a dry run forgot the folder was paused by its window")
+	}
+}
+
+func TestPauseWindowsLeaveManualPausesAlone(t *testing.T) {
+	fake := newFakeSyncthing(t, "media", "docs")
+	svc := fake.service(t, Settings{
+		CronTimezone: "UTC",
+		StateFile:    filepath.Join(t.TempDir(), "state.json"),
+		PauseWindows: map[string][]PauseWindow{
+			"media": {mustPauseWindow(t, "08:00-18:00")},
+			"docs":  {mustPauseWindow(t, "08:00-18:00")},
+		},
+	})
+	ctx := context.Background()
+	day := func(hour int) time.Time { return time.Date(2024, 5, 6, hour, 0, 0, 0, time.UTC) }
+
+	// Paused in the GUI before the window opened: not ours to resume.
+	fake.setPaused("media", true)
+	svc.reconcilePauseWindows(ctx, day(9))
+	// Resumed in the GUI during the window: not paused again until the next one.
+	fake.setPaused("docs", false)
+	svc.reconcilePauseWindows(ctx, day(10))
+	if fake.paused("docs") {
+		t.Fatalf("a manual resume was undone")
+	}
+	svc.reconcilePauseWindows(ctx, day(19))
+	if !fake.paused("media") {
+		t.Fatalf("a manual pause was undone")
+	}
+	if fake.patches != 1 {
+		t.Fatalf("expected only docs to be paused, got %d patches", fake.patches)
+	}
+	if st := svc.stateStore().folder("docs"); !st.WindowPaused.IsZero() {
+		t.Fatalf("expected docs to be forgotten once its window closed: %+v", st)
+	}
+}
+
+func mustPauseWindow(t *testing.T, spec string) PauseWindow {
+	t.Helper()
+	w, err := parsePauseWindow(spec)
+	if err != nil {
+		t.Fatalf("parse %q: %v", spec, err)
+	}
+	return w
+}
@@ -0,0 +1,156 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+// eventDeviceAccepted is raised when a pending device is added to the config.
+const eventDeviceAccepted = "device_accepted"
+
+const pendingDeviceTimeout = 10 * time.Second
+
+// pendingDeviceInterval is how often pending devices are checked.
+var pendingDeviceInterval = time.Minute
+
+// DevicePattern is one ST_AUTO_ACCEPT_DEVICES entry: a device ID or the start of one,
+// optionally also requiring a glob over the name a device announces. Anyone can
+// announce any name, so a name alone is never enough.
+type DevicePattern struct {
+	ID   string // upper case
+	Name string
+}
+
+func (p DevicePattern) String() string {
+	if p.Name != "" {
+		return "name:" + p.Name + "@" + p.ID
+	}
+	return p.ID
+}
+
+func (p DevicePattern) matches(id, name string) bool {
+	if p.Name != "" {
+		if ok, _ := path.Match(p.Name, name); !ok {
+			return false
+		}
+	}
+	return p.ID != "" && strings.HasPrefix(strings.ToUpper(id), p.ID)
+}
+
+// runPendingDevices checks for pending devices, and with ST_AUTO_ACCEPT_FOLDERS
+// pending folders, now and every pendingDeviceInterval while ST_AUTO_ACCEPT_DEVICES
+// is set.
+func (s *Service) runPendingDevices(ctx context.Context) {
+	if len(s.Settings.AutoAcceptDevices) == 0 {
+		return
+	}
+	s.watchers.Add(1)
+	go func() {
+		defer s.watchers.Done()
+		ticker := time.NewTicker(pendingDeviceInterval)
+		defer ticker.Stop()
+		for {
+			s.checkPendingDevices(ctx)
+			if len(s.Settings.AutoAcceptFolders) > 0 {
+				s.checkPendingFolders(ctx)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// checkPendingDevices accepts the pending devices of every instance that match
+// ST_AUTO_ACCEPT_DEVICES and reports the others. Each device is handled once; one
+// that could not be added is tried again on the next check.
+func (s *Service) checkPendingDevices(ctx context.Context) {
+	for _, inst := range s.instances() {
+		client := s.client(inst)
+		key := joinRef(inst, "*")
+		pending, _, err := client.PendingDevices(ctx, pendingDeviceTimeout)
+		if err != nil {
+			s.logFailure(ctx, key, "pending devices", err, "Cannot list the pending devices of instance %s: %v", instanceName(inst), err)
+			continue
+		}
+		s.logSuccess(ctx, key, "pending devices")
+		for _, id := range slices.Sorted(maps.Keys(pending)) {
+			ref := joinRef(inst, id)
+			if _, seen := s.pendingSeen.Load(ref); seen {
+				continue
+			}
+			if s.handlePendingDevice(ctx, inst, id, pending[id]) {
+				s.pendingSeen.Store(ref, struct{}{})
+			}
+		}
+	}
+}
+
+// handlePendingDevice accepts or reports one pending device. It returns false if the
+// device should be looked at again on the next check.
+func (s *Service) handlePendingDevice(ctx context.Context, inst, id string, dev syncthing.PendingDevice) bool {
+	name := fmt.Sprintf("device %s", id)
+	if dev.Name != "" {
+		name += fmt.Sprintf(" (%s)", dev.Name)
+	}
+	if inst != "" {
+		name += " on instance " + inst
+	}
+	var rule DevicePattern
+	matched := false
+	for _, p := range s.Settings.AutoAcceptDevices {
+		if p.matches(id, dev.Name) {
+			rule, matched = p, true
+			break
+		}
+	}
+	switch {
+	case !matched:
+		s.log(ctx).Printf("Pending %s at %s does not match ST_AUTO_ACCEPT_DEVICES; leaving it to be accepted by hand", name, dev.Address)
+		return true
+	case !s.Settings.AllowDestructive:
+		s.log(ctx).Printf("Not accepting pending %s, matching '%s': ST_ALLOW_DESTRUCTIVE is not set", name, rule)
+		return true
+	}
+	nd := syncthing.NewDevice{
+		DeviceID:          id,
+		Name:              dev.Name,
+		Introducer:        s.Settings.AutoAcceptIntroducer,
+		AutoAcceptFolders: s.Settings.AutoAcceptShares,
+	}
+	diff := configDiff{Subject: name, Changes: []configChange{
+		{"deviceID", nil, nd.DeviceID},
+		{"name", nil, nd.Name},
+		{"introducer", nil, nd.Introducer},
+		{"autoAcceptFolders", nil, nd.AutoAcceptFolders},
+	}}
+	if s.Settings.DryRun {
+		s.log(ctx).Printf("[dry-run] Would accept pending %s at %s, matching '%s'", name, dev.Address, rule)
+		s.logConfigDiff(ctx, diff)
+		return true
+	}
+	_, err := s.client(inst).AddDevice(ctx, nd, pendingDeviceTimeout)
+	if err != nil {
+		s.logFailure(ctx, "device:"+joinRef(inst, id), "accept", err, "Failed to accept pending %s: %v", name, err)
+		return false
+	}
+	s.logSuccess(ctx, "device:"+joinRef(inst, id), "accept")
+	s.log(ctx).Printf("Accepted pending %s at %s, matching '%s'", name, dev.Address, rule)
+	s.logConfigDiff(ctx, diff)
+	s.notify(NotifyEvent{
+		Type:     eventDeviceAccepted,
+		Instance: instanceName(inst),
+		Message:  fmt.Sprintf("Accepted pending %s, matching ST_AUTO_ACCEPT_DEVICES entry '%s'", name, rule),
+		Fields:   map[string]any{"deviceID": id, "name": dev.Name, "address": dev.Address, "rule": rule.String()},
+	})
+	return true
+}
@@ -0,0 +1,90 @@
+package app
+
+import (
+	"context"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+const (
+	pendingLaptopID  = "LAPTOPA-AAAAAAA-BBBBBBB-CCCCCCC-DDDDDDD-EEEEEEE-FFFFFFF-GGGGGGG"
+	pendingPhoneID   = "PHONEBB-AAAAAAA-BBBBBBB-CCCCCCC-DDDDDDD-EEEEEEE-FFFFFFF-GGGGGGG"
+	pendingUnknownID = "UNKNOWN-AAAAAAA-BBBBBBB-CCCCCCC-DDDDDDD-EEEEEEE-FFFFFFF-GGGGGGG"
+)
+
+func TestCheckPendingDevices(t *testing.T) {
+	fake := newFakeSyncthing(t)
+	fake.pending = map[string]syncthing.PendingDevice{
+		pendingLaptopID:  {Name: "laptop", Address: "192.0.2.1:22000"},
+		pendingPhoneID:   {Name: "build-phone-3", Address: "192.0.2.2:22000"},
+		pendingUnknownID: {Name: "stranger", Address: "198.51.100.7:22000"},
+	}
+	patterns, err := parseDevicePatterns("laptopa-aaa, name:build-*@phonebb")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	svc := fake.service(t, Settings{AllowDestructive: true, AutoAcceptDevices: patterns, AutoAcceptShares: true})
+	var buf syncBuffer
+	svc.Logger = log.New(&buf, "", 0)
+	rec := &recordingNotifier{}
+	svc.Notifiers = []Notifier{rec}
+
+	svc.checkPendingDevices(context.Background())
+	svc.checkPendingDevices(context.Background())
+	svc.notifications.Wait()
+	if len(fake.added) != 2 || fake.added[0].DeviceID != pendingLaptopID || fake.added[1].DeviceID != pendingPhoneID {
+		t.Fatalf("unexpected devices added: %+v", fake.added)
+	}
+	if dev := fake.added[0]; dev.Name != "laptop" || dev.Introducer || !dev.AutoAcceptFolders {
+		t.Fatalf("unexpected device config: %+v", dev)
+	}
+	if got := rec.types(); len(got) != 2 || got[0] != eventDeviceAccepted {
+		t.Fatalf("expected two device_accepted events, got %v", got)
+	}
+	if rec.events[1].Fields["rule"] != "name:build-*@PHONEBB" {
+		t.Fatalf("unexpected event fields: %+v", rec.events[1].Fields)
+	}
+	if n := strings.Count(buf.String(), "Pending device "+pendingUnknownID+" (stranger) at 198.51.100.7:22000 does not match ST_AUTO_ACCEPT_DEVICES"); n != 1 {
+		t.Fatalf("expected the unknown device to be reported once, got %d:\n%s", n, buf.String())
+	}
+}
+
+func TestCheckPendingDevicesSafetyChecks(t *testing.T) {
+	for _, settings := range []Settings{
+		{AutoAcceptDevices: []DevicePattern{{ID: "LAPTOPA"}}},
+		{AutoAcceptDevices: []DevicePattern{{ID: "LAPTOPA"}}, AllowDestructive: true, DryRun: true},
+	} {
+		fake := newFakeSyncthing(t)
+		fake.pending = map[string]syncthing.PendingDevice{pendingLaptopID: {Name: "laptop"}}
+		svc := fake.service(t, settings)
+		rec := &recordingNotifier{}
+		svc.Notifiers = []Notifier{rec}
+
+		svc.checkPendingDevices(context.Background())
+		svc.notifications.Wait()
+		if len(fake.added) != 0 || len(rec.events) != 0 {
+			t.Fatalf("accepted a device with %+v", settings)
+		}
+	}
+}
+
+func TestParseDevicePatterns(t *testing.T) {
+	got, err := parseDevicePatterns("ABCDEFG\n# comment\nname:nas-*@laptopa, " + pendingLaptopID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 3 || got[0].ID != "ABCDEFG" || got[1].Name != "nas-*" || got[1].ID != "LAPTOPA" || got[2].ID != pendingLaptopID {
+		t.Fatalf("unexpected patterns: %+v", got)
+	}
+	if !got[1].matches(pendingLaptopID, "nas-1") || got[1].matches(pendingUnknownID, "nas-1") || got[1].matches(pendingLaptopID, "laptop") {
+		t.Fatalf("expected name:nas-*@laptopa to need both the name and the ID")
+	}
+	for _, raw := range []string{"ABC", "NOT-A-DEVICE!", "name:", "name:[oops@ABCDEFG", "name:nas-*", "name:nas-*@ABC", "name:@ABCDEFG"} {
+		if _, err := parseDevicePatterns(raw); err == nil || !strings.HasPrefix(err.Error(), "Invalid ST_AUTO_ACCEPT_DEVICES entry") {
+			t.Fatalf("expected %q to be rejected, got %v", raw, err)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+// Events raised by accepting pending folders.
+const (
+	eventFolderAccepted       = "folder_accepted"
+	eventFolderAcceptConflict = "folder_accept_conflict"
+)
+
+// FolderAcceptRule is one ST_AUTO_ACCEPT_FOLDERS line: offered folders whose ID or
+// label matches Pattern are accepted, receive-only, at the path PathTemplate gives.
+type FolderAcceptRule struct {
+	Pattern      string
+	PathTemplate string
+	path         *template.Template
+}
+
+// folderPathData is what an ST_AUTO_ACCEPT_FOLDERS path template sees.
+type folderPathData struct {
+	ID         string // the folder ID
+	Label      string // the label the offering device gave it
+	Device     string // the offering device's ID
+	DeviceName string // and its name in the config
+}
+
+func (r FolderAcceptRule) matches(id, label string) bool {
+	if ok, _ := path.Match(r.Pattern, id); ok {
+		return true
+	}
+	ok, _ := path.Match(r.Pattern, label)
+	return ok && label != ""
+}
+
+// folderPath renders the rule's path template, which must give an absolute path
+// under the template's static prefix. The values it fills in come from the offering
+// device, so each must be a single, non-empty path element.
+func (r FolderAcceptRule) folderPath(d folderPathData) (string, error) {
+	var b strings.Builder
+	if err := r.path.Execute(&b, folderPathValues{d}); err != nil {
+		return "", err
+	}
+	p := filepath.Clean(b.String())
+	if !filepath.IsAbs(p) {
+		return "", fmt.Errorf("path template gave %q, not an absolute path", b.String())
+	}
+	static, _, _ := strings.Cut(r.PathTemplate, "{{")
+	base := filepath.Dir(filepath.Clean(static + "x"))
+	if rel, err := filepath.Rel(base, p); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path template gave %q, outside %s", b.String(), base)
+	}
+	return p, nil
+}
+
+// folderPathValues is what path templates see: the fields of folderPathData, each
+// refused unless it is safe to use as one path element.
+type folderPathValues struct{ d folderPathData }
+
+func (v folderPathValues) ID() (string, error)     { return pathElement("ID", v.d.ID) }
+func (v folderPathValues) Label() (string, error)  { return pathElement("Label", v.d.Label) }
+func (v folderPathValues) Device() (string, error) { return pathElement("Device", v.d.Device) }
+func (v folderPathValues) DeviceName() (string, error) {
+	return pathElement("DeviceName", v.d.DeviceName)
+}
+
+// pathElement returns value if it cannot leave the directory it is put in.
+func pathElement(field, value string) (string, error) {
+	switch {
+	case value == "":
+		return "", fmt.Errorf("the offer's %s is empty", field)
+	case strings.ContainsAny(value, `/\`), strings.Contains(value, ".."):
+		return "", fmt.Errorf("the offer's %s %q is not a single path element", field, value)
+	}
+	return value, nil
+}
+
+// checkPendingFolders accepts the folders offered by devices matching
+// ST_AUTO_ACCEPT_DEVICES that match an ST_AUTO_ACCEPT_FOLDERS rule, and reports the
+// other offers. Each offer is handled once; one that could not be accepted is tried
+// again on the next check.
+func (s *Service) checkPendingFolders(ctx context.Context) {
+	for _, inst := range s.instances() {
+		client := s.client(inst)
+		key := joinRef(inst, "*")
+		pending, _, err := client.PendingFolders(ctx, pendingDeviceTimeout)
+		if err != nil {
+			s.logFailure(ctx, key, "pending folders", err, "Cannot list the pending folders of instance %s: %v", instanceName(inst), err)
+			continue
+		}
+		s.logSuccess(ctx, key, "pending folders")
+		if len(pending) == 0 {
+			continue
+		}
+		devices, _, err := client.Devices(ctx, pendingDeviceTimeout)
+		if err != nil {
+			s.logFailure(ctx, key, "pending folders", err, "Cannot list the devices of instance %s: %v", instanceName(inst), err)
+			continue
+		}
+		names := map[string]string{}
+		for _, dev := range devices {
+			names[dev.DeviceID] = dev.Name
+		}
+		for _, id := range slices.Sorted(maps.Keys(pending)) {
+			offers := pending[id].OfferedBy
+			for _, dev := range slices.Sorted(maps.Keys(offers)) {
+				ref := "folder:" + joinRef(inst, id) + "@" + dev
+				if _, seen := s.pendingSeen.Load(ref); seen {
+					continue
+				}
+				data := folderPathData{ID: id, Label: offers[dev].Label, Device: dev, DeviceName: names[dev]}
+				if s.handlePendingFolder(ctx, inst, data) {
+					s.pendingSeen.Store(ref, struct{}{})
+				}
+			}
+		}
+	}
+}
+
+// handlePendingFolder accepts or reports one device's offer of a folder: a new
+// folder is added, one already here at the same path is shared with the device too,
+// and one here at another path is reported as a conflict and left alone. It returns
+// false if the offer should be looked at again on the next check.
+func (s *Service) handlePendingFolder(ctx context.Context, inst string, d folderPathData) bool {
+	name := fmt.Sprintf("folder '%s'", d.ID)
+	if d.Label != "" {
+		name += fmt.Sprintf(" (%s)", d.Label)
+	}
+	from := "device " + d.Device
+	if d.DeviceName != "" {
+		from += fmt.Sprintf(" (%s)", d.DeviceName)
+	}
+	if inst != "" {
+		from += " on instance " + inst
+	}
+	allowed := false
+	for _, p := range s.Settings.AutoAcceptDevices {
+		allowed = allowed || p.matches(d.Device, d.DeviceName)
+	}
+	if !allowed {
+		s.log(ctx).Printf("Pending %s offered by %s: the device does not match ST_AUTO_ACCEPT_DEVICES; leaving it to be accepted by hand", name, from)
+		return true
+	}
+	var rule FolderAcceptRule
+	matched := false
+	for _, r := range s.Settings.AutoAcceptFolders {
+		if r.matches(d.ID, d.Label) {
+			rule, matched = r, true
+			break
+		}
+	}
+	if !matched {
+		s.log(ctx).Printf("Pending %s offered by %s matches no ST_AUTO_ACCEPT_FOLDERS rule; leaving it to be accepted by hand", name, from)
+		return true
+	}
+	folderPath, err := rule.folderPath(d)
+	if err != nil {
+		s.log(ctx).Printf("Cannot accept pending %s offered by %s with rule '%s': %v", name, from, rule.Pattern, err)
+		return true
+	}
+
+	ref := joinRef(inst, d.ID)
+	client := s.client(inst)
+	existing, code, err := client.Folder(ctx, d.ID, pendingDeviceTimeout)
+	exists := err == nil
+	switch {
+	case exists && filepath.Clean(existing.Path) != folderPath:
+		s.log(ctx).Printf("Not accepting pending %s offered by %s: it already exists here at %s, not %s", name, from, existing.Path, folderPath)
+		s.notify(NotifyEvent{
+			Type:    eventFolderAcceptConflict,
+			Folder:  ref,
+			Message: fmt.Sprintf("Pending %s offered by %s not accepted: it already exists at %s, not %s", name, from, existing.Path, folderPath),
+			Fields:  map[string]any{"deviceID": d.Device, "path": folderPath, "existingPath": existing.Path, "rule": rule.Pattern},
+		})
+		return true
+	case !exists && code != http.StatusNotFound:
+		s.logFailure(ctx, "folder:"+ref, "accept", err, "Cannot check whether pending %s offered by %s already exists: %v", name, from, err)
+		return false
+	}
+	action := "accept"
+	if exists {
+		action = "share existing"
+	}
+	if !s.Settings.AllowDestructive {
+		s.log(ctx).Printf("Not accepting pending %s offered by %s, matching '%s': ST_ALLOW_DESTRUCTIVE is not set", name, from, rule.Pattern)
+		return true
+	}
+	nf := syncthing.NewFolder{
+		ID:      d.ID,
+		Label:   d.Label,
+		Path:    folderPath,
+		Type:    "receiveonly",
+		Devices: []syncthing.FolderDevice{{DeviceID: d.Device}},
+	}
+	diff := configDiff{Subject: name, Folder: ref}
+	if exists {
+		var devices []string
+		for _, fd := range existing.Devices {
+			devices = append(devices, fd.DeviceID)
+		}
+		shared := devices
+		if !slices.Contains(devices, d.Device) {
+			shared = append(slices.Clone(devices), d.Device)
+		}
+		diff.Changes = []configChange{{"devices", devices, shared}}
+	} else {
+		diff.Changes = []configChange{
+			{"id", nil, nf.ID},
+			{"label", nil, nf.Label},
+			{"path", nil, nf.Path},
+			{"type", nil, nf.Type},
+			{"devices", nil, []string{d.Device}},
+		}
+	}
+	if s.Settings.DryRun {
+		s.log(ctx).Printf("[dry-run] Would %s %s offered by %s at %s, matching '%s'", action, name, from, folderPath, rule.Pattern)
+		s.logConfigDiff(ctx, diff)
+		return true
+	}
+	if exists {
+		_, err = client.ShareFolder(ctx, d.ID, d.Device, pendingDeviceTimeout)
+	} else {
+		_, err = client.AddFolder(ctx, nf, pendingDeviceTimeout)
+	}
+	if err != nil {
+		s.logFailure(ctx, "folder:"+ref, "accept", err, "Failed to %s pending %s offered by %s: %v", action, name, from, err)
+		return false
+	}
+	s.logSuccess(ctx, "folder:"+ref, "accept")
+	if exists {
+		s.log(ctx).Printf("Shared %s, already here at %s, with %s, matching '%s'", name, folderPath, from, rule.Pattern)
+	} else {
+		s.log(ctx).Printf("Accepted pending %s offered by %s as a receive-only folder at %s, matching '%s'", name, from, folderPath, rule.Pattern)
+	}
+	s.logConfigDiff(ctx, diff)
+	s.notify(NotifyEvent{
+		Type:    eventFolderAccepted,
+		Folder:  ref,
+		Message: fmt.Sprintf("Accepted %s offered by %s at %s", name, from, folderPath),
+		Fields:  map[string]any{"deviceID": d.Device, "path": folderPath, "existing": exists, "rule": rule.Pattern},
+	})
+	return true
+}
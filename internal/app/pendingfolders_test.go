@@ -0,0 +1,184 @@
+package app
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+func TestCheckPendingFolders(t *testing.T) {
+	fake := newFakeSyncthing(t, "shared", "clash")
+	fake.folders[0].Path = "/data/sync/shared"
+	fake.folders[0].Devices = []syncthing.FolderDevice{{DeviceID: "LOCAL"}}
+	fake.folders[1].Path = "/home/me/clash"
+	fake.setDevice(syncthing.DeviceConfig{DeviceID: pendingLaptopID, Name: "laptop"})
+	fake.setDevice(syncthing.DeviceConfig{DeviceID: pendingUnknownID, Name: "stranger"})
+	offer := func(dev, label string) syncthing.PendingFolder {
+		return syncthing.PendingFolder{OfferedBy: map[string]syncthing.PendingFolderOffer{dev: {Label: label}}}
+	}
+	fake.pendingFolders = map[string]syncthing.PendingFolder{
+		"photos-2024": offer(pendingLaptopID, "Photos"),
+		"shared":      offer(pendingLaptopID, "Shared"),
+		"clash":       offer(pendingLaptopID, "Clash"),
+		"notes":       offer(pendingLaptopID, "Notes"),
+		"secrets":     offer(pendingUnknownID, "Photos of secrets"),
+	}
+	rules, err := parseFolderAcceptRules("Photos* = /data/sync/{{.DeviceName}}/{{.ID}}\nshared = /data/sync/{{.ID}}\nclash = /data/sync/{{.ID}}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	svc := fake.service(t, Settings{
+		AllowDestructive:  true,
+		AutoAcceptDevices: []DevicePattern{{ID: "LAPTOPA", Name: "laptop"}},
+		AutoAcceptFolders: rules,
+	})
+	var buf syncBuffer
+	svc.Logger = log.New(&buf, "", 0)
+	rec := &recordingNotifier{}
+	svc.Notifiers = []Notifier{rec}
+
+	svc.checkPendingFolders(context.Background())
+	svc.checkPendingFolders(context.Background())
+	svc.notifications.Wait()
+
+	// Matched by label, and created receive-only at the templated path.
+	if got := fake.folderConfig("photos-2024"); got.Path != "/data/sync/laptop/photos-2024" || got.Type != "receiveonly" || got.Label != "Photos" ||
+		len(got.Devices) != 1 || got.Devices[0].DeviceID != pendingLaptopID {
+		t.Fatalf("unexpected accepted folder: %+v", got)
+	}
+	// Already here at the same path: shared with the device too.
+	if got := fake.folderConfig("shared").Devices; len(got) != 2 || got[1].DeviceID != pendingLaptopID {
+		t.Fatalf("expected the existing folder shared with the device, got %+v", got)
+	}
+	// Already here at another path: left alone and reported.
+	if got := fake.folderConfig("clash"); got.Path != "/home/me/clash" || len(got.Devices) != 0 {
+		t.Fatalf("the clashing folder was changed: %+v", got)
+	}
+	if !strings.Contains(buf.String(), "Not accepting pending folder 'clash' (Clash) offered by device "+pendingLaptopID+" (laptop): it already exists here at /home/me/clash, not /data/sync/clash") {
+		t.Fatalf("expected the conflict to be logged:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "Pending folder 'notes' (Notes) offered by device "+pendingLaptopID+" (laptop) matches no ST_AUTO_ACCEPT_FOLDERS rule") ||
+		!strings.Contains(buf.String(), "Pending folder 'secrets' (Photos of secrets) offered by device "+pendingUnknownID+" (stranger): the device does not match ST_AUTO_ACCEPT_DEVICES") {
+		t.Fatalf("expected the offers left alone to be logged:\n%s", buf.String())
+	}
+	if got := rec.types(); len(got) != 3 || got[0] != eventFolderAcceptConflict || got[1] != eventFolderAccepted || got[2] != eventFolderAccepted {
+		t.Fatalf("unexpected events: %v", got)
+	}
+	if strings.Count(buf.String(), "matches no ST_AUTO_ACCEPT_FOLDERS rule") != 1 {
+		t.Fatalf("expected each offer to be handled once:\n%s", buf.String())
+	}
+}
+
+func TestCheckPendingFoldersSafetyChecks(t *testing.T) {
+	for _, settings := range []Settings{{}, {AllowDestructive: true, DryRun: true}} {
+		fake := newFakeSyncthing(t)
+		fake.setDevice(syncthing.DeviceConfig{DeviceID: pendingLaptopID, Name: "laptop"})
+		fake.pendingFolders = map[string]syncthing.PendingFolder{
+			"photos": {OfferedBy: map[string]syncthing.PendingFolderOffer{pendingLaptopID: {Label: "Photos"}}},
+		}
+		rules, err := parseFolderAcceptRules("* = /data/sync/{{.ID}}")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		settings.AutoAcceptDevices, settings.AutoAcceptFolders = []DevicePattern{{ID: "LAPTOPA"}}, rules
+		svc := fake.service(t, settings)
+		svc.checkPendingFolders(context.Background())
+		if fake.count("/rest/config/folders") != 0 {
+			t.Fatalf("accepted a folder with %+v", settings)
+		}
+	}
+}
+
+func TestParseFolderAcceptRules(t *testing.T) {
+	for _, raw := range []string{"photos", "= /data/{{.ID}}", "[oops = /data/{{.ID}}", "* = /data/{{.ID"} {
+		if _, err := parseFolderAcceptRules(raw); err == nil {
+			t.Fatalf("expected %q to be rejected", raw)
+		}
+	}
+	rules, err := parseFolderAcceptRules("* = sync/{{.ID}}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := rules[0].folderPath(folderPathData{ID: "docs"}); err == nil {
+		t.Fatalf("expected a relative path to be refused")
+	}
+}
+
+func TestFolderPathRefusesHostileOffers(t *testing.T) {
+	rules, err := parseFolderAcceptRules("* = /data/sync/{{.Label}}\nid = /data/sync/{{.ID}}-copy")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, c := range []struct {
+		rule int
+		d    folderPathData
+		want string
+	}{
+		{0, folderPathData{ID: "docs", Label: "../../etc"}, `the offer's Label "../../etc" is not a single path element`},
+		{0, folderPathData{ID: "docs", Label: `..\..\etc`}, "is not a single path element"},
+		{0, folderPathData{ID: "docs"}, "the offer's Label is empty"},
+		{1, folderPathData{ID: "../../root/.ssh"}, `the offer's ID "../../root/.ssh" is not a single path element`},
+		{1, folderPathData{ID: "a/b"}, "is not a single path element"},
+	} {
+		if p, err := rules[c.rule].folderPath(c.d); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Fatalf("%+v: got %q, %v; want an error containing %q", c.d, p, err, c.want)
+		}
+	}
+	if p, err := rules[1].folderPath(folderPathData{ID: "docs.v2"}); err != nil || p != "/data/sync/docs.v2-copy" {
+		t.Fatalf("expected a safe ID to be accepted, got %q, %v", p, err)
+	}
+
+	// Even a template that climbs out of its own prefix is caught.
+	rules, err = parseFolderAcceptRules("* = /data/sync/{{.ID}}/../../../etc")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p, err := rules[0].folderPath(folderPathData{ID: "docs"}); err == nil || !strings.Contains(err.Error(), "outside /data/sync") {
+		t.Fatalf("expected the path to be refused, got %q, %v", p, err)
+	}
+}
+
+func TestCheckPendingFoldersRefusesHostileLabel(t *testing.T) {
+	fake := newFakeSyncthing(t)
+	fake.setDevice(syncthing.DeviceConfig{DeviceID: pendingLaptopID, Name: "laptop"})
+	fake.pendingFolders = map[string]syncthing.PendingFolder{
+		"planted": {OfferedBy: map[string]syncthing.PendingFolderOffer{pendingLaptopID: {Label: "../../etc"}}},
+	}
+	rules, err := parseFolderAcceptRules("* = /data/sync/{{.Label}}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	svc := fake.service(t, Settings{AllowDestructive: true, AutoAcceptDevices: []DevicePattern{{ID: "LAPTOPA"}}, AutoAcceptFolders: rules})
+	var buf syncBuffer
+	svc.Logger = log.New(&buf, "", 0)
+
+	svc.checkPendingFolders(context.Background())
+	if fake.count("/rest/config/folders") != 0 {
+		t.Fatalf("a folder was added for a hostile label")
+	}
+	if !strings.Contains(buf.String(), "Cannot accept pending folder 'planted' (../../etc)") {
+		t.Fatalf("expected the refusal to be logged:\n%s", buf.String())
+	}
+}
+
+func TestAutoAcceptFoldersBooleanIsDeprecatedAlias(t *testing.T) {
+	os.Clearenv()
+	os.Setenv("ST_API_KEY", "abc123")
+	os.Setenv("ST_CRON", "*/5 * * * *")
+	os.Setenv("ST_AUTO_ACCEPT_FOLDERS", "true")
+	st, err := LoadSettingsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.AutoAcceptShares || len(st.AutoAcceptFolders) != 0 || len(st.Warnings()) != 1 || !strings.Contains(st.Warnings()[0], "use ST_AUTO_ACCEPT_SHARES") {
+		t.Fatalf("expected the alias to set AutoAcceptShares with a warning, got %v, %v, %q", st.AutoAcceptShares, st.AutoAcceptFolders, st.Warnings())
+	}
+	os.Setenv("ST_AUTO_ACCEPT_SHARES", "false")
+	if st, err := LoadSettingsFromEnv(); err != nil || st.AutoAcceptShares {
+		t.Fatalf("expected ST_AUTO_ACCEPT_SHARES to win, got %v, %v", st.AutoAcceptShares, err)
+	}
+}
@@ -0,0 +1,59 @@
+package app
+
+import (
+	"context"
+	"sync"
+)
+
+const defaultScanWorkers = 4
+
+// IdleConnsPerHost is how many idle connections a client should keep to its
+// Syncthing for workers scan workers: one for each worker's trigger and one for the
+// status check that follows it, so a burst of scans reuses connections instead of
+// dialing new ones.
+func IdleConnsPerHost(workers int) int {
+	if workers < 1 {
+		workers = defaultScanWorkers
+	}
+	return 2 * workers
+}
+
+// scanPool bounds the scan triggers in flight per instance (ST_SCAN_WORKERS). Every
+// run draws from it, so a startup pass and a scheduled tick together still stay
+// within the limit. The zero value is ready to use.
+type scanPool struct {
+	mu    sync.Mutex
+	slots map[string]chan struct{}
+}
+
+// acquire waits for a free slot on instance and returns the function releasing it.
+func (p *scanPool) acquire(ctx context.Context, instance string, size int) (func(), error) {
+	if size < 1 {
+		size = defaultScanWorkers
+	}
+	p.mu.Lock()
+	if p.slots == nil {
+		p.slots = map[string]chan struct{}{}
+	}
+	ch := p.slots[instance]
+	if ch == nil {
+		ch = make(chan struct{}, size)
+		p.slots[instance] = ch
+	}
+	p.mu.Unlock()
+
+	select {
+	case ch <- struct{}{}:
+		return func() { <-ch }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// reset drops every slot, in use or not. Releasing a slot taken before the reset
+// is harmless.
+func (p *scanPool) reset() {
+	p.mu.Lock()
+	p.slots = nil
+	p.mu.Unlock()
+}
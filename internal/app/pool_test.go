@@ -0,0 +1,30 @@
+package app
+
+import (
+	"os"
+	"testing"
+)
+
+func TestScanWorkersSizeTheClientPool(t *testing.T) {
+	for _, tc := range []struct {
+		workers string
+		want    int
+	}{
+		{"", 2 * defaultScanWorkers},
+		{"6", 12},
+	} {
+		os.Clearenv()
+		os.Setenv("ST_API_KEY", "abc123")
+		os.Setenv("ST_CRON", "*/5 * * * *")
+		if tc.workers != "" {
+			os.Setenv("ST_SCAN_WORKERS", tc.workers)
+		}
+		st, err := LoadSettingsFromEnv()
+		if err != nil {
+			t.Fatalf("ST_SCAN_WORKERS=%q: %v", tc.workers, err)
+		}
+		if got := IdleConnsPerHost(st.ScanWorkers); got != tc.want {
+			t.Fatalf("ST_SCAN_WORKERS=%q: MaxIdleConnsPerHost = %d, want %d", tc.workers, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package app
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+// deferPollInterval is how often a deferred folder is polled while waiting for it to go idle.
+var deferPollInterval = 15 * time.Second
+
+// folderLocks serializes work on a folder so overlapping schedules never scan it twice
+// at once. The zero value is ready to use.
+type folderLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func (l *folderLocks) lock(folder string) (unlock func()) {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = map[string]*sync.Mutex{}
+	}
+	m, ok := l.locks[folder]
+	if !ok {
+		m = &sync.Mutex{}
+		l.locks[folder] = m
+	}
+	l.mu.Unlock()
+
+	m.Lock()
+	return m.Unlock
+}
+
+// preScanChecks inspects the folder's current state and reports whether the scan should
+// go ahead, along with the status it observed (nil if none was fetched). Status lookup
+// failures never block a scan.
+func (s *Service) preScanChecks(ctx context.Context, folder string) (bool, *syncthing.FolderStatus) {
+	deferMode := s.Settings.DeferWhileSyncing
+	deferring := deferMode == deferSkip || deferMode == deferWait
+	_, id := s.splitRef(folder)
+	if id == "*" || (!s.Settings.SkipIfScanning && !deferring && !s.Settings.SkipUnchanged) {
+		return true, nil
+	}
+
+	st, err := s.folderStatus(ctx, folder, 3*time.Second, false)
+	if err != nil {
+		return true, nil
+	}
+
+	if s.Settings.SkipIfScanning && (st.State == "scanning" || st.State == "scan-waiting") {
+		s.log(ctx).Printf("Folder '%s'%s is already %s; leaving the existing scan to finish", folder, s.labelSuffix(folder), st.State)
+		return false, &st
+	}
+
+	if s.Settings.SkipUnchanged && s.unchangedSinceLastScan(folder, st) {
+		s.log(ctx).Printf("Folder '%s'%s unchanged since last scan (sequence %d); skipping", folder, s.labelSuffix(folder), st.Sequence)
+		return false, &st
+	}
+
+	if st.State == "syncing" && deferring {
+		if deferMode == deferSkip {
+			s.log(ctx).Printf("Folder '%s'%s is syncing; skipping scan", folder, s.labelSuffix(folder))
+			return false, &st
+		}
+		return s.waitUntilIdle(ctx, folder), &st
+	}
+	return true, &st
+}
+
+// unchangedSinceLastScan reports whether the folder's sequence and receive-only counters
+// match what we saw last time, and the forced-rescan interval has not yet elapsed.
+func (s *Service) unchangedSinceLastScan(folder string, st syncthing.FolderStatus) bool {
+	prev := s.stateStore().folder(folder)
+	if prev.LastScan.IsZero() || time.Since(prev.LastScan) >= s.Settings.SkipUnchangedMax {
+		return false
+	}
+	return prev.LastSequence == st.Sequence && prev.LastReceiveOnly == receiveOnlyFingerprint(st)
+}
+
+// recordScan remembers that folder was just scanned, with the status seen beforehand.
+// advance moves the round-robin sub-path position on.
+func (s *Service) recordScan(folder string, pre *syncthing.FolderStatus, advance bool) {
+	if _, id := s.splitRef(folder); id == "*" {
+		return
+	}
+	err := s.stateStore().updateFolder(folder, func(f *FolderState) {
+		f.LastScan = time.Now().UTC()
+		if advance && len(s.Settings.FolderSubpaths[folder]) > 0 {
+			f.SubpathPosition++
+		}
+		if pre != nil {
+			f.LastSequence = pre.Sequence
+			f.LastReceiveOnly = receiveOnlyFingerprint(*pre)
+		}
+	})
+	if err != nil {
+		s.Logger.Printf("Failed to save state: %v", err)
+	}
+}
+
+// recordOutcome persists the result of a trigger attempt for `syncthing-kicker last`.
+func (s *Service) recordOutcome(folder, result string, err error) {
+	if _, id := s.splitRef(folder); id == "*" {
+		return
+	}
+	uerr := s.stateStore().updateFolder(folder, func(f *FolderState) {
+		f.LastTrigger = time.Now().UTC()
+		f.LastResult = result
+		f.LastError = ""
+		if result == resultFailed && err != nil {
+			f.LastError = err.Error()
+		}
+		switch result {
+		case resultTriggered, resultTimeout:
+			f.Scans++
+		case resultFailed:
+			f.Failures++
+		case resultSkipped:
+			f.Skips++
+		}
+	})
+	if uerr != nil {
+		s.Logger.Printf("Failed to save state: %v", uerr)
+	}
+}
+
+// recordState persists the folder's Syncthing state when it differs from the stored one.
+func (s *Service) recordState(folder string, st syncthing.FolderStatus) {
+	if s.stateStore().folder(folder).LastState == st.State {
+		return
+	}
+	err := s.stateStore().updateFolder(folder, func(f *FolderState) {
+		f.LastState = st.State
+		f.LastStateChanged = time.Now().UTC()
+	})
+	if err != nil {
+		s.Logger.Printf("Failed to save state: %v", err)
+	}
+}
+
+// recordSequence stores the latest observed sequence so the next tick compares against it.
+func (s *Service) recordSequence(folder string, st syncthing.FolderStatus) {
+	err := s.stateStore().updateFolder(folder, func(f *FolderState) {
+		f.LastSequence = st.Sequence
+		f.LastReceiveOnly = receiveOnlyFingerprint(st)
+	})
+	if err != nil {
+		s.Logger.Printf("Failed to save state: %v", err)
+	}
+}
+
+func receiveOnlyFingerprint(st syncthing.FolderStatus) [4]int64 {
+	return [4]int64{
+		st.ReceiveOnlyChangedFiles,
+		st.ReceiveOnlyChangedDirectories,
+		st.ReceiveOnlyChangedDeletes,
+		st.ReceiveOnlyChangedBytes,
+	}
+}
+
+// waitUntilIdle polls a syncing folder until it goes idle, DeferMax elapses, or ctx ends,
+// then logs one line describing the outcome and reports whether to scan.
+func (s *Service) waitUntilIdle(ctx context.Context, folder string) bool {
+	start := time.Now()
+	deadline := start.Add(s.Settings.DeferMax)
+
+	for {
+		wait := deferPollInterval
+		if remaining := time.Until(deadline); remaining < wait {
+			wait = remaining
+		}
+		if wait > 0 {
+			t := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				s.log(ctx).Printf("Folder '%s'%s was syncing; gave up waiting after %s: %v", folder, s.labelSuffix(folder), time.Since(start).Round(time.Second), ctx.Err())
+				return false
+			case <-t.C:
+			}
+		}
+
+		st, err := s.folderStatus(ctx, folder, 3*time.Second, true)
+		if err == nil && st.State != "syncing" {
+			s.log(ctx).Printf("Folder '%s'%s was syncing; waited %s until %s, scanning now", folder, s.labelSuffix(folder), time.Since(start).Round(time.Second), st.State)
+			return true
+		}
+
+		if !time.Now().Before(deadline) {
+			if s.Settings.DeferTimeoutAction == deferSkip {
+				s.log(ctx).Printf("Folder '%s'%s still syncing after %s; skipping scan", folder, s.labelSuffix(folder), s.Settings.DeferMax)
+				return false
+			}
+			s.log(ctx).Printf("Folder '%s'%s still syncing after %s; scanning anyway", folder, s.labelSuffix(folder), s.Settings.DeferMax)
+			return true
+		}
+	}
+}
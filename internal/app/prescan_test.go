@@ -0,0 +1,117 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+func withDeferPollInterval(t *testing.T, d time.Duration) {
+	t.Helper()
+	prev := deferPollInterval
+	deferPollInterval = d
+	t.Cleanup(func() { deferPollInterval = prev })
+}
+
+func TestDeferSkipDropsScanWhileSyncing(t *testing.T) {
+	fake := newFakeSyncthing(t, "folderA")
+	fake.setStatus("folderA", syncthing.FolderStatus{State: "syncing"})
+	svc := fake.service(t, Settings{DeferWhileSyncing: deferSkip})
+
+	svc.triggerScan(context.Background(), "folderA")
+
+	if got := fake.scanned(); len(got) != 0 {
+		t.Fatalf("expected no scan, got %v", got)
+	}
+}
+
+func TestDeferOffScansWhileSyncing(t *testing.T) {
+	fake := newFakeSyncthing(t, "folderA")
+	fake.setStatus("folderA", syncthing.FolderStatus{State: "syncing"})
+	svc := fake.service(t, Settings{DeferWhileSyncing: deferOff})
+
+	svc.triggerScan(context.Background(), "folderA")
+
+	if got := fake.scanned(); len(got) != 1 {
+		t.Fatalf("expected scan, got %v", got)
+	}
+}
+
+func TestDeferWaitScansOnceIdle(t *testing.T) {
+	withDeferPollInterval(t, 5*time.Millisecond)
+	fake := newFakeSyncthing(t, "folderA")
+	fake.setStatus("folderA", syncthing.FolderStatus{State: "syncing"})
+	svc := fake.service(t, Settings{DeferWhileSyncing: deferWait, DeferMax: time.Minute, DeferTimeoutAction: deferSkip})
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		fake.setStatus("folderA", syncthing.FolderStatus{State: "idle"})
+	}()
+	svc.triggerScan(context.Background(), "folderA")
+
+	if got := fake.scanned(); len(got) != 1 {
+		t.Fatalf("expected scan after idle, got %v", got)
+	}
+}
+
+func TestDeferWaitTimeoutAction(t *testing.T) {
+	withDeferPollInterval(t, 5*time.Millisecond)
+	for action, wantScans := range map[string]int{deferSkip: 0, deferProceed: 1} {
+		fake := newFakeSyncthing(t, "folderA")
+		fake.setStatus("folderA", syncthing.FolderStatus{State: "syncing"})
+		svc := fake.service(t, Settings{DeferWhileSyncing: deferWait, DeferMax: 20 * time.Millisecond, DeferTimeoutAction: action})
+
+		svc.triggerScan(context.Background(), "folderA")
+
+		if got := fake.scanned(); len(got) != wantScans {
+			t.Fatalf("action %s: expected %d scans, got %v", action, wantScans, got)
+		}
+	}
+}
+
+func TestDeferWaitRespectsContext(t *testing.T) {
+	withDeferPollInterval(t, time.Hour)
+	fake := newFakeSyncthing(t, "folderA")
+	fake.setStatus("folderA", syncthing.FolderStatus{State: "syncing"})
+	svc := fake.service(t, Settings{DeferWhileSyncing: deferWait, DeferMax: time.Hour, DeferTimeoutAction: deferProceed})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	svc.triggerScan(ctx, "folderA")
+
+	if got := fake.scanned(); len(got) != 0 {
+		t.Fatalf("expected no scan after cancellation, got %v", got)
+	}
+}
+
+func TestDeferWaitHoldsFolderLock(t *testing.T) {
+	withDeferPollInterval(t, 5*time.Millisecond)
+	fake := newFakeSyncthing(t, "folderA")
+	fake.setStatus("folderA", syncthing.FolderStatus{State: "syncing"})
+	svc := fake.service(t, Settings{DeferWhileSyncing: deferWait, DeferMax: time.Minute, DeferTimeoutAction: deferProceed})
+
+	done := make(chan struct{})
+	go func() {
+		svc.triggerScan(context.Background(), "folderA")
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	locked := make(chan struct{})
+	go func() {
+		unlock := svc.folderLocks.lock("folderA")
+		unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatalf("folder lock acquired while deferral in progress")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	fake.setStatus("folderA", syncthing.FolderStatus{State: "idle"})
+	<-done
+	<-locked
+}
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// WriteConfig prints the effective settings for --print-config: the whole document,
+// secrets redacted, then the per-folder schedules as merged from ST_FOLDER_CRON_FILE
+// and ST_FOLDER_CRON, and the notification routes resolved to one line per event.
+func WriteConfig(w io.Writer, st Settings) error {
+	data, err := json.MarshalIndent(st.Redacted(), "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Settings:\n%s\n\nFolder schedules:\n", data)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FOLDER\tACTION\tSCHEDULE")
+	crons := st.folderCrons()
+	for _, action := range folderCronActions {
+		for _, folder := range slices.Sorted(maps.Keys(crons[action])) {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", folder, action, crons[action][folder])
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	return writeNotifyRoutes(w, st)
+}
+
+// writeNotifyRoutes prints which sinks each event type goes to, with "*" expanded
+// and the default of every event to every sink spelled out. A "!" marks folders a
+// route leaves out.
+func writeNotifyRoutes(w io.Writer, st Settings) error {
+	fmt.Fprint(w, "\nNotification routes:\n")
+	sinks := sinkNames(st.NotifySinks)
+	if len(sinks) == 0 {
+		_, err := fmt.Fprintln(w, "none: no ST_NOTIFY_SINKS or ST_NOTIFY_WEBHOOK configured")
+		return err
+	}
+	routes := st.NotifyRoutes
+	if len(routes) == 0 {
+		routes = []NotifyRoute{{Events: []string{"*"}, Sinks: sinks}}
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "EVENT\tFOLDERS\tSINKS")
+	for _, r := range routes {
+		events := r.Events
+		if slices.Contains(events, "*") {
+			events = notifyEventTypes
+		}
+		folders := "all"
+		if len(r.Folders) > 0 {
+			names := slices.Clone(r.Folders)
+			if r.ExcludeFolders {
+				for i, f := range names {
+					names[i] = "!" + f
+				}
+			}
+			folders = strings.Join(names, ",")
+		}
+		for _, ev := range events {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", ev, folders, strings.Join(r.Sinks, ","))
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,68 @@
+package app
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWriteConfig(t *testing.T) {
+	var b strings.Builder
+	err := WriteConfig(&b, Settings{
+		APIKey:             "abcdefghijkl",
+		FolderCron:         map[string]string{"docs": "0 2 * * *", "media": "0 3 * * *"},
+		FolderRevertCron:   map[string]string{"inbox": "30 4 * * *"},
+		FolderOverrideCron: map[string]string{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	if strings.Contains(out, "abcdefghijkl") {
+		t.Fatalf("the API key was printed:\n%s", out)
+	}
+	want := "Folder schedules:\n" +
+		"FOLDER  ACTION  SCHEDULE\n" +
+		"docs    scan    0 2 * * *\n" +
+		"media   scan    0 3 * * *\n" +
+		"inbox   revert  30 4 * * *\n" +
+		"\nNotification routes:\n" +
+		"none: no ST_NOTIFY_SINKS or ST_NOTIFY_WEBHOOK configured\n"
+	if !strings.HasPrefix(out, "Settings:\n{") || !strings.HasSuffix(out, want) {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+}
+
+func TestWriteConfigNotifyRoutes(t *testing.T) {
+	sinks := []NotifySinkSettings{{Name: "ops", Type: "ntfy"}, {Name: "chat", Type: "slack"}}
+	routes, err := parseNotifyRoutes("scan_failed[!scratch,tmp], digest -> ops; *[finance] -> chat", sinks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	if err := writeNotifyRoutes(&b, Settings{NotifySinks: sinks, NotifyRoutes: routes}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 4+len(notifyEventTypes) {
+		t.Fatalf("expected every event expanded for the * route:\n%s", b.String())
+	}
+	for _, want := range []string{
+		"EVENT                    FOLDERS        SINKS",
+		"scan_failed              !scratch,!tmp  ops",
+		"digest                   all            ops",
+		"device_absent            finance        chat",
+	} {
+		if !slices.Contains(lines, want) {
+			t.Fatalf("expected %q in:\n%s", want, b.String())
+		}
+	}
+
+	b.Reset()
+	if err := writeNotifyRoutes(&b, Settings{NotifySinks: sinks}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "scan_recovered           all      ops,chat\n") {
+		t.Fatalf("expected the default route to send every event to every sink:\n%s", b.String())
+	}
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// prioritize orders refs by ST_FOLDER_PRIORITY: the folders listed before its "*"
+// first, in their listed order, then the folders it does not list, sorted by ID,
+// then those listed after "*". Without a "*" the unlisted folders come last.
+// Without ST_FOLDER_PRIORITY refs keep their order.
+func (s *Service) prioritize(refs []string) []string {
+	prio := s.Settings.FolderPriority
+	if len(prio) == 0 {
+		return refs
+	}
+	wildcard := slices.Index(prio, "*")
+	if wildcard < 0 {
+		wildcard = len(prio)
+	}
+	rank := map[string]int{}
+	for i, e := range prio {
+		if e != "*" {
+			rank[s.missingRef(e)] = i
+		}
+	}
+	rankOf := func(ref string) (int, bool) {
+		r, ok := rank[s.missingRef(ref)]
+		if !ok {
+			return wildcard, false
+		}
+		return r, true
+	}
+	out := slices.Clone(refs)
+	slices.SortStableFunc(out, func(a, b string) int {
+		ra, listed := rankOf(a)
+		rb, _ := rankOf(b)
+		if ra != rb || listed {
+			return cmp.Compare(ra, rb)
+		}
+		_, ida := s.splitRef(a)
+		_, idb := s.splitRef(b)
+		return cmp.Or(cmp.Compare(ida, idb), cmp.Compare(a, b))
+	})
+	return out
+}
+
+// checkFolderPriority makes sure every folder ST_FOLDER_PRIORITY lists exists. An
+// instance whose folder list cannot be fetched is not checked.
+func (s *Service) checkFolderPriority(ctx context.Context) error {
+	known := map[string]map[string]bool{} // by instance; nil when its list cannot be fetched
+	var unknown []string
+	for _, e := range s.Settings.FolderPriority {
+		inst, id := s.splitRef(e)
+		if id == "*" {
+			continue
+		}
+		ids, fetched := known[inst]
+		if !fetched {
+			list, err := s.cachedFolders(ctx, inst)
+			if err != nil {
+				s.Logger.Printf("Cannot check ST_FOLDER_PRIORITY against the folders of instance %s: %v", instanceName(inst), err)
+			} else {
+				ids = map[string]bool{}
+				for _, f := range list {
+					ids[f.ID] = true
+				}
+			}
+			known[inst] = ids
+		}
+		if ids != nil && !ids[id] {
+			unknown = append(unknown, e)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("ST_FOLDER_PRIORITY lists unknown folder(s): %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
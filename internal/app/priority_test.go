@@ -0,0 +1,68 @@
+package app
+
+import (
+	"context"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPrioritizeOrdersListedWildcardTrailing(t *testing.T) {
+	svc := &Service{Settings: Settings{FolderPriority: []string{"notes", "docs", "*", "media"}}}
+	got := svc.prioritize([]string{"media", "zeta", "docs", "alpha", "notes"})
+	if want := []string{"notes", "docs", "alpha", "zeta", "media"}; !slices.Equal(got, want) {
+		t.Fatalf("prioritize = %v, want %v", got, want)
+	}
+
+	// Without a "*" the unlisted folders come last.
+	svc.Settings.FolderPriority = []string{"media"}
+	if got := svc.prioritize([]string{"zeta", "media", "alpha"}); !slices.Equal(got, []string{"media", "alpha", "zeta"}) {
+		t.Fatalf("prioritize without wildcard = %v", got)
+	}
+
+	svc.Settings.FolderPriority = nil
+	if got := svc.prioritize([]string{"zeta", "alpha"}); !slices.Equal(got, []string{"zeta", "alpha"}) {
+		t.Fatalf("prioritize changed the order without ST_FOLDER_PRIORITY: %v", got)
+	}
+}
+
+func TestWildcardTickTriggersByPriority(t *testing.T) {
+	fake := newFakeSyncthing(t, "media", "photos", "notes", "archive", "docs")
+	svc := fake.service(t, Settings{ScanWorkers: 1, FolderPriority: []string{"notes", "docs", "*", "media"}})
+
+	_ = svc.triggerScans(context.Background(), "global", []string{"*"}, nil)
+	svc.statusChecks.Wait()
+	fake.mu.Lock()
+	got := slices.Clone(fake.scans)
+	fake.mu.Unlock()
+	if want := []string{"notes", "docs", "archive", "photos", "media"}; !slices.Equal(got, want) {
+		t.Fatalf("scans = %v, want %v", got, want)
+	}
+}
+
+func TestFolderPriorityValidation(t *testing.T) {
+	for raw, want := range map[string]string{
+		"notes, *, notes":     `lists "notes" more than once`,
+		"*, docs, *":          `lists "*" more than once`,
+		"docs, default/docs":  `lists "default/docs" more than once`,
+		"nas/*":               `invalid ST_FOLDER_PRIORITY entry "nas/*"`,
+		"!media":              `invalid ST_FOLDER_PRIORITY entry "!media"`,
+		"notes, bad:id, docs": "Invalid folder ID in ST_FOLDER_PRIORITY",
+	} {
+		os.Clearenv()
+		os.Setenv("ST_API_KEY", "abc123")
+		os.Setenv("ST_CRON", "*/5 * * * *")
+		os.Setenv("ST_FOLDER_PRIORITY", raw)
+		if _, err := LoadSettingsFromEnv(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("ST_FOLDER_PRIORITY=%q: expected %q, got %v", raw, want, err)
+		}
+	}
+
+	fake := newFakeSyncthing(t, "notes", "docs")
+	svc := fake.service(t, Settings{CronExpr: "0 5 * * *", FolderPriority: []string{"notes", "*", "medai"}})
+	err := svc.Run(context.Background())
+	if ExitCode(err) != ExitConfig || !strings.Contains(err.Error(), "ST_FOLDER_PRIORITY lists unknown folder(s): medai") {
+		t.Fatalf("expected the unknown folder to fail startup, got %v", err)
+	}
+}
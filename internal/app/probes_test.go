@@ -0,0 +1,75 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type probeResponse struct {
+	Status string                `json:"status"`
+	Checks map[string]probeCheck `json:"checks"`
+}
+
+func probe(t *testing.T, h http.Handler, path string) (int, probeResponse) {
+	t.Helper()
+	rec := adminRequest(t, h, http.MethodGet, path, "", "")
+	var resp probeResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode %s: %v", path, err)
+	}
+	return rec.Code, resp
+}
+
+func TestLivenessIgnoresSyncthingOutage(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	fake.srv.Close()
+	svc := fake.service(t, Settings{CronExpr: "0 5 * * *", LivenessMaxAge: time.Minute, ReadinessMaxAge: time.Minute, AdminToken: "s3cret"})
+	sched, err := svc.buildCronScheduler(make(chan struct{}, 1))
+	if err != nil {
+		t.Fatalf("build scheduler: %v", err)
+	}
+	svc.cron = sched
+	h := svc.adminHandler(context.Background(), make(chan struct{}, 1))
+
+	if code, resp := probe(t, h, "/livez"); code != http.StatusOK || !resp.Checks["heartbeat"].OK {
+		t.Fatalf("expected live, got %d %+v", code, resp)
+	}
+	code, resp := probe(t, h, "/readyz")
+	if code != http.StatusServiceUnavailable || resp.Checks["syncthing:default"].OK || !resp.Checks["scheduler"].OK {
+		t.Fatalf("expected not ready because of Syncthing, got %d %+v", code, resp)
+	}
+}
+
+func TestLivenessFailsOnStaleHeartbeat(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	svc := fake.service(t, Settings{LivenessMaxAge: time.Minute})
+	svc.lastBeat.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+	h := svc.adminHandler(context.Background(), make(chan struct{}, 1))
+
+	if code, resp := probe(t, h, "/livez"); code != http.StatusServiceUnavailable || resp.Checks["heartbeat"].Detail == "" {
+		t.Fatalf("expected stale heartbeat failure, got %d %+v", code, resp)
+	}
+}
+
+func TestReadinessProbesStaleInstance(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	svc := fake.service(t, Settings{LivenessMaxAge: time.Minute, ReadinessMaxAge: time.Minute})
+	h := svc.adminHandler(context.Background(), make(chan struct{}, 1))
+
+	code, resp := probe(t, h, "/readyz")
+	if code != http.StatusServiceUnavailable || resp.Checks["scheduler"].OK || !resp.Checks["syncthing:default"].OK {
+		t.Fatalf("expected only the scheduler check to fail, got %d %+v", code, resp)
+	}
+	if fake.count("/rest/system/status") != 1 {
+		t.Fatalf("expected a probe of the instance")
+	}
+
+	// A recent contact is reused instead of probing again.
+	_, _ = probe(t, h, "/readyz")
+	if fake.count("/rest/system/status") != 1 {
+		t.Fatalf("expected recent contact to be reused")
+	}
+}
@@ -0,0 +1,126 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	errorLogBaseWindow = time.Minute
+	errorLogMaxWindow  = time.Hour
+)
+
+// errorLogLimiter deduplicates repeated failure logs keyed by (folder, operation, error class).
+// The first failure is logged verbatim; repeats within the current window are only counted,
+// and a summary is emitted once the window has elapsed. The window doubles (up to a cap)
+// while the condition persists and resets on success. The zero value is ready to use.
+type errorLogLimiter struct {
+	mu      sync.Mutex
+	entries map[errorLogKey]*errorLogEntry
+	now     func() time.Time // for tests; defaults to time.Now
+}
+
+type errorLogKey struct {
+	folder string
+	op     string
+	class  string
+}
+
+type errorLogEntry struct {
+	windowStart time.Time
+	window      time.Duration
+	suppressed  int
+}
+
+func (l *errorLogLimiter) clock() time.Time {
+	if l.now != nil {
+		return l.now()
+	}
+	return time.Now()
+}
+
+// failure logs (or counts) a failure of op for folder. format/args describe the full
+// message used for the first occurrence.
+func (l *errorLogLimiter) failure(logger *log.Logger, folder, op string, err error, format string, args ...any) {
+	key := errorLogKey{folder: folder, op: op, class: errorClass(err)}
+	now := l.clock()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.entries == nil {
+		l.entries = map[errorLogKey]*errorLogEntry{}
+	}
+
+	e, ok := l.entries[key]
+	if !ok {
+		l.entries[key] = &errorLogEntry{windowStart: now, window: errorLogBaseWindow}
+		logger.Printf(format, args...)
+		return
+	}
+
+	e.suppressed++
+	if now.Sub(e.windowStart) < e.window {
+		return
+	}
+	logger.Printf("folder %s: %s failed %d more times in the last %s: %s", folder, op, e.suppressed, e.window, key.class)
+	e.suppressed = 0
+	e.windowStart = now
+	e.window *= 2
+	if e.window > errorLogMaxWindow {
+		e.window = errorLogMaxWindow
+	}
+}
+
+// success clears any failure state for (folder, op), summarizing suppressed repeats.
+func (l *errorLogLimiter) success(logger *log.Logger, folder, op string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, e := range l.entries {
+		if key.folder != folder || key.op != op {
+			continue
+		}
+		if e.suppressed > 0 {
+			logger.Printf("folder %s: %s failed %d more times before recovering: %s", folder, op, e.suppressed, key.class)
+		}
+		delete(l.entries, key)
+	}
+}
+
+// errorClass reduces an error to a short, stable description used for deduplication.
+func errorClass(err error) string {
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection refused"
+	case errors.Is(err, syscall.ECONNRESET):
+		return "connection reset"
+	case errors.As(err, &dnsErr):
+		return "dns lookup failed"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	}
+	msg := strings.TrimSpace(err.Error())
+	if len(msg) > 120 {
+		msg = msg[:120]
+	}
+	return msg
+}
+
+func (s *Service) logFailure(ctx context.Context, folder, op string, err error, format string, args ...any) {
+	s.errorLog.failure(s.log(ctx), folder, op, err, format, args...)
+}
+
+func (s *Service) logSuccess(ctx context.Context, folder, op string) {
+	s.errorLog.success(s.log(ctx), folder, op)
+}
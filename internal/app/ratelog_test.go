@@ -0,0 +1,131 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLimiter() (*errorLogLimiter, *fakeClock, *bytes.Buffer, *log.Logger) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	var buf bytes.Buffer
+	return &errorLogLimiter{now: clock.now}, clock, &buf, log.New(&buf, "", 0)
+}
+
+func refused() error {
+	return fmt.Errorf("dial tcp 127.0.0.1:8384: %w", syscall.ECONNREFUSED)
+}
+
+func TestErrorLogLimiterSuppressesRepeatsWithinWindow(t *testing.T) {
+	l, clock, buf, logger := newTestLimiter()
+
+	for i := 0; i < 10; i++ {
+		l.failure(logger, "docs", "scan", refused(), "Scan trigger failed for folder '%s': %v", "docs", refused())
+		clock.advance(time.Second)
+	}
+	if got := strings.Count(buf.String(), "\n"); got != 1 {
+		t.Fatalf("expected 1 log line, got %d:\n%s", got, buf.String())
+	}
+}
+
+func TestErrorLogLimiterSummarizesAndGrowsWindow(t *testing.T) {
+	l, clock, buf, logger := newTestLimiter()
+	fail := func() { l.failure(logger, "docs", "scan", refused(), "first failure") }
+
+	fail()
+	for i := 0; i < 13; i++ {
+		clock.advance(4 * time.Second)
+		fail()
+	}
+	clock.advance(10 * time.Second) // 62s since first failure
+	fail()
+
+	if !strings.Contains(buf.String(), "folder docs: scan failed 14 more times in the last 1m0s: connection refused") {
+		t.Fatalf("missing summary line:\n%s", buf.String())
+	}
+
+	// The window has doubled: another minute of failures stays silent.
+	buf.Reset()
+	clock.advance(90 * time.Second)
+	fail()
+	if buf.Len() != 0 {
+		t.Fatalf("expected suppression in doubled window, got:\n%s", buf.String())
+	}
+	clock.advance(31 * time.Second)
+	fail()
+	if !strings.Contains(buf.String(), "in the last 2m0s") {
+		t.Fatalf("expected 2m summary, got:\n%s", buf.String())
+	}
+}
+
+func TestErrorLogLimiterWindowIsCapped(t *testing.T) {
+	l, clock, _, logger := newTestLimiter()
+	for i := 0; i < 20; i++ {
+		l.failure(logger, "docs", "scan", refused(), "fail")
+		clock.advance(3 * time.Hour)
+	}
+	for _, e := range l.entries {
+		if e.window != errorLogMaxWindow {
+			t.Fatalf("expected window capped at %s, got %s", errorLogMaxWindow, e.window)
+		}
+	}
+}
+
+func TestErrorLogLimiterResetsOnSuccess(t *testing.T) {
+	l, clock, buf, logger := newTestLimiter()
+
+	l.failure(logger, "docs", "scan", refused(), "fail")
+	l.failure(logger, "docs", "scan", refused(), "fail")
+	clock.advance(time.Second)
+	l.success(logger, "docs", "scan")
+	if !strings.Contains(buf.String(), "failed 1 more times before recovering") {
+		t.Fatalf("expected recovery summary, got:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	l.failure(logger, "docs", "scan", refused(), "fail again")
+	if !strings.Contains(buf.String(), "fail again") {
+		t.Fatalf("expected first failure after reset to be logged, got:\n%s", buf.String())
+	}
+}
+
+func TestErrorLogLimiterKeysByFolderAndClass(t *testing.T) {
+	l, _, buf, logger := newTestLimiter()
+
+	l.failure(logger, "docs", "scan", refused(), "a")
+	l.failure(logger, "photos", "scan", refused(), "b")
+	l.failure(logger, "docs", "scan", context.DeadlineExceeded, "c")
+	l.failure(logger, "docs", "status check", refused(), "d")
+
+	if got := strings.Count(buf.String(), "\n"); got != 4 {
+		t.Fatalf("expected 4 distinct log lines, got %d:\n%s", got, buf.String())
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{refused(), "connection refused"},
+		{fmt.Errorf("read: %w", syscall.ECONNRESET), "connection reset"},
+		{fmt.Errorf("get: %w", context.DeadlineExceeded), "timeout"},
+		{errors.New("http error: boom"), "http error: boom"},
+	}
+	for _, tt := range tests {
+		if got := errorClass(tt.err); got != tt.want {
+			t.Fatalf("errorClass(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+// folderUnhealthy reports whether a status is out of sync or erroring. With
+// filesOnly only needed files make a folder out of sync.
+func folderUnhealthy(st syncthing.FolderStatus, filesOnly bool) bool {
+	return outOfSync(st.NeedBytes, st.NeedFiles, filesOnly) || st.Errors > 0 || strings.Contains(st.State, "error")
+}
+
+// outOfSync reports whether a folder needing needBytes, needFiles of them in files,
+// is out of sync. Syncthing counts directories, symlinks and deletes in needBytes
+// too, so with filesOnly needBytes alone does not count.
+func outOfSync(needBytes, needFiles int64, filesOnly bool) bool {
+	if filesOnly {
+		return needFiles > 0
+	}
+	return needBytes > 0
+}
+
+// needBreakdown lists the non-zero counts of what a folder needs, e.g.
+// "3 files, 1200 deletes"; it is empty when nothing is needed.
+func needBreakdown(files, dirs, symlinks, deletes int64) string {
+	var parts []string
+	for _, c := range []struct {
+		n    int64
+		what string
+	}{{files, "files"}, {dirs, "directories"}, {symlinks, "symlinks"}, {deletes, "deletes"}} {
+		if c.n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", c.n, c.what))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// trackRecovery remembers when a folder became unhealthy and how far behind it got,
+// and raises folder_recovered on the first healthy (idle, nothing needed, no errors)
+// observation afterwards. Episodes shorter than ST_RECOVERY_MIN end silently so
+// routine syncs do not notify. The state is only written when it changes.
+func (s *Service) trackRecovery(ctx context.Context, ref string, st syncthing.FolderStatus) {
+	prev := s.stateStore().folder(ref)
+	now := time.Now().UTC()
+
+	if folderUnhealthy(st, s.Settings.CheckNeed == checkNeedFiles) {
+		if !prev.UnhealthySince.IsZero() && st.NeedBytes <= prev.PeakNeedBytes && st.Errors <= prev.PeakErrors {
+			return
+		}
+		err := s.stateStore().updateFolder(ref, func(f *FolderState) {
+			if f.UnhealthySince.IsZero() {
+				f.UnhealthySince = now
+			}
+			f.PeakNeedBytes = max(f.PeakNeedBytes, st.NeedBytes)
+			f.PeakErrors = max(f.PeakErrors, st.Errors)
+		})
+		if err != nil {
+			s.Logger.Printf("Failed to save state: %v", err)
+		}
+		return
+	}
+
+	if prev.UnhealthySince.IsZero() || st.State != "idle" {
+		return
+	}
+	err := s.stateStore().updateFolder(ref, func(f *FolderState) {
+		f.UnhealthySince = time.Time{}
+		f.PeakNeedBytes = 0
+		f.PeakErrors = 0
+	})
+	if err != nil {
+		s.Logger.Printf("Failed to save state: %v", err)
+	}
+
+	dur := now.Sub(prev.UnhealthySince)
+	if dur < s.Settings.RecoveryMin {
+		return
+	}
+	msg := fmt.Sprintf("Folder %s%s recovered after %s", ref, s.labelSuffix(ref), dur.Round(time.Second))
+	var behind []string
+	if prev.PeakNeedBytes > 0 {
+		behind = append(behind, formatBytes(prev.PeakNeedBytes)+" behind")
+	}
+	if prev.PeakErrors > 0 {
+		behind = append(behind, fmt.Sprintf("%d errors", prev.PeakErrors))
+	}
+	if len(behind) > 0 {
+		msg += ", was " + strings.Join(behind, " with ")
+	}
+	s.log(ctx).Printf("%s", msg)
+	s.notify(NotifyEvent{
+		Type:    eventFolderRecovered,
+		Folder:  ref,
+		Message: msg,
+		Fields: map[string]any{
+			"unhealthySince":  prev.UnhealthySince,
+			"durationSeconds": int64(dur / time.Second),
+			"peakNeedBytes":   prev.PeakNeedBytes,
+			"peakErrors":      prev.PeakErrors,
+		},
+	})
+}
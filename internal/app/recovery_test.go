@@ -0,0 +1,68 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+func TestRecoveryNotification(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs", "photos")
+	rec := &recordingNotifier{}
+	svc := fake.service(t, Settings{})
+	svc.Notifiers = []Notifier{rec}
+	ctx := context.Background()
+	check := func() {
+		t.Helper()
+		if err := svc.checkSyncStatus(ctx, []string{"docs", "photos"}, 0); err != nil {
+			t.Fatalf("status check: %v", err)
+		}
+	}
+
+	check()
+	fake.setStatus("docs", syncthing.FolderStatus{State: "syncing", NeedBytes: 1 << 30})
+	check()
+	fake.setStatus("docs", syncthing.FolderStatus{State: "syncing", NeedBytes: 3 << 30})
+	check()
+	fake.setStatus("docs", syncthing.FolderStatus{State: "syncing", NeedBytes: 1 << 20})
+	check()
+	fake.setStatus("docs", syncthing.FolderStatus{State: "idle"})
+	check()
+	check()
+	svc.notifications.Wait()
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.events) != 1 {
+		t.Fatalf("expected exactly one event, got %+v", rec.events)
+	}
+	ev := rec.events[0]
+	if ev.Type != eventFolderRecovered || ev.Folder != "docs" || ev.Fields["peakNeedBytes"] != int64(3<<30) {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+	if !strings.Contains(ev.Message, "was 3.0 GiB behind") {
+		t.Fatalf("unexpected message: %q", ev.Message)
+	}
+	if f := svc.stateStore().folder("docs"); !f.UnhealthySince.IsZero() || f.PeakNeedBytes != 0 {
+		t.Fatalf("episode should be cleared: %+v", f)
+	}
+}
+
+func TestShortEpisodesDoNotNotify(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	rec := &recordingNotifier{}
+	svc := fake.service(t, Settings{RecoveryMin: time.Hour})
+	svc.Notifiers = []Notifier{rec}
+
+	fake.setStatus("docs", syncthing.FolderStatus{State: "error", Errors: 2})
+	_ = svc.checkSyncStatus(context.Background(), []string{"docs"}, 0)
+	fake.setStatus("docs", syncthing.FolderStatus{State: "idle"})
+	_ = svc.checkSyncStatus(context.Background(), []string{"docs"}, 0)
+	svc.notifications.Wait()
+	if got := rec.types(); len(got) != 0 {
+		t.Fatalf("expected no events, got %v", got)
+	}
+}
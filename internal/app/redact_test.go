@@ -0,0 +1,70 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+func TestAPIKeyNeverLeaks(t *testing.T) {
+	const key = "s3cr3t-api-key-0123456789abcdef"
+	// Syncthing rejecting the key and echoing it back, as a misbehaving proxy might.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden: bad key "+r.Header.Get("X-API-Key")+"\nat "+r.URL.Path, http.StatusForbidden)
+	}))
+	t.Cleanup(srv.Close)
+
+	var buf syncBuffer
+	logger := log.New(&buf, "", 0)
+	// A primary address that cannot be dialed, with the key where it should not be.
+	primary := "http://" + unusedAddr(t) + "/" + key + "/?apikey=" + key
+	if _, err := syncthing.NewClient("http://bad host/"+key, key, syncthing.ClientOptions{}); err != nil {
+		logger.Printf("Failed to initialize client: %v", err)
+	}
+	client, err := syncthing.NewClient(primary, key, syncthing.ClientOptions{
+		FallbackURL: srv.URL,
+		OnSwitch:    func(from, to string) { logger.Printf("switching from %s to %s", from, to) },
+		OnRetry:     func(method, path string, err error) { logger.Printf("%s %s retrying: %v", method, path, err) },
+		OnRequest: func(method, path string, status int, d time.Duration, err error) {
+			logger.Printf("%s %s %d: %v", method, path, status, err)
+		},
+	})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	svc := &Service{Settings: Settings{ScanWorkers: 1, StatusDelaySec: 0}, Logger: logger, Client: client}
+	ctx := context.Background()
+
+	_ = svc.triggerScans(ctx, "test", []string{"docs"}, nil)
+	report, _ := svc.CheckOnce(ctx, []string{"docs"})
+	for _, r := range report.Instances {
+		logger.Printf("check: %v", r.Err)
+	}
+	for _, r := range svc.SetFoldersPaused(ctx, []string{"docs"}, true) {
+		logger.Printf("pause: %s", r.Error)
+	}
+	for _, r := range svc.CompletionReport(ctx, []string{"docs"}) {
+		logger.Printf("completion: %s", r.Error)
+	}
+	logger.Printf("url: %s", client.URL())
+	for _, h := range []http.HandlerFunc{svc.handleStatus, svc.handleHealth, svc.handleHistory, svc.handleMetrics} {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		fmt.Fprintln(&buf, rec.Body.String())
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "forbidden: bad key "+syncthing.MaskKey(key)) || !strings.Contains(out, "switching from") {
+		t.Fatalf("expected the failures to be logged:\n%s", out)
+	}
+	if strings.Contains(out, key) {
+		t.Fatalf("the API key leaked:\n%s", out)
+	}
+}
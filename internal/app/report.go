@@ -0,0 +1,177 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Classes a Report gives each checked folder.
+const (
+	classOK        = "ok"
+	classPending   = "pending"     // idle with only deletes, directories or symlinks left (ST_CHECK_NEED=files)
+	classOutOfSync = "out_of_sync" // not idle, or needing data
+	classWarning   = "warning"     // in a state ST_CHECK_STATE_SEVERITY rates warning
+	classCritical  = "critical"    // in an error, stopped or unknown state, or one rated critical
+)
+
+// Report is what a check found: each instance's result and every folder whose
+// status was fetched, classified the way --check rates it. CheckOnce builds it;
+// the Nagios, JSON and log renderers only read it.
+//
+// The daemon builds no Report: it runs no whole-set checks, only a status check
+// per triggered folder, which logs its own line and raises its own events. Feeding
+// those through a Report is out of scope until the daemon gains periodic checks.
+type Report struct {
+	Started   time.Time      `json:"started"`
+	Finished  time.Time      `json:"finished"`
+	Instances []CheckResult  `json:"instances"`
+	Folders   []ReportFolder `json:"folders"` // sorted by folder
+	Devices   []DeviceRow    `json:"devices"` // filled in by callers that report devices
+}
+
+// ReportFolder is one checked folder in a Report.
+type ReportFolder struct {
+	Folder          string `json:"folder"`
+	Instance        string `json:"instance"`
+	State           string `json:"state"` // "unknown" when Syncthing reports none
+	Class           string `json:"class"`
+	NeedBytes       int64  `json:"needBytes"`
+	InSyncBytes     int64  `json:"inSyncBytes"`
+	NeedFiles       int64  `json:"needFiles"`
+	NeedDirectories int64  `json:"needDirectories"`
+	NeedSymlinks    int64  `json:"needSymlinks"`
+	NeedDeletes     int64  `json:"needDeletes"`
+	Error           string `json:"error,omitempty"`    // the folder's error, or its first file error
+	LastScan        string `json:"lastScan,omitempty"` // Syncthing's own, RFC3339, tracked with ST_STALE_SCAN_WARN
+	Stale           bool   `json:"stale,omitempty"`
+}
+
+// newReport classifies folders and assembles the report. states overrides how
+// folder states are rated (ST_CHECK_STATE_SEVERITY); with filesOnly
+// (ST_CHECK_NEED=files) an idle folder needing only deletes, directories or
+// symlinks is pending rather than out of sync.
+func newReport(started, finished time.Time, results []CheckResult, folders []ReportFolder, states map[string]string, filesOnly bool) Report {
+	folders = slices.Clone(folders)
+	for i := range folders {
+		if folders[i].State == "" {
+			folders[i].State = "unknown"
+		}
+		folders[i].Class = classifyFolder(folders[i], states, filesOnly)
+	}
+	sort.SliceStable(folders, func(i, j int) bool { return folders[i].Folder < folders[j].Folder })
+	if results == nil {
+		results = []CheckResult{}
+	}
+	if folders == nil {
+		folders = []ReportFolder{}
+	}
+	return Report{Started: started, Finished: finished, Instances: results, Folders: folders, Devices: []DeviceRow{}}
+}
+
+func classifyFolder(f ReportFolder, states map[string]string, filesOnly bool) string {
+	switch sev := stateSeverity(states, f.State); {
+	case sev == severityCritical:
+		return classCritical
+	case sev == severityWarning:
+		return classWarning
+	case sev == checkOK:
+		return classOK
+	case f.State != "idle" || outOfSync(f.NeedBytes, f.NeedFiles, filesOnly):
+		return classOutOfSync
+	case f.NeedBytes > 0 || f.needBreakdown() != "":
+		return classPending
+	default:
+		return classOK
+	}
+}
+
+func (f ReportFolder) needBreakdown() string {
+	return needBreakdown(f.NeedFiles, f.NeedDirectories, f.NeedSymlinks, f.NeedDeletes)
+}
+
+// ExitCode is 0 when every checked instance is reachable and has all its folders,
+// none of them in a critical state, 1 when none does and 2 when only some do.
+func (r Report) ExitCode() int {
+	failed := 0
+	for _, res := range r.Instances {
+		critical := slices.ContainsFunc(res.Problems, FolderProblem.Critical)
+		if res.Err != nil || len(res.Missing) > 0 || critical {
+			failed++
+		}
+	}
+	switch {
+	case failed == 0:
+		return 0
+	case failed == len(r.Instances):
+		return 1
+	default:
+		return 2
+	}
+}
+
+// Checked lists the folders whose status was fetched, instance by instance.
+func (r Report) Checked() []string {
+	var out []string
+	for _, res := range r.Instances {
+		out = append(out, res.Checked...)
+	}
+	return out
+}
+
+// LogLines renders the report as the lines --check logs: folders Syncthing does
+// not know and folders in a state rated warning or critical.
+func (r Report) LogLines() []string {
+	var lines []string
+	for _, res := range r.Instances {
+		if len(res.Missing) > 0 {
+			lines = append(lines, fmt.Sprintf("Check failed: folder(s) %s not found on instance %s; check ST_FOLDERS and ST_FOLDER_CRON", strings.Join(res.Missing, ", "), res.Instance))
+		}
+		for _, p := range res.Problems {
+			msg := fmt.Sprintf("folder %s on instance %s is %s", p.Folder, res.Instance, p.State)
+			if p.Error != "" {
+				msg += ": " + p.Error
+			}
+			if p.Critical() {
+				lines = append(lines, "Check failed: "+msg)
+			} else {
+				lines = append(lines, "Check warning: "+msg)
+			}
+		}
+	}
+	return lines
+}
+
+// WriteJSON renders the report as `--check --json` prints it.
+func (r Report) WriteJSON(w io.Writer) error {
+	if r.Devices == nil {
+		r.Devices = []DeviceRow{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// MarshalJSON writes the instance's error as a string and always lists the checked
+// folders.
+func (c CheckResult) MarshalJSON() ([]byte, error) {
+	out := struct {
+		Instance  string          `json:"instance"`
+		Error     string          `json:"error,omitempty"`
+		Checked   []string        `json:"checked"`
+		Missing   []string        `json:"missing,omitempty"`
+		Problems  []FolderProblem `json:"problems,omitempty"`
+		Abandoned bool            `json:"abandoned,omitempty"`
+	}{Instance: c.Instance, Checked: c.Checked, Missing: c.Missing, Problems: c.Problems, Abandoned: c.Abandoned}
+	if c.Err != nil {
+		out.Error = c.Err.Error()
+	}
+	if out.Checked == nil {
+		out.Checked = []string{}
+	}
+	return json.Marshal(out)
+}
@@ -0,0 +1,113 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+func TestCheckOnceBuildsReport(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs", "media", "notes", "photos")
+	old := time.Now().Add(-48 * time.Hour).UTC().Truncate(time.Second)
+	fake.setLastScan("docs", old)
+	fake.setLastScan("media", time.Now())
+	fake.setLastScan("notes", time.Now())
+	fake.setLastScan("photos", time.Now())
+	fake.setStatus("media", syncthing.FolderStatus{State: "syncing", NeedBytes: 2048, InSyncBytes: 100, NeedFiles: 2})
+	fake.setStatus("notes", syncthing.FolderStatus{State: "idle", NeedBytes: 10, NeedDeletes: 4})
+	fake.setStatus("photos", syncthing.FolderStatus{State: "error", Errors: 1})
+	fake.fileErrors = map[string][]syncthing.FileError{"photos": {{Path: "a.jpg", Error: "permission denied"}}}
+	svc := fake.service(t, Settings{StaleScanWarn: 24 * time.Hour, CheckNeed: checkNeedFiles})
+
+	before := time.Now().UTC()
+	report, err := svc.CheckOnce(context.Background(), []string{"*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Started.Before(before) || report.Finished.Before(report.Started) {
+		t.Fatalf("unexpected run times: %s to %s", report.Started, report.Finished)
+	}
+	if len(report.Instances) != 1 || strings.Join(report.Checked(), ",") != "docs,media,notes,photos" {
+		t.Fatalf("unexpected instances: %+v", report.Instances)
+	}
+	want := []ReportFolder{
+		{Folder: "docs", Instance: "default", State: "idle", Class: classOK, LastScan: old.Format(time.RFC3339), Stale: true},
+		{Folder: "media", Instance: "default", State: "syncing", Class: classOutOfSync, NeedBytes: 2048, InSyncBytes: 100, NeedFiles: 2},
+		{Folder: "notes", Instance: "default", State: "idle", Class: classPending, NeedBytes: 10, NeedDeletes: 4},
+		{Folder: "photos", Instance: "default", State: "error", Class: classCritical, Error: "a.jpg: permission denied"},
+	}
+	if len(report.Folders) != len(want) {
+		t.Fatalf("expected %d folders, got %+v", len(want), report.Folders)
+	}
+	for i, f := range report.Folders {
+		if !f.Stale {
+			f.LastScan = "" // recent, and only as precise as the fake
+		}
+		if f != want[i] {
+			t.Fatalf("folder %d = %+v\nwant %+v", i, f, want[i])
+		}
+	}
+	if report.ExitCode() != 1 {
+		t.Fatalf("a critical folder should fail the check, got %d", report.ExitCode())
+	}
+}
+
+func TestReportRenderers(t *testing.T) {
+	started := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	results := []CheckResult{
+		{
+			Instance: "default",
+			Checked:  []string{"docs", "media", "notes", "photos"},
+			Missing:  []string{"gone"},
+			Problems: []FolderProblem{{Folder: "photos", State: "error", Severity: severityCritical, Error: "a.jpg: permission denied"}},
+		},
+		{Instance: "nas", Err: errors.New("dial tcp 10.0.0.2:8384: connection refused")},
+		{Instance: "offsite", Checked: []string{"offsite/archive"}, Problems: []FolderProblem{{Folder: "offsite/archive", State: "stopped", Severity: severityWarning}}},
+	}
+	folders := []ReportFolder{
+		{Folder: "photos", Instance: "default", State: "error", Error: "a.jpg: permission denied"},
+		{Folder: "docs", Instance: "default", State: "idle", LastScan: "2024-05-03T07:08:09Z", Stale: true},
+		{Folder: "media", Instance: "default", State: "syncing", NeedBytes: 3 << 20, InSyncBytes: 1 << 30, NeedFiles: 12},
+		{Folder: "notes", Instance: "default", State: "idle", NeedBytes: 512, NeedDeletes: 30},
+		{Folder: "offsite/archive", Instance: "offsite", State: "stopped"},
+	}
+	report := newReport(started, started.Add(1500*time.Millisecond), results, folders, map[string]string{"stopped": severityWarning}, true)
+	report.Devices = []DeviceRow{{Instance: "default", DeviceID: "OFFSITE-AAAAAAA", Device: "Offsite NAS", Connection: "disconnected", LastSeen: started.Add(-240 * time.Hour), Folders: []string{"docs"}, Absent: true}}
+
+	nagios, code := report.Nagios()
+	var js bytes.Buffer
+	if err := report.WriteJSON(&js); err != nil {
+		t.Fatal(err)
+	}
+	rendered := map[string]string{
+		"nagios.golden": fmt.Sprintf("%s\nexit %d\n", nagios, code),
+		"json.golden":   js.String(),
+		"log.golden":    strings.Join(report.LogLines(), "\n") + "\n",
+	}
+	for name, got := range rendered {
+		path := filepath.Join("testdata", "check", name)
+		if *updateGolden {
+			if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read golden file: %v", err)
+		}
+		if got != string(want) {
+			t.Fatalf("%s mismatch\ngot:\n%s\nwant:\n%s", name, got, want)
+		}
+	}
+	if report.ExitCode() != 2 {
+		t.Fatalf("expected exit code 2 with one of three instances passing, got %d", report.ExitCode())
+	}
+}
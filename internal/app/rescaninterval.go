@@ -0,0 +1,171 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+const rescanIntervalTimeout = 10 * time.Second
+
+// manageRescanIntervals sets rescanIntervalS to 0 on every folder the kicker
+// schedules, so Syncthing stops rescanning them on its own, and restores the
+// intervals of folders it no longer schedules (all of them with
+// ST_MANAGE_RESCAN_INTERVAL off). The original intervals are kept in the state
+// file, so they survive a crash.
+func (s *Service) manageRescanIntervals(ctx context.Context) {
+	scheduled := map[string]bool{}
+	if s.Settings.ManageRescanInterval {
+		for _, ref := range s.rescanScheduledFolders(ctx) {
+			scheduled[s.missingRef(ref)] = true
+		}
+	}
+	var stale []string
+	for _, ref := range s.stateStore().savedRescanFolders() {
+		if !scheduled[ref] {
+			stale = append(stale, ref)
+		}
+	}
+	s.restoreRescanIntervals(ctx, stale)
+	for _, ref := range slices.Sorted(maps.Keys(scheduled)) {
+		s.disableRescanInterval(ctx, ref)
+	}
+}
+
+// rescanScheduledFolders lists the folders ST_CRON and ST_FOLDER_CRON schedule,
+// leaving out the "*" of instances whose folder list cannot be fetched.
+func (s *Service) rescanScheduledFolders(ctx context.Context) []string {
+	var refs []string
+	if s.Settings.CronExpr != "" {
+		refs = s.Folders()
+	}
+	refs = append(refs, slices.Sorted(maps.Keys(s.folderCrons()[actionScan]))...)
+	var out []string
+	for _, ref := range s.expandWildcards(ctx, refs, "rescan intervals") {
+		if _, id := s.splitRef(ref); id != "*" {
+			out = append(out, ref)
+		}
+	}
+	return out
+}
+
+func (s *Service) disableRescanInterval(ctx context.Context, ref string) {
+	if s.stateStore().folder(ref).SavedRescanIntervalS != 0 {
+		return
+	}
+	inst, id := s.splitRef(ref)
+	client := s.client(inst)
+	key := "rescan:" + ref
+	cfg, _, err := client.Folder(ctx, id, rescanIntervalTimeout)
+	if err != nil {
+		s.logFailure(ctx, key, "rescan interval", err, "Cannot read the rescan interval of folder '%s'%s: %v", ref, s.labelSuffix(ref), err)
+		return
+	}
+	s.logSuccess(ctx, key, "rescan interval")
+	if cfg.RescanIntervalS == 0 {
+		return
+	}
+	if s.Settings.DryRun {
+		s.log(ctx).Printf("[dry-run] Would set the rescan interval of folder '%s'%s from %ds to 0", ref, s.labelSuffix(ref), cfg.RescanIntervalS)
+		s.logConfigDiff(ctx, s.rescanIntervalDiff(ref, cfg.RescanIntervalS, 0))
+		return
+	}
+	// Recorded first, so a crash right after the change still leaves it restorable.
+	if err := s.saveRescanInterval(ref, cfg.RescanIntervalS); err != nil {
+		s.Logger.Printf("Failed to save state: %v", err)
+		return
+	}
+	if _, err := client.SetFolderRescanInterval(ctx, id, 0, rescanIntervalTimeout); err != nil {
+		s.logFailure(ctx, key, "rescan interval", err, "Failed to set the rescan interval of folder '%s'%s to 0: %v", ref, s.labelSuffix(ref), err)
+		if err := s.saveRescanInterval(ref, 0); err != nil {
+			s.Logger.Printf("Failed to save state: %v", err)
+		}
+		return
+	}
+	s.log(ctx).Printf("Set the rescan interval of folder '%s'%s from %ds to 0; the kicker schedules its scans", ref, s.labelSuffix(ref), cfg.RescanIntervalS)
+	s.logConfigDiff(ctx, s.rescanIntervalDiff(ref, cfg.RescanIntervalS, 0))
+}
+
+func (s *Service) rescanIntervalDiff(ref string, old, new int) configDiff {
+	return configDiff{
+		Subject: fmt.Sprintf("folder '%s'%s", ref, s.labelSuffix(ref)),
+		Folder:  ref,
+		Changes: []configChange{{"rescanIntervalS", old, new}},
+	}
+}
+
+// restoreRescanIntervals puts back the saved rescan intervals of refs and returns how
+// many could not be restored. An interval changed by hand since is left alone.
+func (s *Service) restoreRescanIntervals(ctx context.Context, refs []string) int {
+	failed := 0
+	for _, ref := range refs {
+		saved := s.stateStore().folder(ref).SavedRescanIntervalS
+		inst, id := s.splitRef(ref)
+		client := s.client(inst)
+		key := "rescan:" + ref
+		cfg, _, err := client.Folder(ctx, id, rescanIntervalTimeout)
+		switch {
+		case isFolderNotFound(err):
+			s.log(ctx).Printf("Forgetting the saved rescan interval of folder '%s': it no longer exists", ref)
+		case err != nil:
+			s.logFailure(ctx, key, "rescan interval", err, "Cannot read folder '%s'%s to restore its rescan interval: %v", ref, s.labelSuffix(ref), err)
+			failed++
+			continue
+		case cfg.RescanIntervalS != 0:
+			s.log(ctx).Printf("Not restoring the rescan interval of folder '%s'%s: it was changed to %ds since", ref, s.labelSuffix(ref), cfg.RescanIntervalS)
+		case s.Settings.DryRun:
+			s.log(ctx).Printf("[dry-run] Would restore the rescan interval of folder '%s'%s to %ds", ref, s.labelSuffix(ref), saved)
+			s.logConfigDiff(ctx, s.rescanIntervalDiff(ref, 0, saved))
+			continue
+		default:
+			if _, err := client.SetFolderRescanInterval(ctx, id, saved, rescanIntervalTimeout); err != nil {
+				s.logFailure(ctx, key, "rescan interval", err, "Failed to restore the rescan interval of folder '%s'%s: %v", ref, s.labelSuffix(ref), err)
+				failed++
+				continue
+			}
+			s.logSuccess(ctx, key, "rescan interval")
+			s.log(ctx).Printf("Restored the rescan interval of folder '%s'%s to %ds", ref, s.labelSuffix(ref), saved)
+			s.logConfigDiff(ctx, s.rescanIntervalDiff(ref, 0, saved))
+		}
+		if err := s.saveRescanInterval(ref, 0); err != nil {
+			s.Logger.Printf("Failed to save state: %v", err)
+		}
+	}
+	return failed
+}
+
+func (s *Service) saveRescanInterval(ref string, seconds int) error {
+	return s.stateStore().updateFolder(ref, func(f *FolderState) { f.SavedRescanIntervalS = seconds })
+}
+
+// restoreRescanIntervalsOnShutdown restores every interval the kicker changed. It
+// runs after ctx is cancelled, so it gets a context of its own.
+func (s *Service) restoreRescanIntervalsOnShutdown() {
+	refs := s.stateStore().savedRescanFolders()
+	if len(refs) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(len(refs))*rescanIntervalTimeout)
+	defer cancel()
+	s.restoreRescanIntervals(ctx, refs)
+}
+
+// RestoreRescanIntervals restores every rescan interval ST_MANAGE_RESCAN_INTERVAL
+// changed, for --restore-intervals, and saves the state file.
+func (s *Service) RestoreRescanIntervals(ctx context.Context) error {
+	refs := s.stateStore().savedRescanFolders()
+	if len(refs) == 0 {
+		s.Logger.Printf("No rescan intervals to restore")
+		return nil
+	}
+	failed := s.restoreRescanIntervals(ctx, refs)
+	if err := s.FlushState(); err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+	if failed > 0 {
+		return fmt.Errorf("could not restore the rescan interval of %d folder(s)", failed)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package app
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestManageRescanIntervals(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs", "media", "photos")
+	for _, id := range []string{"docs", "media", "photos"} {
+		fake.setRescanInterval(id, 3600)
+	}
+	settings := Settings{
+		CronExpr:             "0 5 * * *",
+		Folders:              []string{"docs"},
+		FolderCron:           map[string]string{"media": "*/5 * * * *"},
+		ManageRescanInterval: true,
+		StateFile:            filepath.Join(t.TempDir(), "state.json"),
+	}
+	svc := fake.service(t, settings)
+	ctx := context.Background()
+
+	svc.manageRescanIntervals(ctx)
+	svc.manageRescanIntervals(ctx)
+	if fake.folderConfig("docs").RescanIntervalS != 0 || fake.folderConfig("media").RescanIntervalS != 0 || fake.patches != 2 {
+		t.Fatalf("expected docs and media set to 0 once, got %d patches", fake.patches)
+	}
+	if fake.folderConfig("photos").RescanIntervalS != 3600 {
+		t.Fatalf("an unscheduled folder was changed")
+	}
+	if err := svc.FlushState(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	// media is no longer scheduled: its interval comes back on the next start.
+	settings.FolderCron = nil
+	restarted := fake.service(t, settings)
+	restarted.manageRescanIntervals(ctx)
+	if fake.folderConfig("media").RescanIntervalS != 3600 || fake.folderConfig("docs").RescanIntervalS != 0 {
+		t.Fatalf("expected media restored and docs left at 0: %+v", fake.folders)
+	}
+
+	restarted.restoreRescanIntervalsOnShutdown()
+	if fake.folderConfig("docs").RescanIntervalS != 3600 {
+		t.Fatalf("expected docs restored on shutdown, got %d", fake.folderConfig("docs").RescanIntervalS)
+	}
+	if got := restarted.stateStore().savedRescanFolders(); len(got) != 0 {
+		t.Fatalf("expected nothing left to restore, got %v", got)
+	}
+}
+
+func TestRestoreRescanIntervalsLeavesManualChanges(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs", "media")
+	fake.setRescanInterval("docs", 3600)
+	fake.setRescanInterval("media", 60)
+	settings := Settings{
+		FolderCron:           map[string]string{"docs": "0 5 * * *", "media": "0 5 * * *"},
+		ManageRescanInterval: true,
+		StateFile:            filepath.Join(t.TempDir(), "state.json"),
+	}
+	svc := fake.service(t, settings)
+	ctx := context.Background()
+	svc.manageRescanIntervals(ctx)
+	if err := svc.FlushState(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	fake.setRescanInterval("media", 120)
+
+	// --restore-intervals runs with the setting already turned off.
+	settings.ManageRescanInterval = false
+	restore := fake.service(t, settings)
+	var buf syncBuffer
+	restore.Logger = log.New(&buf, "", 0)
+	if err := restore.RestoreRescanIntervals(ctx); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if fake.folderConfig("docs").RescanIntervalS != 3600 || fake.folderConfig("media").RescanIntervalS != 120 {
+		t.Fatalf("unexpected intervals: %+v", fake.folders)
+	}
+	if !strings.Contains(buf.String(), "Not restoring the rescan interval of folder 'media': it was changed to 120s since") {
+		t.Fatalf("expected the manual change to be reported:\n%s", buf.String())
+	}
+	if got := fake.service(t, settings).stateStore().savedRescanFolders(); len(got) != 0 {
+		t.Fatalf("expected the saved intervals to be forgotten, got %v", got)
+	}
+}
+
+func TestManageRescanIntervalsDryRun(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	fake.setRescanInterval("docs", 3600)
+	svc := fake.service(t, Settings{
+		DryRun:               true,
+		FolderCron:           map[string]string{"docs": "0 5 * * *"},
+		ManageRescanInterval: true,
+	})
+	var buf syncBuffer
+	svc.Logger = log.New(&buf, "", 0)
+
+	svc.manageRescanIntervals(context.Background())
+	if fake.patches != 0 || len(svc.stateStore().savedRescanFolders()) != 0 {
+		t.Fatalf("dry run changed the rescan interval")
+	}
+	if !strings.Contains(buf.String(), "[dry-run] Would set the rescan interval of folder 'docs' from 3600s to 0") {
+		t.Fatalf("expected the dry-run change to be logged:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"context"
+	"time"
+)
+
+const restartRequestTimeout = 10 * time.Second
+
+// restartTimeout bounds how long a restarted instance is polled until it answers
+// again; restartPollInterval is how often it is polled.
+var (
+	restartTimeout      = 5 * time.Minute
+	restartPollInterval = 2 * time.Second
+)
+
+// scheduled wraps a scheduled job so that, while a Syncthing restart is in progress,
+// it waits for the restart to finish instead of running against an instance that is
+// down. Its tick context only starts once it runs. A panic in the job is recovered
+// and reported to the supervision loop.
+func (s *Service) scheduled(label string, job func(context.Context)) func() {
+	return func() {
+		defer s.recoverPanic(label)
+		if !s.restartGate.TryRLock() {
+			s.Logger.Printf("Deferring %s until the Syncthing restart finishes", label)
+			s.restartGate.RLock()
+		}
+		defer s.restartGate.RUnlock()
+		ctx, cancel := s.tickContext()
+		defer cancel()
+		s.injectPanic(label)
+		job(ctx)
+	}
+}
+
+// restartSyncthing is the ST_RESTART_CRON job. It waits for scheduled work and
+// status checks in flight, then restarts every instance in turn and waits for each
+// to come back. Scheduled jobs firing meanwhile are deferred until it is done.
+func (s *Service) restartSyncthing() {
+	if !s.Settings.AllowDestructive {
+		s.Logger.Printf("Skipping scheduled Syncthing restart: ST_ALLOW_DESTRUCTIVE is not set")
+		return
+	}
+	if s.Settings.DryRun {
+		s.Logger.Printf("[dry-run] Would restart Syncthing")
+		return
+	}
+	s.Logger.Printf("Syncthing restart due; waiting for scans and status checks in flight")
+	s.restartGate.Lock()
+	defer s.restartGate.Unlock()
+	s.statusChecks.Wait()
+	for _, inst := range s.instances() {
+		s.restartInstance(context.Background(), inst)
+	}
+}
+
+// restartInstance restarts one instance and polls it until it answers with a new
+// start time, logging how long it was gone.
+func (s *Service) restartInstance(ctx context.Context, inst string) {
+	key, name := joinRef(inst, "*"), instanceName(inst)
+	client := s.client(inst)
+	before, _, err := client.SystemStatus(ctx, restartRequestTimeout)
+	if err != nil {
+		s.logFailure(ctx, key, "restart", err, "Cannot read the status of instance %s to restart it: %v", name, err)
+		return
+	}
+	started := time.Now()
+	if _, err := client.Restart(ctx, restartRequestTimeout); err != nil {
+		s.logFailure(ctx, key, "restart", err, "Failed to restart instance %s: %v", name, err)
+		return
+	}
+	s.logSuccess(ctx, key, "restart")
+	s.Logger.Printf("Restarting Syncthing instance %s", name)
+
+	deadline := time.NewTimer(restartTimeout)
+	defer deadline.Stop()
+	poll := time.NewTicker(restartPollInterval)
+	defer poll.Stop()
+	for {
+		select {
+		case <-deadline.C:
+			s.Logger.Printf("Syncthing instance %s did not come back within %s of its restart", name, restartTimeout)
+			return
+		case <-poll.C:
+		}
+		if _, err := client.Ping(ctx, restartRequestTimeout); err != nil {
+			continue
+		}
+		// A ping can still reach the old process before it exits.
+		if st, _, err := client.SystemStatus(ctx, restartRequestTimeout); err != nil || st.StartTime.Equal(before.StartTime) {
+			continue
+		}
+		s.Logger.Printf("Syncthing instance %s is back after a restart; down for %s", name, time.Since(started).Round(time.Millisecond))
+		return
+	}
+}
@@ -0,0 +1,123 @@
+package app
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func shortRestartPolls(t *testing.T) {
+	t.Helper()
+	timeout, interval := restartTimeout, restartPollInterval
+	restartTimeout, restartPollInterval = 500*time.Millisecond, 5*time.Millisecond
+	t.Cleanup(func() { restartTimeout, restartPollInterval = timeout, interval })
+}
+
+func TestRestartSyncthing(t *testing.T) {
+	shortRestartPolls(t)
+	fake := newFakeSyncthing(t, "docs")
+	fake.restartDown = 3
+	svc := fake.service(t, Settings{AllowDestructive: true})
+	var buf syncBuffer
+	svc.Logger = log.New(&buf, "", 0)
+
+	svc.restartSyncthing()
+	if fake.count("/rest/system/restart") != 1 {
+		t.Fatalf("expected one restart, got %d", fake.count("/rest/system/restart"))
+	}
+	if fake.count("/rest/system/ping") < 4 {
+		t.Fatalf("expected polling until the instance answered, got %d pings", fake.count("/rest/system/ping"))
+	}
+	if !strings.Contains(buf.String(), "Syncthing instance default is back after a restart; down for ") {
+		t.Fatalf("expected the downtime to be logged:\n%s", buf.String())
+	}
+}
+
+func TestRestartSyncthingTimesOut(t *testing.T) {
+	shortRestartPolls(t)
+	fake := newFakeSyncthing(t, "docs")
+	fake.restartDown = 1 << 20
+	svc := fake.service(t, Settings{AllowDestructive: true})
+	var buf syncBuffer
+	svc.Logger = log.New(&buf, "", 0)
+
+	svc.restartSyncthing()
+	if !strings.Contains(buf.String(), "Syncthing instance default did not come back within 500ms of its restart") {
+		t.Fatalf("expected the timeout to be logged:\n%s", buf.String())
+	}
+}
+
+func TestRestartSyncthingNeedsAllowDestructive(t *testing.T) {
+	for _, settings := range []Settings{{}, {AllowDestructive: true, DryRun: true}} {
+		fake := newFakeSyncthing(t, "docs")
+		svc := fake.service(t, settings)
+		svc.restartSyncthing()
+		if fake.count("/rest/system/restart") != 0 {
+			t.Fatalf("restarted with %+v", settings)
+		}
+	}
+}
+
+func TestRestartDefersScheduledJobs(t *testing.T) {
+	shortRestartPolls(t)
+	fake := newFakeSyncthing(t, "docs")
+	fake.restartDown = 5
+	svc := fake.service(t, Settings{AllowDestructive: true})
+	var buf syncBuffer
+	svc.Logger = log.New(&buf, "", 0)
+
+	// The restart waits for the job in flight...
+	release := make(chan struct{})
+	running := make(chan struct{})
+	go svc.scheduled("folder:docs", func(context.Context) {
+		close(running)
+		<-release
+	})()
+	<-running
+	restarted := make(chan struct{})
+	go func() {
+		svc.restartSyncthing()
+		close(restarted)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if fake.count("/rest/system/restart") != 0 {
+		t.Fatalf("restarted while a scheduled job was running")
+	}
+
+	// ...and a job firing while the restart is due runs after it, not never.
+	ran := make(chan int, 1)
+	go svc.scheduled("global", func(context.Context) {
+		ran <- fake.count("/rest/system/restart")
+	})()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	<-restarted
+	select {
+	case n := <-ran:
+		if n != 1 {
+			t.Fatalf("the deferred job ran before the restart")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("the deferred job never ran")
+	}
+	if !strings.Contains(buf.String(), "Deferring global until the Syncthing restart finishes") {
+		t.Fatalf("expected the deferral to be logged:\n%s", buf.String())
+	}
+}
+
+func TestLoadSettingsRejectsInvalidRestartCron(t *testing.T) {
+	os.Clearenv()
+	os.Setenv("ST_API_KEY", "abc123")
+	os.Setenv("ST_CRON", "*/5 * * * *")
+	os.Setenv("ST_RESTART_CRON", "0 4 * *")
+	if _, err := LoadSettingsFromEnv(); err == nil || !strings.Contains(err.Error(), "invalid ST_RESTART_CRON") {
+		t.Fatalf("expected an invalid ST_RESTART_CRON to be rejected at load, got %v", err)
+	}
+	os.Setenv("ST_RESTART_CRON", "0 4 * * 0")
+	if s, err := LoadSettingsFromEnv(); err != nil || s.RestartCron != "0 4 * * 0" {
+		t.Fatalf("expected the restart schedule, got %q, %v", s.RestartCron, err)
+	}
+}
@@ -0,0 +1,137 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+// Events raised by scheduled reverts once they are sent.
+const (
+	eventRevertCompleted = "revert_completed"
+	eventRevertFailed    = "revert_failed"
+)
+
+// revertTimeout bounds how long a reverted folder is polled for its local changes to
+// be gone; revertPollInterval is how often it is polled.
+var (
+	revertTimeout      = 5 * time.Minute
+	revertPollInterval = 5 * time.Second
+)
+
+// revertFolder runs a scheduled revert of folder and records it as a run of its own.
+// A revert that was sent raises revert_completed once the folder's local changes are
+// gone, or revert_failed if they are not within revertTimeout.
+func (s *Service) revertFolder(ctx context.Context, folder string) {
+	ctx, run := s.startRun(ctx, actionRevert+":"+folder)
+	defer run.finish()
+	a := run.begin(folder)
+	started := time.Now()
+	result, reverted, detail := s.revert(ctx, folder)
+	run.update(a.index, func(f *RunFolderResult) {
+		f.Result, f.DurationMs, f.Reverted = result, time.Since(started).Milliseconds(), reverted
+	})
+	s.log(ctx).Printf("%s: revert %s", folder, result)
+
+	name := fmt.Sprintf("%s%s", folder, s.labelSuffix(folder))
+	switch result {
+	case resultTriggered:
+		s.notify(NotifyEvent{
+			Type:    eventRevertCompleted,
+			Folder:  folder,
+			Message: fmt.Sprintf("Folder %s reverted: %d locally changed item(s) undone", name, reverted),
+			Fields:  map[string]any{"reverted": reverted},
+		})
+	case resultFailed, resultTimeout:
+		s.notify(NotifyEvent{
+			Type:    eventRevertFailed,
+			Folder:  folder,
+			Message: fmt.Sprintf("Revert of folder %s %s: %s", name, result, detail),
+			Fields:  map[string]any{"result": result, "reason": detail},
+		})
+	}
+}
+
+// revert checks that reverting folder is allowed and worthwhile, reverts it and waits
+// for its local changes to go. It returns the outcome, how many changed items there
+// were and, unless it succeeded, why not.
+func (s *Service) revert(ctx context.Context, folder string) (result string, reverted int64, detail string) {
+	name := fmt.Sprintf("folder '%s'%s", folder, s.labelSuffix(folder))
+	if !s.Settings.AllowDestructive {
+		s.log(ctx).Printf("Skipping revert of %s: ST_ALLOW_DESTRUCTIVE is not set", name)
+		return resultSkipped, 0, "ST_ALLOW_DESTRUCTIVE is not set"
+	}
+	inst, id := s.splitRef(folder)
+	client := s.client(inst)
+	cfg, _, err := client.Folder(ctx, id, actionTimeout)
+	if err != nil {
+		s.logFailure(ctx, "revert:"+folder, "revert", err, "Cannot read the config of %s to revert it: %v", name, err)
+		return resultFailed, 0, err.Error()
+	}
+	if cfg.Type != "receiveonly" {
+		detail = fmt.Sprintf("it is a %s folder, not receiveonly", cfg.Type)
+		s.log(ctx).Printf("Skipping revert of %s: %s", name, detail)
+		return resultSkipped, 0, detail
+	}
+	before, _, err := client.FolderStatus(ctx, id, actionTimeout)
+	if err != nil {
+		s.logFailure(ctx, "revert:"+folder, "revert", err, "Cannot read the status of %s to revert it: %v", name, err)
+		return resultFailed, 0, err.Error()
+	}
+	if before.ReceiveOnlyChangedFiles <= int64(s.Settings.RevertThreshold) {
+		s.log(ctx).Printf("Skipping revert of %s: %d locally changed file(s), not more than ST_REVERT_THRESHOLD (%d)",
+			name, before.ReceiveOnlyChangedFiles, s.Settings.RevertThreshold)
+		return resultSkipped, 0, "below ST_REVERT_THRESHOLD"
+	}
+	if s.Settings.DryRun {
+		s.log(ctx).Printf("[dry-run] Would revert %s, changed locally: %s", name, changedCounts(before))
+		return resultDryRun, 0, ""
+	}
+	s.log(ctx).Printf("Reverting %s, changed locally: %s", name, changedCounts(before))
+	if _, err := client.Revert(ctx, id, actionTimeout); err != nil {
+		s.logFailure(ctx, "revert:"+folder, "revert", err, "Failed to revert %s: %v", name, err)
+		return resultFailed, 0, err.Error()
+	}
+	s.logSuccess(ctx, "revert:"+folder, "revert")
+
+	reverted = changedItems(before)
+	deadline := time.NewTimer(revertTimeout)
+	defer deadline.Stop()
+	poll := time.NewTicker(revertPollInterval)
+	defer poll.Stop()
+	last := before
+	for {
+		select {
+		case <-ctx.Done():
+			return resultFailed, reverted, fmt.Sprintf("stopped waiting with %s still changed locally", changedCounts(last))
+		case <-deadline.C:
+			s.log(ctx).Printf("Revert of %s did not finish within %s: %s still changed locally", name, revertTimeout, changedCounts(last))
+			return resultTimeout, reverted, fmt.Sprintf("%s still changed locally after %s", changedCounts(last), revertTimeout)
+		case <-poll.C:
+		}
+		st, _, err := client.FolderStatus(ctx, id, actionTimeout)
+		if err != nil {
+			s.logFailure(ctx, "revert:"+folder, "revert status", err, "Cannot read the status of %s after reverting it: %v", name, err)
+			continue
+		}
+		s.logSuccess(ctx, "revert:"+folder, "revert status")
+		if changedItems(st) == 0 && st.ReceiveOnlyChangedBytes == 0 {
+			s.log(ctx).Printf("Reverted %s: its local changes are gone", name)
+			return resultTriggered, reverted, ""
+		}
+		last = st
+	}
+}
+
+// changedItems is how many files, directories and deletions differ locally in a
+// receive-only folder.
+func changedItems(st syncthing.FolderStatus) int64 {
+	return st.ReceiveOnlyChangedFiles + st.ReceiveOnlyChangedDirectories + st.ReceiveOnlyChangedDeletes
+}
+
+func changedCounts(st syncthing.FolderStatus) string {
+	return fmt.Sprintf("%d file(s), %d directories, %d deletion(s), %d bytes",
+		st.ReceiveOnlyChangedFiles, st.ReceiveOnlyChangedDirectories, st.ReceiveOnlyChangedDeletes, st.ReceiveOnlyChangedBytes)
+}
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"context"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+func shortRevertPolls(t *testing.T) {
+	t.Helper()
+	timeout, interval := revertTimeout, revertPollInterval
+	revertTimeout, revertPollInterval = 200*time.Millisecond, 10*time.Millisecond
+	t.Cleanup(func() { revertTimeout, revertPollInterval = timeout, interval })
+}
+
+func TestRevertFolder(t *testing.T) {
+	shortRevertPolls(t)
+	fake := newFakeSyncthing(t, "inbox")
+	fake.setType("inbox", "receiveonly")
+	fake.setStatus("inbox", syncthing.FolderStatus{State: "idle", ReceiveOnlyChangedFiles: 12, ReceiveOnlyChangedDeletes: 2, ReceiveOnlyChangedBytes: 1 << 20})
+	svc := fake.service(t, Settings{AllowDestructive: true, RevertThreshold: 10})
+	var buf syncBuffer
+	svc.Logger = log.New(&buf, "", 0)
+	rec := &recordingNotifier{}
+	svc.Notifiers = []Notifier{rec}
+
+	svc.revertFolder(context.Background(), "inbox")
+	svc.notifications.Wait()
+	if fake.count("/rest/db/revert") != 1 {
+		t.Fatalf("expected one revert, got %d", fake.count("/rest/db/revert"))
+	}
+	if !strings.Contains(buf.String(), "Reverting folder 'inbox', changed locally: 12 file(s), 0 directories, 2 deletion(s), 1048576 bytes") {
+		t.Fatalf("expected the counts to be logged:\n%s", buf.String())
+	}
+	if run := svc.lastRun("revert:inbox"); run.Folders[0].Result != resultTriggered || run.Folders[0].Reverted != 14 {
+		t.Fatalf("unexpected run: %+v", run)
+	}
+	if got := rec.types(); len(got) != 1 || got[0] != eventRevertCompleted {
+		t.Fatalf("expected revert_completed, got %v", got)
+	}
+}
+
+func TestRevertFolderTimesOut(t *testing.T) {
+	shortRevertPolls(t)
+	fake := newFakeSyncthing(t, "inbox")
+	fake.setType("inbox", "receiveonly")
+	fake.setStatus("inbox", syncthing.FolderStatus{State: "idle", ReceiveOnlyChangedFiles: 3})
+	fake.revertStuck = true
+	svc := fake.service(t, Settings{AllowDestructive: true})
+	rec := &recordingNotifier{}
+	svc.Notifiers = []Notifier{rec}
+
+	svc.revertFolder(context.Background(), "inbox")
+	svc.notifications.Wait()
+	if run := svc.lastRun("revert:inbox"); run.Folders[0].Result != resultTimeout {
+		t.Fatalf("unexpected run: %+v", run)
+	}
+	if got := rec.types(); len(got) != 1 || got[0] != eventRevertFailed {
+		t.Fatalf("expected revert_failed, got %v", got)
+	}
+}
+
+func TestRevertFolderSafetyChecks(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		allow  bool
+		typ    string
+		files  int64
+		dryRun bool
+		result string
+		logged string
+	}{
+		{"not allowed", false, "receiveonly", 50, false, resultSkipped, "ST_ALLOW_DESTRUCTIVE is not set"},
+		{"not receiveonly", true, "sendonly", 50, false, resultSkipped, "it is a sendonly folder, not receiveonly"},
+		{"at the threshold", true, "receiveonly", 10, false, resultSkipped, "10 locally changed file(s), not more than ST_REVERT_THRESHOLD (10)"},
+		{"dry run", true, "receiveonly", 50, true, resultDryRun, "[dry-run] Would revert folder 'inbox', changed locally: 50 file(s)"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			fake := newFakeSyncthing(t, "inbox")
+			fake.setType("inbox", c.typ)
+			fake.setStatus("inbox", syncthing.FolderStatus{State: "idle", ReceiveOnlyChangedFiles: c.files})
+			svc := fake.service(t, Settings{AllowDestructive: c.allow, DryRun: c.dryRun, RevertThreshold: 10})
+			var buf syncBuffer
+			svc.Logger = log.New(&buf, "", 0)
+			rec := &recordingNotifier{}
+			svc.Notifiers = []Notifier{rec}
+
+			svc.revertFolder(context.Background(), "inbox")
+			svc.notifications.Wait()
+			if fake.count("/rest/db/revert") != 0 || len(rec.types()) != 0 {
+				t.Fatalf("the folder was reverted or an event sent")
+			}
+			if got := svc.lastRun("revert:inbox").Folders[0].Result; got != c.result {
+				t.Fatalf("got result %s, want %s", got, c.result)
+			}
+			if !strings.Contains(buf.String(), c.logged) {
+				t.Fatalf("expected %q in the log:\n%s", c.logged, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+type runIDKey struct{}
+
+// newRunID returns a short random identifier for a run.
+func newRunID() string {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return fmt.Sprintf("%08x", time.Now().UnixNano()&0xffffffff)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// withRunID tags ctx with the ID of the run it belongs to.
+func withRunID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, runIDKey{}, id)
+}
+
+// runIDFrom returns the run ID carried by ctx, if any.
+func runIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(runIDKey{}).(string)
+	return id
+}
+
+// log returns the logger for work done under ctx: lines logged on behalf of a run
+// carry its ID, so interleaved runs can be told apart.
+func (s *Service) log(ctx context.Context) *log.Logger {
+	id := runIDFrom(ctx)
+	if id == "" {
+		return s.Logger
+	}
+	return log.New(runLogWriter{s.Logger, id, s.Settings.LogFormat == logFormatJSON}, "", 0)
+}
+
+// runLogWriter hands lines to the service logger with the run ID prepended, or as
+// a field of its own in the JSON format, so they share its output, flags and lock.
+type runLogWriter struct {
+	l    *log.Logger
+	id   string
+	json bool
+}
+
+func (w runLogWriter) Write(p []byte) (int, error) {
+	if w.json {
+		w.l.Print(jsonFormatter{}.format(logEvent{Msg: strings.TrimSuffix(string(p), "\n"), RunID: w.id}))
+		return len(p), nil
+	}
+	w.l.Print("[" + w.id + "] " + string(p))
+	return len(p), nil
+}
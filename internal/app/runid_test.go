@@ -0,0 +1,79 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+// syncBuffer is a bytes.Buffer safe for loggers writing from several goroutines.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestRunIDPrefixesRunLogLines(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs", "media")
+	fake.setStatus("docs", syncthing.FolderStatus{State: "idle"})
+	svc := fake.service(t, Settings{})
+	var buf syncBuffer
+	svc.Logger = log.New(&buf, "", 0)
+
+	pending := make(chan struct{}, 4)
+	_ = svc.triggerScans(context.Background(), "global", []string{"docs", "media"}, pending)
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(buf.String(), "status:") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	runs := svc.recentRuns().list()
+	if len(runs) != 1 || len(runs[0].ID) != 8 {
+		t.Fatalf("expected one run with an ID, got %+v", runs)
+	}
+	prefix := "[" + runs[0].ID + "] "
+	var triggered, status, summary bool
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if !strings.HasPrefix(line, prefix) {
+			t.Fatalf("line without run ID %q", line)
+		}
+		triggered = triggered || strings.Contains(line, "Triggered scan for folder 'docs'")
+		status = status || strings.Contains(line, "status:")
+		summary = summary || strings.Contains(line, "Run global finished in ")
+	}
+	if !triggered || !status || !summary {
+		t.Fatalf("missing trigger, delayed status or summary line:\n%s", buf.String())
+	}
+	for _, f := range svc.stats.snapshot() {
+		if f.LastRun != runs[0].ID {
+			t.Fatalf("folder %s not tagged with the run: %+v", f.Folder, f)
+		}
+	}
+}
+
+func TestRunIDKeepsCallerID(t *testing.T) {
+	ctx, run := (&Service{}).startRun(withRunID(context.Background(), "abcd1234"), "api:abcd1234")
+	if run.rec.ID != "abcd1234" || runIDFrom(ctx) != "abcd1234" {
+		t.Fatalf("expected the caller's run ID to be kept, got %q", run.rec.ID)
+	}
+	if _, run := (&Service{}).startRun(context.Background(), "global"); run.rec.ID == "" {
+		t.Fatalf("expected a new run ID")
+	}
+}
@@ -0,0 +1,58 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+func TestPostScanEncodesNext(t *testing.T) {
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte("{}"))
+	}))
+	t.Cleanup(srv.Close)
+	client, err := syncthing.NewClient(srv.URL, "test-key", syncthing.ClientOptions{})
+	if err != nil {
+		t.Fatalf("client: %v", err)
+	}
+
+	tests := []struct {
+		folder string
+		opts   syncthing.ScanOptions
+		want   string
+	}{
+		{"docs", syncthing.ScanOptions{}, "folder=docs"},
+		{"docs", syncthing.ScanOptions{Next: 90 * time.Second}, "folder=docs&next=90"},
+		{"docs", syncthing.ScanOptions{Next: 1500 * time.Millisecond, Sub: []string{"a b"}}, "folder=docs&next=2&sub=a+b"},
+		{"*", syncthing.ScanOptions{Next: time.Minute}, ""},
+	}
+	for _, tt := range tests {
+		if _, err := client.PostScan(context.Background(), tt.folder, tt.opts, time.Second); err != nil {
+			t.Fatalf("scan %s: %v", tt.folder, err)
+		}
+		if query != tt.want {
+			t.Fatalf("PostScan(%q, %+v) sent %q; want %q", tt.folder, tt.opts, query, tt.want)
+		}
+	}
+}
+
+func TestScanNextPerFolderOverride(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs", "photos", "music")
+	svc := fake.service(t, Settings{
+		ScanWorkers:    1,
+		ScanNext:       time.Hour,
+		FolderScanNext: map[string]time.Duration{"photos": 6 * time.Hour, "music": 0},
+	})
+	_ = svc.triggerScans(context.Background(), "test", []string{"docs", "photos", "music"}, nil)
+	if got := strings.Join(fake.scannedNext(), ","); got != "3600,21600," {
+		t.Fatalf("unexpected next parameters: %q", got)
+	}
+}
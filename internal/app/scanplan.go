@@ -0,0 +1,302 @@
+package app
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// planHorizon is how far ahead planScan looks for a scan no rule holds back: a
+// week and a day, so every weekly pause window is seen opening and closing.
+const planHorizon = 8 * 24 * time.Hour
+
+// planFireLimit bounds the fire times planScan considers per schedule, enough for
+// one firing every minute over planHorizon.
+const planFireLimit = 12000
+
+// ScanPlan is when a folder's next scheduled scan would really go ahead, for
+// `schedules --effective`, the status page and /metrics. Next is zero when no scan
+// is allowed within planHorizon. HeldBy names the rules that skip the earlier fire
+// times (or hold the folder indefinitely); Conditions those only decided when the
+// scan fires, which may still skip it.
+type ScanPlan struct {
+	Folder     string    `json:"folder"`
+	Next       time.Time `json:"next,omitempty"`
+	Schedule   string    `json:"schedule,omitempty"` // label of the schedule firing at Next
+	HeldBy     []string  `json:"heldBy,omitempty"`
+	Conditions []string  `json:"conditions,omitempty"`
+}
+
+// scanTrigger is a schedule that scans a folder.
+type scanTrigger struct {
+	label string
+	sched cron.Schedule
+}
+
+// scanPlanInput is everything planScan knows about one folder, gathered by
+// ScanPlans so that planScan depends on nothing but its arguments.
+type scanPlanInput struct {
+	Folder       string
+	Triggers     []scanTrigger
+	PauseWindows []PauseWindow
+	PauseCron    cron.Schedule // ST_PAUSE_CRON, nil if none
+	ResumeCron   cron.Schedule // ST_RESUME_CRON, nil if none
+	Missing      bool          // not in Syncthing's folder list
+	Inactive     string        // "paused" or "stopped" when found so in Syncthing
+	CronPaused   bool          // paused by ST_PAUSE_CRON
+	State        string        // last observed Syncthing state
+	LastScan     time.Time     // last scan the kicker triggered
+	RetryAt      time.Time     // while the folder's instance is unreachable, when it is tried again
+	Condition    string        // scan condition command, if any
+}
+
+// scanRules are the settings that decide whether a fired scan goes ahead.
+type scanRules struct {
+	SkipIfScanning    bool
+	DeferWhileSyncing string
+	SkipUnchanged     bool
+	SkipUnchangedMax  time.Duration
+}
+
+// planScan walks the folder's fire times after now, in now's location, and returns
+// the first one nothing holds back. A folder Syncthing does not have, or has
+// stopped, is held indefinitely; a paused one until ST_RESUME_CRON resumes it.
+func planScan(now time.Time, in scanPlanInput, rules scanRules) ScanPlan {
+	plan := ScanPlan{Folder: in.Folder}
+	switch {
+	case len(in.Triggers) == 0:
+		plan.HeldBy = []string{"no schedule scans it"}
+		return plan
+	case in.Missing:
+		plan.HeldBy = []string{"not in Syncthing's folder list"}
+		return plan
+	case in.Inactive == "stopped":
+		plan.HeldBy = []string{"stopped in Syncthing"}
+		return plan
+	}
+
+	type fire struct {
+		at    time.Time
+		label string
+	}
+	end := now.Add(planHorizon)
+	times := func(sched cron.Schedule, label string) []fire {
+		var out []fire
+		for t := sched.Next(now); !t.IsZero() && !t.After(end) && len(out) < planFireLimit; t = sched.Next(t) {
+			out = append(out, fire{t, label})
+		}
+		return out
+	}
+	var fires []fire
+	for _, tr := range in.Triggers {
+		fires = append(fires, times(tr.sched, tr.label)...)
+	}
+	slices.SortStableFunc(fires, func(a, b fire) int { return a.at.Compare(b.at) })
+
+	// ST_PAUSE_CRON and ST_RESUME_CRON flip the paused state as the fire times pass.
+	var toggles []fire
+	if in.PauseCron != nil {
+		toggles = append(toggles, times(in.PauseCron, actionPause)...)
+	}
+	if in.ResumeCron != nil {
+		toggles = append(toggles, times(in.ResumeCron, actionResume)...)
+	}
+	slices.SortStableFunc(toggles, func(a, b fire) int { return a.at.Compare(b.at) })
+
+	paused, pausedBy := in.Inactive == "paused", "paused in Syncthing"
+	if in.CronPaused {
+		paused, pausedBy = true, "paused by ST_PAUSE_CRON"
+	}
+	var held []string
+	hold := func(why string) {
+		if !slices.Contains(held, why) {
+			held = append(held, why)
+		}
+	}
+	for _, f := range fires {
+		for len(toggles) > 0 && !toggles[0].at.After(f.at) {
+			paused, pausedBy = toggles[0].label == actionPause, "paused by ST_PAUSE_CRON"
+			toggles = toggles[1:]
+		}
+		w, windowOpen := openPauseWindow(in.PauseWindows, f.at)
+		switch {
+		case paused:
+			hold(pausedBy)
+		case f.at.Before(in.RetryAt):
+			hold("instance unreachable until " + in.RetryAt.Format(time.RFC3339))
+		case windowOpen:
+			hold("pause window " + w.Spec)
+		default:
+			plan.Next, plan.Schedule = f.at, f.label
+		}
+		if !plan.Next.IsZero() {
+			break
+		}
+	}
+	plan.HeldBy = held
+	if plan.Next.IsZero() {
+		if len(held) == 0 {
+			plan.HeldBy = []string{"no fire time within " + planHorizon.String()}
+		}
+		return plan
+	}
+
+	switch {
+	case rules.SkipIfScanning && (in.State == "scanning" || in.State == "scan-waiting"):
+		plan.Conditions = append(plan.Conditions, "skipped if still "+in.State)
+	case in.State == "syncing" && rules.DeferWhileSyncing == deferSkip:
+		plan.Conditions = append(plan.Conditions, "skipped if still syncing")
+	case in.State == "syncing" && rules.DeferWhileSyncing == deferWait:
+		plan.Conditions = append(plan.Conditions, "waits while still syncing")
+	}
+	if rules.SkipUnchanged && !in.LastScan.IsZero() {
+		if forced := in.LastScan.Add(rules.SkipUnchangedMax); plan.Next.Before(forced) {
+			plan.Conditions = append(plan.Conditions, "skipped if unchanged (forced from "+forced.In(now.Location()).Format(time.RFC3339)+")")
+		}
+	}
+	if in.Condition != "" {
+		plan.Conditions = append(plan.Conditions, "scan condition must pass")
+	}
+	return plan
+}
+
+// ScanPlans plans the next scan of every folder a schedule names or the kicker has
+// tracked, as of now, from the settings and what the kicker last saw of Syncthing.
+// It asks Syncthing nothing.
+func (s *Service) ScanPlans(now time.Time) ([]ScanPlan, error) {
+	parse := func(setting, folder, expr string) (cron.Schedule, error) {
+		sched, err := cronParser.Parse(expr)
+		if err != nil && folder != "" {
+			return nil, fmt.Errorf("invalid %s expr for %s: %w", setting, folder, err)
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", setting, err)
+		}
+		return sched, nil
+	}
+	var global cron.Schedule
+	if expr := s.Settings.CronExpr; expr != "" {
+		var err error
+		if global, err = parse("ST_CRON", "", expr); err != nil {
+			return nil, err
+		}
+	}
+	folderCron := s.folderCrons()[actionScan]
+
+	refs := map[string]bool{}
+	selectors := s.Folders()
+	if global != nil {
+		for _, ref := range selectors {
+			if _, id := s.splitRef(ref); id != "*" && !strings.HasPrefix(ref, "!") {
+				refs[ref] = true
+			}
+		}
+	}
+	for ref := range folderCron {
+		refs[ref] = true
+	}
+	stats := map[string]FolderStats{}
+	for _, f := range s.stats.snapshot() {
+		if _, id := s.splitRef(f.Folder); id != "*" {
+			refs[f.Folder] = true
+			stats[f.Folder] = f
+		}
+	}
+
+	rules := scanRules{
+		SkipIfScanning:    s.Settings.SkipIfScanning,
+		DeferWhileSyncing: s.Settings.DeferWhileSyncing,
+		SkipUnchanged:     s.Settings.SkipUnchanged,
+		SkipUnchangedMax:  s.Settings.SkipUnchangedMax,
+	}
+	inactive := s.inactive.snapshot()
+	now = now.In(s.schedulerLocation())
+	plans := []ScanPlan{}
+	for _, ref := range slices.Sorted(maps.Keys(refs)) {
+		inst, _ := s.splitRef(ref)
+		key := s.missingRef(ref)
+		folderState := s.stateStore().folder(ref)
+		in := scanPlanInput{
+			Folder:       ref,
+			PauseWindows: s.pauseWindowsFor(ref),
+			Missing:      s.missing.has(key),
+			Inactive:     inactive[key],
+			State:        stats[ref].State,
+			LastScan:     folderState.LastScan,
+			CronPaused:   !folderState.CronPaused.IsZero(),
+			Condition:    s.scanCondition(ref),
+		}
+		if global != nil && coveredBy(selectors, inst, ref) {
+			in.Triggers = append(in.Triggers, scanTrigger{"global", global})
+		}
+		if expr, ok := folderCron[ref]; ok {
+			sched, err := parse("ST_FOLDER_CRON", ref, expr)
+			if err != nil {
+				return nil, err
+			}
+			in.Triggers = append(in.Triggers, scanTrigger{"folder:" + ref, sched})
+		}
+		var err error
+		if expr, ok := s.Settings.FolderPauseCron[ref]; ok {
+			if in.PauseCron, err = parse("ST_PAUSE_CRON", ref, expr); err != nil {
+				return nil, err
+			}
+		}
+		if expr, ok := s.Settings.FolderResumeCron[ref]; ok {
+			if in.ResumeCron, err = parse("ST_RESUME_CRON", ref, expr); err != nil {
+				return nil, err
+			}
+		}
+		if ok, retryAt := s.health.available(inst); !ok {
+			in.RetryAt = retryAt
+		}
+		plans = append(plans, planScan(now, in, rules))
+	}
+	return plans, nil
+}
+
+// scanPlans is ScanPlans for the status page and /metrics, whose settings have
+// already been checked.
+func (s *Service) scanPlans() map[string]ScanPlan {
+	plans, err := s.ScanPlans(time.Now())
+	if err != nil {
+		s.Logger.Printf("Failed to plan scans: %v", err)
+	}
+	out := make(map[string]ScanPlan, len(plans))
+	for _, p := range plans {
+		out[p.Folder] = p
+	}
+	return out
+}
+
+// note sums up what holds the plan's scan back and what may still skip it.
+func (p ScanPlan) note() string {
+	var notes []string
+	if len(p.HeldBy) > 0 {
+		notes = append(notes, "held by "+strings.Join(p.HeldBy, ", "))
+	}
+	if len(p.Conditions) > 0 {
+		notes = append(notes, strings.Join(p.Conditions, ", "))
+	}
+	return strings.Join(notes, "; ")
+}
+
+// WriteScanPlanTable prints scan plans as an aligned table.
+func WriteScanPlanTable(w io.Writer, plans []ScanPlan) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FOLDER\tNEXT SCAN\tSCHEDULE\tNOTE")
+	for _, p := range plans {
+		next := "-"
+		if !p.Next.IsZero() {
+			next = p.Next.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", p.Folder, next, cmp.Or(p.Schedule, "-"), p.note())
+	}
+	return tw.Flush()
+}
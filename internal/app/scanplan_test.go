@@ -0,0 +1,203 @@
+package app
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+func mustSchedule(t *testing.T, expr string) cron.Schedule {
+	t.Helper()
+	sched, err := cronParser.Parse(expr)
+	if err != nil {
+		t.Fatalf("parse %q: %v", expr, err)
+	}
+	return sched
+}
+
+func TestPlanScan(t *testing.T) {
+	// A Monday morning.
+	now := time.Date(2024, 5, 6, 7, 30, 0, 0, time.UTC)
+	at := func(day, hour, minute int) time.Time { return time.Date(2024, 5, day, hour, minute, 0, 0, time.UTC) }
+	hourly := []scanTrigger{{"global", mustSchedule(t, "0 * * * *")}}
+	workHours := mustPauseWindow(t, "08:00-18:00 Mon-Fri")
+
+	for _, c := range []struct {
+		name       string
+		in         scanPlanInput
+		rules      scanRules
+		next       time.Time
+		schedule   string
+		heldBy     []string
+		conditions []string
+	}{
+		{name: "nothing in the way", in: scanPlanInput{Triggers: hourly}, next: at(6, 8, 0), schedule: "global"},
+		{
+			name:     "earliest of several schedules",
+			in:       scanPlanInput{Triggers: append(slices.Clone(hourly), scanTrigger{"folder:docs", mustSchedule(t, "45 7 * * *")})},
+			next:     at(6, 7, 45),
+			schedule: "folder:docs",
+		},
+		{name: "no schedule", heldBy: []string{"no schedule scans it"}},
+		{name: "missing", in: scanPlanInput{Triggers: hourly, Missing: true}, heldBy: []string{"not in Syncthing's folder list"}},
+		{name: "stopped", in: scanPlanInput{Triggers: hourly, Inactive: "stopped"}, heldBy: []string{"stopped in Syncthing"}},
+		{name: "paused by hand", in: scanPlanInput{Triggers: hourly, Inactive: "paused"}, heldBy: []string{"paused in Syncthing"}},
+		{
+			name:     "paused until ST_RESUME_CRON",
+			in:       scanPlanInput{Triggers: hourly, Inactive: "paused", ResumeCron: mustSchedule(t, "30 17 * * *")},
+			next:     at(6, 18, 0),
+			schedule: "global",
+			heldBy:   []string{"paused in Syncthing"},
+		},
+		{
+			name:     "ST_PAUSE_CRON firing with the scan",
+			in:       scanPlanInput{Triggers: hourly, PauseCron: mustSchedule(t, "0 8 * * *"), ResumeCron: mustSchedule(t, "0 12 * * *")},
+			next:     at(6, 12, 0),
+			schedule: "global",
+			heldBy:   []string{"paused by ST_PAUSE_CRON"},
+		},
+		{
+			name:     "pause window",
+			in:       scanPlanInput{Triggers: hourly, PauseWindows: []PauseWindow{workHours}},
+			next:     at(6, 18, 0),
+			schedule: "global",
+			heldBy:   []string{"pause window 08:00-18:00 Mon-Fri"},
+		},
+		{
+			name:   "every fire time in a pause window",
+			in:     scanPlanInput{Triggers: []scanTrigger{{"global", mustSchedule(t, "0 9 * * 1-5")}}, PauseWindows: []PauseWindow{workHours}},
+			heldBy: []string{"pause window 08:00-18:00 Mon-Fri"},
+		},
+		{
+			name:     "unreachable, then a pause window",
+			in:       scanPlanInput{Triggers: hourly, RetryAt: at(6, 8, 10), PauseWindows: []PauseWindow{mustPauseWindow(t, "08:30-10:00")}},
+			next:     at(6, 10, 0),
+			schedule: "global",
+			heldBy:   []string{"instance unreachable until 2024-05-06T08:10:00Z", "pause window 08:30-10:00"},
+		},
+		{
+			name:     "unreachable",
+			in:       scanPlanInput{Triggers: hourly, RetryAt: at(6, 9, 10)},
+			next:     at(6, 10, 0),
+			schedule: "global",
+			heldBy:   []string{"instance unreachable until 2024-05-06T09:10:00Z"},
+		},
+		{
+			name:       "scanning",
+			in:         scanPlanInput{Triggers: hourly, State: "scanning", Condition: "test -e /mnt/nas"},
+			rules:      scanRules{SkipIfScanning: true},
+			next:       at(6, 8, 0),
+			schedule:   "global",
+			conditions: []string{"skipped if still scanning", "scan condition must pass"},
+		},
+		{
+			name:       "syncing, deferred",
+			in:         scanPlanInput{Triggers: hourly, State: "syncing"},
+			rules:      scanRules{SkipIfScanning: true, DeferWhileSyncing: deferWait},
+			next:       at(6, 8, 0),
+			schedule:   "global",
+			conditions: []string{"waits while still syncing"},
+		},
+		{
+			name:       "syncing, skipped",
+			in:         scanPlanInput{Triggers: hourly, State: "syncing"},
+			rules:      scanRules{DeferWhileSyncing: deferSkip},
+			next:       at(6, 8, 0),
+			schedule:   "global",
+			conditions: []string{"skipped if still syncing"},
+		},
+		{
+			name:     "syncing, not deferred",
+			in:       scanPlanInput{Triggers: hourly, State: "syncing"},
+			rules:    scanRules{SkipIfScanning: true, DeferWhileSyncing: deferOff},
+			next:     at(6, 8, 0),
+			schedule: "global",
+		},
+		{
+			name:       "skip unchanged before the forced rescan",
+			in:         scanPlanInput{Triggers: hourly, LastScan: at(6, 7, 0)},
+			rules:      scanRules{SkipUnchanged: true, SkipUnchangedMax: 2 * time.Hour},
+			next:       at(6, 8, 0),
+			schedule:   "global",
+			conditions: []string{"skipped if unchanged (forced from 2024-05-06T09:00:00Z)"},
+		},
+		{
+			name:     "skip unchanged past the forced rescan",
+			in:       scanPlanInput{Triggers: hourly, LastScan: at(6, 5, 0)},
+			rules:    scanRules{SkipUnchanged: true, SkipUnchangedMax: 2 * time.Hour},
+			next:     at(6, 8, 0),
+			schedule: "global",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			c.in.Folder = "docs"
+			got := planScan(now, c.in, c.rules)
+			if !got.Next.Equal(c.next) || got.Schedule != c.schedule {
+				t.Fatalf("next %s by %q, want %s by %q (held by %q)", got.Next, got.Schedule, c.next, c.schedule, got.HeldBy)
+			}
+			if !slices.Equal(got.HeldBy, c.heldBy) || !slices.Equal(got.Conditions, c.conditions) {
+				t.Fatalf("held by %q with conditions %q, want %q and %q", got.HeldBy, got.Conditions, c.heldBy, c.conditions)
+			}
+		})
+	}
+}
+
+func TestScanPlansFromSettings(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs", "photos", "music")
+	svc := fake.service(t, Settings{
+		CronExpr:         "0 * * * *",
+		Folders:          []string{"*", "!photos"},
+		FolderCron:       map[string]string{"music": "30 * * * *"},
+		PauseWindows:     map[string][]PauseWindow{"music": {mustPauseWindow(t, "00:00-12:00")}},
+		FolderPauseCron:  map[string]string{"docs": "0 0 1 1 *"},
+		FolderResumeCron: map[string]string{"docs": "0 0 2 1 *"},
+	})
+	if err := svc.checkSyncStatus(context.Background(), []string{"*"}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	plans, err := svc.ScanPlans(time.Date(2024, 5, 6, 7, 10, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range plans {
+		got = append(got, p.Folder+" "+p.Next.Format("15:04")+" "+p.Schedule+" "+p.note())
+	}
+	if want := []string{
+		"docs 08:00 global ",
+		"music 12:00 global held by pause window 00:00-12:00",
+		"photos 00:00  held by no schedule scans it",
+	}; !slices.Equal(got, want) {
+		t.Fatalf("unexpected plans:\n%s", strings.Join(got, "\n"))
+	}
+
+	out := scrape(t, svc)
+	if !strings.Contains(out, `syncthing_kicker_next_scan_timestamp_seconds{folder="docs",instance="default"} `) ||
+		strings.Contains(out, `syncthing_kicker_next_scan_timestamp_seconds{folder="photos"`) {
+		t.Fatalf("expected a next scan gauge for docs only:\n%s", out)
+	}
+
+	svc.Settings.FolderCron = map[string]string{"music": "61 * * * *"}
+	if _, err := svc.ScanPlans(time.Now()); err == nil || !strings.Contains(err.Error(), "invalid ST_FOLDER_CRON expr for music") {
+		t.Fatalf("expected a schedule error, got %v", err)
+	}
+}
+
+func TestWriteScanPlanTable(t *testing.T) {
+	var b strings.Builder
+	_ = WriteScanPlanTable(&b, []ScanPlan{
+		{Folder: "docs", Next: time.Date(2024, 5, 6, 18, 0, 0, 0, time.UTC), Schedule: "global", HeldBy: []string{"pause window 08:00-18:00 Mon-Fri"}, Conditions: []string{"scan condition must pass"}},
+		{Folder: "photos", HeldBy: []string{"stopped in Syncthing"}},
+	})
+	want := "FOLDER  NEXT SCAN             SCHEDULE  NOTE\n" +
+		"docs    2024-05-06T18:00:00Z  global    held by pause window 08:00-18:00 Mon-Fri; scan condition must pass\n" +
+		"photos  -                     -         held by stopped in Syncthing\n"
+	if b.String() != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
@@ -0,0 +1,62 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+// ST_SCAN_TIMEOUT_POLICY values: what a scan trigger that times out counts as.
+const (
+	scanTimeoutOK    = "ok"    // success; Syncthing often holds the POST open while it scans
+	scanTimeoutWarn  = "warn"  // success, but logged as a warning
+	scanTimeoutError = "error" // failure, feeding streaks and alerts
+)
+
+// scanTriggerTimeout bounds the POST that triggers a scan.
+var scanTriggerTimeout = 5 * time.Second
+
+// errScanTimeout is a trigger that timed out under ST_SCAN_TIMEOUT_POLICY=error, or
+// one the following status check showed never started a scan.
+var errScanTimeout = errors.New("scan trigger timed out")
+
+// timedOut reports whether a trigger attempt ended in a timeout, whatever the policy
+// made of it.
+func timedOut(result string, err error) bool {
+	return result == resultTimeout || errors.Is(err, errScanTimeout)
+}
+
+// scanStarted reports whether st shows Syncthing started scanning after since: it is
+// scanning now, or its state changed since. A status without stateChanged proves
+// nothing either way and counts as started.
+func scanStarted(st syncthing.FolderStatus, since time.Time) bool {
+	return st.State == "scanning" || st.State == "scan-waiting" || st.StateChanged.IsZero() || !st.StateChanged.Before(since)
+}
+
+// failUnconfirmedTimeout turns a timed-out trigger into a failure once the status
+// check after it shows Syncthing never started scanning, whatever ST_SCAN_TIMEOUT_POLICY
+// says: a wedged Syncthing times out every trigger without doing anything.
+func (s *Service) failUnconfirmedTimeout(ctx context.Context, folder string, st syncthing.FolderStatus) {
+	err := fmt.Errorf("%w and Syncthing never started scanning (state %s since %s)", errScanTimeout, st.State, st.StateChanged.UTC().Format(time.RFC3339))
+	s.logFailure(ctx, folder, "scan", err, "Scan trigger for folder '%s'%s: %v", folder, s.labelSuffix(folder), err)
+	s.stats.failTimeout(folder, err)
+	uerr := s.stateStore().updateFolder(folder, func(f *FolderState) {
+		if f.LastResult != resultTimeout {
+			return
+		}
+		f.Scans--
+		f.Failures++
+		f.LastResult = resultFailed
+		f.LastError = err.Error()
+	})
+	if uerr != nil {
+		s.Logger.Printf("Failed to save state: %v", uerr)
+	}
+	if s.StatsD != nil {
+		s.StatsD.Count("failures", 1, s.folderTags(folder)...)
+	}
+	s.trackFailureStreak(ctx, folder, resultFailed, err)
+}
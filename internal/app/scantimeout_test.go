@@ -0,0 +1,104 @@
+package app
+
+import (
+	"context"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+// slowTrigger makes every scan trigger against fake time out.
+func slowTrigger(t *testing.T, fake *fakeSyncthing) {
+	t.Helper()
+	old := scanTriggerTimeout
+	scanTriggerTimeout = 20 * time.Millisecond
+	t.Cleanup(func() { scanTriggerTimeout = old })
+	fake.slowScans(100 * time.Millisecond)
+}
+
+func TestScanTimeoutPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		policy, result, log string
+		failures            int64
+		alerts              []string
+	}{
+		{scanTimeoutOK, resultTimeout, "Scan trigger for folder 'docs' timed out", 0, nil},
+		{scanTimeoutWarn, resultTimeout, "Warning: scan trigger for folder 'docs' timed out", 0, nil},
+		{scanTimeoutError, resultFailed, "Scan trigger failed for folder 'docs': scan trigger timed out after 20ms", 1, []string{eventScanFailed}},
+	} {
+		t.Run(tc.policy, func(t *testing.T) {
+			fake := newFakeSyncthing(t, "docs")
+			slowTrigger(t, fake)
+			var logs syncBuffer
+			rec := &recordingNotifier{}
+			svc := fake.service(t, Settings{ScanTimeoutPolicy: tc.policy, AlertAfter: 1})
+			svc.Logger = log.New(&logs, "", 0)
+			svc.Notifiers = []Notifier{rec}
+
+			if got := svc.triggerScan(context.Background(), "docs"); got != tc.result {
+				t.Fatalf("result = %s, want %s", got, tc.result)
+			}
+			svc.notifications.Wait()
+			if !strings.Contains(logs.String(), tc.log) {
+				t.Fatalf("expected %q in log:\n%s", tc.log, logs.String())
+			}
+			f := svc.stats.snapshot()[0]
+			if f.Timeouts != 1 || f.Failures != tc.failures {
+				t.Fatalf("unexpected counters: %+v", f)
+			}
+			if got := rec.types(); strings.Join(got, ",") != strings.Join(tc.alerts, ",") {
+				t.Fatalf("alerts = %v, want %v", got, tc.alerts)
+			}
+		})
+	}
+}
+
+func TestUnconfirmedTimeoutBecomesFailure(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs", "photos")
+	slowTrigger(t, fake)
+	// docs has not changed state in a day: the trigger never reached the scanner.
+	fake.setStatus("docs", syncthing.FolderStatus{State: "idle", StateChanged: time.Now().Add(-24 * time.Hour)})
+	fake.setStatus("photos", syncthing.FolderStatus{State: "scanning", StateChanged: time.Now().Add(-24 * time.Hour)})
+	rec := &recordingNotifier{}
+	svc := fake.service(t, Settings{AlertAfter: 1})
+	svc.Notifiers = []Notifier{rec}
+
+	_ = svc.triggerScans(context.Background(), "global", []string{"docs", "photos"}, nil)
+	svc.statusChecks.Wait()
+	svc.notifications.Wait()
+
+	run := svc.lastRun("global")
+	if run.Folders[0].Result != resultFailed || run.Folders[1].Result != resultTimeout {
+		t.Fatalf("unexpected run: %+v", run.Folders)
+	}
+	if f := svc.stateStore().folder("docs"); f.LastResult != resultFailed || f.Failures != 1 || f.Scans != 0 || !strings.Contains(f.LastError, "never started scanning") {
+		t.Fatalf("unexpected stored state: %+v", f)
+	}
+	if got := rec.types(); len(got) != 1 || got[0] != eventScanFailed || rec.events[0].Folder != "docs" {
+		t.Fatalf("expected scan_failed for docs, got %+v", rec.events)
+	}
+}
+
+func TestUnconfirmedTimeoutsReachAlertAfter(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	slowTrigger(t, fake)
+	fake.setStatus("docs", syncthing.FolderStatus{State: "idle", StateChanged: time.Now().Add(-24 * time.Hour)})
+	rec := &recordingNotifier{}
+	svc := fake.service(t, Settings{AlertAfter: 3})
+	svc.Notifiers = []Notifier{rec}
+
+	for i := 1; i <= 3; i++ {
+		_ = svc.triggerScans(context.Background(), "global", []string{"docs"}, nil)
+		svc.statusChecks.Wait()
+		svc.notifications.Wait()
+		if f := svc.stateStore().folder("docs"); f.FailureStreak != i {
+			t.Fatalf("after %d timeouts the streak is %d", i, f.FailureStreak)
+		}
+	}
+	if got := rec.types(); len(got) != 1 || got[0] != eventScanFailed {
+		t.Fatalf("expected a single scan_failed, got %v", got)
+	}
+}
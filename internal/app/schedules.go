@@ -0,0 +1,118 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// scheduleUpcoming is how many fire times a schedule description lists.
+const scheduleUpcoming = 3
+
+// ScheduleInfo describes one scheduler entry for /api/schedules and the
+// `schedules` subcommand. Kind is global, folder (an ST_FOLDER_CRON scan) or action
+// (any other job); Folder is set for per-folder entries. Next is the first of
+// Upcoming, kept for older consumers. Suppressed is set while a folder's scans are
+// held off, SuppressedBy saying by what.
+type ScheduleInfo struct {
+	Label        string    `json:"label"`
+	Kind         string    `json:"kind"`
+	Folder       string    `json:"folder,omitempty"`
+	Expr         string    `json:"expr"`
+	Timezone     string    `json:"timezone"`
+	Next         time.Time `json:"next"`
+	Upcoming     []string  `json:"upcoming"` // RFC3339, in Timezone
+	Suppressed   bool      `json:"suppressed"`
+	SuppressedBy string    `json:"suppressedBy,omitempty"`
+}
+
+// describeSchedules describes entries as scheduled on c, with fire times after now.
+// Both the admin API and the `schedules` subcommand go through here.
+func (s *Service) describeSchedules(c *cron.Cron, entries []scheduleEntry, now time.Time) []ScheduleInfo {
+	out := []ScheduleInfo{}
+	loc := c.Location()
+	now = now.In(loc)
+	zone := loc.String()
+	if zone == "Local" {
+		zone, _ = now.Zone()
+	}
+	for _, e := range entries {
+		entry := c.Entry(e.id)
+		if entry.Schedule == nil {
+			continue
+		}
+		info := ScheduleInfo{Label: e.label, Kind: "action", Expr: e.expr, Timezone: zone, Upcoming: []string{}}
+		switch action, folder, _ := strings.Cut(e.label, ":"); {
+		case e.label == "global":
+			info.Kind = "global"
+		case action == "folder":
+			info.Kind, info.Folder = "folder", folder
+		case e.folderCron, action == actionPause, action == actionResume:
+			info.Folder = folder
+		}
+		for t := now; len(info.Upcoming) < scheduleUpcoming; {
+			t = entry.Schedule.Next(t)
+			if t.IsZero() {
+				break
+			}
+			if info.Next.IsZero() {
+				info.Next = t
+			}
+			info.Upcoming = append(info.Upcoming, t.Format(time.RFC3339))
+		}
+		if info.Kind == "folder" {
+			if w, ok := openPauseWindow(s.pauseWindowsFor(info.Folder), now); ok {
+				info.Suppressed, info.SuppressedBy = true, "pause window "+w.Spec
+			}
+		}
+		out = append(out, info)
+	}
+	return out
+}
+
+// pauseWindowsFor returns the ST_PAUSE_WINDOWS windows of folder, however its
+// instance is written.
+func (s *Service) pauseWindowsFor(folder string) []PauseWindow {
+	var out []PauseWindow
+	for ref, ws := range s.Settings.PauseWindows {
+		if s.missingRef(ref) == s.missingRef(folder) {
+			out = append(out, ws...)
+		}
+	}
+	return out
+}
+
+// DescribeSchedules builds the schedules the settings configure, without starting
+// them, and describes them as of now.
+func (s *Service) DescribeSchedules(now time.Time) ([]ScheduleInfo, error) {
+	c, err := s.buildCronScheduler(nil)
+	if err != nil {
+		return nil, err
+	}
+	s.schedMu.Lock()
+	entries := s.schedules
+	s.schedMu.Unlock()
+	return s.describeSchedules(c, entries, now), nil
+}
+
+// WriteScheduleTable prints schedule descriptions as an aligned table.
+func WriteScheduleTable(w io.Writer, infos []ScheduleInfo) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "LABEL\tEXPR\tTIMEZONE\tNEXT\tNOTE")
+	for _, info := range infos {
+		next := "-"
+		if len(info.Upcoming) > 0 {
+			next = strings.Join(info.Upcoming, ", ")
+		}
+		note := ""
+		if info.Suppressed {
+			note = "suppressed by " + info.SuppressedBy
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", info.Label, info.Expr, info.Timezone, next, note)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,95 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDescribeSchedulesAcrossDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no tzdata: %v", err)
+	}
+	svc := newFakeSyncthing(t, "docs", "media").service(t, Settings{
+		CronExpr:         "0 3 * * *",
+		CronTimezone:     "America/New_York",
+		FolderCron:       map[string]string{"docs": "*/30 9-17 * * 1-5"},
+		FolderRevertCron: map[string]string{"media": "0 4 * * 0"},
+		DigestCron:       "0 8 * * *",
+		PauseWindows:     map[string][]PauseWindow{"default/docs": {mustPauseWindow(t, "08:00-18:00 Mon-Fri")}},
+	})
+	// Friday noon, two days before clocks go forward.
+	now := time.Date(2024, 3, 8, 12, 0, 0, 0, ny)
+	infos, err := svc.DescribeSchedules(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byLabel := map[string]ScheduleInfo{}
+	for _, info := range infos {
+		byLabel[info.Label] = info
+		if info.Timezone != "America/New_York" || len(info.Upcoming) != scheduleUpcoming {
+			t.Fatalf("unexpected description: %+v", info)
+		}
+	}
+	if len(infos) != 4 {
+		t.Fatalf("expected 4 schedules, got %+v", infos)
+	}
+
+	global := byLabel["global"]
+	if want := []string{"2024-03-09T03:00:00-05:00", "2024-03-10T03:00:00-04:00", "2024-03-11T03:00:00-04:00"}; global.Kind != "global" || !slices.Equal(global.Upcoming, want) {
+		t.Fatalf("global = %+v, want upcoming %v", global, want)
+	}
+	if !global.Next.Equal(time.Date(2024, 3, 9, 8, 0, 0, 0, time.UTC)) || global.Suppressed {
+		t.Fatalf("unexpected global next or suppression: %+v", global)
+	}
+	docs := byLabel["folder:docs"]
+	if want := []string{"2024-03-08T12:30:00-05:00", "2024-03-08T13:00:00-05:00", "2024-03-08T13:30:00-05:00"}; docs.Kind != "folder" || docs.Folder != "docs" || !slices.Equal(docs.Upcoming, want) {
+		t.Fatalf("docs = %+v, want upcoming %v", docs, want)
+	}
+	if !docs.Suppressed || docs.SuppressedBy != "pause window 08:00-18:00 Mon-Fri" {
+		t.Fatalf("docs should be suppressed by its pause window: %+v", docs)
+	}
+	if revert := byLabel["revert:media"]; revert.Kind != "action" || revert.Folder != "media" || revert.Upcoming[0] != "2024-03-10T04:00:00-04:00" {
+		t.Fatalf("unexpected revert entry: %+v", revert)
+	}
+	if digest := byLabel["digest"]; digest.Kind != "action" || digest.Folder != "" || digest.Upcoming[0] != "2024-03-09T08:00:00-05:00" {
+		t.Fatalf("unexpected digest entry: %+v", digest)
+	}
+
+	// In the evening the window has closed.
+	infos, _ = svc.DescribeSchedules(time.Date(2024, 3, 8, 19, 0, 0, 0, ny))
+	for _, info := range infos {
+		if info.Suppressed {
+			t.Fatalf("nothing should be suppressed outside the window: %+v", info)
+		}
+	}
+}
+
+func TestAdminAPISchedulesDescribeRunningEntries(t *testing.T) {
+	svc := newFakeSyncthing(t, "photos").service(t, Settings{CronExpr: "0 5 * * *", CronTimezone: "Europe/Lisbon"})
+	sched, err := svc.buildCronScheduler(make(chan struct{}, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.cron = sched
+	h := svc.adminHandler(context.Background(), make(chan struct{}, 1))
+
+	rec := adminRequest(t, h, http.MethodGet, "/api/schedules", "", "")
+	var resp struct {
+		Schedules []ScheduleInfo `json:"schedules"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Schedules) != 1 || resp.Schedules[0].Timezone != "Europe/Lisbon" || len(resp.Schedules[0].Upcoming) != scheduleUpcoming {
+		t.Fatalf("unexpected schedules: %+v", resp.Schedules)
+	}
+	first, err := time.Parse(time.RFC3339, resp.Schedules[0].Upcoming[0])
+	if err != nil || !first.Equal(resp.Schedules[0].Next) {
+		t.Fatalf("upcoming should start at next: %+v (%v)", resp.Schedules[0], err)
+	}
+}
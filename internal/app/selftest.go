@@ -0,0 +1,293 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"time"
+)
+
+// selfTestTimeout bounds each Syncthing call and test notification of a self-test.
+const selfTestTimeout = 10 * time.Second
+
+// eventSelfTest is the event `selftest --notify` sends to every sink.
+const eventSelfTest = "selftest"
+
+// SelfTestStage is the outcome of one step of `syncthing-kicker selftest`. A stage
+// passes when it found no problems; details say what it saw either way.
+type SelfTestStage struct {
+	Name     string   `json:"name"`
+	Skipped  bool     `json:"skipped,omitempty"`
+	Details  []string `json:"details,omitempty"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+// OK reports whether the stage found no problems.
+func (st SelfTestStage) OK() bool { return len(st.Problems) == 0 }
+
+func (st *SelfTestStage) detail(format string, args ...any) {
+	st.Details = append(st.Details, fmt.Sprintf(format, args...))
+}
+
+func (st *SelfTestStage) problem(format string, args ...any) {
+	st.Problems = append(st.Problems, fmt.Sprintf(format, args...))
+}
+
+// SelfTest goes through everything the daemon does short of scanning, handing each
+// stage to done as soon as it has run: the settings, a ping of every instance, the
+// folders the settings name against each instance's config, one folder status call
+// per instance, the schedules with their next fire times, and which windows and
+// bandwidth limits are in force at now. With notify, a test event is sent to every
+// notification sink as well. Nothing in Syncthing's config or the state file is
+// changed; stages that need an unreachable instance leave it out.
+func (s *Service) SelfTest(ctx context.Context, now time.Time, notify bool, done func(SelfTestStage)) []SelfTestStage {
+	var out []SelfTestStage
+	run := func(st SelfTestStage) {
+		out = append(out, st)
+		if done != nil {
+			done(st)
+		}
+	}
+
+	st := SelfTestStage{Name: "settings"}
+	st.detail("loaded; %d instance(s), %d notification sink(s)", len(s.instances()), len(s.Notifiers))
+	for _, w := range s.Settings.Warnings() {
+		st.detail("warning: %s", w)
+	}
+	run(st)
+
+	reachable := map[string]bool{}
+	st = SelfTestStage{Name: "instances"}
+	for _, inst := range s.instances() {
+		if _, err := s.client(inst).Ping(ctx, selfTestTimeout); err != nil {
+			st.problem("instance %s: ping failed: %v", instanceName(inst), err)
+			continue
+		}
+		reachable[inst] = true
+		st.detail("instance %s: ping ok", instanceName(inst))
+	}
+	run(st)
+
+	probe := map[string]string{}
+	run(s.selfTestFolders(ctx, reachable, probe))
+	run(s.selfTestStatus(ctx, reachable, probe))
+
+	st = SelfTestStage{Name: "schedules"}
+	infos, err := s.DescribeSchedules(now)
+	if err != nil {
+		st.problem("%v", err)
+	}
+	for _, info := range infos {
+		next := "never"
+		if len(info.Upcoming) > 0 {
+			next = info.Upcoming[0]
+		}
+		if info.Suppressed {
+			next += ", suppressed now by " + info.SuppressedBy
+		}
+		st.detail("%s (%s): next %s", info.Label, info.Expr, next)
+	}
+	if err == nil && len(infos) == 0 {
+		st.detail("no schedules configured")
+	}
+	run(st)
+
+	run(s.selfTestWindows(now))
+	run(s.selfTestNotify(ctx, now, notify))
+	return out
+}
+
+// selfTestFolders checks that every folder the settings name exists on its instance,
+// by ID as scans and pauses need it, and records in probe a folder per instance for
+// the status call.
+func (s *Service) selfTestFolders(ctx context.Context, reachable map[string]bool, probe map[string]string) SelfTestStage {
+	st := SelfTestStage{Name: "folders"}
+	ids := map[string]map[string]bool{}
+	labels := map[string]map[string]string{}
+	for _, inst := range s.instances() {
+		if !reachable[inst] {
+			continue
+		}
+		list, err := s.cachedFolders(ctx, inst)
+		if err != nil {
+			st.problem("instance %s: cannot list folders: %v", instanceName(inst), err)
+			continue
+		}
+		st.detail("instance %s: %d folder(s) configured", instanceName(inst), len(list))
+		ids[inst], labels[inst] = map[string]bool{}, map[string]string{}
+		for _, cfg := range list {
+			ids[inst][cfg.ID] = true
+			if cfg.Label != "" {
+				labels[inst][cfg.Label] = cfg.ID
+			}
+		}
+		if len(list) > 0 {
+			probe[inst] = list[0].ID
+		}
+	}
+
+	if len(ids) == 0 && st.OK() {
+		st.Skipped = true
+		st.detail("no reachable instance")
+		return st
+	}
+
+	type source struct {
+		name string
+		refs []string
+	}
+	sources := []source{
+		{"ST_FOLDERS", s.Folders()},
+		{"ST_FOLDER_PRIORITY", s.Settings.FolderPriority},
+		{"ST_PAUSE_WINDOWS", slices.Sorted(maps.Keys(s.Settings.PauseWindows))},
+		{"ST_WATCHER_OFF_WINDOWS", slices.Sorted(maps.Keys(s.Settings.WatcherOffWindows))},
+		{"ST_PAUSE_CRON", slices.Sorted(maps.Keys(s.Settings.FolderPauseCron))},
+		{"ST_RESUME_CRON", slices.Sorted(maps.Keys(s.Settings.FolderResumeCron))},
+	}
+	crons := s.folderCrons()
+	for _, action := range folderCronActions {
+		sources = append(sources, source{"ST_FOLDER_CRON", slices.Sorted(maps.Keys(crons[action]))})
+	}
+	checked := map[string]bool{}
+	for _, src := range sources {
+		for _, ref := range src.refs {
+			inst, id := s.splitRef(ref)
+			if id == "*" || ids[inst] == nil || checked[src.name+"\x00"+ref] {
+				continue
+			}
+			checked[src.name+"\x00"+ref] = true
+			switch {
+			case ids[inst][id]:
+				probe[inst] = id
+			case labels[inst][id] != "":
+				st.problem("%s entry '%s' is a label; name folder ID '%s' instead", src.name, ref, joinRef(inst, labels[inst][id]))
+			default:
+				st.problem("%s entry '%s' matches no folder on instance %s", src.name, ref, instanceName(inst))
+			}
+		}
+	}
+	return st
+}
+
+// selfTestStatus reads the status of one folder per reachable instance, a configured
+// one where there is any, to check the API key reaches beyond a ping.
+func (s *Service) selfTestStatus(ctx context.Context, reachable map[string]bool, probe map[string]string) SelfTestStage {
+	st := SelfTestStage{Name: "folder status"}
+	for _, inst := range s.instances() {
+		id, ok := probe[inst]
+		if !reachable[inst] || !ok {
+			continue
+		}
+		ref := joinRef(inst, id)
+		status, _, err := s.client(inst).FolderStatus(ctx, id, selfTestTimeout)
+		if err != nil {
+			st.problem("folder '%s'%s: %v", ref, s.labelSuffix(ref), err)
+			continue
+		}
+		st.detail("folder '%s'%s: %s", ref, s.labelSuffix(ref), status.State)
+	}
+	if len(st.Details)+len(st.Problems) == 0 {
+		st.Skipped = true
+		st.detail("no reachable instance has folders")
+	}
+	return st
+}
+
+// selfTestWindows reports which pause and watcher windows are open at now and which
+// ST_BANDWIDTH_SCHEDULE limits are in force. It reads the bandwidth schedule
+// buildCronScheduler parsed, so it runs after the schedules stage.
+func (s *Service) selfTestWindows(now time.Time) SelfTestStage {
+	st := SelfTestStage{Name: "windows"}
+	now = now.In(s.schedulerLocation())
+	for _, kind := range []struct {
+		name    string
+		windows map[string][]PauseWindow
+	}{
+		{"pause window", s.Settings.PauseWindows},
+		{"watcher window", s.Settings.WatcherOffWindows},
+		{"device pause window", s.Settings.DevicePauseWindows},
+	} {
+		for _, key := range slices.Sorted(maps.Keys(kind.windows)) {
+			if w, open := openPauseWindow(kind.windows[key], now); open {
+				st.detail("'%s': %s %s is open now", key, kind.name, w.Spec)
+			} else {
+				st.detail("'%s': no %s open now", key, kind.name)
+			}
+		}
+	}
+	if bandwidth := s.bandwidthRules(); len(bandwidth) > 0 {
+		if rule, fired, ok := currentBandwidthRule(bandwidth, now); ok {
+			st.detail("bandwidth: send %s, receive %s, from schedule '%s' at %s",
+				formatKbps(rule.SendKbps), formatKbps(rule.RecvKbps), rule.Cron, fired.Format(time.RFC3339))
+		} else {
+			st.detail("bandwidth: no ST_BANDWIDTH_SCHEDULE rule fired within the last year")
+		}
+	}
+	if len(st.Details) == 0 {
+		st.detail("no windows or bandwidth schedule configured")
+	}
+	return st
+}
+
+// selfTestNotify sends a test event straight to every sink, past ST_NOTIFY_ROUTES
+// and ST_NOTIFY_COOLDOWN, waiting for each delivery.
+func (s *Service) selfTestNotify(ctx context.Context, now time.Time, notify bool) SelfTestStage {
+	st := SelfTestStage{Name: "notify"}
+	switch {
+	case len(s.Notifiers) == 0:
+		st.Skipped = true
+		st.detail("no notification sinks configured")
+		return st
+	case !notify:
+		st.Skipped = true
+		st.detail("%d sink(s) configured; pass --notify to send each a test event", len(s.Notifiers))
+		return st
+	}
+	ev := NotifyEvent{
+		Type: eventSelfTest, Time: now.UTC(), Severity: "info",
+		Message: "Test event from syncthing-kicker selftest",
+	}
+	for _, n := range s.Notifiers {
+		timeout := selfTestTimeout
+		if t, ok := n.(interface{ DeliveryTimeout() time.Duration }); ok && t.DeliveryTimeout() > 0 {
+			timeout = t.DeliveryTimeout()
+		}
+		nctx, cancel := context.WithTimeout(ctx, timeout)
+		err := n.Notify(nctx, s.renderNotification(n.Name(), ev))
+		cancel()
+		if err != nil {
+			st.problem("sink %s: %v", n.Name(), err)
+			continue
+		}
+		st.detail("sink %s: test event delivered", n.Name())
+	}
+	return st
+}
+
+// WriteSelfTestStage prints a stage as `selftest` shows it: PASS, FAIL or SKIP and its
+// name, then its problems and details indented.
+func WriteSelfTestStage(w io.Writer, st SelfTestStage) error {
+	verdict := "PASS"
+	switch {
+	case !st.OK():
+		verdict = "FAIL"
+	case st.Skipped:
+		verdict = "SKIP"
+	}
+	if _, err := fmt.Fprintf(w, "%s  %s\n", verdict, st.Name); err != nil {
+		return err
+	}
+	for _, p := range st.Problems {
+		if _, err := fmt.Fprintf(w, "      ! %s\n", p); err != nil {
+			return err
+		}
+	}
+	for _, d := range st.Details {
+		if _, err := fmt.Fprintf(w, "        %s\n", d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+type failingNotifier struct{}
+
+func (failingNotifier) Name() string { return "broken" }
+
+func (failingNotifier) Notify(context.Context, NotifyEvent) error {
+	return errors.New("connection refused")
+}
+
+func TestSelfTestReportsEveryStage(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs", "media")
+	fake.setLabel("docs", "Documents")
+	svc := fake.service(t, Settings{
+		CronExpr:          "0 * * * *",
+		CronTimezone:      "UTC",
+		Folders:           []string{"media", "Documents", "ghost"},
+		FolderCron:        map[string]string{"docs": "30 2 * * *"},
+		PauseWindows:      map[string][]PauseWindow{"media": {mustPauseWindow(t, "08:00-18:00 Mon-Fri")}},
+		BandwidthSchedule: []BandwidthRule{{Cron: "0 8 * * *", SendKbps: 500}},
+	})
+	down := httptest.NewServer(nil)
+	down.Close()
+	nas, err := syncthing.NewClient(down.URL, "key", syncthing.ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.Instances = map[string]*syncthing.Client{"nas": nas}
+	svc.Settings.Folders = append(svc.Settings.Folders, "nas/photos")
+	sink := &recordingNotifier{}
+	svc.Notifiers = []Notifier{sink, failingNotifier{}}
+
+	// A Monday, inside the pause window.
+	now := time.Date(2024, 5, 6, 9, 15, 0, 0, time.UTC)
+	var order []string
+	stages := svc.SelfTest(context.Background(), now, false, func(st SelfTestStage) { order = append(order, st.Name) })
+	if want := []string{"settings", "instances", "folders", "folder status", "schedules", "windows", "notify"}; !slices.Equal(order, want) {
+		t.Fatalf("stages ran as %v, want %v", order, want)
+	}
+	byName := map[string]SelfTestStage{}
+	for _, st := range stages {
+		byName[st.Name] = st
+	}
+
+	if st := byName["instances"]; st.OK() || !strings.Contains(st.Problems[0], "instance nas: ping failed") || !slices.Contains(st.Details, "instance default: ping ok") {
+		t.Fatalf("unexpected instances stage: %+v", st)
+	}
+	// The unreachable instance's folders are not checked again.
+	if st := byName["folders"]; !slices.Equal(st.Problems, []string{
+		"ST_FOLDERS entry 'Documents' is a label; name folder ID 'docs' instead",
+		"ST_FOLDERS entry 'ghost' matches no folder on instance default",
+	}) {
+		t.Fatalf("unexpected folder problems: %q", st.Problems)
+	}
+	if st := byName["folder status"]; !st.OK() || len(st.Details) != 1 || !strings.HasSuffix(st.Details[0], ": idle") {
+		t.Fatalf("expected one status call: %+v", st)
+	}
+	if st := byName["schedules"]; !slices.Contains(st.Details, "global (0 * * * *): next 2024-05-06T10:00:00Z") ||
+		!slices.Contains(st.Details, "folder:docs (30 2 * * *): next 2024-05-07T02:30:00Z") {
+		t.Fatalf("unexpected schedules: %q", st.Details)
+	}
+	if st := byName["windows"]; !slices.Equal(st.Details, []string{
+		"'media': pause window 08:00-18:00 Mon-Fri is open now",
+		"bandwidth: send 500 KiB/s, receive unlimited, from schedule '0 8 * * *' at 2024-05-06T08:00:00Z",
+	}) {
+		t.Fatalf("unexpected windows: %q", st.Details)
+	}
+	if st := byName["notify"]; !st.Skipped || len(sink.types()) != 0 {
+		t.Fatalf("notifications should only be sent with --notify: %+v", st)
+	}
+	if fake.count("/rest/db/scan") != 0 || fake.patches != 0 {
+		t.Fatalf("selftest must not scan or change the config")
+	}
+
+	stages = svc.SelfTest(context.Background(), now, true, nil)
+	st := stages[len(stages)-1]
+	if !slices.Equal(sink.types(), []string{eventSelfTest}) || !slices.Equal(st.Problems, []string{"sink broken: connection refused"}) {
+		t.Fatalf("expected a test event per sink: %+v, delivered %v", st, sink.types())
+	}
+}
+
+func TestWriteSelfTestStage(t *testing.T) {
+	var b strings.Builder
+	_ = WriteSelfTestStage(&b, SelfTestStage{Name: "folders", Details: []string{"instance default: 2 folder(s) configured"}, Problems: []string{"ST_FOLDERS entry 'ghost' matches no folder on instance default"}})
+	_ = WriteSelfTestStage(&b, SelfTestStage{Name: "notify", Skipped: true, Details: []string{"no notification sinks configured"}})
+	want := "FAIL  folders\n" +
+		"      ! ST_FOLDERS entry 'ghost' matches no folder on instance default\n" +
+		"        instance default: 2 folder(s) configured\n" +
+		"SKIP  notify\n" +
+		"        no notification sinks configured\n"
+	if b.String() != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
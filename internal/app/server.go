@@ -0,0 +1,209 @@
+package app
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// startAdminServer serves the local HTTP API on Settings.AdminAddr until the returned
+// stop function is called. API-triggered runs use ctx, not the request context.
+func (s *Service) startAdminServer(ctx context.Context, pending chan struct{}) (func(), error) {
+	ln, err := net.Listen("tcp", s.Settings.AdminAddr)
+	if err != nil {
+		return nil, fmt.Errorf("admin listener: %w", err)
+	}
+	if s.Settings.AdminToken == "" && !isLoopback(ln.Addr()) {
+		s.Logger.Printf("Warning: admin API on %s has no ST_ADMIN_TOKEN set", ln.Addr())
+	}
+
+	srv := &http.Server{
+		Handler:           s.adminHandler(ctx, pending),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.Logger.Printf("Admin API stopped: %v", err)
+		}
+	}()
+	s.Logger.Printf("Admin API listening on %s", ln.Addr())
+
+	return func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+		s.apiRuns.Wait()
+	}, nil
+}
+
+func (s *Service) adminHandler(ctx context.Context, pending chan struct{}) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/trigger", func(w http.ResponseWriter, r *http.Request) {
+		s.handleTrigger(ctx, pending, w, r)
+	})
+	mux.HandleFunc("GET /api/status", s.handleStatus)
+	mux.HandleFunc("GET /api/schedules", s.handleSchedules)
+	mux.HandleFunc("GET /api/health", s.handleHealth)
+	mux.HandleFunc("GET /api/history", s.handleHistory)
+	mux.HandleFunc("GET /api/info", s.handleInfo)
+	mux.HandleFunc("GET /{$}", s.handleStatusPage)
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
+	s.registerProbes(mux)
+	return s.requireToken(mux)
+}
+
+// statusPageCookie carries ST_ADMIN_TOKEN for the status page, so a browser that
+// opened /?token=... once keeps reloading it without an Authorization header.
+const statusPageCookie = "syncthing_kicker_token"
+
+func (s *Service) requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := s.Settings.AdminToken; token != "" && !isProbePath(r.URL.Path) {
+			got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			page := r.Method == http.MethodGet && r.URL.Path == "/"
+			if page && tokenMatches(r.URL.Query().Get("token"), token) {
+				// Keep the token in a cookie rather than the address bar and history.
+				http.SetCookie(w, &http.Cookie{Name: statusPageCookie, Value: token, Path: "/", HttpOnly: true, SameSite: http.SameSiteStrictMode})
+				http.Redirect(w, r, "/", http.StatusSeeOther)
+				return
+			}
+			ok := tokenMatches(got, token)
+			if c, err := r.Cookie(statusPageCookie); !ok && page && err == nil {
+				ok = tokenMatches(c.Value, token)
+			}
+			if !ok {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeAPIError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func tokenMatches(got, token string) bool {
+	return got != "" && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+func isProbePath(p string) bool {
+	return p == "/healthz" || p == "/livez" || p == "/readyz"
+}
+
+type triggerRequest struct {
+	Folders []string `json:"folders"`
+}
+
+type triggerResponse struct {
+	RunID   string   `json:"runId"`
+	Folders []string `json:"folders"`
+}
+
+func (s *Service) handleTrigger(ctx context.Context, pending chan struct{}, w http.ResponseWriter, r *http.Request) {
+	var req triggerRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	folders := make([]string, 0, len(req.Folders))
+	for _, f := range req.Folders {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if f != "*" {
+			if err := validateFolderID(f, "request"); err != nil {
+				writeAPIError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		folders = append(folders, f)
+	}
+	if len(folders) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "no folders given")
+		return
+	}
+
+	runID := newRunID()
+	s.apiRuns.Add(1)
+	go func() {
+		defer s.apiRuns.Done()
+		ctx := withRunID(ctx, runID)
+		s.log(ctx).Printf("API trigger %s for folders %s", runID, strings.Join(folders, ", "))
+		_ = s.triggerScans(ctx, "api:"+runID, folders, pending)
+	}()
+	writeAPIJSON(w, http.StatusAccepted, triggerResponse{RunID: runID, Folders: folders})
+}
+
+func (s *Service) handleStatus(w http.ResponseWriter, r *http.Request) {
+	folders := s.stats.snapshot()
+	for i := range folders {
+		inst, _ := s.splitRef(folders[i].Folder)
+		folders[i].Instance = instanceName(inst)
+	}
+	out := map[string]any{"folders": folders}
+	if devices := s.devicePauseStatus(); len(devices) > 0 {
+		out["devices"] = devices
+	}
+	writeAPIJSON(w, http.StatusOK, out)
+}
+
+// handleHealth reports per-instance health; it answers 503 while any instance is
+// degraded or any folder has not been scanned within ST_STALE_SCAN_WARN.
+func (s *Service) handleHealth(w http.ResponseWriter, r *http.Request) {
+	instances := s.health.snapshot(s.instances())
+	status, code := "ok", http.StatusOK
+	for _, inst := range instances {
+		if !inst.Healthy {
+			status, code = "degraded", http.StatusServiceUnavailable
+		}
+	}
+	stale := s.stats.staleFolders()
+	if len(stale) > 0 {
+		status, code = "degraded", http.StatusServiceUnavailable
+	}
+	folderStreaks, instanceStreaks := s.stateStore().failureStreaks()
+	maxStreak := 0
+	for _, n := range folderStreaks {
+		maxStreak = max(maxStreak, n)
+	}
+	writeAPIJSON(w, code, map[string]any{
+		"status": status, "instances": instances, "staleFolders": stale,
+		"maxFailureStreak": maxStreak, "failureStreaks": map[string]any{"folders": folderStreaks, "instances": instanceStreaks},
+		"panics": s.panicCount.Load(),
+	})
+}
+
+func (s *Service) handleSchedules(w http.ResponseWriter, r *http.Request) {
+	writeAPIJSON(w, http.StatusOK, map[string]any{"schedules": s.scheduleInfos()})
+}
+
+// scheduleInfos describes the running scheduler's entries.
+func (s *Service) scheduleInfos() []ScheduleInfo {
+	s.schedMu.Lock()
+	defer s.schedMu.Unlock()
+	if s.cron == nil {
+		return []ScheduleInfo{}
+	}
+	return s.describeSchedules(s.cron, s.schedules, time.Now())
+}
+
+func writeAPIJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, code int, msg string) {
+	writeAPIJSON(w, code, map[string]string{"error": msg})
+}
+
+func isLoopback(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	return ok && tcp.IP.IsLoopback()
+}
@@ -0,0 +1,133 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func adminRequest(t *testing.T, h http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminAPIRequiresToken(t *testing.T) {
+	fake := newFakeSyncthing(t, "photos")
+	svc := fake.service(t, Settings{AdminToken: "s3cret"})
+	h := svc.adminHandler(context.Background(), make(chan struct{}, 16))
+
+	if rec := adminRequest(t, h, http.MethodGet, "/api/status", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", rec.Code)
+	}
+	if rec := adminRequest(t, h, http.MethodGet, "/api/status", "wrong", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with wrong token, got %d", rec.Code)
+	}
+	if rec := adminRequest(t, h, http.MethodGet, "/api/status", "s3cret", ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 with token, got %d", rec.Code)
+	}
+}
+
+func TestAdminAPITriggerRunsScanPipeline(t *testing.T) {
+	fake := newFakeSyncthing(t, "photos")
+	svc := fake.service(t, Settings{})
+	h := svc.adminHandler(context.Background(), make(chan struct{}, 16))
+
+	rec := adminRequest(t, h, http.MethodPost, "/api/trigger", "", `{"folders": ["photos"]}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp triggerResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.RunID == "" || len(resp.Folders) != 1 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	svc.apiRuns.Wait()
+	if got := fake.scanned(); len(got) != 1 || got[0] != "photos" {
+		t.Fatalf("expected scan of photos, got %v", got)
+	}
+
+	rec = adminRequest(t, h, http.MethodGet, "/api/status", "", "")
+	var status struct {
+		Folders []FolderStats `json:"folders"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("decode status: %v", err)
+	}
+	if len(status.Folders) != 1 || status.Folders[0].Folder != "photos" || status.Folders[0].Scans != 1 {
+		t.Fatalf("unexpected status: %+v", status.Folders)
+	}
+}
+
+func TestAdminAPITriggerRespectsDryRun(t *testing.T) {
+	fake := newFakeSyncthing(t, "photos")
+	svc := fake.service(t, Settings{DryRun: true})
+	h := svc.adminHandler(context.Background(), make(chan struct{}, 16))
+
+	if rec := adminRequest(t, h, http.MethodPost, "/api/trigger", "", `{"folders": ["photos"]}`); rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", rec.Code)
+	}
+	svc.apiRuns.Wait()
+	if got := fake.scanned(); len(got) != 0 {
+		t.Fatalf("expected no scans in dry-run, got %v", got)
+	}
+}
+
+func TestAdminAPITriggerRejectsBadRequests(t *testing.T) {
+	fake := newFakeSyncthing(t, "photos")
+	svc := fake.service(t, Settings{})
+	h := svc.adminHandler(context.Background(), make(chan struct{}, 16))
+
+	for _, body := range []string{`not json`, `{"folders": []}`, `{"folders": ["bad id"]}`} {
+		if rec := adminRequest(t, h, http.MethodPost, "/api/trigger", "", body); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s, got %d", body, rec.Code)
+		}
+	}
+	if rec := adminRequest(t, h, http.MethodGet, "/api/trigger", "", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 for GET trigger, got %d", rec.Code)
+	}
+}
+
+func TestAdminAPIListsSchedules(t *testing.T) {
+	fake := newFakeSyncthing(t, "photos")
+	svc := fake.service(t, Settings{
+		CronExpr:   "0 5 * * *",
+		FolderCron: map[string]string{"photos": "30 2 * * *"},
+	})
+	sched, err := svc.buildCronScheduler(make(chan struct{}, 1))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	svc.cron = sched
+	h := svc.adminHandler(context.Background(), make(chan struct{}, 16))
+
+	rec := adminRequest(t, h, http.MethodGet, "/api/schedules", "", "")
+	var resp struct {
+		Schedules []ScheduleInfo `json:"schedules"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Schedules) != 2 {
+		t.Fatalf("expected 2 schedules, got %+v", resp.Schedules)
+	}
+	for _, sc := range resp.Schedules {
+		if sc.Next.IsZero() {
+			t.Fatalf("expected next fire time for %s", sc.Label)
+		}
+		if sc.Label == "folder:photos" && (sc.Next.Hour() != 2 || sc.Next.Minute() != 30) {
+			t.Fatalf("unexpected next time for photos: %s", sc.Next)
+		}
+	}
+}
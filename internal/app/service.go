@@ -5,8 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"os"
+	"maps"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/robfig/cron/v3"
@@ -15,131 +18,512 @@ import (
 )
 
 type Service struct {
-	Settings Settings
-	Client   *syncthing.Client
-	Logger   *log.Logger
+	Settings  Settings
+	Client    *syncthing.Client            // default instance
+	Instances map[string]*syncthing.Client // additional named instances (ST_INSTANCES)
+	Logger    *log.Logger
+	Notifiers []Notifier // sinks for alert events; may be empty
+	StatsD    *StatsD    // optional StatsD emitter; nil disables
+	// ReadOnlyState reads ST_STATE_FILE but never writes or moves it, for --check
+	// runs alongside a daemon that owns the file.
+	ReadOnlyState bool
+
+	cacheMu         sync.Mutex
+	folderCaches    map[string]*folderCache
+	errorLog        errorLogLimiter
+	health          instanceHealth
+	folderLocks     folderLocks
+	store           stateStore
+	stats           folderStats
+	schedMu         sync.Mutex // guards cron, schedules, pending and bandwidth once the scheduler runs
+	schedules       []scheduleEntry
+	pending         chan struct{} // the running scheduler's status check slots
+	cron            *cron.Cron
+	lifetime        context.Context // Run's context; see serviceContext
+	apiRuns         sync.WaitGroup
+	history         runHistory
+	historyOnce     sync.Once
+	lastBeat        atomic.Int64 // unix nanos of the last scheduler heartbeat
+	watchers        sync.WaitGroup
+	logFmt          logFormatter
+	logFmtOnce      sync.Once
+	notifications   sync.WaitGroup // in-flight notifier deliveries
+	statusChecks    sync.WaitGroup // delayed status checks in flight
+	missing         missingFolders // folders Syncthing does not know, left out of runs
+	level           healthState    // overall health level (/healthz)
+	workers         scanPool
+	conditions      conditionCache // ST_SCAN_CONDITION_CMD results within ST_SCAN_CONDITION_TTL
+	statuses        statusCache    // /rest/db/status results within ST_STATUS_CACHE
+	suppressed      suppressionCounts
+	windowLeft      sync.Map // folders and devices found paused by someone else in their current pause window
+	devicePauses    devicePauses
+	bandwidth       []bandwidthEntry // ST_BANDWIDTH_SCHEDULE, parsed with the scheduler; see bandwidthRules
+	templates       map[string]compiledTemplate
+	templatesOnce   sync.Once
+	restartGate     sync.RWMutex     // held by scheduled jobs while they run, and exclusively by a Syncthing restart
+	pendingSeen     sync.Map         // pending devices already accepted or reported, by instance-prefixed ID
+	keyRotations    sync.Map         // instance name -> *atomic.Int64, keys re-read from ST_API_KEY_FILE
+	discovered      sync.Map         // instance -> syncthingInfo, read at startup for /api/info
+	inactive        inactiveFolders  // configured folders paused or stopped in Syncthing
+	lastDeviceCheck atomic.Int64     // unix nanos of the last ST_DEVICE_ABSENT_WARN check
+	origins         scanOrigins      // scans we triggered, for ST_DUPLICATE_SCAN_THRESHOLD
+	panics          chan panicReport // recovered panics for the supervision loop; nil outside Run
+	panicCount      atomic.Int64
+	panicHook       func(where string) // test-only: called where a panic can be injected
 }
 
-func (s *Service) CheckOnce(ctx context.Context) error {
-	folders := foldersFromEnv()
-	return s.checkSyncStatus(ctx, folders, 0)
+// scheduleEntry labels a cron entry so it can be listed over the admin API.
+type scheduleEntry struct {
+	id         cron.EntryID
+	label      string
+	expr       string
+	folderCron bool // from ST_FOLDER_CRON or ST_FOLDER_CRON_FILE, replaced by ReloadFolderCron
 }
 
 func (s *Service) Run(ctx context.Context) error {
+	s.lifetime = ctx
+	// Load the state file up front so restored counters are reported from the start.
+	s.stateStore()
+	if err := s.waitForSyncthing(ctx); err != nil {
+		return err
+	}
+	if err := s.checkFolderPriority(ctx); err != nil {
+		return Fatal(ErrConfig, err)
+	}
+	s.runPausedFolderCheck(ctx)
+	defer s.watchers.Wait()
 	pending := make(chan struct{}, 1024)
 	defer close(pending)
+	defer func() {
+		if err := s.FlushState(); err != nil {
+			s.Logger.Printf("Failed to save state: %v", err)
+		}
+	}()
+	defer s.notifications.Wait()
 
 	if s.Settings.ScanOnStartup {
-		s.Logger.Printf("Triggering scan on startup")
-		folders := foldersFromEnv()
-		if err := s.triggerScans(ctx, folders, pending); err != nil {
-			return err
-		}
-		for folder := range s.Settings.FolderCron {
-			if err := s.triggerScans(ctx, []string{folder}, pending); err != nil {
-				return err
-			}
+		// With RUN_ONCE, ST_RUN_DEADLINE bounds the startup pass, which is the whole run.
+		startupCtx := ctx
+		if s.Settings.RunOnce && s.Settings.RunDeadline > 0 {
+			var cancel context.CancelFunc
+			startupCtx, cancel = context.WithTimeout(ctx, s.Settings.RunDeadline)
+			defer cancel()
 		}
+		var startup sync.WaitGroup
+		startup.Add(1)
+		go func() {
+			defer startup.Done()
+			folders := s.startupFolders(startupCtx)
+			s.Logger.Printf("Triggering scan on startup for %d folder(s): %s", len(folders), strings.Join(folders, ", "))
+			_ = s.triggerScans(startupCtx, "startup", folders, pending)
+		}()
+		// Status checks must not outlive pending.
+		defer startup.Wait()
 		if s.Settings.RunOnce {
+			startup.Wait()
+			checked := make(chan struct{})
+			go func() {
+				s.statusChecks.Wait()
+				close(checked)
+			}()
+			select {
+			case <-checked:
+			case <-startupCtx.Done():
+			}
+			if errors.Is(startupCtx.Err(), context.DeadlineExceeded) {
+				return Fatal(ErrAborted, fmt.Errorf("run deadline exceeded: %s", runSummary(s.lastRun("startup"))))
+			}
 			return nil
 		}
 	}
 
-	sched, err := s.buildCronScheduler(pending)
+	s.manageRescanIntervals(ctx)
+	if s.Settings.ManageRescanInterval {
+		defer s.restoreRescanIntervalsOnShutdown()
+	}
+
+	s.panics = make(chan panicReport, 1)
+	sched, _, err := s.installScheduler(pending)
 	if err != nil {
-		return err
+		return Fatal(ErrConfig, err)
+	}
+	defer func() {
+		s.schedMu.Lock()
+		defer s.schedMu.Unlock()
+		s.cron.Stop()
+	}()
+
+	if s.Settings.HealthSocket != "" {
+		defer s.startHealthSocket()()
+	}
+
+	if s.Settings.AdminAddr != "" {
+		stopAdmin, err := s.startAdminServer(ctx, pending)
+		if err != nil {
+			return err
+		}
+		defer stopAdmin()
+		s.discoverSyncthing(ctx)
 	}
-	defer sched.Stop()
 
 	s.Logger.Printf("Scheduler starting")
 	sched.Start()
 
-	<-ctx.Done()
-	return ctx.Err()
+	s.runPauseWindows(ctx)
+	defer s.restoreWatchersOnShutdown()
+	s.runBandwidthStartup(ctx)
+	s.runPendingDevices(ctx)
+	s.runWatchers(ctx, pending)
+	s.runMarkerPollers(ctx, pending)
+	s.runEventSubscription(ctx, pending)
+	s.runDuplicateDetection(ctx)
+	s.runFailoverProbes(ctx)
+	defer s.watchers.Wait()
+
+	return s.supervise(ctx, pending)
 }
 
+// buildCronScheduler builds a scheduler from the current settings without starting
+// it, and records its entries for describing it.
 func (s *Service) buildCronScheduler(pending chan struct{}) (*cron.Cron, error) {
+	c, entries, bandwidth, err := s.cronSchedules(pending)
+	if err != nil {
+		return nil, err
+	}
+	s.schedMu.Lock()
+	s.schedules, s.pending, s.bandwidth = entries, pending, bandwidth
+	s.schedMu.Unlock()
+	return c, nil
+}
+
+// installScheduler builds a scheduler like buildCronScheduler and swaps it in along
+// with its entries in one go, so nothing pairs one scheduler with another's entries.
+// It returns the new scheduler, not yet started, and the one it replaced, if any.
+func (s *Service) installScheduler(pending chan struct{}) (sched, old *cron.Cron, err error) {
+	sched, entries, bandwidth, err := s.cronSchedules(pending)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.schedMu.Lock()
+	old = s.cron
+	s.cron, s.schedules, s.pending, s.bandwidth = sched, entries, pending, bandwidth
+	s.schedMu.Unlock()
+	return sched, old, nil
+}
+
+// cronSchedules builds the scheduler's jobs and entries from the current settings.
+func (s *Service) cronSchedules(pending chan struct{}) (*cron.Cron, []scheduleEntry, []bandwidthEntry, error) {
 	opts := []cron.Option{}
 	if tz := strings.TrimSpace(s.Settings.CronTimezone); tz != "" {
-		loc, err := time.LoadLocation(tz)
+		loc, err := s.Settings.Location()
 		if err != nil {
-			return nil, fmt.Errorf("invalid timezone %q: %w", tz, err)
+			return nil, nil, nil, err
 		}
 		opts = append(opts, cron.WithLocation(loc))
 		s.Logger.Printf("Scheduler timezone: %s", tz)
 	}
 
-	// 5-field cron (min hour dom mon dow)
-	parser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-	c := cron.New(append(opts, cron.WithParser(parser))...)
+	c := cron.New(append(opts, cron.WithParser(cronParser))...)
 
+	var entries []scheduleEntry
 	if s.Settings.CronExpr != "" {
-		folders := foldersFromEnv()
-		if _, err := c.AddFunc(s.Settings.CronExpr, func() {
-			ctx := context.Background()
-			_ = s.triggerScans(ctx, folders, pending)
-		}); err != nil {
-			return nil, fmt.Errorf("invalid ST_CRON: %w", err)
+		id, err := c.AddFunc(s.Settings.CronExpr, s.scheduled("global", func(ctx context.Context) {
+			_ = s.triggerScans(ctx, "global", s.Folders(), pending)
+		}))
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid ST_CRON: %w", err)
 		}
+		entries = append(entries, scheduleEntry{id: id, label: "global", expr: s.Settings.CronExpr})
 	}
 
-	for folder, expr := range s.Settings.FolderCron {
-		folder := folder
-		expr := expr
-		if _, err := c.AddFunc(expr, func() {
-			ctx := context.Background()
-			_ = s.triggerScans(ctx, []string{folder}, pending)
-		}); err != nil {
-			return nil, fmt.Errorf("invalid ST_FOLDER_CRON expr for %s: %w", folder, err)
-		}
+	jobs, err := s.folderCronJobs(s.folderCrons(), pending)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, j := range jobs {
+		id := c.Schedule(j.sched, cron.FuncJob(s.scheduled(j.label, j.run)))
+		entries = append(entries, scheduleEntry{id: id, label: j.label, expr: j.expr, folderCron: true})
+	}
+	pauses, err := s.pauseCronJobs()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, j := range pauses {
+		id := c.Schedule(j.sched, cron.FuncJob(s.scheduled(j.label, j.run)))
+		entries = append(entries, scheduleEntry{id: id, label: j.label, expr: j.expr})
 	}
 
 	if len(c.Entries()) == 0 {
-		return nil, errors.New("No schedules configured (check ST_CRON / ST_FOLDER_CRON).")
+		return nil, nil, nil, errors.New("No schedules configured (check ST_CRON / ST_FOLDER_CRON).")
 	}
-	return c, nil
+	if expr := s.Settings.DigestCron; expr != "" {
+		id, err := c.AddFunc(expr, s.scheduled("digest", func(context.Context) { s.sendDigest() }))
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid ST_DIGEST_CRON: %w", err)
+		}
+		entries = append(entries, scheduleEntry{id: id, label: "digest", expr: expr})
+	}
+	if expr := s.Settings.RestartCron; expr != "" {
+		id, err := c.AddFunc(expr, s.restartSyncthing)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid ST_RESTART_CRON: %w", err)
+		}
+		entries = append(entries, scheduleEntry{id: id, label: "restart", expr: expr})
+	}
+	var bandwidth []bandwidthEntry
+	for _, rule := range s.Settings.BandwidthSchedule {
+		sched, err := cronParser.Parse(rule.Cron)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid ST_BANDWIDTH_SCHEDULE expr %q: %w", rule.Cron, err)
+		}
+		rule := rule
+		id := c.Schedule(sched, cron.FuncJob(s.scheduled("bandwidth schedule '"+rule.Cron+"'", func(ctx context.Context) {
+			s.applyBandwidth(ctx, rule, fmt.Sprintf("schedule '%s'", rule.Cron))
+		})))
+		entries = append(entries, scheduleEntry{id: id, label: fmt.Sprintf("bandwidth:%d/%d", rule.SendKbps, rule.RecvKbps), expr: rule.Cron})
+		bandwidth = append(bandwidth, bandwidthEntry{rule: rule, sched: sched})
+	}
+	s.heartbeat()
+	c.Schedule(cron.Every(heartbeatInterval), cron.FuncJob(s.scheduled("heartbeat", func(context.Context) { s.heartbeat() })))
+	c.Schedule(cron.Every(pausedCheckInterval), cron.FuncJob(s.scheduled("paused folder check", s.checkPausedFolders)))
+	return c, entries, bandwidth, nil
+}
+
+// serviceContext is the context Run was given, which ends when the kicker shuts
+// down, for background work that outlives a run but not the service. Outside Run
+// it is context.Background.
+func (s *Service) serviceContext() context.Context {
+	if s.lifetime == nil {
+		return context.Background()
+	}
+	return s.lifetime
 }
 
-func (s *Service) triggerScans(ctx context.Context, folders []string, pending chan struct{}) error {
+// triggerScans scans folders and records them as one run under label. Triggers are
+// dispatched in order through the per-instance worker pool; folders on different
+// instances never wait for each other, so an unreachable instance does not delay
+// the others.
+func (s *Service) triggerScans(ctx context.Context, label string, folders []string, pending chan struct{}) error {
+	refs := make([]string, 0, len(folders))
 	for _, folder := range folders {
-		folder = strings.TrimSpace(folder)
-		if folder == "" {
-			continue
+		if folder = strings.TrimSpace(folder); folder != "" {
+			refs = append(refs, folder)
 		}
-
-		if s.Settings.DryRun {
-			s.Logger.Printf("[dry-run] Would trigger scan for folder '%s'", folder)
-		} else {
-			// Syncthing may hold POST open; keep timeout low and treat timeouts as success.
-			_, err := s.Client.PostScan(ctx, folder, 5*time.Second)
+	}
+	ctx, run := s.startRun(ctx, label)
+	defer run.finish()
+	if !s.Settings.GlobalScan {
+		refs = s.expandWildcards(ctx, refs, "wildcard scan")
+	} else {
+		// One scan of everything cannot leave folders out.
+		refs = slices.DeleteFunc(refs, func(ref string) bool { return strings.HasPrefix(ref, "!") })
+	}
+	refs = s.prioritize(refs)
+	var wg sync.WaitGroup
+	s.forEachInstance(refs, func(refs []string) {
+		for _, folder := range refs {
+			a := run.begin(folder)
+			if s.unknownFolder(ctx, folder) {
+				a.skipUnknown(ctx)
+				continue
+			}
+			inst, _ := s.splitRef(folder)
+			release, err := s.workers.acquire(ctx, inst, s.Settings.ScanWorkers)
 			if err != nil {
-				// If the context timed out, treat it as non-fatal.
-				if errors.Is(err, context.DeadlineExceeded) {
-					s.Logger.Printf("Scan trigger for folder '%s' timed out; Syncthing may still be processing", folder)
-				} else {
-					s.Logger.Printf("Scan trigger failed for folder '%s': %v", folder, err)
-				}
-			} else {
-				s.Logger.Printf("Triggered scan for folder '%s'", folder)
+				run.update(a.index, func(f *RunFolderResult) { f.Result = resultAbandoned })
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer s.recoverPanic("scan worker for " + folder)
+				defer release()
+				s.injectPanic("scan " + folder)
+				a.trigger(ctx, "")
+				s.scheduleStatusCheck(ctx, a, pending)
+			}()
+		}
+	})
+	wg.Wait()
+	s.checkDevices(ctx)
+	return nil
+}
+
+// scanNext is the ST_SCAN_NEXT delay for folder: its own override, if any, or the
+// global value.
+func (s *Service) scanNext(folder string) time.Duration {
+	if d, ok := s.Settings.FolderScanNext[folder]; ok {
+		return d
+	}
+	return s.Settings.ScanNext
+}
+
+// scheduleStatusCheck runs a fire-and-forget status check for the attempt's folder after
+// the configured delay, reporting what it sees back to the attempt, then follows the
+// folder until it settles with ST_SCAN_LATENCY_BUDGET. It keeps ctx's run ID but not
+// its cancellation.
+func (s *Service) scheduleStatusCheck(ctx context.Context, a *scanAttempt, pending chan struct{}) {
+	ctx = context.WithoutCancel(ctx)
+	queued := false
+	select {
+	case pending <- struct{}{}:
+		queued = true
+	default:
+	}
+	s.statusChecks.Add(1)
+	go func(a *scanAttempt) {
+		defer s.statusChecks.Done()
+		defer s.recoverPanic("status check for " + a.folder)
+		defer func() {
+			if queued {
+				<-pending
 			}
+		}()
+		_ = s.checkStatuses(ctx, []string{a.folder}, s.Settings.StatusDelaySec, true, a.settled)
+		if queued {
+			<-pending // the latency polls that may follow do not hold up other checks
+			queued = false
 		}
+		a.measureLatency(ctx)
+	}(a)
+}
 
-		// Fire-and-forget status check.
-		select {
-		case pending <- struct{}{}:
+// triggerScan asks Syncthing to scan a single folder (or all folders for "*"),
+// unless a pre-scan check decides otherwise. Failures are logged, never returned.
+// The per-folder lock is held for the whole attempt, including any deferral.
+func (s *Service) triggerScan(ctx context.Context, folder string) string {
+	return s.triggerScanPath(ctx, folder, "")
+}
+
+// triggerScanPath is triggerScan limited to sub within the folder. An empty sub falls
+// back to the folder's round-robin sub-paths (if configured) or a full scan.
+func (s *Service) triggerScanPath(ctx context.Context, folder, sub string) (result string) {
+	var err error
+	start := time.Now()
+	report := func(result string, err error, elapsed time.Duration) {
+		s.statsdScan(folder, result, err, elapsed)
+		s.stats.recordScan(folder, runIDFrom(ctx), result, err)
+		if isFolderNotFound(err) {
+			s.stats.forget(folder)
+		}
+		s.recordOutcome(folder, result, err)
+		s.trackFailureStreak(ctx, folder, result, err)
+	}
+	// held is set while ST_OFFLINE_GRACE holds a failure back; the release reports
+	// it, so the attempt itself records nothing.
+	held := false
+	defer func() {
+		if !held {
+			report(result, err, time.Since(start))
+		}
+	}()
+
+	inst, id := s.splitRef(folder)
+	if !s.instanceAvailable(ctx, inst, folder, "scan") {
+		return resultSkipped
+	}
+
+	unlock := s.folderLocks.lock(folder)
+	defer unlock()
+
+	if !s.scanConditionMet(ctx, folder) || s.pausedForWindow(ctx, folder) {
+		return resultSkipped
+	}
+	proceed, pre := s.preScanChecks(ctx, folder)
+	if !proceed {
+		return resultSkipped
+	}
+
+	opts := syncthing.ScanOptions{Next: s.scanNext(folder)}
+	roundRobin := sub == ""
+	if roundRobin {
+		sub = s.nextSubpath(folder)
+	}
+	if sub != "" {
+		opts.Sub = []string{sub}
+	}
+	scope := s.scanScope(folder, sub)
+	label := s.labelSuffix(folder)
+
+	if s.Settings.DryRun {
+		s.logEvent(ctx, logEvent{
+			Msg:    fmt.Sprintf("[dry-run] Would trigger scan for folder '%s'%s%s", folder, label, scope),
+			Folder: folder, Label: s.folderLabel(folder), Text: "[dry-run] would scan" + scope,
+		})
+		return resultDryRun
+	}
+
+	// Syncthing may hold POST open; keep timeout low. ST_SCAN_TIMEOUT_POLICY decides
+	// what a timeout counts as.
+	if s.Settings.DuplicateScanThreshold > 0 {
+		s.origins.record(s.missingRef(folder), time.Now(), s.Settings.DuplicateScanWindow)
+	}
+	asked := time.Now()
+	_, err = s.client(inst).PostScan(ctx, id, opts, scanTriggerTimeout)
+	if err != nil && ctx.Err() != nil {
+		// The run itself ran out of time; that says nothing about Syncthing.
+		s.log(ctx).Printf("Scan trigger for folder '%s'%s%s abandoned: %v", folder, label, scope, ctx.Err())
+		return resultAbandoned
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		failed, elapsed := err, time.Since(start)
+		if s.recordHealth(ctx, inst, err, func(since time.Time) {
+			s.logFailure(ctx, folder, "scan", failed, "Scan trigger failed for folder '%s'%s%s: %v (unreachable since %s)", folder, label, scope, failed, since.Format(time.RFC3339))
+			report(resultFailed, failed, elapsed)
+		}) {
+			// Within ST_OFFLINE_GRACE: reported only if the instance stays unreachable.
+			held = true
+			return resultSkipped
+		}
+	}
+	if err != nil {
+		if !errors.Is(err, context.DeadlineExceeded) {
+			if isFolderNotFound(err) {
+				s.folderMissing(ctx, folder, "scan", asked, err)
+				return resultFailed
+			}
+			s.logFailure(ctx, folder, "scan", err, "Scan trigger failed for folder '%s'%s%s: %v", folder, label, scope, err)
+			return resultFailed
+		}
+		switch s.Settings.ScanTimeoutPolicy {
+		case scanTimeoutError:
+			err = fmt.Errorf("%w after %s", errScanTimeout, scanTriggerTimeout)
+			s.logFailure(ctx, folder, "scan", err, "Scan trigger failed for folder '%s'%s%s: %v", folder, label, scope, err)
+			return resultFailed
+		case scanTimeoutWarn:
+			s.logEvent(ctx, logEvent{
+				Msg:    fmt.Sprintf("Warning: scan trigger for folder '%s'%s%s timed out; Syncthing may still be processing", folder, label, scope),
+				Folder: folder, Label: s.folderLabel(folder), Text: "warning: scan timed out" + scope + "; Syncthing may still be processing",
+			})
 		default:
+			s.logEvent(ctx, logEvent{
+				Msg:    fmt.Sprintf("Scan trigger for folder '%s'%s%s timed out; Syncthing may still be processing", folder, label, scope),
+				Folder: folder, Label: s.folderLabel(folder), Text: "scan timed out" + scope + "; Syncthing may still be processing",
+			})
 		}
-		go func(folder string) {
-			defer func() {
-				<-pending
-			}()
-			_ = s.checkSyncStatus(context.Background(), []string{folder}, s.Settings.StatusDelaySec)
-		}(folder)
+		result = resultTimeout
+	} else {
+		s.logSuccess(ctx, folder, "scan")
+		s.logEvent(ctx, logEvent{
+			Msg:    fmt.Sprintf("Triggered scan for folder '%s'%s%s", folder, label, scope),
+			Folder: folder, Label: s.folderLabel(folder), Text: "scan triggered" + scope,
+		})
+		result = resultTriggered
 	}
-	return nil
+	if err := s.stateStore().markSuccess(time.Now().UTC()); err != nil {
+		s.Logger.Printf("Failed to save state: %v", err)
+	}
+	s.recordScan(folder, pre, roundRobin)
+	return result
 }
 
 func (s *Service) checkSyncStatus(ctx context.Context, folders []string, delaySec float64) error {
+	return s.checkStatuses(ctx, folders, delaySec, false, nil)
+}
+
+// checkStatuses is checkSyncStatus calling onStatus, if set, with each status fetched.
+// fresh bypasses ST_STATUS_CACHE, for checks that follow an action on the folder.
+func (s *Service) checkStatuses(ctx context.Context, folders []string, delaySec float64, fresh bool, onStatus func(context.Context, string, syncthing.FolderStatus)) error {
 	if delaySec > 0 {
 		t := time.NewTimer(time.Duration(delaySec * float64(time.Second)))
 		select {
@@ -150,65 +534,198 @@ func (s *Service) checkSyncStatus(ctx context.Context, folders []string, delaySe
 		}
 	}
 
-	wantAll := false
+	folderIDs := []string{}
 	for _, f := range folders {
-		if strings.TrimSpace(f) == "*" {
-			wantAll = true
-			break
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		inst, id := s.splitRef(f)
+		if id != "*" {
+			folderIDs = append(folderIDs, f)
+			continue
+		}
+		if !s.instanceAvailable(ctx, inst, f, "folder list") {
+			continue
+		}
+		list, err := s.cachedFolderIDs(ctx, inst)
+		if s.recordHealth(ctx, inst, err, func(since time.Time) {
+			s.logFailure(ctx, f, "folder list", err, "Failed to fetch folder list for wildcard status check on instance %s: %v (unreachable since %s)", instanceName(inst), err, since.Format(time.RFC3339))
+		}) {
+			continue
+		}
+		if err != nil {
+			s.logFailure(ctx, f, "folder list", err, "Failed to fetch folder list for wildcard status check on instance %s: %v", instanceName(inst), err)
+			continue
+		}
+		s.logSuccess(ctx, f, "folder list")
+		if len(list) == 0 {
+			s.log(ctx).Printf("No folders returned by Syncthing config on instance %s; nothing to report", instanceName(inst))
+		}
+		for _, cfg := range list {
+			folderIDs = append(folderIDs, joinRef(inst, cfg.ID))
 		}
 	}
+	folderIDs = s.prioritize(folderIDs)
 
-	folderIDs := []string{}
-	if wantAll {
-		cfg, _, err := s.Client.SystemConfig(ctx, 15*time.Second)
-		if err != nil {
-			s.Logger.Printf("Failed to fetch folder list for wildcard status check: %v", err)
-			return nil
+	var lastScans map[string]time.Time
+	if s.Settings.StaleScanWarn > 0 {
+		lastScans = s.lastScans(ctx, folderIDs)
+	}
+
+	for _, ref := range folderIDs {
+		inst, _ := s.splitRef(ref)
+		if !s.instanceAvailable(ctx, inst, ref, "status check") {
+			continue
 		}
-		for _, f := range cfg.Folders {
-			if strings.TrimSpace(f.ID) != "" {
-				folderIDs = append(folderIDs, f.ID)
+		asked := time.Now()
+		st, err := s.folderStatus(ctx, ref, 10*time.Second, fresh)
+		if s.recordHealth(ctx, inst, err, func(since time.Time) {
+			s.logFailure(ctx, ref, "status check", err, "Folder %s%s status check failed: %v (unreachable since %s)", ref, s.labelSuffix(ref), err, since.Format(time.RFC3339))
+		}) {
+			continue
+		}
+		if err != nil {
+			if isFolderNotFound(err) {
+				s.folderMissing(ctx, ref, "status check", asked, err)
+				s.stats.forget(ref)
+				continue
 			}
+			s.logFailure(ctx, ref, "status check", err, "Folder %s%s status check failed: %v", ref, s.labelSuffix(ref), err)
+			continue
 		}
-		if len(folderIDs) == 0 {
-			s.Logger.Printf("No folders returned by Syncthing config; nothing to report")
-			return nil
+		s.logSuccess(ctx, ref, "status check")
+		s.stats.recordStatus(ref, st)
+		s.recordState(ref, st)
+		s.trackRecovery(ctx, ref, st)
+		s.digestStatus(ref, st)
+		s.StatsD.Gauge("need_bytes", st.NeedBytes, s.folderTags(ref)...)
+		if s.Settings.SkipUnchanged {
+			s.recordSequence(ref, st)
 		}
-	} else {
-		for _, f := range folders {
-			f = strings.TrimSpace(f)
-			if f != "" && f != "*" {
-				folderIDs = append(folderIDs, f)
+		lastScan, hasLastScan := lastScans[ref]
+		if hasLastScan {
+			s.checkStale(ctx, ref, lastScan)
+		}
+		if !s.Settings.LogOnChange || s.stats.statusChanged(ref, st, s.Settings.LogHeartbeat, time.Now()) {
+			ev := logEvent{
+				Msg:    fmt.Sprintf("Folder %s%s status: state=%s needBytes=%d inSyncBytes=%d", ref, s.labelSuffix(ref), st.State, st.NeedBytes, st.InSyncBytes),
+				Folder: ref, Label: s.folderLabel(ref), Text: "status",
+				Fields: []logField{{"state", st.State}, {"need", logBytes(st.NeedBytes)}, {"in sync", logBytes(st.InSyncBytes)}},
+			}
+			if pending := needBreakdown(st.NeedFiles, st.NeedDirectories, st.NeedSymlinks, st.NeedDeletes); pending != "" {
+				ev.Msg += fmt.Sprintf(" needFiles=%d needDirectories=%d needSymlinks=%d needDeletes=%d", st.NeedFiles, st.NeedDirectories, st.NeedSymlinks, st.NeedDeletes)
+				ev.Fields = append(ev.Fields, logField{"pending", pending})
 			}
+			if hasLastScan {
+				ev.Msg += " lastScan=" + lastScan.Format(time.RFC3339)
+				ev.Fields = append(ev.Fields, logField{"last scan", lastScan.Format(time.RFC3339)})
+			}
+			s.logEvent(ctx, ev)
+		}
+		if onStatus != nil {
+			onStatus(ctx, ref, st)
 		}
 	}
+	return nil
+}
+
+// startupFolders is ST_FOLDERS plus the ST_FOLDER_CRON folders, each listed once.
+// Wildcards are resolved to the instance's folders first (even with ST_GLOBAL_SCAN)
+// so a folder that is also scheduled on its own is not scanned twice.
+func (s *Service) startupFolders(ctx context.Context) []string {
+	return s.configuredFolders(ctx, "startup scan")
+}
+
+// configuredFolders is the folder set the schedules scan, as for startupFolders;
+// purpose names what it is for in failures to resolve a wildcard.
+func (s *Service) configuredFolders(ctx context.Context, purpose string) []string {
+	crons := slices.Sorted(maps.Keys(s.folderCrons()[actionScan]))
 
-	for _, id := range folderIDs {
-		st, _, err := s.Client.FolderStatus(ctx, id, 10*time.Second)
+	all := s.expandWildcards(ctx, append(s.Folders(), crons...), purpose)
+	seen := map[string]bool{}
+	out := make([]string, 0, len(all))
+	for _, ref := range all {
+		if key := s.missingRef(ref); !seen[key] {
+			seen[key] = true
+			out = append(out, ref)
+		}
+	}
+	return s.prioritize(out)
+}
+
+// expandWildcards resolves each "*" to its instance's folders from the cached config,
+// leaving out folders that are already listed and those a "!folder" entry excludes.
+// An instance whose folder list cannot be fetched keeps its "*", which falls back to
+// a single scan of everything.
+func (s *Service) expandWildcards(ctx context.Context, refs []string, purpose string) []string {
+	excluded, listed := map[string]bool{}, map[string]bool{}
+	for _, ref := range refs {
+		if rest, ok := strings.CutPrefix(ref, "!"); ok {
+			excluded[s.missingRef(strings.TrimSpace(rest))] = true
+		} else {
+			listed[s.missingRef(ref)] = true
+		}
+	}
+	out := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		inst, id := s.splitRef(ref)
+		if strings.HasPrefix(ref, "!") || excluded[s.missingRef(ref)] {
+			continue
+		}
+		if id != "*" {
+			out = append(out, ref)
+			continue
+		}
+		list, err := s.cachedFolderIDs(ctx, inst)
 		if err != nil {
-			s.Logger.Printf("Folder %s status check failed: %v", id, err)
+			s.logFailure(ctx, ref, "folder list", err, "Failed to fetch folder list for %s on instance %s: %v", purpose, instanceName(inst), err)
+			out = append(out, ref)
 			continue
 		}
-		s.Logger.Printf("Folder %s status: state=%s needBytes=%d inSyncBytes=%d", id, st.State, st.NeedBytes, st.InSyncBytes)
+		s.logSuccess(ctx, ref, "folder list")
+		if len(list) == 0 {
+			s.log(ctx).Printf("No folders returned by Syncthing config on instance %s; nothing to scan", instanceName(inst))
+		}
+		for _, cfg := range list {
+			folder := joinRef(inst, cfg.ID)
+			if key := s.missingRef(folder); !listed[key] && !excluded[key] {
+				listed[key] = true
+				out = append(out, folder)
+			}
+		}
 	}
-	return nil
+	return out
 }
 
-func foldersFromEnv() []string {
-	raw := os.Getenv("ST_FOLDERS")
-	if strings.TrimSpace(raw) == "" {
+// Folders returns the folders ST_CRON scans (ST_FOLDERS and ST_FOLDERS_FILE), or
+// "*" when there are none.
+func (s *Service) Folders() []string {
+	s.schedMu.Lock()
+	defer s.schedMu.Unlock()
+	if len(s.Settings.Folders) == 0 {
 		return []string{"*"}
 	}
-	parts := strings.Split(raw, ",")
-	out := make([]string, 0, len(parts))
-	for _, p := range parts {
-		p = strings.TrimSpace(p)
-		if p != "" {
-			out = append(out, p)
-		}
+	return slices.Clone(s.Settings.Folders)
+}
+
+// ReloadFolders re-reads ST_FOLDERS_FILE, merged with ST_FOLDERS as at startup, for
+// the ST_CRON runs that follow. On error the current folders stay as they are.
+func (s *Service) ReloadFolders() error {
+	file := s.Settings.FoldersFile
+	if file == "" {
+		return nil
 	}
-	if len(out) == 0 {
-		return []string{"*"}
+	folders, warning, err := loadFolders(file)
+	if err != nil {
+		return err
 	}
-	return out
+	if warning != "" {
+		s.Logger.Printf("Warning: %s", warning)
+	}
+	s.schedMu.Lock()
+	s.Settings.Folders = folders
+	s.schedMu.Unlock()
+	s.Logger.Printf("Reloaded ST_FOLDERS_FILE %s: %s", file, strings.Join(folders, ", "))
+	return nil
 }
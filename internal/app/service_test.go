@@ -1,11 +1,17 @@
 package app
 
 import (
+	"context"
 	"io"
 	"log"
+	"net/http"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+	"github.com/rcarmo/syncthing-kicker/internal/syncthingtest"
 )
 
 func TestBuildCronSchedulerRejectsInvalidGlobalCron(t *testing.T) {
@@ -356,3 +362,198 @@ func syncthingStub() *syncthing.Client {
 	// buildCronScheduler does not call the client; use a nil-ish placeholder.
 	return &syncthing.Client{}
 }
+
+func TestTriggerScanSkipsFolderAlreadyScanning(t *testing.T) {
+	for _, state := range []string{"scanning", "scan-waiting"} {
+		srv := syncthingtest.New(t, "folderA")
+		srv.SetStatus("folderA", syncthing.FolderStatus{State: state})
+		svc := harnessService(t, srv, Settings{SkipIfScanning: true})
+
+		svc.triggerScan(context.Background(), "folderA")
+
+		if got := srv.Scans(); len(got) != 0 {
+			t.Fatalf("state %s: expected no scan, got %v", state, got)
+		}
+	}
+}
+
+func TestTriggerScanProceedsWhenIdle(t *testing.T) {
+	srv := syncthingtest.New(t, "folderA")
+	svc := harnessService(t, srv, Settings{SkipIfScanning: true})
+
+	svc.triggerScan(context.Background(), "folderA")
+
+	if got := srv.Scans(); len(got) != 1 || got[0] != "folderA" {
+		t.Fatalf("expected one scan of folderA, got %v", got)
+	}
+	if got := srv.Count("/rest/db/status"); got != 1 {
+		t.Fatalf("expected 1 status lookup, got %d", got)
+	}
+}
+
+func TestTriggerScanProceedsWhenStatusLookupFails(t *testing.T) {
+	srv := syncthingtest.New(t, "folderA")
+	srv.Inject(syncthingtest.Fault{Path: "/rest/db/status", Status: http.StatusInternalServerError})
+	svc := harnessService(t, srv, Settings{SkipIfScanning: true})
+
+	svc.triggerScan(context.Background(), "folderA")
+
+	if got := srv.Scans(); len(got) != 1 {
+		t.Fatalf("expected scan despite status failure, got %v", got)
+	}
+}
+
+func TestTriggerScanDoesNotCheckStatusWhenDisabled(t *testing.T) {
+	srv := syncthingtest.New(t, "folderA")
+	srv.SetStatus("folderA", syncthing.FolderStatus{State: "scanning"})
+	svc := harnessService(t, srv, Settings{})
+
+	svc.triggerScan(context.Background(), "folderA")
+
+	if got := srv.Scans(); len(got) != 1 {
+		t.Fatalf("expected scan, got %v", got)
+	}
+	if got := srv.Count("/rest/db/status"); got != 0 {
+		t.Fatalf("expected no status lookup, got %d", got)
+	}
+}
+
+func TestTriggerScansUnderInjectedFaults(t *testing.T) {
+	srv := syncthingtest.New(t, "docs", "photos", "music")
+	// A status lookup whose connection is dropped is retried on a fresh one; a
+	// failed scan is not.
+	srv.Inject(syncthingtest.Fault{Path: "/rest/db/status", Folder: "docs", Drop: true, Times: 1})
+	srv.Inject(syncthingtest.Fault{Path: "/rest/db/scan", Folder: "photos", Status: http.StatusServiceUnavailable})
+	srv.Inject(syncthingtest.Fault{Path: "/rest/db/scan", Folder: "music", Delay: 50 * time.Millisecond})
+	svc := harnessService(t, srv, Settings{ScanWorkers: 1, SkipIfScanning: true})
+
+	_ = svc.triggerScans(context.Background(), "global", []string{"docs", "photos", "music"}, nil)
+
+	var results []string
+	for _, f := range svc.lastRun("global").Folders {
+		results = append(results, f.Folder+"="+f.Result)
+	}
+	if got := strings.Join(results, ","); got != "docs=triggered,photos=failed,music=triggered" {
+		t.Fatalf("unexpected results: %s", got)
+	}
+	var first []string
+	for _, r := range srv.Requests()[:3] {
+		first = append(first, r.Method+" "+r.Path+"?"+r.Query.Get("folder"))
+	}
+	if got := strings.Join(first, ","); got != "GET /rest/db/status?docs,GET /rest/db/status?docs,POST /rest/db/scan?docs" {
+		t.Fatalf("expected the dropped status lookup to be sent again before scanning, got %s", got)
+	}
+}
+
+func TestStartupScansUseWorkerPoolAndSkipDuplicates(t *testing.T) {
+	folders := []string{"f1", "f2", "f3", "f4", "f5", "f6", "f7", "f8", "f9"}
+	fake := newFakeSyncthing(t, folders...)
+	fake.slowScans(100 * time.Millisecond)
+
+	run := func(workers int) time.Duration {
+		svc := fake.service(t, Settings{
+			ScanOnStartup: true,
+			RunOnce:       true,
+			ScanWorkers:   workers,
+			Folders:       folders[:8],
+			FolderCron:    map[string]string{"f1": "0 3 * * *", "default/f9": "0 4 * * *"},
+		})
+		start := time.Now()
+		if err := svc.Run(context.Background()); err != nil {
+			t.Fatalf("run: %v", err)
+		}
+		return time.Since(start)
+	}
+
+	sequential := run(1)
+	if got := len(fake.scanned()); got != 9 {
+		t.Fatalf("expected 9 startup scans (f1 only once), got %d: %v", got, fake.scanned())
+	}
+	// RUN_ONCE waits for the delayed status checks too, which come on top of the
+	// paused folder check at startup.
+	if got := fake.count("/rest/db/status"); got != 18 {
+		t.Fatalf("expected 18 status lookups before Run returned, got %d", got)
+	}
+	parallel := run(9)
+	if len(fake.scanned()) != 18 {
+		t.Fatalf("unexpected scans: %v", fake.scanned())
+	}
+	if sequential < 900*time.Millisecond || parallel > sequential/3 {
+		t.Fatalf("expected the worker pool to overlap slow scans: sequential %s, parallel %s", sequential, parallel)
+	}
+}
+
+func TestStartupFoldersResolveWildcards(t *testing.T) {
+	def := newFakeSyncthing(t, "docs", "photos")
+	nas := newFakeSyncthing(t, "media", "music")
+	svc := multiInstanceService(t, Settings{
+		Folders:    []string{"nas/*", "docs", "docs"},
+		FolderCron: map[string]string{"nas/media": "0 3 * * *", "photos": "0 4 * * *", "default/docs": "0 5 * * *"},
+	}, def, map[string]*fakeSyncthing{"nas": nas})
+	if got := strings.Join(svc.startupFolders(context.Background()), ","); got != "nas/music,docs,nas/media,photos" {
+		t.Fatalf("startupFolders = %q", got)
+	}
+
+	nas.srv.Close()
+	svc = multiInstanceService(t, Settings{Folders: []string{"nas/*", "docs"}, FolderCron: map[string]string{"nas/media": "0 3 * * *"}}, def, map[string]*fakeSyncthing{"nas": nas})
+	if got := strings.Join(svc.startupFolders(context.Background()), ","); got != "nas/*,docs,nas/media" {
+		t.Fatalf("unreachable instance should keep its wildcard, got %q", got)
+	}
+}
+
+func TestStartupScansEachFolderOnce(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs", "photos", "music")
+	svc := fake.service(t, Settings{
+		ScanOnStartup: true,
+		RunOnce:       true,
+		Folders:       []string{"*"},
+		FolderCron:    map[string]string{"docs": "0 3 * * *", "photos": "0 4 * * *"},
+	})
+	if err := svc.Run(context.Background()); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	got := fake.scanned()
+	sort.Strings(got)
+	if strings.Join(got, ",") != "docs,music,photos" {
+		t.Fatalf("expected exactly one scan per folder, got %v", got)
+	}
+}
+
+func TestWildcardScansOneFolderAtATime(t *testing.T) {
+	srv := syncthingtest.New(t, "docs", "photos", "music")
+	svc := harnessService(t, srv, Settings{ScanWorkers: 1})
+	_ = svc.triggerScans(context.Background(), "global", []string{"photos", "*"}, nil)
+	if got := strings.Join(srv.Scans(), ","); got != "photos,docs,music" {
+		t.Fatalf("expected one scan per folder, photos once, got %q", got)
+	}
+	var folders []string
+	for _, f := range svc.lastRun("global").Folders {
+		folders = append(folders, f.Folder+"="+f.Result)
+	}
+	if got := strings.Join(folders, ","); got != "photos=triggered,docs=triggered,music=triggered" {
+		t.Fatalf("expected per-folder attempts in the run, got %q", got)
+	}
+
+	global := syncthingtest.New(t, "docs", "photos")
+	svc = harnessService(t, global, Settings{GlobalScan: true})
+	_ = svc.triggerScans(context.Background(), "global", []string{"*"}, nil)
+	if got := global.Scans(); len(got) != 1 || got[0] != "" {
+		t.Fatalf("ST_GLOBAL_SCAN should send a single scan of everything, got %q", got)
+	}
+}
+
+func TestWildcardScansLeaveOutExcludedFolders(t *testing.T) {
+	srv := syncthingtest.New(t, "docs", "photos", "music")
+	svc := harnessService(t, srv, Settings{ScanWorkers: 1})
+	_ = svc.triggerScans(context.Background(), "global", []string{"*", "!photos", "music", "!music"}, nil)
+	if got := strings.Join(srv.Scans(), ","); got != "docs" {
+		t.Fatalf("expected the excluded folders left out, got %q", got)
+	}
+
+	global := syncthingtest.New(t, "docs", "photos")
+	svc = harnessService(t, global, Settings{GlobalScan: true})
+	_ = svc.triggerScans(context.Background(), "global", []string{"*", "!photos"}, nil)
+	if got := global.Scans(); len(got) != 1 || got[0] != "" {
+		t.Fatalf("an exclusion should never be posted as a folder, got %q", got)
+	}
+}
@@ -0,0 +1,155 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+// fakeGUI is a Syncthing GUI that refuses API keys: /rest calls need the session
+// cookie from a login plus the matching CSRF token header.
+type fakeGUI struct {
+	mu       sync.Mutex
+	basic    bool // login by HTTP basic auth only, as before the password form existed
+	session  int  // current session number; 0 before the first login
+	logins   int
+	refusals int
+}
+
+func (g *fakeGUI) serve(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	sid, csrf := "s"+strconv.Itoa(g.session), "t"+strconv.Itoa(g.session)
+	switch {
+	case r.URL.Path == "/rest/noauth/auth/password":
+		var form struct{ Username, Password string }
+		if g.basic {
+			http.NotFound(w, r)
+			return
+		}
+		if json.NewDecoder(r.Body).Decode(&form) != nil || form.Username != "admin" || form.Password != "hunter2" {
+			http.Error(w, "bad credentials", http.StatusForbidden)
+			return
+		}
+		g.login(w)
+	case r.URL.Path == "/":
+		if user, pass, ok := r.BasicAuth(); g.basic && ok && user == "admin" && pass == "hunter2" {
+			g.login(w)
+			sid, csrf = "s"+strconv.Itoa(g.session), "t"+strconv.Itoa(g.session)
+		} else if c, err := r.Cookie("sessionid-FAKE"); err != nil || c.Value != sid {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Authorization Required"`)
+			http.Error(w, "not authorized", http.StatusUnauthorized)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "CSRF-Token-FAKE", Value: csrf, Path: "/"})
+	case r.Header.Get("X-API-Key") != "":
+		http.Error(w, "API keys are disabled", http.StatusForbidden)
+	default:
+		c, err := r.Cookie("sessionid-FAKE")
+		if err != nil || c.Value != sid || r.Header.Get("X-CSRF-Token-FAKE") != csrf {
+			g.refusals++
+			http.Error(w, "CSRF Error", http.StatusForbidden)
+			return
+		}
+		writeJSON(w, syncthing.SystemStatus{MyID: "FAKE"})
+	}
+}
+
+func (g *fakeGUI) login(w http.ResponseWriter) {
+	g.session++
+	g.logins++
+	http.SetCookie(w, &http.Cookie{Name: "sessionid-FAKE", Value: "s" + strconv.Itoa(g.session), Path: "/"})
+}
+
+// expire drops the current session, as a GUI restart would.
+func (g *fakeGUI) expire() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.session++
+}
+
+func newSessionClient(t *testing.T, g *fakeGUI, password string) *syncthing.Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(g.serve))
+	t.Cleanup(srv.Close)
+	c, err := syncthing.NewClient(srv.URL, "", syncthing.ClientOptions{GUIUser: "admin", GUIPassword: password})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	return c
+}
+
+func TestSessionAuthLogsInAndSendsCSRFToken(t *testing.T) {
+	for _, basic := range []bool{false, true} {
+		g := &fakeGUI{basic: basic}
+		c := newSessionClient(t, g, "hunter2")
+		ctx := context.Background()
+
+		for i := 0; i < 3; i++ {
+			if _, _, err := c.SystemStatus(ctx, time.Second); err != nil {
+				t.Fatalf("basic=%v: request %d failed: %v", basic, i, err)
+			}
+		}
+		if g.logins != 1 || g.refusals != 0 {
+			t.Fatalf("basic=%v: expected one login and no refusals, got %d logins, %d refusals", basic, g.logins, g.refusals)
+		}
+
+		// A dropped session is refused once, then the client logs in again.
+		g.expire()
+		if _, _, err := c.SystemStatus(ctx, time.Second); err != nil {
+			t.Fatalf("basic=%v: request after expiry failed: %v", basic, err)
+		}
+		if g.logins != 2 || g.refusals != 1 {
+			t.Fatalf("basic=%v: expected a second login after one refusal, got %d logins, %d refusals", basic, g.logins, g.refusals)
+		}
+	}
+}
+
+func TestSessionAuthReportsRefusedLogin(t *testing.T) {
+	g := &fakeGUI{}
+	c := newSessionClient(t, g, "wrong")
+	_, _, err := c.SystemStatus(context.Background(), time.Second)
+	if err == nil || err.Error() != "GUI login as admin refused: 403 Forbidden" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestSessionAuthExcludesAPIKey(t *testing.T) {
+	if _, err := syncthing.NewClient("http://127.0.0.1:8384", "abc123", syncthing.ClientOptions{GUIUser: "admin"}); err == nil {
+		t.Fatalf("expected an API key plus GUI login to be refused")
+	}
+
+	cases := []struct {
+		name string
+		env  map[string]string
+		ok   bool
+	}{
+		{"session", map[string]string{"ST_AUTH_MODE": "session", "ST_GUI_USER": "admin", "ST_GUI_PASSWORD": "hunter2"}, true},
+		{"session with a key", map[string]string{"ST_AUTH_MODE": "session", "ST_GUI_USER": "admin", "ST_GUI_PASSWORD": "hunter2", "ST_API_KEY": "abc123"}, false},
+		{"session without a password", map[string]string{"ST_AUTH_MODE": "session", "ST_GUI_USER": "admin"}, false},
+		{"key with a GUI user", map[string]string{"ST_API_KEY": "abc123", "ST_GUI_USER": "admin"}, false},
+		{"unknown mode", map[string]string{"ST_AUTH_MODE": "oauth", "ST_API_KEY": "abc123"}, false},
+	}
+	for _, tc := range cases {
+		os.Clearenv()
+		os.Setenv("ST_CRON", "*/5 * * * *")
+		for k, v := range tc.env {
+			os.Setenv(k, v)
+		}
+		st, err := LoadSettingsFromEnv()
+		if (err == nil) != tc.ok {
+			t.Fatalf("%s: unexpected result: %v", tc.name, err)
+		}
+		if tc.ok && (st.AuthMode != authSession || st.GUIUser != "admin" || st.APIKey != "") {
+			t.Fatalf("%s: unexpected settings: %+v", tc.name, st)
+		}
+	}
+}
@@ -3,25 +3,350 @@ package app
 import (
 	"errors"
 	"fmt"
+	"maps"
 	"math"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"text/template"
 	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
 )
 
 type Settings struct {
 	APIURL         string
+	APIURLFallback string // optional second address of the same instance
 	APIKey         string
+	APIKeyFile     string // file APIKey was read from, re-read when Syncthing refuses the key
+	// AuthMode is how ST_API_URL is authenticated: authAPIKey with APIKey, or
+	// authSession, logging in to the GUI as GUIUser for a session cookie and CSRF token.
+	AuthMode       string
+	GUIUser        string
+	GUIPassword    string
 	ScanOnStartup  bool
 	VerifyTLS      bool
 	RequestTimeout float64 // seconds; 0 means default
+	ErrorBodyLimit int     // bytes of a Syncthing error response shown in logs; 0 means default
 	RunOnce        bool
+	RunDeadline    time.Duration // bounds --check, RUN_ONCE and each scheduled tick; 0 disables
 	DryRun         bool
 	CronExpr       string
+	// Folders are the ST_FOLDERS and ST_FOLDERS_FILE entries ST_CRON scans; empty
+	// means "*". Read them through Service.Folders, as SIGHUP re-reads the file.
+	Folders        []string
+	FoldersFile    string
+	FolderPriority []string // ST_FOLDER_PRIORITY: folder IDs and "*", the trigger order within a run
 	FolderCron     map[string]string
+	FolderCronFile string // ST_FOLDER_CRON_FILE, merged under ST_FOLDER_CRON and re-read on SIGHUP
 	CronTimezone   string
+
+	// FolderOverrideCron and FolderRevertCron schedule the "override" and "revert"
+	// actions of ST_FOLDER_CRON lines, which only run with AllowDestructive
+	// (ST_ALLOW_DESTRUCTIVE) set. A revert waits for more than RevertThreshold
+	// locally changed files. RestartCron (ST_RESTART_CRON) restarts Syncthing, and
+	// needs AllowDestructive too.
+	FolderOverrideCron map[string]string
+	FolderRevertCron   map[string]string
+	AllowDestructive   bool
+	RevertThreshold    int
+	RestartCron        string
+	// AutoAcceptDevices (ST_AUTO_ACCEPT_DEVICES) are the pending devices that are
+	// added to the config, with AutoAcceptIntroducer and AutoAcceptShares set as
+	// given. AutoAcceptFolders (ST_AUTO_ACCEPT_FOLDERS) accepts the folders those
+	// devices offer. Both need AllowDestructive.
+	AutoAcceptDevices    []DevicePattern
+	AutoAcceptIntroducer bool
+	AutoAcceptShares     bool
+	AutoAcceptFolders    []FolderAcceptRule
+
+	// FolderVersionsReportCron schedules the "versions-report" action of ST_FOLDER_CRON
+	// lines; a folder whose versions take more than VersionsWarnGB GiB raises
+	// versions_over_threshold. 0 only logs the report.
+	FolderVersionsReportCron map[string]string
+	VersionsWarnGB           float64
+
+	// FolderPauseCron and FolderResumeCron (ST_PAUSE_CRON, ST_RESUME_CRON) pause and
+	// resume folders on a schedule, in the ST_FOLDER_CRON line format.
+	FolderPauseCron  map[string]string
+	FolderResumeCron map[string]string
+
+	// PauseWindows are the times each folder is kept paused (ST_PAUSE_WINDOWS).
+	PauseWindows map[string][]PauseWindow
+	// DevicePauseWindows are the same for devices, keyed by device ID or name.
+	DevicePauseWindows map[string][]PauseWindow
+	// WatcherOffWindows are the times each folder's filesystem watcher is kept off.
+	WatcherOffWindows map[string][]PauseWindow
+	// IgnorePaused are folders not warned about when found paused or stopped in
+	// Syncthing (ST_IGNORE_PAUSED); "*" silences the check.
+	IgnorePaused []string
+	// BandwidthSchedule sets Syncthing's global rate limits on cron schedules.
+	BandwidthSchedule []BandwidthRule
+	// ManageRescanInterval turns off Syncthing's own rescans of scheduled folders.
+	ManageRescanInterval bool
+
 	StatusDelaySec float64
+	ConfigCacheTTL time.Duration // 0 disables folder list caching
+	StatusCacheTTL time.Duration // how long a folder status is shared between consumers; 0 disables
+	SkipIfScanning bool
+	GlobalScan     bool          // scan "*" with one POST for everything instead of one per folder
+	ScanWorkers    int           // concurrent scan triggers per instance
+	StaleScanWarn  time.Duration // warn and report degraded when Syncthing's last scan is older; 0 disables
+	// DeviceAbsentWarn raises device_absent for devices sharing a configured folder
+	// that have not been seen for longer (ST_DEVICE_ABSENT_WARN); 0 disables.
+	DeviceAbsentWarn time.Duration
+	// DuplicateScanThreshold is how many scans we did not trigger, each starting
+	// within DuplicateScanWindow of one of the folder's schedule times, make an
+	// instance look shared with another kicker (ST_DUPLICATE_SCAN_THRESHOLD); 0 disables.
+	DuplicateScanThreshold int
+	DuplicateScanWindow    time.Duration
+	// ScanLatencyBudget is how long the status check after a scan keeps polling until
+	// the folder settles, to measure the scan's latency; 0 disables.
+	ScanLatencyBudget time.Duration
+	ScanLatencyWarn   time.Duration // warn when a scan's latency is longer; 0 disables
+	// ScanTimeoutPolicy is what a timed-out scan trigger counts as: ok, warn or error.
+	ScanTimeoutPolicy string
+	ScanNext          time.Duration            // sent as Syncthing's "next" with every scan trigger; 0 omits it
+	FolderScanNext    map[string]time.Duration // per-folder ScanNext overrides
+	// CheckStateSeverity overrides how --check rates folder states (ST_CHECK_STATE_SEVERITY).
+	CheckStateSeverity map[string]string
+	// CheckNeed is what makes a folder out of sync (ST_CHECK_NEED): checkNeedAll for
+	// anything it needs, checkNeedFiles for files only, so that pending deletes,
+	// directories and symlinks alone do not count.
+	CheckNeed string
+
+	NotifySinks  []NotifySinkSettings // named notification sinks (ST_NOTIFY_SINKS, ST_NOTIFY_WEBHOOK)
+	NotifyRoutes []NotifyRoute        // which events go to which sinks; empty sends everything everywhere
+	// NotifyTemplates maps a sink name ("" for all sinks) to its message templates.
+	NotifyTemplates map[string]NotifyTemplate
+	AlertAfter      int           // consecutive failed triggers before scan_failed is raised
+	AlertRepeat     time.Duration // scan_still_failing reminder interval; 0 disables
+	RecoveryMin     time.Duration // shortest unhealthy episode that raises folder_recovered
+	DigestCron      string        // when to send the activity digest; empty disables
+	NotifyCooldown  time.Duration // identical events within this are suppressed; 0 disables
+	// NotifySeverity overrides the default severity of event types (ST_NOTIFY_SEVERITY).
+	NotifySeverity map[string]string
+
+	LogOnChange  bool          // only log status lines that differ from the last one
+	LogHeartbeat time.Duration // with LogOnChange, still log each folder at least this often
+	LogFormat    string        // plain, pretty or json
+	LogColor     string        // auto, always or never (pretty only)
+
+	LogFile       string // optional log file, rotated by size
+	LogMaxSizeMB  int    // rotate once the file would exceed this; 0 never
+	LogMaxBackups int    // rotated files kept as .1 … .N
+	LogStdout     bool   // also log to stdout when LogFile is set
+
+	DeferWhileSyncing  string        // off, skip or wait
+	DeferMax           time.Duration // how long "wait" polls before giving up
+	DeferTimeoutAction string        // proceed or skip once DeferMax has elapsed
+
+	StateFile          string        // optional JSON file persisting per-folder state across restarts
+	StateFlushInterval time.Duration // minimum time between state file writes; 0 writes every change
+	SkipUnchanged      bool          // skip scans when the folder sequence has not moved
+	SkipUnchangedMax   time.Duration // force a scan at least this often when SkipUnchanged is set
+
+	FolderSubpaths   map[string][]string // folder -> sub-paths scanned one per tick
+	SubpathFullEvery int                 // full scan after this many complete sub-path rounds; 0 never
+
+	AdminAddr  string // optional listen address for the local HTTP API
+	AdminToken string // bearer token required by the HTTP API when set
+
+	StatsDAddr   string // optional host:port of a StatsD server (UDP)
+	StatsDPrefix string // prefix for every StatsD metric name
+	StatsDTags   bool   // send folder and instance as DogStatsD tags
+
+	HealthSocket      string        // unix socket always serving /healthz; empty disables
+	HealthcheckMaxAge time.Duration // --healthcheck fallback: max age of the state file's last success
+	HistorySize       int           // number of runs kept for /api/history
+	LivenessMaxAge    time.Duration // /livez fails once the scheduler heartbeat is older than this
+	ReadinessMaxAge   time.Duration // /readyz probes Syncthing when the last contact is older than this
+	PanicLimit        int           // panics per hour the scheduler is rebuilt after before giving up
+	// HealthUnhealthyAfter is how long an instance may stay unreachable before the
+	// health level goes from degraded to unhealthy; HealthRecoverAfter is how long a
+	// better level must hold before the health level improves.
+	HealthUnhealthyAfter time.Duration
+	HealthRecoverAfter   time.Duration
+	// OfflineGrace is how long connection failures to an instance are held back
+	// before they are reported, so Syncthing restarts go unnoticed; 0 disables.
+	OfflineGrace time.Duration
+	// StartupWait is how long Run waits for Syncthing to answer a ping before
+	// anything else; 0 does not wait.
+	StartupWait time.Duration
+
+	WatchPaths    map[string]string // folder -> local directory watched for changes
+	WatchDebounce time.Duration     // quiet period after the last change before scanning
+
+	TriggerFiles       map[string]string // folder -> marker file whose mtime triggers a scan
+	TriggerFilePoll    time.Duration
+	TriggerFileConsume bool // delete the marker after a successful trigger
+
+	CompletionRules map[string][]string // source folder -> folders scanned when it finishes syncing
+
+	HookOutputLimit int // bytes of output logged per hook command; 0 logs none
+
+	ScanConditionCmd   string            // shell command that must exit 0 for a scan to go ahead
+	FolderConditionCmd map[string]string // per-folder ScanConditionCmd overrides
+	ScanConditionTTL   time.Duration     // how long a condition result is reused; 0 runs it every time
+
+	Instances []InstanceSettings // additional named Syncthing instances
+
+	warnings []string // see Warnings
+}
+
+// NotifySinkSettings configures one notification sink.
+type NotifySinkSettings struct {
+	Name    string
+	Type    string // webhook, ntfy, slack or discord
+	URL     string
+	Timeout time.Duration // per-delivery timeout; 0 uses the default
+
+	Channel  string // slack only: post to this channel instead of the webhook's own
+	Username string // slack only: post under this name
+}
+
+// NotifyRoute sends the listed event types ("*" for all) to the listed sinks.
+type NotifyRoute struct {
+	Events []string
+	Sinks  []string
+	// Folders limits the route to events about these folders, by ID or label; with
+	// ExcludeFolders it covers every event except those about them.
+	Folders        []string
+	ExcludeFolders bool
+}
+
+// InstanceSettings describes one named Syncthing instance from ST_INSTANCES.
+type InstanceSettings struct {
+	Name        string
+	APIURL      string
+	APIKey      string
+	FallbackURL string
+}
+
+// ST_AUTH_MODE values.
+const (
+	authAPIKey  = "apikey"
+	authSession = "session"
+)
+
+// ST_CHECK_NEED values.
+const (
+	checkNeedAll   = "all"
+	checkNeedFiles = "files"
+)
+
+const (
+	deferOff     = "off"
+	deferSkip    = "skip"
+	deferWait    = "wait"
+	deferProceed = "proceed"
+)
+
+// Warnings returns what LoadSettingsFromEnv found worth logging but not fatal.
+func (st Settings) Warnings() []string {
+	return st.warnings
+}
+
+// Location returns the timezone schedules and pause windows are read in: CRON_TZ
+// or TZ, or time.Local when neither is set. LoadSettingsFromEnv rejects a zone that
+// does not load, so only hand-built settings get an error here.
+func (st Settings) Location() (*time.Location, error) {
+	tz := strings.TrimSpace(st.CronTimezone)
+	if tz == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", tz, err)
+	}
+	return loc, nil
+}
+
+// timezoneWarning explains what is off about an abbreviation such as EST or CET
+// used as CRON_TZ/TZ, or returns "" for a region name or UTC. Those zones are
+// kept for compatibility: some are fixed offsets that never move for daylight
+// saving time, and what the others mean has changed between tzdata releases.
+func timezoneWarning(tz string, loc *time.Location, now time.Time) string {
+	switch tz {
+	case "UTC", "UCT", "GMT", "Local":
+		return ""
+	}
+	if strings.Contains(tz, "/") || strings.ToUpper(tz) != tz {
+		return ""
+	}
+	year := now.Year()
+	_, winter := time.Date(year, time.January, 1, 12, 0, 0, 0, loc).Zone()
+	_, summer := time.Date(year, time.July, 1, 12, 0, 0, 0, loc).Zone()
+	if winter == summer {
+		return fmt.Sprintf("CRON_TZ/TZ %q is a fixed UTC offset that ignores daylight saving time; use a region name such as America/New_York if schedules should follow local clocks", tz)
+	}
+	return fmt.Sprintf("CRON_TZ/TZ %q is a legacy abbreviation whose rules depend on the tzdata release; prefer a region name such as Europe/Paris", tz)
+}
+
+// Redacted returns a copy of the settings that is safe to show: API keys are masked
+// to their last 4 characters, passwords and tokens hidden, credentials removed from
+// Syncthing addresses and notification sink URLs cut down to their host.
+func (st Settings) Redacted() Settings {
+	st.APIURL = syncthing.RedactURL(st.APIURL, st.APIKey)
+	st.APIURLFallback = syncthing.RedactURL(st.APIURLFallback, st.APIKey)
+	st.APIKey = syncthing.MaskKey(st.APIKey)
+	st.GUIPassword = hideSecret(st.GUIPassword)
+	st.AdminToken = hideSecret(st.AdminToken)
+	st.Instances = slices.Clone(st.Instances)
+	for i, inst := range st.Instances {
+		st.Instances[i].APIURL = syncthing.RedactURL(inst.APIURL, inst.APIKey)
+		st.Instances[i].FallbackURL = syncthing.RedactURL(inst.FallbackURL, inst.APIKey)
+		st.Instances[i].APIKey = syncthing.MaskKey(inst.APIKey)
+	}
+	st.NotifySinks = slices.Clone(st.NotifySinks)
+	for i, sink := range st.NotifySinks {
+		st.NotifySinks[i].URL = redactSinkURL(sink.URL)
+	}
+	st.warnings = nil
+	return st
+}
+
+// hideSecret replaces a set secret with a fixed placeholder, giving away nothing
+// about it, not even its length.
+func hideSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "********"
+}
+
+// redactSinkURL keeps the scheme and host of a notification sink URL. Webhook,
+// Slack, Discord and ntfy URLs carry their credentials in the path or query.
+func redactSinkURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return hideSecret(raw)
+	}
+	out := u.Scheme + "://" + u.Host
+	if strings.Trim(u.Path, "/") != "" || u.RawQuery != "" {
+		out += "/********"
+	}
+	return out
+}
+
+// ReadKeyFile reads the API key from ST_API_KEY_FILE, ignoring surrounding
+// whitespace.
+func ReadKeyFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("ST_API_KEY_FILE: %w", err)
+	}
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return "", fmt.Errorf("ST_API_KEY_FILE: %s is empty", path)
+	}
+	return key, nil
 }
 
 func LoadSettingsFromEnv() (Settings, error) {
@@ -35,19 +360,125 @@ func LoadSettingsFromEnv() (Settings, error) {
 	}
 	apiURL = strings.TrimRight(apiURL, "/") + "/"
 
+	apiURLFallback := strings.TrimSpace(os.Getenv("ST_API_URL_FALLBACK"))
+	if apiURLFallback != "" {
+		apiURLFallback = strings.TrimRight(apiURLFallback, "/") + "/"
+	}
+
 	apiKey := strings.TrimSpace(os.Getenv("ST_API_KEY"))
-	if apiKey == "" {
-		return Settings{}, errors.New("ST_API_KEY environment variable is required")
+	apiKeyFile := strings.TrimSpace(os.Getenv("ST_API_KEY_FILE"))
+	if apiKeyFile != "" {
+		if apiKey != "" {
+			return Settings{}, errors.New("ST_API_KEY and ST_API_KEY_FILE are mutually exclusive")
+		}
+		key, err := ReadKeyFile(apiKeyFile)
+		if err != nil {
+			return Settings{}, err
+		}
+		apiKey = key
+	}
+	authMode := strings.ToLower(strings.TrimSpace(getenv("ST_AUTH_MODE", authAPIKey)))
+	guiUser := strings.TrimSpace(os.Getenv("ST_GUI_USER"))
+	guiPassword := os.Getenv("ST_GUI_PASSWORD")
+	switch authMode {
+	case authAPIKey:
+		if apiKey == "" {
+			return Settings{}, errors.New("ST_API_KEY or ST_API_KEY_FILE is required")
+		}
+		if guiUser != "" || guiPassword != "" {
+			return Settings{}, errors.New("ST_GUI_USER and ST_GUI_PASSWORD need ST_AUTH_MODE=session")
+		}
+	case authSession:
+		if guiUser == "" || guiPassword == "" {
+			return Settings{}, errors.New("ST_AUTH_MODE=session requires ST_GUI_USER and ST_GUI_PASSWORD")
+		}
+		if apiKey != "" {
+			return Settings{}, errors.New("ST_API_KEY and ST_API_KEY_FILE cannot be used with ST_AUTH_MODE=session")
+		}
+	default:
+		return Settings{}, fmt.Errorf("invalid ST_AUTH_MODE %q (expected apikey or session)", authMode)
 	}
 
 	cronExpr := strings.TrimSpace(os.Getenv("ST_CRON"))
-	folderCron, err := parseFolderCron(os.Getenv("ST_FOLDER_CRON"))
+	foldersFile := strings.TrimSpace(os.Getenv("ST_FOLDERS_FILE"))
+	folders, foldersWarning, err := loadFolders(foldersFile)
+	if err != nil {
+		return Settings{}, err
+	}
+	var warnings []string
+	if foldersWarning != "" {
+		warnings = append(warnings, foldersWarning)
+	}
+	folderCronFile := strings.TrimSpace(os.Getenv("ST_FOLDER_CRON_FILE"))
+	folderCrons, err := loadFolderCron(folderCronFile)
+	if err != nil {
+		return Settings{}, err
+	}
+	folderCron := folderCrons[actionScan]
+	folderOverrideCron := folderCrons[actionOverride]
+	folderRevertCron := folderCrons[actionRevert]
+	folderVersionsReportCron := folderCrons[actionVersionsReport]
+	versionsWarnGB := 0.0
+	if raw := strings.TrimSpace(os.Getenv("ST_VERSIONS_WARN_GB")); raw != "" {
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return Settings{}, fmt.Errorf("invalid ST_VERSIONS_WARN_GB: %w", err)
+		}
+		if v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+			return Settings{}, errors.New("ST_VERSIONS_WARN_GB must be >= 0 and not NaN or Inf")
+		}
+		versionsWarnGB = v
+	}
+	autoAcceptDevices, err := parseDevicePatterns(os.Getenv("ST_AUTO_ACCEPT_DEVICES"))
+	if err != nil {
+		return Settings{}, err
+	}
+	// ST_AUTO_ACCEPT_FOLDERS was first the boolean now called ST_AUTO_ACCEPT_SHARES.
+	acceptFoldersRaw := os.Getenv("ST_AUTO_ACCEPT_FOLDERS")
+	autoAcceptShares := parseBool(getenv("ST_AUTO_ACCEPT_SHARES", "false"), false)
+	switch strings.ToLower(strings.TrimSpace(acceptFoldersRaw)) {
+	case "1", "true", "yes", "on", "0", "false", "no", "off":
+		warnings = append(warnings, "ST_AUTO_ACCEPT_FOLDERS=true/false is deprecated; use ST_AUTO_ACCEPT_SHARES instead")
+		if os.Getenv("ST_AUTO_ACCEPT_SHARES") == "" {
+			autoAcceptShares = parseBool(acceptFoldersRaw, false)
+		}
+		acceptFoldersRaw = ""
+	}
+	autoAcceptFolders, err := parseFolderAcceptRules(acceptFoldersRaw)
+	if err != nil {
+		return Settings{}, err
+	}
+	if len(autoAcceptFolders) > 0 && len(autoAcceptDevices) == 0 {
+		return Settings{}, errors.New("ST_AUTO_ACCEPT_FOLDERS needs ST_AUTO_ACCEPT_DEVICES to say which devices to accept folders from")
+	}
+	revertThreshold, err := parseNonNegativeInt("ST_REVERT_THRESHOLD", getenv("ST_REVERT_THRESHOLD", "0"))
+	if err != nil {
+		return Settings{}, err
+	}
+
+	pauseWindows, err := parsePauseWindows("ST_PAUSE_WINDOWS", os.Getenv("ST_PAUSE_WINDOWS"))
+	if err != nil {
+		return Settings{}, err
+	}
+	devicePauseWindows, err := parsePauseWindows("ST_DEVICE_PAUSE_WINDOWS", os.Getenv("ST_DEVICE_PAUSE_WINDOWS"))
+	if err != nil {
+		return Settings{}, err
+	}
+	watcherOffWindows, err := parsePauseWindows("ST_WATCHER_OFF_WINDOWS", os.Getenv("ST_WATCHER_OFF_WINDOWS"))
+	if err != nil {
+		return Settings{}, err
+	}
+	ignorePaused, err := parseIgnorePaused(os.Getenv("ST_IGNORE_PAUSED"))
+	if err != nil {
+		return Settings{}, err
+	}
+	bandwidthSchedule, err := parseBandwidthSchedule(os.Getenv("ST_BANDWIDTH_SCHEDULE"))
 	if err != nil {
 		return Settings{}, err
 	}
 
 	if cronExpr == "" && len(folderCron) == 0 {
-		return Settings{}, errors.New("Set ST_CRON (global cron schedule) and/or ST_FOLDER_CRON (per-folder schedules).")
+		return Settings{}, errors.New("Set ST_CRON (global cron schedule) and/or ST_FOLDER_CRON or ST_FOLDER_CRON_FILE (per-folder schedules).")
 	}
 
 	cronTZ := strings.TrimSpace(os.Getenv("CRON_TZ"))
@@ -55,9 +486,39 @@ func LoadSettingsFromEnv() (Settings, error) {
 		cronTZ = strings.TrimSpace(os.Getenv("TZ"))
 	}
 	if cronTZ != "" {
-		if _, err := time.LoadLocation(cronTZ); err != nil {
+		loc, err := Settings{CronTimezone: cronTZ}.Location()
+		if err != nil {
 			return Settings{}, fmt.Errorf("invalid CRON_TZ/TZ value: %w", err)
 		}
+		if w := timezoneWarning(cronTZ, loc, time.Now()); w != "" {
+			warnings = append(warnings, w)
+		}
+	}
+	// Expressions may carry their own CRON_TZ= prefix; catch a zone this box cannot
+	// load now rather than when the scheduler starts.
+	if cronExpr != "" {
+		if _, err := cronParser.Parse(cronExpr); err != nil {
+			return Settings{}, fmt.Errorf("invalid ST_CRON: %w", err)
+		}
+	}
+	restartCron := strings.TrimSpace(os.Getenv("ST_RESTART_CRON"))
+	if restartCron != "" {
+		if _, err := cronParser.Parse(restartCron); err != nil {
+			return Settings{}, fmt.Errorf("invalid ST_RESTART_CRON: %w", err)
+		}
+	}
+	for _, folder := range slices.Sorted(maps.Keys(folderCron)) {
+		if _, err := cronParser.Parse(folderCron[folder]); err != nil {
+			return Settings{}, fmt.Errorf("invalid ST_FOLDER_CRON expr for %s: %w", folder, err)
+		}
+	}
+	folderPauseCron, err := parseFolderSchedules("ST_PAUSE_CRON", os.Getenv("ST_PAUSE_CRON"))
+	if err != nil {
+		return Settings{}, err
+	}
+	folderResumeCron, err := parseFolderSchedules("ST_RESUME_CRON", os.Getenv("ST_RESUME_CRON"))
+	if err != nil {
+		return Settings{}, err
 	}
 
 	statusDelaySec := 5.0
@@ -84,77 +545,1404 @@ func LoadSettingsFromEnv() (Settings, error) {
 		}
 		requestTimeout = v
 	}
+	errorBodyLimit, err := parseNonNegativeInt("ST_ERROR_BODY_LIMIT", getenv("ST_ERROR_BODY_LIMIT", "0"))
+	if err != nil {
+		return Settings{}, err
+	}
 
-	return Settings{
-		APIURL:         apiURL,
-		APIKey:         apiKey,
-		ScanOnStartup:  parseBool(getenv("SCAN_ON_STARTUP", "false"), false),
-		VerifyTLS:      verifyTLS,
-		RequestTimeout: requestTimeout,
-		RunOnce:        parseBool(getenv("RUN_ONCE", "false"), false),
-		DryRun:         parseBool(getenv("DRY_RUN", "false"), false),
-		CronExpr:       cronExpr,
-		FolderCron:     folderCron,
-		CronTimezone:   cronTZ,
-		StatusDelaySec: statusDelaySec,
-	}, nil
-}
-
-func getenv(name, def string) string {
-	v := os.Getenv(name)
-	if v == "" {
-		return def
+	configCacheTTL, err := parseDuration("ST_CONFIG_CACHE", getenv("ST_CONFIG_CACHE", "5m"))
+	if err != nil {
+		return Settings{}, err
+	}
+	statusCacheTTL, err := parseDuration("ST_STATUS_CACHE", getenv("ST_STATUS_CACHE", "2s"))
+	if err != nil {
+		return Settings{}, err
+	}
+	scanLatencyBudget, err := parseDuration("ST_SCAN_LATENCY_BUDGET", getenv("ST_SCAN_LATENCY_BUDGET", "0"))
+	if err != nil {
+		return Settings{}, err
+	}
+	scanLatencyWarn, err := parseDuration("ST_SCAN_LATENCY_WARN", getenv("ST_SCAN_LATENCY_WARN", "0"))
+	if err != nil {
+		return Settings{}, err
 	}
-	return v
-}
 
-func parseBool(raw string, def bool) bool {
-	s := strings.TrimSpace(strings.ToLower(raw))
-	if s == "" {
-		return def
+	deferMode := strings.ToLower(strings.TrimSpace(getenv("ST_DEFER_WHILE_SYNCING", deferOff)))
+	switch deferMode {
+	case deferOff, deferSkip, deferWait:
+	default:
+		return Settings{}, fmt.Errorf("invalid ST_DEFER_WHILE_SYNCING %q (expected off, skip or wait)", deferMode)
 	}
-	switch s {
-	case "1", "true", "yes", "on":
-		return true
-	case "0", "false", "no", "off":
-		return false
+	deferMax, err := parseDuration("ST_DEFER_MAX", getenv("ST_DEFER_MAX", "30m"))
+	if err != nil {
+		return Settings{}, err
+	}
+	deferTimeoutAction := strings.ToLower(strings.TrimSpace(getenv("ST_DEFER_TIMEOUT_ACTION", deferProceed)))
+	switch deferTimeoutAction {
+	case deferProceed, deferSkip:
 	default:
-		return def
+		return Settings{}, fmt.Errorf("invalid ST_DEFER_TIMEOUT_ACTION %q (expected proceed or skip)", deferTimeoutAction)
 	}
-}
 
-func parseFolderCron(raw string) (map[string]string, error) {
-	out := map[string]string{}
-	for _, line := range strings.Split(raw, "\n") {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		parts := strings.SplitN(line, ":", 2)
-		if len(parts) != 2 {
-			return nil, errors.New("Invalid ST_FOLDER_CRON line. Expected 'folderId: <cron expr>'")
-		}
-		folder := strings.TrimSpace(parts[0])
-		expr := strings.TrimSpace(parts[1])
-		if folder == "" || expr == "" {
-			return nil, errors.New("Invalid ST_FOLDER_CRON line. Expected 'folderId: <cron expr>'")
-		}
-		if err := validateFolderID(folder); err != nil {
-			return nil, err
-		}
-		out[folder] = expr
+	skipUnchangedMax, err := parseDuration("ST_SKIP_UNCHANGED_MAX", getenv("ST_SKIP_UNCHANGED_MAX", "24h"))
+	if err != nil {
+		return Settings{}, err
 	}
-	return out, nil
-}
 
-func validateFolderID(folder string) error {
-	// Syncthing folder IDs are generally simple slugs; reject whitespace and separators
-	// that are likely user mistakes or unsafe to pass around.
-	if strings.ContainsAny(folder, " \t\r\n,;") {
-		return errors.New("Invalid folder ID in ST_FOLDER_CRON")
+	folderSubpaths, err := parseFolderSubpaths(os.Getenv("ST_FOLDER_SUBPATHS"))
+	if err != nil {
+		return Settings{}, err
 	}
-	if strings.Contains(folder, ":") {
-		return errors.New("Invalid folder ID in ST_FOLDER_CRON")
+	subpathFullEvery, err := parseNonNegativeInt("ST_SUBPATH_FULL_EVERY", getenv("ST_SUBPATH_FULL_EVERY", "0"))
+	if err != nil {
+		return Settings{}, err
 	}
-	return nil
+
+	healthSocket := getenv("ST_HEALTH_SOCKET", filepath.Join(os.TempDir(), "syncthing-kicker.sock"))
+	if strings.EqualFold(strings.TrimSpace(healthSocket), "off") {
+		healthSocket = ""
+	}
+	healthcheckMaxAge, err := parseDuration("ST_HEALTHCHECK_MAX_AGE", getenv("ST_HEALTHCHECK_MAX_AGE", "168h"))
+	if err != nil {
+		return Settings{}, err
+	}
+
+	livenessMaxAge, err := parseDuration("ST_LIVENESS_MAX_AGE", getenv("ST_LIVENESS_MAX_AGE", "1m"))
+	if err != nil {
+		return Settings{}, err
+	}
+	readinessMaxAge, err := parseDuration("ST_READINESS_MAX_AGE", getenv("ST_READINESS_MAX_AGE", "5m"))
+	if err != nil {
+		return Settings{}, err
+	}
+
+	healthUnhealthyAfter, err := parseDuration("ST_UNHEALTHY_AFTER", getenv("ST_UNHEALTHY_AFTER", "5m"))
+	if err != nil {
+		return Settings{}, err
+	}
+	healthRecoverAfter, err := parseDuration("ST_HEALTH_RECOVER_AFTER", getenv("ST_HEALTH_RECOVER_AFTER", "1m"))
+	if err != nil {
+		return Settings{}, err
+	}
+	offlineGrace, err := parseDuration("ST_OFFLINE_GRACE", getenv("ST_OFFLINE_GRACE", "60s"))
+	if err != nil {
+		return Settings{}, err
+	}
+	startupWait, err := parseDuration("ST_STARTUP_WAIT", os.Getenv("ST_STARTUP_WAIT"))
+	if err != nil {
+		return Settings{}, err
+	}
+
+	runDeadline, err := parseDuration("ST_RUN_DEADLINE", os.Getenv("ST_RUN_DEADLINE"))
+	if err != nil {
+		return Settings{}, err
+	}
+
+	scanWorkers, err := parsePositiveInt("ST_SCAN_WORKERS", getenv("ST_SCAN_WORKERS", strconv.Itoa(defaultScanWorkers)))
+	if err != nil {
+		return Settings{}, err
+	}
+
+	panicLimit, err := parseNonNegativeInt("ST_PANIC_LIMIT", getenv("ST_PANIC_LIMIT", strconv.Itoa(defaultPanicLimit)))
+	if err != nil {
+		return Settings{}, err
+	}
+
+	historySize, err := parsePositiveInt("ST_HISTORY_SIZE", getenv("ST_HISTORY_SIZE", strconv.Itoa(defaultHistorySize)))
+	if err != nil {
+		return Settings{}, err
+	}
+
+	staleScanWarn, err := parseDuration("ST_STALE_SCAN_WARN", getenv("ST_STALE_SCAN_WARN", "0"))
+	if err != nil {
+		return Settings{}, err
+	}
+	deviceAbsentWarn, err := parseDuration("ST_DEVICE_ABSENT_WARN", getenv("ST_DEVICE_ABSENT_WARN", "0"))
+	if err != nil {
+		return Settings{}, err
+	}
+	duplicateScanThreshold, err := parseNonNegativeInt("ST_DUPLICATE_SCAN_THRESHOLD", getenv("ST_DUPLICATE_SCAN_THRESHOLD", "0"))
+	if err != nil {
+		return Settings{}, err
+	}
+	duplicateScanWindow, err := parseDuration("ST_DUPLICATE_SCAN_WINDOW", getenv("ST_DUPLICATE_SCAN_WINDOW", "1m"))
+	if err != nil {
+		return Settings{}, err
+	}
+	if duplicateScanThreshold > 0 && duplicateScanWindow <= 0 {
+		return Settings{}, errors.New("ST_DUPLICATE_SCAN_WINDOW must be > 0 with ST_DUPLICATE_SCAN_THRESHOLD")
+	}
+	scanTimeoutPolicy := strings.ToLower(strings.TrimSpace(getenv("ST_SCAN_TIMEOUT_POLICY", scanTimeoutOK)))
+	switch scanTimeoutPolicy {
+	case scanTimeoutOK, scanTimeoutWarn, scanTimeoutError:
+	default:
+		return Settings{}, fmt.Errorf("invalid ST_SCAN_TIMEOUT_POLICY %q (expected ok, warn or error)", scanTimeoutPolicy)
+	}
+	folderPriority, err := parseFolderPriority(os.Getenv("ST_FOLDER_PRIORITY"))
+	if err != nil {
+		return Settings{}, err
+	}
+	scanNext, folderScanNext, err := parseScanNext(os.Getenv("ST_SCAN_NEXT"))
+	if err != nil {
+		return Settings{}, err
+	}
+	folderConditionCmd, err := parseFolderCommands("ST_FOLDER_CONDITION_CMD", os.Getenv("ST_FOLDER_CONDITION_CMD"))
+	if err != nil {
+		return Settings{}, err
+	}
+	scanConditionTTL, err := parseDuration("ST_SCAN_CONDITION_TTL", os.Getenv("ST_SCAN_CONDITION_TTL"))
+	if err != nil {
+		return Settings{}, err
+	}
+	hookOutputLimit, err := parseNonNegativeInt("ST_HOOK_OUTPUT_LIMIT", getenv("ST_HOOK_OUTPUT_LIMIT", strconv.Itoa(defaultHookOutputLimit)))
+	if err != nil {
+		return Settings{}, err
+	}
+
+	notifySinks, err := parseNotifySinks(os.Getenv("ST_NOTIFY_SINKS"), splitList(os.Getenv("ST_NOTIFY_WEBHOOK")))
+	if err != nil {
+		return Settings{}, err
+	}
+	notifyRoutes, err := parseNotifyRoutes(os.Getenv("ST_NOTIFY_ROUTES"), notifySinks)
+	if err != nil {
+		return Settings{}, err
+	}
+
+	notifyTemplates := map[string]NotifyTemplate{}
+	for _, sink := range append([]string{""}, sinkNames(notifySinks)...) {
+		t := NotifyTemplate{Title: os.Getenv(notifyTemplateEnv("TITLE", sink)), Body: os.Getenv(notifyTemplateEnv("BODY", sink))}
+		if t == (NotifyTemplate{}) {
+			continue
+		}
+		if _, err := parseNotifyTemplate(sink, t); err != nil {
+			return Settings{}, err
+		}
+		notifyTemplates[sink] = t
+	}
+
+	alertAfter, err := parsePositiveInt("ST_ALERT_AFTER", getenv("ST_ALERT_AFTER", "3"))
+	if err != nil {
+		return Settings{}, err
+	}
+	digestCron := strings.TrimSpace(os.Getenv("ST_DIGEST_CRON"))
+	if digestCron != "" {
+		if _, err := cronParser.Parse(digestCron); err != nil {
+			return Settings{}, fmt.Errorf("invalid ST_DIGEST_CRON: %w", err)
+		}
+	}
+	alertRepeat, err := parseDuration("ST_ALERT_REPEAT", getenv("ST_ALERT_REPEAT", "6h"))
+	if err != nil {
+		return Settings{}, err
+	}
+
+	recoveryMin, err := parseDuration("ST_RECOVERY_MIN", getenv("ST_RECOVERY_MIN", "10m"))
+	if err != nil {
+		return Settings{}, err
+	}
+	checkStateSeverity, err := parseCheckStateSeverity(os.Getenv("ST_CHECK_STATE_SEVERITY"))
+	if err != nil {
+		return Settings{}, err
+	}
+	checkNeed := strings.ToLower(strings.TrimSpace(getenv("ST_CHECK_NEED", checkNeedAll)))
+	if checkNeed != checkNeedAll && checkNeed != checkNeedFiles {
+		return Settings{}, fmt.Errorf("invalid ST_CHECK_NEED %q (expected all or files)", checkNeed)
+	}
+	notifyCooldown, err := parseDuration("ST_NOTIFY_COOLDOWN", getenv("ST_NOTIFY_COOLDOWN", "30m"))
+	if err != nil {
+		return Settings{}, err
+	}
+	notifySeverity, err := parseNotifySeverity(os.Getenv("ST_NOTIFY_SEVERITY"))
+	if err != nil {
+		return Settings{}, err
+	}
+
+	stateFlushInterval, err := parseDuration("ST_STATE_FLUSH_INTERVAL", getenv("ST_STATE_FLUSH_INTERVAL", "5s"))
+	if err != nil {
+		return Settings{}, err
+	}
+
+	logHeartbeat, err := parseDuration("ST_LOG_HEARTBEAT", getenv("ST_LOG_HEARTBEAT", "24h"))
+	if err != nil {
+		return Settings{}, err
+	}
+
+	logFormat := strings.ToLower(strings.TrimSpace(getenv("ST_LOG_FORMAT", logFormatPlain)))
+	switch logFormat {
+	case logFormatPlain, logFormatPretty, logFormatJSON:
+	default:
+		return Settings{}, fmt.Errorf("invalid ST_LOG_FORMAT %q (expected plain, pretty or json)", logFormat)
+	}
+	logColor := strings.ToLower(strings.TrimSpace(getenv("ST_LOG_COLOR", logColorAuto)))
+	switch logColor {
+	case logColorAuto, logColorAlways, logColorNever:
+	default:
+		return Settings{}, fmt.Errorf("invalid ST_LOG_COLOR %q (expected auto, always or never)", logColor)
+	}
+
+	logMaxSizeMB, err := parseNonNegativeInt("ST_LOG_MAX_SIZE_MB", getenv("ST_LOG_MAX_SIZE_MB", "10"))
+	if err != nil {
+		return Settings{}, err
+	}
+	logMaxBackups, err := parseNonNegativeInt("ST_LOG_MAX_BACKUPS", getenv("ST_LOG_MAX_BACKUPS", "5"))
+	if err != nil {
+		return Settings{}, err
+	}
+
+	watchPaths, err := parseFolderPaths("ST_WATCH_PATHS", os.Getenv("ST_WATCH_PATHS"))
+	if err != nil {
+		return Settings{}, err
+	}
+	watchDebounce, err := parseDuration("ST_WATCH_DEBOUNCE", getenv("ST_WATCH_DEBOUNCE", "10s"))
+	if err != nil {
+		return Settings{}, err
+	}
+
+	triggerFiles, err := parseFolderPaths("ST_TRIGGER_FILES", os.Getenv("ST_TRIGGER_FILES"))
+	if err != nil {
+		return Settings{}, err
+	}
+	triggerFilePoll, err := parseDuration("ST_TRIGGER_FILE_POLL", getenv("ST_TRIGGER_FILE_POLL", "30s"))
+	if err != nil {
+		return Settings{}, err
+	}
+	if len(triggerFiles) > 0 && triggerFilePoll <= 0 {
+		return Settings{}, errors.New("ST_TRIGGER_FILE_POLL must be > 0")
+	}
+
+	completionRules, err := parseCompletionRules(os.Getenv("ST_ON_FOLDER_COMPLETION"))
+	if err != nil {
+		return Settings{}, err
+	}
+
+	instances, err := parseInstances(os.Getenv("ST_INSTANCES"))
+	if err != nil {
+		return Settings{}, err
+	}
+
+	return Settings{
+		APIURL:            apiURL,
+		APIURLFallback:    apiURLFallback,
+		APIKey:            apiKey,
+		APIKeyFile:        apiKeyFile,
+		AuthMode:          authMode,
+		GUIUser:           guiUser,
+		GUIPassword:       guiPassword,
+		ScanOnStartup:     parseBool(getenv("SCAN_ON_STARTUP", "false"), false),
+		VerifyTLS:         verifyTLS,
+		RequestTimeout:    requestTimeout,
+		ErrorBodyLimit:    errorBodyLimit,
+		RunOnce:           parseBool(getenv("RUN_ONCE", "false"), false),
+		RunDeadline:       runDeadline,
+		DryRun:            parseBool(getenv("DRY_RUN", "false"), false),
+		CronExpr:          cronExpr,
+		Folders:           folders,
+		FoldersFile:       foldersFile,
+		FolderPriority:    folderPriority,
+		FolderCron:        folderCron,
+		FolderCronFile:    folderCronFile,
+		CronTimezone:      cronTZ,
+		StatusDelaySec:    statusDelaySec,
+		ConfigCacheTTL:    configCacheTTL,
+		StatusCacheTTL:    statusCacheTTL,
+		SkipIfScanning:    parseBool(getenv("ST_SKIP_IF_SCANNING", "true"), true),
+		GlobalScan:        parseBool(getenv("ST_GLOBAL_SCAN", "false"), false),
+		ScanWorkers:       scanWorkers,
+		StaleScanWarn:     staleScanWarn,
+		DeviceAbsentWarn:  deviceAbsentWarn,
+		ScanLatencyBudget: scanLatencyBudget,
+		ScanLatencyWarn:   scanLatencyWarn,
+
+		DuplicateScanThreshold: duplicateScanThreshold,
+		DuplicateScanWindow:    duplicateScanWindow,
+
+		FolderOverrideCron: folderOverrideCron,
+		FolderRevertCron:   folderRevertCron,
+		AllowDestructive:   parseBool(getenv("ST_ALLOW_DESTRUCTIVE", "false"), false),
+		RevertThreshold:    revertThreshold,
+		RestartCron:        restartCron,
+
+		AutoAcceptDevices:    autoAcceptDevices,
+		AutoAcceptIntroducer: parseBool(getenv("ST_AUTO_ACCEPT_INTRODUCER", "false"), false),
+		AutoAcceptShares:     autoAcceptShares,
+		AutoAcceptFolders:    autoAcceptFolders,
+
+		FolderVersionsReportCron: folderVersionsReportCron,
+		VersionsWarnGB:           versionsWarnGB,
+		FolderPauseCron:          folderPauseCron,
+		FolderResumeCron:         folderResumeCron,
+
+		ScanTimeoutPolicy:  scanTimeoutPolicy,
+		ScanNext:           scanNext,
+		FolderScanNext:     folderScanNext,
+		CheckStateSeverity: checkStateSeverity,
+		CheckNeed:          checkNeed,
+
+		NotifySinks:     notifySinks,
+		NotifyRoutes:    notifyRoutes,
+		NotifyTemplates: notifyTemplates,
+		AlertAfter:      alertAfter,
+		AlertRepeat:     alertRepeat,
+		RecoveryMin:     recoveryMin,
+		DigestCron:      digestCron,
+		NotifyCooldown:  notifyCooldown,
+		NotifySeverity:  notifySeverity,
+
+		LogOnChange:  parseBool(getenv("ST_LOG_ON_CHANGE", "false"), false),
+		LogHeartbeat: logHeartbeat,
+		LogFormat:    logFormat,
+		LogColor:     logColor,
+
+		LogFile:       strings.TrimSpace(os.Getenv("ST_LOG_FILE")),
+		LogMaxSizeMB:  logMaxSizeMB,
+		LogMaxBackups: logMaxBackups,
+		LogStdout:     parseBool(getenv("ST_LOG_STDOUT", "true"), true),
+
+		DeferWhileSyncing:  deferMode,
+		DeferMax:           deferMax,
+		DeferTimeoutAction: deferTimeoutAction,
+
+		StateFile:          strings.TrimSpace(os.Getenv("ST_STATE_FILE")),
+		StateFlushInterval: stateFlushInterval,
+		SkipUnchanged:      parseBool(getenv("ST_SKIP_UNCHANGED", "false"), false),
+		SkipUnchangedMax:   skipUnchangedMax,
+
+		FolderSubpaths:   folderSubpaths,
+		SubpathFullEvery: subpathFullEvery,
+
+		AdminAddr:  strings.TrimSpace(os.Getenv("ST_ADMIN_ADDR")),
+		AdminToken: strings.TrimSpace(os.Getenv("ST_ADMIN_TOKEN")),
+
+		StatsDAddr:   strings.TrimSpace(os.Getenv("ST_STATSD_ADDR")),
+		StatsDPrefix: strings.TrimSpace(getenv("ST_STATSD_PREFIX", "syncthing_kicker")),
+		StatsDTags:   parseBool(getenv("ST_STATSD_TAGS", "false"), false),
+
+		HealthSocket:      strings.TrimSpace(healthSocket),
+		HealthcheckMaxAge: healthcheckMaxAge,
+		HistorySize:       historySize,
+		LivenessMaxAge:    livenessMaxAge,
+		ReadinessMaxAge:   readinessMaxAge,
+		PanicLimit:        panicLimit,
+
+		HealthUnhealthyAfter: healthUnhealthyAfter,
+		HealthRecoverAfter:   healthRecoverAfter,
+		OfflineGrace:         offlineGrace,
+		StartupWait:          startupWait,
+
+		WatchPaths:    watchPaths,
+		WatchDebounce: watchDebounce,
+
+		TriggerFiles:       triggerFiles,
+		TriggerFilePoll:    triggerFilePoll,
+		TriggerFileConsume: parseBool(getenv("ST_TRIGGER_FILE_CONSUME", "false"), false),
+
+		CompletionRules: completionRules,
+
+		PauseWindows:       pauseWindows,
+		DevicePauseWindows: devicePauseWindows,
+		WatcherOffWindows:  watcherOffWindows,
+		IgnorePaused:       ignorePaused,
+		BandwidthSchedule:  bandwidthSchedule,
+
+		ManageRescanInterval: parseBool(getenv("ST_MANAGE_RESCAN_INTERVAL", "false"), false),
+
+		HookOutputLimit: hookOutputLimit,
+
+		ScanConditionCmd:   strings.TrimSpace(os.Getenv("ST_SCAN_CONDITION_CMD")),
+		FolderConditionCmd: folderConditionCmd,
+		ScanConditionTTL:   scanConditionTTL,
+
+		Instances: instances,
+
+		warnings: warnings,
+	}, nil
+}
+
+func getenv(name, def string) string {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	return v
+}
+
+// loadFolders returns the folders ST_CRON scans: the ST_FOLDERS_FILE lines, if file
+// is set, then the ST_FOLDERS entries, which replace the file's for the same folder
+// (a "!folder" and "folder" count as the same). Without any, it returns "*", with a
+// warning if that is because the file lists nothing.
+func loadFolders(file string) (folders []string, warning string, err error) {
+	env := splitList(os.Getenv("ST_FOLDERS"))
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, "", fmt.Errorf("ST_FOLDERS_FILE: %w", err)
+		}
+		fromFile, err := parseFolderLines(string(data))
+		if err != nil {
+			return nil, "", fmt.Errorf("ST_FOLDERS_FILE %s: %w", file, err)
+		}
+		listed := map[string]bool{}
+		for _, sel := range env {
+			listed[folderSelectorKey(sel)] = true
+		}
+		for _, sel := range fromFile {
+			if !listed[folderSelectorKey(sel)] {
+				folders = append(folders, sel)
+			}
+		}
+		if len(fromFile) == 0 && len(env) == 0 {
+			warning = fmt.Sprintf("ST_FOLDERS_FILE %s lists no folders; scanning * instead", file)
+		}
+	}
+	folders = append(folders, env...)
+	if len(folders) == 0 {
+		return []string{"*"}, warning, nil
+	}
+	return folders, warning, nil
+}
+
+// parseFolderLines reads an ST_FOLDERS_FILE: one entry per line, with comments and
+// line endings as in ST_FOLDER_CRON.
+func parseFolderLines(raw string) ([]string, error) {
+	var out []string
+	for i, line := range configLines(raw) {
+		sel := strings.TrimSpace(stripComment(line))
+		if sel == "" {
+			continue
+		}
+		if strings.ContainsAny(sel, ",;") || strings.IndexFunc(sel, unicode.IsControl) >= 0 || !utf8.ValidString(sel) {
+			return nil, fmt.Errorf("Invalid folder on line %d: %s. Expected one folder per line", i+1, lineExcerpt(line))
+		}
+		out = append(out, sel)
+	}
+	return out, nil
+}
+
+// folderSelectorKey is the folder an ST_FOLDERS entry is about, whether it selects
+// or excludes it.
+func folderSelectorKey(sel string) string {
+	return strings.TrimSpace(strings.TrimPrefix(sel, "!"))
+}
+
+// splitList splits a comma-separated list, dropping empty entries.
+func splitList(raw string) []string {
+	var out []string
+	for _, p := range strings.Split(raw, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func parseNonNegativeInt(name, raw string) (int, error) {
+	v, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	if v < 0 {
+		return 0, fmt.Errorf("%s must be >= 0", name)
+	}
+	return v, nil
+}
+
+func parsePositiveInt(name, raw string) (int, error) {
+	v, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	if v < 1 {
+		return 0, fmt.Errorf("%s must be >= 1", name)
+	}
+	return v, nil
+}
+
+func parseBool(raw string, def bool) bool {
+	s := strings.TrimSpace(strings.ToLower(raw))
+	if s == "" {
+		return def
+	}
+	switch s {
+	case "1", "true", "yes", "on":
+		return true
+	case "0", "false", "no", "off":
+		return false
+	default:
+		return def
+	}
+}
+
+// parseDuration accepts either a Go duration ("5m", "90s") or a bare number of seconds.
+func parseDuration(name, raw string) (time.Duration, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, nil
+	}
+	if v, err := strconv.ParseFloat(raw, 64); err == nil {
+		if v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+			return 0, fmt.Errorf("%s must be >= 0 and not NaN or Inf", name)
+		}
+		return time.Duration(v * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("%s must be >= 0", name)
+	}
+	return d, nil
+}
+
+// folderCronActions are the actions an ST_FOLDER_CRON line can schedule.
+var folderCronActions = []string{actionScan, actionOverride, actionRevert, actionVersionsReport}
+
+// loadFolderCron returns the schedules of every action, keyed by action, from
+// ST_FOLDER_CRON_FILE, if set, and ST_FOLDER_CRON. A folder listed in ST_FOLDER_CRON
+// drops all of its lines from the file.
+func loadFolderCron(file string) (map[string]map[string]string, error) {
+	out, err := parseFolderCronActions(os.Getenv("ST_FOLDER_CRON"))
+	if err != nil || file == "" {
+		return out, err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("ST_FOLDER_CRON_FILE: %w", err)
+	}
+	fromFile, err := parseFolderCronActions(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("ST_FOLDER_CRON_FILE %s: %w", file, err)
+	}
+	listed := map[string]bool{}
+	for _, m := range out {
+		for folder := range m {
+			listed[folder] = true
+		}
+	}
+	for action, m := range fromFile {
+		for folder, expr := range m {
+			if !listed[folder] {
+				out[action][folder] = expr
+			}
+		}
+	}
+	return out, nil
+}
+
+func parseFolderCronActions(raw string) (map[string]map[string]string, error) {
+	out := map[string]map[string]string{}
+	for _, action := range folderCronActions {
+		m, err := parseFolderCronAction(raw, action)
+		if err != nil {
+			return nil, err
+		}
+		out[action] = m
+	}
+	return out, nil
+}
+
+func parseFolderCron(raw string) (map[string]string, error) {
+	return parseFolderCronAction(raw, actionScan)
+}
+
+// parseFolderCronAction returns the ST_FOLDER_CRON schedules of one action. A line's
+// cron expression may be preceded by the action it runs, "scan" by default, and
+// followed by a " # comment". Errors name the 1-based line and quote it.
+func parseFolderCronAction(raw, action string) (map[string]string, error) {
+	return parseFolderCronLines("ST_FOLDER_CRON", raw, action)
+}
+
+// parseFolderSchedules parses a setting in the ST_FOLDER_CRON line format that
+// schedules one thing only, such as ST_PAUSE_CRON: no action goes before the cron
+// expressions, which are checked here as ST_FOLDER_CRON's are at load.
+func parseFolderSchedules(name, raw string) (map[string]string, error) {
+	out, err := parseFolderCronLines(name, raw, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, folder := range slices.Sorted(maps.Keys(out)) {
+		if _, err := cronParser.Parse(out[folder]); err != nil {
+			return nil, fmt.Errorf("invalid %s expr for %s: %w", name, folder, err)
+		}
+	}
+	return out, nil
+}
+
+// parseFolderCronLines reads the "folderId: <cron expr>" lines of setting name,
+// keeping those of action. An empty action allows none before the expression.
+func parseFolderCronLines(name, raw, action string) (map[string]string, error) {
+	expected := "'folderId: [override|revert|versions-report] <cron expr>'"
+	if action == "" {
+		expected = "'folderId: <cron expr>'"
+	}
+	out := map[string]string{}
+	for i, line := range configLines(raw) {
+		n := i + 1
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		folder, expr, ok := strings.Cut(line, ":")
+		folder, expr = strings.TrimSpace(folder), strings.TrimSpace(expr)
+		if !ok || folder == "" || expr == "" {
+			return nil, fmt.Errorf("Invalid %s line %d: %s. Expected 'folderId: <cron expr>'", name, n, lineExcerpt(line))
+		}
+		if !utf8.ValidString(folder) {
+			return nil, fmt.Errorf("Invalid folder ID in %s line %d: %s (not valid UTF-8)", name, n, lineExcerpt(line))
+		}
+		if at := strings.IndexFunc(folder, unicode.IsControl); at >= 0 {
+			r, _ := utf8.DecodeRuneInString(folder[at:])
+			return nil, fmt.Errorf("Invalid folder ID in %s line %d: %s (control character %U)", name, n, lineExcerpt(line), r)
+		}
+		if err := validateFolderID(folder, name); err != nil {
+			return nil, fmt.Errorf("%w line %d: %s", err, n, lineExcerpt(line))
+		}
+		a, rest, err := folderCronValue(expr)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s line %d: %s (%w)", name, n, lineExcerpt(line), err)
+		}
+		if rest == "" || (action == "" && a != actionScan) {
+			return nil, fmt.Errorf("Invalid %s line %d: %s. Expected %s", name, n, lineExcerpt(line), expected)
+		}
+		if a == action || action == "" {
+			out[folder] = rest
+		}
+	}
+	return out, nil
+}
+
+// folderCronValue splits what follows the folder ID on an ST_FOLDER_CRON line into
+// its action and cron expression. An unquoted expression ends at a "#" that follows
+// whitespace; a double-quoted one is taken as written, '#' and outer spaces
+// included, with a backslash escaping the character after it.
+func folderCronValue(value string) (action, expr string, err error) {
+	action, value = folderCronAction(value)
+	if !strings.HasPrefix(value, `"`) {
+		return action, strings.TrimSpace(stripComment(value)), nil
+	}
+	var b strings.Builder
+	for i := 1; i < len(value); i++ {
+		switch c := value[i]; {
+		case c == '\\' && i+1 < len(value):
+			i++
+			b.WriteByte(value[i])
+		case c == '"':
+			if tail := strings.TrimSpace(value[i+1:]); tail != "" && !strings.HasPrefix(tail, "#") {
+				return "", "", errors.New("unexpected text after the closing quote")
+			}
+			return action, b.String(), nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", errors.New("unterminated quote")
+}
+
+// stripComment cuts s at the first '#' that starts it or follows whitespace.
+func stripComment(s string) string {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t') {
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// configLines splits a multi-line setting into lines, dropping a leading UTF-8 BOM
+// and taking "\r\n" and a lone "\r" as line ends too, as files edited on Windows or
+// old Macs and passed in through an env_file have them.
+func configLines(raw string) []string {
+	raw = strings.TrimPrefix(raw, "\ufeff")
+	raw = strings.ReplaceAll(raw, "\r\n", "\n")
+	return strings.Split(strings.ReplaceAll(raw, "\r", "\n"), "\n")
+}
+
+// maxExcerpt is how many characters of an offending line an error quotes.
+const maxExcerpt = 40
+
+// lineExcerpt quotes line for an error message, escaping anything unprintable and
+// shortening it to maxExcerpt characters.
+func lineExcerpt(line string) string {
+	if r := []rune(line); len(r) > maxExcerpt {
+		return strconv.Quote(string(r[:maxExcerpt])) + "..."
+	}
+	return strconv.Quote(line)
+}
+
+// parsePauseWindows parses ST_PAUSE_WINDOWS and ST_WATCHER_OFF_WINDOWS, or
+// ST_DEVICE_PAUSE_WINDOWS with devices for folders: "folderId: HH:MM-HH:MM [days]"
+// lines, where days are names and ranges such as "Mon-Fri" or "Sat,Sun" (every day
+// when left out). A folder may have several lines.
+func parsePauseWindows(name, raw string) (map[string][]PauseWindow, error) {
+	out := map[string][]PauseWindow{}
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		folder, spec, ok := strings.Cut(line, ":")
+		folder, spec = strings.TrimSpace(folder), strings.TrimSpace(spec)
+		if !ok || folder == "" || spec == "" {
+			return nil, fmt.Errorf("Invalid %s line. Expected '<id>: HH:MM-HH:MM [days]'", name)
+		}
+		if name != "ST_DEVICE_PAUSE_WINDOWS" {
+			if err := validateFolderID(folder, name); err != nil {
+				return nil, err
+			}
+		}
+		w, err := parsePauseWindow(spec)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s window %q for %s: %w", name, spec, folder, err)
+		}
+		out[folder] = append(out[folder], w)
+	}
+	return out, nil
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func parsePauseWindow(spec string) (PauseWindow, error) {
+	w := PauseWindow{Spec: spec}
+	fields := strings.Fields(spec)
+	if len(fields) > 2 {
+		return w, errors.New("expected 'HH:MM-HH:MM [days]'")
+	}
+	from, to, ok := strings.Cut(fields[0], "-")
+	if !ok {
+		return w, errors.New("expected 'HH:MM-HH:MM [days]'")
+	}
+	var err error
+	if w.Start, err = parseClock(from); err != nil {
+		return w, err
+	}
+	if w.End, err = parseClock(to); err != nil {
+		return w, err
+	}
+	if w.Start == w.End {
+		return w, errors.New("window is empty")
+	}
+	if len(fields) == 1 {
+		for d := range w.Days {
+			w.Days[d] = true
+		}
+		return w, nil
+	}
+	for _, part := range strings.Split(fields[1], ",") {
+		first, last, isRange := strings.Cut(strings.ToLower(part), "-")
+		if !isRange {
+			last = first
+		}
+		a, okFirst := weekdayNames[first]
+		b, okLast := weekdayNames[last]
+		if !okFirst || !okLast {
+			return w, fmt.Errorf("unknown day %q (expected Mon, Tue, ... or a range such as Mon-Fri)", part)
+		}
+		for d := a; ; d = (d + 1) % 7 {
+			w.Days[d] = true
+			if d == b {
+				break
+			}
+		}
+	}
+	return w, nil
+}
+
+// parseClock parses "HH:MM" into minutes since midnight.
+func parseClock(raw string) (int, error) {
+	t, err := time.Parse("15:04", raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q (expected HH:MM)", raw)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// parseBandwidthSchedule parses ST_BANDWIDTH_SCHEDULE: "<cron expr> = <send>/<recv>"
+// lines, with the limits in KiB/s and 0 for unlimited. Cron expressions are
+// checked when the scheduler is built.
+func parseBandwidthSchedule(raw string) ([]BandwidthRule, error) {
+	var out []BandwidthRule
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		expr, limits, ok := strings.Cut(line, "=")
+		send, recv, okLimits := strings.Cut(limits, "/")
+		expr = strings.TrimSpace(expr)
+		if !ok || !okLimits || expr == "" {
+			return nil, errors.New("Invalid ST_BANDWIDTH_SCHEDULE line. Expected '<cron expr> = <send>/<recv>'")
+		}
+		rule := BandwidthRule{Cron: expr}
+		var err error
+		if rule.SendKbps, err = parseNonNegativeInt("ST_BANDWIDTH_SCHEDULE send limit", send); err != nil {
+			return nil, err
+		}
+		if rule.RecvKbps, err = parseNonNegativeInt("ST_BANDWIDTH_SCHEDULE receive limit", recv); err != nil {
+			return nil, err
+		}
+		out = append(out, rule)
+	}
+	return out, nil
+}
+
+// parseDevicePatterns parses ST_AUTO_ACCEPT_DEVICES: entries separated by commas or
+// newlines, each a device ID or the start of one (at least its first group of seven
+// characters), optionally as "name:<glob>@<id>" to also require the name the device
+// announces to match the glob.
+func parseDevicePatterns(raw string) ([]DevicePattern, error) {
+	var out []DevicePattern
+	for _, entry := range strings.FieldsFunc(raw, func(r rune) bool { return r == ',' || r == '\n' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		invalid := fmt.Errorf("Invalid ST_AUTO_ACCEPT_DEVICES entry %q. Expected a device ID, its first 7 or more characters, or 'name:<glob>@<id>'", entry)
+		var p DevicePattern
+		id := entry
+		if rest, ok := strings.CutPrefix(entry, "name:"); ok {
+			glob, prefix, ok := strings.Cut(rest, "@")
+			if !ok {
+				return nil, fmt.Errorf("Invalid ST_AUTO_ACCEPT_DEVICES entry %q. A device name can be announced by anyone: use 'name:<glob>@<id>' to also require a device ID or its first 7 or more characters", entry)
+			}
+			p.Name, id = strings.TrimSpace(glob), prefix
+			if _, err := path.Match(p.Name, ""); err != nil || p.Name == "" {
+				return nil, invalid
+			}
+		}
+		p.ID = strings.ToUpper(strings.TrimSpace(id))
+		if len(p.ID) < 7 || strings.Trim(p.ID, "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567-") != "" {
+			return nil, invalid
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// parseFolderAcceptRules parses ST_AUTO_ACCEPT_FOLDERS: "<glob> = <path template>"
+// lines, the glob matching a folder's ID or label and the path a Go text/template.
+func parseFolderAcceptRules(raw string) ([]FolderAcceptRule, error) {
+	var out []FolderAcceptRule
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		glob, tmpl, ok := strings.Cut(line, "=")
+		glob, tmpl = strings.TrimSpace(glob), strings.TrimSpace(tmpl)
+		if !ok || glob == "" || tmpl == "" {
+			return nil, errors.New("Invalid ST_AUTO_ACCEPT_FOLDERS line. Expected '<folder id or label glob> = <path template>'")
+		}
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid ST_AUTO_ACCEPT_FOLDERS pattern %q: %w", glob, err)
+		}
+		t, err := template.New(glob).Option("missingkey=error").Parse(tmpl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ST_AUTO_ACCEPT_FOLDERS path template for %q: %w", glob, err)
+		}
+		out = append(out, FolderAcceptRule{Pattern: glob, PathTemplate: tmpl, path: t})
+	}
+	return out, nil
+}
+
+// parseScanNext parses ST_SCAN_NEXT: a duration for every folder and/or
+// "folderId: <duration>" lines overriding it for single folders.
+func parseScanNext(raw string) (time.Duration, map[string]time.Duration, error) {
+	var global time.Duration
+	out := map[string]time.Duration{}
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		folder, value, ok := strings.Cut(line, ":")
+		if !ok {
+			d, err := parseDuration("ST_SCAN_NEXT", line)
+			if err != nil {
+				return 0, nil, err
+			}
+			global = d
+			continue
+		}
+		folder = strings.TrimSpace(folder)
+		if folder == "" || strings.TrimSpace(value) == "" {
+			return 0, nil, errors.New("Invalid ST_SCAN_NEXT line. Expected '<duration>' or 'folderId: <duration>'")
+		}
+		if err := validateFolderID(folder, "ST_SCAN_NEXT"); err != nil {
+			return 0, nil, err
+		}
+		d, err := parseDuration("ST_SCAN_NEXT for folder "+folder, value)
+		if err != nil {
+			return 0, nil, err
+		}
+		out[folder] = d
+	}
+	return global, out, nil
+}
+
+// parseFolderPriority parses ST_FOLDER_PRIORITY: folder IDs, optionally prefixed
+// with an instance, and at most one "*", each listed once. Whether the folders
+// exist is checked against Syncthing at startup.
+func parseFolderPriority(raw string) ([]string, error) {
+	entries := splitList(raw)
+	seen := map[string]bool{}
+	for _, e := range entries {
+		if e != "*" {
+			if strings.ContainsAny(e, "*!") {
+				return nil, fmt.Errorf("invalid ST_FOLDER_PRIORITY entry %q (expected a folder ID or *)", e)
+			}
+			if err := validateFolderID(e, "ST_FOLDER_PRIORITY"); err != nil {
+				return nil, err
+			}
+		}
+		key := strings.TrimPrefix(e, defaultInstance+"/")
+		if seen[key] {
+			return nil, fmt.Errorf("ST_FOLDER_PRIORITY lists %q more than once", e)
+		}
+		seen[key] = true
+	}
+	return entries, nil
+}
+
+// parseIgnorePaused parses ST_IGNORE_PAUSED: folder IDs, optionally prefixed with
+// an instance, or "*" for all of them.
+func parseIgnorePaused(raw string) ([]string, error) {
+	entries := splitList(raw)
+	for _, e := range entries {
+		if e == "*" {
+			continue
+		}
+		if strings.ContainsAny(e, "*!") {
+			return nil, fmt.Errorf("invalid ST_IGNORE_PAUSED entry %q (expected a folder ID or *)", e)
+		}
+		if err := validateFolderID(e, "ST_IGNORE_PAUSED"); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+func validateFolderID(folder, source string) error {
+	// Syncthing folder IDs are generally simple slugs; reject whitespace and separators
+	// that are likely user mistakes or unsafe to pass around.
+	if strings.ContainsAny(folder, " \t\r\n,;") {
+		return fmt.Errorf("Invalid folder ID in %s", source)
+	}
+	if strings.Contains(folder, ":") {
+		return fmt.Errorf("Invalid folder ID in %s", source)
+	}
+	return nil
+}
+
+func parseFolderSubpaths(raw string) (map[string][]string, error) {
+	out := map[string][]string{}
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("Invalid ST_FOLDER_SUBPATHS line. Expected 'folderId: sub1, sub2, ...'")
+		}
+		folder := strings.TrimSpace(parts[0])
+		if folder == "" {
+			return nil, errors.New("Invalid ST_FOLDER_SUBPATHS line. Expected 'folderId: sub1, sub2, ...'")
+		}
+		if err := validateFolderID(folder, "ST_FOLDER_SUBPATHS"); err != nil {
+			return nil, err
+		}
+		var subs []string
+		for _, sub := range strings.Split(parts[1], ",") {
+			sub = strings.Trim(strings.TrimSpace(sub), "/")
+			if sub == "" {
+				continue
+			}
+			if sub == ".." || strings.HasPrefix(sub, "../") || strings.Contains(sub, "/../") || strings.HasSuffix(sub, "/..") {
+				return nil, fmt.Errorf("Invalid sub-path %q for folder %s in ST_FOLDER_SUBPATHS", sub, folder)
+			}
+			subs = append(subs, sub)
+		}
+		if len(subs) == 0 {
+			return nil, fmt.Errorf("No sub-paths listed for folder %s in ST_FOLDER_SUBPATHS", folder)
+		}
+		out[folder] = subs
+	}
+	return out, nil
+}
+
+// parseFolderCommands parses "folderId: <shell command>" lines. The command is
+// everything after the first colon.
+func parseFolderCommands(name, raw string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		folder, command, ok := strings.Cut(line, ":")
+		folder, command = strings.TrimSpace(folder), strings.TrimSpace(command)
+		if !ok || folder == "" || command == "" {
+			return nil, fmt.Errorf("Invalid %s line. Expected 'folderId: <command>'", name)
+		}
+		if err := validateFolderID(folder, name); err != nil {
+			return nil, err
+		}
+		out[folder] = command
+	}
+	return out, nil
+}
+
+// parseFolderPaths parses "folderId: /local/path" lines.
+func parseFolderPaths(name, raw string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid %s line. Expected 'folderId: /path'", name)
+		}
+		folder := strings.TrimSpace(parts[0])
+		p := strings.TrimSpace(parts[1])
+		if folder == "" || p == "" {
+			return nil, fmt.Errorf("Invalid %s line. Expected 'folderId: /path'", name)
+		}
+		if err := validateFolderID(folder, name); err != nil {
+			return nil, err
+		}
+		out[folder] = filepath.Clean(p)
+	}
+	return out, nil
+}
+
+// parseInstances parses "name = url key=... [fallback=url]" entries separated by newlines or ';'.
+func parseInstances(raw string) ([]InstanceSettings, error) {
+	var out []InstanceSettings
+	seen := map[string]bool{}
+	for _, line := range strings.FieldsFunc(raw, func(r rune) bool { return r == '\n' || r == ';' }) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("Invalid ST_INSTANCES line. Expected 'name = url key=apikey'")
+		}
+		name := strings.TrimSpace(parts[0])
+		fields := strings.Fields(parts[1])
+		if name == "" || len(fields) == 0 {
+			return nil, errors.New("Invalid ST_INSTANCES line. Expected 'name = url key=apikey'")
+		}
+		if strings.ContainsAny(name, " \t/,:*") {
+			return nil, fmt.Errorf("Invalid instance name %q in ST_INSTANCES", name)
+		}
+		if name == defaultInstance {
+			return nil, fmt.Errorf("ST_INSTANCES: %q is reserved for ST_API_URL", defaultInstance)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("ST_INSTANCES: duplicate instance %q", name)
+		}
+		seen[name] = true
+
+		inst := InstanceSettings{Name: name, APIURL: strings.TrimRight(fields[0], "/") + "/"}
+		for _, opt := range fields[1:] {
+			k, v, _ := strings.Cut(opt, "=")
+			switch k {
+			case "key":
+				inst.APIKey = v
+			case "fallback":
+				inst.FallbackURL = strings.TrimRight(v, "/") + "/"
+			default:
+				return nil, fmt.Errorf("ST_INSTANCES: unknown option %q for instance %s", opt, name)
+			}
+		}
+		if inst.APIKey == "" {
+			return nil, fmt.Errorf("ST_INSTANCES: instance %s needs key=<api key>", name)
+		}
+		out = append(out, inst)
+	}
+	return out, nil
+}
+
+// parseNotifySinks parses "name = type url [timeout=10s]" entries separated by ';' or
+// newlines. Each ST_NOTIFY_WEBHOOK URL adds a webhook sink named "webhook" (then
+// "webhook-2", ...).
+func parseNotifySinks(raw string, webhooks []string) ([]NotifySinkSettings, error) {
+	var out []NotifySinkSettings
+	seen := map[string]bool{}
+	add := func(sink NotifySinkSettings) error {
+		if seen[sink.Name] {
+			return fmt.Errorf("ST_NOTIFY_SINKS: duplicate sink %q", sink.Name)
+		}
+		seen[sink.Name] = true
+		out = append(out, sink)
+		return nil
+	}
+	for i, u := range webhooks {
+		name := "webhook"
+		if i > 0 {
+			name = fmt.Sprintf("webhook-%d", i+1)
+		}
+		if err := add(NotifySinkSettings{Name: name, Type: "webhook", URL: u}); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, line := range strings.FieldsFunc(raw, func(r rune) bool { return r == '\n' || r == ';' }) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, rest, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		fields := strings.Fields(rest)
+		if !ok || name == "" || len(fields) < 2 {
+			return nil, errors.New("Invalid ST_NOTIFY_SINKS line. Expected 'name = type url'")
+		}
+		if strings.ContainsAny(name, " \t,*") || name == "-" {
+			return nil, fmt.Errorf("Invalid sink name %q in ST_NOTIFY_SINKS", name)
+		}
+		sink := NotifySinkSettings{Name: name, Type: strings.ToLower(fields[0]), URL: fields[1]}
+		if !slices.Contains(notifierTypes, sink.Type) {
+			return nil, fmt.Errorf("ST_NOTIFY_SINKS: unknown sink type %q for %s (expected one of %s)", fields[0], name, strings.Join(notifierTypes, ", "))
+		}
+		for _, opt := range fields[2:] {
+			k, v, _ := strings.Cut(opt, "=")
+			switch k {
+			case "timeout":
+				d, err := parseDuration("ST_NOTIFY_SINKS timeout", v)
+				if err != nil {
+					return nil, err
+				}
+				sink.Timeout = d
+			case "channel", "username":
+				if sink.Type != "slack" || v == "" {
+					return nil, fmt.Errorf("ST_NOTIFY_SINKS: option %q only applies to slack sinks", opt)
+				}
+				if k == "channel" {
+					sink.Channel = v
+				} else {
+					sink.Username = v
+				}
+			default:
+				return nil, fmt.Errorf("ST_NOTIFY_SINKS: unknown option %q for sink %s", opt, name)
+			}
+		}
+		if sink.Type == "syslog" {
+			if _, _, err := syslogAddr(sink.URL); err != nil {
+				return nil, fmt.Errorf("ST_NOTIFY_SINKS: %s: %w", name, err)
+			}
+		}
+		if err := add(sink); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func sinkNames(sinks []NotifySinkSettings) []string {
+	out := make([]string, 0, len(sinks))
+	for _, s := range sinks {
+		out = append(out, s.Name)
+	}
+	return out
+}
+
+// parseNotifyRoutes parses "event,event -> sink,sink" rules separated by ';' or
+// newlines. An event may carry a folder filter, "scan_failed[finance,docs]" or
+// "scan_failed[!scratch]"; events of one rule with different filters become
+// separate routes. Unknown event types and sinks are rejected.
+func parseNotifyRoutes(raw string, sinks []NotifySinkSettings) ([]NotifyRoute, error) {
+	known := map[string]bool{}
+	for _, s := range sinks {
+		known[s.Name] = true
+	}
+	var out []NotifyRoute
+	for _, line := range strings.FieldsFunc(raw, func(r rune) bool { return r == '\n' || r == ';' }) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lhs, rhs, ok := strings.Cut(line, "->")
+		events, sinks := splitRouteEvents(lhs), splitList(rhs)
+		if !ok || len(events) == 0 || len(sinks) == 0 {
+			return nil, errors.New("Invalid ST_NOTIFY_ROUTES rule. Expected 'event,event -> sink,sink'")
+		}
+		for _, sink := range sinks {
+			if !known[sink] {
+				return nil, fmt.Errorf("ST_NOTIFY_ROUTES: unknown sink %q", sink)
+			}
+		}
+		var routes []NotifyRoute
+		for _, token := range events {
+			ev, folders, exclude, err := parseRouteEvent(token)
+			if err != nil {
+				return nil, err
+			}
+			if ev != "*" && !slices.Contains(notifyEventTypes, ev) {
+				return nil, fmt.Errorf("ST_NOTIFY_ROUTES: unknown event %q (expected * or one of %s)", ev, strings.Join(notifyEventTypes, ", "))
+			}
+			i := slices.IndexFunc(routes, func(r NotifyRoute) bool {
+				return r.ExcludeFolders == exclude && slices.Equal(r.Folders, folders)
+			})
+			if i < 0 {
+				routes = append(routes, NotifyRoute{Sinks: sinks, Folders: folders, ExcludeFolders: exclude})
+				i = len(routes) - 1
+			}
+			routes[i].Events = append(routes[i].Events, ev)
+		}
+		out = append(out, routes...)
+	}
+	return out, nil
+}
+
+// splitRouteEvents splits the event side of a routing rule on commas outside
+// folder filters.
+func splitRouteEvents(raw string) []string {
+	var out []string
+	depth, start := 0, 0
+	flush := func(end int) {
+		if tok := strings.TrimSpace(raw[start:end]); tok != "" {
+			out = append(out, tok)
+		}
+	}
+	for i, r := range raw {
+		switch r {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				flush(i)
+				start = i + 1
+			}
+		}
+	}
+	flush(len(raw))
+	return out
+}
+
+// parseRouteEvent splits "event[folder,...]" or "event[!folder,...]" into the event
+// and its folder filter.
+func parseRouteEvent(token string) (event string, folders []string, exclude bool, err error) {
+	event, filter, ok := strings.Cut(token, "[")
+	event = strings.TrimSpace(event)
+	if !ok {
+		return event, nil, false, nil
+	}
+	filter, rest, closed := strings.Cut(filter, "]")
+	if !closed || strings.TrimSpace(rest) != "" {
+		return "", nil, false, fmt.Errorf("ST_NOTIFY_ROUTES: invalid folder filter in %q (expected event[folder,...] or event[!folder,...])", token)
+	}
+	negated := 0
+	for _, f := range strings.Split(filter, ",") {
+		f = strings.TrimSpace(f)
+		if strings.HasPrefix(f, "!") {
+			negated++
+			f = strings.TrimSpace(f[1:])
+		}
+		if f == "" {
+			return "", nil, false, fmt.Errorf("ST_NOTIFY_ROUTES: empty folder in filter %q", token)
+		}
+		folders = append(folders, f)
+	}
+	// "[!a,b]" excludes both; "[a,!b]" is ambiguous.
+	exclude = strings.HasPrefix(strings.TrimSpace(filter), "!")
+	if negated > 0 && !exclude {
+		return "", nil, false, fmt.Errorf("ST_NOTIFY_ROUTES: filter %q mixes included and excluded folders", token)
+	}
+	return event, folders, exclude, nil
+}
+
+// parseCompletionRules parses "source -> target" rules separated by newlines or ';'.
+// Chains (a target that is itself a source) are refused to avoid trigger loops.
+func parseCompletionRules(raw string) (map[string][]string, error) {
+	out := map[string][]string{}
+	targets := map[string]bool{}
+	for _, line := range strings.FieldsFunc(raw, func(r rune) bool { return r == '\n' || r == ';' }) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "->", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("Invalid ST_ON_FOLDER_COMPLETION rule. Expected 'source -> target'")
+		}
+		source := strings.TrimSpace(parts[0])
+		target := strings.TrimSpace(parts[1])
+		if source == "" || target == "" {
+			return nil, errors.New("Invalid ST_ON_FOLDER_COMPLETION rule. Expected 'source -> target'")
+		}
+		for _, id := range []string{source, target} {
+			if err := validateFolderID(id, "ST_ON_FOLDER_COMPLETION"); err != nil {
+				return nil, err
+			}
+		}
+		if source == target {
+			return nil, fmt.Errorf("ST_ON_FOLDER_COMPLETION rule %q targets its own source", line)
+		}
+		out[source] = append(out[source], target)
+		targets[target] = true
+	}
+	for source := range out {
+		if targets[source] {
+			return nil, fmt.Errorf("ST_ON_FOLDER_COMPLETION chains through %q; only single-hop rules are allowed", source)
+		}
+	}
+	return out, nil
+}
+
+// parseNotifySeverity parses ST_NOTIFY_SEVERITY: "event: severity" entries,
+// separated by commas or newlines.
+func parseNotifySeverity(raw string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, entry := range strings.FieldsFunc(raw, func(r rune) bool { return r == ',' || r == '\n' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		ev, sev, ok := strings.Cut(entry, ":")
+		ev, sev = strings.TrimSpace(ev), strings.ToLower(strings.TrimSpace(sev))
+		if !ok || ev == "" || sev == "" {
+			return nil, fmt.Errorf("Invalid ST_NOTIFY_SEVERITY entry %q. Expected 'event: severity'", entry)
+		}
+		if !slices.Contains(notifyEventTypes, ev) {
+			return nil, fmt.Errorf("ST_NOTIFY_SEVERITY: unknown event %q (expected one of %s)", ev, strings.Join(notifyEventTypes, ", "))
+		}
+		if !slices.Contains(severityLevels, sev) {
+			return nil, fmt.Errorf("ST_NOTIFY_SEVERITY: invalid severity %q for %s (expected one of %s)", sev, ev, strings.Join(severityLevels, ", "))
+		}
+		out[ev] = sev
+	}
+	return out, nil
+}
+
+// parseCheckStateSeverity parses ST_CHECK_STATE_SEVERITY: "state: severity" entries,
+// separated by commas or newlines, where severity is ok, warning or critical.
+func parseCheckStateSeverity(raw string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, entry := range strings.FieldsFunc(raw, func(r rune) bool { return r == ',' || r == '\n' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		state, sev, ok := strings.Cut(entry, ":")
+		state, sev = strings.ToLower(strings.TrimSpace(state)), strings.ToLower(strings.TrimSpace(sev))
+		if !ok || state == "" || sev == "" {
+			return nil, fmt.Errorf("Invalid ST_CHECK_STATE_SEVERITY entry %q. Expected 'state: severity'", entry)
+		}
+		if !slices.Contains(checkStates, state) {
+			return nil, fmt.Errorf("ST_CHECK_STATE_SEVERITY: unknown state %q (expected one of %s)", state, strings.Join(checkStates, ", "))
+		}
+		if !slices.Contains(checkSeverityLevels, sev) {
+			return nil, fmt.Errorf("ST_CHECK_STATE_SEVERITY: invalid severity %q for %s (expected one of %s)", sev, state, strings.Join(checkSeverityLevels, ", "))
+		}
+		out[state] = sev
+	}
+	return out, nil
 }
@@ -1,9 +1,15 @@
 package app
 
 import (
+	"fmt"
+	"io"
+	"log"
+	"maps"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseFolderCron(t *testing.T) {
@@ -79,6 +85,92 @@ func TestLoadSettingsDefaults(t *testing.T) {
 	}
 }
 
+func TestLoadFoldersMergesFileAndEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "folders")
+	if err := os.WriteFile(path, []byte("\ufeff# shared with the backup job\r\nnas/*\r\n!nas/tmp # scratch\r\ndocs\r\n\r\nphotos\r\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		env, want string
+	}{
+		{"", "nas/*,!nas/tmp,docs,photos"},
+		{"music, nas/tmp", "nas/*,docs,photos,music,nas/tmp"}, // the env entry replaces the file's exclusion
+		{"!photos", "nas/*,!nas/tmp,docs,!photos"},
+	}
+	for _, tc := range cases {
+		os.Clearenv()
+		os.Setenv("ST_API_KEY", "abc123")
+		os.Setenv("ST_CRON", "*/5 * * * *")
+		os.Setenv("ST_FOLDERS_FILE", path)
+		os.Setenv("ST_FOLDERS", tc.env)
+		st, err := LoadSettingsFromEnv()
+		if err != nil {
+			t.Fatalf("ST_FOLDERS=%q: unexpected error: %v", tc.env, err)
+		}
+		if got := strings.Join(st.Folders, ","); got != tc.want || len(st.Warnings()) != 0 {
+			t.Fatalf("ST_FOLDERS=%q: folders = %q (warnings %v), want %q", tc.env, got, st.Warnings(), tc.want)
+		}
+	}
+
+	os.Setenv("ST_FOLDERS_FILE", path+".missing")
+	if _, err := LoadSettingsFromEnv(); err == nil || !strings.Contains(err.Error(), path+".missing") {
+		t.Fatalf("expected the missing path in the error, got %v", err)
+	}
+	if err := os.WriteFile(path, []byte("docs\nmedia, music\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("ST_FOLDERS_FILE", path)
+	if _, err := LoadSettingsFromEnv(); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("expected the bad line named, got %v", err)
+	}
+}
+
+func TestLoadFoldersEmptyFileScansEverything(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "folders")
+	if err := os.WriteFile(path, []byte("# nothing yet\n\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	os.Clearenv()
+	os.Setenv("ST_API_KEY", "abc123")
+	os.Setenv("ST_CRON", "*/5 * * * *")
+	os.Setenv("ST_FOLDERS_FILE", path)
+	st, err := LoadSettingsFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(st.Folders, ",") != "*" || len(st.Warnings()) != 1 || !strings.Contains(st.Warnings()[0], "lists no folders") {
+		t.Fatalf("expected * with a warning, got %v, %v", st.Folders, st.Warnings())
+	}
+
+	// Without a file an unset ST_FOLDERS means * too, quietly.
+	os.Unsetenv("ST_FOLDERS_FILE")
+	if st, err = LoadSettingsFromEnv(); err != nil || strings.Join(st.Folders, ",") != "*" || len(st.Warnings()) != 0 {
+		t.Fatalf("unexpected default: %v, %v, %v", st.Folders, st.Warnings(), err)
+	}
+}
+
+func TestReloadFoldersRereadsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "folders")
+	if err := os.WriteFile(path, []byte("docs\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	os.Clearenv()
+	svc := &Service{Settings: Settings{Folders: []string{"docs"}, FoldersFile: path}, Logger: log.New(io.Discard, "", 0)}
+
+	if err := os.WriteFile(path, []byte("docs\nphotos\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.ReloadFolders(); err != nil || strings.Join(svc.Folders(), ",") != "docs,photos" {
+		t.Fatalf("unexpected reload: %v, %v", svc.Folders(), err)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.ReloadFolders(); err == nil || strings.Join(svc.Folders(), ",") != "docs,photos" {
+		t.Fatalf("expected a failed reload to keep the folders, got %v, %v", svc.Folders(), err)
+	}
+}
+
 func TestLoadSettingsRejectsInvalidStatusDelay(t *testing.T) {
 	os.Clearenv()
 	os.Setenv("ST_API_KEY", "abc123")
@@ -306,6 +398,126 @@ func TestParseFolderCronAcceptsSpecialCharacters(t *testing.T) {
 	}
 }
 
+// Test parseFolderCron with a file edited on Windows: BOM and CRLF line endings
+func TestParseFolderCronAcceptsBOMAndCRLF(t *testing.T) {
+	for _, input := range []string{
+		"\ufefffolderA: */5 * * * *\r\nfolderB: 0 0 * * 1\r\n",
+		"\ufefffolderA: */5 * * * *\rfolderB: 0 0 * * 1\r",
+	} {
+		got, err := parseFolderCron(input)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", input, err)
+		}
+		if len(got) != 2 || got["folderA"] != "*/5 * * * *" || got["folderB"] != "0 0 * * 1" {
+			t.Fatalf("unexpected result for %q: %#v", input, got)
+		}
+	}
+}
+
+// Test parseFolderCron errors name the line and quote it safely
+func TestParseFolderCronErrorsNameTheLine(t *testing.T) {
+	cases := []struct{ input, want string }{
+		{"folderA: */5 * * * *\r\nfolder\x07B: 0 0 * * *", `Invalid folder ID in ST_FOLDER_CRON line 2: "folder\aB: 0 0 * * *" (control character U+0007)`},
+		{"# schedules\n\nfolder\xffB: 0 0 * * *", `Invalid folder ID in ST_FOLDER_CRON line 3: "folder\xffB: 0 0 * * *" (not valid UTF-8)`},
+		{"folderA: */5 * * * *\rfolder A: 0 0 * * *", `Invalid folder ID in ST_FOLDER_CRON line 2: "folder A: 0 0 * * *"`},
+		{"folderA */5 * * * * and a long tail of text after it", `Invalid ST_FOLDER_CRON line 1: "folderA */5 * * * * and a long tail of t".... Expected 'folderId: <cron expr>'`},
+		{"\n\noutbox: override", `Invalid ST_FOLDER_CRON line 3: "outbox: override". Expected 'folderId: [override|revert|versions-report] <cron expr>'`},
+	}
+	for _, tc := range cases {
+		_, err := parseFolderCron(tc.input)
+		if err == nil || err.Error() != tc.want {
+			t.Fatalf("parseFolderCron(%q) error = %v, want %s", tc.input, err, tc.want)
+		}
+	}
+}
+
+// Test parseFolderCron with trailing comments and quoted expressions
+func TestParseFolderCronCommentsAndQuotes(t *testing.T) {
+	cases := []struct{ input, want string }{
+		{"folderA: 0 4 * * * # nightly", "0 4 * * *"},
+		{"folderA: 0 4 * * *\t# nightly", "0 4 * * *"},
+		{"folderA: 0 4 * * 6#3", "0 4 * * 6#3"}, // no whitespace before '#': not a comment
+		{`folderA: "0 4 * * *"`, "0 4 * * *"},
+		{`folderA: "0 4 * * *" # nightly`, "0 4 * * *"},
+		{`folderA: "0 4 # * * *"`, "0 4 # * * *"},
+		{`folderA: "  0 4 * * *  "`, "  0 4 * * *  "},
+		{`folderA: "0 4 \"*\" * *"`, `0 4 "*" * *`},
+		{`folderA: "0 4 \\ * *"`, `0 4 \ * *`},
+		{`folderA: scan "override 0 4 * * *"`, "override 0 4 * * *"},
+		{`folderA: "#x"`, "#x"},
+	}
+	for _, tc := range cases {
+		got, err := parseFolderCron("# schedules\n" + tc.input + "\n")
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.input, err)
+		}
+		if got["folderA"] != tc.want {
+			t.Fatalf("parseFolderCron(%q) = %q, want %q", tc.input, got["folderA"], tc.want)
+		}
+	}
+
+	overrides, err := parseFolderCronAction(`outbox: override "0 4 * * *" # weekly`, actionOverride)
+	if err != nil || overrides["outbox"] != "0 4 * * *" {
+		t.Fatalf("unexpected quoted override: %#v, %v", overrides, err)
+	}
+}
+
+// Test parseFolderCron rejects broken quoting and comment-only expressions
+func TestParseFolderCronRejectsBadQuotes(t *testing.T) {
+	cases := []struct{ input, want string }{
+		{"folderA: */5 * * * *\nfolderB: \"0 4 * * *", `Invalid ST_FOLDER_CRON line 2: "folderB: \"0 4 * * *" (unterminated quote)`},
+		{`folderA: "0 4 * * *\"`, `Invalid ST_FOLDER_CRON line 1: "folderA: \"0 4 * * *\\\"" (unterminated quote)`},
+		{`folderA: "0 4" * * *`, `Invalid ST_FOLDER_CRON line 1: "folderA: \"0 4\" * * *" (unexpected text after the closing quote)`},
+		{"folderA: # nightly", `Invalid ST_FOLDER_CRON line 1: "folderA: # nightly". Expected 'folderId: [override|revert|versions-report] <cron expr>'`},
+		{`folderA: ""`, `Invalid ST_FOLDER_CRON line 1: "folderA: \"\"". Expected 'folderId: [override|revert|versions-report] <cron expr>'`},
+		{"outbox: override # weekly", `Invalid ST_FOLDER_CRON line 1: "outbox: override # weekly". Expected 'folderId: [override|revert|versions-report] <cron expr>'`},
+	}
+	for _, tc := range cases {
+		_, err := parseFolderCron(tc.input)
+		if err == nil || err.Error() != tc.want {
+			t.Fatalf("parseFolderCron(%q) error = %v, want %s", tc.input, err, tc.want)
+		}
+	}
+}
+
+// cronQuoter escapes an expression for a double-quoted ST_FOLDER_CRON value.
+var cronQuoter = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// FuzzParseFolderCron checks parseFolderCron never panics and that accepted entries
+// parse back to the same schedules.
+func FuzzParseFolderCron(f *testing.F) {
+	for _, seed := range []string{
+		"folderA: */5 * * * *\nfolderB: 0 0 * * 1\n",
+		"\ufefffolderA: */5 * * * *\r\n# comment\r\n",
+		"outbox: override 0 4 * * *\rinbox: scan 30 4 * * *",
+		"folder:A: */5 * * * *",
+		"folder\x00A: * * * * *",
+		"\xff\xfe: \x85",
+		"folderA: 0 4 * * * # nightly\noutbox: override \"0 4 * * *\" # weekly",
+		"folderA: \" 0 4 # \\\"x\\\\ \"",
+		"folderA: \"0 4 * * *",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, raw string) {
+		got, err := parseFolderCron(raw)
+		if err != nil {
+			return
+		}
+		var b strings.Builder
+		for folder, expr := range got {
+			fmt.Fprintf(&b, "%s: scan \"%s\"\n", folder, cronQuoter.Replace(expr))
+		}
+		again, err := parseFolderCron(b.String())
+		if err != nil {
+			t.Fatalf("accepted entries %#v do not parse back: %v", got, err)
+		}
+		if !maps.Equal(got, again) {
+			t.Fatalf("round trip changed %#v into %#v", got, again)
+		}
+	})
+}
+
 // Test LoadSettingsFromEnv with empty API URL (uses default)
 func TestLoadSettingsUsesDefaultForEmptyAPIURL(t *testing.T) {
 	os.Clearenv()
@@ -558,3 +770,377 @@ func TestLoadSettingsCronTZOverridesTZ(t *testing.T) {
 		t.Fatalf("expected CRON_TZ to override TZ, got: %q", st.CronTimezone)
 	}
 }
+
+func TestLoadSettingsDeferWhileSyncing(t *testing.T) {
+	os.Clearenv()
+	os.Setenv("ST_API_KEY", "abc123")
+	os.Setenv("ST_CRON", "*/5 * * * *")
+	st, err := LoadSettingsFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if st.DeferWhileSyncing != "off" || st.DeferTimeoutAction != "proceed" || st.DeferMax != 30*time.Minute {
+		t.Fatalf("unexpected defaults: %+v", st)
+	}
+
+	os.Setenv("ST_DEFER_WHILE_SYNCING", "Wait")
+	os.Setenv("ST_DEFER_MAX", "10m")
+	os.Setenv("ST_DEFER_TIMEOUT_ACTION", "skip")
+	st, err = LoadSettingsFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if st.DeferWhileSyncing != "wait" || st.DeferMax != 10*time.Minute || st.DeferTimeoutAction != "skip" {
+		t.Fatalf("unexpected values: %+v", st)
+	}
+}
+
+func TestLoadSettingsRejectsInvalidDeferMode(t *testing.T) {
+	os.Clearenv()
+	os.Setenv("ST_API_KEY", "abc123")
+	os.Setenv("ST_CRON", "*/5 * * * *")
+	os.Setenv("ST_DEFER_WHILE_SYNCING", "sometimes")
+	if _, err := LoadSettingsFromEnv(); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestParseFolderSubpaths(t *testing.T) {
+	got, err := parseFolderSubpaths("media: movies, /tv/ , music\n# comment\nphotos: 2024\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(got["media"], "|") != "movies|tv|music" {
+		t.Fatalf("media sub-paths mismatch: %q", got["media"])
+	}
+	if strings.Join(got["photos"], "|") != "2024" {
+		t.Fatalf("photos sub-paths mismatch: %q", got["photos"])
+	}
+}
+
+func TestParseFolderSubpathsRejectsInvalidEntries(t *testing.T) {
+	for _, raw := range []string{
+		"media movies",
+		"media: ",
+		"media: ../etc",
+		"media: a/../../b",
+		"bad id: a",
+	} {
+		if _, err := parseFolderSubpaths(raw); err == nil {
+			t.Fatalf("expected error for %q", raw)
+		}
+	}
+}
+
+func TestParseFolderPaths(t *testing.T) {
+	got, err := parseFolderPaths("ST_WATCH_PATHS", "photos: /data/photos/\n# c\nexports: /data/exports")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got["photos"] != "/data/photos" || got["exports"] != "/data/exports" {
+		t.Fatalf("unexpected paths: %v", got)
+	}
+	if _, err := parseFolderPaths("ST_WATCH_PATHS", "photos /data"); err == nil {
+		t.Fatalf("expected error for malformed line")
+	}
+}
+
+func TestParseCompletionRules(t *testing.T) {
+	got, err := parseCompletionRules("inbox -> archive; inbox -> backup\nphotos->album")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(got["inbox"], ",") != "archive,backup" || strings.Join(got["photos"], ",") != "album" {
+		t.Fatalf("unexpected rules: %v", got)
+	}
+}
+
+func TestParseCompletionRulesRejectsChainsAndLoops(t *testing.T) {
+	for _, raw := range []string{
+		"inbox -> archive; archive -> backup",
+		"inbox -> inbox",
+		"inbox archive",
+		"inbox -> ",
+	} {
+		if _, err := parseCompletionRules(raw); err == nil {
+			t.Fatalf("expected error for %q", raw)
+		}
+	}
+}
+
+func TestParseInstances(t *testing.T) {
+	got, err := parseInstances("nas = http://nas:8384 key=abc; laptop = https://laptop:8384/ key=def\n# c")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 instances, got %v", got)
+	}
+	if got[0] != (InstanceSettings{Name: "nas", APIURL: "http://nas:8384/", APIKey: "abc"}) {
+		t.Fatalf("unexpected first instance: %+v", got[0])
+	}
+	if got[1].Name != "laptop" || got[1].APIURL != "https://laptop:8384/" || got[1].APIKey != "def" {
+		t.Fatalf("unexpected second instance: %+v", got[1])
+	}
+}
+
+func TestParseInstancesRejectsInvalidEntries(t *testing.T) {
+	for _, raw := range []string{
+		"nas http://nas:8384 key=abc",
+		"nas = http://nas:8384",
+		"nas = http://nas:8384 token=abc",
+		"default = http://other:8384 key=abc",
+		"nas = http://a:8384 key=a; nas = http://b:8384 key=b",
+		"n/as = http://nas:8384 key=abc",
+	} {
+		if _, err := parseInstances(raw); err == nil {
+			t.Fatalf("expected error for %q", raw)
+		}
+	}
+}
+
+func TestParseInstancesFallback(t *testing.T) {
+	got, err := parseInstances("nas = http://192.168.1.2:8384 key=abc fallback=http://10.0.0.2:8384")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got[0].FallbackURL != "http://10.0.0.2:8384/" {
+		t.Fatalf("unexpected fallback: %+v", got[0])
+	}
+}
+
+func TestLoadSettingsLogFormat(t *testing.T) {
+	os.Clearenv()
+	os.Setenv("ST_API_KEY", "abc123")
+	os.Setenv("ST_CRON", "*/5 * * * *")
+	st, err := LoadSettingsFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if st.LogFormat != "plain" || st.LogColor != "auto" {
+		t.Fatalf("unexpected defaults: %q %q", st.LogFormat, st.LogColor)
+	}
+
+	os.Setenv("ST_LOG_FORMAT", "Pretty")
+	os.Setenv("ST_LOG_COLOR", "never")
+	st, err = LoadSettingsFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if st.LogFormat != "pretty" || st.LogColor != "never" {
+		t.Fatalf("unexpected values: %q %q", st.LogFormat, st.LogColor)
+	}
+
+	os.Setenv("ST_LOG_COLOR", "sometimes")
+	if _, err := LoadSettingsFromEnv(); err == nil {
+		t.Fatalf("expected error for invalid ST_LOG_COLOR")
+	}
+	os.Setenv("ST_LOG_COLOR", "auto")
+	os.Setenv("ST_LOG_FORMAT", "xml")
+	if _, err := LoadSettingsFromEnv(); err == nil {
+		t.Fatalf("expected error for invalid ST_LOG_FORMAT")
+	}
+}
+
+func TestLoadSettingsScanTimeoutPolicy(t *testing.T) {
+	os.Clearenv()
+	os.Setenv("ST_API_KEY", "abc123")
+	os.Setenv("ST_CRON", "*/5 * * * *")
+	st, err := LoadSettingsFromEnv()
+	if err != nil || st.ScanTimeoutPolicy != scanTimeoutOK {
+		t.Fatalf("unexpected default: %q %v", st.ScanTimeoutPolicy, err)
+	}
+	os.Setenv("ST_SCAN_TIMEOUT_POLICY", "Error")
+	if st, err = LoadSettingsFromEnv(); err != nil || st.ScanTimeoutPolicy != scanTimeoutError {
+		t.Fatalf("unexpected value: %q %v", st.ScanTimeoutPolicy, err)
+	}
+	os.Setenv("ST_SCAN_TIMEOUT_POLICY", "ignore")
+	if _, err := LoadSettingsFromEnv(); err == nil {
+		t.Fatalf("expected error for invalid ST_SCAN_TIMEOUT_POLICY")
+	}
+}
+
+func TestParseFolderCommands(t *testing.T) {
+	cmds, err := parseFolderCommands("ST_FOLDER_CONDITION_CMD", "docs: curl -fs http://localhost:8080/ok\n# c\nnas/media: on_ac_power")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cmds["docs"] != "curl -fs http://localhost:8080/ok" || cmds["nas/media"] != "on_ac_power" || len(cmds) != 2 {
+		t.Fatalf("unexpected commands: %v", cmds)
+	}
+	for _, raw := range []string{"docs", "docs:", ": true", "my docs: true"} {
+		if _, err := parseFolderCommands("ST_FOLDER_CONDITION_CMD", raw); err == nil {
+			t.Fatalf("expected error for %q", raw)
+		}
+	}
+}
+
+func TestParseFolderCronActions(t *testing.T) {
+	raw := "outbox: override 0 4 * * *\noutbox: 0 * * * *\ndocs: scan */5 * * * *"
+	scans, err := parseFolderCron(raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	overrides, err := parseFolderCronAction(raw, actionOverride)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(scans) != 2 || scans["outbox"] != "0 * * * *" || scans["docs"] != "*/5 * * * *" {
+		t.Fatalf("unexpected scans: %v", scans)
+	}
+	if len(overrides) != 1 || overrides["outbox"] != "0 4 * * *" {
+		t.Fatalf("unexpected overrides: %v", overrides)
+	}
+	if reverts, err := parseFolderCronAction(raw+"\ninbox: revert 30 4 * * *", actionRevert); err != nil || len(reverts) != 1 || reverts["inbox"] != "30 4 * * *" {
+		t.Fatalf("unexpected reverts: %v %v", reverts, err)
+	}
+	if reports, err := parseFolderCronAction(raw+"\narchive: versions-report 0 6 * * 1", actionVersionsReport); err != nil || len(reports) != 1 || reports["archive"] != "0 6 * * 1" {
+		t.Fatalf("unexpected versions reports: %v %v", reports, err)
+	}
+	if _, err := parseFolderCron("outbox: override"); err == nil {
+		t.Fatalf("expected an action without a cron expression to be rejected")
+	}
+}
+
+func TestParsePauseWindows(t *testing.T) {
+	got, err := parsePauseWindows("ST_PAUSE_WINDOWS", "media: 08:00-18:00 Mon-Fri\n# weekends too\nmedia: 22:00-06:00 Sat,Sun\nnas/photos: 9:30-10:00")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got["media"]) != 2 || len(got["nas/photos"]) != 1 {
+		t.Fatalf("unexpected windows: %+v", got)
+	}
+	w := got["media"][0]
+	if w.Start != 8*60 || w.End != 18*60 || w.Days[time.Sunday] || !w.Days[time.Monday] || !w.Days[time.Friday] {
+		t.Fatalf("unexpected window: %+v", w)
+	}
+	if p := got["nas/photos"][0]; p.Start != 9*60+30 || p.Days != [7]bool{true, true, true, true, true, true, true} {
+		t.Fatalf("unexpected window: %+v", p)
+	}
+	if w := got["media"][1]; !w.Days[time.Saturday] || !w.Days[time.Sunday] || w.Days[time.Monday] {
+		t.Fatalf("unexpected window: %+v", w)
+	}
+	for _, raw := range []string{"media", "media: 8-18", "media: 08:00-08:00", "media: 08:00-25:00", "media: 08:00-18:00 Someday", "media: 08:00-18:00 Mon Tue"} {
+		if _, err := parsePauseWindows("ST_PAUSE_WINDOWS", raw); err == nil {
+			t.Fatalf("expected error for %q", raw)
+		}
+	}
+	if _, err := parsePauseWindows("ST_PAUSE_WINDOWS", "my media: 08:00-18:00"); err == nil {
+		t.Fatalf("expected an invalid folder ID to be rejected")
+	}
+	if _, err := parsePauseWindows("ST_WATCHER_OFF_WINDOWS", "batch out: 01:00-04:00"); err == nil {
+		t.Fatalf("expected an invalid folder ID to be rejected in ST_WATCHER_OFF_WINDOWS")
+	}
+	devices, err := parsePauseWindows("ST_DEVICE_PAUSE_WINDOWS", "Offsite NAS: 06:00-23:00")
+	if err != nil || len(devices["Offsite NAS"]) != 1 {
+		t.Fatalf("expected a device name with spaces to be accepted: %v %+v", err, devices)
+	}
+}
+
+func TestParseBandwidthSchedule(t *testing.T) {
+	got, err := parseBandwidthSchedule("0 8 * * 1-5 = 500/2000\n# evenings are unlimited\n0 22 * * * = 0/0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 || got[0] != (BandwidthRule{Cron: "0 8 * * 1-5", SendKbps: 500, RecvKbps: 2000}) || got[1] != (BandwidthRule{Cron: "0 22 * * *"}) {
+		t.Fatalf("unexpected rules: %+v", got)
+	}
+	for _, raw := range []string{"0 8 * * *", "0 8 * * * = 500", "= 500/500", "0 8 * * * = fast/500", "0 8 * * * = -1/0"} {
+		if _, err := parseBandwidthSchedule(raw); err == nil {
+			t.Fatalf("expected error for %q", raw)
+		}
+	}
+}
+
+func TestParseScanNext(t *testing.T) {
+	global, folders, err := parseScanNext("1h\n# photos rescans less often\nphotos: 6h\nnas/media: 0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if global != time.Hour || folders["photos"] != 6*time.Hour || len(folders) != 2 {
+		t.Fatalf("unexpected values: %s %v", global, folders)
+	}
+	for _, raw := range []string{"soon", "photos: later", ": 1h", "my photos: 1h"} {
+		if _, _, err := parseScanNext(raw); err == nil {
+			t.Fatalf("expected error for %q", raw)
+		}
+	}
+}
+
+func TestParseNotifySeverity(t *testing.T) {
+	got, err := parseNotifySeverity("scan_failed: critical, digest: Warning\n# quiet\nfolder_recovered: info")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 3 || got[eventScanFailed] != severityCritical || got[eventDigest] != severityWarning || got[eventFolderRecovered] != severityInfo {
+		t.Fatalf("unexpected values: %v", got)
+	}
+	for _, raw := range []string{"scan_failed", "scan_failed: loud", "out_of_sync: critical", ": info"} {
+		if _, err := parseNotifySeverity(raw); err == nil {
+			t.Fatalf("expected error for %q", raw)
+		}
+	}
+}
+
+func TestParseCheckStateSeverity(t *testing.T) {
+	got, err := parseCheckStateSeverity("stopped: ok, Error: Warning\n# quiet\nsyncing: critical")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 3 || got["stopped"] != checkOK || got["error"] != severityWarning || got["syncing"] != severityCritical {
+		t.Fatalf("unexpected values: %v", got)
+	}
+	for _, raw := range []string{"stopped", "stopped: info", "paused: ok", ": ok"} {
+		if _, err := parseCheckStateSeverity(raw); err == nil {
+			t.Fatalf("expected error for %q", raw)
+		}
+	}
+}
+
+func TestParseNotifySinksAndRoutes(t *testing.T) {
+	sinks, err := parseNotifySinks("alerts = ntfy https://ntfy.sh/kicker timeout=3s\n# c", []string{"https://a/hook", "https://b/hook"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sinks) != 3 || sinks[0].Name != "webhook" || sinks[1].Name != "webhook-2" || sinks[2].Type != "ntfy" || sinks[2].Timeout != 3*time.Second {
+		t.Fatalf("unexpected sinks: %+v", sinks)
+	}
+
+	routes, err := parseNotifyRoutes("scan_failed, scan_still_failing -> alerts; * -> webhook", sinks)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(routes) != 2 || strings.Join(routes[0].Events, ",") != "scan_failed,scan_still_failing" || routes[1].Sinks[0] != "webhook" {
+		t.Fatalf("unexpected routes: %+v", routes)
+	}
+
+	filtered, err := parseNotifyRoutes("scan_failed[finance,docs], scan_still_failing[finance,docs], digest -> alerts; *[!scratch, tmp] -> webhook", sinks)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(filtered) != 3 || strings.Join(filtered[0].Events, ",") != "scan_failed,scan_still_failing" || strings.Join(filtered[0].Folders, ",") != "finance,docs" ||
+		len(filtered[1].Folders) != 0 || filtered[1].Events[0] != "digest" ||
+		!filtered[2].ExcludeFolders || strings.Join(filtered[2].Folders, ",") != "scratch,tmp" {
+		t.Fatalf("unexpected filtered routes: %+v", filtered)
+	}
+
+	for _, raw := range []string{"bogus -> webhook", "scan_failed -> email", "scan_failed", "-> webhook",
+		"out_of_sync[!scratch] -> webhook", "scan_failed[docs -> webhook", "scan_failed[] -> webhook", "scan_failed[docs,!tmp] -> webhook", "scan_failed[docs]x -> webhook"} {
+		if _, err := parseNotifyRoutes(raw, sinks); err == nil {
+			t.Fatalf("expected error for %q", raw)
+		}
+	}
+	for _, raw := range []string{"x = email smtp://host", "x = ntfy", "x = ntfy https://a bogus=1", "webhook = ntfy https://a", "x = discord https://a channel=#ops", "x = slack https://a username="} {
+		if _, err := parseNotifySinks(raw, []string{"https://a/hook"}); err == nil {
+			t.Fatalf("expected error for %q", raw)
+		}
+	}
+
+	chat, err := parseNotifySinks("team = slack https://hooks.slack.com/services/T/B/X channel=#ops username=kicker; gaming = Discord https://discord.com/api/webhooks/1/x", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(chat) != 2 || chat[0].Channel != "#ops" || chat[0].Username != "kicker" || chat[1].Type != "discord" {
+		t.Fatalf("unexpected chat sinks: %+v", chat)
+	}
+}
@@ -0,0 +1,102 @@
+package app
+
+// Notification severities, from least to most urgent.
+const (
+	severityInfo     = "info"
+	severityWarning  = "warning"
+	severityCritical = "critical"
+)
+
+var severityLevels = []string{severityInfo, severityWarning, severityCritical}
+
+// defaultSeverities is how urgent each event type is unless ST_NOTIFY_SEVERITY says
+// otherwise. health_changed is not listed: it takes the level it moved to.
+var defaultSeverities = map[string]string{
+	eventScanFailed:            severityWarning,
+	eventScanStillFailing:      severityWarning,
+	eventScanRecovered:         severityInfo,
+	eventFolderRecovered:       severityInfo,
+	eventDigest:                severityInfo,
+	eventOverride:              severityWarning,
+	eventRevertCompleted:       severityInfo,
+	eventRevertFailed:          severityWarning,
+	eventVersionsOverThreshold: severityWarning,
+	eventDeviceAccepted:        severityInfo,
+	eventFolderAccepted:        severityInfo,
+	eventFolderAcceptConflict:  severityWarning,
+	eventDeviceAbsent:          severityWarning,
+}
+
+// healthSeverities maps the health level health_changed moved to onto a severity.
+var healthSeverities = map[string]string{
+	levelHealthy:   severityInfo,
+	levelDegraded:  severityWarning,
+	levelUnhealthy: severityCritical,
+}
+
+// severityHealth is healthSeverities the other way round: the level a folder's
+// failure streak brings the daemon down to, by the severity of its scan_failed.
+var severityHealth = map[string]string{
+	severityInfo:     levelHealthy,
+	severityWarning:  levelDegraded,
+	severityCritical: levelUnhealthy,
+}
+
+// severityEscalation is how many times its threshold a threshold-based event must
+// reach to be raised one severity.
+const severityEscalation = 10
+
+// escalateSeverity raises sev one step once value is severityEscalation times
+// threshold or more. Critical stays critical.
+func escalateSeverity(sev string, value, threshold int64) string {
+	if threshold <= 0 || value < severityEscalation*threshold {
+		return sev
+	}
+	switch sev {
+	case severityInfo:
+		return severityWarning
+	case severityWarning:
+		return severityCritical
+	}
+	return sev
+}
+
+// eventSeverity works out how urgent ev is: ST_NOTIFY_SEVERITY's setting for its
+// type or the default, escalated for failure streaks far past ST_ALERT_AFTER and
+// versions far past ST_VERSIONS_WARN_GB.
+func (s *Service) eventSeverity(ev NotifyEvent) string {
+	sev, ok := s.Settings.NotifySeverity[ev.Type]
+	if !ok {
+		sev, ok = defaultSeverities[ev.Type]
+	}
+	if !ok && ev.Type == eventHealthChanged {
+		to, _ := ev.Fields["to"].(string)
+		sev, ok = healthSeverities[to]
+	}
+	if !ok {
+		sev = severityInfo
+	}
+	switch ev.Type {
+	case eventScanFailed, eventScanStillFailing:
+		if n, ok := factInt(ev.Fields["streak"]); ok {
+			sev = escalateSeverity(sev, n, int64(max(s.Settings.AlertAfter, 1)))
+		}
+	case eventVersionsOverThreshold:
+		if n, ok := factInt(ev.Fields["bytes"]); ok {
+			sev = escalateSeverity(sev, n, s.versionsWarnBytes())
+		}
+	}
+	return sev
+}
+
+// recoveryEvent reports whether ev says something got better; such events are
+// shown as good news whatever their severity.
+func recoveryEvent(ev NotifyEvent) bool {
+	switch ev.Type {
+	case eventScanRecovered, eventFolderRecovered:
+		return true
+	case eventHealthChanged:
+		return ev.Fields["to"] == levelHealthy
+	}
+	return false
+}
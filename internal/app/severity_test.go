@@ -0,0 +1,139 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEscalateSeverity(t *testing.T) {
+	for _, c := range []struct {
+		sev              string
+		value, threshold int64
+		want             string
+	}{
+		{severityWarning, 3, 3, severityWarning},
+		{severityWarning, 29, 3, severityWarning},
+		{severityWarning, 30, 3, severityCritical},
+		{severityInfo, 100, 3, severityWarning},
+		{severityCritical, 100, 3, severityCritical},
+		{severityWarning, 100, 0, severityWarning},
+	} {
+		if got := escalateSeverity(c.sev, c.value, c.threshold); got != c.want {
+			t.Fatalf("escalateSeverity(%s, %d, %d) = %s, want %s", c.sev, c.value, c.threshold, got, c.want)
+		}
+	}
+}
+
+func TestEventSeverity(t *testing.T) {
+	svc := newFakeSyncthing(t).service(t, Settings{AlertAfter: 3, NotifySeverity: map[string]string{eventDigest: severityWarning}})
+	for _, c := range []struct {
+		ev   NotifyEvent
+		want string
+	}{
+		{NotifyEvent{Type: eventScanFailed, Fields: map[string]any{"streak": 3}}, severityWarning},
+		{NotifyEvent{Type: eventScanStillFailing, Fields: map[string]any{"streak": 29}}, severityWarning},
+		{NotifyEvent{Type: eventScanStillFailing, Fields: map[string]any{"streak": 30}}, severityCritical},
+		{NotifyEvent{Type: eventScanRecovered}, severityInfo},
+		{NotifyEvent{Type: eventFolderRecovered}, severityInfo},
+		{NotifyEvent{Type: eventDigest}, severityWarning},
+		{NotifyEvent{Type: eventHealthChanged, Fields: map[string]any{"to": levelUnhealthy}}, severityCritical},
+		{NotifyEvent{Type: eventHealthChanged, Fields: map[string]any{"to": levelDegraded}}, severityWarning},
+		{NotifyEvent{Type: eventHealthChanged, Fields: map[string]any{"to": levelHealthy}}, severityInfo},
+	} {
+		if got := svc.eventSeverity(c.ev); got != c.want {
+			t.Fatalf("%s %v: got %s, want %s", c.ev.Type, c.ev.Fields, got, c.want)
+		}
+	}
+
+	// An override sets the base severity; far past the threshold still escalates it.
+	svc.Settings.NotifySeverity = map[string]string{eventScanStillFailing: severityInfo}
+	if got := svc.eventSeverity(NotifyEvent{Type: eventScanStillFailing, Fields: map[string]any{"streak": 30}}); got != severityWarning {
+		t.Fatalf("expected an overridden info to escalate to warning, got %s", got)
+	}
+}
+
+func TestNtfyPriorityFollowsSeverity(t *testing.T) {
+	priorities := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		priorities <- r.Header.Get("Priority")
+	}))
+	defer srv.Close()
+
+	svc := newFakeSyncthing(t, "docs").service(t, Settings{AlertAfter: 1})
+	svc.Notifiers = []Notifier{&NtfyNotifier{SinkName: "ntfy", URL: srv.URL, Client: &http.Client{}}}
+	svc.notify(NotifyEvent{Type: eventScanFailed, Folder: "docs", Message: "failed", Fields: map[string]any{"streak": 10}})
+	svc.notifications.Wait()
+	if got := <-priorities; got != "urgent" {
+		t.Fatalf("expected a critical event to be sent as urgent, got %q", got)
+	}
+
+	n := &NtfyNotifier{SinkName: "ntfy", URL: srv.URL, Client: &http.Client{}}
+	if err := n.Notify(context.Background(), NotifyEvent{Type: eventDigest, Severity: severityInfo}); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	if got := <-priorities; got != "default" {
+		t.Fatalf("expected an info event to be sent at the default priority, got %q", got)
+	}
+}
+
+func TestGotifyPriorityFollowsSeverity(t *testing.T) {
+	priorities := make(chan int, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Priority int `json:"priority"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		priorities <- body.Priority
+	}))
+	defer srv.Close()
+
+	n := &GotifyNotifier{SinkName: "gotify", URL: srv.URL + "/message?token=abc", Client: &http.Client{}}
+	for sev, want := range map[string]int{severityInfo: 2, severityWarning: 5, severityCritical: 8} {
+		if err := n.Notify(context.Background(), NotifyEvent{Type: eventScanFailed, Severity: sev}); err != nil {
+			t.Fatalf("notify: %v", err)
+		}
+		if got := <-priorities; got != want {
+			t.Fatalf("expected %s to be sent at priority %d, got %d", sev, want, got)
+		}
+	}
+}
+
+func TestSyslogLevelFollowsSeverity(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	n := &SyslogNotifier{SinkName: "syslog", URL: "udp://" + conn.LocalAddr().String()}
+	for sev, want := range map[string]string{severityInfo: "<30>", severityWarning: "<28>", severityCritical: "<26>"} {
+		if err := n.Notify(context.Background(), NotifyEvent{Type: eventScanFailed, Severity: sev, Title: "Scan failed", Message: "docs\nfailed"}); err != nil {
+			t.Fatalf("notify: %v", err)
+		}
+		buf := make([]byte, 1024)
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		k, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		line := string(buf[:k])
+		if !strings.HasPrefix(line, want) || !strings.HasSuffix(line, "]: Scan failed: docs failed\n") {
+			t.Fatalf("expected %s to be logged at %s, got %q", sev, want, line)
+		}
+	}
+}
+
+func TestParseSyslogSink(t *testing.T) {
+	if _, err := parseNotifySinks("local = syslog unix:///dev/log", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseNotifySinks("remote = syslog http://logs.example", nil); err == nil || !strings.Contains(err.Error(), "must be udp://host:port") {
+		t.Fatalf("expected a bad syslog URL to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// errStaleScan is logged for folders Syncthing has not scanned within
+// ST_STALE_SCAN_WARN; being constant, repeats are rate-limited like other failures.
+var errStaleScan = errors.New("last scan too old")
+
+// lastScans fetches Syncthing's last scan time for refs, with one /rest/stats/folder
+// request per instance. Instances that fail or are degraded are left out, so their
+// folders keep their previous staleness.
+func (s *Service) lastScans(ctx context.Context, refs []string) map[string]time.Time {
+	out := map[string]time.Time{}
+	_, groups := s.groupByInstance(refs)
+	for inst, group := range groups {
+		if ok, _ := s.health.available(inst); !ok {
+			continue
+		}
+		stats, _, err := s.client(inst).FolderStats(ctx, 10*time.Second)
+		if s.recordHealth(ctx, inst, err, func(since time.Time) {
+			s.logFailure(ctx, joinRef(inst, "*"), "folder stats", err, "Failed to fetch folder statistics on instance %s: %v (unreachable since %s)", instanceName(inst), err, since.Format(time.RFC3339))
+		}) {
+			continue
+		}
+		if err != nil {
+			s.logFailure(ctx, joinRef(inst, "*"), "folder stats", err, "Failed to fetch folder statistics on instance %s: %v", instanceName(inst), err)
+			continue
+		}
+		s.logSuccess(ctx, joinRef(inst, "*"), "folder stats")
+		for _, ref := range group {
+			_, id := s.splitRef(ref)
+			if st, ok := stats[id]; ok && !st.LastScan.IsZero() {
+				out[ref] = st.LastScan
+			}
+		}
+	}
+	return out
+}
+
+// checkStale records ref's last Syncthing scan and warns while it is older than
+// ST_STALE_SCAN_WARN.
+func (s *Service) checkStale(ctx context.Context, ref string, lastScan time.Time) {
+	age := time.Since(lastScan)
+	stale := age > s.Settings.StaleScanWarn
+	s.stats.recordLastScan(ref, lastScan, stale)
+	if !stale {
+		s.logSuccess(ctx, ref, "stale scan")
+		return
+	}
+	s.logFailure(ctx, ref, "stale scan", errStaleScan, "Warning: folder %s%s was last scanned by Syncthing %s ago at %s (limit %s)",
+		ref, s.labelSuffix(ref), age.Round(time.Second), lastScan.Format(time.RFC3339), s.Settings.StaleScanWarn)
+}
@@ -0,0 +1,60 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStaleScanWarning(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs", "photos")
+	old := time.Now().Add(-48 * time.Hour).UTC().Truncate(time.Second)
+	fake.setLastScan("docs", old)
+	fake.setLastScan("photos", time.Now().Add(-time.Minute))
+	svc := fake.service(t, Settings{StaleScanWarn: 24 * time.Hour})
+	var buf bytes.Buffer
+	svc.Logger = log.New(&buf, "", 0)
+
+	if err := svc.checkSyncStatus(context.Background(), []string{"*"}, 0); err != nil {
+		t.Fatalf("status check: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "Warning: folder docs was last scanned by Syncthing") || strings.Contains(out, "folder photos was last scanned") {
+		t.Fatalf("expected a warning for docs only:\n%s", out)
+	}
+	if !strings.Contains(out, "Folder docs status: state=idle needBytes=0 inSyncBytes=0 lastScan="+old.Format(time.RFC3339)) {
+		t.Fatalf("expected lastScan in the status line:\n%s", out)
+	}
+	if got := fake.count("/rest/stats/folder"); got != 1 {
+		t.Fatalf("expected one stats fetch per check, got %d", got)
+	}
+
+	h := svc.adminHandler(context.Background(), make(chan struct{}, 1))
+	rec := adminRequest(t, h, http.MethodGet, "/api/health", "", "")
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"staleFolders":["docs"]`) {
+		t.Fatalf("expected degraded health, got %d %s", rec.Code, rec.Body.String())
+	}
+	if m := scrape(t, svc); !strings.Contains(m, `syncthing_kicker_syncthing_last_scan_timestamp_seconds{folder="docs",instance="default"}`) {
+		t.Fatalf("missing last scan gauge:\n%s", m)
+	}
+
+	fake.setLastScan("docs", time.Now())
+	_ = svc.checkSyncStatus(context.Background(), []string{"*"}, 0)
+	if rec := adminRequest(t, h, http.MethodGet, "/api/health", "", ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected healthy once docs was scanned, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestStaleScanDisabledByDefault(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	fake.setLastScan("docs", time.Now().Add(-48*time.Hour))
+	svc := fake.service(t, Settings{})
+	_ = svc.checkSyncStatus(context.Background(), []string{"docs"}, 0)
+	if got := fake.count("/rest/stats/folder"); got != 0 {
+		t.Fatalf("stats should not be fetched without ST_STALE_SCAN_WARN, got %d", got)
+	}
+}
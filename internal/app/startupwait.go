@@ -0,0 +1,75 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const startupPingTimeout = 5 * time.Second
+
+// startupBaseBackoff is the first pause between startup pings; it doubles after
+// each round up to startupMaxBackoff.
+var (
+	startupBaseBackoff = time.Second
+	startupMaxBackoff  = 30 * time.Second
+)
+
+// waitForSyncthing pings every instance until it answers, backing off between
+// rounds, for up to ST_STARTUP_WAIT, so a kicker started before Syncthing does not
+// fail its first runs. It returns ctx's error if ctx ends first. Once the wait runs
+// out with no instance answering it returns an ErrUnreachable error; if only some
+// did, the others are logged and left to the usual instance backoff.
+func (s *Service) waitForSyncthing(ctx context.Context) error {
+	if s.Settings.StartupWait <= 0 {
+		return nil
+	}
+	start := time.Now()
+	deadline := start.Add(s.Settings.StartupWait)
+	waiting := s.instances()
+	total := len(waiting)
+	backoff := startupBaseBackoff
+	for round := 1; ; round++ {
+		var down []string
+		var lastErr error
+		for _, inst := range waiting {
+			if _, err := s.client(inst).Ping(ctx, startupPingTimeout); err != nil {
+				down, lastErr = append(down, inst), err
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if len(down) == 0 {
+			if round > 1 {
+				s.Logger.Printf("Syncthing is reachable after %s", time.Since(start).Round(time.Millisecond))
+			}
+			return nil
+		}
+
+		names := make([]string, len(down))
+		for i, inst := range down {
+			names[i] = instanceName(inst)
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			if len(down) < total {
+				s.Logger.Printf("Instance(s) %s still unreachable after ST_STARTUP_WAIT (%s): %v; starting without them", strings.Join(names, ", "), s.Settings.StartupWait, lastErr)
+				return nil
+			}
+			return Fatal(ErrUnreachable, fmt.Errorf("Syncthing still unreachable after ST_STARTUP_WAIT (%s): %w", s.Settings.StartupWait, lastErr))
+		}
+		wait := min(backoff, remaining)
+		s.Logger.Printf("Waiting for Syncthing instance(s) %s: %v; retrying in %s", strings.Join(names, ", "), lastErr, wait)
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+		backoff = min(backoff*2, startupMaxBackoff)
+		waiting = down
+	}
+}
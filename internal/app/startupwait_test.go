@@ -0,0 +1,123 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+	"github.com/rcarmo/syncthing-kicker/internal/syncthingtest"
+)
+
+func fastStartupBackoff(t *testing.T) {
+	base, ceiling := startupBaseBackoff, startupMaxBackoff
+	startupBaseBackoff, startupMaxBackoff = 10*time.Millisecond, 40*time.Millisecond
+	t.Cleanup(func() { startupBaseBackoff, startupMaxBackoff = base, ceiling })
+}
+
+func TestLoadSettingsStartupWait(t *testing.T) {
+	os.Clearenv()
+	os.Setenv("ST_API_KEY", "abc123")
+	os.Setenv("ST_CRON", "*/5 * * * *")
+	if s, err := LoadSettingsFromEnv(); err != nil || s.StartupWait != 0 {
+		t.Fatalf("expected no wait by default, got %s, %v", s.StartupWait, err)
+	}
+	os.Setenv("ST_STARTUP_WAIT", "90")
+	if s, err := LoadSettingsFromEnv(); err != nil || s.StartupWait != 90*time.Second {
+		t.Fatalf("expected 90s, got %s, %v", s.StartupWait, err)
+	}
+	os.Setenv("ST_STARTUP_WAIT", "-1")
+	if _, err := LoadSettingsFromEnv(); err == nil || !strings.Contains(err.Error(), "ST_STARTUP_WAIT") {
+		t.Fatalf("expected a negative wait to be rejected, got %v", err)
+	}
+}
+
+func TestStartupWaitRetriesUntilSyncthingAnswers(t *testing.T) {
+	fastStartupBackoff(t)
+	srv := syncthingtest.New(t, "docs")
+	srv.Inject(syncthingtest.Fault{Path: "/rest/system/ping", Status: http.StatusServiceUnavailable, Times: 3})
+	svc := harnessService(t, srv, Settings{StartupWait: time.Minute})
+	var buf syncBuffer
+	svc.Logger = log.New(&buf, "", 0)
+
+	if err := svc.waitForSyncthing(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.Count("/rest/system/ping"); got != 4 {
+		t.Fatalf("expected 4 pings, got %d", got)
+	}
+	for _, want := range []string{
+		"Waiting for Syncthing instance(s) default: ",
+		"retrying in 10ms",
+		"retrying in 20ms",
+		"retrying in 40ms",
+		"Syncthing is reachable after ",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("expected %q in:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestStartupWaitDisabledByDefault(t *testing.T) {
+	srv := syncthingtest.New(t, "docs")
+	svc := harnessService(t, srv, Settings{})
+	if err := svc.waitForSyncthing(context.Background()); err != nil || srv.Count("/rest/system/ping") != 0 {
+		t.Fatalf("expected no ping without ST_STARTUP_WAIT, got %v after %d", err, srv.Count("/rest/system/ping"))
+	}
+}
+
+func TestRunGivesUpAfterStartupWait(t *testing.T) {
+	fastStartupBackoff(t)
+	srv := syncthingtest.New(t, "docs")
+	srv.Inject(syncthingtest.Fault{Path: "/rest/system/ping", Status: http.StatusServiceUnavailable})
+	svc := harnessService(t, srv, Settings{StartupWait: 100 * time.Millisecond, ScanOnStartup: true, CronExpr: "* * * * *"})
+
+	err := svc.Run(context.Background())
+	if !errors.Is(err, ErrUnreachable) || !strings.Contains(err.Error(), "still unreachable after ST_STARTUP_WAIT (100ms)") {
+		t.Fatalf("expected an unreachable error, got %v", err)
+	}
+	if len(srv.Scans()) != 0 || svc.cron != nil {
+		t.Fatalf("nothing should start before Syncthing answers")
+	}
+}
+
+func TestStartupWaitStopsOnCancel(t *testing.T) {
+	srv := syncthingtest.New(t, "docs")
+	srv.Inject(syncthingtest.Fault{Path: "/rest/system/ping", Status: http.StatusServiceUnavailable})
+	svc := harnessService(t, srv, Settings{StartupWait: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	if err := svc.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the wait to end with the context, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("cancel took %s to end the wait", elapsed)
+	}
+}
+
+func TestStartupWaitStartsWithoutAnUnreachableInstance(t *testing.T) {
+	fastStartupBackoff(t)
+	srv := syncthingtest.New(t, "docs")
+	down := syncthingtest.New(t, "photos")
+	down.Inject(syncthingtest.Fault{Path: "/rest/system/ping", Status: http.StatusServiceUnavailable})
+	svc := harnessService(t, srv, Settings{StartupWait: 50 * time.Millisecond})
+	svc.Instances = map[string]*syncthing.Client{"nas": down.Client(t)}
+	var buf bytes.Buffer
+	svc.Logger = log.New(&buf, "", 0)
+
+	if err := svc.waitForSyncthing(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if srv.Count("/rest/system/ping") != 1 || !strings.Contains(buf.String(), "Instance(s) nas still unreachable after ST_STARTUP_WAIT (50ms)") {
+		t.Fatalf("expected only nas to be waited for:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,491 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// stateVersion is the schema version written to ST_STATE_FILE. Older documents are
+// upgraded on load by stateMigrations.
+const stateVersion = 2
+
+// stateMigrations upgrade a document from the version they are keyed by to the next.
+var stateMigrations = map[int]func(*State){
+	// Files written before versioning have the version 1 layout.
+	0: func(*State) {},
+	// Version 2 added the per-folder scan counters; they start at zero.
+	1: func(*State) {},
+}
+
+// errStateVersion means the state file was written by a newer version of the kicker.
+var errStateVersion = errors.New("state file is from a newer version")
+
+// State is the document persisted to ST_STATE_FILE between runs.
+type State struct {
+	Version int                     `json:"version"`
+	Folders map[string]*FolderState `json:"folders,omitempty"`
+	// LastSuccess is when a scan was last triggered successfully; --healthcheck
+	// falls back to it when the daemon's health listener cannot be reached.
+	LastSuccess time.Time `json:"lastSuccess,omitempty"`
+	// History mirrors the in-memory run history so `history` works without the daemon.
+	History []RunRecord `json:"history,omitempty"`
+	// Instances holds per-instance counters, keyed by instance name.
+	Instances map[string]*InstanceState `json:"instances,omitempty"`
+	// Digest accumulates activity until the next ST_DIGEST_CRON emission.
+	Digest *Digest `json:"digest,omitempty"`
+	// Cooldowns tracks ST_NOTIFY_COOLDOWN per event type, instance and folder.
+	Cooldowns map[string]*NotifyCooldown `json:"cooldowns,omitempty"`
+	// Devices holds what we remember about devices, keyed by instance-prefixed device ID.
+	Devices map[string]*DeviceState `json:"devices,omitempty"`
+}
+
+// DeviceState is what we remember about a device.
+type DeviceState struct {
+	// WindowPaused is when an ST_DEVICE_PAUSE_WINDOWS window paused the device; zero
+	// when the kicker has not paused it.
+	WindowPaused time.Time `json:"windowPaused,omitempty"`
+	// AbsentWarned is when device_absent was raised for the device; zero once it
+	// has been seen again.
+	AbsentWarned time.Time `json:"absentWarned,omitempty"`
+}
+
+// InstanceState is what we remember about a Syncthing instance.
+type InstanceState struct {
+	// FailureStreak counts consecutive failed scan triggers on any of its folders.
+	FailureStreak int `json:"failureStreak,omitempty"`
+}
+
+// FolderState is what we remember about a single folder.
+type FolderState struct {
+	LastScan     time.Time `json:"lastScan,omitempty"`
+	LastSequence int64     `json:"lastSequence,omitempty"`
+	// LastReceiveOnly is a fingerprint of the receive-only changed counters.
+	LastReceiveOnly [4]int64 `json:"lastReceiveOnly"`
+	// SubpathPosition counts sub-path ticks so round-robin scanning resumes where it left off.
+	SubpathPosition int `json:"subpathPosition,omitempty"`
+	// LastMarker is the trigger-file mtime that last caused a scan.
+	LastMarker time.Time `json:"lastMarker,omitempty"`
+
+	// LastTrigger, LastResult and LastError describe the most recent trigger attempt.
+	LastTrigger time.Time `json:"lastTrigger,omitempty"`
+	LastResult  string    `json:"lastResult,omitempty"`
+	LastError   string    `json:"lastError,omitempty"`
+	// LastState is the last observed Syncthing state; it is only rewritten when it changes.
+	LastState        string    `json:"lastState,omitempty"`
+	LastStateChanged time.Time `json:"lastStateChanged,omitempty"`
+	// FailureStreak counts consecutive failed triggers; LastAlert is when the last
+	// scan_failed or scan_still_failing notification went out for it.
+	FailureStreak int       `json:"failureStreak,omitempty"`
+	LastAlert     time.Time `json:"lastAlert,omitempty"`
+	// Scans, Failures and Skips count trigger outcomes over the folder's lifetime.
+	Scans    int64 `json:"scans,omitempty"`
+	Failures int64 `json:"failures,omitempty"`
+	Skips    int64 `json:"skips,omitempty"`
+	// UnhealthySince is when the folder was first seen out of sync or erroring in
+	// the current episode; the peaks are the worst values seen during it.
+	UnhealthySince time.Time `json:"unhealthySince,omitempty"`
+	PeakNeedBytes  int64     `json:"peakNeedBytes,omitempty"`
+	PeakErrors     int64     `json:"peakErrors,omitempty"`
+	// WindowPaused is when an ST_PAUSE_WINDOWS window paused the folder; zero when
+	// the kicker has not paused it, so pauses made by hand are never undone.
+	WindowPaused time.Time `json:"windowPaused,omitempty"`
+	// CronPaused is when ST_PAUSE_CRON paused the folder; zero once it is resumed.
+	CronPaused time.Time `json:"cronPaused,omitempty"`
+	// SavedRescanIntervalS is the folder's rescanIntervalS from before
+	// ST_MANAGE_RESCAN_INTERVAL set it to 0; zero when the kicker has not changed it.
+	SavedRescanIntervalS int `json:"savedRescanIntervalS,omitempty"`
+	// WatcherOff is when an ST_WATCHER_OFF_WINDOWS window turned the folder's
+	// filesystem watcher off; zero when the kicker has not.
+	WatcherOff time.Time `json:"watcherOff,omitempty"`
+}
+
+// stateStore guards the persisted state. With no path it is memory-only. Writes are
+// atomic and throttled to one per flushEvery; pending changes are written by a
+// timer or by flush.
+type stateStore struct {
+	once       sync.Once
+	mu         sync.Mutex
+	path       string
+	readOnly   bool
+	state      State
+	logger     *log.Logger
+	flushEvery time.Duration
+	dirty      bool
+	lastWrite  time.Time
+	timer      *time.Timer
+}
+
+func (s *Service) stateStore() *stateStore {
+	st := &s.store
+	st.once.Do(func() {
+		st.path = s.Settings.StateFile
+		st.readOnly = s.ReadOnlyState
+		st.logger = s.Logger
+		st.flushEvery = s.Settings.StateFlushInterval
+		st.state = State{Version: stateVersion, Folders: map[string]*FolderState{}}
+		if st.path == "" {
+			return
+		}
+		loaded, err := loadState(st.path)
+		if err != nil && st.readOnly {
+			s.Logger.Printf("Ignoring unusable state file %s: %v", st.path, err)
+			return
+		}
+		if err != nil {
+			backup := fmt.Sprintf("%s.bad-%s", st.path, time.Now().UTC().Format("20060102T150405Z"))
+			if rerr := os.Rename(st.path, backup); rerr != nil {
+				s.Logger.Printf("Ignoring unusable state file %s (%v); could not move it aside: %v", st.path, err, rerr)
+			} else {
+				s.Logger.Printf("Ignoring unusable state file %s (%v); moved it to %s and starting fresh", st.path, err, backup)
+			}
+			return
+		}
+		st.state = loaded
+		for id, f := range loaded.Folders {
+			s.stats.seed(id, *f)
+		}
+	})
+	return st
+}
+
+// loadState reads the state file for the store, upgrading older schema versions.
+// Unlike readState it refuses documents it cannot fully understand, so they are
+// never overwritten.
+func loadState(path string) (State, error) {
+	state, err := readState(path)
+	if err != nil {
+		return state, err
+	}
+	if state.Version > stateVersion {
+		return state, fmt.Errorf("%w (version %d, expected at most %d)", errStateVersion, state.Version, stateVersion)
+	}
+	if state.Version < 0 {
+		return state, fmt.Errorf("decode state: invalid version %d", state.Version)
+	}
+	for v := state.Version; v < stateVersion; v++ {
+		stateMigrations[v](&state)
+	}
+	state.Version = stateVersion
+	return state, nil
+}
+
+// folder returns a copy of the stored state for folder (zero value if unknown).
+func (st *stateStore) folder(id string) FolderState {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if f := st.state.Folders[id]; f != nil {
+		return *f
+	}
+	return FolderState{}
+}
+
+// updateFolder applies fn to the folder's state and persists the result.
+func (st *stateStore) updateFolder(id string, fn func(*FolderState)) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	fn(st.folderLocked(id))
+	return st.saveLocked()
+}
+
+// updateInstance applies fn to the instance's state and persists the result.
+func (st *stateStore) updateInstance(name string, fn func(*InstanceState)) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	fn(st.instanceLocked(name))
+	return st.saveLocked()
+}
+
+// updateFolderAndInstance applies ff to the folder's state and fi to its
+// instance's, and persists both in one save.
+func (st *stateStore) updateFolderAndInstance(id, name string, ff func(*FolderState), fi func(*InstanceState)) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	ff(st.folderLocked(id))
+	fi(st.instanceLocked(name))
+	return st.saveLocked()
+}
+
+func (st *stateStore) folderLocked(id string) *FolderState {
+	f := st.state.Folders[id]
+	if f == nil {
+		f = &FolderState{}
+		st.state.Folders[id] = f
+	}
+	return f
+}
+
+func (st *stateStore) instanceLocked(name string) *InstanceState {
+	if st.state.Instances == nil {
+		st.state.Instances = map[string]*InstanceState{}
+	}
+	i := st.state.Instances[name]
+	if i == nil {
+		i = &InstanceState{}
+		st.state.Instances[name] = i
+	}
+	return i
+}
+
+// failureStreaks returns the current failure streak of every folder and instance.
+func (st *stateStore) failureStreaks() (folders, instances map[string]int) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	folders, instances = map[string]int{}, map[string]int{}
+	for id, f := range st.state.Folders {
+		if f.FailureStreak > 0 {
+			folders[id] = f.FailureStreak
+		}
+	}
+	for name, i := range st.state.Instances {
+		if i.FailureStreak > 0 {
+			instances[name] = i.FailureStreak
+		}
+	}
+	return folders, instances
+}
+
+// unhealthyFolders returns the folders currently out of sync or erroring, sorted.
+func (st *stateStore) unhealthyFolders() []string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	var out []string
+	for id, f := range st.state.Folders {
+		if !f.UnhealthySince.IsZero() {
+			out = append(out, id)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// windowPausedFolders lists the folders a pause window paused, sorted.
+func (st *stateStore) windowPausedFolders() []string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	var out []string
+	for id, f := range st.state.Folders {
+		if !f.WindowPaused.IsZero() {
+			out = append(out, id)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// watcherOffFolders lists the folders whose watcher a watcher window turned off, sorted.
+func (st *stateStore) watcherOffFolders() []string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	var out []string
+	for id, f := range st.state.Folders {
+		if !f.WatcherOff.IsZero() {
+			out = append(out, id)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// savedRescanFolders lists the folders whose rescan interval the kicker changed, sorted.
+func (st *stateStore) savedRescanFolders() []string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	var out []string
+	for id, f := range st.state.Folders {
+		if f.SavedRescanIntervalS != 0 {
+			out = append(out, id)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// device returns a copy of the stored state for device ref (zero value if unknown).
+func (st *stateStore) device(ref string) DeviceState {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if d := st.state.Devices[ref]; d != nil {
+		return *d
+	}
+	return DeviceState{}
+}
+
+// updateDevice applies fn to the device's state and persists the result. Devices
+// with nothing left to remember are dropped.
+func (st *stateStore) updateDevice(ref string, fn func(*DeviceState)) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.state.Devices == nil {
+		st.state.Devices = map[string]*DeviceState{}
+	}
+	d := st.state.Devices[ref]
+	if d == nil {
+		d = &DeviceState{}
+		st.state.Devices[ref] = d
+	}
+	fn(d)
+	if d.WindowPaused.IsZero() && d.AbsentWarned.IsZero() {
+		delete(st.state.Devices, ref)
+	}
+	return st.saveLocked()
+}
+
+// windowPausedDevices lists the devices a pause window paused, sorted.
+func (st *stateStore) windowPausedDevices() []string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	var out []string
+	for ref, d := range st.state.Devices {
+		if !d.WindowPaused.IsZero() {
+			out = append(out, ref)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// markSuccess records a successful trigger and persists it.
+func (st *stateStore) markSuccess(t time.Time) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.state.LastSuccess = t
+	return st.saveLocked()
+}
+
+func (st *stateStore) history() []RunRecord {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return append([]RunRecord(nil), st.state.History...)
+}
+
+// setHistory replaces the persisted run history.
+func (st *stateStore) setHistory(runs []RunRecord) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.state.History = runs
+	return st.saveLocked()
+}
+
+// saveLocked persists the state, or schedules it if the last write was less than
+// flushEvery ago.
+func (st *stateStore) saveLocked() error {
+	if st.path == "" || st.readOnly {
+		return nil
+	}
+	st.dirty = true
+	if wait := st.flushEvery - time.Since(st.lastWrite); wait > 0 {
+		if st.timer == nil {
+			st.timer = time.AfterFunc(wait, st.flushPending)
+		}
+		return nil
+	}
+	return st.writeLocked()
+}
+
+func (st *stateStore) writeLocked() error {
+	st.dirty = false
+	st.lastWrite = time.Now()
+	data, err := json.MarshalIndent(st.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(st.path, data)
+}
+
+func (st *stateStore) flushPending() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.timer = nil
+	if !st.dirty {
+		return
+	}
+	if err := st.writeLocked(); err != nil {
+		st.logger.Printf("Failed to save state: %v", err)
+	}
+}
+
+// flush writes any throttled changes immediately.
+func (st *stateStore) flush() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.timer != nil {
+		st.timer.Stop()
+		st.timer = nil
+	}
+	if !st.dirty {
+		return nil
+	}
+	return st.writeLocked()
+}
+
+// FlushState writes pending state changes to ST_STATE_FILE; call it before exiting.
+func (s *Service) FlushState() error {
+	return s.stateStore().flush()
+}
+
+// ReadFolderState returns what the state file at path remembers about folder. Unknown
+// fields from newer versions are ignored.
+func ReadFolderState(path, folder string) (FolderState, bool, error) {
+	state, err := readState(path)
+	if err != nil {
+		return FolderState{}, false, err
+	}
+	f := state.Folders[folder]
+	if f == nil {
+		return FolderState{}, false, nil
+	}
+	return *f, true, nil
+}
+
+// readState loads the state file. Documents written by newer versions are read on a
+// best-effort basis: unknown fields are ignored rather than treated as errors. A
+// document without a version predates versioning and is read as version 0.
+func readState(path string) (State, error) {
+	state := State{Folders: map[string]*FolderState{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		state.Version = stateVersion
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("decode state: %w", err)
+	}
+	if state.Folders == nil {
+		state.Folders = map[string]*FolderState{}
+	}
+	// A null entry carries nothing and would be dereferenced later.
+	maps.DeleteFunc(state.Folders, func(_ string, f *FolderState) bool { return f == nil })
+	maps.DeleteFunc(state.Instances, func(_ string, i *InstanceState) bool { return i == nil })
+	maps.DeleteFunc(state.Cooldowns, func(_ string, c *NotifyCooldown) bool { return c == nil })
+	maps.DeleteFunc(state.Devices, func(_ string, d *DeviceState) bool { return d == nil })
+	return state, nil
+}
+
+// writeFileAtomic writes data to a temp file next to path and renames it into place.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
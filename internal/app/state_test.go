@@ -0,0 +1,278 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+func TestStateStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	svc := &Service{Settings: Settings{StateFile: path}, Logger: log.New(io.Discard, "", 0)}
+
+	if err := svc.stateStore().updateFolder("docs", func(f *FolderState) { f.LastSequence = 42 }); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reloaded := &Service{Settings: Settings{StateFile: path}, Logger: log.New(io.Discard, "", 0)}
+	if got := reloaded.stateStore().folder("docs").LastSequence; got != 42 {
+		t.Fatalf("expected sequence 42 after reload, got %d", got)
+	}
+}
+
+func TestStateStoreMovesUnusableFilesAside(t *testing.T) {
+	for name, doc := range map[string]string{
+		"corrupt":  "{not json",
+		"future":   `{"version": 99, "folders": {"docs": {"lastSequence": 7}}}`,
+		"negative": `{"version": -1, "folders": {"docs": {"lastSequence": 7}}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "state.json")
+			if err := os.WriteFile(path, []byte(doc), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			svc := &Service{Settings: Settings{StateFile: path}, Logger: log.New(io.Discard, "", 0)}
+			if got := svc.stateStore().folder("docs"); got.LastSequence != 0 {
+				t.Fatalf("expected empty state, got %+v", got)
+			}
+			backups, _ := filepath.Glob(path + ".bad-*")
+			if len(backups) != 1 {
+				t.Fatalf("expected the unusable file to be moved aside, got %v", backups)
+			}
+			if data, _ := os.ReadFile(backups[0]); string(data) != doc {
+				t.Fatalf("backup does not hold the original document: %q", data)
+			}
+		})
+	}
+}
+
+func TestStateStoreDropsNullEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	doc := `{"version": 2, "folders": {"docs": null, "photos": {"lastSequence": 3}}, "instances": {"default": null}}`
+	if err := os.WriteFile(path, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	svc := &Service{Settings: Settings{StateFile: path}, Logger: log.New(io.Discard, "", 0)}
+	st := svc.stateStore()
+	if _, ok := st.state.Folders["docs"]; ok || st.folder("photos").LastSequence != 3 {
+		t.Fatalf("expected the null folder to be dropped: %+v", st.state.Folders)
+	}
+	if folders, instances := st.failureStreaks(); len(folders) != 0 || len(instances) != 0 {
+		t.Fatalf("unexpected streaks %v %v", folders, instances)
+	}
+}
+
+func TestReadOnlyStateNeverWrites(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	doc := `{"version": 2, "folders": {"docs": {"lastSequence": 7}}}`
+	if err := os.WriteFile(path, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	svc := &Service{Settings: Settings{StateFile: path}, Logger: log.New(io.Discard, "", 0), ReadOnlyState: true}
+	if svc.stateStore().folder("docs").LastSequence != 7 {
+		t.Fatalf("expected the state to be read")
+	}
+	if err := svc.stateStore().updateFolder("docs", func(f *FolderState) { f.LastSequence = 8 }); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.FlushState(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != doc {
+		t.Fatalf("the state file was rewritten: %s", data)
+	}
+
+	if err := os.WriteFile(path, []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	svc = &Service{Settings: Settings{StateFile: path}, Logger: log.New(io.Discard, "", 0), ReadOnlyState: true}
+	svc.stateStore()
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("expected an unusable file to be left in place, got %v", entries)
+	}
+}
+
+func TestStateStoreMigratesOldVersions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	doc := `{"version": 1, "folders": {"docs": {"lastSequence": 7, "lastResult": "triggered"}}}`
+	if err := os.WriteFile(path, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	svc := &Service{Settings: Settings{StateFile: path}, Logger: log.New(io.Discard, "", 0)}
+	st := svc.stateStore()
+	if got := st.folder("docs"); got.LastSequence != 7 {
+		t.Fatalf("expected migrated folder state, got %+v", got)
+	}
+	if st.state.Version != stateVersion {
+		t.Fatalf("expected version %d after migration, got %d", stateVersion, st.state.Version)
+	}
+}
+
+func TestStateStoreMigratesUnversionedFiles(t *testing.T) {
+	var ran []int
+	orig := stateMigrations
+	stateMigrations = map[int]func(*State){}
+	for v, m := range orig {
+		stateMigrations[v] = func(s *State) { ran = append(ran, v); m(s) }
+	}
+	t.Cleanup(func() { stateMigrations = orig })
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	doc := `{"folders": {"docs": {"lastSequence": 7, "lastResult": "triggered"}}}`
+	if err := os.WriteFile(path, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	state, err := loadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(ran, []int{0, 1}) {
+		t.Fatalf("expected every migration from version 0 to run, ran %v", ran)
+	}
+	if state.Version != stateVersion || state.Folders["docs"] == nil || state.Folders["docs"].LastSequence != 7 {
+		t.Fatalf("expected the folder state at version %d, got version %d with %+v", stateVersion, state.Version, state.Folders["docs"])
+	}
+}
+
+func TestStateStoreThrottlesWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	svc := &Service{Settings: Settings{StateFile: path, StateFlushInterval: time.Hour}, Logger: log.New(io.Discard, "", 0)}
+	st := svc.stateStore()
+	_ = st.updateFolder("docs", func(f *FolderState) { f.LastSequence = 1 })
+	_ = st.updateFolder("docs", func(f *FolderState) { f.LastSequence = 2 })
+	if got, _, _ := ReadFolderState(path, "docs"); got.LastSequence != 1 {
+		t.Fatalf("expected only the first write on disk, got %d", got.LastSequence)
+	}
+	if err := svc.FlushState(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if got, _, _ := ReadFolderState(path, "docs"); got.LastSequence != 2 {
+		t.Fatalf("expected flushed state on disk, got %d", got.LastSequence)
+	}
+}
+
+func TestCountersSurviveRestart(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	settings := Settings{StateFile: filepath.Join(t.TempDir(), "state.json")}
+	svc := fake.service(t, settings)
+	svc.triggerScan(context.Background(), "docs")
+	svc.triggerScan(context.Background(), "docs")
+
+	restarted := fake.service(t, settings)
+	restarted.stateStore()
+	snap := restarted.stats.snapshot()
+	if len(snap) != 1 || snap[0].Scans != 2 || snap[0].LastResult != resultTriggered {
+		t.Fatalf("expected counters restored from the state file, got %+v", snap)
+	}
+}
+
+func TestSkipUnchangedSkipsSecondScan(t *testing.T) {
+	fake := newFakeSyncthing(t, "archive")
+	fake.setStatus("archive", syncthing.FolderStatus{State: "idle", Sequence: 10})
+	svc := fake.service(t, Settings{SkipUnchanged: true, SkipUnchangedMax: time.Hour})
+
+	svc.triggerScan(context.Background(), "archive")
+	svc.triggerScan(context.Background(), "archive")
+
+	if got := fake.scanned(); len(got) != 1 {
+		t.Fatalf("expected exactly one scan, got %v", got)
+	}
+}
+
+func TestSkipUnchangedScansWhenSequenceMoves(t *testing.T) {
+	fake := newFakeSyncthing(t, "archive")
+	fake.setStatus("archive", syncthing.FolderStatus{State: "idle", Sequence: 10})
+	svc := fake.service(t, Settings{SkipUnchanged: true, SkipUnchangedMax: time.Hour})
+
+	svc.triggerScan(context.Background(), "archive")
+	fake.setStatus("archive", syncthing.FolderStatus{State: "idle", Sequence: 11})
+	svc.triggerScan(context.Background(), "archive")
+	fake.setStatus("archive", syncthing.FolderStatus{State: "idle", Sequence: 11, ReceiveOnlyChangedFiles: 1})
+	svc.triggerScan(context.Background(), "archive")
+
+	if got := fake.scanned(); len(got) != 3 {
+		t.Fatalf("expected three scans, got %v", got)
+	}
+}
+
+func TestSkipUnchangedForcesScanAfterMax(t *testing.T) {
+	fake := newFakeSyncthing(t, "archive")
+	fake.setStatus("archive", syncthing.FolderStatus{State: "idle", Sequence: 10})
+	svc := fake.service(t, Settings{SkipUnchanged: true, SkipUnchangedMax: time.Hour})
+
+	svc.triggerScan(context.Background(), "archive")
+	_ = svc.stateStore().updateFolder("archive", func(f *FolderState) { f.LastScan = time.Now().Add(-2 * time.Hour) })
+	svc.triggerScan(context.Background(), "archive")
+
+	if got := fake.scanned(); len(got) != 2 {
+		t.Fatalf("expected forced scan, got %v", got)
+	}
+}
+
+func TestSkipUnchangedSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	fake := newFakeSyncthing(t, "archive")
+	fake.setStatus("archive", syncthing.FolderStatus{State: "idle", Sequence: 10})
+	settings := Settings{SkipUnchanged: true, SkipUnchangedMax: time.Hour, StateFile: path}
+
+	fake.service(t, settings).triggerScan(context.Background(), "archive")
+	fake.service(t, settings).triggerScan(context.Background(), "archive")
+
+	if got := fake.scanned(); len(got) != 1 {
+		t.Fatalf("expected one scan across restarts, got %v", got)
+	}
+}
+
+func TestStateRecordsLastOutcomeAndState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	fake := newFakeSyncthing(t, "docs")
+	svc := fake.service(t, Settings{StateFile: path})
+
+	svc.triggerScan(context.Background(), "docs")
+	_ = svc.checkSyncStatus(context.Background(), []string{"docs"}, 0)
+	svc.triggerScan(context.Background(), "missing")
+
+	st, ok, err := ReadFolderState(path, "docs")
+	if err != nil || !ok {
+		t.Fatalf("expected state for docs: %v", err)
+	}
+	if st.LastResult != resultTriggered || st.LastTrigger.IsZero() || st.LastState != "idle" || st.LastStateChanged.IsZero() {
+		t.Fatalf("unexpected docs state: %+v", st)
+	}
+	changed := st.LastStateChanged
+
+	// An unchanged state keeps its original timestamp.
+	_ = svc.checkSyncStatus(context.Background(), []string{"docs"}, 0)
+	if st, _, _ := ReadFolderState(path, "docs"); !st.LastStateChanged.Equal(changed) {
+		t.Fatalf("state change time moved without a change")
+	}
+
+	missing, _, _ := ReadFolderState(path, "missing")
+	if missing.LastResult != resultFailed || missing.LastError == "" {
+		t.Fatalf("expected failure recorded for missing: %+v", missing)
+	}
+}
+
+func TestReadFolderStateIgnoresUnknownFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	doc := `{"version": 99, "future": {"x": 1}, "folders": {"docs": {"lastResult": "triggered", "newField": [1, 2]}}}`
+	if err := os.WriteFile(path, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	st, ok, err := ReadFolderState(path, "docs")
+	if err != nil || !ok || st.LastResult != "triggered" {
+		t.Fatalf("expected graceful read, got %+v ok=%v err=%v", st, ok, err)
+	}
+	if _, ok, err := ReadFolderState(path, "other"); err != nil || ok {
+		t.Fatalf("expected unknown folder to be reported as missing, got ok=%v err=%v", ok, err)
+	}
+}
@@ -0,0 +1,224 @@
+package app
+
+import (
+	"math/bits"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+// Scan outcomes recorded per folder.
+const (
+	resultTriggered     = "triggered"
+	resultTimeout       = "timeout"
+	resultFailed        = "failed"
+	resultSkipped       = "skipped"
+	resultDryRun        = "dry-run"
+	resultAbandoned     = "abandoned"      // the run's deadline or shutdown cut the attempt short
+	resultUnknownFolder = "unknown_folder" // not in Syncthing's folder list; never sent
+)
+
+// FolderStats is the in-memory view of a folder exposed over the admin API.
+type FolderStats struct {
+	Folder      string    `json:"folder"`
+	Instance    string    `json:"instance"`
+	LastTrigger time.Time `json:"lastTrigger,omitempty"`
+	LastScan    time.Time `json:"lastScan,omitempty"` // last trigger Syncthing accepted
+	LastResult  string    `json:"lastResult,omitempty"`
+	LastRun     string    `json:"lastRun,omitempty"` // ID of the run that made the last trigger attempt
+	LastError   string    `json:"lastError,omitempty"`
+	State       string    `json:"state,omitempty"`
+	NeedBytes   int64     `json:"needBytes"`
+	InSyncBytes int64     `json:"inSyncBytes"`
+	// What the folder needs, by type, as of the last status check.
+	NeedFiles       int64     `json:"needFiles"`
+	NeedDirectories int64     `json:"needDirectories"`
+	NeedSymlinks    int64     `json:"needSymlinks"`
+	NeedDeletes     int64     `json:"needDeletes"`
+	LastStatus      time.Time `json:"lastStatus,omitempty"`
+	// SyncthingLastScan is Syncthing's own last completed scan (/rest/stats/folder),
+	// tracked when ST_STALE_SCAN_WARN is set; Stale means it is older than that.
+	SyncthingLastScan time.Time `json:"syncthingLastScan,omitempty"`
+	Stale             bool      `json:"stale,omitempty"`
+	Scans             int64     `json:"scans"`
+	Failures          int64     `json:"failures"`
+	Skips             int64     `json:"skips"`
+	Timeouts          int64     `json:"timeouts"` // triggers that timed out, whatever ST_SCAN_TIMEOUT_POLICY made of them
+	UnknownFolder     int64     `json:"unknownFolder"`
+
+	latency latencyHistogram // with ST_SCAN_LATENCY_BUDGET
+
+	// What the last logged status line showed, for ST_LOG_ON_CHANGE.
+	logged   statusLogKey
+	loggedAt time.Time
+}
+
+// statusLogKey is the part of a folder status that decides whether it is worth logging.
+type statusLogKey struct {
+	state      string
+	needBucket int // log2 of needBytes, so only doubling or halving counts as a change
+	errors     int64
+}
+
+// folderStats tracks per-folder outcomes. The zero value is ready to use.
+type folderStats struct {
+	mu      sync.Mutex
+	folders map[string]*FolderStats
+}
+
+func (t *folderStats) get(folder string) *FolderStats {
+	if t.folders == nil {
+		t.folders = map[string]*FolderStats{}
+	}
+	f := t.folders[folder]
+	if f == nil {
+		f = &FolderStats{Folder: folder}
+		t.folders[folder] = f
+	}
+	return f
+}
+
+func (t *folderStats) recordScan(folder, runID, result string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f := t.get(folder)
+	f.LastTrigger = time.Now().UTC()
+	f.LastResult = result
+	f.LastRun = runID
+	f.LastError = ""
+	if timedOut(result, err) {
+		f.Timeouts++
+	}
+	switch result {
+	case resultTriggered, resultTimeout:
+		f.Scans++
+		f.LastScan = f.LastTrigger
+	case resultFailed:
+		f.Failures++
+		if err != nil {
+			f.LastError = err.Error()
+		}
+	case resultSkipped:
+		f.Skips++
+	case resultUnknownFolder:
+		f.UnknownFolder++
+	}
+}
+
+// failTimeout turns the folder's last outcome, a timed-out trigger, into a failure.
+func (t *folderStats) failTimeout(folder string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f := t.get(folder)
+	if f.LastResult != resultTimeout {
+		return
+	}
+	f.Scans--
+	f.Failures++
+	f.LastResult = resultFailed
+	f.LastError = err.Error()
+}
+
+// seed restores a folder's counters and last outcome from the state file.
+func (t *folderStats) seed(folder string, st FolderState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f := t.get(folder)
+	f.Scans, f.Failures, f.Skips = st.Scans, st.Failures, st.Skips
+	f.LastTrigger, f.LastResult, f.LastError = st.LastTrigger, st.LastResult, st.LastError
+	if st.LastResult == resultTriggered || st.LastResult == resultTimeout {
+		f.LastScan = st.LastTrigger
+	}
+	f.State = st.LastState
+}
+
+func (t *folderStats) recordStatus(folder string, st syncthing.FolderStatus) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f := t.get(folder)
+	f.State = st.State
+	f.NeedBytes = st.NeedBytes
+	f.InSyncBytes = st.InSyncBytes
+	f.NeedFiles, f.NeedDirectories, f.NeedSymlinks, f.NeedDeletes = st.NeedFiles, st.NeedDirectories, st.NeedSymlinks, st.NeedDeletes
+	f.LastStatus = time.Now().UTC()
+}
+
+func (t *folderStats) recordLastScan(folder string, lastScan time.Time, stale bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f := t.get(folder)
+	f.SyncthingLastScan = lastScan
+	f.Stale = stale
+}
+
+// staleFolders returns the folders whose last Syncthing scan is too old, sorted.
+func (t *folderStats) staleFolders() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var out []string
+	for _, f := range t.folders {
+		if f.Stale {
+			out = append(out, f.Folder)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// statusChanged reports whether st differs materially from the last status logged for
+// folder, or heartbeat has passed since that line. The first observation always counts.
+func (t *folderStats) statusChanged(folder string, st syncthing.FolderStatus, heartbeat time.Duration, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f := t.get(folder)
+	key := statusLogKey{state: st.State, needBucket: bits.Len64(uint64(max(st.NeedBytes, 0))), errors: st.Errors}
+	if !f.loggedAt.IsZero() && key == f.logged && (heartbeat <= 0 || now.Sub(f.loggedAt) < heartbeat) {
+		return false
+	}
+	f.logged = key
+	f.loggedAt = now
+	return true
+}
+
+// forget drops a folder, e.g. once Syncthing no longer knows it.
+func (t *folderStats) forget(folder string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.folders, folder)
+}
+
+// retain drops the folders for which keep returns false.
+func (t *folderStats) retain(keep func(folder string) bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for folder := range t.folders {
+		if !keep(folder) {
+			delete(t.folders, folder)
+		}
+	}
+}
+
+// lookup returns a copy of folder's stats, if it is tracked.
+func (t *folderStats) lookup(folder string) (FolderStats, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f, ok := t.folders[folder]
+	if !ok {
+		return FolderStats{}, false
+	}
+	return *f, true
+}
+
+// snapshot returns a copy of all tracked folders sorted by ID.
+func (t *folderStats) snapshot() []FolderStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]FolderStats, 0, len(t.folders))
+	for _, f := range t.folders {
+		out = append(out, *f)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Folder < out[j].Folder })
+	return out
+}
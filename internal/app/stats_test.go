@@ -0,0 +1,143 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+	"github.com/rcarmo/syncthing-kicker/internal/syncthingtest"
+)
+
+func TestStatusChangedSequence(t *testing.T) {
+	var stats folderStats
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	idle := syncthing.FolderStatus{State: "idle"}
+
+	steps := []struct {
+		st    syncthing.FolderStatus
+		after time.Duration
+		want  bool
+	}{
+		{idle, 0, true},            // first observation always logs
+		{idle, time.Minute, false}, // unchanged
+		{syncthing.FolderStatus{State: "syncing", NeedBytes: 1000}, time.Minute, true},
+		{syncthing.FolderStatus{State: "syncing", NeedBytes: 900}, time.Minute, false}, // same bucket
+		{syncthing.FolderStatus{State: "syncing", NeedBytes: 400}, time.Minute, true},  // halved
+		{syncthing.FolderStatus{State: "syncing", NeedBytes: 400, Errors: 2}, time.Minute, true},
+		{idle, time.Minute, true},
+		{idle, 23 * time.Hour, false},
+		{idle, 2 * time.Hour, true}, // heartbeat elapsed
+	}
+	for i, step := range steps {
+		now = now.Add(step.after)
+		if got := stats.statusChanged("docs", step.st, 24*time.Hour, now); got != step.want {
+			t.Fatalf("step %d (%+v): got %v, want %v", i, step.st, got, step.want)
+		}
+	}
+	if !stats.statusChanged("photos", idle, 24*time.Hour, now) {
+		t.Fatalf("folders must be tracked independently")
+	}
+}
+
+func TestLogOnChangeSuppressesRepeatedStatusLines(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	var buf bytes.Buffer
+	svc := fake.service(t, Settings{LogOnChange: true, LogHeartbeat: 24 * time.Hour})
+	svc.Logger = log.New(&buf, "", 0)
+
+	for i := 0; i < 3; i++ {
+		_ = svc.checkSyncStatus(context.Background(), []string{"docs"}, 0)
+	}
+	fake.setStatus("docs", syncthing.FolderStatus{State: "syncing", NeedBytes: 10})
+	_ = svc.checkSyncStatus(context.Background(), []string{"docs"}, 0)
+
+	if got := strings.Count(buf.String(), "Folder docs status"); got != 2 {
+		t.Fatalf("expected 2 status lines, got %d:\n%s", got, buf.String())
+	}
+}
+
+func TestFolderStatusNeedBreakdown(t *testing.T) {
+	// A /rest/db/status response in the shape Syncthing 1.27 sends.
+	raw, err := os.ReadFile(filepath.Join("testdata", "syncthing", "db_status.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var st syncthing.FolderStatus
+	if err := json.Unmarshal(raw, &st); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if st.NeedFiles != 3 || st.NeedDirectories != 2 || st.NeedSymlinks != 1 || st.NeedDeletes != 1200 || st.NeedBytes != 153773 {
+		t.Fatalf("unexpected need breakdown: %+v", st)
+	}
+
+	// Serve the capture itself rather than re-encoding the decoded struct.
+	srv := syncthingtest.New(t, "docs")
+	if err := srv.Replay(filepath.Join("testdata", "syncthing")); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	svc := harnessService(t, srv, Settings{})
+	svc.Logger = log.New(&buf, "", 0)
+	if err := svc.checkSyncStatus(context.Background(), []string{"docs"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "needBytes=153773 inSyncBytes=5839000000 needFiles=3 needDirectories=2 needSymlinks=1 needDeletes=1200") {
+		t.Fatalf("expected the breakdown in the status line:\n%s", buf.String())
+	}
+	rec := httptest.NewRecorder()
+	svc.handleStatus(rec, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+	if !strings.Contains(rec.Body.String(), `"needFiles":3,"needDirectories":2,"needSymlinks":1,"needDeletes":1200`) {
+		t.Fatalf("expected the breakdown in /api/status:\n%s", rec.Body.String())
+	}
+}
+
+func TestRecordedStatusReplaysTheSame(t *testing.T) {
+	upstream := syncthingtest.New(t, "docs")
+	upstream.SetStatus("docs", syncthing.FolderStatus{State: "syncing", NeedBytes: 2048, NeedFiles: 4, InSyncBytes: 1 << 20})
+	dir := t.TempDir()
+	proxy := syncthingtest.Record(t, upstream.URL, syncthingtest.APIKey, dir)
+	client, err := syncthing.NewClient(proxy.URL, syncthingtest.APIKey, syncthing.ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(client *syncthing.Client) string {
+		var buf bytes.Buffer
+		svc := &Service{Settings: Settings{}, Client: client, Logger: log.New(&buf, "", 0)}
+		if err := svc.checkSyncStatus(context.Background(), []string{"docs"}, 0); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	live := check(client)
+	if _, err := os.Stat(filepath.Join(dir, "db_status@docs.json")); err != nil {
+		t.Fatalf("expected the status to be recorded: %v", err)
+	}
+
+	replay := syncthingtest.New(t, "docs")
+	if err := replay.Replay(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := check(replay.Client(t)); got != live || !strings.Contains(got, "needBytes=2048") {
+		t.Fatalf("replayed check differs:\n%s\nlive:\n%s", got, live)
+	}
+}
+
+func TestCheckNeedFilesIgnoresPendingDeletes(t *testing.T) {
+	deletes := syncthing.FolderStatus{State: "idle", NeedBytes: 153600, NeedDeletes: 1200}
+	if !folderUnhealthy(deletes, false) || folderUnhealthy(deletes, true) {
+		t.Fatalf("expected pending deletes to count only without ST_CHECK_NEED=files")
+	}
+	if files := (syncthing.FolderStatus{State: "idle", NeedBytes: 10, NeedFiles: 1}); !folderUnhealthy(files, true) {
+		t.Fatalf("expected a needed file to count with ST_CHECK_NEED=files")
+	}
+}
@@ -0,0 +1,185 @@
+package app
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// statsdQueue bounds the packets waiting to be sent; further metrics are dropped.
+const statsdQueue = 256
+
+// StatsD sends metrics over UDP to a StatsD server. Sending never blocks the
+// caller: packets are queued and written by a background goroutine, and dropped
+// when the queue is full. A nil *StatsD discards everything.
+type StatsD struct {
+	prefix string
+	tags   bool // DogStatsD "|#k:v" tags instead of tag values in the metric name
+	conn   net.Conn
+	done   chan struct{}
+	closed sync.Once
+
+	mu    sync.RWMutex
+	queue chan string // nil once closed
+}
+
+// NewStatsD connects to addr (host:port). With tags set, folder and instance travel
+// as DogStatsD tags; otherwise they are appended to the metric name.
+func NewStatsD(addr, prefix string, tags bool) (*StatsD, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("statsd: %w", err)
+	}
+	d := &StatsD{
+		prefix: strings.TrimSuffix(prefix, "."),
+		tags:   tags,
+		conn:   conn,
+		queue:  make(chan string, statsdQueue),
+		done:   make(chan struct{}),
+	}
+	go d.loop(d.queue)
+	return d, nil
+}
+
+func (d *StatsD) loop(queue <-chan string) {
+	defer close(d.done)
+	for pkt := range queue {
+		_, _ = d.conn.Write([]byte(pkt))
+	}
+}
+
+// Close sends what is still queued and closes the socket. Later metrics are dropped.
+func (d *StatsD) Close() error {
+	if d == nil {
+		return nil
+	}
+	var err error
+	d.closed.Do(func() {
+		d.mu.Lock()
+		close(d.queue)
+		d.queue = nil
+		d.mu.Unlock()
+		<-d.done
+		err = d.conn.Close()
+	})
+	return err
+}
+
+// statsdTag is one tag; its value also becomes a name segment without DogStatsD.
+type statsdTag struct{ key, value string }
+
+func (d *StatsD) Count(name string, n int64, tags ...statsdTag) {
+	d.send(name, fmt.Sprintf("%d|c", n), tags)
+}
+
+func (d *StatsD) Timing(name string, v time.Duration, tags ...statsdTag) {
+	d.send(name, fmt.Sprintf("%d|ms", v.Milliseconds()), tags)
+}
+
+func (d *StatsD) Gauge(name string, v int64, tags ...statsdTag) {
+	d.send(name, fmt.Sprintf("%d|g", v), tags)
+}
+
+func (d *StatsD) send(name, value string, tags []statsdTag) {
+	if d == nil {
+		return
+	}
+	pkt := d.format(name, value, tags)
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.queue == nil {
+		return
+	}
+	select {
+	case d.queue <- pkt:
+	default:
+	}
+}
+
+// format renders one packet, e.g. "kicker.scans:1|c|#folder:docs,instance:default"
+// with tags or "kicker.scans.default.docs:1|c" without.
+func (d *StatsD) format(name, value string, tags []statsdTag) string {
+	var b strings.Builder
+	if d.prefix != "" {
+		b.WriteString(d.prefix + ".")
+	}
+	b.WriteString(name)
+	if !d.tags {
+		for _, t := range tags {
+			b.WriteString("." + statsdSanitize(t.value))
+		}
+	}
+	b.WriteString(":" + value)
+	if d.tags && len(tags) > 0 {
+		b.WriteString("|#")
+		for i, t := range tags {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(t.key + ":" + statsdSanitize(t.value))
+		}
+	}
+	return b.String()
+}
+
+// statsdSanitize replaces characters with a meaning in the StatsD line protocol.
+func statsdSanitize(v string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', '@', '#', ',', '.', '/', ' ', '\n':
+			return '_'
+		}
+		return r
+	}, v)
+}
+
+// folderTags tags metrics for a folder reference with its instance and ID.
+func (s *Service) folderTags(ref string) []statsdTag {
+	inst, id := s.splitRef(ref)
+	return []statsdTag{{"instance", instanceName(inst)}, {"folder", id}}
+}
+
+// statsdScan emits the counters and timer for one trigger attempt.
+func (s *Service) statsdScan(ref, result string, err error, d time.Duration) {
+	if s.StatsD == nil || result == resultDryRun || result == resultAbandoned {
+		return
+	}
+	if _, id := s.splitRef(ref); id == "*" {
+		return
+	}
+	tags := s.folderTags(ref)
+	if timedOut(result, err) {
+		s.StatsD.Count("timeouts", 1, tags...)
+	}
+	switch result {
+	case resultUnknownFolder:
+		s.StatsD.Count("unknown_folders", 1, tags...)
+		return
+	case resultFailed:
+		s.StatsD.Count("failures", 1, tags...)
+	case resultSkipped:
+		s.StatsD.Count("skips", 1, tags...)
+	default:
+		s.StatsD.Count("scans", 1, tags...)
+	}
+	s.StatsD.Timing("scan.duration", d, tags...)
+}
+
+// ObserveRequest returns a syncthing.ClientOptions.OnRequest hook timing the API
+// requests made to instance.
+func (s *Service) ObserveRequest(instance string) func(method, path string, status int, d time.Duration, err error) {
+	return func(method, path string, status int, d time.Duration, err error) {
+		endpoint := strings.Trim(path, "/")
+		for _, prefix := range []string{"rest/config/folders", "rest/config/devices"} {
+			if strings.HasPrefix(endpoint, prefix+"/") {
+				endpoint = prefix // one series for all folders or devices
+			}
+		}
+		s.StatsD.Timing("api.latency", d, statsdTag{"instance", instance}, statsdTag{"endpoint", endpoint})
+		if err != nil {
+			s.StatsD.Count("api.errors", 1, statsdTag{"instance", instance}, statsdTag{"endpoint", endpoint})
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package app
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+// listenStatsD returns a local UDP listener and a function collecting every packet
+// received until nothing arrives for a short while.
+func listenStatsD(t *testing.T) (string, func() []string) {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	return pc.LocalAddr().String(), func() []string {
+		var out []string
+		buf := make([]byte, 1500)
+		for {
+			_ = pc.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+			n, _, err := pc.ReadFrom(buf)
+			if err != nil {
+				return out
+			}
+			out = append(out, string(buf[:n]))
+		}
+	}
+}
+
+func TestStatsDWireFormat(t *testing.T) {
+	addr, read := listenStatsD(t)
+	fake := newFakeSyncthing(t, "docs")
+	fake.setStatus("docs", syncthing.FolderStatus{State: "idle", NeedBytes: 42})
+	svc := fake.service(t, Settings{})
+	d, err := NewStatsD(addr, "kicker.", true)
+	if err != nil {
+		t.Fatalf("new statsd: %v", err)
+	}
+	svc.StatsD = d
+	svc.Client, err = syncthing.NewClient(fake.srv.URL, "test-key", syncthing.ClientOptions{OnRequest: svc.ObserveRequest("default")})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+
+	if got := svc.triggerScan(context.Background(), "docs"); got != resultTriggered {
+		t.Fatalf("unexpected result %q", got)
+	}
+	_ = svc.checkSyncStatus(context.Background(), []string{"docs"}, 0)
+	if err := d.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	d.Count("after_close", 1) // dropped, must not panic
+
+	pkts := read()
+	for _, want := range []string{
+		"kicker.scans:1|c|#instance:default,folder:docs",
+		"kicker.need_bytes:42|g|#instance:default,folder:docs",
+	} {
+		if !slices.Contains(pkts, want) {
+			t.Fatalf("missing %q in %q", want, pkts)
+		}
+	}
+	var timers []string
+	for _, p := range pkts {
+		if strings.Contains(p, "|ms|") {
+			timers = append(timers, p[:strings.Index(p, ":")]+p[strings.Index(p, "|"):])
+		}
+	}
+	for _, want := range []string{
+		"kicker.scan.duration|ms|#instance:default,folder:docs",
+		"kicker.api.latency|ms|#instance:default,endpoint:rest_db_scan",
+		"kicker.api.latency|ms|#instance:default,endpoint:rest_db_status",
+	} {
+		if !slices.Contains(timers, want) {
+			t.Fatalf("missing timer %q in %q", want, timers)
+		}
+	}
+}
+
+func TestStatsDFormatWithoutTags(t *testing.T) {
+	d := &StatsD{prefix: "kicker"}
+	got := d.format("scans", "1|c", []statsdTag{{"instance", "nas"}, {"folder", "photos.raw"}})
+	if got != "kicker.scans.nas.photos_raw:1|c" {
+		t.Fatalf("unexpected packet %q", got)
+	}
+	var nilD *StatsD
+	nilD.Gauge("need_bytes", 1) // no-op
+}
@@ -0,0 +1,78 @@
+package app
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+// statusCache shares /rest/db/status results between consumers for
+// ST_STATUS_CACHE: a status fetched within that window is reused, and concurrent
+// requests for the same folder share one upstream call. Only successful fetches
+// are kept. The zero value is ready to use.
+type statusCache struct {
+	mu      sync.Mutex
+	entries map[string]*statusFetch
+	now     func() time.Time // for tests; defaults to time.Now
+}
+
+// statusFetch is one upstream status request, in flight until done is closed.
+type statusFetch struct {
+	done      chan struct{}
+	status    syncthing.FolderStatus
+	err       error
+	fetchedAt time.Time
+}
+
+func (c *statusCache) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// folderStatus returns ref's status, reusing one fetched within ST_STATUS_CACHE or
+// joining a fetch already in flight. fresh always fetches, for callers that need
+// the state after something they just did, such as the follow-up check after a
+// scan; the result still refreshes the cache for everyone else.
+func (s *Service) folderStatus(ctx context.Context, ref string, timeout time.Duration, fresh bool) (syncthing.FolderStatus, error) {
+	inst, id := s.splitRef(ref)
+	ttl := s.Settings.StatusCacheTTL
+	if ttl <= 0 {
+		st, _, err := s.client(inst).FolderStatus(ctx, id, timeout)
+		return st, err
+	}
+
+	c := &s.statuses
+	c.mu.Lock()
+	if c.entries == nil {
+		c.entries = map[string]*statusFetch{}
+	}
+	if f := c.entries[ref]; f != nil && !fresh {
+		select {
+		case <-f.done:
+			if f.err == nil && c.clock().Sub(f.fetchedAt) < ttl {
+				c.mu.Unlock()
+				return f.status, nil
+			}
+		default:
+			c.mu.Unlock()
+			select {
+			case <-f.done:
+				return f.status, f.err
+			case <-ctx.Done():
+				return syncthing.FolderStatus{}, ctx.Err()
+			}
+		}
+	}
+	f := &statusFetch{done: make(chan struct{})}
+	c.entries[ref] = f
+	c.mu.Unlock()
+
+	f.status, _, f.err = s.client(inst).FolderStatus(ctx, id, timeout)
+	f.fetchedAt = c.clock()
+	close(f.done)
+	return f.status, f.err
+}
@@ -0,0 +1,65 @@
+package app
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentStatusChecksShareOneRequest(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs", "media")
+	fake.statusDelay = 50 * time.Millisecond
+	svc := fake.service(t, Settings{StatusCacheTTL: 2 * time.Second})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = svc.checkSyncStatus(context.Background(), []string{"docs", "media"}, 0)
+		}()
+	}
+	wg.Wait()
+	if got := fake.count("/rest/db/status"); got != 2 {
+		t.Fatalf("expected one status request per folder, got %d", got)
+	}
+
+	// Within the TTL later checks reuse the result; the post-scan check does not.
+	_ = svc.checkSyncStatus(context.Background(), []string{"docs"}, 0)
+	if got := fake.count("/rest/db/status"); got != 2 {
+		t.Fatalf("expected the cached status reused, got %d requests", got)
+	}
+	_ = svc.checkStatuses(context.Background(), []string{"docs"}, 0, true, nil)
+	if got := fake.count("/rest/db/status"); got != 3 {
+		t.Fatalf("expected a fresh check to bypass the cache, got %d requests", got)
+	}
+}
+
+func TestStatusCacheExpires(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	svc := fake.service(t, Settings{StatusCacheTTL: 2 * time.Second})
+	svc.statuses.now = clock.now
+
+	_ = svc.checkSyncStatus(context.Background(), []string{"docs"}, 0)
+	clock.advance(time.Second)
+	_ = svc.checkSyncStatus(context.Background(), []string{"docs"}, 0)
+	clock.advance(time.Second)
+	_ = svc.checkSyncStatus(context.Background(), []string{"docs"}, 0)
+	if got := fake.count("/rest/db/status"); got != 2 {
+		t.Fatalf("expected a refetch once the TTL ran out, got %d requests", got)
+	}
+}
+
+func TestStatusCacheDisabled(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	svc := fake.service(t, Settings{})
+
+	for i := 0; i < 3; i++ {
+		_ = svc.checkSyncStatus(context.Background(), []string{"docs"}, 0)
+	}
+	if got := fake.count("/rest/db/status"); got != 3 {
+		t.Fatalf("expected every check to fetch, got %d requests", got)
+	}
+}
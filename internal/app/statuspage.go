@@ -0,0 +1,159 @@
+package app
+
+import (
+	"html/template"
+	"net/http"
+	"slices"
+	"time"
+)
+
+const (
+	statusPageRefresh = 30 // seconds between automatic reloads
+	statusPageRuns    = 20 // most recent runs shown
+)
+
+// statusPage is what the HTML status page at / renders.
+type statusPage struct {
+	Now     time.Time
+	Refresh int
+	Health  HealthLevel
+	Folders []statusPageFolder
+	Runs    []RunRecord // newest first
+}
+
+// statusPageFolder is a folder's /api/status entry with when its next scan would
+// really go ahead and, in Note, what holds it back or may still skip it.
+type statusPageFolder struct {
+	FolderStats
+	NextScan time.Time
+	Note     string
+}
+
+var statusPageTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"bytes": formatBytes,
+	"when": func(t time.Time) string {
+		if t.IsZero() {
+			return "—"
+		}
+		return t.UTC().Format("2006-01-02 15:04:05") + " UTC"
+	},
+	"ago": func(now, t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		if d := now.Sub(t).Round(time.Second); d >= 0 {
+			return d.String() + " ago"
+		}
+		return "in " + t.Sub(now).Round(time.Second).String()
+	},
+	"duration": func(ms int64) string { return (time.Duration(ms) * time.Millisecond).String() },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.Refresh}}">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>syncthing-kicker: {{.Health.Level}}</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 1.5em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { padding: .3em .8em; border-bottom: 1px solid #ddd; text-align: left; vertical-align: top; }
+th { background: #f4f4f4; }
+td.num { text-align: right; }
+small { color: #777; }
+.healthy { color: #1a7f37; } .degraded { color: #9a6700; } .unhealthy { color: #cf222e; }
+.failed, .error { color: #cf222e; }
+</style>
+</head>
+<body>
+<h1>syncthing-kicker</h1>
+<p>Health: <strong class="{{.Health.Level}}">{{.Health.Level}}</strong>{{with .Health.Reason}} — {{.}}{{end}}
+{{- if not .Health.Since.IsZero}} <small>since {{when .Health.Since}}</small>{{end}}</p>
+<p><small>As of {{when .Now}}; this page reloads every {{.Refresh}}s.</small></p>
+
+<h2>Folders</h2>
+{{- if .Folders}}
+<table>
+<tr><th>Folder</th><th>Instance</th><th>State</th><th>Needs</th><th>Last scan</th><th>Last result</th><th>Next scan</th></tr>
+{{- range .Folders}}
+<tr>
+<td>{{.Folder}}</td>
+<td>{{.Instance}}</td>
+<td class="{{.State}}">{{or .State "—"}}</td>
+<td class="num">{{bytes .NeedBytes}}</td>
+<td>{{when .LastScan}}{{with ago $.Now .LastScan}}<br><small>{{.}}</small>{{end}}</td>
+<td class="{{.LastResult}}">{{or .LastResult "—"}}{{with .LastError}}<br><small>{{.}}</small>{{end}}</td>
+<td>{{when .NextScan}}{{with ago $.Now .NextScan}}<br><small>{{.}}</small>{{end}}{{with .Note}}<br><small>{{.}}</small>{{end}}</td>
+</tr>
+{{- end}}
+</table>
+{{- else}}
+<p>No folder has been scanned yet.</p>
+{{- end}}
+
+<h2>Recent runs</h2>
+{{- if .Runs}}
+<table>
+<tr><th>Run</th><th>Started</th><th>Source</th><th>Duration</th><th>Folders</th></tr>
+{{- range .Runs}}
+<tr>
+<td>{{.ID}}</td>
+<td>{{when .Started}}</td>
+<td>{{.Label}}</td>
+<td class="num">{{duration .DurationMs}}</td>
+<td>{{range $i, $f := .Folders}}{{if $i}}, {{end}}{{$f.Folder}}: <span class="{{$f.Result}}">{{$f.Result}}</span>{{with $f.Settled}} ({{.}}){{end}}{{end}}</td>
+</tr>
+{{- end}}
+</table>
+{{- else}}
+<p>No runs yet.</p>
+{{- end}}
+</body>
+</html>
+`))
+
+// statusPage gathers the page's data from the same structures as /api/status,
+// /api/history and /api/schedules.
+func (s *Service) statusPage(health HealthLevel) statusPage {
+	page := statusPage{Now: time.Now(), Refresh: statusPageRefresh, Health: health}
+
+	plans := s.scanPlans()
+	for _, f := range s.stats.snapshot() {
+		inst, id := s.splitRef(f.Folder)
+		if id == "*" {
+			continue
+		}
+		f.Instance = instanceName(inst)
+		plan := plans[f.Folder]
+		page.Folders = append(page.Folders, statusPageFolder{FolderStats: f, NextScan: plan.Next, Note: plan.note()})
+	}
+
+	runs := s.recentRuns().list()
+	slices.Reverse(runs)
+	page.Runs = runs[:min(len(runs), statusPageRuns)]
+	return page
+}
+
+// coveredBy reports whether the ST_FOLDERS selectors pick folder, a reference on
+// instance inst, directly or through a wildcard, without excluding it.
+func coveredBy(selectors []string, inst, folder string) bool {
+	covered := false
+	for _, sel := range selectors {
+		switch sel {
+		case "!" + folder:
+			return false
+		case folder, joinRef(inst, "*"):
+			covered = true
+		}
+	}
+	return covered
+}
+
+// handleStatusPage serves the HTML status page.
+func (s *Service) handleStatusPage(w http.ResponseWriter, r *http.Request) {
+	page := s.statusPage(s.updateHealthLevel(r.Context()))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := statusPageTemplate.Execute(w, page); err != nil {
+		s.Logger.Printf("Failed to render the status page: %v", err)
+	}
+}
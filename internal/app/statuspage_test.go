@@ -0,0 +1,131 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusPageGolden(t *testing.T) {
+	now := time.Date(2024, 5, 1, 3, 0, 0, 0, time.UTC)
+	page := statusPage{
+		Now:     now,
+		Refresh: statusPageRefresh,
+		Health:  HealthLevel{Level: levelDegraded, Reason: "folder photos <out of sync>", Since: now.Add(-10 * time.Minute)},
+		Folders: []statusPageFolder{
+			{
+				FolderStats: FolderStats{Folder: "docs", Instance: "default", State: "idle", LastScan: now.Add(-90 * time.Second), LastResult: "ok"},
+				NextScan:    now.Add(time.Hour),
+			},
+			{
+				FolderStats: FolderStats{Folder: "nas/photos", Instance: "nas", State: "error", NeedBytes: 3 << 30, LastResult: "failed", LastError: "connection refused"},
+				Note:        "held by pause window 01:00-07:00",
+			},
+		},
+		Runs: []RunRecord{
+			{ID: "b2", Started: now.Add(-90 * time.Second), Label: "global", DurationMs: 1500, Folders: []RunFolderResult{
+				{Folder: "docs", Result: resultTriggered, Settled: "idle"},
+				{Folder: "nas/photos", Result: "failed"},
+			}},
+			{ID: "a1", Started: now.Add(-time.Hour), Label: "startup", DurationMs: 20},
+		},
+	}
+	var buf bytes.Buffer
+	if err := statusPageTemplate.Execute(&buf, page); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+
+	path := filepath.Join("testdata", "statuspage.golden")
+	if *updateGolden {
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden file: %v", err)
+	}
+	if buf.String() != string(want) {
+		t.Fatalf("rendered status page mismatch\ngot:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestStatusPageServedBehindToken(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs", "photos")
+	svc := fake.service(t, Settings{AdminToken: "s3cret", CronExpr: "0 5 * * *", Folders: []string{"*", "!photos"}})
+	sched, err := svc.buildCronScheduler(make(chan struct{}, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.cron = sched
+	_ = svc.triggerScans(context.Background(), "global", []string{"docs", "photos"}, nil)
+	svc.statusChecks.Wait()
+	h := svc.adminHandler(context.Background(), make(chan struct{}, 1))
+
+	if rec := adminRequest(t, h, http.MethodGet, "/", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", rec.Code)
+	}
+	rec := adminRequest(t, h, http.MethodGet, "/", "s3cret", "")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("expected an HTML page, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), "<td>docs</td>") || !strings.Contains(rec.Body.String(), "global") {
+		t.Fatalf("expected docs and the run in the page:\n%s", rec.Body.String())
+	}
+	if rec := adminRequest(t, h, http.MethodGet, "/nope", "s3cret", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for other paths, got %d", rec.Code)
+	}
+
+	page := svc.statusPage(HealthLevel{})
+	next := map[string]bool{}
+	for _, f := range page.Folders {
+		next[f.Folder] = !f.NextScan.IsZero()
+	}
+	if !next["docs"] || next["photos"] {
+		t.Fatalf("expected only docs to have a next ST_CRON scan, got %v", next)
+	}
+	if !strings.Contains(rec.Body.String(), "held by no schedule scans it") {
+		t.Fatalf("expected photos to say why it has no next scan:\n%s", rec.Body.String())
+	}
+}
+
+func TestStatusPageTokenFromQueryAndCookie(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	svc := fake.service(t, Settings{AdminToken: "s3cret"})
+	h := svc.adminHandler(context.Background(), make(chan struct{}, 1))
+
+	if rec := adminRequest(t, h, http.MethodGet, "/?token=wrong", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with a wrong query token, got %d", rec.Code)
+	}
+	rec := adminRequest(t, h, http.MethodGet, "/?token=s3cret", "", "")
+	cookies := rec.Result().Cookies()
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/" || len(cookies) != 1 || !cookies[0].HttpOnly {
+		t.Fatalf("expected a redirect setting the token cookie, got %d %q %v", rec.Code, rec.Header().Get("Location"), cookies)
+	}
+
+	request := func(path string, c *http.Cookie) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.AddCookie(c)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := request("/", cookies[0]); code != http.StatusOK {
+		t.Fatalf("expected the cookie to open the status page, got %d", code)
+	}
+	if code := request("/api/status", cookies[0]); code != http.StatusUnauthorized {
+		t.Fatalf("the cookie must not open the API, got %d", code)
+	}
+	if code := request("/", &http.Cookie{Name: statusPageCookie, Value: "wrong"}); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with a wrong cookie, got %d", code)
+	}
+	if rec := adminRequest(t, h, http.MethodGet, "/api/status?token=s3cret", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("a query token must not open the API, got %d", rec.Code)
+	}
+}
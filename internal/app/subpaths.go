@@ -0,0 +1,37 @@
+package app
+
+import "fmt"
+
+// nextSubpath returns the sub-path to scan on this tick for folder in round-robin order,
+// or "" for a full scan. Every SubpathFullEvery complete rounds one tick is a full scan.
+func (s *Service) nextSubpath(folder string) string {
+	subs := s.Settings.FolderSubpaths[folder]
+	if len(subs) == 0 {
+		return ""
+	}
+	pos := s.stateStore().folder(folder).SubpathPosition
+	if pos < 0 {
+		pos = 0
+	}
+	period := len(subs)
+	if n := s.Settings.SubpathFullEvery; n > 0 {
+		period = n*len(subs) + 1
+	}
+	pos %= period
+	if pos == len(subs)*s.Settings.SubpathFullEvery && s.Settings.SubpathFullEvery > 0 {
+		return ""
+	}
+	return subs[pos%len(subs)]
+}
+
+// scanScope describes which part of a folder a scan covers, for log lines.
+func (s *Service) scanScope(folder, sub string) string {
+	switch {
+	case sub != "":
+		return fmt.Sprintf(" (sub-path '%s')", sub)
+	case len(s.Settings.FolderSubpaths[folder]) > 0:
+		return " (full scan)"
+	default:
+		return ""
+	}
+}
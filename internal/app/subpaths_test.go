@@ -0,0 +1,66 @@
+package app
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSubpathRoundRobinWithPeriodicFullScan(t *testing.T) {
+	fake := newFakeSyncthing(t, "media")
+	svc := fake.service(t, Settings{
+		FolderSubpaths:   map[string][]string{"media": {"movies", "tv", "music"}},
+		SubpathFullEvery: 2,
+	})
+
+	for i := 0; i < 9; i++ {
+		svc.triggerScan(context.Background(), "media")
+	}
+
+	want := []string{"movies", "tv", "music", "movies", "tv", "music", "", "movies", "tv"}
+	if got := fake.scannedSubs(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("sub-path order mismatch:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestSubpathRoundRobinWithoutFullScans(t *testing.T) {
+	fake := newFakeSyncthing(t, "media")
+	svc := fake.service(t, Settings{FolderSubpaths: map[string][]string{"media": {"a", "b"}}})
+
+	for i := 0; i < 5; i++ {
+		svc.triggerScan(context.Background(), "media")
+	}
+
+	want := []string{"a", "b", "a", "b", "a"}
+	if got := fake.scannedSubs(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("sub-path order mismatch: got %q want %q", got, want)
+	}
+}
+
+func TestSubpathPositionSurvivesRestart(t *testing.T) {
+	fake := newFakeSyncthing(t, "media")
+	settings := Settings{
+		FolderSubpaths: map[string][]string{"media": {"a", "b", "c"}},
+		StateFile:      filepath.Join(t.TempDir(), "state.json"),
+	}
+
+	fake.service(t, settings).triggerScan(context.Background(), "media")
+	fake.service(t, settings).triggerScan(context.Background(), "media")
+
+	want := []string{"a", "b"}
+	if got := fake.scannedSubs(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected position to persist: got %q want %q", got, want)
+	}
+}
+
+func TestSubpathsOnlyApplyToConfiguredFolders(t *testing.T) {
+	fake := newFakeSyncthing(t, "media", "docs")
+	svc := fake.service(t, Settings{FolderSubpaths: map[string][]string{"media": {"a"}}})
+
+	svc.triggerScan(context.Background(), "docs")
+
+	if got := fake.scannedSubs(); !reflect.DeepEqual(got, []string{""}) {
+		t.Fatalf("expected full scan of docs, got %q", got)
+	}
+}
@@ -0,0 +1,78 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"slices"
+	"time"
+)
+
+const defaultPanicLimit = 3
+
+// panicReport is a panic recovered in a scheduled job or a worker goroutine.
+type panicReport struct {
+	where string
+	value any
+}
+
+// recoverPanic recovers a panic in the goroutine it is deferred in, logs its stack,
+// counts it and hands it to the supervision loop, if one is running. It must be
+// deferred directly.
+func (s *Service) recoverPanic(where string) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	s.panicCount.Add(1)
+	s.Logger.Printf("Panic in %s: %v\n%s", where, v, debug.Stack())
+	select {
+	case s.panics <- panicReport{where: where, value: v}:
+	default: // a rebuild is already due
+	}
+}
+
+// injectPanic runs the test-only panic hook for where, if one is set.
+func (s *Service) injectPanic(where string) {
+	if s.panicHook != nil {
+		s.panicHook(where)
+	}
+}
+
+// supervise waits for ctx to end, rebuilding the scheduler and the scan worker pool
+// after every recovered panic. Once more than ST_PANIC_LIMIT panics fall within an
+// hour it gives up with an error.
+func (s *Service) supervise(ctx context.Context, pending chan struct{}) error {
+	var recent []time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case p := <-s.panics:
+			now := time.Now()
+			recent = append(slices.DeleteFunc(recent, func(t time.Time) bool { return now.Sub(t) >= time.Hour }), now)
+			if len(recent) > s.Settings.PanicLimit {
+				return Fatal(ErrAborted, fmt.Errorf("giving up after %d panic(s) within an hour (ST_PANIC_LIMIT=%d), the last in %s: %v",
+					len(recent), s.Settings.PanicLimit, p.where, p.value))
+			}
+			s.Logger.Printf("Rebuilding the scheduler and scan workers after a panic in %s (%d of %d per hour)", p.where, len(recent), s.Settings.PanicLimit)
+			if err := s.rebuildScheduler(pending); err != nil {
+				return Fatal(ErrAborted, fmt.Errorf("cannot rebuild the scheduler after a panic: %w", err))
+			}
+		}
+	}
+}
+
+// rebuildScheduler replaces the running scheduler with a fresh one built from the
+// current settings, and the scan worker pool with an empty one. Jobs still running
+// on the old scheduler finish on their own; the slots they hold are not carried over.
+func (s *Service) rebuildScheduler(pending chan struct{}) error {
+	sched, old, err := s.installScheduler(pending)
+	if err != nil {
+		return err
+	}
+	old.Stop()
+	s.workers.reset()
+	sched.Start()
+	return nil
+}
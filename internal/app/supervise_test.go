@@ -0,0 +1,191 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// fireGlobal waits for Run to have a scheduler other than prev, then runs its
+// "global" job in place and returns that scheduler.
+func fireGlobal(t *testing.T, svc *Service, prev *cron.Cron) *cron.Cron {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		svc.schedMu.Lock()
+		sched, entries := svc.cron, svc.schedules
+		svc.schedMu.Unlock()
+		if sched != nil && sched != prev {
+			for _, e := range entries {
+				if e.label == "global" {
+					sched.Entry(e.id).Job.Run()
+					return sched
+				}
+			}
+			t.Fatalf("no global schedule in %+v", entries)
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("scheduler not (re)built in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func panickingService(t *testing.T, limit int, logs *syncBuffer) *Service {
+	t.Helper()
+	fake := newFakeSyncthing(t, "docs")
+	svc := fake.service(t, Settings{CronExpr: "0 5 * * *", PanicLimit: limit, Folders: []string{"docs"}})
+	svc.Logger = log.New(logs, "", 0)
+	svc.panicHook = func(where string) {
+		if where == "global" {
+			panic("injected")
+		}
+	}
+	return svc
+}
+
+func TestSupervisorRebuildsThenGivesUp(t *testing.T) {
+	var logs syncBuffer
+	svc := panickingService(t, 1, &logs)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- svc.Run(ctx) }()
+
+	first := fireGlobal(t, svc, nil)
+	// Waits for the rebuilt scheduler, which still has the global schedule.
+	fireGlobal(t, svc, first)
+	for _, want := range []string{"Panic in global: injected", "goroutine ", "Rebuilding the scheduler and scan workers after a panic in global (1 of 1 per hour)"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Fatalf("expected %q in log:\n%s", want, logs.String())
+		}
+	}
+	var buf bytes.Buffer
+	svc.writeMetrics(&buf)
+	if !strings.Contains(buf.String(), "\nsyncthing_kicker_panics_total 2\n") {
+		t.Fatalf("expected 2 panics in metrics:\n%s", buf.String())
+	}
+
+	// The second panic is over the limit.
+	select {
+	case err := <-done:
+		if ExitCode(err) != ExitFailure || !strings.Contains(err.Error(), "giving up after 2 panic(s) within an hour (ST_PANIC_LIMIT=1), the last in global: injected") {
+			t.Fatalf("unexpected error: %v (exit code %d)", err, ExitCode(err))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Run did not give up")
+	}
+}
+
+func TestSupervisorKeepsRunningWithinLimit(t *testing.T) {
+	var logs syncBuffer
+	svc := panickingService(t, 3, &logs)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- svc.Run(ctx) }()
+
+	sched := fireGlobal(t, svc, nil)
+	sched = fireGlobal(t, svc, sched)
+	fireGlobal(t, svc, sched)
+	select {
+	case err := <-done:
+		t.Fatalf("Run ended within the panic limit: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected Run to end with its context, got %v", err)
+	}
+}
+
+func TestScanWorkerPanicReleasesSlot(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	var logs syncBuffer
+	svc := fake.service(t, Settings{ScanWorkers: 1})
+	svc.Logger = log.New(&logs, "", 0)
+	panicked := false
+	svc.panicHook = func(where string) {
+		if where == "scan docs" && !panicked {
+			panicked = true
+			panic("injected")
+		}
+	}
+
+	_ = svc.triggerScans(context.Background(), "global", []string{"docs"}, nil)
+	_ = svc.triggerScans(context.Background(), "global", []string{"docs"}, nil)
+	svc.statusChecks.Wait()
+	if got := fake.count("/rest/db/scan"); got != 1 {
+		t.Fatalf("expected the second run to scan, got %d scan(s)", got)
+	}
+	if svc.panicCount.Load() != 1 || !strings.Contains(logs.String(), "Panic in scan worker for docs: injected") {
+		t.Fatalf("expected one recovered panic, got %d:\n%s", svc.panicCount.Load(), logs.String())
+	}
+}
+
+func TestEveryScheduledJobRecoversPanics(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	var logs syncBuffer
+	svc := fake.service(t, Settings{CronExpr: "0 5 * * *", DigestCron: "0 8 * * *", Folders: []string{"docs"}})
+	svc.Logger = log.New(&logs, "", 0)
+	svc.panicHook = func(string) { panic("injected") }
+	sched, err := svc.buildCronScheduler(make(chan struct{}, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range sched.Entries() {
+		e.Job.Run()
+	}
+	if got := svc.panicCount.Load(); got != int64(len(sched.Entries())) {
+		t.Fatalf("expected every job's panic recovered, got %d of %d:\n%s", got, len(sched.Entries()), logs.String())
+	}
+	for _, where := range []string{"Panic in digest: injected", "Panic in heartbeat: injected"} {
+		if !strings.Contains(logs.String(), where) {
+			t.Fatalf("expected %q in:\n%s", where, logs.String())
+		}
+	}
+}
+
+func TestRebuildSchedulerWhileDescribing(t *testing.T) {
+	fake := newFakeSyncthing(t, "docs")
+	svc := fake.service(t, Settings{
+		CronExpr:          "0 5 * * *",
+		Folders:           []string{"docs"},
+		BandwidthSchedule: []BandwidthRule{{Cron: "0 1 * * *", SendKbps: 100, RecvKbps: 100}},
+	})
+	pending := make(chan struct{}, 1)
+	if _, _, err := svc.installScheduler(pending); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 50 {
+			if err := svc.rebuildScheduler(pending); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			svc.schedMu.Lock()
+			svc.cron.Stop()
+			svc.schedMu.Unlock()
+			return
+		default:
+		}
+		if got := svc.scheduleInfos(); len(got) != 2 {
+			t.Fatalf("expected the global and bandwidth schedules, got %+v", got)
+		}
+		if len(svc.bandwidthRules()) != 1 {
+			t.Fatalf("expected one bandwidth rule")
+		}
+	}
+}
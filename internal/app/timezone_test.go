@@ -0,0 +1,93 @@
+package app
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimezoneWarning(t *testing.T) {
+	now := time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		tz   string
+		want string // substring of the warning; "" for none
+	}{
+		{"Europe/Lisbon", ""},
+		{"US/Pacific", ""},
+		{"UTC", ""},
+		{"Etc/GMT+5", ""},
+		{"EST", "fixed UTC offset that ignores daylight saving time"},
+		{"MST", "fixed UTC offset"},
+		{"EST5EDT", "legacy abbreviation"},
+		{"CET", `CRON_TZ/TZ "CET"`}, // fixed or not depends on the tzdata release
+	} {
+		loc, err := time.LoadLocation(tc.tz)
+		if err != nil {
+			t.Fatalf("%s should load from the embedded database: %v", tc.tz, err)
+		}
+		got := timezoneWarning(tc.tz, loc, now)
+		if (tc.want == "") != (got == "") || !strings.Contains(got, tc.want) {
+			t.Fatalf("%s: warning %q, want %q", tc.tz, got, tc.want)
+		}
+	}
+}
+
+func TestLoadSettingsValidatesCronTimezonesEarly(t *testing.T) {
+	for _, tc := range []struct {
+		env     map[string]string
+		err     string
+		warning string
+	}{
+		{env: map[string]string{"ST_CRON": "CRON_TZ=Not/A_Zone 0 3 * * *"}, err: "invalid ST_CRON"},
+		{env: map[string]string{"ST_FOLDER_CRON": "docs: TZ=Mars/Olympus 0 3 * * *"}, err: "invalid ST_FOLDER_CRON expr for docs"},
+		{env: map[string]string{"ST_FOLDER_CRON": "docs: 0 3 * *"}, err: "invalid ST_FOLDER_CRON expr for docs"},
+		{env: map[string]string{"ST_CRON": "CRON_TZ=US/Pacific 0 3 * * *"}},
+		{env: map[string]string{"ST_CRON": "0 3 * * *", "CRON_TZ": "US/Pacific"}},
+		{env: map[string]string{"ST_CRON": "0 3 * * *", "TZ": "EST"}, warning: `CRON_TZ/TZ "EST" is a fixed UTC offset`},
+	} {
+		os.Clearenv()
+		os.Setenv("ST_API_KEY", "abc123")
+		for k, v := range tc.env {
+			os.Setenv(k, v)
+		}
+		st, err := LoadSettingsFromEnv()
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("%v: expected %q, got %v", tc.env, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", tc.env, err)
+		}
+		warned := strings.Join(st.Warnings(), "\n")
+		if (tc.warning == "") != (warned == "") || !strings.Contains(warned, tc.warning) {
+			t.Fatalf("%v: warnings %q, want %q", tc.env, warned, tc.warning)
+		}
+	}
+}
+
+// TestTimezonesLoadWithoutSystemData loads zones in a child process whose
+// ZONEINFO and TZDIR point at an empty directory (the time package reads its
+// ZONEINFO override once per process, hence the child). Go still looks in the
+// usual system directories before falling back to the embedded database, so on a
+// machine without tzdata, like the distroless image, it is the embedded copy that
+// answers.
+func TestTimezonesLoadWithoutSystemData(t *testing.T) {
+	if os.Getenv("KICKER_TZDATA_CHILD") == "1" {
+		for _, tz := range []string{"America/New_York", "US/Pacific", "CET", "Europe/Lisbon"} {
+			if _, err := (Settings{CronTimezone: tz}).Location(); err != nil {
+				t.Fatalf("%s: %v", tz, err)
+			}
+		}
+		return
+	}
+	empty := t.TempDir()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestTimezonesLoadWithoutSystemData$")
+	cmd.Env = append(os.Environ(), "KICKER_TZDATA_CHILD=1", "ZONEINFO="+empty, "TZDIR="+empty)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("loading zones without system tzdata failed: %v\n%s", err, out)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !notzdata
+
+package app
+
+// The timezone database is compiled in (about 450 KB), so CRON_TZ and TZ work in
+// images without /usr/share/zoneinfo; time.LoadLocation still prefers the system's
+// copy where there is one. Build with -tags notzdata to leave it out.
+import _ "time/tzdata"
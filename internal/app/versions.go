@@ -0,0 +1,73 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+// eventVersionsOverThreshold is raised by a versions report that finds a folder's
+// archived versions taking more than ST_VERSIONS_WARN_GB.
+const eventVersionsOverThreshold = "versions_over_threshold"
+
+// versionsWarnBytes is ST_VERSIONS_WARN_GB in bytes; 0 disables the alert.
+func (s *Service) versionsWarnBytes() int64 {
+	return int64(s.Settings.VersionsWarnGB * (1 << 30))
+}
+
+// reportVersions runs a scheduled versions report of folder and records it as a run
+// of its own: it lists the folder's archived versions and logs how many there are
+// and how much space they take. The report only reads, so it also runs on a dry run.
+func (s *Service) reportVersions(ctx context.Context, folder string) {
+	ctx, run := s.startRun(ctx, actionVersionsReport+":"+folder)
+	defer run.finish()
+	a := run.begin(folder)
+	started := time.Now()
+	name := fmt.Sprintf("folder '%s'%s", folder, s.labelSuffix(folder))
+	inst, id := s.splitRef(folder)
+	versions, _, err := s.client(inst).Versions(ctx, id, actionTimeout)
+	if err != nil {
+		s.logFailure(ctx, "versions:"+folder, "versions report", err, "Cannot list the versions of %s: %v", name, err)
+		run.update(a.index, func(f *RunFolderResult) {
+			f.Result, f.DurationMs = resultFailed, time.Since(started).Milliseconds()
+		})
+		return
+	}
+	s.logSuccess(ctx, "versions:"+folder, "versions report")
+	files, count, size := versionTotals(versions)
+	run.update(a.index, func(f *RunFolderResult) {
+		f.Result, f.DurationMs = resultTriggered, time.Since(started).Milliseconds()
+		f.VersionedFiles, f.Versions, f.VersionsBytes = files, count, size
+	})
+	s.log(ctx).Printf("Versions of %s: %d version(s) of %d file(s), %s", name, count, files, formatBytes(size))
+
+	limit := s.versionsWarnBytes()
+	if limit <= 0 || size <= limit {
+		return
+	}
+	s.notify(NotifyEvent{
+		Type:   eventVersionsOverThreshold,
+		Folder: folder,
+		Message: fmt.Sprintf("Folder %s%s keeps %s in %d version(s) of %d file(s), over ST_VERSIONS_WARN_GB (%s)",
+			folder, s.labelSuffix(folder), formatBytes(size), count, files, formatBytes(limit)),
+		Fields: map[string]any{"files": files, "versions": count, "bytes": size, "thresholdBytes": limit},
+	})
+}
+
+// versionTotals counts the files with archived versions, the versions and their
+// total size.
+func versionTotals(versions map[string][]syncthing.FileVersion) (files, count, size int64) {
+	for _, vs := range versions {
+		if len(vs) == 0 {
+			continue
+		}
+		files++
+		for _, v := range vs {
+			count++
+			size += v.Size
+		}
+	}
+	return files, count, size
+}
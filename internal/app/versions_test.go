@@ -0,0 +1,61 @@
+package app
+
+import (
+	"context"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+func TestReportVersions(t *testing.T) {
+	fake := newFakeSyncthing(t, "archive")
+	fake.versions = map[string]map[string][]syncthing.FileVersion{"archive": {
+		"a.txt":     {{Size: 3 << 30}, {Size: 1 << 30}},
+		"sub/b.bin": {{Size: 1 << 30}},
+		"gone":      {},
+	}}
+	svc := fake.service(t, Settings{VersionsWarnGB: 2})
+	var buf syncBuffer
+	svc.Logger = log.New(&buf, "", 0)
+	rec := &recordingNotifier{}
+	svc.Notifiers = []Notifier{rec}
+
+	svc.reportVersions(context.Background(), "archive")
+	svc.notifications.Wait()
+	if !strings.Contains(buf.String(), "Versions of folder 'archive': 3 version(s) of 2 file(s), 5.0 GiB") {
+		t.Fatalf("expected the report to be logged:\n%s", buf.String())
+	}
+	f := svc.lastRun("versions-report:archive").Folders[0]
+	if f.Result != resultTriggered || f.VersionedFiles != 2 || f.Versions != 3 || f.VersionsBytes != 5<<30 {
+		t.Fatalf("unexpected run: %+v", f)
+	}
+	if len(rec.events) != 1 || rec.events[0].Type != eventVersionsOverThreshold || rec.events[0].Fields["bytes"] != int64(5<<30) || rec.events[0].Severity != severityWarning {
+		t.Fatalf("unexpected notifications: %+v", rec.events)
+	}
+}
+
+func TestReportVersionsUnderThreshold(t *testing.T) {
+	for _, warnGB := range []float64{0, 10} {
+		fake := newFakeSyncthing(t, "archive")
+		fake.versions = map[string]map[string][]syncthing.FileVersion{"archive": {"a.txt": {{Size: 1 << 30}}}}
+		svc := fake.service(t, Settings{VersionsWarnGB: warnGB})
+		rec := &recordingNotifier{}
+		svc.Notifiers = []Notifier{rec}
+
+		svc.reportVersions(context.Background(), "archive")
+		svc.notifications.Wait()
+		if len(rec.events) != 0 {
+			t.Fatalf("ST_VERSIONS_WARN_GB=%v: unexpected notifications: %+v", warnGB, rec.events)
+		}
+	}
+}
+
+func TestVersionsSeverityEscalates(t *testing.T) {
+	svc := &Service{Settings: Settings{VersionsWarnGB: 1}}
+	ev := NotifyEvent{Type: eventVersionsOverThreshold, Fields: map[string]any{"bytes": int64(12 << 30)}}
+	if got := svc.eventSeverity(ev); got != severityCritical {
+		t.Fatalf("expected versions ten times over the threshold to be critical, got %s", got)
+	}
+}
@@ -0,0 +1,159 @@
+package app
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchRetryInterval is how long a failed watcher waits before starting over.
+var watchRetryInterval = 30 * time.Second
+
+// runWatchers starts one filesystem watcher per ST_WATCH_PATHS entry. Each runs until ctx ends.
+func (s *Service) runWatchers(ctx context.Context, pending chan struct{}) {
+	for folder, root := range s.Settings.WatchPaths {
+		s.watchers.Add(1)
+		go func(folder, root string) {
+			defer s.watchers.Done()
+			s.watchFolder(ctx, folder, root, pending)
+		}(folder, root)
+	}
+}
+
+// watchFolder watches root recursively and triggers a scan of folder once changes have
+// been quiet for WatchDebounce. Watcher failures are logged and retried, never fatal.
+func (s *Service) watchFolder(ctx context.Context, folder, root string, pending chan struct{}) {
+	for {
+		err := s.watchOnce(ctx, folder, root, pending)
+		if ctx.Err() != nil {
+			return
+		}
+		s.logFailure(ctx, folder, "watch", err, "Watcher for folder '%s'%s (%s) failed: %v; retrying in %s", folder, s.labelSuffix(folder), root, err, watchRetryInterval)
+		t := time.NewTimer(watchRetryInterval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (s *Service) watchOnce(ctx context.Context, folder, root string, pending chan struct{}) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	if err := addWatchTree(w, root); err != nil {
+		return err
+	}
+	s.logSuccess(ctx, folder, "watch")
+	s.Logger.Printf("Watching %s for folder '%s'%s", root, folder, s.labelSuffix(folder))
+
+	var (
+		changed  []string
+		debounce *time.Timer
+		fire     <-chan time.Time
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			if debounce != nil {
+				debounce.Stop()
+			}
+			return ctx.Err()
+
+		case ev, ok := <-w.Events:
+			if !ok {
+				return errWatcherClosed
+			}
+			if ev.Has(fsnotify.Create) {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					// New directories need their own watches; failures surface via w.Errors.
+					_ = addWatchTree(w, ev.Name)
+				}
+			}
+			if rel, err := filepath.Rel(root, ev.Name); err == nil {
+				changed = append(changed, filepath.ToSlash(rel))
+			}
+			if debounce == nil {
+				debounce = time.NewTimer(s.Settings.WatchDebounce)
+			} else {
+				debounce.Reset(s.Settings.WatchDebounce)
+			}
+			fire = debounce.C
+
+		case err, ok := <-w.Errors:
+			if !ok {
+				return errWatcherClosed
+			}
+			return err
+
+		case <-fire:
+			fire = nil
+			sub := commonSubdir(changed)
+			runCtx, run := s.startRun(ctx, "watch:"+folder)
+			s.log(runCtx).Printf("Detected %d change(s) in %s; triggering scan for folder '%s'%s", len(changed), root, folder, s.labelSuffix(folder))
+			changed = nil
+			attempt := run.scan(runCtx, folder, sub)
+			run.finish()
+			s.scheduleStatusCheck(runCtx, attempt, pending)
+		}
+	}
+}
+
+type watcherError string
+
+func (e watcherError) Error() string { return string(e) }
+
+const errWatcherClosed = watcherError("watcher closed")
+
+// addWatchTree adds root and every directory below it to w.
+func addWatchTree(w *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		return w.Add(p)
+	})
+}
+
+// commonSubdir returns the deepest directory (slash-separated, relative to the watch root)
+// containing every changed path, or "" when the changes span the root.
+func commonSubdir(paths []string) string {
+	var common []string
+	for i, p := range paths {
+		dir := strings.Split(pathDir(p), "/")
+		if i == 0 {
+			common = dir
+			continue
+		}
+		n := 0
+		for n < len(common) && n < len(dir) && common[n] == dir[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	out := strings.Join(common, "/")
+	if out == "." {
+		return ""
+	}
+	return out
+}
+
+func pathDir(p string) string {
+	if i := strings.LastIndex(p, "/"); i >= 0 {
+		return p[:i]
+	}
+	return "."
+}
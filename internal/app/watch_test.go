@@ -0,0 +1,101 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCommonSubdir(t *testing.T) {
+	tests := []struct {
+		paths []string
+		want  string
+	}{
+		{[]string{"a/b/c.txt", "a/b/d.txt"}, "a/b"},
+		{[]string{"a/b/c.txt", "a/e/d.txt"}, "a"},
+		{[]string{"a/b/c.txt", "top.txt"}, ""},
+		{[]string{"top.txt"}, ""},
+		{[]string{"a/b/c.txt"}, "a/b"},
+	}
+	for _, tt := range tests {
+		if got := commonSubdir(tt.paths); got != tt.want {
+			t.Fatalf("commonSubdir(%q) = %q, want %q", tt.paths, got, tt.want)
+		}
+	}
+}
+
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met within %s", timeout)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWatcherTriggersDebouncedSubpathScan(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "2024", "march"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	fake := newFakeSyncthing(t, "photos")
+	svc := fake.service(t, Settings{
+		WatchPaths:    map[string]string{"photos": root},
+		WatchDebounce: 50 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	svc.runWatchers(ctx, make(chan struct{}, 16))
+	time.Sleep(50 * time.Millisecond) // let the watcher register
+
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		if err := os.WriteFile(filepath.Join(root, "2024", "march", name), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waitFor(t, 2*time.Second, func() bool { return len(fake.scanned()) > 0 })
+	time.Sleep(100 * time.Millisecond)
+	if got := fake.scannedSubs(); !reflect.DeepEqual(got, []string{"2024/march"}) {
+		t.Fatalf("expected one scan of 2024/march, got %q", got)
+	}
+
+	cancel()
+	svc.watchers.Wait()
+}
+
+func TestWatcherRetriesMissingPath(t *testing.T) {
+	prev := watchRetryInterval
+	watchRetryInterval = 20 * time.Millisecond
+	t.Cleanup(func() { watchRetryInterval = prev })
+
+	root := filepath.Join(t.TempDir(), "not-yet")
+	fake := newFakeSyncthing(t, "exports")
+	svc := fake.service(t, Settings{
+		WatchPaths:    map[string]string{"exports": root},
+		WatchDebounce: 20 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	svc.runWatchers(ctx, make(chan struct{}, 16))
+
+	time.Sleep(50 * time.Millisecond)
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond) // a retry picks the directory up
+	if err := os.WriteFile(filepath.Join(root, "file"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, 2*time.Second, func() bool { return len(fake.scanned()) > 0 })
+	cancel()
+	svc.watchers.Wait()
+}
@@ -0,0 +1,98 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+// watcherTargets lists the folders with an ST_WATCHER_OFF_WINDOWS window or whose
+// watcher one turned off. Their watcher is "paused" while it is off.
+func (s *Service) watcherTargets() []pauseTarget {
+	windows := map[string][]PauseWindow{}
+	for folder, ws := range s.Settings.WatcherOffWindows {
+		ref := s.missingRef(folder)
+		windows[ref] = append(windows[ref], ws...)
+	}
+	for _, ref := range s.stateStore().watcherOffFolders() {
+		if _, ok := windows[ref]; !ok {
+			windows[ref] = nil
+		}
+	}
+	var out []pauseTarget
+	for _, ref := range slices.Sorted(maps.Keys(windows)) {
+		inst, id := s.splitRef(ref)
+		client := s.client(inst)
+		out = append(out, pauseTarget{
+			key:     "watcher:" + ref,
+			name:    fmt.Sprintf("the watcher of folder '%s'%s", ref, s.labelSuffix(ref)),
+			folder:  ref,
+			verbs:   watcherVerbs,
+			windows: windows[ref],
+			ours:    !s.stateStore().folder(ref).WatcherOff.IsZero(),
+			paused: func(ctx context.Context) (bool, bool, error) {
+				cfg, _, err := client.Folder(ctx, id, pauseWindowTimeout)
+				if isFolderNotFound(err) {
+					return false, false, nil
+				}
+				return !cfg.FSWatcherEnabled, err == nil, err
+			},
+			set: func(ctx context.Context, off bool) error {
+				return s.setFolderWatcher(ctx, client, ref, !off)
+			},
+			own: func(since time.Time) error {
+				return s.stateStore().updateFolder(ref, func(f *FolderState) { f.WatcherOff = since })
+			},
+		})
+	}
+	return out
+}
+
+// setFolderWatcher turns the watcher of folder ref on or off. If Syncthing reports a
+// conflict because another writer changed the folder meanwhile, the folder is read
+// afresh and the change retried once, unless it is no longer needed.
+func (s *Service) setFolderWatcher(ctx context.Context, client *syncthing.Client, ref string, enabled bool) error {
+	_, id := s.splitRef(ref)
+	code, err := client.SetFolderWatcher(ctx, id, enabled, pauseWindowTimeout)
+	if code != http.StatusConflict {
+		return err
+	}
+	s.log(ctx).Printf("Folder '%s'%s was changed by another writer while its watcher was being set; retrying once", ref, s.labelSuffix(ref))
+	cfg, _, err := client.Folder(ctx, id, pauseWindowTimeout)
+	if err != nil {
+		return err
+	}
+	if cfg.FSWatcherEnabled == enabled {
+		return nil
+	}
+	_, err = client.SetFolderWatcher(ctx, id, enabled, pauseWindowTimeout)
+	return err
+}
+
+// restoreWatchersOnShutdown turns back on the watchers a watcher window turned off,
+// so they are not left off while the kicker is not running; the next start turns
+// them off again if their window is still open. It runs after ctx is cancelled, so
+// it gets a context of its own.
+func (s *Service) restoreWatchersOnShutdown() {
+	refs := s.stateStore().watcherOffFolders()
+	if len(refs) == 0 {
+		return
+	}
+	if s.Settings.DryRun {
+		s.Logger.Printf("[dry-run] Would turn the watcher back on for %s on shutdown", strings.Join(refs, ", "))
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(len(refs))*2*pauseWindowTimeout)
+	defer cancel()
+	for _, t := range s.watcherTargets() {
+		if t.ours {
+			s.resumeAfterWindow(ctx, t)
+		}
+	}
+}
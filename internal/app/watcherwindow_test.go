@@ -0,0 +1,116 @@
+package app
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatcherOffWindows(t *testing.T) {
+	fake := newFakeSyncthing(t, "batch-out", "docs")
+	fake.setWatcher("batch-out", true)
+	fake.setWatcher("docs", true)
+	settings := Settings{
+		CronTimezone:      "UTC",
+		StateFile:         filepath.Join(t.TempDir(), "state.json"),
+		WatcherOffWindows: map[string][]PauseWindow{"batch-out": {mustPauseWindow(t, "01:00-04:00")}},
+	}
+	svc := fake.service(t, settings)
+	ctx := context.Background()
+	at := func(hour int) time.Time { return time.Date(2024, 5, 6, hour, 0, 0, 0, time.UTC) }
+
+	svc.reconcilePauseWindows(ctx, at(2))
+	if fake.folderConfig("batch-out").FSWatcherEnabled || !fake.folderConfig("docs").FSWatcherEnabled || fake.patches != 1 {
+		t.Fatalf("expected only batch-out's watcher turned off, got %d patches", fake.patches)
+	}
+	if fake.paused("batch-out") {
+		t.Fatalf("a watcher window paused the folder")
+	}
+
+	// A clean shutdown turns the watcher back on; starting again inside the window
+	// turns it off again.
+	svc.restoreWatchersOnShutdown()
+	if !fake.folderConfig("batch-out").FSWatcherEnabled || len(svc.stateStore().watcherOffFolders()) != 0 {
+		t.Fatalf("expected the watcher restored on shutdown")
+	}
+	if err := svc.FlushState(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	restarted := fake.service(t, settings)
+	restarted.reconcilePauseWindows(ctx, at(3))
+	if fake.folderConfig("batch-out").FSWatcherEnabled {
+		t.Fatalf("expected the watcher turned off again after a restart inside the window")
+	}
+	restarted.reconcilePauseWindows(ctx, at(5))
+	if !fake.folderConfig("batch-out").FSWatcherEnabled || fake.patches != 4 {
+		t.Fatalf("expected the watcher back on after the window, got %d patches", fake.patches)
+	}
+}
+
+func TestWatcherOffWindowsDryRunShutdown(t *testing.T) {
+	fake := newFakeSyncthing(t, "batch-out")
+	fake.setWatcher("batch-out", true)
+	settings := Settings{
+		CronTimezone:      "UTC",
+		StateFile:         filepath.Join(t.TempDir(), "state.json"),
+		WatcherOffWindows: map[string][]PauseWindow{"batch-out": {mustPauseWindow(t, "01:00-04:00")}},
+	}
+	svc := fake.service(t, settings)
+	svc.reconcilePauseWindows(context.Background(), time.Date(2024, 5, 6, 2, 0, 0, 0, time.UTC))
+	if err := svc.FlushState(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	// Restarted with DRY_RUN inside the window, then shut down.
+	settings.DryRun = true
+	dry := fake.service(t, settings)
+	var buf syncBuffer
+	dry.Logger = log.New(&buf, "", 0)
+	dry.restoreWatchersOnShutdown()
+	if fake.folderConfig("batch-out").FSWatcherEnabled || fake.patches != 1 {
+		t.Fatalf("a dry run turned the watcher back on (%d patches)", fake.patches)
+	}
+	if !strings.Contains(buf.String(), "[dry-run] Would turn the watcher back on for batch-out on shutdown") {
+		t.Fatalf("expected the restore to be logged:\n%s", buf.String())
+	}
+}
+
+func TestWatcherOffWindowsRetryConflict(t *testing.T) {
+	fake := newFakeSyncthing(t, "batch-out")
+	fake.setWatcher("batch-out", true)
+	svc := fake.service(t, Settings{
+		CronTimezone:      "UTC",
+		WatcherOffWindows: map[string][]PauseWindow{"batch-out": {mustPauseWindow(t, "01:00-04:00")}},
+	})
+	var buf syncBuffer
+	svc.Logger = log.New(&buf, "", 0)
+	ctx := context.Background()
+	night := time.Date(2024, 5, 6, 2, 0, 0, 0, time.UTC)
+
+	fake.conflicts = 1
+	svc.reconcilePauseWindows(ctx, night)
+	if fake.folderConfig("batch-out").FSWatcherEnabled {
+		t.Fatalf("expected the change to be retried after a conflict")
+	}
+	if !strings.Contains(buf.String(), "Folder 'batch-out' was changed by another writer while its watcher was being set; retrying once") {
+		t.Fatalf("expected the retry to be logged:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "Turned off the watcher of folder 'batch-out' for watcher window 01:00-04:00") {
+		t.Fatalf("expected the change to be logged:\n%s", buf.String())
+	}
+
+	// Only one retry: a second conflict is a failure, tried again on the next tick.
+	svc.reconcilePauseWindows(ctx, night.Add(2*time.Hour))
+	fake.conflicts = 2
+	svc.reconcilePauseWindows(ctx, night.Add(24*time.Hour))
+	if !fake.folderConfig("batch-out").FSWatcherEnabled || len(svc.stateStore().watcherOffFolders()) != 0 {
+		t.Fatalf("expected the watcher left on after two conflicts")
+	}
+	svc.reconcilePauseWindows(ctx, night.Add(24*time.Hour+time.Minute))
+	if fake.folderConfig("batch-out").FSWatcherEnabled {
+		t.Fatalf("expected the next tick to turn the watcher off")
+	}
+}
@@ -0,0 +1,52 @@
+package syncthing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClientErrorBodies(t *testing.T) {
+	stack := "panic: runtime error: index out of range\n\ngoroutine 1 [running]:\n" + strings.Repeat("main.main()\n\t/src/main.go:12 +0x1d\n", 1460)
+	for _, tc := range []struct {
+		name string
+		body string
+		want string
+	}{
+		{"empty", "", "http error: 500 Internal Server Error with no body (POST /rest/db/scan)"},
+		{"one-liner", "folder is paused\n", "http error: folder is paused (POST /rest/db/scan)"},
+		{"stack dump", stack, "http error: panic: runtime error: index out of range | goroutine 1 [running]: | main.main() | /src/main.go:12 +0x1d | "},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				w.WriteHeader(http.StatusInternalServerError)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			defer srv.Close()
+			client, err := NewClient(srv.URL, "secret-key", ClientOptions{MaxErrorBody: 120})
+			if err != nil {
+				t.Fatalf("new client: %v", err)
+			}
+			_, err = client.PostScan(context.Background(), "docs", ScanOptions{Sub: []string{"private/path"}}, 0)
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.Status != http.StatusInternalServerError || apiErr.Body != tc.body {
+				t.Fatalf("expected an APIError keeping the whole body, got %#v", err)
+			}
+			msg := err.Error()
+			if !strings.HasPrefix(msg, tc.want) || strings.Contains(msg, "\n") {
+				t.Fatalf("unexpected message %q", msg)
+			}
+			if strings.Contains(msg, "secret-key") || strings.Contains(msg, "private") {
+				t.Fatalf("the message leaks the request: %q", msg)
+			}
+			if len(tc.body) > 120 && (!strings.HasSuffix(msg, fmt.Sprintf("main.main()… (%d bytes) (POST /rest/db/scan)", len(tc.body))) || len(msg) > 200) {
+				t.Fatalf("expected a long body to be cut with its size, got %q", msg)
+			}
+		})
+	}
+}
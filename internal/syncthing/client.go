@@ -1,88 +1,408 @@
 package syncthing
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"net"
 	"net/http"
+	"net/http/cookiejar"
 	"net/url"
 	"path"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
+	"unicode/utf8"
 )
 
+// ErrFolderNotFound matches (with errors.Is) the error returned when Syncthing
+// rejects a folder ID it does not know.
+var ErrFolderNotFound = errors.New("folder not found")
+
+// DefaultMaxErrorBody is how much of an error response APIError.Error shows unless
+// ClientOptions.MaxErrorBody says otherwise.
+const DefaultMaxErrorBody = 300
+
+// DefaultMaxIdleConnsPerHost is how many idle connections to Syncthing a client
+// keeps for reuse unless ClientOptions says otherwise. http.DefaultTransport keeps
+// two, which makes a burst of concurrent requests to the one host open most of its
+// connections afresh.
+const DefaultMaxIdleConnsPerHost = 8
+
+// APIError is an error response from Syncthing. Error renders its body, usually a
+// text/plain one-liner but a whole stack dump after a panic, on one line and cut to
+// a bounded length; Body keeps it as received, for debug logging. Only the method
+// and path are recorded, never the query or the API key.
+type APIError struct {
+	Method string
+	Path   string
+	Status int
+	Body   string
+
+	maxBody  int
+	notFound bool
+}
+
+func (e *APIError) Error() string {
+	var lines []string
+	for _, line := range strings.Split(e.Body, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	msg := strings.Join(lines, " | ")
+	if msg == "" {
+		msg = fmt.Sprintf("%d %s with no body", e.Status, http.StatusText(e.Status))
+	}
+	if e.maxBody > 0 && len(msg) > e.maxBody {
+		cut := e.maxBody
+		for cut > 0 && !utf8.RuneStart(msg[cut]) {
+			cut--
+		}
+		msg = fmt.Sprintf("%s… (%d bytes)", strings.TrimRight(msg[:cut], " |"), len(e.Body))
+	}
+	return fmt.Sprintf("http error: %s (%s %s)", msg, e.Method, e.Path)
+}
+
+// Is matches ErrFolderNotFound when Syncthing rejected an unknown folder.
+func (e *APIError) Is(target error) bool { return e.notFound && target == ErrFolderNotFound }
+
+// isFolderNotFoundBody reports whether an error response is Syncthing rejecting an
+// unknown folder. Depending on the version and endpoint that is a 404 or a 500 with
+// "no such folder", "folder ... does not exist" or "unknown folder" in the body, or
+// for /rest/config/folders/{id} a 404 with "No folder with given ID".
+func isFolderNotFoundBody(status int, body string) bool {
+	if status != http.StatusNotFound && status != http.StatusInternalServerError {
+		return false
+	}
+	msg := strings.ToLower(body)
+	return strings.Contains(msg, "no such folder") || strings.Contains(msg, "does not exist") || strings.Contains(msg, "unknown folder") ||
+		strings.Contains(msg, "no folder with given id")
+}
+
 type Client struct {
-	baseURL *url.URL
-	apiKey  string
-	hc      *http.Client
+	urls     []*url.URL // primary first, then the optional fallback
+	hc       *http.Client
+	onSwitch func(from, to string)
+	onRetry  func(method, path string, err error)
+	observe  func(method, path string, status int, d time.Duration, err error)
+	// requestTimeout caps every call's own timeout; 0 leaves them alone.
+	requestTimeout time.Duration
+	// maxErrorBody bounds the body shown in an APIError's message.
+	maxErrorBody int
+	// session, when set, authenticates through the GUI login instead of apiKey.
+	session *session
+	// reloadKey and onKeyRotated implement ClientOptions.ReloadKey and OnKeyRotated.
+	reloadKey    func() (string, error)
+	onKeyRotated func(from, to string)
+
+	mu     sync.Mutex
+	apiKey string
+	active int // index into urls of the endpoint requests go to
 }
 
 type ClientOptions struct {
 	VerifyTLS      bool
-	RequestTimeout time.Duration // 0 means default
+	RequestTimeout time.Duration // caps each call's own timeout; 0 means no cap
+
+	// FallbackURL is a second address of the same Syncthing instance. Requests move to
+	// it when the active address cannot be dialed; OnSwitch is called on every change.
+	FallbackURL string
+	OnSwitch    func(from, to string)
+
+	// OnRequest, when set, is called after every API request with its method, path,
+	// HTTP status (0 if none was received), latency and error. It runs on the
+	// request's goroutine and must not block.
+	OnRequest func(method, path string, status int, d time.Duration, err error)
+
+	// OnRetry, when set, is called before a GET that failed on a dropped keep-alive
+	// connection is retried on a fresh one.
+	OnRetry func(method, path string, err error)
+
+	// MaxErrorBody bounds how much of an error response an APIError's message shows;
+	// 0 means DefaultMaxErrorBody.
+	MaxErrorBody int
+
+	// MaxIdleConnsPerHost is how many idle connections are kept for reuse; 0 means
+	// DefaultMaxIdleConnsPerHost. MaxConnsPerHost caps the connections open at once,
+	// requests beyond it waiting for one to free up; 0 means no cap, which keeps
+	// long-polls such as /rest/events from holding up scans.
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+
+	// GUIUser and GUIPassword, when set, make the client log in to the GUI and use
+	// its session cookie and CSRF token instead of an API key, which must then be
+	// empty. It logs in again whenever Syncthing answers 401 or 403.
+	GUIUser     string
+	GUIPassword string
+
+	// ReloadKey, when set, is called when Syncthing answers 403 to the API key. If it
+	// returns a different key, the client switches to it, calls OnKeyRotated with
+	// both keys masked, and retries the request once.
+	ReloadKey    func() (string, error)
+	OnKeyRotated func(from, to string)
 }
 
 func NewClient(apiURL, apiKey string, opts ClientOptions) (*Client, error) {
-	u, err := url.Parse(apiURL)
-	if err != nil {
-		return nil, fmt.Errorf("invalid api url: %w", err)
+	if apiKey != "" && opts.GUIUser != "" {
+		return nil, errors.New("an API key and a GUI login are mutually exclusive")
 	}
-	if !strings.HasSuffix(u.Path, "/") {
-		u.Path += "/"
+	raw := []string{apiURL}
+	if opts.FallbackURL != "" {
+		raw = append(raw, opts.FallbackURL)
 	}
 
 	tr := http.DefaultTransport.(*http.Transport).Clone()
-	if u.Scheme == "https" && !opts.VerifyTLS {
-		tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} //nolint:gosec
+	tr.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+	if tr.MaxIdleConnsPerHost <= 0 {
+		tr.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+	tr.MaxConnsPerHost = max(opts.MaxConnsPerHost, 0)
+	urls := make([]*url.URL, 0, len(raw))
+	for _, r := range raw {
+		u, err := url.Parse(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid api url: %w", RedactError(err, apiKey))
+		}
+		if !strings.HasSuffix(u.Path, "/") {
+			u.Path += "/"
+		}
+		if u.Scheme == "https" && !opts.VerifyTLS {
+			tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} //nolint:gosec
+		}
+		urls = append(urls, u)
 	}
 
 	hc := &http.Client{Transport: tr}
-	if opts.RequestTimeout > 0 {
-		hc.Timeout = opts.RequestTimeout
+	var sess *session
+	if opts.GUIUser != "" {
+		hc.Jar, _ = cookiejar.New(nil) // never fails without options
+		sess = &session{user: opts.GUIUser, password: opts.GUIPassword}
 	}
 
-	return &Client{baseURL: u, apiKey: apiKey, hc: hc}, nil
+	maxErrorBody := opts.MaxErrorBody
+	if maxErrorBody <= 0 {
+		maxErrorBody = DefaultMaxErrorBody
+	}
+
+	return &Client{urls: urls, apiKey: apiKey, hc: hc, onSwitch: opts.OnSwitch, onRetry: opts.OnRetry, observe: opts.OnRequest, requestTimeout: opts.RequestTimeout, maxErrorBody: maxErrorBody, session: sess, reloadKey: opts.ReloadKey, onKeyRotated: opts.OnKeyRotated}, nil
+}
+
+// URL returns the address requests currently go to, with credentials masked.
+func (c *Client) URL() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return RedactURL(c.urls[c.active].String(), c.apiKey)
+}
+
+func (c *Client) key() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.apiKey
+}
+
+// rotateKey asks ReloadKey for the key after used was refused and reports whether
+// there is a different one to retry with. Concurrent refusals rotate only once.
+func (c *Client) rotateKey(used string) bool {
+	if c.reloadKey == nil {
+		return false
+	}
+	next, err := c.reloadKey()
+	if err != nil || next == "" || next == used {
+		return false
+	}
+	c.mu.Lock()
+	rotated := c.apiKey == used
+	if rotated {
+		c.apiKey = next
+	}
+	c.mu.Unlock()
+	if rotated && c.onKeyRotated != nil {
+		c.onKeyRotated(MaskKey(used), MaskKey(next))
+	}
+	return true
+}
+
+// HasFallback reports whether the client was configured with a fallback address.
+func (c *Client) HasFallback() bool {
+	return len(c.urls) > 1
+}
+
+func (c *Client) activeIndex() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.active
+}
+
+// switchTo makes urls[to] active if urls[from] still is, reporting the change.
+func (c *Client) switchTo(from, to int) {
+	c.mu.Lock()
+	if c.active != from || from == to {
+		c.mu.Unlock()
+		return
+	}
+	c.active = to
+	key := c.apiKey
+	c.mu.Unlock()
+	if c.onSwitch != nil {
+		c.onSwitch(RedactURL(c.urls[from].String(), key), RedactURL(c.urls[to].String(), key))
+	}
+}
+
+// Probe checks every address in priority order and routes requests to the first one
+// that answers, so the client returns to the primary once it is reachable again.
+func (c *Client) Probe(ctx context.Context, timeout time.Duration) error {
+	var firstErr error
+	for i, u := range c.urls {
+		pctx, cancel := c.withTimeout(ctx, timeout)
+		code, err := c.do(pctx, u, http.MethodGet, "/rest/noauth/health", nil, nil, nil)
+		cancel()
+		if code > 0 {
+			c.switchTo(c.activeIndex(), i)
+			return nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
 }
 
-func (c *Client) doJSON(ctx context.Context, method, p string, q url.Values, timeout time.Duration, out any) (int, error) {
-	ctx, cancel := withTimeout(ctx, timeout)
+// doJSON sends a request to the active address. A GET that fails because its
+// keep-alive connection was dropped is retried once on a fresh connection. If the
+// address cannot be dialed the request was never delivered, so it is safe to retry
+// it once on the other address.
+func (c *Client) doJSON(ctx context.Context, method, p string, q url.Values, in any, timeout time.Duration, out any) (int, error) {
+	ctx, cancel := c.withTimeout(ctx, timeout)
 	defer cancel()
 
-	u := *c.baseURL
-	u.Path = path.Join(c.baseURL.Path, strings.TrimPrefix(p, "/"))
+	idx := c.activeIndex()
+	code, err := c.do(ctx, c.urls[idx], method, p, q, in, out)
+	if err != nil && method == http.MethodGet && ctx.Err() == nil && isConnDropped(err) {
+		if c.onRetry != nil {
+			c.onRetry(method, p, err)
+		}
+		c.hc.CloseIdleConnections()
+		code, err = c.do(ctx, c.urls[idx], method, p, q, in, out)
+	}
+	if err == nil || len(c.urls) < 2 || ctx.Err() != nil || !isDialError(err) {
+		return code, err
+	}
+	other := (idx + 1) % len(c.urls)
+	code2, err2 := c.do(ctx, c.urls[other], method, p, q, in, out)
+	if code2 == 0 {
+		return code, err
+	}
+	c.switchTo(idx, other)
+	return code2, err2
+}
+
+func (c *Client) do(ctx context.Context, base *url.URL, method, p string, q url.Values, in, out any) (status int, err error) {
+	if c.observe != nil {
+		start := time.Now()
+		defer func() { c.observe(method, p, status, time.Since(start), err) }()
+	}
+	// Errors reach logs, hooks, /api/status and the history, so none may carry the key:
+	// neither the one this call started with nor one a 403 rotated it to.
+	original := c.key()
+	key := original
+	defer func() { err = RedactError(RedactError(err, original), key) }()
+
+	u := *base
+	u.Path = path.Join(base.Path, strings.TrimPrefix(p, "/"))
 	u.RawQuery = q.Encode()
 
-	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
-	if err != nil {
-		return 0, err
+	var data []byte
+	if in != nil {
+		if data, err = json.Marshal(in); err != nil {
+			return 0, err
+		}
 	}
-	req.Header.Set("X-API-Key", c.apiKey)
-	req.Header.Set("Accept", "application/json")
+	// In session mode a 401 or 403 means the session expired or the CSRF token was
+	// rotated: log in again and retry once. With an API key, a 403 retries once if
+	// ReloadKey has a new key.
+	authenticate := c.session != nil && !strings.HasPrefix(p, "/rest/noauth/")
+	var resp *http.Response
+	var tok csrfToken
+	for attempt := 0; ; attempt++ {
+		var reqBody io.Reader
+		if in != nil {
+			reqBody = bytes.NewReader(data)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, u.String(), reqBody)
+		if err != nil {
+			return 0, err
+		}
+		if authenticate {
+			var stale *csrfToken
+			if attempt > 0 {
+				stale = &tok
+			}
+			if tok, err = c.session.token(ctx, c.hc, base, stale); err != nil {
+				return 0, err
+			}
+			req.Header.Set(tok.header, tok.value)
+		} else if c.session == nil {
+			req.Header.Set("X-API-Key", key)
+		}
+		req.Header.Set("Accept", "application/json")
+		if in != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
 
-	resp, err := c.hc.Do(req)
-	if err != nil {
-		return 0, err
+		if resp, err = c.hc.Do(req); err != nil {
+			return 0, err
+		}
+		retry := false
+		switch {
+		case attempt > 0:
+		case authenticate:
+			retry = resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden
+		case c.session == nil && resp.StatusCode == http.StatusForbidden:
+			retry = c.rotateKey(key)
+		}
+		if !retry {
+			break
+		}
+		resp.Body.Close()
+		key = c.key()
 	}
 	defer resp.Body.Close()
 
+	if d, ok := out.(bodyDecoder); ok && resp.StatusCode < 400 {
+		return resp.StatusCode, d.decodeBody(resp.Body)
+	}
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return resp.StatusCode, err
 	}
 
 	if resp.StatusCode >= 400 {
-		if len(body) == 0 {
-			return resp.StatusCode, errors.New("http error")
+		return resp.StatusCode, &APIError{
+			Method:   method,
+			Path:     p,
+			Status:   resp.StatusCode,
+			Body:     RedactString(string(body), key),
+			maxBody:  c.maxErrorBody,
+			notFound: isFolderNotFoundBody(resp.StatusCode, string(body)),
 		}
-		return resp.StatusCode, fmt.Errorf("http error: %s", strings.TrimSpace(string(body)))
 	}
 
 	if out == nil {
 		return resp.StatusCode, nil
 	}
+	// Callers that only want a success check pass a throwaway *any; some endpoints
+	// (POST /rest/db/scan among them) answer with an empty or non-JSON body.
+	if _, discard := out.(*any); discard && (len(bytes.TrimSpace(body)) == 0 || !isJSON(resp.Header.Get("Content-Type"))) {
+		return resp.StatusCode, nil
+	}
 
 	if err := json.Unmarshal(body, out); err != nil {
 		return resp.StatusCode, err
@@ -90,42 +410,483 @@ func (c *Client) doJSON(ctx context.Context, method, p string, q url.Values, tim
 	return resp.StatusCode, nil
 }
 
-func (c *Client) PostScan(ctx context.Context, folder string, timeout time.Duration) (int, error) {
+// isJSON reports whether a Content-Type header names JSON. A missing header counts,
+// as the body may still be JSON.
+func isJSON(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mt, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mt == "application/json" || strings.HasSuffix(mt, "+json"))
+}
+
+// isDialError reports whether err happened while connecting, before anything was sent.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// isConnDropped reports whether err means the connection went away mid-request (a
+// stale keep-alive connection), rather than Syncthing answering or being unreachable.
+func isConnDropped(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// ScanOptions narrows or tunes a scan request.
+type ScanOptions struct {
+	Sub  []string      // sub-paths within the folder; empty scans the whole folder
+	Next time.Duration // delay Syncthing's next automatic rescan of the folder by this much; 0 leaves it alone
+}
+
+func (c *Client) PostScan(ctx context.Context, folder string, opts ScanOptions, timeout time.Duration) (int, error) {
 	q := url.Values{}
 	if strings.TrimSpace(folder) != "" && folder != "*" {
 		q.Set("folder", folder)
+		for _, sub := range opts.Sub {
+			q.Add("sub", sub)
+		}
+		if opts.Next > 0 {
+			// Syncthing takes whole seconds; round up so a short delay is not dropped.
+			q.Set("next", strconv.FormatInt(int64((opts.Next+time.Second-1)/time.Second), 10))
+		}
 	}
 	var ignore any
-	return c.doJSON(ctx, http.MethodPost, "/rest/db/scan", q, timeout, &ignore)
+	return c.doJSON(ctx, http.MethodPost, "/rest/db/scan", q, nil, timeout, &ignore)
 }
 
 type FolderStatus struct {
-	State       string `json:"state"`
-	NeedBytes   int64  `json:"needBytes"`
-	InSyncBytes int64  `json:"inSyncBytes"`
+	State        string    `json:"state"`
+	StateChanged time.Time `json:"stateChanged"`
+	NeedBytes    int64     `json:"needBytes"`
+	InSyncBytes  int64     `json:"inSyncBytes"`
+	Sequence     int64     `json:"sequence"`
+	Errors       int64     `json:"errors"`
+	Error        string    `json:"error"` // why the folder is in the error state
+
+	NeedFiles       int64 `json:"needFiles"`
+	NeedDirectories int64 `json:"needDirectories"`
+	NeedSymlinks    int64 `json:"needSymlinks"`
+	NeedDeletes     int64 `json:"needDeletes"`
+
+	ReceiveOnlyChangedFiles       int64 `json:"receiveOnlyChangedFiles"`
+	ReceiveOnlyChangedDirectories int64 `json:"receiveOnlyChangedDirectories"`
+	ReceiveOnlyChangedDeletes     int64 `json:"receiveOnlyChangedDeletes"`
+	ReceiveOnlyChangedBytes       int64 `json:"receiveOnlyChangedBytes"`
+}
+
+// FileError is one entry of /rest/folder/errors: a file the folder failed to sync.
+type FileError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// FolderErrors returns up to perPage of folder's current file errors.
+func (c *Client) FolderErrors(ctx context.Context, folder string, perPage int, timeout time.Duration) ([]FileError, int, error) {
+	q := url.Values{}
+	q.Set("folder", folder)
+	q.Set("page", "1")
+	q.Set("perpage", strconv.Itoa(perPage))
+	var out struct {
+		Errors []FileError `json:"errors"`
+	}
+	code, err := c.doJSON(ctx, http.MethodGet, "/rest/folder/errors", q, nil, timeout, &out)
+	return out.Errors, code, err
 }
 
 func (c *Client) FolderStatus(ctx context.Context, folder string, timeout time.Duration) (FolderStatus, int, error) {
 	q := url.Values{}
 	q.Set("folder", folder)
 	var st FolderStatus
-	code, err := c.doJSON(ctx, http.MethodGet, "/rest/db/status", q, timeout, &st)
+	code, err := c.doJSON(ctx, http.MethodGet, "/rest/db/status", q, nil, timeout, &st)
 	return st, code, err
 }
 
+// Override makes the cluster match a send-only folder's local copy, undoing remote
+// changes to it.
+func (c *Client) Override(ctx context.Context, folder string, timeout time.Duration) (int, error) {
+	q := url.Values{}
+	q.Set("folder", folder)
+	return c.doJSON(ctx, http.MethodPost, "/rest/db/override", q, nil, timeout, nil)
+}
+
+// Revert undoes the local changes of a receive-only folder, bringing it back in line
+// with the cluster.
+func (c *Client) Revert(ctx context.Context, folder string, timeout time.Duration) (int, error) {
+	q := url.Values{}
+	q.Set("folder", folder)
+	return c.doJSON(ctx, http.MethodPost, "/rest/db/revert", q, nil, timeout, nil)
+}
+
+// FileVersion is one archived version of a file, as listed by /rest/folder/versions.
+type FileVersion struct {
+	VersionTime time.Time `json:"versionTime"`
+	ModTime     time.Time `json:"modTime"`
+	Size        int64     `json:"size"`
+}
+
+// Versions lists the archived versions of the files in folder, keyed by path.
+func (c *Client) Versions(ctx context.Context, folder string, timeout time.Duration) (map[string][]FileVersion, int, error) {
+	q := url.Values{}
+	q.Set("folder", folder)
+	var versions map[string][]FileVersion
+	code, err := c.doJSON(ctx, http.MethodGet, "/rest/folder/versions", q, nil, timeout, &versions)
+	return versions, code, err
+}
+
+// RestoreVersions restores, for each path, the archived version of folder's file
+// with that version time. It returns the paths that could not be restored, with why.
+func (c *Client) RestoreVersions(ctx context.Context, folder string, versions map[string]time.Time, timeout time.Duration) (map[string]string, int, error) {
+	q := url.Values{}
+	q.Set("folder", folder)
+	var failed map[string]string
+	code, err := c.doJSON(ctx, http.MethodPost, "/rest/folder/versions", q, versions, timeout, &failed)
+	return failed, code, err
+}
+
+// FolderCompletion is the response of /rest/db/completion.
+type FolderCompletion struct {
+	Completion  float64 `json:"completion"`
+	GlobalBytes int64   `json:"globalBytes"`
+	NeedBytes   int64   `json:"needBytes"`
+	NeedItems   int64   `json:"needItems"`
+	NeedDeletes int64   `json:"needDeletes"`
+	RemoteState string  `json:"remoteState"`
+}
+
+// Completion returns how far device is from completing folder. An empty device
+// aggregates over all remote devices sharing the folder.
+func (c *Client) Completion(ctx context.Context, folder, device string, timeout time.Duration) (FolderCompletion, int, error) {
+	q := url.Values{}
+	q.Set("folder", folder)
+	if device != "" {
+		q.Set("device", device)
+	}
+	var fc FolderCompletion
+	code, err := c.doJSON(ctx, http.MethodGet, "/rest/db/completion", q, nil, timeout, &fc)
+	return fc, code, err
+}
+
+// FolderStatistics is one folder's entry in /rest/stats/folder.
+type FolderStatistics struct {
+	LastScan time.Time `json:"lastScan"`
+}
+
+// FolderStats returns per-folder statistics keyed by folder ID.
+func (c *Client) FolderStats(ctx context.Context, timeout time.Duration) (map[string]FolderStatistics, int, error) {
+	var stats map[string]FolderStatistics
+	code, err := c.doJSON(ctx, http.MethodGet, "/rest/stats/folder", nil, nil, timeout, &stats)
+	return stats, code, err
+}
+
+// DeviceStatistics is one device's entry in /rest/stats/device. LastSeen is the
+// Unix epoch for a device that was never connected.
+type DeviceStatistics struct {
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// DeviceStats returns per-device statistics keyed by device ID.
+func (c *Client) DeviceStats(ctx context.Context, timeout time.Duration) (map[string]DeviceStatistics, int, error) {
+	var stats map[string]DeviceStatistics
+	code, err := c.doJSON(ctx, http.MethodGet, "/rest/stats/device", nil, nil, timeout, &stats)
+	return stats, code, err
+}
+
+// Connection is one device's entry in /rest/system/connections.
+type Connection struct {
+	Connected bool   `json:"connected"`
+	Paused    bool   `json:"paused"`
+	Address   string `json:"address"`
+}
+
+// Connections returns the connection state of every configured device, keyed by
+// device ID.
+func (c *Client) Connections(ctx context.Context, timeout time.Duration) (map[string]Connection, int, error) {
+	var out struct {
+		Connections map[string]Connection `json:"connections"`
+	}
+	code, err := c.doJSON(ctx, http.MethodGet, "/rest/system/connections", nil, nil, timeout, &out)
+	return out.Connections, code, err
+}
+
+type FolderConfig struct {
+	ID               string `json:"id"`
+	Label            string `json:"label"`
+	Type             string `json:"type"` // sendreceive, sendonly, receiveonly or receiveencrypted
+	Path             string `json:"path"`
+	Paused           bool   `json:"paused"`
+	RescanIntervalS  int    `json:"rescanIntervalS"`
+	FSWatcherEnabled bool   `json:"fsWatcherEnabled"`
+	// Devices are the devices the folder is shared with, the local one included.
+	Devices []FolderDevice `json:"devices,omitempty"`
+}
+
 type Config struct {
-	Folders []struct {
-		ID string `json:"id"`
-	} `json:"folders"`
+	Folders []FolderConfig `json:"folders"`
 }
 
 func (c *Client) SystemConfig(ctx context.Context, timeout time.Duration) (Config, int, error) {
 	var cfg Config
-	code, err := c.doJSON(ctx, http.MethodGet, "/rest/system/config", nil, timeout, &cfg)
+	code, err := c.doJSON(ctx, http.MethodGet, "/rest/system/config", nil, nil, timeout, &cfg)
 	return cfg, code, err
 }
 
-func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+// ConfigVersion returns a number that advances whenever Syncthing saves its config:
+// the ID of the latest ConfigSaved event, or 0 before the first. The "version" in
+// the config itself is its schema version, which edits leave alone. IDs restart with
+// Syncthing, so compare versions from the same process only.
+func (c *Client) ConfigVersion(ctx context.Context, timeout time.Duration) (int64, int, error) {
+	q := url.Values{"events": {"ConfigSaved"}, "since": {"0"}, "limit": {"1"}, "timeout": {"0"}}
+	var events []Event
+	code, err := c.doJSON(ctx, http.MethodGet, "/rest/events", q, nil, timeout, &events)
+	if err != nil || len(events) == 0 {
+		return 0, code, err
+	}
+	return events[len(events)-1].ID, code, nil
+}
+
+// Folder returns the current configuration of one folder.
+func (c *Client) Folder(ctx context.Context, folder string, timeout time.Duration) (FolderConfig, int, error) {
+	var f FolderConfig
+	code, err := c.doJSON(ctx, http.MethodGet, "/rest/config/folders/"+folder, nil, nil, timeout, &f)
+	return f, code, err
+}
+
+// NewFolder is a folder to add to Syncthing's configuration; Syncthing fills in its
+// defaults for everything else and shares it with the local device too.
+type NewFolder struct {
+	ID      string         `json:"id"`
+	Label   string         `json:"label,omitempty"`
+	Path    string         `json:"path"`
+	Type    string         `json:"type"`
+	Devices []FolderDevice `json:"devices"`
+}
+
+// FolderDevice is a device a folder is shared with.
+type FolderDevice struct {
+	DeviceID string `json:"deviceID"`
+}
+
+// AddFolder adds a folder to the configuration.
+func (c *Client) AddFolder(ctx context.Context, f NewFolder, timeout time.Duration) (int, error) {
+	return c.doJSON(ctx, http.MethodPost, "/rest/config/folders", nil, f, timeout, nil)
+}
+
+// ShareFolder shares folder with deviceID as well. The folder's device list is read
+// and written back whole, so the settings of the devices already on it are kept.
+func (c *Client) ShareFolder(ctx context.Context, folder, deviceID string, timeout time.Duration) (int, error) {
+	var cfg struct {
+		Devices []map[string]json.RawMessage `json:"devices"`
+	}
+	code, err := c.doJSON(ctx, http.MethodGet, "/rest/config/folders/"+folder, nil, nil, timeout, &cfg)
+	if err != nil {
+		return code, err
+	}
+	for _, dev := range cfg.Devices {
+		var id string
+		if json.Unmarshal(dev["deviceID"], &id) == nil && id == deviceID {
+			return code, nil
+		}
+	}
+	cfg.Devices = append(cfg.Devices, map[string]json.RawMessage{"deviceID": json.RawMessage(strconv.Quote(deviceID))})
+	return c.doJSON(ctx, http.MethodPatch, "/rest/config/folders/"+folder, nil, map[string]any{"devices": cfg.Devices}, timeout, nil)
+}
+
+// PendingFolderOffer is one device's offer of a folder that is not shared with it.
+type PendingFolderOffer struct {
+	Time  time.Time `json:"time"`
+	Label string    `json:"label"`
+}
+
+// PendingFolder lists the devices offering a folder, keyed by device ID.
+type PendingFolder struct {
+	OfferedBy map[string]PendingFolderOffer `json:"offeredBy"`
+}
+
+// PendingFolders returns the folders offered by other devices and not yet shared
+// with them, keyed by folder ID.
+func (c *Client) PendingFolders(ctx context.Context, timeout time.Duration) (map[string]PendingFolder, int, error) {
+	var pending map[string]PendingFolder
+	code, err := c.doJSON(ctx, http.MethodGet, "/rest/cluster/pending/folders", nil, nil, timeout, &pending)
+	return pending, code, err
+}
+
+// SetFolderPaused pauses or resumes a folder, leaving the rest of its configuration alone.
+func (c *Client) SetFolderPaused(ctx context.Context, folder string, paused bool, timeout time.Duration) (int, error) {
+	return c.doJSON(ctx, http.MethodPatch, "/rest/config/folders/"+folder, nil, map[string]bool{"paused": paused}, timeout, nil)
+}
+
+// PauseFolder pauses a folder through its config, like SetFolderPaused. An unknown
+// folder is an *APIError matching ErrFolderNotFound.
+func (c *Client) PauseFolder(ctx context.Context, folder string, timeout time.Duration) (int, error) {
+	return c.SetFolderPaused(ctx, folder, true, timeout)
+}
+
+// ResumeFolder resumes a paused folder; see PauseFolder.
+func (c *Client) ResumeFolder(ctx context.Context, folder string, timeout time.Duration) (int, error) {
+	return c.SetFolderPaused(ctx, folder, false, timeout)
+}
+
+// SetFolderRescanInterval sets a folder's rescanIntervalS (0 disables Syncthing's own
+// periodic scans), leaving the rest of its configuration alone.
+func (c *Client) SetFolderRescanInterval(ctx context.Context, folder string, seconds int, timeout time.Duration) (int, error) {
+	return c.doJSON(ctx, http.MethodPatch, "/rest/config/folders/"+folder, nil, map[string]int{"rescanIntervalS": seconds}, timeout, nil)
+}
+
+// SetFolderWatcher turns a folder's filesystem watcher on or off, leaving the rest of
+// its configuration alone.
+func (c *Client) SetFolderWatcher(ctx context.Context, folder string, enabled bool, timeout time.Duration) (int, error) {
+	return c.doJSON(ctx, http.MethodPatch, "/rest/config/folders/"+folder, nil, map[string]bool{"fsWatcherEnabled": enabled}, timeout, nil)
+}
+
+// DeviceConfig is one device's entry in Syncthing's configuration.
+type DeviceConfig struct {
+	DeviceID string `json:"deviceID"`
+	Name     string `json:"name"`
+	Paused   bool   `json:"paused"`
+}
+
+// Devices returns the configured devices.
+func (c *Client) Devices(ctx context.Context, timeout time.Duration) ([]DeviceConfig, int, error) {
+	var devices []DeviceConfig
+	code, err := c.doJSON(ctx, http.MethodGet, "/rest/config/devices", nil, nil, timeout, &devices)
+	return devices, code, err
+}
+
+// SetDevicePaused pauses or resumes a device, leaving the rest of its configuration alone.
+func (c *Client) SetDevicePaused(ctx context.Context, deviceID string, paused bool, timeout time.Duration) (int, error) {
+	return c.doJSON(ctx, http.MethodPatch, "/rest/config/devices/"+deviceID, nil, map[string]bool{"paused": paused}, timeout, nil)
+}
+
+// NewDevice is a device to add to Syncthing's configuration; Syncthing fills in its
+// defaults for everything else.
+type NewDevice struct {
+	DeviceID          string `json:"deviceID"`
+	Name              string `json:"name,omitempty"`
+	Introducer        bool   `json:"introducer"`
+	AutoAcceptFolders bool   `json:"autoAcceptFolders"`
+}
+
+// AddDevice adds a device to the configuration.
+func (c *Client) AddDevice(ctx context.Context, dev NewDevice, timeout time.Duration) (int, error) {
+	return c.doJSON(ctx, http.MethodPost, "/rest/config/devices", nil, dev, timeout, nil)
+}
+
+// PendingDevice is a device that tried to connect without being configured.
+type PendingDevice struct {
+	Time    time.Time `json:"time"`
+	Name    string    `json:"name"`
+	Address string    `json:"address"`
+}
+
+// PendingDevices returns the devices waiting to be accepted, keyed by device ID.
+func (c *Client) PendingDevices(ctx context.Context, timeout time.Duration) (map[string]PendingDevice, int, error) {
+	var pending map[string]PendingDevice
+	code, err := c.doJSON(ctx, http.MethodGet, "/rest/cluster/pending/devices", nil, nil, timeout, &pending)
+	return pending, code, err
+}
+
+// Options is Syncthing's global options object. It is kept as raw JSON, so writing
+// back what GetOptions returned leaves the settings this package does not know
+// about as they were.
+type Options map[string]json.RawMessage
+
+// Int returns the integer option key, or 0 when it is unset or not a number.
+func (o Options) Int(key string) int {
+	var v int
+	_ = json.Unmarshal(o[key], &v)
+	return v
+}
+
+// SetInt sets the integer option key.
+func (o Options) SetInt(key string, v int) {
+	o[key] = json.RawMessage(strconv.Itoa(v))
+}
+
+// GetOptions returns the global options, e.g. maxSendKbps and maxRecvKbps.
+func (c *Client) GetOptions(ctx context.Context, timeout time.Duration) (Options, int, error) {
+	var opts Options
+	code, err := c.doJSON(ctx, http.MethodGet, "/rest/config/options", nil, nil, timeout, &opts)
+	if err == nil && opts == nil {
+		// A null body decodes to a nil map, which SetInt could not write to.
+		opts = Options{}
+	}
+	return opts, code, err
+}
+
+// SetOptions replaces the global options with opts; read them with GetOptions first.
+func (c *Client) SetOptions(ctx context.Context, opts Options, timeout time.Duration) (int, error) {
+	return c.doJSON(ctx, http.MethodPut, "/rest/config/options", nil, opts, timeout, nil)
+}
+
+type SystemStatus struct {
+	MyID      string    `json:"myID"`
+	StartTime time.Time `json:"startTime"`
+	Uptime    int64     `json:"uptime"`
+}
+
+func (c *Client) SystemStatus(ctx context.Context, timeout time.Duration) (SystemStatus, int, error) {
+	var st SystemStatus
+	code, err := c.doJSON(ctx, http.MethodGet, "/rest/system/status", nil, nil, timeout, &st)
+	return st, code, err
+}
+
+// SystemVersion is what /rest/system/version reports about the Syncthing build.
+type SystemVersion struct {
+	Version     string `json:"version"`
+	LongVersion string `json:"longVersion"`
+	OS          string `json:"os"`
+	Arch        string `json:"arch"`
+}
+
+func (c *Client) SystemVersion(ctx context.Context, timeout time.Duration) (SystemVersion, int, error) {
+	var v SystemVersion
+	code, err := c.doJSON(ctx, http.MethodGet, "/rest/system/version", nil, nil, timeout, &v)
+	return v, code, err
+}
+
+// Ping checks that Syncthing answers authenticated requests.
+func (c *Client) Ping(ctx context.Context, timeout time.Duration) (int, error) {
+	return c.doJSON(ctx, http.MethodGet, "/rest/system/ping", nil, nil, timeout, nil)
+}
+
+// Restart asks Syncthing to restart itself; it answers before going down.
+func (c *Client) Restart(ctx context.Context, timeout time.Duration) (int, error) {
+	return c.doJSON(ctx, http.MethodPost, "/rest/system/restart", nil, nil, timeout, nil)
+}
+
+// Event is one entry from Syncthing's /rest/events stream.
+type Event struct {
+	ID       int64           `json:"id"`
+	GlobalID int64           `json:"globalID"`
+	Type     string          `json:"type"`
+	Time     time.Time       `json:"time"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// Events long-polls /rest/events for events after since, waiting up to wait for new ones.
+// limit > 0 returns only the most recent events; types filters by event type.
+func (c *Client) Events(ctx context.Context, since int64, limit int, types []string, wait time.Duration) ([]Event, int, error) {
+	q := url.Values{}
+	q.Set("since", strconv.FormatInt(since, 10))
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	if len(types) > 0 {
+		q.Set("events", strings.Join(types, ","))
+	}
+	q.Set("timeout", strconv.Itoa(int(wait/time.Second)))
+	var events []Event
+	code, err := c.doJSON(ctx, http.MethodGet, "/rest/events", q, nil, wait+10*time.Second, &events)
+	return events, code, err
+}
+
+// withTimeout bounds a call by the shorter of its own timeout and RequestTimeout,
+// ignoring whichever is 0. Timeouts are only ever context deadlines, so a call that
+// runs out of time fails with an error matching context.DeadlineExceeded.
+func (c *Client) withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 || (c.requestTimeout > 0 && c.requestTimeout < d) {
+		d = c.requestTimeout
+	}
 	if d <= 0 {
 		return ctx, func() {}
 	}
@@ -0,0 +1,60 @@
+package syncthing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientTimeouts(t *testing.T) {
+	const (
+		answer = 200 * time.Millisecond // how long Syncthing takes
+		short  = 20 * time.Millisecond
+		long   = 5 * time.Second
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(answer):
+			writeJSON(w, map[string]any{})
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	for _, tc := range []struct {
+		name            string
+		client, perCall time.Duration
+		timesOut        bool
+	}{
+		{"no timeouts", 0, 0, false},
+		{"client only", short, 0, true},
+		{"call only", 0, short, true},
+		{"client shorter", short, long, true},
+		{"call shorter", long, short, true},
+		{"both long", long, long, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client, err := NewClient(srv.URL, "test-key", ClientOptions{RequestTimeout: tc.client})
+			if err != nil {
+				t.Fatalf("new client: %v", err)
+			}
+			start := time.Now()
+			_, err = client.PostScan(context.Background(), "docs", ScanOptions{}, tc.perCall)
+			if !tc.timesOut {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("expected a context deadline error, got %v", err)
+			}
+			if took := time.Since(start); took >= answer {
+				t.Fatalf("expected the shorter timeout to apply, took %s", took)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package syncthing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// bodyDecoder is implemented by results that decode a successful response straight
+// from the body, instead of doJSON reading it whole first.
+type bodyDecoder interface {
+	decodeBody(r io.Reader) error
+}
+
+// ConfigFolders returns the folders of /rest/system/config, streaming the response
+// and decoding nothing but the folders array, so a large config (many devices,
+// long address lists, defaults) is never held in memory whole. With light set, each
+// folder carries only its ID, label and paused flag. SystemConfig still decodes
+// the config the usual way.
+func (c *Client) ConfigFolders(ctx context.Context, timeout time.Duration, light bool) ([]FolderConfig, int, error) {
+	out := &configFolders{light: light}
+	code, err := c.doJSON(ctx, http.MethodGet, "/rest/system/config", nil, nil, timeout, out)
+	return out.folders, code, err
+}
+
+// configFolders walks a config document's top-level keys with a token decoder,
+// decoding the folders array element by element and skipping everything else.
+type configFolders struct {
+	light   bool
+	folders []FolderConfig
+}
+
+// lightFolder is what a light ConfigFolders decodes of each folder.
+type lightFolder struct {
+	ID     string `json:"id"`
+	Label  string `json:"label"`
+	Paused bool   `json:"paused"`
+}
+
+// skipValue swallows a JSON value without decoding it.
+type skipValue struct{}
+
+func (*skipValue) UnmarshalJSON([]byte) error { return nil }
+
+func (cf *configFolders) decodeBody(r io.Reader) error {
+	cf.folders = nil // a retried request starts over
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if key != "folders" {
+			if err := dec.Decode(&skipValue{}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := cf.decodeFolders(dec); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+func (cf *configFolders) decodeFolders(dec *json.Decoder) error {
+	tok, err := dec.Token()
+	if err != nil || tok == nil {
+		return err
+	}
+	if tok != json.Delim('[') {
+		return fmt.Errorf("config folders: expected an array, got %v", tok)
+	}
+	for dec.More() {
+		if cf.light {
+			var f lightFolder
+			if err := dec.Decode(&f); err != nil {
+				return err
+			}
+			cf.folders = append(cf.folders, FolderConfig{ID: f.ID, Label: f.Label, Paused: f.Paused})
+			continue
+		}
+		var f FolderConfig
+		if err := dec.Decode(&f); err != nil {
+			return err
+		}
+		cf.folders = append(cf.folders, f)
+	}
+	return expectDelim(dec, ']')
+}
+
+// expectDelim reads the next token, failing unless it is delim.
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("config: expected %v, got %v", delim, tok)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package syncthing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// largeConfig builds a /rest/system/config body of roughly the size a busy
+// instance serves: many devices with long address lists, folders shared with
+// dozens of them, and the sections the kicker never reads.
+func largeConfig(folders, devices int) []byte {
+	type device struct {
+		DeviceID   string   `json:"deviceID"`
+		Name       string   `json:"name"`
+		Addresses  []string `json:"addresses"`
+		Introducer bool     `json:"introducer"`
+	}
+	type folderDevice struct {
+		DeviceID           string `json:"deviceID"`
+		IntroducedBy       string `json:"introducedBy"`
+		EncryptionPassword string `json:"encryptionPassword"`
+	}
+	type folder struct {
+		FolderConfig
+		Devices        []folderDevice    `json:"devices"`
+		Versioning     map[string]any    `json:"versioning"`
+		IgnorePerms    bool              `json:"ignorePerms"`
+		MarkerName     string            `json:"markerName"`
+		XattrFilter    map[string]any    `json:"xattrFilter"`
+		MinDiskFree    map[string]string `json:"minDiskFree"`
+		CopyOwnership  bool              `json:"copyOwnershipFromParent"`
+		PullerMaxPend  int               `json:"pullerMaxPendingKiB"`
+		BlockPullOrder string            `json:"blockPullOrder"`
+	}
+	cfg := map[string]any{
+		"version": 37,
+		"gui":     map[string]any{"enabled": true, "address": "127.0.0.1:8384", "apiKey": "redacted", "theme": "default"},
+		"options": map[string]any{"listenAddresses": []string{"default"}, "globalAnnounceServers": []string{"default"}, "maxSendKbps": 0},
+		"ldap":    map[string]any{},
+	}
+	devs := make([]device, devices)
+	for i := range devs {
+		id := fmt.Sprintf("DEV%04d-AAAAAAA-BBBBBBB-CCCCCCC-DDDDDDD-EEEEEEE-FFFFFFF-GGGGGGG", i)
+		devs[i] = device{DeviceID: id, Name: fmt.Sprintf("device %d", i)}
+		for j := range 8 {
+			devs[i].Addresses = append(devs[i].Addresses, fmt.Sprintf("tcp://host-%d-%d.example.net:22000", i, j))
+		}
+	}
+	cfg["devices"] = devs
+	fs := make([]folder, folders)
+	for i := range fs {
+		fs[i] = folder{
+			FolderConfig: FolderConfig{
+				ID: fmt.Sprintf("folder-%04d", i), Label: fmt.Sprintf("Folder %d", i), Type: "sendreceive",
+				Path: fmt.Sprintf("/srv/sync/folder-%04d", i), Paused: i%10 == 0, RescanIntervalS: 3600, FSWatcherEnabled: true,
+			},
+			Versioning:     map[string]any{"type": "staggered", "params": map[string]string{"maxAge": "31536000"}},
+			MarkerName:     ".stfolder",
+			XattrFilter:    map[string]any{"entries": []any{}, "maxSingleEntrySize": 1024},
+			MinDiskFree:    map[string]string{"value": "1", "unit": "%"},
+			BlockPullOrder: "standard",
+		}
+		for j := range 40 {
+			fs[i].Devices = append(fs[i].Devices, folderDevice{DeviceID: devs[(i+j)%devices].DeviceID})
+		}
+	}
+	cfg["folders"] = fs
+	cfg["defaults"] = map[string]any{"folder": fs[0], "device": devs[0]}
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		panic(err)
+	}
+	return raw
+}
+
+func serveConfig(tb testing.TB, body []byte) *Client {
+	tb.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}))
+	tb.Cleanup(srv.Close)
+	client, err := NewClient(srv.URL, "test-key", ClientOptions{})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return client
+}
+
+func TestConfigFoldersStreamsTheFoldersArray(t *testing.T) {
+	client := serveConfig(t, largeConfig(50, 20))
+	ctx := context.Background()
+
+	cfg, _, err := client.SystemConfig(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	streamed, _, err := client.ConfigFolders(ctx, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streamed) != 50 || !reflect.DeepEqual(streamed, cfg.Folders) {
+		t.Fatalf("streamed folders differ from the full decode")
+	}
+	light, _, err := client.ConfigFolders(ctx, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range light {
+		want := FolderConfig{ID: cfg.Folders[i].ID, Label: cfg.Folders[i].Label, Paused: cfg.Folders[i].Paused}
+		if !reflect.DeepEqual(f, want) {
+			t.Fatalf("light folder %d = %+v, want %+v", i, f, want)
+		}
+	}
+
+	for _, tc := range []struct{ body, want string }{
+		{`{"version":37,"folders":null}`, ""},
+		{`{"folders":[{"id":"a","label":"A","extra":{"nested":[1,2]}}],"devices":[{"deviceID":"X"}]}`, "a"},
+		{`{"folders":{"id":"a"}}`, "error"},
+		{`{"folders":[{"id":"a"}`, "error"},
+		{`[]`, "error"},
+	} {
+		folders, _, err := serveConfig(t, []byte(tc.body)).ConfigFolders(ctx, 0, true)
+		ids := make([]string, 0, len(folders))
+		for _, f := range folders {
+			ids = append(ids, f.ID)
+		}
+		got := strings.Join(ids, ",")
+		if err != nil {
+			got = "error"
+		}
+		if got != tc.want {
+			t.Fatalf("%s: got %q (%v), want %q", tc.body, got, err, tc.want)
+		}
+	}
+}
+
+// BenchmarkConfigFolders compares fetching the folder list of a large config by
+// decoding it whole with streaming only its folders:
+//
+//	go test ./internal/syncthing -run '^$' -bench ConfigFolders -benchmem
+func BenchmarkConfigFolders(b *testing.B) {
+	body := largeConfig(2000, 400)
+	client := serveConfig(b, body)
+	ctx := context.Background()
+	b.Logf("config is %d KiB", len(body)/1024)
+
+	b.Run("full", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			if _, _, err := client.SystemConfig(ctx, 0); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	for _, light := range []bool{false, true} {
+		name := "stream"
+		if light {
+			name = "light"
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for range b.N {
+				if _, _, err := client.ConfigFolders(ctx, 0, light); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package syncthing
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// burstConnections sends rounds bursts of folders scans, workers at a time, and
+// returns how many connections the server saw opened.
+func burstConnections(t *testing.T, opts ClientOptions, workers, folders, rounds int) int64 {
+	t.Helper()
+	var opened atomic.Int64
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(2 * time.Millisecond) // long enough for the workers to overlap
+		writeJSON(w, map[string]any{})
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			opened.Add(1)
+		}
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+	client, err := NewClient(srv.URL, "test-key", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range rounds {
+		work := make(chan string)
+		var wg sync.WaitGroup
+		for range workers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for folder := range work {
+					if _, err := client.PostScan(context.Background(), folder, ScanOptions{}, 0); err != nil {
+						t.Errorf("scan %s: %v", folder, err)
+					}
+				}
+			}()
+		}
+		for i := range folders {
+			work <- fmt.Sprintf("folder-%d", i)
+		}
+		close(work)
+		wg.Wait()
+	}
+	return opened.Load()
+}
+
+func TestClientReusesConnectionsInBursts(t *testing.T) {
+	// One idle connection per worker's trigger and one for its status check.
+	const workers, folders, rounds = 8, 120, 3
+	const idle = 2 * workers
+
+	untuned := burstConnections(t, ClientOptions{MaxIdleConnsPerHost: 2}, workers, folders, rounds)
+	tuned := burstConnections(t, ClientOptions{MaxIdleConnsPerHost: idle}, workers, folders, rounds)
+	t.Logf("%d scans with %d workers: %d connections with 2 idle, %d with %d idle", folders*rounds, workers, untuned, tuned, idle)
+	if tuned > int64(idle) {
+		t.Fatalf("expected at most %d connections with %d kept idle, got %d", idle, idle, tuned)
+	}
+	if tuned*2 > untuned {
+		t.Fatalf("expected tuning to at least halve new connections: %d tuned, %d untuned", tuned, untuned)
+	}
+
+	// MaxConnsPerHost caps the connections even when more requests are in flight.
+	if capped := burstConnections(t, ClientOptions{MaxIdleConnsPerHost: idle, MaxConnsPerHost: 3}, workers, 30, 1); capped > 3 {
+		t.Fatalf("expected at most 3 connections with MaxConnsPerHost 3, got %d", capped)
+	}
+}
@@ -0,0 +1,29 @@
+package syncthing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGetOptionsNullBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte("null"))
+	}))
+	defer srv.Close()
+	client, err := NewClient(srv.URL, "test-key", ClientOptions{})
+	if err != nil {
+		t.Fatalf("client: %v", err)
+	}
+	opts, _, err := client.GetOptions(context.Background(), time.Second)
+	if err != nil {
+		t.Fatalf("options: %v", err)
+	}
+	opts.SetInt("maxSendKbps", 100)
+	if got := opts.Int("maxSendKbps"); got != 100 {
+		t.Fatalf("expected the option to be set, got %d", got)
+	}
+}
@@ -0,0 +1,70 @@
+package syncthing
+
+import (
+	"net/url"
+	"strings"
+)
+
+// MaskKey hides all but the last 4 characters of an API key, enough to tell keys
+// apart in logs. Keys of 8 characters or fewer are hidden entirely.
+func MaskKey(key string) string {
+	if len(key) <= 8 {
+		return strings.Repeat("*", len(key))
+	}
+	return strings.Repeat("*", len(key)-4) + key[len(key)-4:]
+}
+
+// RedactString masks every occurrence of key in s.
+func RedactString(s, key string) string {
+	if key == "" {
+		return s
+	}
+	return strings.ReplaceAll(s, key, MaskKey(key))
+}
+
+// RedactURL masks key in a URL, along with any password in its user info and the
+// values of query parameters that carry credentials.
+func RedactURL(raw, key string) string {
+	secrets := []string{key}
+	if u, err := url.Parse(raw); err == nil {
+		if pw, ok := u.User.Password(); ok {
+			secrets = append(secrets, pw)
+		}
+		for name, vals := range u.Query() {
+			switch strings.ToLower(name) {
+			case "apikey", "api_key", "key", "token":
+				secrets = append(secrets, vals...)
+			}
+		}
+	}
+	for _, secret := range secrets {
+		if secret != "" {
+			raw = RedactString(RedactString(raw, url.QueryEscape(secret)), secret)
+		}
+	}
+	return raw
+}
+
+// RedactError masks key in err's message, and in the URL of a *url.Error, keeping
+// the error chain intact for errors.Is and errors.As.
+func RedactError(err error, key string) error {
+	if err == nil || key == "" {
+		return err
+	}
+	if urlErr, ok := err.(*url.Error); ok {
+		return &url.Error{Op: urlErr.Op, URL: RedactURL(urlErr.URL, key), Err: RedactError(urlErr.Err, key)}
+	}
+	if !strings.Contains(err.Error(), key) {
+		return err
+	}
+	return &redactedError{err: err, key: key}
+}
+
+// redactedError shows err's message with the key masked.
+type redactedError struct {
+	err error
+	key string
+}
+
+func (e *redactedError) Error() string { return RedactString(e.err.Error(), e.key) }
+func (e *redactedError) Unwrap() error { return e.err }
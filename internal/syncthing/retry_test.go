@@ -0,0 +1,97 @@
+package syncthing
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// droppingServer answers like Syncthing but cuts the first `drop` responses off
+// mid-body, as a keep-alive connection dying under a request does.
+func droppingServer(t *testing.T, drop int) (*httptest.Server, func(path string) int) {
+	t.Helper()
+	var mu sync.Mutex
+	hits := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		n := hits[r.URL.Path]
+		mu.Unlock()
+		if n <= drop {
+			conn, buf, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Errorf("hijack: %v", err)
+				return
+			}
+			_, _ = buf.WriteString("HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: 100\r\n\r\n{\"state\":")
+			_ = buf.Flush()
+			_ = conn.Close()
+			return
+		}
+		writeJSON(w, FolderStatus{State: "idle"})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func(path string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return hits[path]
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestClientRetriesGETOnDroppedConnection(t *testing.T) {
+	srv, hits := droppingServer(t, 1)
+	var retries []string
+	client, err := NewClient(srv.URL, "test-key", ClientOptions{
+		OnRetry: func(method, path string, err error) { retries = append(retries, method+" "+path) },
+	})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+
+	st, code, err := client.FolderStatus(context.Background(), "docs", 0)
+	if err != nil || code != http.StatusOK || st.State != "idle" {
+		t.Fatalf("expected the retry to succeed, got %+v %d %v", st, code, err)
+	}
+	if got := hits("/rest/db/status"); got != 2 {
+		t.Fatalf("expected exactly one retry, got %d requests", got)
+	}
+	if len(retries) != 1 || retries[0] != "GET /rest/db/status" {
+		t.Fatalf("expected one retry hook call, got %v", retries)
+	}
+}
+
+func TestClientRetriesGETOnlyOnce(t *testing.T) {
+	srv, hits := droppingServer(t, 2)
+	client, err := NewClient(srv.URL, "test-key", ClientOptions{})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	if _, _, err := client.SystemConfig(context.Background(), 0); err == nil {
+		t.Fatal("expected the second dropped response to be returned")
+	}
+	if got := hits("/rest/system/config"); got != 2 {
+		t.Fatalf("expected 2 requests, got %d", got)
+	}
+}
+
+func TestClientNeverRetriesPOST(t *testing.T) {
+	srv, hits := droppingServer(t, 1)
+	client, err := NewClient(srv.URL, "test-key", ClientOptions{})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	if _, err := client.PostScan(context.Background(), "docs", ScanOptions{}, 0); err == nil {
+		t.Fatal("expected the dropped scan request to fail")
+	}
+	if got := hits("/rest/db/scan"); got != 1 {
+		t.Fatalf("expected no retry for POST, got %d requests", got)
+	}
+}
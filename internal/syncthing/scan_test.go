@@ -0,0 +1,37 @@
+package syncthing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPostScanAcceptsEmptyResponse(t *testing.T) {
+	bodies := []struct{ contentType, body string }{
+		{"", ""},
+		{"application/json", ""},
+		{"text/plain; charset=utf-8", "OK\n"},
+	}
+	for _, b := range bodies {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if b.contentType != "" {
+				w.Header().Set("Content-Type", b.contentType)
+			}
+			_, _ = w.Write([]byte(b.body))
+		}))
+		client, err := NewClient(srv.URL, "test-key", ClientOptions{})
+		if err != nil {
+			t.Fatalf("client: %v", err)
+		}
+		if code, err := client.PostScan(context.Background(), "docs", ScanOptions{}, time.Second); err != nil || code != http.StatusOK {
+			t.Fatalf("scan answered %q (%s): got %d, %v", b.body, b.contentType, code, err)
+		}
+		// Calls that want the body still fail on an empty one.
+		if _, _, err := client.FolderStatus(context.Background(), "docs", time.Second); err == nil {
+			t.Fatalf("expected an empty status body (%s) to be an error", b.contentType)
+		}
+		srv.Close()
+	}
+}
@@ -0,0 +1,103 @@
+package syncthing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// csrfCookiePrefix names the cookie the GUI keeps its CSRF token in; the rest of the
+// name is the device ID prefix, and the token goes back in an "X-" + name header.
+const csrfCookiePrefix = "CSRF-Token-"
+
+// session logs in to the Syncthing GUI for setups that refuse API keys and only
+// take the GUI's session cookie plus CSRF token. The cookie lives in the client's
+// jar; the token is kept per host, as each address of an instance logs in on its own.
+type session struct {
+	user     string
+	password string
+
+	mu     sync.Mutex
+	tokens map[string]csrfToken
+}
+
+type csrfToken struct {
+	header string
+	value  string
+}
+
+// token returns the CSRF token for base, logging in first when there is none yet or
+// the current one is stale: the token a request was just refused with.
+func (s *session) token(ctx context.Context, hc *http.Client, base *url.URL, stale *csrfToken) (csrfToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if tok, ok := s.tokens[base.Host]; ok && (stale == nil || tok != *stale) {
+		return tok, nil
+	}
+	tok, err := s.login(ctx, hc, base)
+	if err != nil {
+		return csrfToken{}, err
+	}
+	if s.tokens == nil {
+		s.tokens = map[string]csrfToken{}
+	}
+	s.tokens[base.Host] = tok
+	return tok, nil
+}
+
+// login runs the GUI login flow: the password form, or HTTP basic auth on releases
+// that predate it, then a GET of the GUI page, which sets the CSRF cookie.
+func (s *session) login(ctx context.Context, hc *http.Client, base *url.URL) (csrfToken, error) {
+	form, err := json.Marshal(map[string]any{"username": s.user, "password": s.password, "stayLoggedIn": true})
+	if err != nil {
+		return csrfToken{}, err
+	}
+	status, err := s.send(ctx, hc, http.MethodPost, base.JoinPath("rest/noauth/auth/password"), form, false)
+	if err != nil {
+		return csrfToken{}, fmt.Errorf("GUI login: %w", err)
+	}
+	basic := status == http.StatusNotFound
+	if status >= 400 && !basic {
+		return csrfToken{}, fmt.Errorf("GUI login as %s refused: %d %s", s.user, status, http.StatusText(status))
+	}
+	if status, err = s.send(ctx, hc, http.MethodGet, base, nil, basic); err != nil {
+		return csrfToken{}, fmt.Errorf("GUI login: %w", err)
+	}
+	if status >= 400 {
+		return csrfToken{}, fmt.Errorf("GUI login as %s refused: %d %s", s.user, status, http.StatusText(status))
+	}
+	for _, c := range hc.Jar.Cookies(base) {
+		if strings.HasPrefix(c.Name, csrfCookiePrefix) {
+			return csrfToken{header: "X-" + c.Name, value: c.Value}, nil
+		}
+	}
+	return csrfToken{}, errors.New("GUI login: no CSRF token cookie in the response")
+}
+
+// send makes one login request and returns its status, discarding the body.
+func (s *session) send(ctx context.Context, hc *http.Client, method string, u *url.URL, body []byte, basicAuth bool) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if basicAuth {
+		req.SetBasicAuth(s.user, s.password)
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,62 @@
+package syncthingtest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Record starts a proxy in front of the Syncthing at upstream, stopped when the test
+// ends. Clients talk to it with APIKey; it sends apiKey upstream instead and saves
+// the body of every successful GET into dir, named by FixtureName, for Replay.
+// Only GETs are recorded, so a test pointed at production through it should stick
+// to reading. Pointing a client at it from a one-off test captures fresh
+// fixtures:
+//
+//	proxy := syncthingtest.Record(t, "https://nas:8384", key, "testdata/syncthing")
+//	client, _ := syncthing.NewClient(proxy.URL, syncthingtest.APIKey, syncthing.ClientOptions{})
+func Record(tb testing.TB, upstream, apiKey, dir string) *httptest.Server {
+	tb.Helper()
+	target, err := url.Parse(upstream)
+	if err != nil {
+		tb.Fatalf("syncthingtest: upstream: %v", err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		tb.Fatalf("syncthingtest: %v", err)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	direct := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		direct(r)
+		r.Host = target.Host
+		r.Header.Set("X-API-Key", apiKey)
+	}
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		req := resp.Request
+		if req.Method != http.MethodGet || resp.StatusCode != http.StatusOK {
+			return nil
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return os.WriteFile(filepath.Join(dir, FixtureName(req.URL.Path, req.URL.Query())), body, 0o644)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != APIKey {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	tb.Cleanup(srv.Close)
+	return srv
+}
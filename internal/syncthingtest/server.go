@@ -0,0 +1,408 @@
+// Package syncthingtest is a fake Syncthing REST API for tests. It serves the
+// endpoints the kicker's client uses from scriptable per-folder state, records the
+// requests it gets, injects faults (latency, error statuses, dropped connections)
+// and can replay responses recorded from a real Syncthing.
+//
+// New endpoints the client learns belong here, next to the state they read.
+package syncthingtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/syncthing-kicker/internal/syncthing"
+)
+
+// APIKey is the key the server expects in X-API-Key; requests without it get 403,
+// as from Syncthing.
+const APIKey = "syncthingtest"
+
+// Folder is the scriptable state of one folder.
+type Folder struct {
+	Config   syncthing.FolderConfig
+	Status   syncthing.FolderStatus
+	LastScan time.Time // served by /rest/stats/folder when set
+	// Completion answers /rest/db/completion by device ID. Without an entry a folder
+	// needing bytes is 50% complete and any other 100%.
+	Completion map[string]syncthing.FolderCompletion
+}
+
+// Request is one request the server received.
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+}
+
+// Fault changes how the server answers matching requests.
+type Fault struct {
+	Path   string        // the endpoint, e.g. "/rest/db/scan"; "" matches all
+	Folder string        // only requests with this folder parameter; "" matches all
+	Delay  time.Duration // added before answering, or before failing
+	Status int           // answer with this status and a one-line body instead
+	Drop   bool          // close the connection without answering
+	Times  int           // requests it applies to before it is spent; 0 for all
+}
+
+// Server is a running fake Syncthing. Its methods are safe to call while the code
+// under test talks to it.
+type Server struct {
+	URL string
+
+	srv       *httptest.Server
+	mu        sync.Mutex
+	folders   []*Folder
+	startTime time.Time
+	events    []syncthing.Event
+	faults    []*Fault
+	requests  []Request
+	fixtures  map[string][]byte // by fixture name, see Replay
+}
+
+// New starts a server with idle folders of the given IDs, stopped when the test
+// ends.
+func New(tb testing.TB, folders ...string) *Server {
+	tb.Helper()
+	s := &Server{startTime: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	for _, id := range folders {
+		s.folders = append(s.folders, &Folder{Config: syncthing.FolderConfig{ID: id}, Status: syncthing.FolderStatus{State: "idle"}})
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serve))
+	s.URL = s.srv.URL
+	tb.Cleanup(s.srv.Close)
+	return s
+}
+
+// Client returns a client for the server with default options.
+func (s *Server) Client(tb testing.TB) *syncthing.Client {
+	tb.Helper()
+	c, err := syncthing.NewClient(s.URL, APIKey, syncthing.ClientOptions{})
+	if err != nil {
+		tb.Fatalf("syncthingtest: new client: %v", err)
+	}
+	return c
+}
+
+// Close stops the server, so every later request fails to connect.
+func (s *Server) Close() { s.srv.Close() }
+
+// Update changes folder id's state under the server's lock, adding the folder if
+// it does not exist.
+func (s *Server) Update(id string, update func(f *Folder)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.folder(id)
+	if f == nil {
+		f = &Folder{Config: syncthing.FolderConfig{ID: id}, Status: syncthing.FolderStatus{State: "idle"}}
+		s.folders = append(s.folders, f)
+	}
+	update(f)
+}
+
+// SetStatus sets what /rest/db/status reports for folder id.
+func (s *Server) SetStatus(id string, st syncthing.FolderStatus) {
+	s.Update(id, func(f *Folder) { f.Status = st })
+}
+
+// Remove drops folder id, which Syncthing then reports as unknown.
+func (s *Server) Remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.folders = slices.DeleteFunc(s.folders, func(f *Folder) bool { return f.Config.ID == id })
+}
+
+// AddEvent appends an event of type typ with data marshalled as its payload.
+func (s *Server) AddEvent(typ string, data any) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		panic(fmt.Sprintf("syncthingtest: marshal %s event: %v", typ, err))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, syncthing.Event{ID: int64(len(s.events) + 1), Type: typ, Time: time.Now().UTC(), Data: raw})
+}
+
+// Restart moves the reported start time on, as a Syncthing restart would.
+func (s *Server) Restart() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.startTime = s.startTime.Add(time.Hour)
+}
+
+// Inject adds a fault. Faults are matched in the order they were added and the
+// first one that matches applies.
+func (s *Server) Inject(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// Requests returns the requests received so far, faulted ones included.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.requests)
+}
+
+// Count returns how many requests path has received.
+func (s *Server) Count(path string) int {
+	n := 0
+	for _, r := range s.Requests() {
+		if r.Path == path {
+			n++
+		}
+	}
+	return n
+}
+
+// Scans returns the folder parameter of each scan request answered, in order; ""
+// is a scan of every folder.
+func (s *Server) Scans() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []string
+	for _, r := range s.requests {
+		if r.Path == "/rest/db/scan" && r.Method == http.MethodPost {
+			out = append(out, r.Query.Get("folder"))
+		}
+	}
+	return out
+}
+
+func (s *Server) folder(id string) *Folder {
+	for _, f := range s.folders {
+		if f.Config.ID == id {
+			return f
+		}
+	}
+	return nil
+}
+
+// fault returns the fault that applies to r, using up one of its times.
+func (s *Server) fault(r *http.Request) (Fault, bool) {
+	for i, f := range s.faults {
+		if (f.Path != "" && f.Path != r.URL.Path) || (f.Folder != "" && f.Folder != r.URL.Query().Get("folder")) {
+			continue
+		}
+		if f.Times > 0 {
+			if f.Times--; f.Times == 0 {
+				s.faults = slices.Delete(s.faults, i, i+1)
+			}
+		}
+		return *f, true
+	}
+	return Fault{}, false
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Query: r.URL.Query()})
+	f, faulted := s.fault(r)
+	s.mu.Unlock()
+
+	if faulted {
+		time.Sleep(f.Delay) // outside the lock so slow requests overlap
+		switch {
+		case f.Drop:
+			if conn, _, err := http.NewResponseController(w).Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+			panic(http.ErrAbortHandler)
+		case f.Status != 0:
+			http.Error(w, "syncthingtest: injected failure", f.Status)
+			return
+		}
+	}
+	if r.Header.Get("X-API-Key") != APIKey {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if body, ok := s.fixture(r); ok {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+		return
+	}
+	folder := r.URL.Query().Get("folder")
+	if id, ok := strings.CutPrefix(r.URL.Path, "/rest/config/folders/"); ok {
+		s.serveFolderConfig(w, r, id)
+		return
+	}
+	switch r.URL.Path {
+	case "/rest/system/ping":
+		writeJSON(w, map[string]string{"ping": "pong"})
+	case "/rest/system/status":
+		writeJSON(w, syncthing.SystemStatus{MyID: "SYNCTHINGTEST", StartTime: s.startTime})
+	case "/rest/system/version":
+		writeJSON(w, syncthing.SystemVersion{Version: "v1.27.0", OS: "linux", Arch: "amd64"})
+	case "/rest/system/config":
+		writeJSON(w, syncthing.Config{Folders: s.configs()})
+	case "/rest/config/folders":
+		writeJSON(w, s.configs())
+	case "/rest/stats/folder":
+		stats := map[string]syncthing.FolderStatistics{}
+		for _, f := range s.folders {
+			if !f.LastScan.IsZero() {
+				stats[f.Config.ID] = syncthing.FolderStatistics{LastScan: f.LastScan}
+			}
+		}
+		writeJSON(w, stats)
+	case "/rest/db/status":
+		f := s.folder(folder)
+		if f == nil {
+			http.Error(w, "no such folder", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, f.Status)
+	case "/rest/db/completion":
+		f := s.folder(folder)
+		if f == nil {
+			http.Error(w, "no such folder", http.StatusNotFound)
+			return
+		}
+		if fc, ok := f.Completion[r.URL.Query().Get("device")]; ok {
+			writeJSON(w, fc)
+			return
+		}
+		completion := 100.0
+		if f.Status.NeedBytes > 0 {
+			completion = 50
+		}
+		writeJSON(w, syncthing.FolderCompletion{Completion: completion, NeedBytes: f.Status.NeedBytes})
+	case "/rest/db/scan":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if folder != "" && s.folder(folder) == nil {
+			http.Error(w, "no such folder", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string]any{})
+	case "/rest/events":
+		s.serveEvents(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) configs() []syncthing.FolderConfig {
+	out := make([]syncthing.FolderConfig, 0, len(s.folders))
+	for _, f := range s.folders {
+		out = append(out, f.Config)
+	}
+	return out
+}
+
+// serveFolderConfig serves GET and a PATCH of "paused" of one folder's config.
+func (s *Server) serveFolderConfig(w http.ResponseWriter, r *http.Request, id string) {
+	f := s.folder(id)
+	if f == nil {
+		http.Error(w, "No folder with given ID", http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodPatch {
+		var patch struct {
+			Paused *bool `json:"paused"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil || patch.Paused == nil {
+			http.Error(w, "bad patch", http.StatusBadRequest)
+			return
+		}
+		f.Config.Paused = *patch.Paused
+	}
+	writeJSON(w, f.Config)
+}
+
+// serveEvents answers a poll of /rest/events with the events after since, of the
+// listed types, at most limit of them. An empty answer waits a little first, so
+// idle subscribers do not spin.
+func (s *Server) serveEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	since, _ := strconv.ParseInt(q.Get("since"), 10, 64)
+	var types []string
+	if list := q.Get("events"); list != "" {
+		types = strings.Split(list, ",")
+	}
+	out := []syncthing.Event{}
+	for _, ev := range s.events {
+		if ev.ID > since && (types == nil || slices.Contains(types, ev.Type)) {
+			out = append(out, ev)
+		}
+	}
+	if limit, _ := strconv.Atoi(q.Get("limit")); limit > 0 && len(out) > limit {
+		out = out[len(out)-limit:]
+	}
+	if len(out) == 0 {
+		s.mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		s.mu.Lock()
+	}
+	writeJSON(w, out)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// FixtureName is the file a GET of path with query is recorded in and replayed
+// from: the path after /rest/ with '/' as '_', then "@" and the folder parameter if
+// there is one, e.g. "db_status@docs.json".
+func FixtureName(path string, query url.Values) string {
+	name := strings.ReplaceAll(strings.TrimPrefix(path, "/rest/"), "/", "_")
+	if folder := query.Get("folder"); folder != "" {
+		name += "@" + url.PathEscape(folder)
+	}
+	return name + ".json"
+}
+
+// Replay serves the fixtures in dir in place of the built-in answers: a GET is
+// answered with the fixture named for its path and folder or, failing that, for its
+// path alone ("db_status.json" for the status of any folder). Faults still apply.
+func (s *Server) Replay(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	fixtures := map[string][]byte{}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		body, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return err
+		}
+		fixtures[e.Name()] = body
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fixtures = fixtures
+	return nil
+}
+
+func (s *Server) fixture(r *http.Request) ([]byte, bool) {
+	if r.Method != http.MethodGet || s.fixtures == nil {
+		return nil, false
+	}
+	if body, ok := s.fixtures[FixtureName(r.URL.Path, r.URL.Query())]; ok {
+		return body, true
+	}
+	body, ok := s.fixtures[FixtureName(r.URL.Path, nil)]
+	return body, ok
+}